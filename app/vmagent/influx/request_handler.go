@@ -1,7 +1,6 @@
 package influx
 
 import (
-	"flag"
 	"io"
 	"net/http"
 	"sync"
@@ -10,6 +9,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/influxutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/influx"
@@ -19,13 +19,6 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 )
 
-var (
-	measurementFieldSeparator = flag.String("influxMeasurementFieldSeparator", "_", "Separator for '{measurement}{separator}{field_name}' metric name when inserted via InfluxDB line protocol")
-	skipSingleField           = flag.Bool("influxSkipSingleField", false, "Uses '{measurement}' instead of '{measurement}{separator}{field_name}' for metric name if InfluxDB line contains only a single field")
-	skipMeasurement           = flag.Bool("influxSkipMeasurement", false, "Uses '{field_name}' as a metric name while ignoring '{measurement}' and '-influxMeasurementFieldSeparator'")
-	dbLabel                   = flag.String("influxDBLabel", "db", "Default label for the DB name sent over '?db={db_name}' query parameter")
-)
-
 var (
 	rowsInserted       = metrics.NewCounter(`vmagent_rows_inserted_total{type="influx"}`)
 	rowsTenantInserted = tenantmetrics.NewCounterMap(`vmagent_tenant_inserted_rows_total{type="influx"}`)
@@ -77,7 +70,7 @@ func insertRows(at *auth.Token, db string, rows []influx.Row, extraLabels []prom
 		hasDBKey := false
 		for j := range r.Tags {
 			tag := &r.Tags[j]
-			if tag.Key == *dbLabel {
+			if tag.Key == *influxutil.DBLabel {
 				hasDBKey = true
 			}
 			commonLabels = append(commonLabels, prompb.Label{
@@ -87,19 +80,19 @@ func insertRows(at *auth.Token, db string, rows []influx.Row, extraLabels []prom
 		}
 		if len(db) > 0 && !hasDBKey {
 			commonLabels = append(commonLabels, prompb.Label{
-				Name:  *dbLabel,
+				Name:  *influxutil.DBLabel,
 				Value: db,
 			})
 		}
 		commonLabels = append(commonLabels, extraLabels...)
 		ctx.metricGroupBuf = ctx.metricGroupBuf[:0]
-		if !*skipMeasurement {
+		if !*influxutil.SkipMeasurement {
 			ctx.metricGroupBuf = append(ctx.metricGroupBuf, r.Measurement...)
 		}
 		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1139
-		skipFieldKey := len(r.Measurement) > 0 && len(r.Fields) == 1 && *skipSingleField
+		skipFieldKey := len(r.Measurement) > 0 && len(r.Fields) == 1 && *influxutil.SkipSingleField
 		if len(ctx.metricGroupBuf) > 0 && !skipFieldKey {
-			ctx.metricGroupBuf = append(ctx.metricGroupBuf, *measurementFieldSeparator...)
+			ctx.metricGroupBuf = append(ctx.metricGroupBuf, *influxutil.MeasurementFieldSeparator...)
 		}
 		for j := range r.Fields {
 			f := &r.Fields[j]
@@ -69,6 +69,9 @@ func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, mms []prompb.Met
 		tssDst = append(tssDst, prompb.TimeSeries{
 			Labels:  labels[labelsLen:],
 			Samples: samples[samplesLen:],
+
+			// Exemplars refer to the request buffer, which remains valid until the TryPush call below returns.
+			Exemplars: ts.Exemplars,
 		})
 	}
 	ctx.WriteRequest.Timeseries = tssDst
@@ -77,6 +77,26 @@ var (
 	oauth2TokenURL = flagutil.NewArrayString("remoteWrite.oauth2.tokenUrl", "Optional OAuth2 tokenURL to use for the corresponding -remoteWrite.url")
 	oauth2Scopes   = flagutil.NewArrayString("remoteWrite.oauth2.scopes", "Optional OAuth2 scopes to use for the corresponding -remoteWrite.url. Scopes must be delimited by ';'")
 
+	azureADUseManagedIdentity = flagutil.NewArrayBool("remoteWrite.azuread.useManagedIdentity", "Whether to obtain access tokens for the corresponding -remoteWrite.url "+
+		"via Azure managed identity. See https://docs.victoriametrics.com/victoriametrics/vmagent/#azure-ad-and-google-iam-authorization")
+	azureADUseWorkloadIdentity = flagutil.NewArrayBool("remoteWrite.azuread.useWorkloadIdentity", "Whether to obtain access tokens for the corresponding -remoteWrite.url "+
+		"via Azure workload identity. See https://docs.victoriametrics.com/victoriametrics/vmagent/#azure-ad-and-google-iam-authorization")
+	azureADClientID = flagutil.NewArrayString("remoteWrite.azuread.clientID", "Optional client id of Azure managed identity or workload identity application for the corresponding -remoteWrite.url. "+
+		"AZURE_CLIENT_ID env var is used for workload identity if it isn't set")
+	azureADTenantID = flagutil.NewArrayString("remoteWrite.azuread.tenantID", "Optional tenant id of Azure workload identity application for the corresponding -remoteWrite.url. "+
+		"AZURE_TENANT_ID env var is used if it isn't set")
+	azureADCloud = flagutil.NewArrayString("remoteWrite.azuread.cloud", "Optional Azure cloud for the corresponding -remoteWrite.url. "+
+		"Supported values: AzurePublic, AzureChina, AzureGovernment. Defaults to AzurePublic")
+	azureADScope = flagutil.NewArrayString("remoteWrite.azuread.scope", "Optional scope for Azure access tokens for the corresponding -remoteWrite.url. "+
+		"Defaults to Azure Monitor scope for -remoteWrite.azuread.cloud")
+
+	googleIAMEnabled = flagutil.NewArrayBool("remoteWrite.googleIAM.enabled", "Whether to obtain access tokens for the corresponding -remoteWrite.url from Google Cloud IAM. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#azure-ad-and-google-iam-authorization")
+	googleIAMCredentialsFile = flagutil.NewArrayString("remoteWrite.googleIAM.credentialsFile", "Optional path to Google Cloud credentials file for the corresponding -remoteWrite.url. "+
+		"Application default credentials are used if it isn't set")
+	googleIAMScopes = flagutil.NewArrayString("remoteWrite.googleIAM.scopes", "Optional OAuth2 scopes for Google Cloud access tokens for the corresponding -remoteWrite.url. "+
+		"Scopes must be delimited by ';'. Defaults to https://www.googleapis.com/auth/cloud-platform")
+
 	awsUseSigv4 = flagutil.NewArrayBool("remoteWrite.aws.useSigv4", "Enables SigV4 request signing for the corresponding -remoteWrite.url. "+
 		"It is expected that other -remoteWrite.aws.* command-line flags are set if sigv4 request signing is enabled")
 	awsEC2Endpoint = flagutil.NewArrayString("remoteWrite.aws.ec2Endpoint", "Optional AWS EC2 API endpoint to use for the corresponding -remoteWrite.url if -remoteWrite.aws.useSigv4 is set")
@@ -276,6 +296,37 @@ func getAuthConfig(argIdx int) (*promauth.Config, error) {
 		}
 	}
 
+	var azureADCfg *promauth.AzureADConfig
+	useManagedIdentity := azureADUseManagedIdentity.GetOptionalArg(argIdx)
+	useWorkloadIdentity := azureADUseWorkloadIdentity.GetOptionalArg(argIdx)
+	if useManagedIdentity || useWorkloadIdentity {
+		azureADCfg = &promauth.AzureADConfig{
+			Cloud: azureADCloud.GetOptionalArg(argIdx),
+			Scope: azureADScope.GetOptionalArg(argIdx),
+		}
+		if useManagedIdentity {
+			azureADCfg.ManagedIdentity = &promauth.AzureManagedIdentityConfig{
+				ClientID: azureADClientID.GetOptionalArg(argIdx),
+			}
+		}
+		if useWorkloadIdentity {
+			azureADCfg.WorkloadIdentity = &promauth.AzureWorkloadIdentityConfig{
+				ClientID: azureADClientID.GetOptionalArg(argIdx),
+				TenantID: azureADTenantID.GetOptionalArg(argIdx),
+			}
+		}
+	}
+
+	var googleIAMCfg *promauth.GoogleIAMConfig
+	if googleIAMEnabled.GetOptionalArg(argIdx) {
+		googleIAMCfg = &promauth.GoogleIAMConfig{
+			CredentialsFile: googleIAMCredentialsFile.GetOptionalArg(argIdx),
+		}
+		if scopes := googleIAMScopes.GetOptionalArg(argIdx); scopes != "" {
+			googleIAMCfg.Scopes = strings.Split(scopes, ";")
+		}
+	}
+
 	tlsCfg := &promauth.TLSConfig{
 		CAFile:             tlsCAFile.GetOptionalArg(argIdx),
 		CertFile:           tlsCertFile.GetOptionalArg(argIdx),
@@ -289,6 +340,8 @@ func getAuthConfig(argIdx int) (*promauth.Config, error) {
 		BearerToken:     token,
 		BearerTokenFile: tokenFile,
 		OAuth2:          oauth2Cfg,
+		AzureAD:         azureADCfg,
+		GoogleIAM:       googleIAMCfg,
 		TLSConfig:       tlsCfg,
 		Headers:         hdrs,
 	}
@@ -114,10 +114,12 @@ type writeRequest struct {
 
 	wr prompb.WriteRequest
 
-	tss     []prompb.TimeSeries
-	mms     []prompb.MetricMetadata
-	labels  []prompb.Label
-	samples []prompb.Sample
+	tss            []prompb.TimeSeries
+	mms            []prompb.MetricMetadata
+	labels         []prompb.Label
+	samples        []prompb.Sample
+	exemplars      []prompb.Exemplar
+	exemplarLabels []prompb.Label
 
 	// buf holds labels data
 	buf []byte
@@ -141,6 +143,13 @@ func (wr *writeRequest) reset() {
 	wr.labels = wr.labels[:0]
 
 	wr.samples = wr.samples[:0]
+
+	clear(wr.exemplars)
+	wr.exemplars = wr.exemplars[:0]
+
+	promrelabel.CleanLabels(wr.exemplarLabels)
+	wr.exemplarLabels = wr.exemplarLabels[:0]
+
 	wr.buf = wr.buf[:0]
 	wr.metadatabuf = wr.metadatabuf[:0]
 }
@@ -261,12 +270,42 @@ func (wr *writeRequest) tryPushTimeSeries(src []prompb.TimeSeries) bool {
 }
 
 func (wr *writeRequest) copyTimeSeries(dst, src *prompb.TimeSeries) {
-	labelsSrc := src.Labels
+	labelsLen := len(wr.labels)
+	wr.labels = wr.copyLabels(wr.labels, src.Labels)
+	dst.Labels = wr.labels[labelsLen:]
+
+	// Copy samples
+	samplesLen := len(wr.samples)
+	wr.samples = append(wr.samples, src.Samples...)
+	dst.Samples = wr.samples[samplesLen:]
+
+	// Copy exemplars
+	dst.Exemplars = nil
+	if len(src.Exemplars) == 0 {
+		return
+	}
+	exemplarsLen := len(wr.exemplars)
+	for i := range src.Exemplars {
+		e := &src.Exemplars[i]
+		exemplarLabelsLen := len(wr.exemplarLabels)
+		wr.exemplarLabels = wr.copyLabels(wr.exemplarLabels, e.Labels)
+		wr.exemplars = append(wr.exemplars, prompb.Exemplar{
+			Labels:    wr.exemplarLabels[exemplarLabelsLen:],
+			Value:     e.Value,
+			Timestamp: e.Timestamp,
+		})
+	}
+	dst.Exemplars = wr.exemplars[exemplarsLen:]
+}
 
+// copyLabels appends copies of labelsSrc to dst and returns the result.
+//
+// Label names and values are copied to wr.buf.
+func (wr *writeRequest) copyLabels(dst, labelsSrc []prompb.Label) []prompb.Label {
 	// Pre-allocate memory for labels.
-	labelsLen := len(wr.labels)
-	wr.labels = slicesutil.SetLength(wr.labels, labelsLen+len(labelsSrc))
-	labelsDst := wr.labels[labelsLen:]
+	labelsLen := len(dst)
+	dst = slicesutil.SetLength(dst, labelsLen+len(labelsSrc))
+	labelsDst := dst[labelsLen:]
 
 	// Pre-allocate memory for byte slice needed for storing label names and values.
 	neededBufLen := 0
@@ -292,12 +331,7 @@ func (wr *writeRequest) copyTimeSeries(dst, src *prompb.TimeSeries) {
 		dstLabel.Value = bytesutil.ToUnsafeString(buf[bufLen:])
 	}
 	wr.buf = buf
-	dst.Labels = labelsDst
-
-	// Copy samples
-	samplesLen := len(wr.samples)
-	wr.samples = append(wr.samples, src.Samples...)
-	dst.Samples = wr.samples[samplesLen:]
+	return dst
 }
 
 // marshalConcurrency limits the maximum number of concurrent workers, which marshal and compress WriteRequest.
@@ -367,13 +401,16 @@ func tryPushWriteRequest(wr *prompb.WriteRequest, tryPushBlock func(block []byte
 	case 1:
 		// A single time series left. Recursively split its samples and metadata into smaller parts if possible.
 		samples := wr.Timeseries[0].Samples
+		exemplars := wr.Timeseries[0].Exemplars
 		metaData := wr.Metadata
-		if len(samples) == 1 && len(metaData) <= 1 {
-			logger.Warnf("dropping a sample for metric and %d metadata which are exceeding -remoteWrite.maxBlockSize=%d bytes", len(metaData), maxUnpackedBlockSize.N)
+		if len(samples) <= 1 && len(metaData) <= 1 {
+			logger.Warnf("dropping %d samples and %d exemplars for metric and %d metadata which are exceeding -remoteWrite.maxBlockSize=%d bytes",
+				len(samples), len(exemplars), len(metaData), maxUnpackedBlockSize.N)
 			return true
 		}
 		n := len(samples) / 2
 		m := len(metaData) / 2
+		// Send exemplars only with the first part in order to avoid their duplication.
 		wr.Timeseries[0].Samples = samples[:n]
 		wr.Metadata = metaData[:m]
 		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite) {
@@ -382,13 +419,16 @@ func tryPushWriteRequest(wr *prompb.WriteRequest, tryPushBlock func(block []byte
 			return false
 		}
 		wr.Timeseries[0].Samples = samples[n:]
+		wr.Timeseries[0].Exemplars = nil
 		wr.Metadata = metaData[m:]
 		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite) {
 			wr.Timeseries[0].Samples = samples
+			wr.Timeseries[0].Exemplars = exemplars
 			wr.Metadata = metaData
 			return false
 		}
 		wr.Timeseries[0].Samples = samples
+		wr.Timeseries[0].Exemplars = exemplars
 		wr.Metadata = metaData
 		return true
 
@@ -1,11 +1,15 @@
 package remotewrite
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"testing"
 
+	"github.com/golang/snappy"
+
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 )
 
 func TestPushWriteRequest(t *testing.T) {
@@ -71,3 +75,105 @@ func newTestWriteRequest(seriesCount, labelsCount int) *prompb.WriteRequest {
 	}
 	return &wr
 }
+
+func TestPushWriteRequest_Exemplars(t *testing.T) {
+	exemplars := []prompb.Exemplar{
+		{
+			Labels: []prompb.Label{
+				{
+					Name:  "trace_id",
+					Value: "abc",
+				},
+			},
+			Value:     1.5,
+			Timestamp: 1000,
+		},
+	}
+	src := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels: []prompb.Label{
+					{
+						Name:  "__name__",
+						Value: "foo",
+					},
+				},
+				Samples: []prompb.Sample{
+					{
+						Value:     1,
+						Timestamp: 1000,
+					},
+				},
+				Exemplars: exemplars,
+			},
+			{
+				// Prometheus may send exemplars without samples.
+				Labels: []prompb.Label{
+					{
+						Name:  "__name__",
+						Value: "bar",
+					},
+				},
+				Exemplars: exemplars,
+			},
+		},
+	}
+	data := src.MarshalProtobuf(nil)
+
+	wru := prompb.GetWriteRequestUnmarshaler()
+	defer prompb.PutWriteRequestUnmarshaler(wru)
+	wrSrc, err := wru.UnmarshalProtobuf(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal write request: %s", err)
+	}
+
+	pcs, err := promrelabel.ParseRelabelConfigsData([]byte(`
+- target_label: job
+  replacement: test
+`))
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+	rctx := &relabelCtx{}
+	tss := rctx.applyRelabeling(wrSrc.Timeseries, pcs)
+
+	var wr writeRequest
+	if !wr.tryPushTimeSeries(tss) {
+		t.Fatalf("cannot push time series")
+	}
+
+	// Make sure the pushed data doesn't refer to the source buffer.
+	clear(data)
+	rctx.reset()
+
+	wr.wr.Timeseries = wr.tss
+	var pushedData []byte
+	pushBlock := func(block []byte) bool {
+		pushedData, err = snappy.Decode(nil, block)
+		if err != nil {
+			t.Fatalf("cannot decode pushed block: %s", err)
+		}
+		return true
+	}
+	if !tryPushWriteRequest(&wr.wr, pushBlock, false) {
+		t.Fatalf("cannot push write request")
+	}
+
+	wruDst := prompb.GetWriteRequestUnmarshaler()
+	defer prompb.PutWriteRequestUnmarshaler(wruDst)
+	wrDst, err := wruDst.UnmarshalProtobuf(pushedData)
+	if err != nil {
+		t.Fatalf("cannot unmarshal pushed write request: %s", err)
+	}
+
+	for i := range src.Timeseries {
+		src.Timeseries[i].Labels = append(src.Timeseries[i].Labels, prompb.Label{
+			Name:  "job",
+			Value: "test",
+		})
+	}
+	// Compare marshaled requests, since the unmarshaled exemplar-only series contains an empty non-nil samples slice.
+	if !bytes.Equal(wrDst.MarshalProtobuf(nil), src.MarshalProtobuf(nil)) {
+		t.Fatalf("unexpected time series pushed\ngot\n%v\nwant\n%v", wrDst.Timeseries, src.Timeseries)
+	}
+}
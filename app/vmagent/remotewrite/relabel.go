@@ -250,8 +250,9 @@ func (rctx *relabelCtx) applyRelabeling(tss []prompb.TimeSeries, pcs *promrelabe
 			fixPromCompatibleNaming(labels[labelsLen:])
 		}
 		tssDst = append(tssDst, prompb.TimeSeries{
-			Labels:  labels[labelsLen:],
-			Samples: ts.Samples,
+			Labels:    labels[labelsLen:],
+			Samples:   ts.Samples,
+			Exemplars: ts.Exemplars,
 		})
 	}
 	rctx.labels = labels
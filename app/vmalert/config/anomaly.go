@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
+)
+
+// Supported anomaly detection methods.
+const (
+	// AnomalyMethodZScore compares the current value with the average over the lookback window
+	// in units of standard deviation.
+	AnomalyMethodZScore = "zscore"
+	// AnomalyMethodMAD compares the current value with the median over the lookback window
+	// in units of median absolute deviation.
+	AnomalyMethodMAD = "mad"
+	// AnomalyMethodSeasonal compares the current value with the values
+	// observed over the lookback window one season ago.
+	AnomalyMethodSeasonal = "seasonal"
+)
+
+const (
+	defaultAnomalyLookback         = 24 * time.Hour
+	defaultAnomalySeasonalLookback = time.Hour
+	defaultAnomalySeason           = 7 * 24 * time.Hour
+	defaultAnomalyThreshold        = 3
+)
+
+// AnomalyDetector configures baseline calculation for anomaly rules.
+type AnomalyDetector struct {
+	// Method is one of zscore, mad or seasonal.
+	Method string `yaml:"method"`
+	// Lookback is the window for calculating the baseline.
+	Lookback *promutil.Duration `yaml:"lookback,omitempty"`
+	// Season is the offset for the seasonal baseline.
+	Season *promutil.Duration `yaml:"season,omitempty"`
+	// Threshold is the absolute anomaly score value for triggering the alert.
+	Threshold *float64 `yaml:"threshold,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]any `yaml:",inline"`
+}
+
+// GetLookback returns the window for calculating the baseline
+func (ad *AnomalyDetector) GetLookback() time.Duration {
+	if d := ad.Lookback.Duration(); d > 0 {
+		return d
+	}
+	if ad.Method == AnomalyMethodSeasonal {
+		return defaultAnomalySeasonalLookback
+	}
+	return defaultAnomalyLookback
+}
+
+// GetSeason returns the offset for the seasonal baseline
+func (ad *AnomalyDetector) GetSeason() time.Duration {
+	if d := ad.Season.Duration(); d > 0 {
+		return d
+	}
+	return defaultAnomalySeason
+}
+
+// GetThreshold returns the absolute anomaly score value for triggering the alert
+func (ad *AnomalyDetector) GetThreshold() float64 {
+	if ad.Threshold != nil {
+		return *ad.Threshold
+	}
+	return defaultAnomalyThreshold
+}
+
+// String implements Stringer interface
+func (ad *AnomalyDetector) String() string {
+	s := fmt.Sprintf("method=%s; lookback=%s; threshold=%v", ad.Method, ad.GetLookback(), ad.GetThreshold())
+	if ad.Method == AnomalyMethodSeasonal {
+		s += fmt.Sprintf("; season=%s", ad.GetSeason())
+	}
+	return s
+}
+
+// Validate checks AnomalyDetector configuration errors
+func (ad *AnomalyDetector) Validate() error {
+	switch ad.Method {
+	case AnomalyMethodZScore, AnomalyMethodMAD:
+		if ad.Season != nil {
+			return fmt.Errorf("`season` can be set only for %q method", AnomalyMethodSeasonal)
+		}
+	case AnomalyMethodSeasonal:
+		if ad.Season.Duration() < 0 {
+			return fmt.Errorf("season shouldn't be lower than 0")
+		}
+		if ad.GetLookback() > ad.GetSeason() {
+			return fmt.Errorf("lookback %s shouldn't be bigger than season %s", ad.GetLookback(), ad.GetSeason())
+		}
+	default:
+		return fmt.Errorf("unknown method %q; want %q, %q or %q", ad.Method, AnomalyMethodZScore, AnomalyMethodMAD, AnomalyMethodSeasonal)
+	}
+	if ad.Lookback.Duration() < 0 {
+		return fmt.Errorf("lookback shouldn't be lower than 0")
+	}
+	if ad.GetThreshold() <= 0 {
+		return fmt.Errorf("threshold must be greater than 0; got %v", ad.GetThreshold())
+	}
+	return checkOverflow(ad.XXX, "detector")
+}
@@ -50,6 +50,9 @@ type Group struct {
 	EvalAlignment *bool `yaml:"eval_alignment,omitempty"`
 	// Debug enables debug logs for the group
 	Debug bool `yaml:"debug,omitempty"`
+	// SLO contains Service Level Objective definition for groups of type `slo`.
+	// Rules for such groups are generated from SLO definition.
+	SLO *SLO `yaml:"slo,omitempty"`
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]any `yaml:",inline"`
 }
@@ -70,6 +73,25 @@ func (g *Group) UnmarshalYAML(unmarshal func(any) error) error {
 	h := fnv.New64a()
 	h.Write(b)
 	g.Checksum = fmt.Sprintf("%x", h.Sum(nil))
+
+	if g.Type.Get() != sloType {
+		if g.SLO != nil {
+			return fmt.Errorf("group %q: `slo` can be set only for groups with type %q", g.Name, sloType)
+		}
+		return nil
+	}
+	if g.SLO == nil {
+		return fmt.Errorf("group %q: `slo` must be set for groups with type %q", g.Name, sloType)
+	}
+	if len(g.Rules) > 0 {
+		return fmt.Errorf("group %q: `rules` can't be set for groups with type %q; they are generated from `slo`", g.Name, sloType)
+	}
+	if g.SLO.Name == "" {
+		g.SLO.Name = g.Name
+	}
+	// SLO rules are evaluated via prometheus datasource
+	g.Type = NewPrometheusType()
+	g.Rules = g.SLO.Rules()
 	return nil
 }
 
@@ -94,13 +116,15 @@ func (g *Group) Validate(validateTplFn ValidateTplFn, validateExpressions bool)
 	if g.Concurrency < 0 {
 		return fmt.Errorf("invalid concurrency %d, shouldn't be less than 0", g.Concurrency)
 	}
+	if g.SLO != nil {
+		if err := g.SLO.Validate(); err != nil {
+			return fmt.Errorf("invalid slo: %w", err)
+		}
+	}
 
 	uniqueRules := map[uint64]struct{}{}
 	for _, r := range g.Rules {
-		ruleName := r.Record
-		if r.Alert != "" {
-			ruleName = r.Alert
-		}
+		ruleName := r.Name()
 		if _, ok := uniqueRules[r.ID]; ok {
 			return fmt.Errorf("%q is a duplicate in group", r.String())
 		}
@@ -108,6 +132,9 @@ func (g *Group) Validate(validateTplFn ValidateTplFn, validateExpressions bool)
 		if err := r.Validate(); err != nil {
 			return fmt.Errorf("invalid rule %q: %w", ruleName, err)
 		}
+		if r.Anomaly != "" && g.Type.String() != "prometheus" {
+			return fmt.Errorf("invalid rule %q: anomaly rules are supported only for groups with type %q", ruleName, "prometheus")
+		}
 		if validateExpressions {
 			// its needed only for tests.
 			// because correct types must be inherited after unmarshalling.
@@ -129,13 +156,16 @@ func (g *Group) Validate(validateTplFn ValidateTplFn, validateExpressions bool)
 }
 
 // Rule describes entity that represent either
-// recording rule or alerting rule.
+// recording rule, alerting rule or anomaly rule.
 type Rule struct {
-	ID     uint64
-	Record string             `yaml:"record,omitempty"`
-	Alert  string             `yaml:"alert,omitempty"`
-	Expr   string             `yaml:"expr"`
-	For    *promutil.Duration `yaml:"for,omitempty"`
+	ID      uint64
+	Record  string             `yaml:"record,omitempty"`
+	Alert   string             `yaml:"alert,omitempty"`
+	Anomaly string             `yaml:"anomaly,omitempty"`
+	Expr    string             `yaml:"expr"`
+	For     *promutil.Duration `yaml:"for,omitempty"`
+	// Detector configures baseline calculation for anomaly rules.
+	Detector *AnomalyDetector `yaml:"detector,omitempty"`
 	// Alert will continue firing for this long even when the alerting expression no longer has results.
 	KeepFiringFor *promutil.Duration `yaml:"keep_firing_for,omitempty"`
 	Labels        map[string]string  `yaml:"labels,omitempty"`
@@ -164,6 +194,9 @@ func (r *Rule) Name() string {
 	if r.Record != "" {
 		return r.Record
 	}
+	if r.Anomaly != "" {
+		return r.Anomaly
+	}
 	return r.Alert
 }
 
@@ -173,6 +206,9 @@ func (r *Rule) String() string {
 	if r.Alert != "" {
 		ruleType = "alerting"
 	}
+	if r.Anomaly != "" {
+		ruleType = "anomaly"
+	}
 	var b strings.Builder
 	fmt.Fprintf(&b, "%s rule %q", ruleType, r.Name())
 	fmt.Fprintf(&b, "; expr: %q", r.Expr)
@@ -198,10 +234,17 @@ func (r *Rule) String() string {
 func HashRule(r Rule) uint64 {
 	h := fnv.New64a()
 	h.Write([]byte(r.Expr))
-	if r.Record != "" {
+	switch {
+	case r.Record != "":
 		h.Write([]byte("recording"))
 		h.Write([]byte(r.Record))
-	} else {
+	case r.Anomaly != "":
+		h.Write([]byte("anomaly"))
+		h.Write([]byte(r.Anomaly))
+		if r.Detector != nil {
+			h.Write([]byte(r.Detector.String()))
+		}
+	default:
 		h.Write([]byte("alerting"))
 		h.Write([]byte(r.Alert))
 	}
@@ -216,12 +259,29 @@ func HashRule(r Rule) uint64 {
 
 // Validate check for Rule configuration errors
 func (r *Rule) Validate() error {
-	if (r.Record == "" && r.Alert == "") || (r.Record != "" && r.Alert != "") {
-		return fmt.Errorf("either `record` or `alert` must be set")
+	var kinds int
+	for _, name := range []string{r.Record, r.Alert, r.Anomaly} {
+		if name != "" {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("either `record`, `alert` or `anomaly` must be set")
 	}
 	if r.Expr == "" {
 		return fmt.Errorf("expression can't be empty")
 	}
+	if r.Anomaly == "" && r.Detector != nil {
+		return fmt.Errorf("`detector` can be set only for anomaly rules")
+	}
+	if r.Anomaly != "" {
+		if r.Detector == nil {
+			return fmt.Errorf("`detector` must be set for anomaly rules")
+		}
+		if err := r.Detector.Validate(); err != nil {
+			return fmt.Errorf("invalid detector: %w", err)
+		}
+	}
 	if _, ok := r.Labels["__name__"]; ok {
 		return fmt.Errorf("invalid rule label __name__")
 	}
@@ -264,6 +324,13 @@ func Parse(pathPatterns []string, validateTplFn ValidateTplFn, validateExpressio
 	return groups, nil
 }
 
+// ParseData parses rule configs from the given files content,
+// where key is a file name and value is the file content.
+// It applies the same validation as Parse.
+func ParseData(files map[string][]byte, validateTplFn ValidateTplFn, validateExpressions bool) ([]Group, error) {
+	return parse(files, validateTplFn, validateExpressions)
+}
+
 func parse(files map[string][]byte, validateTplFn ValidateTplFn, validateExpressions bool) ([]Group, error) {
 	errGroup := new(vmalertutil.ErrGroup)
 	var groups []Group
@@ -119,8 +119,8 @@ func TestParse_Failure(t *testing.T) {
 	f([]string{"testdata/dir/rules0-bad.rules"}, "invalid annotations")
 	f([]string{"testdata/dir/rules1-bad.rules"}, "duplicate in file")
 	f([]string{"testdata/dir/rules2-bad.rules"}, "function \"unknown\" not defined")
-	f([]string{"testdata/dir/rules3-bad.rules"}, "either `record` or `alert` must be set")
-	f([]string{"testdata/dir/rules4-bad.rules"}, "either `record` or `alert` must be set")
+	f([]string{"testdata/dir/rules3-bad.rules"}, "either `record`, `alert` or `anomaly` must be set")
+	f([]string{"testdata/dir/rules4-bad.rules"}, "either `record`, `alert` or `anomaly` must be set")
 	f([]string{"testdata/rules/rules1-bad.rules"}, "bad GraphiteQL expr")
 	f([]string{"testdata/rules/vlog-rules0-bad.rules"}, "bad LogsQL expr")
 	f([]string{"testdata/dir/rules6-bad.rules"}, "missing ':' in header")
@@ -174,6 +174,68 @@ groups:
 
 	f([]byte(`
 groups:
+- name: anomaly without detector
+  rules:
+  - anomaly: foo
+    expr: sum(up)
+`), false, "`detector` must be set for anomaly rules")
+
+	f([]byte(`
+groups:
+- name: detector for alerting rule
+  rules:
+  - alert: foo
+    expr: sum(up)
+    detector:
+      method: zscore
+`), false, "`detector` can be set only for anomaly rules")
+
+	f([]byte(`
+groups:
+- name: unknown anomaly method
+  rules:
+  - anomaly: foo
+    expr: sum(up)
+    detector:
+      method: prophet
+`), false, "unknown method")
+
+	f([]byte(`
+groups:
+- name: season for zscore
+  rules:
+  - anomaly: foo
+    expr: sum(up)
+    detector:
+      method: zscore
+      season: 1w
+`), false, "`season` can be set only")
+
+	f([]byte(`
+groups:
+- name: lookback bigger than season
+  rules:
+  - anomaly: foo
+    expr: sum(up)
+    detector:
+      method: seasonal
+      lookback: 2d
+      season: 1d
+`), false, "shouldn't be bigger than season")
+
+	f([]byte(`
+groups:
+- name: anomaly for graphite
+  type: graphite
+  rules:
+  - anomaly: foo
+    expr: sumSeries(foo.bar)
+    detector:
+      method: zscore
+`), false, "anomaly rules are supported only for groups with type")
+
+	f([]byte(`
+groups:
 - name: negative interval
   interval: -1ms
 `), false, "interval shouldn't be lower than 0")
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
+)
+
+// sloType is a group type for generating SLO rules.
+// Groups of this type are converted into regular prometheus groups
+// with recording and alerting rules generated from SLO definition.
+const sloType = "slo"
+
+// sloWindowPlaceholder is replaced with the rate window in SLI queries.
+const sloWindowPlaceholder = "{{.window}}"
+
+// sloLabel is a label attached to every series generated for SLO.
+const sloLabel = "slo_name"
+
+// SLO describes Service Level Objective for the group of type `slo`.
+//
+// SLO is converted into recording rules for error ratios over standard windows,
+// error budget series and multi-window multi-burn-rate alerting rules.
+// See https://sre.google/workbook/alerting-on-slos/
+type SLO struct {
+	// Name of the SLO. Defaults to the group name.
+	Name string `yaml:"name,omitempty"`
+	// Objective is the target percentage of good events, e.g. 99.9.
+	Objective float64 `yaml:"objective"`
+	// Window is the SLO compliance period. Defaults to 30d.
+	Window *promutil.Duration `yaml:"window,omitempty"`
+	// SLI contains queries for good and total events.
+	SLI SLI `yaml:"sli"`
+	// Alerting configures generated alerting rules.
+	Alerting SLOAlerting `yaml:"alerting,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]any `yaml:",inline"`
+}
+
+// SLI contains queries for calculating Service Level Indicator.
+//
+// Both queries must contain `{{.window}}` placeholder,
+// which is replaced with the rate window on rules generation.
+type SLI struct {
+	Good  string `yaml:"good"`
+	Total string `yaml:"total"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]any `yaml:",inline"`
+}
+
+// SLOAlerting configures alerting rules generated for SLO.
+type SLOAlerting struct {
+	// Name of generated alerts. Defaults to `<SLO name>ErrorBudgetBurn`.
+	Name        string            `yaml:"name,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	PageAlert   SLOAlert          `yaml:"page_alert,omitempty"`
+	TicketAlert SLOAlert          `yaml:"ticket_alert,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]any `yaml:",inline"`
+}
+
+// SLOAlert configures one of the generated alerting rules.
+type SLOAlert struct {
+	Disable     bool              `yaml:"disable,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+
+	// Catches all undefined fields and must be empty after parsing.
+	XXX map[string]any `yaml:",inline"`
+}
+
+const defaultSLOWindow = 30 * 24 * time.Hour
+
+// burnRateWindow defines a pair of windows for multi-window burn-rate alert
+// and the share of the error budget which is allowed to be consumed over the long window.
+type burnRateWindow struct {
+	short, long    time.Duration
+	budgetConsumed float64
+}
+
+// See https://sre.google/workbook/alerting-on-slos/#6-multiwindow-multi-burn-rate-alerts
+var (
+	pageBurnRateWindows = []burnRateWindow{
+		{short: 5 * time.Minute, long: time.Hour, budgetConsumed: 0.02},
+		{short: 30 * time.Minute, long: 6 * time.Hour, budgetConsumed: 0.05},
+	}
+	ticketBurnRateWindows = []burnRateWindow{
+		{short: 2 * time.Hour, long: 24 * time.Hour, budgetConsumed: 0.1},
+		{short: 6 * time.Hour, long: 3 * 24 * time.Hour, budgetConsumed: 0.1},
+	}
+)
+
+// sloRateWindows contains windows for which error ratio recording rules are generated.
+var sloRateWindows = []time.Duration{
+	5 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+}
+
+func (s *SLO) window() time.Duration {
+	if d := s.Window.Duration(); d > 0 {
+		return d
+	}
+	return defaultSLOWindow
+}
+
+func (s *SLO) alertName() string {
+	if s.Alerting.Name != "" {
+		return s.Alerting.Name
+	}
+	return s.Name + "ErrorBudgetBurn"
+}
+
+// Validate checks SLO configuration errors
+func (s *SLO) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("slo name must be set")
+	}
+	if s.Objective <= 0 || s.Objective >= 100 {
+		return fmt.Errorf("objective must be in range (0, 100); got %v", s.Objective)
+	}
+	if s.Window.Duration() < 0 {
+		return fmt.Errorf("window shouldn't be lower than 0")
+	}
+	// The window must exceed the longest burn-rate window. This also guarantees that the recording rule for the SLO window
+	// doesn't write the same series as the recording rule for some of the rate windows.
+	if w := s.window(); w <= 3*24*time.Hour {
+		return fmt.Errorf("window must be longer than 3d; got %s", FormatDuration(w))
+	}
+	if s.SLI.Good == "" || s.SLI.Total == "" {
+		return fmt.Errorf("both `sli.good` and `sli.total` queries must be set")
+	}
+	for _, q := range []string{s.SLI.Good, s.SLI.Total} {
+		if !strings.Contains(q, sloWindowPlaceholder) {
+			return fmt.Errorf("sli query %q must contain %s placeholder", q, sloWindowPlaceholder)
+		}
+	}
+	if err := checkOverflow(s.XXX, "slo"); err != nil {
+		return err
+	}
+	if err := checkOverflow(s.SLI.XXX, "slo.sli"); err != nil {
+		return err
+	}
+	if err := checkOverflow(s.Alerting.XXX, "slo.alerting"); err != nil {
+		return err
+	}
+	if err := checkOverflow(s.Alerting.PageAlert.XXX, "slo.alerting.page_alert"); err != nil {
+		return err
+	}
+	return checkOverflow(s.Alerting.TicketAlert.XXX, "slo.alerting.ticket_alert")
+}
+
+// Rules generates recording and alerting rules for SLO.
+func (s *SLO) Rules() []Rule {
+	var rules []Rule
+	budget := 1 - s.Objective/100
+	selector := fmt.Sprintf("{%s=%q}", sloLabel, s.Name)
+
+	add := func(r Rule) {
+		r.ID = HashRule(r)
+		rules = append(rules, r)
+	}
+	recordLabels := map[string]string{sloLabel: s.Name}
+
+	for _, w := range sloRateWindows {
+		add(Rule{
+			Record: sloErrorRatioName(w),
+			Expr:   s.errorRatioExpr(w),
+			Labels: recordLabels,
+		})
+	}
+	window := s.window()
+	add(Rule{
+		Record: sloErrorRatioName(window),
+		Expr:   fmt.Sprintf("avg_over_time(%s%s[%s])", sloErrorRatioName(sloRateWindows[0]), selector, FormatDuration(window)),
+		Labels: recordLabels,
+	})
+	add(Rule{
+		Record: "slo:objective:ratio",
+		Expr:   fmt.Sprintf("vector(%s)", formatFloat(s.Objective/100)),
+		Labels: recordLabels,
+	})
+	add(Rule{
+		Record: "slo:error_budget:ratio",
+		Expr:   fmt.Sprintf("vector(%s)", formatFloat(budget)),
+		Labels: recordLabels,
+	})
+	add(Rule{
+		Record: "slo:error_budget_remaining:ratio",
+		Expr:   fmt.Sprintf("1 - %s%s / %s", sloErrorRatioName(window), selector, formatFloat(budget)),
+		Labels: recordLabels,
+	})
+
+	alerts := []struct {
+		cfg      SLOAlert
+		severity string
+		windows  []burnRateWindow
+	}{
+		{cfg: s.Alerting.PageAlert, severity: "page", windows: pageBurnRateWindows},
+		{cfg: s.Alerting.TicketAlert, severity: "ticket", windows: ticketBurnRateWindows},
+	}
+	for _, a := range alerts {
+		if a.cfg.Disable {
+			continue
+		}
+		labels := map[string]string{
+			sloLabel:   s.Name,
+			"severity": a.severity,
+		}
+		annotations := make(map[string]string)
+		mergeLabels(labels, s.Alerting.Labels)
+		mergeLabels(labels, a.cfg.Labels)
+		mergeLabels(annotations, s.Alerting.Annotations)
+		mergeLabels(annotations, a.cfg.Annotations)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		add(Rule{
+			Alert:       s.alertName(),
+			Expr:        s.burnRateExpr(selector, budget, a.windows),
+			Labels:      labels,
+			Annotations: annotations,
+		})
+	}
+	return rules
+}
+
+func (s *SLO) errorRatioExpr(w time.Duration) string {
+	window := FormatDuration(w)
+	good := strings.ReplaceAll(s.SLI.Good, sloWindowPlaceholder, window)
+	total := strings.ReplaceAll(s.SLI.Total, sloWindowPlaceholder, window)
+	return fmt.Sprintf("1 - ((%s) / (%s))", good, total)
+}
+
+func (s *SLO) burnRateExpr(selector string, budget float64, windows []burnRateWindow) string {
+	var conditions []string
+	for _, w := range windows {
+		factor := w.budgetConsumed * float64(s.window()) / float64(w.long)
+		threshold := formatFloat(factor * budget)
+		conditions = append(conditions, fmt.Sprintf("(%s%s > %s and %s%s > %s)",
+			sloErrorRatioName(w.long), selector, threshold,
+			sloErrorRatioName(w.short), selector, threshold))
+	}
+	return strings.Join(conditions, " or ")
+}
+
+func sloErrorRatioName(w time.Duration) string {
+	return "slo:sli_error:ratio_rate" + FormatDuration(w)
+}
+
+// FormatDuration formats d in the shortest form supported by MetricsQL, e.g. 5m, 1h or 30d.
+func FormatDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case d%day == 0:
+		return fmt.Sprintf("%dd", d/day)
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', 10, 64)
+}
+
+func mergeLabels(dst, src map[string]string) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSLORules(t *testing.T) {
+	var g Group
+	err := yaml.Unmarshal([]byte(`
+name: api
+type: slo
+slo:
+  objective: 99.9
+  sli:
+    good: sum(rate(requests_total{code="200"}[{{.window}}]))
+    total: sum(rate(requests_total[{{.window}}]))
+  alerting:
+    labels:
+      team: foo
+    ticket_alert:
+      disable: true
+`), &g)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := g.Validate(nil, true); err != nil {
+		t.Fatalf("unexpected validation error: %s", err)
+	}
+	if g.Type.String() != "prometheus" {
+		t.Fatalf("expected group type to be converted to prometheus; got %q", g.Type.String())
+	}
+
+	rules := make(map[string]Rule)
+	for _, r := range g.Rules {
+		if r.ID != HashRule(r) {
+			t.Fatalf("rule %q has unexpected ID", r.Name())
+		}
+		rules[r.Name()] = r
+	}
+	// 7 rate windows, slo window, objective, error budget, remaining error budget and page alert
+	if len(g.Rules) != 12 {
+		t.Fatalf("expected to get 12 rules; got %d", len(g.Rules))
+	}
+
+	f := func(name, exprExpected string) {
+		t.Helper()
+		r, ok := rules[name]
+		if !ok {
+			t.Fatalf("missing rule %q", name)
+		}
+		if r.Expr != exprExpected {
+			t.Fatalf("unexpected expr for rule %q;\ngot\n%s\nwant\n%s", name, r.Expr, exprExpected)
+		}
+		if r.Labels[sloLabel] != "api" {
+			t.Fatalf("expected rule %q to have label %s=%q; got %v", name, sloLabel, "api", r.Labels)
+		}
+	}
+
+	f("slo:sli_error:ratio_rate5m", `1 - ((sum(rate(requests_total{code="200"}[5m]))) / (sum(rate(requests_total[5m]))))`)
+	f("slo:sli_error:ratio_rate3d", `1 - ((sum(rate(requests_total{code="200"}[3d]))) / (sum(rate(requests_total[3d]))))`)
+	f("slo:sli_error:ratio_rate30d", `avg_over_time(slo:sli_error:ratio_rate5m{slo_name="api"}[30d])`)
+	f("slo:objective:ratio", `vector(0.999)`)
+	f("slo:error_budget:ratio", `vector(0.001)`)
+	f("slo:error_budget_remaining:ratio", `1 - slo:sli_error:ratio_rate30d{slo_name="api"} / 0.001`)
+	f("apiErrorBudgetBurn", `(slo:sli_error:ratio_rate1h{slo_name="api"} > 0.0144 and slo:sli_error:ratio_rate5m{slo_name="api"} > 0.0144)`+
+		` or (slo:sli_error:ratio_rate6h{slo_name="api"} > 0.006 and slo:sli_error:ratio_rate30m{slo_name="api"} > 0.006)`)
+
+	alert := rules["apiErrorBudgetBurn"]
+	if alert.Labels["severity"] != "page" || alert.Labels["team"] != "foo" {
+		t.Fatalf("unexpected alert labels: %v", alert.Labels)
+	}
+}
+
+func TestSLOValidate_Failure(t *testing.T) {
+	f := func(data, errStrExpected string) {
+		t.Helper()
+
+		_, err := parse(map[string][]byte{"test.yaml": []byte(data)}, nil, true)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if !strings.Contains(err.Error(), errStrExpected) {
+			t.Fatalf("missing %q in the returned error %q", errStrExpected, err)
+		}
+	}
+
+	f(`
+groups:
+- name: missing slo
+  type: slo
+`, "`slo` must be set")
+
+	f(`
+groups:
+- name: slo for prometheus type
+  slo:
+    objective: 99
+`, "`slo` can be set only for groups with type")
+
+	f(`
+groups:
+- name: slo with rules
+  type: slo
+  slo:
+    objective: 99
+    sli:
+      good: sum(rate(good[{{.window}}]))
+      total: sum(rate(total[{{.window}}]))
+  rules:
+  - record: foo
+    expr: bar
+`, "`rules` can't be set")
+
+	f(`
+groups:
+- name: bad objective
+  type: slo
+  slo:
+    objective: 100
+    sli:
+      good: sum(rate(good[{{.window}}]))
+      total: sum(rate(total[{{.window}}]))
+`, "objective must be in range")
+
+	f(`
+groups:
+- name: short window
+  type: slo
+  slo:
+    objective: 99
+    window: 1d
+    sli:
+      good: sum(rate(good[{{.window}}]))
+      total: sum(rate(total[{{.window}}]))
+`, "window must be longer than 3d")
+
+	f(`
+groups:
+- name: window equal to the longest burn-rate window
+  type: slo
+  slo:
+    objective: 99
+    window: 3d
+    sli:
+      good: sum(rate(good[{{.window}}]))
+      total: sum(rate(total[{{.window}}]))
+`, "window must be longer than 3d")
+
+	f(`
+groups:
+- name: window matching the rate window
+  type: slo
+  slo:
+    objective: 99
+    window: 72h
+    sli:
+      good: sum(rate(good[{{.window}}]))
+      total: sum(rate(total[{{.window}}]))
+`, "window must be longer than 3d")
+
+	f(`
+groups:
+- name: missing placeholder
+  type: slo
+  slo:
+    objective: 99
+    sli:
+      good: sum(rate(good[5m]))
+      total: sum(rate(total[{{.window}}]))
+`, "must contain {{.window}} placeholder")
+
+	f(`
+groups:
+- name: unknown field
+  type: slo
+  slo:
+    objective: 99
+    sli:
+      good: sum(rate(good[{{.window}}]))
+      total: sum(rate(total[{{.window}}]))
+      bad: foo
+`, "unknown fields in slo.sli")
+
+	f(`
+groups:
+- name: bad sli query
+  type: slo
+  slo:
+    objective: 99
+    sli:
+      good: sum(rate(good[{{.window}}])
+      total: sum(rate(total[{{.window}}]))
+`, "bad MetricsQL expr")
+}
@@ -101,8 +101,8 @@ func (t *Type) UnmarshalYAML(unmarshal func(any) error) error {
 	if err := unmarshal(&s); err != nil {
 		return err
 	}
-	if !SupportedType(s) {
-		return fmt.Errorf("unknown datasource type=%q, want prometheus, graphite or vlogs", s)
+	if s != sloType && !SupportedType(s) {
+		return fmt.Errorf("unknown datasource type=%q, want prometheus, graphite, vlogs or slo", s)
 	}
 	t.Name = s
 	return nil
@@ -49,6 +49,23 @@ var (
 	oauth2TokenURL = flag.String("datasource.oauth2.tokenUrl", "", "Optional OAuth2 tokenURL to use for -datasource.url")
 	oauth2Scopes   = flag.String("datasource.oauth2.scopes", "", "Optional OAuth2 scopes to use for -datasource.url. Scopes must be delimited by ';'")
 
+	azureADUseManagedIdentity  = flag.Bool("datasource.azuread.useManagedIdentity", false, "Whether to obtain access tokens for -datasource.url via Azure managed identity")
+	azureADUseWorkloadIdentity = flag.Bool("datasource.azuread.useWorkloadIdentity", false, "Whether to obtain access tokens for -datasource.url via Azure workload identity")
+	azureADClientID            = flag.String("datasource.azuread.clientID", "", "Optional client id of Azure managed identity or workload identity application for -datasource.url. "+
+		"AZURE_CLIENT_ID env var is used for workload identity if it isn't set")
+	azureADTenantID = flag.String("datasource.azuread.tenantID", "", "Optional tenant id of Azure workload identity application for -datasource.url. "+
+		"AZURE_TENANT_ID env var is used if it isn't set")
+	azureADCloud = flag.String("datasource.azuread.cloud", "", "Optional Azure cloud for -datasource.url. "+
+		"Supported values: AzurePublic, AzureChina, AzureGovernment. Defaults to AzurePublic")
+	azureADScope = flag.String("datasource.azuread.scope", "", "Optional scope for Azure access tokens for -datasource.url. "+
+		"Defaults to Azure Monitor scope for -datasource.azuread.cloud")
+
+	googleIAMEnabled         = flag.Bool("datasource.googleIAM.enabled", false, "Whether to obtain access tokens for -datasource.url from Google Cloud IAM")
+	googleIAMCredentialsFile = flag.String("datasource.googleIAM.credentialsFile", "", "Optional path to Google Cloud credentials file for -datasource.url. "+
+		"Application default credentials are used if it isn't set")
+	googleIAMScopes = flag.String("datasource.googleIAM.scopes", "", "Optional OAuth2 scopes for Google Cloud access tokens for -datasource.url. "+
+		"Scopes must be delimited by ';'. Defaults to https://www.googleapis.com/auth/cloud-platform")
+
 	queryStep = flag.Duration("datasource.queryStep", 5*time.Minute, "How far a value can fallback to when evaluating queries to the configured -datasource.url and -remoteRead.url. Only valid for prometheus datasource. "+
 		"For example, if -datasource.queryStep=15s then param \"step\" with value \"15s\" will be added to every query. "+
 		"If set to 0, rule's evaluation interval will be used instead.")
@@ -118,6 +135,8 @@ func Init(extraParams url.Values) (QuerierBuilder, error) {
 		vmalertutil.WithBasicAuth(*basicAuthUsername, *basicAuthUsernameFile, *basicAuthPassword, *basicAuthPasswordFile),
 		vmalertutil.WithBearer(*bearerToken, *bearerTokenFile),
 		vmalertutil.WithOAuth(*oauth2ClientID, *oauth2ClientSecret, *oauth2ClientSecretFile, *oauth2TokenURL, *oauth2Scopes, endpointParams),
+		vmalertutil.WithAzureAD(*azureADUseManagedIdentity, *azureADUseWorkloadIdentity, *azureADClientID, *azureADTenantID, *azureADCloud, *azureADScope),
+		vmalertutil.WithGoogleIAM(*googleIAMEnabled, *googleIAMCredentialsFile, *googleIAMScopes),
 		vmalertutil.WithHeaders(*headers))
 	if err != nil {
 		return nil, fmt.Errorf("failed to configure auth: %w", err)
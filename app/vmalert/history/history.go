@@ -0,0 +1,406 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+// historyMetricName is the name of the series written for every state transition
+// if remote write for history is enabled.
+const historyMetricName = "ALERTS_HISTORY"
+
+var (
+	entriesTotal         = metrics.NewCounter(`vmalert_alerts_history_entries_total`)
+	droppedEntriesTotal  = metrics.NewCounter(`vmalert_alerts_history_dropped_entries_total`)
+	fileWriteErrorsTotal = metrics.NewCounter(`vmalert_alerts_history_file_write_errors_total`)
+	rwErrorsTotal        = metrics.NewCounter(`vmalert_alerts_history_remotewrite_errors_total`)
+)
+
+// minQueueSize is the minimum number of transitions waiting to be written in background.
+const minQueueSize = 10000
+
+var droppedEntriesLogger = logger.WithThrottler("alertsHistoryDropped", 5*time.Second)
+
+// Entry represents a single alert state transition.
+type Entry struct {
+	// Time is the evaluation timestamp at which the transition happened
+	Time time.Time `json:"time"`
+	// GroupID is the ID of the group the rule belongs to
+	GroupID string `json:"group_id"`
+	// RuleID is the ID of the alerting rule
+	RuleID string `json:"rule_id"`
+	// AlertID is the ID of the alert
+	AlertID string `json:"alert_id"`
+	// Name is the alert name
+	Name string `json:"name"`
+	// From is the alert state before the transition
+	From string `json:"from"`
+	// To is the alert state after the transition
+	To string `json:"to"`
+	// Labels are the alert labels
+	Labels map[string]string `json:"labels"`
+	// Value is the alert value at the moment of the transition.
+	// It is stored as a string, since JSON doesn't support NaN and Inf values.
+	Value string `json:"value"`
+	// ActiveAt is the moment when the alert has become active
+	ActiveAt time.Time `json:"activeAt"`
+}
+
+// Recorder stores alert state transitions in a ring buffer.
+//
+// The ring buffer may be persisted to a local file, so entries survive restarts.
+// Additionally, Recorder may write every transition as a time series
+// to remote storage or send it as JSON line to the logs endpoint.
+//
+// Writing to the file and to remote storage is performed asynchronously,
+// so slow disk or remote storage doesn't delay rules evaluation.
+type Recorder struct {
+	// mu protects the ring buffer
+	mu sync.Mutex
+	// entries is a ring buffer with the last len(entries) transitions
+	entries []Entry
+	// next is the position in entries for the next transition
+	next int
+	// full is set to true when entries were overwritten at least once
+	full bool
+	// seq is the sequence number of the last transition added to entries
+	seq uint64
+
+	// fileMu protects f, fileEntries and fileSeq
+	fileMu sync.Mutex
+	path   string
+	f      *os.File
+	// fileEntries is the number of entries written to f.
+	// The file is compacted to the ring buffer contents
+	// when fileEntries reaches 2*len(entries).
+	fileEntries int
+	// fileSeq is the sequence number of the last transition written to f
+	fileSeq uint64
+
+	rw   remotewrite.RWClient
+	logs *logsSender
+
+	// queue contains transitions, which must be written to f, rw and logs
+	queue  chan queuedEntry
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+type queuedEntry struct {
+	e   Entry
+	seq uint64
+}
+
+// NewRecorder returns a Recorder, which keeps up to maxEntries transitions.
+//
+// If path is non-empty, then entries are loaded from the file at path
+// and all the new entries are appended to it.
+// If rw is non-nil, then every transition is written to it as a time series.
+// If logsURL is non-empty, then every transition is sent to it as JSON line.
+func NewRecorder(maxEntries int, path string, rw remotewrite.RWClient, logsURL string) (*Recorder, error) {
+	if maxEntries <= 0 {
+		return nil, fmt.Errorf("maxEntries must be greater than 0; got %d", maxEntries)
+	}
+	r := &Recorder{
+		entries: make([]Entry, maxEntries),
+		path:    path,
+		rw:      rw,
+	}
+	if path != "" {
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+		if err := r.compact(); err != nil {
+			return nil, err
+		}
+	}
+	if logsURL != "" {
+		ls, err := newLogsSender(logsURL)
+		if err != nil {
+			return nil, err
+		}
+		r.logs = ls
+	}
+	if path != "" || rw != nil || r.logs != nil {
+		// the queue must fit bursts of transitions, which may exceed maxEntries,
+		// e.g. when all the alerts of a big group change their state at once.
+		r.queue = make(chan queuedEntry, max(maxEntries, minQueueSize))
+		r.stopCh = make(chan struct{})
+		r.wg.Go(r.runWriter)
+	}
+	return r, nil
+}
+
+// Record registers the given transition.
+//
+// The transition is available via Entries immediately,
+// while it is written to the file, remote storage and logs in background.
+func (r *Recorder) Record(e Entry) {
+	entriesTotal.Inc()
+
+	r.mu.Lock()
+	r.add(e)
+	seq := r.seq
+	r.mu.Unlock()
+
+	if r.queue == nil {
+		return
+	}
+	select {
+	case r.queue <- queuedEntry{e: e, seq: seq}:
+	default:
+		droppedEntriesTotal.Inc()
+		droppedEntriesLogger.Warnf("dropping alert state transition for %q, since the queue for writing alerts history is full; "+
+			"the file at -history.path or -remoteWrite.url may be too slow", e.Name)
+	}
+}
+
+func (r *Recorder) runWriter() {
+	for {
+		select {
+		case qe := <-r.queue:
+			r.write(qe)
+		case <-r.stopCh:
+			// write the remaining entries before stopping
+			for {
+				select {
+				case qe := <-r.queue:
+					r.write(qe)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) write(qe queuedEntry) {
+	r.fileMu.Lock()
+	if r.f != nil {
+		if err := r.writeEntry(qe); err != nil {
+			fileWriteErrorsTotal.Inc()
+			logger.Errorf("cannot write alert state transition to %q: %s", r.path, err)
+		}
+	}
+	r.fileMu.Unlock()
+
+	if r.rw != nil {
+		if err := r.rw.Push(entryToTimeSeries(qe.e)); err != nil {
+			rwErrorsTotal.Inc()
+			logger.Errorf("cannot push alert state transition to remote write: %s", err)
+		}
+	}
+	if r.logs != nil {
+		r.logs.send(qe.e)
+	}
+}
+
+// Entries returns transitions for the given ruleID in the time range [from, to],
+// sorted by time.
+//
+// Transitions for all the rules are returned if ruleID is 0.
+// Zero from or to mean unbounded range.
+func (r *Recorder) Entries(ruleID uint64, from, to time.Time) []Entry {
+	var id string
+	if ruleID > 0 {
+		id = strconv.FormatUint(ruleID, 10)
+	}
+	var result []Entry
+	r.mu.Lock()
+	r.forEach(func(e Entry) {
+		if id != "" && e.RuleID != id {
+			return
+		}
+		if !from.IsZero() && e.Time.Before(from) {
+			return
+		}
+		if !to.IsZero() && e.Time.After(to) {
+			return
+		}
+		result = append(result, e)
+	})
+	r.mu.Unlock()
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	return result
+}
+
+// Close stops the Recorder.
+//
+// The transitions registered before Close call are written to the file, remote storage and logs.
+func (r *Recorder) Close() error {
+	if r.stopCh != nil {
+		close(r.stopCh)
+		r.wg.Wait()
+	}
+	if r.logs != nil {
+		r.logs.stop()
+	}
+	r.fileMu.Lock()
+	defer r.fileMu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+func (r *Recorder) add(e Entry) {
+	r.seq++
+	r.entries[r.next] = e
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// forEach calls f for every entry in the ring buffer in the order they were added.
+func (r *Recorder) forEach(f func(e Entry)) {
+	if r.full {
+		for _, e := range r.entries[r.next:] {
+			f(e)
+		}
+	}
+	for _, e := range r.entries[:r.next] {
+		f(e)
+	}
+}
+
+func (r *Recorder) writeEntry(qe queuedEntry) error {
+	if r.fileEntries >= 2*len(r.entries) {
+		if err := r.compact(); err != nil {
+			return err
+		}
+	}
+	if qe.seq <= r.fileSeq {
+		// the entry was already written to the file during compaction
+		return nil
+	}
+	b, err := json.Marshal(qe.e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err := r.f.Write(b); err != nil {
+		return err
+	}
+	r.fileEntries++
+	r.fileSeq = qe.seq
+	return nil
+}
+
+// load reads entries from r.path into the ring buffer.
+// Lines which cannot be parsed are skipped, since they could be partially written on unclean shutdown.
+func (r *Recorder) load() error {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot read alerts history file: %w", err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1024*1024)
+	skipped := 0
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			skipped++
+			continue
+		}
+		r.add(e)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("cannot read alerts history file %q: %w", r.path, err)
+	}
+	if skipped > 0 {
+		logger.Warnf("skipped %d malformed entries in alerts history file %q", skipped, r.path)
+	}
+	return nil
+}
+
+// compact atomically rewrites r.path with the ring buffer contents
+// and reopens it for appending new entries.
+//
+// r.fileMu must be locked by the caller.
+func (r *Recorder) compact() error {
+	if r.f != nil {
+		_ = r.f.Close()
+		r.f = nil
+	}
+	var buf bytes.Buffer
+	n := 0
+	r.mu.Lock()
+	seq := r.seq
+	r.forEach(func(e Entry) {
+		b, err := json.Marshal(e)
+		if err != nil {
+			// entries which can't be marshaled were never written to the file
+			return
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+		n++
+	})
+	r.mu.Unlock()
+	fs.MustWriteAtomic(r.path, buf.Bytes(), true)
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot open alerts history file: %w", err)
+	}
+	r.f = f
+	r.fileEntries = n
+	r.fileSeq = seq
+	return nil
+}
+
+func entryToTimeSeries(e Entry) prompb.TimeSeries {
+	labels := make([]prompb.Label, 0, len(e.Labels)+3)
+	labels = append(labels, prompb.Label{Name: "__name__", Value: historyMetricName})
+	for k, v := range e.Labels {
+		if k == "__name__" || k == "alertstate" || k == "alertstate_prev" {
+			continue
+		}
+		labels = append(labels, prompb.Label{Name: k, Value: v})
+	}
+	labels = append(labels,
+		prompb.Label{Name: "alertstate", Value: e.To},
+		prompb.Label{Name: "alertstate_prev", Value: e.From},
+	)
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	v, err := strconv.ParseFloat(e.Value, 64)
+	if err != nil {
+		v = math.NaN()
+	}
+	return prompb.TimeSeries{
+		Labels: labels,
+		Samples: []prompb.Sample{{
+			Value:     v,
+			Timestamp: e.Time.UnixMilli(),
+		}},
+	}
+}
@@ -0,0 +1,283 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func newEntry(ruleID string, ts int64, to string) Entry {
+	return Entry{
+		Time:   time.Unix(ts, 0).UTC(),
+		RuleID: ruleID,
+		Name:   "foo",
+		From:   "inactive",
+		To:     to,
+		Labels: map[string]string{"alertname": "foo", "job": "bar"},
+		Value:  strconv.FormatInt(ts, 10),
+	}
+}
+
+func TestRecorder_Entries(t *testing.T) {
+	r, err := NewRecorder(3, "", nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	for i := int64(1); i <= 5; i++ {
+		ruleID := "1"
+		if i%2 == 0 {
+			ruleID = "2"
+		}
+		r.Record(newEntry(ruleID, i, "pending"))
+	}
+
+	f := func(ruleID uint64, from, to int64, timestampsExpected []int64) {
+		t.Helper()
+		var fromT, toT time.Time
+		if from > 0 {
+			fromT = time.Unix(from, 0)
+		}
+		if to > 0 {
+			toT = time.Unix(to, 0)
+		}
+		entries := r.Entries(ruleID, fromT, toT)
+		if len(entries) != len(timestampsExpected) {
+			t.Fatalf("expecting %d entries; got %d: %v", len(timestampsExpected), len(entries), entries)
+		}
+		for i, e := range entries {
+			if e.Time.Unix() != timestampsExpected[i] {
+				t.Fatalf("unexpected entry #%d timestamp; got %d; want %d", i, e.Time.Unix(), timestampsExpected[i])
+			}
+		}
+	}
+
+	// the first two entries must be evicted from the ring buffer
+	f(0, 0, 0, []int64{3, 4, 5})
+	f(1, 0, 0, []int64{3, 5})
+	f(2, 0, 0, []int64{4})
+	f(3, 0, 0, nil)
+	f(0, 4, 0, []int64{4, 5})
+	f(0, 0, 4, []int64{3, 4})
+	f(1, 4, 4, nil)
+}
+
+func TestRecorder_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	r, err := NewRecorder(2, path, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := int64(1); i <= 5; i++ {
+		r.Record(newEntry("1", i, "firing"))
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+
+	// the file must be compacted once it contains 2*maxEntries.
+	// The last entry is already in the ring buffer during compaction,
+	// so it must be written only once.
+	if n := countLines(t, path); n != 2 {
+		t.Fatalf("expecting 2 lines in history file; got %d", n)
+	}
+
+	// simulate partially written entry
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("cannot open file: %s", err)
+	}
+	if _, err := fd.WriteString(`{"time":"2020`); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+	_ = fd.Close()
+
+	r, err = NewRecorder(2, path, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = r.Close() }()
+	entries := r.Entries(0, time.Time{}, time.Time{})
+	if len(entries) != 2 {
+		t.Fatalf("expecting 2 entries after restart; got %d", len(entries))
+	}
+	if entries[0].Time.Unix() != 4 || entries[1].Time.Unix() != 5 {
+		t.Fatalf("unexpected entries after restart: %v", entries)
+	}
+	if entries[1].Labels["job"] != "bar" || entries[1].To != "firing" {
+		t.Fatalf("unexpected entry contents after restart: %v", entries[1])
+	}
+	if n := countLines(t, path); n != 2 {
+		t.Fatalf("expecting history file to be compacted on start; got %d lines", n)
+	}
+}
+
+func TestRecorder_NaNValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	r, err := NewRecorder(10, path, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	e := newEntry("1", 1, "firing")
+	e.Value = strconv.FormatFloat(math.NaN(), 'f', -1, 64)
+	r.Record(e)
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+
+	r, err = NewRecorder(10, path, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = r.Close() }()
+	entries := r.Entries(0, time.Time{}, time.Time{})
+	if len(entries) != 1 {
+		t.Fatalf("expecting 1 entry after restart; got %d", len(entries))
+	}
+	if entries[0].Value != "NaN" {
+		t.Fatalf("unexpected value after restart; got %q; want %q", entries[0].Value, "NaN")
+	}
+	if _, err := json.Marshal(entries); err != nil {
+		t.Fatalf("cannot marshal entries: %s", err)
+	}
+	ts := entryToTimeSeries(entries[0])
+	if len(ts.Samples) != 1 || !math.IsNaN(ts.Samples[0].Value) {
+		t.Fatalf("unexpected samples: %v", ts.Samples)
+	}
+}
+
+type blockingRWClient struct {
+	unblockCh chan struct{}
+
+	mu     sync.Mutex
+	pushed []prompb.TimeSeries
+}
+
+func (c *blockingRWClient) Push(s prompb.TimeSeries) error {
+	<-c.unblockCh
+	c.mu.Lock()
+	c.pushed = append(c.pushed, s)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *blockingRWClient) Close() error { return nil }
+
+func TestRecorder_Async(t *testing.T) {
+	rw := &blockingRWClient{
+		unblockCh: make(chan struct{}),
+	}
+	r, err := NewRecorder(10, "", rw, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Record must not block while remote write is stuck
+	doneCh := make(chan struct{})
+	go func() {
+		for i := int64(1); i <= 3; i++ {
+			r.Record(newEntry("1", i, "firing"))
+		}
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Record is blocked by slow remote write")
+	}
+	if n := len(r.Entries(0, time.Time{}, time.Time{})); n != 3 {
+		t.Fatalf("expecting 3 entries; got %d", n)
+	}
+
+	// the queued entries must be pushed on Close
+	close(rw.unblockCh)
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if len(rw.pushed) != 3 {
+		t.Fatalf("expecting 3 pushed time series; got %d", len(rw.pushed))
+	}
+}
+
+func TestRecorder_Logs(t *testing.T) {
+	var mu sync.Mutex
+	var got []Entry
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/stream+json" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var e Entry
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+				t.Errorf("cannot unmarshal entry %q: %s", sc.Text(), err)
+				return
+			}
+			mu.Lock()
+			got = append(got, e)
+			mu.Unlock()
+		}
+	}))
+	defer srv.Close()
+
+	r, err := NewRecorder(10, "", nil, srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	r.Record(newEntry("1", 1, "pending"))
+	r.Record(newEntry("1", 2, "firing"))
+	// Close must flush the pending entries
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %s", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expecting 2 entries to be sent; got %d", len(got))
+	}
+	if got[1].To != "firing" || got[1].RuleID != "1" {
+		t.Fatalf("unexpected entry sent: %v", got[1])
+	}
+}
+
+func TestEntryToTimeSeries(t *testing.T) {
+	e := newEntry("1", 10, "firing")
+	e.From = "pending"
+	ts := entryToTimeSeries(e)
+
+	var labels []string
+	for _, l := range ts.Labels {
+		labels = append(labels, l.Name+"="+l.Value)
+	}
+	got := strings.Join(labels, ",")
+	expected := "__name__=ALERTS_HISTORY,alertname=foo,alertstate=firing,alertstate_prev=pending,job=bar"
+	if got != expected {
+		t.Fatalf("unexpected labels;\ngot\n%s\nwant\n%s", got, expected)
+	}
+	if len(ts.Samples) != 1 || ts.Samples[0].Timestamp != 10e3 || ts.Samples[0].Value != 10 {
+		t.Fatalf("unexpected samples: %v", ts.Samples)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read file: %s", err)
+	}
+	return strings.Count(string(data), "\n")
+}
@@ -0,0 +1,75 @@
+package history
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
+)
+
+var (
+	maxEntries = flag.Int("history.maxEntries", 10e3, "The max number of alert state transitions kept in the alerts history. "+
+		"Older transitions are dropped when the limit is reached. Set to 0 for disabling the alerts history. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmalert/#alerts-history")
+	path = flag.String("history.path", "", "Optional path to the file for persisting alerts history between restarts. "+
+		"The file contains at most 2*-history.maxEntries JSON lines. By default, alerts history is kept in memory only")
+	writeSeries = flag.Bool("history.writeSeries", false, "Whether to write every alert state transition as ALERTS_HISTORY time series to -remoteWrite.url")
+	logsURL     = flag.String("history.logsURL", "", "Optional URL for sending alert state transitions as JSON lines, "+
+		"e.g. http://victorialogs:9428/insert/jsonline?_msg_field=name&_time_field=time&_stream_fields=rule_id")
+)
+
+var defaultRecorder *Recorder
+
+// Init initializes alerts history from -history.* flags.
+// rw is used for writing transitions as time series if -history.writeSeries is set.
+//
+// Init must be called before rules evaluation starts.
+func Init(rw remotewrite.RWClient) error {
+	if *maxEntries <= 0 {
+		return nil
+	}
+	if !*writeSeries {
+		rw = nil
+	} else if rw == nil {
+		return fmt.Errorf("-history.writeSeries requires -remoteWrite.url to be set")
+	}
+	r, err := NewRecorder(*maxEntries, *path, rw, *logsURL)
+	if err != nil {
+		return err
+	}
+	defaultRecorder = r
+	return nil
+}
+
+// Stop stops alerts history initialized via Init.
+func Stop() error {
+	if defaultRecorder == nil {
+		return nil
+	}
+	err := defaultRecorder.Close()
+	defaultRecorder = nil
+	return err
+}
+
+// Enabled returns true if alerts history was initialized.
+func Enabled() bool {
+	return defaultRecorder != nil
+}
+
+// Record registers alert state transition if alerts history is enabled.
+func Record(e Entry) {
+	if defaultRecorder == nil {
+		return
+	}
+	defaultRecorder.Record(e)
+}
+
+// Entries returns recorded transitions for the given ruleID in the time range [from, to].
+// See Recorder.Entries for details.
+func Entries(ruleID uint64, from, to time.Time) []Entry {
+	if defaultRecorder == nil {
+		return nil
+	}
+	return defaultRecorder.Entries(ruleID, from, to)
+}
@@ -0,0 +1,133 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+const (
+	logsQueueSize     = 10e3
+	logsMaxBatchSize  = 1e3
+	logsFlushInterval = time.Second
+	logsSendTimeout   = 30 * time.Second
+)
+
+var (
+	logsSentTotal    = metrics.NewCounter(`vmalert_alerts_history_logs_sent_total`)
+	logsDroppedTotal = metrics.NewCounter(`vmalert_alerts_history_logs_dropped_total`)
+	logsErrorsTotal  = metrics.NewCounter(`vmalert_alerts_history_logs_errors_total`)
+)
+
+// logsSender sends alert state transitions as JSON lines to the logs endpoint,
+// such as VictoriaLogs /insert/jsonline.
+type logsSender struct {
+	url string
+	c   *http.Client
+
+	input chan Entry
+	wg    sync.WaitGroup
+}
+
+func newLogsSender(url string) (*logsSender, error) {
+	if err := httputil.CheckURL(url); err != nil {
+		return nil, fmt.Errorf("invalid logs url: %w", err)
+	}
+	ls := &logsSender{
+		url: url,
+		c: &http.Client{
+			Timeout:   logsSendTimeout,
+			Transport: httputil.NewTransport(false, "vmalert_history_logs"),
+		},
+		input: make(chan Entry, logsQueueSize),
+	}
+	ls.wg.Go(ls.run)
+	return ls, nil
+}
+
+// send enqueues e for sending. e is dropped if the queue is full,
+// so slow logs endpoint doesn't block rules evaluation.
+func (ls *logsSender) send(e Entry) {
+	select {
+	case ls.input <- e:
+	default:
+		logsDroppedTotal.Inc()
+	}
+}
+
+func (ls *logsSender) stop() {
+	close(ls.input)
+	ls.wg.Wait()
+}
+
+func (ls *logsSender) run() {
+	ticker := time.NewTicker(logsFlushInterval)
+	defer ticker.Stop()
+
+	var buf bytes.Buffer
+	n := 0
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		if err := ls.post(buf.Bytes()); err != nil {
+			logsErrorsTotal.Inc()
+			logger.Errorf("cannot send %d alert state transitions to %q: %s", n, ls.url, err)
+		} else {
+			logsSentTotal.Add(n)
+		}
+		buf.Reset()
+		n = 0
+	}
+	for {
+		select {
+		case e, ok := <-ls.input:
+			if !ok {
+				flush()
+				return
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				logger.Errorf("cannot marshal alert state transition: %s", err)
+				continue
+			}
+			buf.Write(b)
+			buf.WriteByte('\n')
+			n++
+			if n >= logsMaxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (ls *logsSender) post(data []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, ls.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/stream+json")
+	req.Header.Set("User-Agent", "vmalert")
+	resp, err := ls.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response code %d; response body: %q", resp.StatusCode, body)
+	}
+	return nil
+}
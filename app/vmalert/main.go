@@ -15,6 +15,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/history"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remoteread"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
@@ -104,9 +105,9 @@ func main() {
 	}
 
 	if *dryRun {
-		groups, err := config.Parse(*rulePath, notifier.ValidateTemplates, true)
+		groups, err := config.Parse(getRulePaths(), notifier.ValidateTemplates, true)
 		if err != nil {
-			logger.Fatalf("failed to parse %q: %s", *rulePath, err)
+			logger.Fatalf("failed to parse %q: %s", getRulePaths(), err)
 		}
 		if len(groups) == 0 {
 			logger.Fatalf("No rules for validation. Please specify path to file(s) with alerting and/or recording rules using `-rule` flag")
@@ -125,13 +126,29 @@ func main() {
 	}
 
 	if *replayFrom != "" {
-		rw, err := remotewrite.Init(context.Background())
-		if err != nil {
-			logger.Fatalf("failed to init remoteWrite: %s", err)
+		var rw remotewrite.RWClient
+		if *replayNativeImport {
+			nc, err := remotewrite.InitNative()
+			if err != nil {
+				logger.Fatalf("failed to init native import client: %s", err)
+			}
+			if nc != nil {
+				rw = nc
+			}
+		} else {
+			c, err := remotewrite.Init(context.Background())
+			if err != nil {
+				logger.Fatalf("failed to init remoteWrite: %s", err)
+			}
+			if c != nil {
+				rw = c
+			}
 		}
 		if rw == nil {
 			logger.Fatalf("remoteWrite.url can't be empty in replay mode")
 		}
+		// groups managed via config API aren't replayed,
+		// since their results must be written on behalf of their tenants.
 		groupsCfg, err := config.Parse(*rulePath, validateTplFn, *validateExpressions)
 		if err != nil {
 			logger.Fatalf("cannot parse configuration file: %s", err)
@@ -158,8 +175,12 @@ func main() {
 	if err != nil {
 		logger.Fatalf("failed to create manager: %s", err)
 	}
-	logger.Infof("reading rules configuration file from %q", strings.Join(*rulePath, ";"))
-	groupsCfg, err := config.Parse(*rulePath, validateTplFn, *validateExpressions)
+	var rules *rulesStorage
+	if *configAPIDir != "" {
+		rules = newRulesStorage(*configAPIDir)
+	}
+	logger.Infof("reading rules configuration file from %q", strings.Join(getRulePaths(), ";"))
+	groupsCfg, err := config.Parse(getRulePaths(), validateTplFn, *validateExpressions)
 	if err != nil {
 		logger.Fatalf("cannot parse configuration file: %s", err)
 	}
@@ -179,7 +200,7 @@ func main() {
 	if len(listenAddrs) == 0 {
 		listenAddrs = []string{":8880"}
 	}
-	rh := &requestHandler{m: manager}
+	rh := &requestHandler{m: manager, rules: rules}
 	go httpserver.Serve(listenAddrs, rh.handler, httpserver.ServeOptions{
 		UseProxyProtocol: useProxyProtocol,
 	})
@@ -236,6 +257,9 @@ func newManager(ctx context.Context) (*manager, error) {
 	}
 	if rw != nil {
 		manager.rw = rw
+		manager.newTenantRW = func(tenant string) (remotewrite.RWClient, error) {
+			return remotewrite.InitWithHeaders(ctx, map[string]string{tenantHeader: tenant})
+		}
 	}
 
 	rr, err := remoteread.Init()
@@ -244,6 +268,10 @@ func newManager(ctx context.Context) (*manager, error) {
 	}
 	manager.rr = rr
 
+	if err := history.Init(manager.rw); err != nil {
+		return nil, fmt.Errorf("failed to init alerts history: %w", err)
+	}
+
 	return manager, nil
 }
 
@@ -325,10 +353,14 @@ func configReload(ctx context.Context, m *manager, groupsCfg []config.Group, sig
 			if len(*ruleTemplatesPath) > 0 {
 				tmplMsg = fmt.Sprintf("and templates %q ", *ruleTemplatesPath)
 			}
-			logger.Infof("SIGHUP received. Going to reload rules %q %s...", *rulePath, tmplMsg)
+			logger.Infof("SIGHUP received. Going to reload rules %q %s...", getRulePaths(), tmplMsg)
 			configReloads.Inc()
 			// allow logs emitting during manual config reload
 			parseFn = config.Parse
+		case <-configAPIReloadCh:
+			logger.Infof("rule groups were changed via config API. Going to reload rules %q...", getRulePaths())
+			configReloads.Inc()
+			parseFn = config.Parse
 		case <-configCheckCh:
 			// disable logs emitting during per-interval config reload
 			parseFn = config.ParseSilent
@@ -344,7 +376,7 @@ func configReload(ctx context.Context, m *manager, groupsCfg []config.Group, sig
 			logger.Errorf("failed to load new templates: %s", err)
 			continue
 		}
-		newGroupsCfg, err := parseFn(*rulePath, validateTplFn, *validateExpressions)
+		newGroupsCfg, err := parseFn(getRulePaths(), validateTplFn, *validateExpressions)
 		if err != nil {
 			setConfigError(err)
 			logger.Errorf("cannot parse configuration file: %s", err)
@@ -368,7 +400,7 @@ func configReload(ctx context.Context, m *manager, groupsCfg []config.Group, sig
 		templates.Reload()
 		groupsCfg = newGroupsCfg
 		setConfigSuccessAt(fasttime.UnixTimestamp())
-		logger.Infof("Rules reloaded successfully from %q", *rulePath)
+		logger.Infof("Rules reloaded successfully from %q", getRulePaths())
 	}
 }
 
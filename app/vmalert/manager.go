@@ -8,6 +8,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/history"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/rule"
@@ -19,6 +20,12 @@ type manager struct {
 	querierBuilder datasource.QuerierBuilder
 
 	rw remotewrite.RWClient
+	// newTenantRW creates remote write client for groups of the given tenant managed via config API.
+	// m.rw is used for such groups if newTenantRW is nil.
+	newTenantRW func(tenant string) (remotewrite.RWClient, error)
+	// tenantRW contains remote write clients created via newTenantRW.
+	// It is protected by groupsMu.
+	tenantRW map[string]remotewrite.RWClient
 	// remote read builder.
 	rr datasource.QuerierBuilder
 
@@ -89,30 +96,64 @@ func (m *manager) start(ctx context.Context, groupsCfg []config.Group) error {
 }
 
 func (m *manager) close() {
+	// groups must be stopped before alerts history and remote write client,
+	// since they record transitions to history, which writes them to m.rw in background.
+	m.wg.Wait()
+	if err := history.Stop(); err != nil {
+		logger.Errorf("cannot stop alerts history: %s", err)
+	}
 	if m.rw != nil {
 		err := m.rw.Close()
 		if err != nil {
 			logger.Fatalf("cannot stop the remotewrite: %s", err)
 		}
 	}
-	m.wg.Wait()
+	for tenant, rw := range m.tenantRW {
+		if err := rw.Close(); err != nil {
+			logger.Fatalf("cannot stop the remotewrite for tenant %q: %s", tenant, err)
+		}
+	}
 }
 
-func (m *manager) startGroup(ctx context.Context, g *rule.Group, restore bool) {
+// startGroup starts g, which writes results to rw.
+func (m *manager) startGroup(ctx context.Context, g *rule.Group, rw remotewrite.RWClient, restore bool) {
 	id := g.GetID()
 	g.Init()
 	m.wg.Go(func() {
 		if restore {
-			g.Start(ctx, m.rw, m.rr)
+			g.Start(ctx, rw, m.rr)
 		} else {
-			g.Start(ctx, m.rw, nil)
+			g.Start(ctx, rw, nil)
 		}
 	})
 
 	m.groups[id] = g
 }
 
+// getRW returns remote write client for groups of the given tenant.
+//
+// m.groupsMu must be locked by the caller.
+func (m *manager) getRW(tenant string) (remotewrite.RWClient, error) {
+	if tenant == "" || m.rw == nil || m.newTenantRW == nil {
+		return m.rw, nil
+	}
+	if rw, ok := m.tenantRW[tenant]; ok {
+		return rw, nil
+	}
+	rw, err := m.newTenantRW(tenant)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create remote write client for tenant %q: %w", tenant, err)
+	}
+	if m.tenantRW == nil {
+		m.tenantRW = make(map[string]remotewrite.RWClient)
+	}
+	m.tenantRW[tenant] = rw
+	return rw, nil
+}
+
 func (m *manager) update(ctx context.Context, groupsCfg []config.Group, restore bool) error {
+	setConfigAPITenantHeaders(groupsCfg)
+
 	var rrPresent, arPresent bool
 	groupsRegistry := make(map[uint64]*rule.Group)
 	for _, cfg := range groupsCfg {
@@ -126,6 +167,10 @@ func (m *manager) update(ctx context.Context, groupsCfg []config.Group, restore
 			if r.Alert != "" {
 				arPresent = true
 			}
+			if r.Anomaly != "" {
+				// anomaly rules produce both anomaly_score series and alerts
+				rrPresent, arPresent = true, true
+			}
 		}
 		ng := rule.NewGroup(cfg, m.querierBuilder, *evaluationInterval, m.labels)
 		groupsRegistry[ng.GetID()] = ng
@@ -145,6 +190,17 @@ func (m *manager) update(ctx context.Context, groupsCfg []config.Group, restore
 	var toUpdate []updateItem
 
 	m.groupsMu.Lock()
+	// obtain remote write clients before applying any changes,
+	// so the update could be rejected without side effects.
+	groupsRW := make(map[uint64]remotewrite.RWClient, len(groupsRegistry))
+	for id, ng := range groupsRegistry {
+		rw, err := m.getRW(configAPITenant(ng.File))
+		if err != nil {
+			m.groupsMu.Unlock()
+			return err
+		}
+		groupsRW[id] = rw
+	}
 	for _, og := range m.groups {
 		ng, ok := groupsRegistry[og.GetID()]
 		if !ok {
@@ -161,7 +217,7 @@ func (m *manager) update(ctx context.Context, groupsCfg []config.Group, restore
 		}
 	}
 	for _, ng := range groupsRegistry {
-		m.startGroup(ctx, ng, restore)
+		m.startGroup(ctx, ng, groupsRW[ng.GetID()], restore)
 	}
 	m.groupsMu.Unlock()
 
@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -267,6 +268,65 @@ func compareGroups(t *testing.T, a, b *rule.Group) {
 	}
 }
 
+func TestManagerUpdate_ConfigAPITenant(t *testing.T) {
+	originalDir := *configAPIDir
+	defer func() {
+		*configAPIDir = originalDir
+	}()
+	*configAPIDir = t.TempDir()
+
+	data := `
+groups:
+  - name: tenantGroup
+    headers:
+      - "X-Scope-OrgID: other"
+    rules:
+      - record: foo
+        expr: sum(bar)
+`
+	tenantDir := filepath.Join(*configAPIDir, "team-a")
+	if err := os.MkdirAll(tenantDir, 0o755); err != nil {
+		t.Fatalf("cannot create dir: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(tenantDir, "ns.yaml"), []byte(data), 0o644); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+	cfg, err := config.Parse(getRulePaths(), nil, true)
+	if err != nil {
+		t.Fatalf("cannot parse config: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	var tenants []string
+	m := &manager{
+		groups:         make(map[uint64]*rule.Group),
+		querierBuilder: &datasource.FakeQuerier{},
+		rw:             &fakeRWClient{},
+		newTenantRW: func(tenant string) (remotewrite.RWClient, error) {
+			tenants = append(tenants, tenant)
+			return &fakeRWClient{}, nil
+		},
+	}
+	if err := m.update(ctx, cfg, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tenants) != 1 || tenants[0] != "team-a" {
+		t.Fatalf("unexpected tenants for remote write clients; got %q; want %q", tenants, []string{"team-a"})
+	}
+	if len(m.groups) != 1 {
+		t.Fatalf("expecting 1 group; got %d", len(m.groups))
+	}
+	for _, g := range m.groups {
+		for _, headers := range []map[string]string{g.Headers, g.NotifierHeaders} {
+			if len(headers) != 1 || headers[tenantHeader] != "team-a" {
+				t.Fatalf("unexpected headers for group %q: %v", g.Name, headers)
+			}
+		}
+	}
+	cancel()
+	m.close()
+}
+
 func TestManagerUpdate_Failure(t *testing.T) {
 	f := func(notifiers []notifier.Notifier, rw remotewrite.RWClient, cfg config.Group, errStrExpected string) {
 		t.Helper()
@@ -54,6 +54,7 @@ type Client struct {
 	addr          string
 	c             *http.Client
 	authCfg       *promauth.Config
+	headers       map[string]string
 	input         chan prompb.TimeSeries
 	flushInterval time.Duration
 	maxBatchSize  int
@@ -88,6 +89,9 @@ type Config struct {
 	FlushInterval time.Duration
 	// Transport will be used by the underlying http.Client
 	Transport *http.Transport
+	// Headers contains optional HTTP headers added to every request.
+	// They override headers set via AuthCfg.
+	Headers map[string]string
 }
 
 // NewClient returns asynchronous client for
@@ -125,6 +129,7 @@ func NewClient(ctx context.Context, cfg Config) (*Client, error) {
 		c:             hc,
 		addr:          strings.TrimSuffix(rwURL.String(), "/"),
 		authCfg:       cfg.AuthCfg,
+		headers:       cfg.Headers,
 		flushInterval: cfg.FlushInterval,
 		maxBatchSize:  cfg.MaxBatchSize,
 		maxQueueSize:  cfg.MaxQueueSize,
@@ -394,6 +399,9 @@ func (c *Client) send(ctx context.Context, data []byte) error {
 			}
 		}
 	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
 	if !*disablePathAppend {
 		req.URL.Path = path.Join(req.URL.Path, "/api/v1/write")
 	}
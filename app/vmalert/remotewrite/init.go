@@ -71,6 +71,13 @@ func InitSecretFlags() {
 // Init creates Client object from given flags.
 // Returns nil if addr flag wasn't set.
 func Init(ctx context.Context) (*Client, error) {
+	return InitWithHeaders(ctx, nil)
+}
+
+// InitWithHeaders creates Client object from given flags,
+// which adds the given headers to every request.
+// Returns nil if addr flag wasn't set.
+func InitWithHeaders(ctx context.Context, extraHeaders map[string]string) (*Client, error) {
 	if *addr == "" {
 		return nil, nil
 	}
@@ -83,17 +90,9 @@ func Init(ctx context.Context) (*Client, error) {
 	}
 	tr.IdleConnTimeout = *idleConnectionTimeout
 
-	endpointParams, err := flagutil.ParseJSONMap(*oauth2EndpointParams)
-	if err != nil {
-		return nil, fmt.Errorf("cannot parse JSON for -remoteWrite.oauth2.endpointParams=%s: %w", *oauth2EndpointParams, err)
-	}
-	authCfg, err := vmalertutil.AuthConfig(
-		vmalertutil.WithBasicAuth(*basicAuthUsername, *basicAuthUsernameFile, *basicAuthPassword, *basicAuthPasswordFile),
-		vmalertutil.WithBearer(*bearerToken, *bearerTokenFile),
-		vmalertutil.WithOAuth(*oauth2ClientID, *oauth2ClientSecret, *oauth2ClientSecretFile, *oauth2TokenURL, *oauth2Scopes, endpointParams),
-		vmalertutil.WithHeaders(*headers))
+	authCfg, err := getAuthConfig()
 	if err != nil {
-		return nil, fmt.Errorf("failed to configure auth: %w", err)
+		return nil, err
 	}
 
 	return NewClient(ctx, Config{
@@ -104,5 +103,22 @@ func Init(ctx context.Context) (*Client, error) {
 		MaxBatchSize:  *maxBatchSize,
 		FlushInterval: *flushInterval,
 		Transport:     tr,
+		Headers:       extraHeaders,
 	})
 }
+
+func getAuthConfig() (*promauth.Config, error) {
+	endpointParams, err := flagutil.ParseJSONMap(*oauth2EndpointParams)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse JSON for -remoteWrite.oauth2.endpointParams=%s: %w", *oauth2EndpointParams, err)
+	}
+	authCfg, err := vmalertutil.AuthConfig(
+		vmalertutil.WithBasicAuth(*basicAuthUsername, *basicAuthUsernameFile, *basicAuthPassword, *basicAuthPasswordFile),
+		vmalertutil.WithBearer(*bearerToken, *bearerTokenFile),
+		vmalertutil.WithOAuth(*oauth2ClientID, *oauth2ClientSecret, *oauth2ClientSecretFile, *oauth2TokenURL, *oauth2Scopes, endpointParams),
+		vmalertutil.WithHeaders(*headers))
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure auth: %w", err)
+	}
+	return authCfg, nil
+}
@@ -0,0 +1,290 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+)
+
+const (
+	// nativeMaxPendingSamples is the max number of samples buffered by NativeClient before flushing them.
+	nativeMaxPendingSamples = 1e6
+	// nativeMaxRowsPerBlock is the max number of samples in a single native block.
+	nativeMaxRowsPerBlock = 8 * 1024
+)
+
+// NativeClient is a synchronous HTTP client for writing
+// timeseries via VictoriaMetrics native import protocol,
+// see https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#how-to-import-data-in-native-format
+//
+// NativeClient merges samples of series with identical labels into blocks,
+// so it is more efficient than remote write protocol for writing big amounts
+// of historical data, e.g. during the replay.
+type NativeClient struct {
+	addr    string
+	c       *http.Client
+	authCfg *promauth.Config
+
+	mu             sync.Mutex
+	pending        map[string]*nativeSeries
+	pendingSamples int
+}
+
+type nativeSeries struct {
+	labels  []prompb.Label
+	samples []prompb.Sample
+}
+
+// InitNative creates NativeClient object from -remoteWrite.* flags.
+// Returns nil if addr flag wasn't set.
+func InitNative() (*NativeClient, error) {
+	if *addr == "" {
+		return nil, nil
+	}
+	if err := httputil.CheckURL(*addr); err != nil {
+		return nil, fmt.Errorf("invalid -remoteWrite.url: %w", err)
+	}
+	tr, err := promauth.NewTLSTransport(*tlsCertFile, *tlsKeyFile, *tlsCAFile, *tlsServerName, *tlsInsecureSkipVerify, "vmalert_remotewrite_native")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport for -remoteWrite.url=%q: %w", *addr, err)
+	}
+	tr.IdleConnTimeout = *idleConnectionTimeout
+	authCfg, err := getAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewNativeClient(*addr, authCfg, tr)
+}
+
+// NewNativeClient returns NativeClient for writing data to the given addr.
+func NewNativeClient(addr string, authCfg *promauth.Config, tr *http.Transport) (*NativeClient, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("addr can't be empty")
+	}
+	if tr == nil {
+		tr = httputil.NewTransport(false, "vmalert_remotewrite_native")
+	}
+	hc := &http.Client{
+		Timeout:   *sendTimeout,
+		Transport: tr,
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse addr %q: %w", addr, err)
+	}
+	hc.Transport, u = httputil.NewLoadBalancerTransport(hc.Transport, u)
+	return &NativeClient{
+		addr:    strings.TrimSuffix(u.String(), "/"),
+		c:       hc,
+		authCfg: authCfg,
+		pending: make(map[string]*nativeSeries),
+	}, nil
+}
+
+// Push adds the given timeseries to the buffer.
+// The buffer is flushed to the remote storage once it becomes full.
+func (c *NativeClient) Push(s prompb.TimeSeries) error {
+	if len(s.Samples) == 0 {
+		return nil
+	}
+	rwTotal.Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := labelsKey(s.Labels)
+	ns, ok := c.pending[key]
+	if !ok {
+		ns = &nativeSeries{
+			labels: append([]prompb.Label{}, s.Labels...),
+		}
+		c.pending[key] = ns
+	}
+	ns.samples = append(ns.samples, s.Samples...)
+	c.pendingSamples += len(s.Samples)
+	if c.pendingSamples < nativeMaxPendingSamples {
+		return nil
+	}
+	return c.flushLocked()
+}
+
+// Flush sends all the buffered series to the remote storage.
+// Buffered series are dropped if Flush returns an error.
+func (c *NativeClient) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked()
+}
+
+// Close flushes the buffered series.
+func (c *NativeClient) Close() error {
+	return c.Flush()
+}
+
+func (c *NativeClient) flushLocked() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+	rows := c.pendingSamples
+	data := marshalNative(c.pending)
+	c.pending = make(map[string]*nativeSeries)
+	c.pendingSamples = 0
+
+	zb := zstd.CompressLevel(nil, data, 0)
+	if err := c.sendWithRetries(zb); err != nil {
+		rwErrors.Inc()
+		droppedRows.Add(rows)
+		return err
+	}
+	sentRows.Add(rows)
+	sentBytes.Add(len(zb))
+	return nil
+}
+
+// marshalNative marshals the given series into native import format.
+func marshalNative(pending map[string]*nativeSeries) []byte {
+	tr := storage.TimeRange{
+		MinTimestamp: 1<<63 - 1,
+		MaxTimestamp: -1 << 63,
+	}
+	var blocks []byte
+	var mn storage.MetricName
+	var b storage.Block
+	var mnBuf, tmp []byte
+	var timestamps, values []int64
+	var floats []float64
+	for _, ns := range pending {
+		mn.Reset()
+		for _, l := range ns.labels {
+			if l.Name == "__name__" {
+				mn.MetricGroup = append(mn.MetricGroup[:0], l.Value...)
+				continue
+			}
+			mn.AddTag(l.Name, l.Value)
+		}
+		sort.Slice(mn.Tags, func(i, j int) bool {
+			return string(mn.Tags[i].Key) < string(mn.Tags[j].Key)
+		})
+		mnBuf = mn.Marshal(mnBuf[:0])
+
+		samples := ns.samples
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].Timestamp < samples[j].Timestamp
+		})
+		tr.MinTimestamp = min(tr.MinTimestamp, samples[0].Timestamp)
+		tr.MaxTimestamp = max(tr.MaxTimestamp, samples[len(samples)-1].Timestamp)
+		for len(samples) > 0 {
+			n := min(len(samples), nativeMaxRowsPerBlock)
+			timestamps, floats = timestamps[:0], floats[:0]
+			for _, s := range samples[:n] {
+				timestamps = append(timestamps, s.Timestamp)
+				floats = append(floats, s.Value)
+			}
+			samples = samples[n:]
+
+			var scale int16
+			values, scale = decimal.AppendFloatToDecimal(values[:0], floats)
+			b.Init(&storage.TSID{}, timestamps, values, scale, 64)
+
+			blocks = encoding.MarshalUint32(blocks, uint32(len(mnBuf)))
+			blocks = append(blocks, mnBuf...)
+			tmp = b.MarshalPortable(tmp[:0])
+			blocks = encoding.MarshalUint32(blocks, uint32(len(tmp)))
+			blocks = append(blocks, tmp...)
+		}
+	}
+
+	dst := make([]byte, 0, 16+len(blocks))
+	dst = encoding.MarshalInt64(dst, tr.MinTimestamp)
+	dst = encoding.MarshalInt64(dst, tr.MaxTimestamp)
+	return append(dst, blocks...)
+}
+
+func (c *NativeClient) sendWithRetries(data []byte) error {
+	bt := timeutil.NewBackoffTimer(*retryMinInterval, *retryMaxTime)
+	timeStart := time.Now()
+	defer func() {
+		sendDuration.Add(time.Since(timeStart).Seconds())
+	}()
+	for attempt := 1; ; attempt++ {
+		err := c.send(data)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*nonRetriableError); ok {
+			return err
+		}
+		timeLeftForRetries := *retryMaxTime - time.Since(timeStart)
+		if timeLeftForRetries < 0 {
+			return fmt.Errorf("failed to send native import request after %d attempts: %w", attempt, err)
+		}
+		logger.Warnf("attempt %d to send native import request failed: %s", attempt, err)
+		if bt.CurrentDelay() > timeLeftForRetries {
+			bt.SetDelay(timeLeftForRetries)
+		}
+		bt.Wait(nil)
+	}
+}
+
+func (c *NativeClient) send(data []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, c.addr, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create new HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", "vmalert")
+	req.Header.Set("Content-Encoding", "zstd")
+	if c.authCfg != nil {
+		if err := c.authCfg.SetHeaders(req, true); err != nil {
+			return &nonRetriableError{err: err}
+		}
+	}
+	if !*disablePathAppend {
+		req.URL.Path = path.Join(req.URL.Path, "/api/v1/import/native")
+	}
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return fmt.Errorf("error while sending request to %s: %w", req.URL.Redacted(), err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	switch resp.StatusCode / 100 {
+	case 2:
+		return nil
+	case 4:
+		return &nonRetriableError{
+			err: fmt.Errorf("unexpected response code %d for %s. Response body %q", resp.StatusCode, req.URL.Redacted(), body),
+		}
+	default:
+		return fmt.Errorf("unexpected response code %d for %s. Response body %q", resp.StatusCode, req.URL.Redacted(), body)
+	}
+}
+
+func labelsKey(labels []prompb.Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package remotewrite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/native/stream"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+)
+
+func TestNativeClient_Push(t *testing.T) {
+	protoparserutil.StartUnmarshalWorkers()
+	defer protoparserutil.StopUnmarshalWorkers()
+
+	var mu sync.Mutex
+	got := make(map[string][]int64)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/import/native" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		err := stream.Parse(r.Body, r.Header.Get("Content-Encoding"), func(block *stream.Block) error {
+			mu.Lock()
+			defer mu.Unlock()
+			key := block.MetricName.String()
+			got[key] = append(got[key], block.Timestamps...)
+			return nil
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c, err := NewNativeClient(srv.URL, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+	labels := []prompb.Label{{Name: "__name__", Value: "foo"}, {Name: "job", Value: "bar"}}
+	// push samples in reverse order to verify they are sorted before marshaling
+	for i := 20; i > 0; i-- {
+		ts := prompb.TimeSeries{
+			Labels:  labels,
+			Samples: []prompb.Sample{{Value: float64(i), Timestamp: int64(i * 1000)}},
+		}
+		if err := c.Push(ts); err != nil {
+			t.Fatalf("unexpected push error: %s", err)
+		}
+	}
+	if err := c.Push(prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "baz"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}); err != nil {
+		t.Fatalf("unexpected push error: %s", err)
+	}
+	if requests != 0 {
+		t.Fatalf("expecting no requests before flush; got %d", requests)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected close error: %s", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expecting a single request on close; got %d", requests)
+	}
+
+	timestamps := got[`foo{job="bar"}`]
+	if len(timestamps) != 20 {
+		t.Fatalf("expecting 20 samples for series foo; got %d: %v", len(timestamps), got)
+	}
+	if !sort.SliceIsSorted(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] }) {
+		t.Fatalf("expecting timestamps to be sorted; got %v", timestamps)
+	}
+	if len(got["baz{}"]) != 1 {
+		t.Fatalf("expecting 1 sample for series baz; got %v", got)
+	}
+
+	// flushing empty buffer must be no-op
+	if err := c.Flush(); err != nil {
+		t.Fatalf("unexpected flush error: %s", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expecting no requests for empty flush; got %d", requests)
+	}
+}
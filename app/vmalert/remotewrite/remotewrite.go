@@ -11,3 +11,10 @@ type RWClient interface {
 	// Close stops the client. Client can't be reused after Close call.
 	Close() error
 }
+
+// Flusher is implemented by clients which support synchronous flushing of the pushed data.
+type Flusher interface {
+	// Flush sends all the previously pushed time series to remote storage
+	// and returns an error if they weren't sent.
+	Flush() error
+}
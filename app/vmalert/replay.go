@@ -1,15 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/rule"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
 
@@ -32,12 +37,24 @@ var (
 		"Increasing this value when replaying for a long time, since each request is limited by -replay.maxDatapointsPerQuery.")
 	continueWithExecutionErr = flag.Bool("replay.continueWithExecutionErr", false, "Whether to continue replaying other rules if a rule execution fails with a 400 or 422 response code, "+
 		"which can happen due to an expression syntax error or a resource limit being hit.")
+	replayNativeImport = flag.Bool("replay.nativeImport", false, "Whether to write replay results to -remoteWrite.url via VictoriaMetrics native import API '/api/v1/import/native' instead of remote write protocol. "+
+		"Native import merges samples of the same series into blocks, so it is much faster for replaying long time ranges. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmalert/#rules-backfilling")
+	replayStateFile = flag.String("replay.stateFile", "", "Optional path to the file for storing the replay progress. "+
+		"If the replay is interrupted, the next run with the same rules, -replay.timeFrom and -replay.timeTo resumes from the last persisted progress. "+
+		"Requires -replay.nativeImport.")
+	replayGroupsConcurrency = flag.Int("replay.groupsConcurrency", 1, "The maximum number of groups replayed concurrently. "+
+		"Groups must be independent, e.g. recording rules in one group shouldn't depend on the results of rules in another group. "+
+		"It is recommended to set -replay.disableProgressBar when replaying groups concurrently.")
 )
 
 func replay(groupsCfg []config.Group, qb datasource.QuerierBuilder, rw remotewrite.RWClient) (totalRows, droppedRows int, err error) {
 	if *replayMaxDatapoints < 1 {
 		return 0, 0, fmt.Errorf("replay.maxDatapointsPerQuery can't be lower than 1")
 	}
+	if *replayGroupsConcurrency < 1 {
+		return 0, 0, fmt.Errorf("replay.groupsConcurrency can't be lower than 1")
+	}
 	tFrom, err := time.Parse(time.RFC3339, *replayFrom)
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to parse replay.timeFrom=%q: %w", *replayFrom, err)
@@ -67,16 +84,41 @@ func replay(groupsCfg []config.Group, qb datasource.QuerierBuilder, rw remotewri
 		labels[s[:n]] = s[n+1:]
 	}
 
+	var progress *replayProgress
+	if *replayStateFile != "" {
+		if _, ok := rw.(remotewrite.Flusher); !ok {
+			return 0, 0, fmt.Errorf("replay.stateFile requires replay.nativeImport to be set")
+		}
+		progress, err = loadReplayProgress(*replayStateFile, tFrom, tTo)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
 	fmt.Printf("Replay mode:"+
 		"\nfrom: \t%v "+
 		"\nto: \t%v "+
 		"\nmax data points per request: %d\n",
 		tFrom, tTo, *replayMaxDatapoints)
 
+	var rows atomic.Int64
+	sem := make(chan struct{}, *replayGroupsConcurrency)
+	var wg sync.WaitGroup
 	for _, cfg := range groupsCfg {
 		ng := rule.NewGroup(cfg, qb, *evaluationInterval, labels)
-		totalRows += ng.Replay(tFrom, tTo, rw, *replayMaxDatapoints, *replayRuleRetryAttempts, *replayRulesDelay, *disableProgressBar, *ruleEvaluationConcurrency, *continueWithExecutionErr)
+		sem <- struct{}{}
+		wg.Go(func() {
+			var p rule.ReplayProgress
+			if progress != nil {
+				p = progress
+			}
+			n := ng.Replay(tFrom, tTo, rw, *replayMaxDatapoints, *replayRuleRetryAttempts, *replayRulesDelay, *disableProgressBar, *ruleEvaluationConcurrency, *continueWithExecutionErr, p)
+			rows.Add(int64(n))
+			<-sem
+		})
 	}
+	wg.Wait()
+	totalRows = int(rows.Load())
 	logger.Infof("replay evaluation finished, generated %d samples", totalRows)
 	if err := rw.Close(); err != nil {
 		return 0, 0, err
@@ -84,3 +126,75 @@ func replay(groupsCfg []config.Group, qb datasource.QuerierBuilder, rw remotewri
 	droppedRows = remotewrite.GetDroppedRows()
 	return totalRows, droppedRows, nil
 }
+
+// replayProgress implements rule.ReplayProgress
+// by persisting the progress into a local file.
+type replayProgress struct {
+	path string
+
+	mu    sync.Mutex
+	state replayState
+}
+
+type replayState struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Rules contains timestamps till which rules were replayed,
+	// keyed by "groupID:ruleID".
+	Rules map[string]time.Time `json:"rules"`
+}
+
+func loadReplayProgress(path string, from, to time.Time) (*replayProgress, error) {
+	rp := &replayProgress{
+		path: path,
+		state: replayState{
+			From:  from,
+			To:    to,
+			Rules: make(map[string]time.Time),
+		},
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rp, nil
+		}
+		return nil, fmt.Errorf("cannot read replay state file %q: %w", path, err)
+	}
+	var state replayState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("cannot parse replay state file %q: %w", path, err)
+	}
+	if !state.From.Equal(from) || !state.To.Equal(to) {
+		return nil, fmt.Errorf("replay state file %q was created for time range [%v, %v]; remove it to start the replay for time range [%v, %v]",
+			path, state.From, state.To, from, to)
+	}
+	if state.Rules != nil {
+		rp.state.Rules = state.Rules
+	}
+	logger.Infof("resuming replay from state file %q with progress for %d rules", path, len(rp.state.Rules))
+	return rp, nil
+}
+
+// Get implements rule.ReplayProgress interface
+func (rp *replayProgress) Get(groupID, ruleID uint64) time.Time {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.state.Rules[replayProgressKey(groupID, ruleID)]
+}
+
+// Set implements rule.ReplayProgress interface
+func (rp *replayProgress) Set(groupID, ruleID uint64, ts time.Time) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.state.Rules[replayProgressKey(groupID, ruleID)] = ts
+	data, err := json.Marshal(&rp.state)
+	if err != nil {
+		return fmt.Errorf("cannot marshal replay state: %w", err)
+	}
+	fs.MustWriteAtomic(rp.path, data, true)
+	return nil
+}
+
+func replayProgressKey(groupID, ruleID uint64) string {
+	return fmt.Sprintf("%d:%d", groupID, ruleID)
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/rule"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
@@ -310,3 +312,186 @@ func TestReplay(t *testing.T) {
 		},
 	}, 2)
 }
+
+type fakeFlusherRWClient struct {
+	fakeRWClient
+	flushes int
+}
+
+func (fc *fakeFlusherRWClient) Flush() error {
+	fc.flushes++
+	return nil
+}
+
+func TestReplay_Resume(t *testing.T) {
+	fromOrig, toOrig, maxDatapointsOrig := *replayFrom, *replayTo, *replayMaxDatapoints
+	retriesOrig, delayOrig, stateFileOrig := *replayRuleRetryAttempts, *replayRulesDelay, *replayStateFile
+	groupsConcurrencyOrig := *replayGroupsConcurrency
+	defer func() {
+		*replayFrom, *replayTo = fromOrig, toOrig
+		*replayMaxDatapoints, *replayRuleRetryAttempts = maxDatapointsOrig, retriesOrig
+		*replayRulesDelay, *replayStateFile = delayOrig, stateFileOrig
+		*replayGroupsConcurrency = groupsConcurrencyOrig
+	}()
+
+	*replayFrom = "2021-01-01T12:00:00.000Z"
+	*replayTo = "2021-01-01T12:02:30.000Z"
+	*replayMaxDatapoints = 1
+	*replayRuleRetryAttempts = 1
+	*replayRulesDelay = 0
+	*replayGroupsConcurrency = 2
+	*replayStateFile = t.TempDir() + "/replay-state.json"
+
+	cfg := []config.Group{
+		{Name: "foo", Rules: []config.Rule{{ID: 1, Record: "foo", Expr: "sum(up)"}}},
+		{Name: "bar", Rules: []config.Rule{{ID: 2, Record: "bar", Expr: "max(up)"}}},
+	}
+	qb := &fakeReplayQuerier{
+		registry: map[string]map[string][]datasource.Metric{
+			"sum(up)": {
+				"12:00:00+12:01:00": {{Timestamps: []int64{1}, Values: []float64{1}}},
+				"12:01:00+12:02:00": {{Timestamps: []int64{1}, Values: []float64{1}}},
+				"12:02:00+12:02:30": {{Timestamps: []int64{1}, Values: []float64{1}}},
+			},
+			"max(up)": {
+				"12:00:00+12:01:00": {{Timestamps: []int64{1}, Values: []float64{1}}},
+				"12:01:00+12:02:00": {},
+				"12:02:00+12:02:30": {},
+			},
+		},
+	}
+
+	// the state file can't be used without flushing support
+	if _, _, err := replay(cfg, qb, &fakeRWClient{}); err == nil {
+		t.Fatalf("expecting non-nil error when replay.stateFile is used with remote write client")
+	}
+
+	rw := &fakeFlusherRWClient{}
+	totalRows, _, err := replay(cfg, qb, rw)
+	if err != nil {
+		t.Fatalf("replay failed: %s", err)
+	}
+	if totalRows != 4 {
+		t.Fatalf("unexpected total rows count: got %d, want %d", totalRows, 4)
+	}
+	if rw.flushes == 0 {
+		t.Fatalf("expecting results to be flushed before persisting the progress")
+	}
+	// The progress must be saved once per rule, since the replay takes less than the interval between progress updates.
+	if rw.flushes != 2 {
+		t.Fatalf("unexpected number of flushes; got %d; want 2", rw.flushes)
+	}
+
+	// the second run must skip already replayed ranges
+	totalRows, _, err = replay(cfg, qb, &fakeFlusherRWClient{})
+	if err != nil {
+		t.Fatalf("replay failed: %s", err)
+	}
+	if totalRows != 0 {
+		t.Fatalf("expecting resumed replay to generate no rows; got %d", totalRows)
+	}
+
+	// the state file can't be reused for another time range
+	*replayTo = "2021-01-01T12:03:00.000Z"
+	if _, _, err := replay(cfg, qb, &fakeFlusherRWClient{}); err == nil {
+		t.Fatalf("expecting non-nil error for the state file created for another time range")
+	}
+}
+
+type fakeCapturingRWClient struct {
+	fakeFlusherRWClient
+
+	mu     sync.Mutex
+	series []prompb.TimeSeries
+}
+
+func (fc *fakeCapturingRWClient) Push(s prompb.TimeSeries) error {
+	fc.mu.Lock()
+	fc.series = append(fc.series, s)
+	fc.mu.Unlock()
+	return nil
+}
+
+func (fc *fakeCapturingRWClient) firingSamples() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	n := 0
+	for _, s := range fc.series {
+		isAlerts, isFiring := false, false
+		for _, l := range s.Labels {
+			if l.Name == "__name__" && l.Value == "ALERTS" {
+				isAlerts = true
+			}
+			if l.Name == "alertstate" && l.Value == "firing" {
+				isFiring = true
+			}
+		}
+		if isAlerts && isFiring {
+			n += len(s.Samples)
+		}
+	}
+	return n
+}
+
+func TestReplay_ResumeRestoresAlertsState(t *testing.T) {
+	fromOrig, toOrig, maxDatapointsOrig := *replayFrom, *replayTo, *replayMaxDatapoints
+	retriesOrig, delayOrig, stateFileOrig := *replayRuleRetryAttempts, *replayRulesDelay, *replayStateFile
+	defer func() {
+		*replayFrom, *replayTo = fromOrig, toOrig
+		*replayMaxDatapoints, *replayRuleRetryAttempts = maxDatapointsOrig, retriesOrig
+		*replayRulesDelay, *replayStateFile = delayOrig, stateFileOrig
+	}()
+
+	*replayFrom = "2021-01-01T12:00:00.000Z"
+	*replayTo = "2021-01-01T12:03:00.000Z"
+	*replayMaxDatapoints = 1
+	*replayRuleRetryAttempts = 1
+	*replayRulesDelay = 0
+
+	cfg := []config.Group{
+		{Name: "foo", Rules: []config.Rule{{ID: 1, Alert: "foo", Expr: "sum(up) > 0", For: promutil.NewDuration(2 * time.Minute)}}},
+	}
+	t0 := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC).Unix()
+	qb := &fakeReplayQuerier{
+		registry: map[string]map[string][]datasource.Metric{
+			"sum(up) > 0": {
+				"12:00:00+12:01:00": {{Timestamps: []int64{t0, t0 + 60}, Values: []float64{1, 1}}},
+				"12:01:00+12:02:00": {{Timestamps: []int64{t0 + 60, t0 + 120}, Values: []float64{1, 1}}},
+				"12:02:00+12:03:00": {{Timestamps: []int64{t0 + 120, t0 + 180}, Values: []float64{1, 1}}},
+			},
+		},
+	}
+
+	// The alert becomes firing at 12:02. The sample at 12:02 is generated for both the second and the third ranges.
+	rw := &fakeCapturingRWClient{}
+	*replayStateFile = t.TempDir() + "/replay-state.json"
+	if _, _, err := replay(cfg, qb, rw); err != nil {
+		t.Fatalf("replay failed: %s", err)
+	}
+	if n := rw.firingSamples(); n != 3 {
+		t.Fatalf("unexpected number of firing samples after the full replay; got %d; want 3", n)
+	}
+
+	// Simulate the replay interrupted at 12:02.
+	*replayStateFile = t.TempDir() + "/replay-state.json"
+	tFrom, _ := time.Parse(time.RFC3339, *replayFrom)
+	tTo, _ := time.Parse(time.RFC3339, *replayTo)
+	progress, err := loadReplayProgress(*replayStateFile, tFrom, tTo)
+	if err != nil {
+		t.Fatalf("cannot load replay progress: %s", err)
+	}
+	g := rule.NewGroup(cfg[0], qb, *evaluationInterval, map[string]string{})
+	if err := progress.Set(g.GetID(), 1, tFrom.Add(2*time.Minute)); err != nil {
+		t.Fatalf("cannot save replay progress: %s", err)
+	}
+
+	// The resumed replay must restore the pending state of the alert and produce the same firing samples for the last range.
+	rw = &fakeCapturingRWClient{}
+	if _, _, err := replay(cfg, qb, rw); err != nil {
+		t.Fatalf("replay failed: %s", err)
+	}
+	if n := rw.firingSamples(); n != 2 {
+		t.Fatalf("unexpected number of firing samples after resume; got %d; want 2", n)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"hash/fnv"
 	"math"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/history"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/templates"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/vmalertutil"
@@ -247,6 +249,22 @@ func (ar *AlertingRule) GetAlerts() []*notifier.Alert {
 	return alerts
 }
 
+// recordTransition registers the transition of alert a from one state to another in alerts history.
+func (ar *AlertingRule) recordTransition(at time.Time, a *notifier.Alert, from, to notifier.AlertState) {
+	history.Record(history.Entry{
+		Time:     at,
+		GroupID:  fmt.Sprintf("%d", ar.GroupID),
+		RuleID:   fmt.Sprintf("%d", ar.ID()),
+		AlertID:  fmt.Sprintf("%d", a.ID),
+		Name:     ar.Name,
+		From:     from.String(),
+		To:       to.String(),
+		Labels:   a.Labels,
+		Value:    strconv.FormatFloat(a.Value, 'f', -1, 64),
+		ActiveAt: a.ActiveAt,
+	})
+}
+
 func (ar *AlertingRule) logDebugf(at time.Time, a *notifier.Alert, format string, args ...any) {
 	if !ar.Debug {
 		return
@@ -525,15 +543,16 @@ func (ar *AlertingRule) exec(ctx context.Context, ts time.Time, limit int) ([]pr
 		}
 		updated[alertID] = struct{}{}
 		if a, ok := ar.alerts[alertID]; ok {
+			a.Value = m.Values[0]
 			if a.State == notifier.StateInactive {
 				// alert could be in inactive state for resolvedRetention
 				// so when we again receive metrics for it - we switch it
 				// back to notifier.StatePending
 				a.State = notifier.StatePending
 				a.ActiveAt = ts
+				ar.recordTransition(ts, a, notifier.StateInactive, notifier.StatePending)
 				ar.logDebugf(ts, a, "INACTIVE => PENDING")
 			}
-			a.Value = m.Values[0]
 			a.Interval = ar.EvalInterval
 			a.Annotations = annotations
 			a.KeepFiringSince = time.Time{}
@@ -544,6 +563,7 @@ func (ar *AlertingRule) exec(ctx context.Context, ts time.Time, limit int) ([]pr
 		a.ID = alertID
 		a.State = notifier.StatePending
 		ar.alerts[alertID] = a
+		ar.recordTransition(ts, a, notifier.StateInactive, notifier.StatePending)
 		ar.logDebugf(ts, a, "created in state PENDING")
 	}
 	var numActivePending int
@@ -558,6 +578,7 @@ func (ar *AlertingRule) exec(ctx context.Context, ts time.Time, limit int) ([]pr
 				tss = append(tss, pendingAlertStaleTimeSeries(a.Labels, ts.Unix(), true)...)
 
 				delete(ar.alerts, h)
+				ar.recordTransition(ts, a, notifier.StatePending, notifier.StateInactive)
 				ar.logDebugf(ts, a, "PENDING => DELETED: is absent in current evaluation round")
 				continue
 			}
@@ -574,6 +595,7 @@ func (ar *AlertingRule) exec(ctx context.Context, ts time.Time, limit int) ([]pr
 				if ts.Sub(a.KeepFiringSince) >= ar.KeepFiringFor {
 					a.State = notifier.StateInactive
 					a.ResolvedAt = ts
+					ar.recordTransition(ts, a, notifier.StateFiring, notifier.StateInactive)
 					// add stale time series
 					tss = append(tss, firingAlertStaleTimeSeries(a.Labels, ts.Unix())...)
 
@@ -588,6 +610,7 @@ func (ar *AlertingRule) exec(ctx context.Context, ts time.Time, limit int) ([]pr
 			a.State = notifier.StateFiring
 			a.Start = ts
 			alertsFired.Inc()
+			ar.recordTransition(ts, a, notifier.StatePending, notifier.StateFiring)
 			if ar.For > 0 {
 				// add stale time series
 				tss = append(tss, pendingAlertStaleTimeSeries(a.Labels, ts.Unix(), false)...)
@@ -596,6 +619,12 @@ func (ar *AlertingRule) exec(ctx context.Context, ts time.Time, limit int) ([]pr
 		}
 	}
 	if limit > 0 && numActivePending > limit {
+		// all the alerts are dropped, so record their transitions to inactive state
+		for _, a := range ar.alerts {
+			if a.State != notifier.StateInactive {
+				ar.recordTransition(ts, a, a.State, notifier.StateInactive)
+			}
+		}
 		ar.alerts = map[uint64]*notifier.Alert{}
 		curState.Err = fmt.Errorf("exec exceeded limit of %d with %d alerts", limit, numActivePending)
 		return nil, curState.Err
@@ -16,6 +16,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/history"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/vmalertutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
@@ -1097,6 +1098,44 @@ func TestAlertingRuleLimit_Failure(t *testing.T) {
 	f(1, "exec exceeded limit of 1 with 2 alerts")
 }
 
+func TestAlertingRuleLimit_History(t *testing.T) {
+	if err := history.Init(nil); err != nil {
+		t.Fatalf("cannot init alerts history: %s", err)
+	}
+	defer func() {
+		if err := history.Stop(); err != nil {
+			t.Fatalf("cannot stop alerts history: %s", err)
+		}
+	}()
+
+	fq := &datasource.FakeQuerier{}
+	ar := newTestAlertingRule("test", 0)
+	ar.q = fq
+	ar.For = time.Minute
+
+	fq.Add(metricWithValueAndLabels(t, 1, "__name__", "foo", "job", "bar"))
+	fq.Add(metricWithValueAndLabels(t, 1, "__name__", "foo", "job", "baz"))
+
+	timestamp := time.Now()
+	if _, err := ar.exec(context.TODO(), timestamp, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := ar.exec(context.TODO(), timestamp.Add(time.Second), 1); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+
+	// alerts dropped because of the exceeded limit must be recorded as resolved
+	entries := history.Entries(ar.ID(), time.Time{}, time.Time{})
+	if len(entries) != 4 {
+		t.Fatalf("expecting 4 entries in alerts history; got %d: %v", len(entries), entries)
+	}
+	for _, e := range entries[2:] {
+		if e.From != notifier.StatePending.String() || e.To != notifier.StateInactive.String() {
+			t.Fatalf("unexpected transition %s => %s; want %s => %s", e.From, e.To, notifier.StatePending, notifier.StateInactive)
+		}
+	}
+}
+
 func TestAlertingRuleLimit_Success(t *testing.T) {
 	f := func(limit int) {
 		t.Helper()
@@ -0,0 +1,69 @@
+package rule
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+)
+
+const (
+	// anomalyScoreMetricName is the metric name for time series with anomaly scores
+	// produced by anomaly rules.
+	anomalyScoreMetricName = "anomaly_score"
+	// anomalyNameLabel is the label name indicating the name of an anomaly rule.
+	anomalyNameLabel = "anomaly"
+)
+
+// newAnomalyRules returns rules for the given anomaly rule config.
+//
+// Anomaly rule is evaluated via two rules sharing the same score expression:
+// the recording rule writes `anomaly_score` series and the alerting rule
+// fires when the absolute score value exceeds the detector threshold.
+func newAnomalyRules(qb datasource.QuerierBuilder, g *Group, cfg config.Rule) []Rule {
+	score := anomalyScoreExpr(cfg.Expr, cfg.Detector)
+
+	labels := make(map[string]string, len(cfg.Labels)+1)
+	maps.Copy(labels, cfg.Labels)
+	labels[anomalyNameLabel] = cfg.Anomaly
+	rrCfg := config.Rule{
+		Record:             anomalyScoreMetricName,
+		Expr:               score,
+		Labels:             labels,
+		Debug:              cfg.Debug,
+		UpdateEntriesLimit: cfg.UpdateEntriesLimit,
+	}
+	rrCfg.ID = config.HashRule(rrCfg)
+
+	arCfg := cfg
+	arCfg.Anomaly = ""
+	arCfg.Detector = nil
+	arCfg.Alert = cfg.Anomaly
+	arCfg.Expr = fmt.Sprintf("abs(%s) > %s", score, strconv.FormatFloat(cfg.Detector.GetThreshold(), 'g', -1, 64))
+
+	return []Rule{
+		NewRecordingRule(qb, g, rrCfg),
+		NewAlertingRule(qb, g, arCfg),
+	}
+}
+
+// anomalyScoreExpr returns MetricsQL expression for calculating anomaly score
+// of the given expr according to the detector settings.
+func anomalyScoreExpr(expr string, ad *config.AnomalyDetector) string {
+	lookback := config.FormatDuration(ad.GetLookback())
+	// The divisor is filtered with `> 0`, since the score is undefined for flat series,
+	// and division by zero would return Inf, which triggers the alert.
+	switch ad.Method {
+	case config.AnomalyMethodMAD:
+		return fmt.Sprintf("((%s) - median_over_time((%s)[%s:])) / (mad_over_time((%s)[%s:]) > 0)",
+			expr, expr, lookback, expr, lookback)
+	case config.AnomalyMethodSeasonal:
+		season := config.FormatDuration(ad.GetSeason())
+		return fmt.Sprintf("((%s) - avg_over_time((%s)[%s:] offset %s)) / (stddev_over_time((%s)[%s:] offset %s) > 0)",
+			expr, expr, lookback, season, expr, lookback, season)
+	default:
+		return fmt.Sprintf("zscore_over_time((%s)[%s:])", expr, lookback)
+	}
+}
@@ -0,0 +1,83 @@
+package rule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
+)
+
+func TestAnomalyScoreExpr(t *testing.T) {
+	f := func(ad *config.AnomalyDetector, exprExpected string) {
+		t.Helper()
+
+		expr := anomalyScoreExpr("sum(rate(foo[5m]))", ad)
+		if expr != exprExpected {
+			t.Fatalf("unexpected expr;\ngot\n%s\nwant\n%s", expr, exprExpected)
+		}
+	}
+
+	f(&config.AnomalyDetector{Method: config.AnomalyMethodZScore},
+		"zscore_over_time((sum(rate(foo[5m])))[1d:])")
+	f(&config.AnomalyDetector{Method: config.AnomalyMethodMAD, Lookback: promutil.NewDuration(6 * time.Hour)},
+		"((sum(rate(foo[5m]))) - median_over_time((sum(rate(foo[5m])))[6h:])) / (mad_over_time((sum(rate(foo[5m])))[6h:]) > 0)")
+	f(&config.AnomalyDetector{Method: config.AnomalyMethodSeasonal},
+		"((sum(rate(foo[5m]))) - avg_over_time((sum(rate(foo[5m])))[1h:] offset 7d)) / (stddev_over_time((sum(rate(foo[5m])))[1h:] offset 7d) > 0)")
+}
+
+func TestNewGroup_AnomalyRule(t *testing.T) {
+	threshold := 4.5
+	cfg := config.Group{
+		Name: "anomalies",
+		Labels: map[string]string{
+			"team": "foo",
+		},
+		Rules: []config.Rule{{
+			ID:      1,
+			Anomaly: "RequestsAnomaly",
+			Expr:    "sum(rate(foo[5m]))",
+			Detector: &config.AnomalyDetector{
+				Method:    config.AnomalyMethodZScore,
+				Threshold: &threshold,
+			},
+		}},
+	}
+	g := NewGroup(cfg, &datasource.FakeQuerier{}, 0, nil)
+	if len(g.Rules) != 2 {
+		t.Fatalf("expected to get 2 rules; got %d", len(g.Rules))
+	}
+
+	rr, ok := g.Rules[0].(*RecordingRule)
+	if !ok {
+		t.Fatalf("expected to get recording rule; got %T", g.Rules[0])
+	}
+	if rr.Name != anomalyScoreMetricName {
+		t.Fatalf("unexpected recording rule name %q", rr.Name)
+	}
+	if rr.Labels[anomalyNameLabel] != "RequestsAnomaly" || rr.Labels["team"] != "foo" {
+		t.Fatalf("unexpected recording rule labels: %v", rr.Labels)
+	}
+
+	ar, ok := g.Rules[1].(*AlertingRule)
+	if !ok {
+		t.Fatalf("expected to get alerting rule; got %T", g.Rules[1])
+	}
+	if ar.ID() != 1 {
+		t.Fatalf("expected alerting rule to keep anomaly rule ID; got %d", ar.ID())
+	}
+	if ar.Name != "RequestsAnomaly" {
+		t.Fatalf("unexpected alerting rule name %q", ar.Name)
+	}
+	exprExpected := "abs(zscore_over_time((sum(rate(foo[5m])))[1d:])) > 4.5"
+	if ar.Expr != exprExpected {
+		t.Fatalf("unexpected alerting rule expr;\ngot\n%s\nwant\n%s", ar.Expr, exprExpected)
+	}
+	if _, ok := ar.Labels[anomalyNameLabel]; ok {
+		t.Fatalf("alerting rule isn't expected to have %q label; got %v", anomalyNameLabel, ar.Labels)
+	}
+	if rr.ID() == ar.ID() {
+		t.Fatalf("expected recording and alerting rules to have different IDs")
+	}
+}
@@ -165,8 +165,8 @@ func NewGroup(cfg config.Group, qb datasource.QuerierBuilder, defaultInterval ti
 	for _, h := range cfg.NotifierHeaders {
 		g.NotifierHeaders[h.Key] = h.Value
 	}
-	rules := make([]Rule, len(cfg.Rules))
-	for i, r := range cfg.Rules {
+	rules := make([]Rule, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
 		var extraLabels map[string]string
 		// apply external labels
 		if len(labels) > 0 {
@@ -181,7 +181,11 @@ func NewGroup(cfg config.Group, qb datasource.QuerierBuilder, defaultInterval ti
 			r.Labels = mergeLabels(g.Name, r.Name(), extraLabels, r.Labels)
 		}
 
-		rules[i] = g.newRule(qb, r)
+		if r.Anomaly != "" {
+			rules = append(rules, newAnomalyRules(qb, g, r)...)
+			continue
+		}
+		rules = append(rules, g.newRule(qb, r))
 	}
 	g.Rules = rules
 	return g
@@ -549,8 +553,23 @@ func (g *Group) infof(format string, args ...any) {
 		g.Name, g.File, g.Interval, g.EvalOffset, g.Concurrency, msg)
 }
 
-// Replay performs group replay
-func (g *Group) Replay(start, end time.Time, rw remotewrite.RWClient, maxDataPoint, replayRuleRetryAttempts int, replayDelay time.Duration, disableProgressBar bool, ruleEvaluationConcurrency int, continueWithExecutionErr bool) int {
+// ReplayProgress stores the replay progress of rules,
+// so the interrupted replay could be resumed.
+type ReplayProgress interface {
+	// Get returns the timestamp till which the rule with the given ruleID
+	// from the group with the given groupID was already replayed.
+	// Returns zero time if rule wasn't replayed yet.
+	Get(groupID, ruleID uint64) time.Time
+	// Set persists the timestamp till which the rule was replayed.
+	Set(groupID, ruleID uint64, ts time.Time) error
+}
+
+// Replay performs group replay.
+//
+// If progress isn't nil, then time ranges already replayed according to progress are skipped,
+// and progress is periodically updated after the results for the replayed time ranges are flushed to rw.
+// rw must implement remotewrite.Flusher in this case.
+func (g *Group) Replay(start, end time.Time, rw remotewrite.RWClient, maxDataPoint, replayRuleRetryAttempts int, replayDelay time.Duration, disableProgressBar bool, ruleEvaluationConcurrency int, continueWithExecutionErr bool, progress ReplayProgress) int {
 	var total int
 	step := g.Interval * time.Duration(maxDataPoint)
 	ri := rangeIterator{start: start, end: end, step: step}
@@ -578,7 +597,7 @@ func (g *Group) Replay(start, end time.Time, rw remotewrite.RWClient, maxDataPoi
 			if !disableProgressBar {
 				bar = pb.StartNew(iterations)
 			}
-			total += replayRuleRange(rule, ri, bar, rw, replayRuleRetryAttempts, ruleEvaluationConcurrency, continueWithExecutionErr)
+			total += replayRuleRange(rule, g.GetID(), ri, bar, rw, replayRuleRetryAttempts, ruleEvaluationConcurrency, continueWithExecutionErr, progress)
 			if bar != nil {
 				bar.Finish()
 			}
@@ -600,7 +619,7 @@ func (g *Group) Replay(start, end time.Time, rw remotewrite.RWClient, maxDataPoi
 		rule := g.Rules[i]
 		sem <- struct{}{}
 		wg.Go(func() {
-			res <- replayRuleRange(rule, ri, bar, rw, replayRuleRetryAttempts, ruleEvaluationConcurrency, continueWithExecutionErr)
+			res <- replayRuleRange(rule, g.GetID(), ri, bar, rw, replayRuleRetryAttempts, ruleEvaluationConcurrency, continueWithExecutionErr, progress)
 			<-sem
 		})
 	}
@@ -620,25 +639,61 @@ func (g *Group) Replay(start, end time.Time, rw remotewrite.RWClient, maxDataPoi
 	return total
 }
 
-func replayRuleRange(r Rule, ri rangeIterator, bar *pb.ProgressBar, rw remotewrite.RWClient, replayRuleRetryAttempts, ruleEvaluationConcurrency int, continueWithExecutionErr bool) int {
+func replayRuleRange(r Rule, groupID uint64, ri rangeIterator, bar *pb.ProgressBar, rw remotewrite.RWClient, replayRuleRetryAttempts, ruleEvaluationConcurrency int, continueWithExecutionErr bool, progress ReplayProgress) int {
 	fmt.Printf("> Rule %q (ID: %d)\n", r, r.ID())
 	// alerting rule with for>0 can't be replayed concurrently, since the status change might depend on the previous evaluation
 	// see https://github.com/VictoriaMetrics/VictoriaMetrics/commit/abcb21aa5ee918ba9a4e9cde495dba06e1e9564c
 	if r, ok := r.(*AlertingRule); ok && r.For > 0 {
 		ruleEvaluationConcurrency = 1
 	}
+	var pt *replayProgressTracker
+	var replayedTill time.Time
+	if progress != nil {
+		replayedTill = progress.Get(groupID, r.ID())
+		if !replayedTill.IsZero() {
+			fmt.Printf("> Rule %q (ID: %d) was already replayed till %v, resuming\n", r, r.ID(), replayedTill)
+		}
+		pt = &replayProgressTracker{
+			groupID:   groupID,
+			ruleID:    r.ID(),
+			progress:  progress,
+			rw:        rw,
+			done:      make(map[int]time.Time),
+			lastFlush: time.Now(),
+		}
+	}
 	sem := make(chan struct{}, ruleEvaluationConcurrency)
 	wg := sync.WaitGroup{}
 	res := make(chan int, int(ri.end.Sub(ri.start)/ri.step)+1)
+	var skippedRanges [][2]time.Time
 	for ri.next() {
-		sem <- struct{}{}
 		start := ri.s
 		end := ri.e
+		idx := ri.iter - 1
+		if pt != nil && !end.After(replayedTill) {
+			// the range was replayed during the previous run
+			pt.next = idx + 1
+			skippedRanges = append(skippedRanges, [2]time.Time{start, end})
+			if bar != nil {
+				bar.Increment()
+			}
+			continue
+		}
+		if len(skippedRanges) > 0 {
+			restoreReplayState(r, skippedRanges, replayRuleRetryAttempts, continueWithExecutionErr)
+			skippedRanges = nil
+		}
+		sem <- struct{}{}
 		wg.Go(func() {
 			n, err := replayRule(r, start, end, rw, replayRuleRetryAttempts, continueWithExecutionErr)
 			if err != nil {
 				logger.Fatalf("rule %q: %s", r, err)
 			}
+			if pt != nil {
+				if err := pt.markDone(idx, end); err != nil {
+					logger.Fatalf("rule %q: cannot save replay progress: %s", r, err)
+				}
+			}
 			if bar != nil {
 				bar.Increment()
 			}
@@ -650,6 +705,12 @@ func replayRuleRange(r Rule, ri rangeIterator, bar *pb.ProgressBar, rw remotewri
 	close(res)
 	close(sem)
 
+	if pt != nil {
+		if err := pt.flush(); err != nil {
+			logger.Fatalf("rule %q: cannot save replay progress: %s", r, err)
+		}
+	}
+
 	total := 0
 	for n := range res {
 		total += n
@@ -657,6 +718,111 @@ func replayRuleRange(r Rule, ri rangeIterator, bar *pb.ProgressBar, rw remotewri
 	return total
 }
 
+// restoreReplayState restores the state of alerts with `for` param for the rule r on resuming the replay
+// by evaluating the already replayed ranges without writing the results.
+//
+// Only the ranges which may affect the state of alerts at the end of the last range are evaluated.
+func restoreReplayState(r Rule, ranges [][2]time.Time, replayRuleRetryAttempts int, continueWithExecutionErr bool) {
+	ar, ok := r.(*AlertingRule)
+	if !ok || ar.For <= 0 {
+		return
+	}
+	replayedTill := ranges[len(ranges)-1][1]
+	minEnd := replayedTill.Add(-ar.For)
+	fmt.Printf("> Rule %q (ID: %d): restoring the state of alerts from %v to %v\n", r, r.ID(), minEnd, replayedTill)
+	for _, tr := range ranges {
+		if !tr[1].After(minEnd) {
+			continue
+		}
+		if _, err := replayRule(r, tr[0], tr[1], discardRWClient{}, replayRuleRetryAttempts, continueWithExecutionErr); err != nil {
+			logger.Fatalf("rule %q: cannot restore the state of alerts: %s", r, err)
+		}
+	}
+}
+
+// discardRWClient drops all the pushed series.
+type discardRWClient struct{}
+
+func (discardRWClient) Push(_ prompb.TimeSeries) error { return nil }
+
+func (discardRWClient) Close() error { return nil }
+
+// replayProgressSaveInterval is the minimum interval between replay progress updates for a single rule.
+//
+// Every update requires flushing the replayed results to remote storage, so it shouldn't be performed too frequently.
+var replayProgressSaveInterval = 10 * time.Second
+
+// replayProgressTracker tracks time ranges replayed concurrently for a single rule
+// and updates ReplayProgress once all the ranges till the given one are replayed.
+type replayProgressTracker struct {
+	groupID  uint64
+	ruleID   uint64
+	progress ReplayProgress
+	rw       remotewrite.RWClient
+
+	mu sync.Mutex
+	// done contains end timestamps for replayed ranges with index >= next
+	done map[int]time.Time
+	// next is the index of the first range which wasn't replayed yet
+	next int
+
+	// pendingTill is the timestamp till which the rule was replayed, but the progress wasn't saved yet
+	pendingTill time.Time
+	// lastFlush is the time of the last progress update
+	lastFlush time.Time
+}
+
+func (pt *replayProgressTracker) markDone(idx int, end time.Time) error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	pt.done[idx] = end
+	var replayedTill time.Time
+	for {
+		ts, ok := pt.done[pt.next]
+		if !ok {
+			break
+		}
+		delete(pt.done, pt.next)
+		replayedTill = ts
+		pt.next++
+	}
+	if replayedTill.IsZero() {
+		return nil
+	}
+	pt.pendingTill = replayedTill
+	if time.Since(pt.lastFlush) < replayProgressSaveInterval {
+		return nil
+	}
+	return pt.flushLocked()
+}
+
+// flush saves the progress for all the replayed ranges.
+func (pt *replayProgressTracker) flush() error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	return pt.flushLocked()
+}
+
+func (pt *replayProgressTracker) flushLocked() error {
+	if pt.pendingTill.IsZero() {
+		return nil
+	}
+	// make sure the results are persisted before updating the progress
+	if f, ok := pt.rw.(remotewrite.Flusher); ok {
+		if err := f.Flush(); err != nil {
+			return fmt.Errorf("cannot flush replayed results: %w", err)
+		}
+	}
+	if err := pt.progress.Set(pt.groupID, pt.ruleID, pt.pendingTill); err != nil {
+		return err
+	}
+	pt.pendingTill = time.Time{}
+	pt.lastFlush = time.Now()
+	return nil
+}
+
 // ExecOnce evaluates all the rules under group for once with given timestamp.
 func (g *Group) ExecOnce(ctx context.Context, rw remotewrite.RWClient, evalTS time.Time) chan error {
 	e := &executor{
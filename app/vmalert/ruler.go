@@ -0,0 +1,482 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	configAPIDir = flag.String("rule.configAPIDir", "", "Optional path to the local directory for storing rule groups managed via config API. "+
+		"Config API is disabled if empty. See https://docs.victoriametrics.com/victoriametrics/vmalert/#rules-config-api")
+	configAPIAuthKey = flagutil.NewPassword("rule.configAPIAuthKey", "Auth key for config API endpoints. It must be passed via authKey query arg. It overrides -httpAuth.*")
+)
+
+const (
+	// configAPIPath is the path prefix for config API endpoints.
+	// It follows the ruler config API of Cortex and Mimir.
+	configAPIPath = "/config/v1/rules"
+
+	// tenantHeader contains the tenant ID for config API requests.
+	tenantHeader = "X-Scope-OrgID"
+	// defaultTenant is used for config API requests without tenantHeader.
+	defaultTenant = "anonymous"
+
+	maxConfigAPIRequestBodySize = 16 << 20
+)
+
+// configAPIReloadCh is notified when rule groups were changed via config API.
+var configAPIReloadCh = make(chan struct{}, 1)
+
+func notifyConfigAPIReload() {
+	select {
+	case configAPIReloadCh <- struct{}{}:
+	default:
+	}
+}
+
+// getRulePaths returns paths for reading rule groups from,
+// including the groups managed via config API.
+func getRulePaths() []string {
+	if *configAPIDir == "" {
+		return *rulePath
+	}
+	return append(slices.Clone(*rulePath), filepath.Join(*configAPIDir, "*", "*.yaml"))
+}
+
+// configAPITenant returns the tenant for the given rules file managed via config API.
+// It returns empty string if the file isn't managed via config API.
+func configAPITenant(file string) string {
+	if *configAPIDir == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(*configAPIDir, file)
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Dir(rel)
+	if dir == "." || dir == ".." || strings.ContainsRune(dir, filepath.Separator) {
+		return ""
+	}
+	tenant, err := url.PathUnescape(dir)
+	if err != nil {
+		return ""
+	}
+	return tenant
+}
+
+// setConfigAPITenantHeaders sets tenantHeader for datasource and notifier requests
+// of groups managed via config API, so rules of one tenant can't access data of other tenants.
+//
+// The header set in group config is overridden.
+func setConfigAPITenantHeaders(groups []config.Group) {
+	for i := range groups {
+		g := &groups[i]
+		tenant := configAPITenant(g.File)
+		if tenant == "" {
+			continue
+		}
+		g.Headers = withTenantHeader(g.Headers, tenant)
+		g.NotifierHeaders = withTenantHeader(g.NotifierHeaders, tenant)
+	}
+}
+
+func withTenantHeader(headers []config.Header, tenant string) []config.Header {
+	result := make([]config.Header, 0, len(headers)+1)
+	for _, h := range headers {
+		if !strings.EqualFold(h.Key, tenantHeader) {
+			result = append(result, h)
+		}
+	}
+	return append(result, config.Header{Key: tenantHeader, Value: tenant})
+}
+
+// rulesStorage stores rule groups managed via config API in the local directory.
+//
+// Groups are stored in files <dir>/<tenant>/<namespace>.yaml,
+// where every file has the same format as files passed via -rule flag.
+type rulesStorage struct {
+	dir string
+
+	// mu serializes modifications of the stored files
+	mu sync.Mutex
+}
+
+func newRulesStorage(dir string) *rulesStorage {
+	fs.MustMkdirIfNotExist(dir)
+	return &rulesStorage{dir: dir}
+}
+
+// rulesFile represents the content of the namespace file.
+// Groups are stored as yaml.MapSlice in order to return them exactly as they were set.
+type rulesFile struct {
+	Groups []yaml.MapSlice `yaml:"groups"`
+}
+
+func escapePathSegment(s string) (string, error) {
+	if s == "" || s == "." || s == ".." {
+		return "", fmt.Errorf("invalid name %q", s)
+	}
+	return url.PathEscape(s), nil
+}
+
+func (rs *rulesStorage) tenantDir(tenant string) (string, error) {
+	t, err := escapePathSegment(tenant)
+	if err != nil {
+		return "", fmt.Errorf("invalid tenant: %w", err)
+	}
+	return filepath.Join(rs.dir, t), nil
+}
+
+func (rs *rulesStorage) namespacePath(tenant, namespace string) (string, error) {
+	dir, err := rs.tenantDir(tenant)
+	if err != nil {
+		return "", err
+	}
+	ns, err := escapePathSegment(namespace)
+	if err != nil {
+		return "", fmt.Errorf("invalid namespace: %w", err)
+	}
+	return filepath.Join(dir, ns+".yaml"), nil
+}
+
+// getNamespace returns groups stored for the given tenant and namespace.
+// It returns nil if the namespace doesn't exist.
+func (rs *rulesStorage) getNamespace(tenant, namespace string) ([]yaml.MapSlice, error) {
+	path, err := rs.namespacePath(tenant, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return readRulesFile(path)
+}
+
+// listNamespaces returns all the namespaces with groups for the given tenant.
+func (rs *rulesStorage) listNamespaces(tenant string) (map[string][]yaml.MapSlice, error) {
+	dir, err := rs.tenantDir(tenant)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]yaml.MapSlice)
+	if !fs.IsPathExist(dir) {
+		return result, nil
+	}
+	for _, de := range fs.MustReadDir(dir) {
+		name, ok := strings.CutSuffix(de.Name(), ".yaml")
+		if !ok || de.IsDir() {
+			continue
+		}
+		namespace, err := url.PathUnescape(name)
+		if err != nil {
+			continue
+		}
+		groups, err := readRulesFile(filepath.Join(dir, de.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(groups) > 0 {
+			result[namespace] = groups
+		}
+	}
+	return result, nil
+}
+
+// setGroup creates or replaces the group with the same name in the given namespace.
+// The namespace content is validated before writing it.
+func (rs *rulesStorage) setGroup(tenant, namespace string, group yaml.MapSlice) error {
+	path, err := rs.namespacePath(tenant, namespace)
+	if err != nil {
+		return err
+	}
+	name := groupName(group)
+	if name == "" {
+		return fmt.Errorf("group name must be set")
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	groups, err := readRulesFile(path)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(groups, func(g yaml.MapSlice) bool {
+		return groupName(g) == name
+	})
+	if idx >= 0 {
+		groups[idx] = group
+	} else {
+		groups = append(groups, group)
+	}
+	return writeRulesFile(path, groups, true)
+}
+
+// deleteGroup deletes the group with the given name from the namespace.
+// It returns false if the group doesn't exist.
+func (rs *rulesStorage) deleteGroup(tenant, namespace, name string) (bool, error) {
+	path, err := rs.namespacePath(tenant, namespace)
+	if err != nil {
+		return false, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	groups, err := readRulesFile(path)
+	if err != nil {
+		return false, err
+	}
+	idx := slices.IndexFunc(groups, func(g yaml.MapSlice) bool {
+		return groupName(g) == name
+	})
+	if idx < 0 {
+		return false, nil
+	}
+	groups = slices.Delete(groups, idx, idx+1)
+	if len(groups) == 0 {
+		fs.MustRemovePath(path)
+		return true, nil
+	}
+	// there is no need in validating the remaining groups, since they were validated before
+	return true, writeRulesFile(path, groups, false)
+}
+
+// deleteNamespace deletes all the groups in the given namespace.
+// It returns false if the namespace doesn't exist.
+func (rs *rulesStorage) deleteNamespace(tenant, namespace string) (bool, error) {
+	path, err := rs.namespacePath(tenant, namespace)
+	if err != nil {
+		return false, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if !fs.IsPathExist(path) {
+		return false, nil
+	}
+	fs.MustRemovePath(path)
+	return true, nil
+}
+
+func groupName(g yaml.MapSlice) string {
+	for _, item := range g {
+		if k, ok := item.Key.(string); ok && k == "name" {
+			name, _ := item.Value.(string)
+			return name
+		}
+	}
+	return ""
+}
+
+func readRulesFile(path string) ([]yaml.MapSlice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read rules file: %w", err)
+	}
+	var rf rulesFile
+	if err := yaml.Unmarshal(data, &rf); err != nil {
+		return nil, fmt.Errorf("cannot parse rules file %q: %w", path, err)
+	}
+	return rf.Groups, nil
+}
+
+func writeRulesFile(path string, groups []yaml.MapSlice, validate bool) error {
+	data, err := yaml.Marshal(rulesFile{Groups: groups})
+	if err != nil {
+		return fmt.Errorf("cannot marshal rule groups: %w", err)
+	}
+	if validate {
+		var validateTplFn config.ValidateTplFn
+		if *validateTemplates {
+			validateTplFn = notifier.ValidateTemplates
+		}
+		if _, err := config.ParseData(map[string][]byte{path: data}, validateTplFn, *validateExpressions); err != nil {
+			return fmt.Errorf("invalid rule group: %w", err)
+		}
+	}
+	fs.MustMkdirIfNotExist(filepath.Dir(path))
+	fs.MustWriteAtomic(path, data, true)
+	return nil
+}
+
+// handleConfigAPI serves config API requests.
+// It follows the ruler config API of Cortex and Mimir:
+//
+//	GET    /config/v1/rules                        - list all the groups for the tenant
+//	GET    /config/v1/rules/{namespace}            - list the groups in the namespace
+//	GET    /config/v1/rules/{namespace}/{group}    - get the group
+//	POST   /config/v1/rules/{namespace}            - create or update the group in the namespace
+//	DELETE /config/v1/rules/{namespace}/{group}    - delete the group
+//	DELETE /config/v1/rules/{namespace}            - delete all the groups in the namespace
+//
+// The tenant is read from X-Scope-OrgID header.
+func (rh *requestHandler) handleConfigAPI(w http.ResponseWriter, r *http.Request, path string) {
+	if !httpserver.CheckAuthFlag(w, r, configAPIAuthKey) {
+		return
+	}
+	if rh.rules == nil {
+		httpserver.Errorf(w, r, "config API is disabled; set -rule.configAPIDir for enabling it")
+		return
+	}
+	tenant := r.Header.Get(tenantHeader)
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+
+	var args []string
+	for _, s := range strings.Split(strings.Trim(path, "/"), "/") {
+		if s == "" {
+			continue
+		}
+		arg, err := url.PathUnescape(s)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot unescape path segment %q: %s", s, err)
+			return
+		}
+		args = append(args, arg)
+	}
+	if len(args) > 2 {
+		httpserver.Errorf(w, r, "unsupported path %q", r.URL.Path)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rh.configAPIGet(w, r, tenant, args)
+	case http.MethodPost:
+		if len(args) != 1 {
+			httpserver.Errorf(w, r, "namespace must be set in path for %s request", r.Method)
+			return
+		}
+		rh.configAPISet(w, r, tenant, args[0])
+	case http.MethodDelete:
+		rh.configAPIDelete(w, r, tenant, args)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, fmt.Sprintf("unsupported method %s", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (rh *requestHandler) configAPIGet(w http.ResponseWriter, r *http.Request, tenant string, args []string) {
+	var v any
+	switch len(args) {
+	case 0:
+		namespaces, err := rh.rules.listNamespaces(tenant)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		v = sortedNamespaces(namespaces)
+	default:
+		groups, err := rh.rules.getNamespace(tenant, args[0])
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		if len(groups) == 0 {
+			http.Error(w, fmt.Sprintf("namespace %q not found", args[0]), http.StatusNotFound)
+			return
+		}
+		v = yaml.MapSlice{{Key: args[0], Value: groups}}
+		if len(args) == 2 {
+			idx := slices.IndexFunc(groups, func(g yaml.MapSlice) bool {
+				return groupName(g) == args[1]
+			})
+			if idx < 0 {
+				http.Error(w, fmt.Sprintf("group %q not found in namespace %q", args[1], args[0]), http.StatusNotFound)
+				return
+			}
+			v = groups[idx]
+		}
+	}
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot marshal response: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+func (rh *requestHandler) configAPISet(w http.ResponseWriter, r *http.Request, tenant, namespace string) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxConfigAPIRequestBodySize+1))
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot read request body: %s", err)
+		return
+	}
+	if len(data) > maxConfigAPIRequestBodySize {
+		httpserver.Errorf(w, r, "request body exceeds %d bytes", maxConfigAPIRequestBodySize)
+		return
+	}
+	var group yaml.MapSlice
+	if err := yaml.Unmarshal(data, &group); err != nil {
+		httpserver.Errorf(w, r, "cannot parse rule group: %s", err)
+		return
+	}
+	if err := rh.rules.setGroup(tenant, namespace, group); err != nil {
+		httpserver.Errorf(w, r, "cannot set rule group in namespace %q: %s", namespace, err)
+		return
+	}
+	logger.Infof("rule group %q in namespace %q for tenant %q was updated via config API", groupName(group), namespace, tenant)
+	notifyConfigAPIReload()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (rh *requestHandler) configAPIDelete(w http.ResponseWriter, r *http.Request, tenant string, args []string) {
+	var deleted bool
+	var err error
+	switch len(args) {
+	case 1:
+		deleted, err = rh.rules.deleteNamespace(tenant, args[0])
+	case 2:
+		deleted, err = rh.rules.deleteGroup(tenant, args[0], args[1])
+	default:
+		httpserver.Errorf(w, r, "namespace must be set in path for %s request", r.Method)
+		return
+	}
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if !deleted {
+		http.Error(w, "no rule groups found", http.StatusNotFound)
+		return
+	}
+	logger.Infof("rule groups %q were deleted via config API for tenant %q", args, tenant)
+	notifyConfigAPIReload()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sortedNamespaces returns namespaces sorted by name for deterministic output.
+func sortedNamespaces(m map[string][]yaml.MapSlice) yaml.MapSlice {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make(yaml.MapSlice, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, yaml.MapItem{Key: k, Value: m[k]})
+	}
+	return result
+}
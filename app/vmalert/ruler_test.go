@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/rule"
+)
+
+func TestHandler_ConfigAPI(t *testing.T) {
+	originalDir := *configAPIDir
+	originalRulePath := *rulePath
+	defer func() {
+		*configAPIDir = originalDir
+		*rulePath = originalRulePath
+	}()
+	*configAPIDir = t.TempDir()
+	*rulePath = nil
+
+	rh := &requestHandler{
+		m:     &manager{groups: map[uint64]*rule.Group{}},
+		rules: newRulesStorage(*configAPIDir),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { rh.handler(w, r) }))
+	defer ts.Close()
+
+	f := func(method, path, tenant, body string, codeExpected int, respExpected string) {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		if tenant != "" {
+			req.Header.Set(tenantHeader, tenant)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("cannot read response body: %s", err)
+		}
+		if resp.StatusCode != codeExpected {
+			t.Fatalf("unexpected status code for %s %s; got %d; want %d; response: %s", method, path, resp.StatusCode, codeExpected, data)
+		}
+		if respExpected != "" && string(data) != respExpected {
+			t.Fatalf("unexpected response for %s %s;\ngot\n%s\nwant\n%s", method, path, data, respExpected)
+		}
+	}
+
+	const group1 = `name: group1
+rules:
+- alert: foo
+  expr: up == 0
+`
+	const group2 = `name: group2
+interval: 1m
+rules:
+- record: bar
+  expr: sum(up)
+`
+
+	f(http.MethodGet, "/config/v1/rules", "", "", http.StatusOK, "{}\n")
+	f(http.MethodGet, "/config/v1/rules/ns1", "", "", http.StatusNotFound, "")
+
+	f(http.MethodPost, "/config/v1/rules/ns1", "", group1, http.StatusAccepted, "")
+	f(http.MethodPost, "/vmalert/config/v1/rules/ns1", "", group2, http.StatusAccepted, "")
+	f(http.MethodPost, "/config/v1/rules/ns%2F2", "tenant1", group1, http.StatusAccepted, "")
+	select {
+	case <-configAPIReloadCh:
+	default:
+		t.Fatalf("expecting config reload to be requested")
+	}
+
+	// invalid groups must be rejected
+	f(http.MethodPost, "/config/v1/rules/ns1", "", "name: bad\nrules:\n- alert: foo\n  expr: up ==\n", http.StatusBadRequest, "")
+	f(http.MethodPost, "/config/v1/rules/ns1", "", "rules:\n- alert: foo\n  expr: up\n", http.StatusBadRequest, "")
+	f(http.MethodPost, "/config/v1/rules", "", group1, http.StatusBadRequest, "")
+	f(http.MethodPost, "/config/v1/rules/..", "", group1, http.StatusBadRequest, "")
+
+	f(http.MethodGet, "/config/v1/rules/ns1/group1", "", "", http.StatusOK, group1)
+	f(http.MethodGet, "/config/v1/rules/ns1/group3", "", "", http.StatusNotFound, "")
+	f(http.MethodGet, "/config/v1/rules", "tenant1", "", http.StatusOK, `ns/2:
+- name: group1
+  rules:
+  - alert: foo
+    expr: up == 0
+`)
+
+	// update the group
+	group1Updated := strings.ReplaceAll(group1, "up == 0", "up == 1")
+	f(http.MethodPost, "/config/v1/rules/ns1", "", group1Updated, http.StatusAccepted, "")
+	f(http.MethodGet, "/config/v1/rules/ns1/group1", "", "", http.StatusOK, group1Updated)
+
+	groups, err := config.Parse(getRulePaths(), nil, true)
+	if err != nil {
+		t.Fatalf("cannot parse groups stored via config API: %s", err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("expecting 3 groups to be loaded; got %d", len(groups))
+	}
+
+	f(http.MethodDelete, "/config/v1/rules/ns1/group1", "", "", http.StatusAccepted, "")
+	f(http.MethodDelete, "/config/v1/rules/ns1/group1", "", "", http.StatusNotFound, "")
+	f(http.MethodGet, "/config/v1/rules/ns1", "", "", http.StatusOK, `ns1:
+- name: group2
+  interval: 1m
+  rules:
+  - record: bar
+    expr: sum(up)
+`)
+	f(http.MethodDelete, "/config/v1/rules/ns%2F2", "tenant1", "", http.StatusAccepted, "")
+	f(http.MethodDelete, "/config/v1/rules/ns%2F2", "tenant1", "", http.StatusNotFound, "")
+	f(http.MethodPut, "/config/v1/rules/ns1", "", "", http.StatusMethodNotAllowed, "")
+
+	groups, err = config.Parse(getRulePaths(), nil, true)
+	if err != nil {
+		t.Fatalf("cannot parse groups stored via config API: %s", err)
+	}
+	if len(groups) != 1 || groups[0].Name != "group2" {
+		t.Fatalf("expecting only group2 to remain; got %v", groups)
+	}
+
+	rhDisabled := &requestHandler{m: rh.m}
+	w := httptest.NewRecorder()
+	rhDisabled.handler(w, httptest.NewRequest(http.MethodGet, "/config/v1/rules", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expecting config API to be disabled; got status code %d", w.Code)
+	}
+}
@@ -61,6 +61,45 @@ func WithOAuth(clientID, clientSecret, clientSecretFile, tokenURL, scopes string
 	}
 }
 
+// WithAzureAD returns AuthConfigOptions and set Azure AD params based on given params
+func WithAzureAD(useManagedIdentity, useWorkloadIdentity bool, clientID, tenantID, cloud, scope string) AuthConfigOptions {
+	return func(config *promauth.HTTPClientConfig) {
+		if !useManagedIdentity && !useWorkloadIdentity {
+			return
+		}
+		config.AzureAD = &promauth.AzureADConfig{
+			Cloud: cloud,
+			Scope: scope,
+		}
+		if useManagedIdentity {
+			config.AzureAD.ManagedIdentity = &promauth.AzureManagedIdentityConfig{
+				ClientID: clientID,
+			}
+		}
+		if useWorkloadIdentity {
+			config.AzureAD.WorkloadIdentity = &promauth.AzureWorkloadIdentityConfig{
+				ClientID: clientID,
+				TenantID: tenantID,
+			}
+		}
+	}
+}
+
+// WithGoogleIAM returns AuthConfigOptions and set Google IAM params based on given params
+func WithGoogleIAM(enabled bool, credentialsFile, scopes string) AuthConfigOptions {
+	return func(config *promauth.HTTPClientConfig) {
+		if !enabled {
+			return
+		}
+		config.GoogleIAM = &promauth.GoogleIAMConfig{
+			CredentialsFile: credentialsFile,
+		}
+		if scopes != "" {
+			config.GoogleIAM.Scopes = strings.Split(scopes, ";")
+		}
+	}
+}
+
 // WithHeaders returns AuthConfigOptions and set Headers based on the given params
 func WithHeaders(headers string) AuthConfigOptions {
 	return func(config *promauth.HTTPClientConfig) {
@@ -10,10 +10,12 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/VictoriaMetrics/metricsql"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/history"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/rule"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/tpl"
@@ -22,6 +24,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
 )
 
 var reloadAuthKey = flagutil.NewPassword("reloadAuthKey", "Auth key for /-/reload http endpoint. It must be passed via authKey query arg. It overrides -httpAuth.*")
@@ -33,6 +36,7 @@ var (
 		{"api/v1/rules", "list all loaded groups and rules"},
 		{"api/v1/alerts", "list all active alerts"},
 		{"api/v1/notifiers", "list all notifiers"},
+		{fmt.Sprintf("api/v1/alerts/history?%s=<int>&from=<time>&to=<time>", rule.ParamRuleID), "list alert state transitions"},
 		{fmt.Sprintf("api/v1/alert?%s=<int>&%s=<int>", rule.ParamGroupID, rule.ParamAlertID), "get alert status by group and alert ID"},
 		{fmt.Sprintf("api/v1/rule?%s=<int>&%s=<int>", rule.ParamGroupID, rule.ParamRuleID), "get rule status by group and rule ID"},
 		{fmt.Sprintf("api/v1/group?%s=<int>", rule.ParamGroupID), "get group status by group ID"},
@@ -65,6 +69,8 @@ var (
 
 type requestHandler struct {
 	m *manager
+	// rules is nil if config API is disabled
+	rules *rulesStorage
 }
 
 var (
@@ -88,6 +94,14 @@ func (rh *requestHandler) handler(w http.ResponseWriter, r *http.Request) bool {
 		return true
 	}
 
+	for _, prefix := range []string{configAPIPath, "/vmalert" + configAPIPath} {
+		// use escaped path, since namespace and group names may contain slashes
+		if path, ok := strings.CutPrefix(r.URL.EscapedPath(), prefix); ok && (path == "" || path[0] == '/') {
+			rh.handleConfigAPI(w, r, path)
+			return true
+		}
+	}
+
 	switch r.URL.Path {
 	case "/", "/vmalert", "/vmalert/":
 		if r.Method != http.MethodGet {
@@ -177,6 +191,15 @@ func (rh *requestHandler) handler(w http.ResponseWriter, r *http.Request) bool {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(data)
 		return true
+	case "/vmalert/api/v1/alerts/history", "/api/v1/alerts/history":
+		data, err := rh.listAlertsHistory(r)
+		if err != nil {
+			errJson(w, r, err)
+			return true
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return true
 	case "/vmalert/api/v1/alert", "/api/v1/alert":
 		alert, err := rh.getAlert(r)
 		if err != nil {
@@ -665,6 +688,57 @@ func (rh *requestHandler) listAlerts(af *alertsFilter) ([]byte, *httpserver.Erro
 	return b, nil
 }
 
+type listAlertsHistoryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Entries []history.Entry `json:"entries"`
+	} `json:"data"`
+}
+
+func (rh *requestHandler) listAlertsHistory(r *http.Request) ([]byte, *httpserver.ErrorWithStatusCode) {
+	if !history.Enabled() {
+		return nil, errResponse(fmt.Errorf("alerts history is disabled; see -history.maxEntries"), http.StatusBadRequest)
+	}
+	var ruleID uint64
+	if s := r.FormValue(rule.ParamRuleID); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, errResponse(fmt.Errorf("failed to read %q param: %w", rule.ParamRuleID, err), http.StatusBadRequest)
+		}
+		ruleID = id
+	}
+	getTime := func(argKey string) (time.Time, *httpserver.ErrorWithStatusCode) {
+		s := r.FormValue(argKey)
+		if s == "" {
+			return time.Time{}, nil
+		}
+		msecs, err := timeutil.ParseTimeMsec(s)
+		if err != nil {
+			return time.Time{}, errResponse(fmt.Errorf("failed to read %q param: %w", argKey, err), http.StatusBadRequest)
+		}
+		return time.UnixMilli(msecs), nil
+	}
+	from, errStatus := getTime("from")
+	if errStatus != nil {
+		return nil, errStatus
+	}
+	to, errStatus := getTime("to")
+	if errStatus != nil {
+		return nil, errStatus
+	}
+
+	lr := listAlertsHistoryResponse{Status: "success"}
+	lr.Data.Entries = history.Entries(ruleID, from, to)
+	if lr.Data.Entries == nil {
+		lr.Data.Entries = make([]history.Entry, 0)
+	}
+	b, err := json.Marshal(lr)
+	if err != nil {
+		return nil, errResponse(fmt.Errorf(`error encoding alerts history: %w`, err), http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
 type listNotifiersResponse struct {
 	Status string `json:"status"`
 	Data   struct {
@@ -14,6 +14,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/history"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/rule"
 )
@@ -503,3 +504,69 @@ func TestMatchesRule(t *testing.T) {
 		false,
 	)
 }
+
+func TestHandler_AlertsHistory(t *testing.T) {
+	if err := history.Init(nil); err != nil {
+		t.Fatalf("cannot init alerts history: %s", err)
+	}
+	defer func() {
+		if err := history.Stop(); err != nil {
+			t.Fatalf("cannot stop alerts history: %s", err)
+		}
+	}()
+
+	fq := &datasource.FakeQuerier{}
+	fq.Add(datasource.Metric{
+		Values:     []float64{1},
+		Timestamps: []int64{0},
+	})
+	_, cleanup := notifier.InitFakeNotifier()
+	defer cleanup()
+
+	g := rule.NewGroup(config.Group{
+		Name:        "group",
+		Concurrency: 1,
+		Rules: []config.Rule{
+			{ID: 1, Alert: "alert"},
+			{ID: 2, Alert: "another_alert"},
+		},
+	}, fq, time.Minute, nil)
+	evalTS := time.Now().Truncate(time.Second)
+	g.ExecOnce(context.Background(), nil, evalTS)
+
+	m := &manager{groups: map[uint64]*rule.Group{g.CreateID(): g}}
+	rh := &requestHandler{m: m}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { rh.handler(w, r) }))
+	defer ts.Close()
+
+	f := func(query string, entriesExpected int, code int) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/v1/alerts/history?" + query)
+		if err != nil {
+			t.Fatalf("unexpected err %s", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != code {
+			t.Fatalf("unexpected status code %d want %d", resp.StatusCode, code)
+		}
+		if code != http.StatusOK {
+			return
+		}
+		var lr listAlertsHistoryResponse
+		if err := json.NewDecoder(resp.Body).Decode(&lr); err != nil {
+			t.Fatalf("unexpected err %s", err)
+		}
+		if len(lr.Data.Entries) != entriesExpected {
+			t.Fatalf("expected %d entries; got %d: %v", entriesExpected, len(lr.Data.Entries), lr.Data.Entries)
+		}
+	}
+
+	// every alert with for=0 transitions inactive => pending => firing within the same evaluation
+	f("", 4, http.StatusOK)
+	f("rule_id=1", 2, http.StatusOK)
+	f("rule_id=3", 0, http.StatusOK)
+	f(fmt.Sprintf("rule_id=1&from=%d", evalTS.Unix()), 2, http.StatusOK)
+	f(fmt.Sprintf("rule_id=1&to=%d", evalTS.Add(-time.Second).Unix()), 0, http.StatusOK)
+	f("rule_id=foo", 0, http.StatusBadRequest)
+	f("from=bar", 0, http.StatusBadRequest)
+}
@@ -33,6 +33,9 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/secretprovider"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 )
 
 var (
@@ -61,6 +64,9 @@ type AuthConfig struct {
 
 	// ms holds all the metrics for the given AuthConfig
 	ms *metrics.Set
+
+	// secrets holds values for secret references in the config at the time it was loaded.
+	secrets map[string]string
 }
 
 // UserInfo is user information read from authConfigPath
@@ -73,6 +79,8 @@ type UserInfo struct {
 	Username    string     `yaml:"username,omitempty"`
 	Password    string     `yaml:"password,omitempty"`
 
+	MTLS *MTLSConfig `yaml:"mtls,omitempty"`
+
 	URLPrefix              *URLPrefix  `yaml:"url_prefix,omitempty"`
 	DiscoverBackendIPs     *bool       `yaml:"discover_backend_ips,omitempty"`
 	URLMaps                []URLMap    `yaml:"url_map,omitempty"`
@@ -94,9 +102,24 @@ type UserInfo struct {
 
 	AccessLog *AccessLog `yaml:"access_log,omitempty"`
 
+	MaxRequestsPerSecond     float64 `yaml:"max_requests_per_second,omitempty"`
+	MaxRequestBytesPerSecond int64   `yaml:"max_request_bytes_per_second,omitempty"`
+
+	HedgeDelay    *HedgeDelay `yaml:"hedge_delay,omitempty"`
+	ShadowURL     string      `yaml:"shadow_url,omitempty"`
+	ShadowPercent *float64    `yaml:"shadow_percent,omitempty"`
+
+	EnforceLabels []string `yaml:"enforce_labels,omitempty"`
+
 	concurrencyLimitCh      chan struct{}
 	concurrencyLimitReached *metrics.Counter
 
+	rateLimits       *rateLimits
+	rateLimitReached *metrics.Counter
+
+	// hasRequestBytesLimits is set to true if max_request_bytes_per_second is set either at user or at url_map level.
+	hasRequestBytesLimits bool
+
 	rt http.RoundTripper
 
 	requests         *metrics.Counter
@@ -117,7 +140,7 @@ type AccessLogFilters struct {
 	SkipStatusCodes []int `yaml:"skip_status_codes"`
 }
 
-func (ui *UserInfo) logRequest(r *http.Request, userName string, statusCode int, duration time.Duration) {
+func (ui *UserInfo) logRequest(r *http.Request, userName string, statusCode int, duration time.Duration, span *tracing.Span) {
 	if ui == nil || ui.AccessLog == nil {
 		return
 	}
@@ -131,8 +154,17 @@ func (ui *UserInfo) logRequest(r *http.Request, userName string, statusCode int,
 
 	remoteAddr := httpserver.GetQuotedRemoteAddr(r)
 	requestURI := httpserver.GetRequestURI(r)
-	logger.Infof("access_log request_host=%q request_uri=%q status_code=%d remote_addr=%s user_agent=%q referer=%q duration_ms=%d username=%q",
-		r.Host, requestURI, statusCode, remoteAddr, r.UserAgent(), r.Referer(), duration.Milliseconds(), userName)
+	var traceID string
+	if span != nil {
+		// Allow correlating the access log with the trace for the request.
+		// See https://docs.victoriametrics.com/victoriametrics/vmauth/#tracing
+		sc := span.SpanContext()
+		traceID = fmt.Sprintf(" trace_id=%q", sc.TraceID.String())
+	}
+	logger.Infof("access_log request_host=%q request_uri=%q status_code=%d remote_addr=%s user_agent=%q referer=%q duration_ms=%d username=%q%s",
+		r.Host, requestURI, statusCode, remoteAddr, r.UserAgent(), r.Referer(), duration.Milliseconds(), userName, traceID)
+
+	exportAccessLog(r, userName, statusCode, duration, span)
 }
 
 // hasAnyURLs reports whether ui has at least one backend URL route configured.
@@ -280,6 +312,27 @@ type URLMap struct {
 
 	// DropSrcPathPrefixParts is the number of `/`-delimited request path prefix parts to drop before proxying the request to backend.
 	DropSrcPathPrefixParts *int `yaml:"drop_src_path_prefix_parts,omitempty"`
+
+	// MaxRequestsPerSecond is the maximum number of requests per second, which can be proxied via the given url_map entry.
+	MaxRequestsPerSecond float64 `yaml:"max_requests_per_second,omitempty"`
+
+	// MaxRequestBytesPerSecond is the maximum number of request body bytes per second, which can be proxied via the given url_map entry.
+	MaxRequestBytesPerSecond int64 `yaml:"max_request_bytes_per_second,omitempty"`
+
+	// ResponseCacheTTL is the duration for caching backend responses for the given url_map entry.
+	ResponseCacheTTL *promutil.Duration `yaml:"response_cache_ttl,omitempty"`
+
+	// HedgeDelay is the delay before sending a hedged request to another backend for the given url_map entry.
+	HedgeDelay *HedgeDelay `yaml:"hedge_delay,omitempty"`
+
+	// ShadowURL is the backend url for mirroring requests for the given url_map entry.
+	ShadowURL string `yaml:"shadow_url,omitempty"`
+
+	// ShadowPercent is the percent of requests to mirror to ShadowURL.
+	ShadowPercent *float64 `yaml:"shadow_percent,omitempty"`
+
+	// EnforceLabels is a list of `name=value` labels, which must be enforced for requests to the given url_map entry.
+	EnforceLabels []string `yaml:"enforce_labels,omitempty"`
 }
 
 // QueryArg represents HTTP query arg
@@ -340,6 +393,30 @@ type URLPrefix struct {
 	// how many request path prefix parts to drop before routing the request to backendURL
 	dropSrcPathPrefixParts int
 
+	// rate limits for the url_map entry the given url_prefix belongs to
+	rateLimits *rateLimits
+
+	// the duration for caching backend responses for the url_map entry the given url_prefix belongs to
+	//
+	// responses aren't cached if it is zero.
+	responseCacheTTL time.Duration
+
+	// the delay before sending a hedged request to another backend
+	//
+	// requests aren't hedged if it is nil.
+	hedgeDelay *HedgeDelay
+
+	// latencyTracker tracks backend response latencies if hedgeDelay is set to a percentile
+	latencyTracker *latencyTracker
+
+	// the config for mirroring requests to a shadow backend
+	shadow *shadowConfig
+
+	// labelEnforcer enforces label filters for requests
+	//
+	// labels aren't enforced if it is nil.
+	labelEnforcer *labelEnforcer
+
 	// busOriginal contains the original list of backends specified in yaml config.
 	busOriginal []*url.URL
 
@@ -836,6 +913,14 @@ func authConfigReloader(sighupCh <-chan os.Signal) {
 		refreshCh = ticker.C
 	}
 
+	// Periodically check whether secrets referred in the config have been rotated.
+	var secretsRefreshCh <-chan time.Time
+	if d := secretprovider.RefreshInterval(); d > 0 {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		secretsRefreshCh = ticker.C
+	}
+
 	updateFn := func() {
 		configReloads.Inc()
 		updated, err := reloadAuthConfig()
@@ -862,6 +947,11 @@ func authConfigReloader(sighupCh <-chan os.Signal) {
 			return
 		case <-refreshCh:
 			updateFn()
+		case <-secretsRefreshCh:
+			if authConfig.Load().secretsChanged() {
+				logger.Infof("secrets referred in -auth.config=%q have been changed; reloading it", *authConfigPath)
+				updateFn()
+			}
 		case <-sighupCh:
 			logger.Infof("SIGHUP received; loading -auth.config=%q", *authConfigPath)
 			updateFn()
@@ -913,8 +1003,8 @@ func reloadAuthConfig() (bool, error) {
 
 func reloadAuthConfigData(data []byte) (bool, error) {
 	oldData := authConfigData.Load()
-	if oldData != nil && bytes.Equal(data, *oldData) {
-		// there are no updates in the config - skip reloading.
+	if oldData != nil && bytes.Equal(data, *oldData) && !authConfig.Load().secretsChanged() {
+		// there are no updates in the config and in the secrets referred by it - skip reloading.
 		return false, nil
 	}
 
@@ -922,6 +1012,9 @@ func reloadAuthConfigData(data []byte) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("failed to parse auth config: %w", err)
 	}
+	if err := checkMTLSCAFile(ac); err != nil {
+		return false, err
+	}
 
 	oidcDP := &oidcDiscovererPool{}
 	jui, err := parseJWTUsers(ac, oidcDP)
@@ -966,11 +1059,17 @@ func reloadAuthConfigData(data []byte) (bool, error) {
 func parseAuthConfig(data []byte) (*AuthConfig, error) {
 	data = envtemplate.ReplaceBytes(data)
 	ac := &AuthConfig{
-		ms: metrics.NewSet(),
+		ms:      metrics.NewSet(),
+		secrets: make(map[string]string),
 	}
 	if err := yaml.UnmarshalStrict(data, ac); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal AuthConfig data: %w", err)
 	}
+	for i := range ac.Users {
+		if err := ac.Users[i].resolveSecretRefs(ac.secrets); err != nil {
+			return nil, err
+		}
+	}
 
 	ui := ac.UnauthorizedUser
 	if ui != nil {
@@ -989,6 +1088,9 @@ func parseAuthConfig(data []byte) (*AuthConfig, error) {
 		if ui.AuthToken != "" {
 			return nil, fmt.Errorf("field auth_token can't be specified for unauthorized_user section")
 		}
+		if ui.MTLS != nil {
+			return nil, fmt.Errorf("field mtls can't be specified for unauthorized_user section")
+		}
 		if ui.Name != "" {
 			return nil, fmt.Errorf("field name can't be specified for unauthorized_user section")
 		}
@@ -1013,6 +1115,7 @@ func parseAuthConfig(data []byte) (*AuthConfig, error) {
 		ui.requestsDuration = ac.ms.NewSummary(`vmauth_unauthorized_user_request_duration_seconds` + metricLabels)
 		ui.concurrencyLimitCh = make(chan struct{}, ui.getMaxConcurrentRequests())
 		ui.concurrencyLimitReached = ac.ms.NewCounter(`vmauth_unauthorized_user_concurrent_requests_limit_reached_total` + metricLabels)
+		ui.rateLimitReached = ac.ms.NewCounter(`vmauth_unauthorized_user_rate_limit_reached_total` + metricLabels)
 		_ = ac.ms.NewGauge(`vmauth_unauthorized_user_concurrent_requests_capacity`+metricLabels, func() float64 {
 			return float64(cap(ui.concurrencyLimitCh))
 		})
@@ -1038,13 +1141,16 @@ func parseAuthConfigUsers(ac *AuthConfig) (map[string]*UserInfo, error) {
 	}
 	for i := range uis {
 		ui := &uis[i]
+		if ui.MTLS != nil && ui.JWT != nil {
+			return nil, fmt.Errorf("mtls cannot be specified if jwt is set")
+		}
 		// users with jwt tokens are parsed by parseJWTUsers function.
 		// the function also checks that users with jwt tokens do not have auth tokens, bearer tokens, usernames and passwords.
 		if ui.JWT != nil {
 			continue
 		}
 
-		ats, err := getAuthTokens(ui.AuthToken, ui.BearerToken, ui.Username, ui.Password)
+		ats, err := ui.getAuthTokens()
 		if err != nil {
 			return nil, err
 		}
@@ -1075,6 +1181,7 @@ func parseAuthConfigUsers(ac *AuthConfig) (map[string]*UserInfo, error) {
 		mcr := ui.getMaxConcurrentRequests()
 		ui.concurrencyLimitCh = make(chan struct{}, mcr)
 		ui.concurrencyLimitReached = ac.ms.GetOrCreateCounter(`vmauth_user_concurrent_requests_limit_reached_total` + metricLabels)
+		ui.rateLimitReached = ac.ms.GetOrCreateCounter(`vmauth_user_rate_limit_reached_total` + metricLabels)
 		_ = ac.ms.GetOrCreateGauge(`vmauth_user_concurrent_requests_capacity`+metricLabels, func() float64 {
 			return float64(cap(ui.concurrencyLimitCh))
 		})
@@ -1153,11 +1260,32 @@ func (ui *UserInfo) initURLs() error {
 		}
 		up.mergeQueryArgs = mergeQueryArgs
 	}
+	sc, err := newShadowConfig(ui.ShadowURL, ui.ShadowPercent)
+	if err != nil {
+		return err
+	}
+	le, err := newLabelEnforcer(ui.EnforceLabels, ui.JWT != nil)
+	if err != nil {
+		return fmt.Errorf("invalid enforce_labels: %w", err)
+	}
+	if up != nil {
+		up.setHedgeDelay(ui.HedgeDelay)
+		up.shadow = sc
+		up.labelEnforcer = le
+	}
 	if ui.DefaultURL != nil {
 		if err := ui.DefaultURL.sanitizeAndInitialize(); err != nil {
 			return err
 		}
+		ui.DefaultURL.labelEnforcer = le
+	}
+
+	rls, err := newRateLimits(ui.MaxRequestsPerSecond, ui.MaxRequestBytesPerSecond)
+	if err != nil {
+		return err
 	}
+	ui.rateLimits = rls
+	ui.hasRequestBytesLimits = rls.getBytesLimiter() != nil
 
 	for _, e := range ui.URLMaps {
 		if len(e.SrcPaths) == 0 && len(e.SrcHosts) == 0 && len(e.SrcQueryArgs) == 0 && len(e.SrcHeaders) == 0 {
@@ -1196,6 +1324,46 @@ func (ui *UserInfo) initURLs() error {
 		e.URLPrefix.mergeQueryArgs = mqa
 		e.URLPrefix.dropSrcPathPrefixParts = dsp
 		e.URLPrefix.discoverBackendIPs = dbd
+
+		rls, err := newRateLimits(e.MaxRequestsPerSecond, e.MaxRequestBytesPerSecond)
+		if err != nil {
+			return fmt.Errorf("invalid rate limits in `url_map`: %w", err)
+		}
+		e.URLPrefix.rateLimits = rls
+		if rls.getBytesLimiter() != nil {
+			ui.hasRequestBytesLimits = true
+		}
+
+		if e.ResponseCacheTTL != nil {
+			ttl := e.ResponseCacheTTL.Duration()
+			if ttl < 0 {
+				return fmt.Errorf("response_cache_ttl in `url_map` cannot be negative; got %s", ttl)
+			}
+			e.URLPrefix.responseCacheTTL = ttl
+		}
+
+		hd := ui.HedgeDelay
+		if e.HedgeDelay != nil {
+			hd = e.HedgeDelay
+		}
+		e.URLPrefix.setHedgeDelay(hd)
+		esc := sc
+		if e.ShadowURL != "" || e.ShadowPercent != nil {
+			esc, err = newShadowConfig(e.ShadowURL, e.ShadowPercent)
+			if err != nil {
+				return fmt.Errorf("invalid shadow config in `url_map`: %w", err)
+			}
+		}
+		e.URLPrefix.shadow = esc
+
+		ele := le
+		if len(e.EnforceLabels) > 0 {
+			ele, err = newLabelEnforcer(e.EnforceLabels, ui.JWT != nil)
+			if err != nil {
+				return fmt.Errorf("invalid enforce_labels in `url_map`: %w", err)
+			}
+		}
+		e.URLPrefix.labelEnforcer = ele
 	}
 	if len(ui.URLMaps) == 0 && ui.URLPrefix == nil {
 		return fmt.Errorf("missing `url_prefix` or `url_map`")
@@ -1221,9 +1389,30 @@ func (ui *UserInfo) name() string {
 	if ui.JWT != nil {
 		return `jwt`
 	}
+	if ui.MTLS != nil {
+		at, err := ui.MTLS.getAuthToken()
+		if err == nil {
+			return at
+		}
+	}
 	return ""
 }
 
+// getAuthTokens returns auth tokens for ui.
+func (ui *UserInfo) getAuthTokens() ([]string, error) {
+	if ui.MTLS == nil {
+		return getAuthTokens(ui.AuthToken, ui.BearerToken, ui.Username, ui.Password)
+	}
+	if ui.AuthToken != "" || ui.BearerToken != "" || ui.Username != "" || ui.Password != "" {
+		return nil, fmt.Errorf("auth_token, bearer_token, username and password cannot be specified if mtls is set")
+	}
+	at, err := ui.MTLS.getAuthToken()
+	if err != nil {
+		return nil, err
+	}
+	return []string{at}, nil
+}
+
 func getAuthTokens(authToken, bearerToken, username, password string) ([]string, error) {
 	if authToken != "" {
 		if bearerToken != "" {
@@ -1295,6 +1484,10 @@ func getAuthTokensFromRequest(r *http.Request) []string {
 		ats = append(ats, at)
 	}
 
+	// Authorization via verified client TLS certificate
+	// See https://docs.victoriametrics.com/victoriametrics/vmauth/#mtls-based-request-routing
+	ats = append(ats, getClientCertAuthTokens(r)...)
+
 	return ats
 }
 
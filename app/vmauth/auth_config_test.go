@@ -324,6 +324,160 @@ users:
     - src_paths: ["/select/.*"]
       url_prefix: 'http://ahost/{{a_placeholder}}/foobar'
 `)
+
+	// negative rate limits
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  max_requests_per_second: -1
+`)
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  max_request_bytes_per_second: -1
+`)
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/write"]
+    url_prefix: http://foo.bar
+    max_requests_per_second: -10
+`)
+
+	// invalid rate limit value
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  max_request_bytes_per_second: 10MB
+`)
+
+	// invalid response_cache_ttl
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/labels"]
+    url_prefix: http://foo.bar
+    response_cache_ttl: -1s
+`)
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/labels"]
+    url_prefix: http://foo.bar
+    response_cache_ttl: foo
+`)
+
+	// invalid mtls
+	f(`
+users:
+- mtls:
+    common_name: foo
+    organization: bar
+  url_prefix: http://foo.bar
+`)
+	f(`
+users:
+- mtls:
+    spiffe_id: http://example.org/foo
+  url_prefix: http://foo.bar
+`)
+	f(`
+users:
+- mtls:
+    common_name: foo
+  username: foo
+  url_prefix: http://foo.bar
+`)
+	f(`
+unauthorized_user:
+  mtls:
+    common_name: foo
+  url_prefix: http://foo.bar
+`)
+
+	// duplicate mtls identities
+	f(`
+users:
+- mtls:
+    uri_san: spiffe://example.org/foo
+  url_prefix: http://foo.bar
+- mtls:
+    spiffe_id: spiffe://example.org/foo
+  url_prefix: http://foo.baz
+`)
+
+	// invalid enforce_labels
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  enforce_labels: ["team"]
+`)
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/query"]
+    url_prefix: http://foo.bar
+    enforce_labels: ["=dev"]
+`)
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  enforce_labels: ["{{.MetricsExtraLabels}}"]
+`)
+
+	// invalid hedge_delay
+	f(`
+users:
+- username: foo
+  url_prefix: [http://foo.bar, http://baz]
+  hedge_delay: foo
+`)
+	f(`
+users:
+- username: foo
+  url_prefix: [http://foo.bar, http://baz]
+  hedge_delay: p100
+`)
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/query"]
+    url_prefix: [http://foo.bar, http://baz]
+    hedge_delay: -1s
+`)
+
+	// invalid shadow_url and shadow_percent
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  shadow_url: ":bad-url"
+`)
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  shadow_percent: 10
+`)
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/query"]
+    url_prefix: http://foo.bar
+    shadow_url: http://shadow
+    shadow_percent: 101
+`)
 }
 
 func TestParseAuthConfigSuccess(t *testing.T) {
@@ -1012,7 +1166,7 @@ func TestLogRequest(t *testing.T) {
 		t.Helper()
 
 		testOutput.Reset()
-		ui.logRequest(req, user, status, duration)
+		ui.logRequest(req, user, status, duration, nil)
 
 		got := testOutput.String()
 		if expectedLog == "" && got != "" {
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/snappy"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/jwt"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+var maxEnforceLabelsWriteRequestSize = flagutil.NewBytes("enforceLabels.maxWriteRequestSize", 32*1024*1024, "The maximum size of write request body, "+
+	"which can be validated according to enforce_labels option. See https://docs.victoriametrics.com/victoriametrics/vmauth/#label-enforcement")
+
+var enforceLabelsRejectedRequests = metrics.NewCounter(`vmauth_enforce_labels_rejected_requests_total`)
+
+// labelEnforcer enforces label filters for requests according to `enforce_labels` option.
+//
+// See https://docs.victoriametrics.com/victoriametrics/vmauth/#label-enforcement
+type labelEnforcer struct {
+	// lfs contains label filters from the config.
+	lfs []metricsql.LabelFilter
+
+	// useJWTClaim is set to true if label filters must be obtained from metrics_extra_labels at JWT vm_access claim.
+	useJWTClaim bool
+}
+
+// newLabelEnforcer returns labelEnforcer for the given enforceLabels.
+//
+// nil is returned if enforceLabels is empty.
+func newLabelEnforcer(enforceLabels []string, isJWTAllowed bool) (*labelEnforcer, error) {
+	if len(enforceLabels) == 0 {
+		return nil, nil
+	}
+	var le labelEnforcer
+	for _, s := range enforceLabels {
+		if s == metricsExtraLabelsPlaceholder {
+			if !isJWTAllowed {
+				return nil, fmt.Errorf("%s placeholder at enforce_labels is allowed only for users with jwt", s)
+			}
+			le.useJWTClaim = true
+			continue
+		}
+		lf, err := parseEnforcedLabel(s)
+		if err != nil {
+			return nil, err
+		}
+		le.lfs = append(le.lfs, lf)
+	}
+	return &le, nil
+}
+
+func parseEnforcedLabel(s string) (metricsql.LabelFilter, error) {
+	n := strings.IndexByte(s, '=')
+	if n <= 0 {
+		return metricsql.LabelFilter{}, fmt.Errorf("unexpected enforced label %q; it must have `name=value` format", s)
+	}
+	lf := metricsql.LabelFilter{
+		Label: s[:n],
+		Value: s[n+1:],
+	}
+	return lf, nil
+}
+
+// getLabelFilters returns label filters to enforce for the request with the given vmac.
+func (le *labelEnforcer) getLabelFilters(vmac *jwt.VMAccessClaim) ([]metricsql.LabelFilter, error) {
+	if !le.useJWTClaim {
+		return le.lfs, nil
+	}
+	var extraLabels []string
+	if vmac != nil {
+		extraLabels = vmac.MetricsExtraLabels
+	}
+	if len(extraLabels) == 0 {
+		return nil, fmt.Errorf("missing metrics_extra_labels at vm_access claim of jwt token")
+	}
+	lfs := append([]metricsql.LabelFilter{}, le.lfs...)
+	for _, s := range extraLabels {
+		lf, err := parseEnforcedLabel(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics_extra_labels at vm_access claim of jwt token: %w", err)
+		}
+		lfs = append(lfs, lf)
+	}
+	return lfs, nil
+}
+
+// enforce enforces label filters for the request r with the normalized url u and the given vmac.
+//
+// Queries and series selectors at u query args and at r body are updated with the enforced label filters,
+// while write requests are validated for containing only series with the enforced labels.
+func (le *labelEnforcer) enforce(r *http.Request, u *url.URL, vmac *jwt.VMAccessClaim) error {
+	lfs, err := le.getLabelFilters(vmac)
+	if err != nil {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        err,
+			StatusCode: http.StatusForbidden,
+		}
+	}
+
+	if isRemoteWritePath(u.Path) {
+		return validateRemoteWriteRequest(r, lfs)
+	}
+	if !isEnforceLabelsAllowedPath(u.Path) {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot enforce labels for %q; see the list of supported paths at https://docs.victoriametrics.com/victoriametrics/vmauth/#label-enforcement", u.Path),
+			StatusCode: http.StatusForbidden,
+		}
+	}
+
+	// Update query args.
+	args := u.Query()
+	hasMatch := hasMatchArg(args)
+	ok, err := enforceLabelsInArgs(args, lfs)
+	if err != nil {
+		return err
+	}
+	if ok {
+		u.RawQuery = args.Encode()
+	}
+
+	// Update query args at the request body.
+	bodyArgs, err := getRequestBodyArgs(r)
+	if err != nil {
+		return err
+	}
+	if bodyArgs != nil {
+		hasMatch = hasMatch || hasMatchArg(bodyArgs)
+		if _, err := enforceLabelsInArgs(bodyArgs, lfs); err != nil {
+			return err
+		}
+		// Always re-encode the body, so multipart requests are proxied as url-encoded forms with the enforced labels.
+		body := []byte(bodyArgs.Encode())
+		r.Body = newBufferedBody(nil, body, len(body)+1)
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	// Add series selector with the enforced label filters to the requests,
+	// which return data for all the series without match[] query arg.
+	if !hasMatch && isMatchRequiredPath(u.Path) {
+		me := &metricsql.MetricExpr{
+			LabelFilterss: [][]metricsql.LabelFilter{lfs},
+		}
+		args := u.Query()
+		args.Set("match[]", string(me.AppendString(nil)))
+		u.RawQuery = args.Encode()
+	}
+	return nil
+}
+
+// getRequestBodyArgs returns query args from the body of r.
+//
+// nil is returned if r has no body. An error is returned if the body cannot be parsed,
+// since the backend may obtain queries from it, which cannot be updated with the enforced labels.
+func getRequestBodyArgs(r *http.Request) (url.Values, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	bb, ok := r.Body.(*bufferedBody)
+	if !ok || bb.r != nil {
+		return nil, &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot enforce labels for too big request body; the request body size mustn't exceed -requestBufferSize=%d", requestBufferSize.N),
+			StatusCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	if len(bb.buf) == 0 {
+		return nil, nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data") {
+		return nil, &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot enforce labels for request body with Content-Type=%q; supported content types: application/x-www-form-urlencoded, multipart/form-data", contentType),
+			StatusCode: http.StatusUnsupportedMediaType,
+		}
+	}
+
+	// Parse the body in the same way as backends do.
+	req := &http.Request{
+		Method: http.MethodPost,
+		Header: http.Header{
+			"Content-Type": []string{contentType},
+		},
+		Body: io.NopCloser(bytes.NewReader(bb.buf)),
+	}
+	if err := req.ParseMultipartForm(int64(len(bb.buf))); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot parse request body: %w", err),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if req.MultipartForm != nil {
+		_ = req.MultipartForm.RemoveAll()
+	}
+	return req.PostForm, nil
+}
+
+func hasMatchArg(args url.Values) bool {
+	return len(args["match[]"]) > 0 || len(args["match"]) > 0
+}
+
+// enforceLabelsInArgs adds lfs to queries and series selectors at args.
+//
+// true is returned if args are updated.
+func enforceLabelsInArgs(args url.Values, lfs []metricsql.LabelFilter) (bool, error) {
+	updated := false
+	for _, argName := range []string{"query", "match[]", "match"} {
+		for i, s := range args[argName] {
+			sNew, err := enforceLabelsInQuery(s, lfs, argName != "query")
+			if err != nil {
+				return false, &httpserver.ErrorWithStatusCode{
+					Err:        fmt.Errorf("cannot enforce labels at %s=%q: %w", argName, s, err),
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			args[argName][i] = sNew
+			updated = true
+		}
+	}
+	return updated, nil
+}
+
+// enforceLabelsInQuery adds lfs to every series selector at the given MetricsQL query q.
+//
+// If isSeriesSelector is set, then q must be a series selector.
+func enforceLabelsInQuery(q string, lfs []metricsql.LabelFilter, isSeriesSelector bool) (string, error) {
+	e, err := metricsql.Parse(q)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := e.(*metricsql.MetricExpr); !ok && isSeriesSelector {
+		return "", fmt.Errorf("expecting series selector")
+	}
+
+	// The same MetricExpr may be visited multiple times if it is shared between multiple WITH template expansions.
+	seen := make(map[*metricsql.MetricExpr]struct{})
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		me, ok := expr.(*metricsql.MetricExpr)
+		if !ok {
+			return
+		}
+		if _, ok := seen[me]; ok {
+			return
+		}
+		seen[me] = struct{}{}
+		if len(me.LabelFilterss) == 0 {
+			me.LabelFilterss = [][]metricsql.LabelFilter{nil}
+		}
+		for i, lfsOrig := range me.LabelFilterss {
+			me.LabelFilterss[i] = append(lfsOrig[:len(lfsOrig):len(lfsOrig)], lfs...)
+		}
+	})
+	return string(e.AppendString(nil)), nil
+}
+
+// validateRemoteWriteRequest verifies whether all the series at Prometheus remote write request r contain the given lfs.
+func validateRemoteWriteRequest(r *http.Request, lfs []metricsql.LabelFilter) error {
+	if r.Body == nil {
+		return nil
+	}
+	maxSize := maxEnforceLabelsWriteRequestSize.IntN()
+	data, err := io.ReadAll(io.LimitReader(r.Body, int64(maxSize)+1))
+	if err != nil {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot read request body: %w", err),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if len(data) > maxSize {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("too big request body for validating enforced labels; it mustn't exceed -enforceLabels.maxWriteRequestSize=%d bytes", maxSize),
+			StatusCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	// The request body has been read, so replace it with the read data for proxying to backends.
+	r.Body = newBufferedBody(nil, data, len(data)+1)
+
+	var buf []byte
+	if r.Header.Get("Content-Encoding") == "zstd" {
+		buf, err = encoding.DecompressZSTDLimited(nil, data, maxSize)
+	} else {
+		buf, err = snappy.Decode(nil, data, maxSize)
+	}
+	if err != nil {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot decompress Prometheus remote write request: %w", err),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	wru := prompb.GetWriteRequestUnmarshaler()
+	defer prompb.PutWriteRequestUnmarshaler(wru)
+	wr, err := wru.UnmarshalProtobuf(buf)
+	if err != nil {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot unmarshal Prometheus remote write request: %w", err),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	seen := make(map[string]struct{})
+	for _, ts := range wr.Timeseries {
+		// Series with duplicate label names are rejected, since backends may use any of the duplicate labels.
+		if name, ok := getDuplicateLabelName(ts.Labels, seen); ok {
+			return &httpserver.ErrorWithStatusCode{
+				Err:        fmt.Errorf("series %s contains duplicate %q label", labelsString(ts.Labels), name),
+				StatusCode: http.StatusForbidden,
+			}
+		}
+		for _, lf := range lfs {
+			if !hasLabel(ts.Labels, lf.Label, lf.Value) {
+				return &httpserver.ErrorWithStatusCode{
+					Err:        fmt.Errorf("series %s must contain %s label", labelsString(ts.Labels), lf.AppendString(nil)),
+					StatusCode: http.StatusForbidden,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getDuplicateLabelName returns the first duplicate label name from labels.
+//
+// seen is used as a temporary storage for label names.
+func getDuplicateLabelName(labels []prompb.Label, seen map[string]struct{}) (string, bool) {
+	clear(seen)
+	for _, label := range labels {
+		if _, ok := seen[label.Name]; ok {
+			return label.Name, true
+		}
+		seen[label.Name] = struct{}{}
+	}
+	return "", false
+}
+
+func hasLabel(labels []prompb.Label, name, value string) bool {
+	for _, label := range labels {
+		if label.Name == name {
+			return label.Value == value
+		}
+	}
+	return false
+}
+
+func labelsString(labels []prompb.Label) string {
+	a := make([]string, len(labels))
+	for i, label := range labels {
+		a[i] = fmt.Sprintf("%s=%q", label.Name, label.Value)
+	}
+	return "{" + strings.Join(a, ",") + "}"
+}
+
+func isRemoteWritePath(path string) bool {
+	return strings.HasSuffix(path, "/api/v1/write")
+}
+
+// isEnforceLabelsAllowedPath returns true if path belongs to API, which can be safely proxied with the enforced labels.
+//
+// Requests to other paths are rejected, since they may return data outside the enforced labels.
+func isEnforceLabelsAllowedPath(path string) bool {
+	if isMatchRequiredPath(path) {
+		return true
+	}
+	for _, s := range []string{"/api/v1/query", "/api/v1/query_range", "/api/v1/query_exemplars", "/api/v1/status/buildinfo"} {
+		if strings.HasSuffix(path, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMatchRequiredPath returns true if path belongs to querying API, which returns data for all the series if match[] query arg is missing.
+func isMatchRequiredPath(path string) bool {
+	if strings.Contains(path, "/api/v1/label/") && strings.HasSuffix(path, "/values") {
+		return true
+	}
+	for _, s := range []string{"/api/v1/labels", "/api/v1/series", "/api/v1/export", "/api/v1/export/csv", "/api/v1/export/native", "/federate", "/api/v1/status/tsdb"} {
+		if strings.HasSuffix(path, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/metricsql"
+	"github.com/golang/snappy"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/jwt"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestEnforceLabelsInQuerySuccess(t *testing.T) {
+	lfs := []metricsql.LabelFilter{
+		{Label: "team", Value: "dev"},
+	}
+	f := func(q string, isSeriesSelector bool, resultExpected string) {
+		t.Helper()
+
+		result, err := enforceLabelsInQuery(q, lfs, isSeriesSelector)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q\ngot\n%s\nwant\n%s", q, result, resultExpected)
+		}
+	}
+
+	f(`up`, false, `up{team="dev"}`)
+	f(`up`, true, `up{team="dev"}`)
+	f(`{job="foo"}`, true, `{job="foo",team="dev"}`)
+	f(`rate(http_requests_total{job="foo"}[5m])`, false, `rate(http_requests_total{job="foo",team="dev"}[5m])`)
+	f(`sum(up) / count(foo{team="prod"})`, false, `sum(up{team="dev"}) / count(foo{team="prod",team="dev"})`)
+	f(`{a="b" or c="d"}`, false, `{a="b",team="dev" or c="d",team="dev"}`)
+	f(`max_over_time(up[1h:5m])`, false, `max_over_time(up{team="dev"}[1h:5m])`)
+	f(`WITH (x = up) x + x`, false, `up{team="dev"} + up{team="dev"}`)
+	f(`1 + 2`, false, `3`)
+}
+
+func TestEnforceLabelsInQueryFailure(t *testing.T) {
+	lfs := []metricsql.LabelFilter{
+		{Label: "team", Value: "dev"},
+	}
+	f := func(q string, isSeriesSelector bool) {
+		t.Helper()
+
+		if _, err := enforceLabelsInQuery(q, lfs, isSeriesSelector); err == nil {
+			t.Fatalf("expecting non-nil error for %q", q)
+		}
+	}
+
+	// invalid query
+	f(`sum(`, false)
+
+	// non-series selector
+	f(`rate(up[5m])`, true)
+}
+
+func TestLabelEnforcerGetLabelFilters(t *testing.T) {
+	f := func(enforceLabels []string, vmac *jwt.VMAccessClaim, resultExpected string) {
+		t.Helper()
+
+		le, err := newLabelEnforcer(enforceLabels, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		lfs, err := le.getLabelFilters(vmac)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		me := &metricsql.MetricExpr{
+			LabelFilterss: [][]metricsql.LabelFilter{lfs},
+		}
+		if result := string(me.AppendString(nil)); result != resultExpected {
+			t.Fatalf("unexpected label filters; got %s; want %s", result, resultExpected)
+		}
+	}
+
+	f([]string{"team=dev"}, nil, `{team="dev"}`)
+	f([]string{"team=dev", "{{.MetricsExtraLabels}}"}, &jwt.VMAccessClaim{
+		MetricsExtraLabels: []string{"env=prod"},
+	}, `{team="dev",env="prod"}`)
+
+	// missing metrics_extra_labels at vm_access claim
+	le, err := newLabelEnforcer([]string{"{{.MetricsExtraLabels}}"}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := le.getLabelFilters(&jwt.VMAccessClaim{}); err == nil {
+		t.Fatalf("expecting non-nil error for missing metrics_extra_labels")
+	}
+
+	// the placeholder isn't allowed for users without jwt
+	if _, err := newLabelEnforcer([]string{"{{.MetricsExtraLabels}}"}, false); err == nil {
+		t.Fatalf("expecting non-nil error for the placeholder without jwt")
+	}
+}
+
+func TestLabelEnforcerEnforceSuccess(t *testing.T) {
+	le, err := newLabelEnforcer([]string{"team=dev"}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(method, requestURL, contentType, body, urlExpected, bodyExpected string) {
+		t.Helper()
+
+		r, err := http.NewRequest(method, requestURL, nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		if body != "" {
+			r.Header.Set("Content-Type", contentType)
+			r.Body = newBufferedBody(nil, []byte(body), 1024)
+		}
+		u := normalizeURL(r.URL)
+		if err := le.enforce(r, u, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if s := u.String(); s != urlExpected {
+			t.Fatalf("unexpected url\ngot\n%s\nwant\n%s", s, urlExpected)
+		}
+		if body != "" {
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("cannot read request body: %s", err)
+			}
+			if string(data) != bodyExpected {
+				t.Fatalf("unexpected request body\ngot\n%s\nwant\n%s", data, bodyExpected)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+				t.Fatalf("unexpected Content-Type; got %q; want %q", ct, "application/x-www-form-urlencoded")
+			}
+		}
+	}
+
+	f("GET", "http://vmauth/api/v1/query?query=up&time=123", "", "",
+		"http://vmauth/api/v1/query?query=up%7Bteam%3D%22dev%22%7D&time=123", "")
+	f("GET", "http://vmauth/api/v1/series?match[]=up", "", "",
+		"http://vmauth/api/v1/series?match%5B%5D=up%7Bteam%3D%22dev%22%7D", "")
+	f("GET", "http://vmauth/api/v1/series?match=up", "", "",
+		"http://vmauth/api/v1/series?match=up%7Bteam%3D%22dev%22%7D", "")
+	f("POST", "http://vmauth/api/v1/query_range", "application/x-www-form-urlencoded", "query=sum(up)&step=60", "http://vmauth/api/v1/query_range",
+		"query=sum%28up%7Bteam%3D%22dev%22%7D%29&step=60")
+
+	// Content-Type is case-insensitive
+	f("POST", "http://vmauth/api/v1/query", "Application/X-WWW-Form-Urlencoded; charset=UTF-8", "query=up", "http://vmauth/api/v1/query",
+		"query=up%7Bteam%3D%22dev%22%7D")
+
+	// multipart body is converted to url-encoded body
+	f("POST", "http://vmauth/api/v1/query", "multipart/form-data; boundary=foo", "--foo\r\nContent-Disposition: form-data; name=\"query\"\r\n\r\nup\r\n--foo--\r\n",
+		"http://vmauth/api/v1/query", "query=up%7Bteam%3D%22dev%22%7D")
+
+	// match[] is added to the requests without series selectors
+	f("GET", "http://vmauth/api/v1/labels", "", "",
+		"http://vmauth/api/v1/labels?match%5B%5D=%7Bteam%3D%22dev%22%7D", "")
+	f("GET", "http://vmauth/api/v1/label/job/values?start=1", "", "",
+		"http://vmauth/api/v1/label/job/values?match%5B%5D=%7Bteam%3D%22dev%22%7D&start=1", "")
+	f("GET", "http://vmauth/api/v1/status/tsdb?topN=5", "", "",
+		"http://vmauth/api/v1/status/tsdb?match%5B%5D=%7Bteam%3D%22dev%22%7D&topN=5", "")
+	f("POST", "http://vmauth/api/v1/labels", "application/x-www-form-urlencoded", "match[]=up", "http://vmauth/api/v1/labels",
+		"match%5B%5D=up%7Bteam%3D%22dev%22%7D")
+
+	// requests without queries are left as is
+	f("GET", "http://vmauth/api/v1/status/buildinfo", "", "", "http://vmauth/api/v1/status/buildinfo", "")
+}
+
+func TestLabelEnforcerEnforceFailure(t *testing.T) {
+	le, err := newLabelEnforcer([]string{"team=dev"}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(method, requestURL, contentType, body string, statusCodeExpected int) {
+		t.Helper()
+
+		r, err := http.NewRequest(method, requestURL, nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		if body != "" {
+			r.Header.Set("Content-Type", contentType)
+			r.Body = newBufferedBody(nil, []byte(body), 1024)
+		}
+		u := normalizeURL(r.URL)
+		err = le.enforce(r, u, nil)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		var esc *httpserver.ErrorWithStatusCode
+		if !errors.As(err, &esc) {
+			t.Fatalf("unexpected error type %T: %s", err, err)
+		}
+		if esc.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", esc.StatusCode, statusCodeExpected)
+		}
+	}
+
+	// paths, which cannot be rewritten with the enforced labels
+	f("GET", "http://vmauth/render?target=foo", "", "", http.StatusForbidden)
+	f("GET", "http://vmauth/query?q=select+*+from+foo", "", "", http.StatusForbidden)
+	f("GET", "http://vmauth/api/v1/status/top_queries", "", "", http.StatusForbidden)
+	f("GET", "http://vmauth/api/v1/series/count", "", "", http.StatusForbidden)
+	f("GET", "http://vmauth/tags/autoComplete/tags", "", "", http.StatusForbidden)
+	f("POST", "http://vmauth/api/v1/import", "", "foo", http.StatusForbidden)
+
+	// unsupported request body
+	f("POST", "http://vmauth/api/v1/query", "application/json", `{"query":"up"}`, http.StatusUnsupportedMediaType)
+	f("POST", "http://vmauth/api/v1/query", "", "query=up", http.StatusUnsupportedMediaType)
+	f("PUT", "http://vmauth/api/v1/query", "text/plain", "query=up", http.StatusUnsupportedMediaType)
+
+	// invalid query
+	f("POST", "http://vmauth/api/v1/query", "application/x-www-form-urlencoded", "query=sum(", http.StatusBadRequest)
+	f("GET", "http://vmauth/api/v1/series?match=rate(up[5m])", "", "", http.StatusBadRequest)
+}
+
+func TestValidateRemoteWriteRequest(t *testing.T) {
+	lfs := []metricsql.LabelFilter{
+		{Label: "team", Value: "dev"},
+	}
+	f := func(labels []prompb.Label, isValid bool) {
+		t.Helper()
+
+		wr := &prompb.WriteRequest{
+			Timeseries: []prompb.TimeSeries{{
+				Labels: labels,
+				Samples: []prompb.Sample{{
+					Value:     1,
+					Timestamp: 123,
+				}},
+			}},
+		}
+		data := snappy.Encode(nil, wr.MarshalProtobuf(nil))
+		r, err := http.NewRequest(http.MethodPost, "http://vmauth/api/v1/write", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		err = validateRemoteWriteRequest(r, lfs)
+		if isValid && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !isValid && err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+
+		// The request body must be preserved for proxying to backends.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("cannot read request body: %s", err)
+		}
+		if !bytes.Equal(body, data) {
+			t.Fatalf("unexpected request body after validation")
+		}
+	}
+
+	f([]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "team", Value: "dev"}}, true)
+	f([]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "team", Value: "prod"}}, false)
+	f([]prompb.Label{{Name: "__name__", Value: "up"}}, false)
+
+	// duplicate label names
+	f([]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "team", Value: "dev"}, {Name: "team", Value: "prod"}}, false)
+	f([]prompb.Label{{Name: "__name__", Value: "up"}, {Name: "team", Value: "prod"}, {Name: "team", Value: "dev"}}, false)
+}
+
+func TestRequestHandlerEnforceLabels(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.RequestURI())
+	}))
+	defer ts.Close()
+
+	cfgOrigP := authConfigData.Load()
+	cfgStr := strings.ReplaceAll(`
+users:
+- username: foo
+  password: bar
+  url_prefix: {BACKEND}
+  enforce_labels: ["team=dev"]
+`, "{BACKEND}", ts.URL)
+	if _, err := reloadAuthConfigData([]byte(cfgStr)); err != nil {
+		t.Fatalf("cannot load config data: %s", err)
+	}
+	defer func() {
+		cfgOrig := []byte("unauthorized_user:\n  url_prefix: http://foo/bar")
+		if cfgOrigP != nil {
+			cfgOrig = *cfgOrigP
+		}
+		if _, err := reloadAuthConfigData(cfgOrig); err != nil {
+			t.Fatalf("cannot load the original config: %s", err)
+		}
+	}()
+
+	f := func(requestURL string, statusCodeExpected int, responseExpected string) {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodGet, requestURL, nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		r.RequestURI = r.URL.RequestURI()
+		r.RemoteAddr = "42.2.3.84:6789"
+		r.SetBasicAuth("foo", "bar")
+
+		w := &fakeResponseWriter{}
+		if !requestHandler(w, r) {
+			t.Fatalf("unexpected false is returned from requestHandler")
+		}
+		if w.statusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d; response:\n%s", w.statusCode, statusCodeExpected, w.getResponse())
+		}
+		if statusCodeExpected != http.StatusOK {
+			return
+		}
+		response := w.getResponse()
+		response = response[strings.IndexByte(response, '\n')+1:]
+		responseURL, err := url.Parse(response)
+		if err != nil {
+			t.Fatalf("cannot parse response %q: %s", response, err)
+		}
+		if q := responseURL.Query().Get("query"); q != responseExpected {
+			t.Fatalf("unexpected query at backend; got %q; want %q", q, responseExpected)
+		}
+	}
+
+	f("http://some-host.com/api/v1/query?query=sum(rate(foo[5m]))", http.StatusOK, `sum(rate(foo{team="dev"}[5m]))`)
+	f("http://some-host.com/api/v1/query?query=sum(", http.StatusBadRequest, "")
+	f("http://some-host.com/influx/write", http.StatusForbidden, "")
+	f("http://some-host.com/render?target=foo", http.StatusForbidden, "")
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/histogram"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+)
+
+var (
+	hedgedRequests    = metrics.NewCounter(`vmauth_hedged_requests_total`)
+	hedgedRequestsWon = metrics.NewCounter(`vmauth_hedged_requests_won_total`)
+)
+
+// HedgeDelay is the delay before sending a hedged request to another backend if the response from the first backend isn't received yet.
+//
+// It can be either a duration such as `200ms` or a percentile of backend response latencies such as `p95`.
+type HedgeDelay struct {
+	// d is the fixed delay.
+	d time.Duration
+
+	// phi is the percentile of backend response latencies in the range (0..1) to use as the delay.
+	phi float64
+
+	sOriginal string
+}
+
+// UnmarshalYAML unmarshals hd from yaml.
+func (hd *HedgeDelay) UnmarshalYAML(f func(any) error) error {
+	var s string
+	if err := f(&s); err != nil {
+		return err
+	}
+	hd.sOriginal = s
+
+	if n, ok := strings.CutPrefix(s, "p"); ok {
+		p, err := strconv.ParseFloat(n, 64)
+		if err != nil || p <= 0 || p >= 100 {
+			return fmt.Errorf("unexpected percentile in hedge_delay=%q; it must be in the range (p0..p100), for example, p95", s)
+		}
+		hd.phi = p / 100
+		return nil
+	}
+
+	var d promutil.Duration
+	if err := f(&d); err != nil {
+		return fmt.Errorf("cannot parse hedge_delay=%q; it must be either a duration such as 200ms or a percentile such as p95: %w", s, err)
+	}
+	if d.D <= 0 {
+		return fmt.Errorf("hedge_delay=%q must be positive", s)
+	}
+	hd.d = d.D
+	return nil
+}
+
+// MarshalYAML marshals hd to yaml.
+func (hd *HedgeDelay) MarshalYAML() (any, error) {
+	return hd.sOriginal, nil
+}
+
+// setHedgeDelay enables request hedging for up with the given delay.
+func (up *URLPrefix) setHedgeDelay(hd *HedgeDelay) {
+	up.hedgeDelay = hd
+	if hd != nil && hd.phi > 0 {
+		up.latencyTracker = newLatencyTracker(hd.phi)
+	}
+}
+
+// getHedgeDelay returns the delay before sending a hedged request.
+//
+// Zero is returned if hedging is disabled or if there are not enough samples for calculating the percentile of response latencies.
+func (up *URLPrefix) getHedgeDelay() time.Duration {
+	hd := up.hedgeDelay
+	if hd == nil || up.getBackendsCount() < 2 {
+		return 0
+	}
+	if hd.phi > 0 {
+		return up.latencyTracker.get()
+	}
+	return hd.d
+}
+
+// getHedgeBackendURL returns the least loaded non-broken backendURL, which differs from bu.
+//
+// nil is returned if there are no such backends.
+//
+// backendURL.put() must be called on the returned backendURL after the request is complete.
+func (up *URLPrefix) getHedgeBackendURL(bu *backendURL) *backendURL {
+	bus := up.bus.Load()
+	var buMin *backendURL
+	for _, b := range bus.bus {
+		if b == bu || b.isBroken() {
+			continue
+		}
+		if buMin == nil || b.concurrentRequests.Load() < buMin.concurrentRequests.Load() {
+			buMin = b
+		}
+	}
+	if buMin != nil {
+		buMin.get()
+	}
+	return buMin
+}
+
+// latencyTracker tracks the given percentile of backend response latencies.
+type latencyTracker struct {
+	phi float64
+
+	// value is the last calculated percentile in nanoseconds.
+	value atomic.Int64
+
+	// mu protects fields below
+	mu        sync.Mutex
+	h         *histogram.Fast
+	samples   int
+	lastReset time.Time
+}
+
+// latencyTrackerMinSamples is the minimum number of samples needed for calculating the percentile.
+const latencyTrackerMinSamples = 100
+
+// latencyTrackerResetInterval is the interval for resetting the collected samples,
+// so the percentile follows the changes in backend latencies.
+const latencyTrackerResetInterval = time.Minute
+
+func newLatencyTracker(phi float64) *latencyTracker {
+	return &latencyTracker{
+		phi:       phi,
+		h:         histogram.NewFast(),
+		lastReset: time.Now(),
+	}
+}
+
+func (lt *latencyTracker) update(d time.Duration) {
+	if lt == nil {
+		return
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	lt.h.Update(float64(d))
+	lt.samples++
+	if lt.samples%latencyTrackerMinSamples == 0 {
+		lt.value.Store(int64(lt.h.Quantile(lt.phi)))
+	}
+	if lt.samples >= latencyTrackerMinSamples && time.Since(lt.lastReset) > latencyTrackerResetInterval {
+		lt.h.Reset()
+		lt.samples = 0
+		lt.lastReset = time.Now()
+	}
+}
+
+func (lt *latencyTracker) get() time.Duration {
+	return time.Duration(lt.value.Load())
+}
+
+// canHedgeRequest returns true if req can be sent to multiple backends concurrently.
+//
+// This is possible only for read-only requests with the body fully buffered in memory.
+func canHedgeRequest(req *http.Request) bool {
+	if !isReadOnlyRequest(req) {
+		return false
+	}
+	switch t := req.Body.(type) {
+	case nil:
+		return true
+	case *bufferedBody:
+		return t.r == nil && t.canRetry()
+	default:
+		return req.Body == http.NoBody
+	}
+}
+
+// isReadOnlyRequest returns true if req doesn't modify the state of the backend, so it can be safely sent to multiple backends.
+//
+// POST requests are considered read-only only for querying APIs, since they are frequently sent via POST by clients such as Grafana.
+func isReadOnlyRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		path := req.URL.Path
+		for _, suffix := range readOnlyPostPathSuffixes {
+			if strings.HasSuffix(path, suffix) {
+				return true
+			}
+		}
+		return strings.Contains(path, "/api/v1/label/") && strings.HasSuffix(path, "/values")
+	default:
+		return false
+	}
+}
+
+// readOnlyPostPathSuffixes contains path suffixes for querying APIs, which accept POST requests.
+var readOnlyPostPathSuffixes = []string{
+	"/api/v1/query",
+	"/api/v1/query_range",
+	"/api/v1/query_exemplars",
+	"/api/v1/series",
+	"/api/v1/labels",
+	"/render",
+}
+
+// newHedgeRequestBody returns a copy of the body for req, which can be read independently of req.Body.
+//
+// canHedgeRequest(req) must return true before calling this function.
+func newHedgeRequestBody(req *http.Request) io.ReadCloser {
+	bb, ok := req.Body.(*bufferedBody)
+	if !ok {
+		return req.Body
+	}
+	return newBufferedBody(nil, bb.buf, len(bb.buf)+1)
+}
+
+type roundTripResult struct {
+	res     *http.Response
+	err     error
+	isHedge bool
+}
+
+// hedgedRoundTrip sends req via rt. If the response isn't received during the given delay, then it sends
+// the request returned by newHedgeRequest.
+//
+// The first successful response is returned, while the other request is canceled. Responses with status codes
+// from retryStatusCodes and with 502, 503 and 504 status codes are considered unsuccessful, since the other request may succeed.
+// newHedgeRequest must return nil if the hedged request cannot be sent. Otherwise, it must return
+// the request and the function, which is called after the hedged request is complete.
+//
+// true is returned additionally if the response is received for the hedged request.
+func hedgedRoundTrip(rt http.RoundTripper, req *http.Request, delay time.Duration, retryStatusCodes []int, newHedgeRequest func() (*http.Request, func())) (*http.Response, bool, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	resultCh := make(chan roundTripResult, 2)
+	go func() {
+		res, err := rt.RoundTrip(req.WithContext(ctx))
+		resultCh <- roundTripResult{
+			res: res,
+			err: err,
+		}
+	}()
+
+	t := timerpool.Get(delay)
+	select {
+	case rtr := <-resultCh:
+		timerpool.Put(t)
+		return finishRoundTrip(rtr, cancel, nil)
+	case <-t.C:
+		timerpool.Put(t)
+	}
+
+	hreq, release := newHedgeRequest()
+	if hreq == nil {
+		rtr := <-resultCh
+		return finishRoundTrip(rtr, cancel, nil)
+	}
+	hedgedRequests.Inc()
+	hctx, hcancel := context.WithCancel(req.Context())
+	go func() {
+		res, err := rt.RoundTrip(hreq.WithContext(hctx))
+		resultCh <- roundTripResult{
+			res:     res,
+			err:     err,
+			isHedge: true,
+		}
+	}()
+
+	rtr := <-resultCh
+	if rtr.isFailed(retryStatusCodes) {
+		// Wait for the other request, since it may succeed.
+		rtrOther := <-resultCh
+		otherFailed := rtrOther.isFailed(retryStatusCodes)
+		if !otherFailed || !rtrOther.isHedge {
+			// Return either the successful result or the result for the original request
+			// if both requests failed, so the caller could retry it at another backend.
+			rtr, rtrOther = rtrOther, rtr
+		}
+		rtrOther.closeResponse()
+		if rtr.isHedge {
+			cancel()
+			if !otherFailed {
+				hedgedRequestsWon.Inc()
+			}
+			return finishRoundTrip(rtr, hcancel, release)
+		}
+		hcancel()
+		release()
+		return finishRoundTrip(rtr, cancel, nil)
+	}
+
+	// Cancel the other request and close its response if it has been already received.
+	if rtr.isHedge {
+		cancel()
+		go discardRoundTripResult(resultCh, nil)
+		hedgedRequestsWon.Inc()
+		return finishRoundTrip(rtr, hcancel, release)
+	}
+	hcancel()
+	go discardRoundTripResult(resultCh, release)
+	return finishRoundTrip(rtr, cancel, nil)
+}
+
+// isFailed returns true if rtr contains an error or a response with status code, which may succeed at another backend.
+func (rtr *roundTripResult) isFailed(retryStatusCodes []int) bool {
+	if rtr.err != nil {
+		return true
+	}
+	switch rtr.res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return slices.Contains(retryStatusCodes, rtr.res.StatusCode)
+	}
+}
+
+// closeResponse closes the response body for rtr if it exists.
+func (rtr *roundTripResult) closeResponse() {
+	if rtr.res != nil {
+		_ = rtr.res.Body.Close()
+	}
+}
+
+func discardRoundTripResult(resultCh <-chan roundTripResult, release func()) {
+	rtr := <-resultCh
+	if rtr.res != nil {
+		_ = rtr.res.Body.Close()
+	}
+	if release != nil {
+		release()
+	}
+}
+
+// finishRoundTrip returns the response from rtr, which cancels its context and calls release after the response body is closed.
+func finishRoundTrip(rtr roundTripResult, cancel, release func()) (*http.Response, bool, error) {
+	if rtr.err != nil {
+		cancel()
+		if release != nil {
+			release()
+		}
+		return nil, rtr.isHedge, rtr.err
+	}
+	rtr.res.Body = &cancelOnCloseBody{
+		ReadCloser: rtr.res.Body,
+		cancel:     cancel,
+		release:    release,
+	}
+	return rtr.res, rtr.isHedge, nil
+}
+
+// cancelOnCloseBody cancels the request context after the response body is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+
+	cancel  func()
+	release func()
+	once    sync.Once
+}
+
+// Close implements io.Closer interface.
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.cancel()
+		if b.release != nil {
+			b.release()
+		}
+	})
+	return err
+}
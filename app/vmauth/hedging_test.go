@@ -0,0 +1,238 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestHedgeDelayUnmarshalYAML(t *testing.T) {
+	f := func(s string, dExpected time.Duration, phiExpected float64) {
+		t.Helper()
+
+		var hd HedgeDelay
+		if err := yaml.UnmarshalStrict([]byte(s), &hd); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if hd.d != dExpected {
+			t.Fatalf("unexpected delay; got %s; want %s", hd.d, dExpected)
+		}
+		if hd.phi != phiExpected {
+			t.Fatalf("unexpected percentile; got %v; want %v", hd.phi, phiExpected)
+		}
+		data, err := yaml.Marshal(&hd)
+		if err != nil {
+			t.Fatalf("cannot marshal hedge delay: %s", err)
+		}
+		if result := strings.TrimSpace(string(data)); result != s {
+			t.Fatalf("unexpected marshaled hedge delay; got %q; want %q", result, s)
+		}
+	}
+
+	f("200ms", 200*time.Millisecond, 0)
+	f("1s", time.Second, 0)
+	f("p95", 0, 0.95)
+	f("p50", 0, 0.5)
+}
+
+func TestLatencyTracker(t *testing.T) {
+	lt := newLatencyTracker(0.9)
+
+	// Not enough samples
+	for i := 0; i < latencyTrackerMinSamples-1; i++ {
+		lt.update(time.Millisecond)
+	}
+	if d := lt.get(); d != 0 {
+		t.Fatalf("unexpected latency for insufficient number of samples; got %s; want 0s", d)
+	}
+
+	lt.update(time.Millisecond)
+	if d := lt.get(); d != time.Millisecond {
+		t.Fatalf("unexpected latency; got %s; want 1ms", d)
+	}
+
+	// nil tracker must be ignored
+	var ltNil *latencyTracker
+	ltNil.update(time.Second)
+}
+
+func TestHedgedRoundTrip(t *testing.T) {
+	newBackend := func(delay time.Duration, statusCode int, response string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			w.WriteHeader(statusCode)
+			_, _ = io.WriteString(w, response)
+		}))
+	}
+	slow := newBackend(time.Second, http.StatusOK, "slow")
+	defer slow.Close()
+	medium := newBackend(200*time.Millisecond, http.StatusOK, "medium")
+	defer medium.Close()
+	fast := newBackend(0, http.StatusOK, "fast")
+	defer fast.Close()
+	unavailable := newBackend(100*time.Millisecond, http.StatusServiceUnavailable, "unavailable")
+	defer unavailable.Close()
+	retriable := newBackend(100*time.Millisecond, http.StatusTooManyRequests, "retriable")
+	defer retriable.Close()
+
+	f := func(firstURL, hedgeURL, responseExpected string, isHedgeExpected bool) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, firstURL, nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		released := false
+		newHedgeRequest := func() (*http.Request, func()) {
+			if hedgeURL == "" {
+				return nil, nil
+			}
+			hreq, err := http.NewRequest(http.MethodGet, hedgeURL, nil)
+			if err != nil {
+				t.Fatalf("cannot initialize hedged http request: %s", err)
+			}
+			return hreq, func() { released = true }
+		}
+
+		res, isHedge, err := hedgedRoundTrip(http.DefaultTransport, req, 50*time.Millisecond, []int{http.StatusTooManyRequests}, newHedgeRequest)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("cannot read response body: %s", err)
+		}
+		_ = res.Body.Close()
+		if string(data) != responseExpected {
+			t.Fatalf("unexpected response; got %q; want %q", data, responseExpected)
+		}
+		if isHedge != isHedgeExpected {
+			t.Fatalf("unexpected isHedge; got %v; want %v", isHedge, isHedgeExpected)
+		}
+		if isHedgeExpected && !released {
+			t.Fatalf("the hedged request must be released after closing the response body")
+		}
+	}
+
+	// The first backend responds before the hedge delay
+	f(fast.URL, slow.URL, "fast", false)
+
+	// The hedged request wins
+	f(slow.URL, fast.URL, "fast", true)
+
+	// There are no backends for the hedged request
+	f(slow.URL, "", "slow", false)
+
+	// The first backend returns retriable status code, so the response for the hedged request is used
+	f(unavailable.URL, medium.URL, "medium", true)
+	f(retriable.URL, medium.URL, "medium", true)
+
+	// The hedged request returns retriable status code, so the response for the first request is used
+	f(medium.URL, unavailable.URL, "medium", false)
+
+	// Both requests fail, so the response for the first request is returned
+	f(unavailable.URL, retriable.URL, "unavailable", false)
+	f(retriable.URL, unavailable.URL, "retriable", false)
+}
+
+func TestCanHedgeRequest(t *testing.T) {
+	f := func(method, path string, resultExpected bool) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, "http://foo"+path, nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		if result := canHedgeRequest(req); result != resultExpected {
+			t.Fatalf("unexpected result for %s %s; got %v; want %v", method, path, result, resultExpected)
+		}
+	}
+
+	// read-only requests
+	f(http.MethodGet, "/api/v1/query", true)
+	f(http.MethodHead, "/", true)
+	f(http.MethodPost, "/api/v1/query", true)
+	f(http.MethodPost, "/select/0/prometheus/api/v1/query_range", true)
+	f(http.MethodPost, "/api/v1/label/job/values", true)
+	f(http.MethodPost, "/render", true)
+
+	// requests, which may modify the backend state
+	f(http.MethodPost, "/api/v1/write", false)
+	f(http.MethodPost, "/api/v1/import", false)
+	f(http.MethodPost, "/api/v1/admin/tsdb/delete_series", false)
+	f(http.MethodPut, "/api/v1/query", false)
+	f(http.MethodDelete, "/api/v1/query", false)
+}
+
+func TestRequestHandlerShadowTraffic(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "backend")
+	}))
+	defer backend.Close()
+
+	shadowCh := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		shadowCh <- r.URL.RequestURI() + " " + string(body)
+		_, _ = io.WriteString(w, "shadow")
+	}))
+	defer shadow.Close()
+
+	cfgOrigP := authConfigData.Load()
+	cfgStr := strings.NewReplacer("{BACKEND}", backend.URL, "{SHADOW}", shadow.URL).Replace(`
+users:
+- username: foo
+  password: bar
+  url_map:
+  - src_paths: ["/api/v1/query"]
+    url_prefix: {BACKEND}/select/
+    shadow_url: {SHADOW}/candidate/
+`)
+	if _, err := reloadAuthConfigData([]byte(cfgStr)); err != nil {
+		t.Fatalf("cannot load config data: %s", err)
+	}
+	defer func() {
+		cfgOrig := []byte("unauthorized_user:\n  url_prefix: http://foo/bar")
+		if cfgOrigP != nil {
+			cfgOrig = *cfgOrigP
+		}
+		if _, err := reloadAuthConfigData(cfgOrig); err != nil {
+			t.Fatalf("cannot load the original config: %s", err)
+		}
+	}()
+
+	r, err := http.NewRequest(http.MethodPost, "http://some-host.com/api/v1/query?query=up", strings.NewReader("time=123"))
+	if err != nil {
+		t.Fatalf("cannot initialize http request: %s", err)
+	}
+	r.RequestURI = r.URL.RequestURI()
+	r.RemoteAddr = "42.2.3.84:6789"
+	r.SetBasicAuth("foo", "bar")
+
+	w := &fakeResponseWriter{}
+	if !requestHandler(w, r) {
+		t.Fatalf("unexpected false is returned from requestHandler")
+	}
+	responseExpected := "statusCode=200\nbackend"
+	if response := strings.TrimSpace(w.getResponse()); response != responseExpected {
+		t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", response, responseExpected)
+	}
+
+	select {
+	case s := <-shadowCh:
+		if sExpected := "/candidate/api/v1/query?query=up time=123"; s != sExpected {
+			t.Fatalf("unexpected shadow request; got %q; want %q", s, sExpected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for the shadow request")
+	}
+}
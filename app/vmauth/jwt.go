@@ -179,6 +179,7 @@ func parseJWTUsers(ac *AuthConfig, oidcDP *oidcDiscovererPool) ([]*UserInfo, err
 		mcr := ui.getMaxConcurrentRequests()
 		ui.concurrencyLimitCh = make(chan struct{}, mcr)
 		ui.concurrencyLimitReached = ac.ms.GetOrCreateCounter(`vmauth_user_concurrent_requests_limit_reached_total` + metricLabels)
+		ui.rateLimitReached = ac.ms.GetOrCreateCounter(`vmauth_user_rate_limit_reached_total` + metricLabels)
 		_ = ac.ms.GetOrCreateGauge(`vmauth_user_concurrent_requests_capacity`+metricLabels, func() float64 {
 			return float64(cap(ui.concurrencyLimitCh))
 		})
@@ -228,7 +229,7 @@ func getJWTUserInfo(ats []string) (*UserInfo, *jwt.Token) {
 	tkn := getToken()
 
 	for _, at := range ats {
-		if strings.Count(at, ".") != 2 {
+		if !strings.HasPrefix(at, `http_auth:`) || strings.Count(at, ".") != 2 {
 			continue
 		}
 
@@ -33,6 +33,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 )
 
 var (
@@ -116,6 +117,8 @@ func main() {
 	}
 	logger.Infof("starting vmauth at %q...", listenAddrs)
 	startTime := time.Now()
+	tracing.Init("vmauth")
+	initAccessLogExporter()
 	initAuthConfig()
 
 	disableInternalRoutes := len(*httpInternalListenAddr) > 0
@@ -128,6 +131,7 @@ func main() {
 		UseProxyProtocol: useProxyProtocol,
 		// built-in routes will be exposed at *httpInternalListenAddr
 		DisableBuiltinRoutes: disableInternalRoutes,
+		ConfigureTLS:         configureMTLS,
 	})
 
 	if len(*httpInternalListenAddr) > 0 {
@@ -147,6 +151,9 @@ func main() {
 	}
 	logger.Infof("successfully shut down the webservice in %.3f seconds", time.Since(startTime).Seconds())
 	stopAuthConfig()
+	stopResponseCache()
+	stopAccessLogExporter()
+	tracing.Stop()
 	logger.Infof("successfully stopped vmauth in %.3f seconds", time.Since(startTime).Seconds())
 }
 
@@ -181,7 +188,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 
-		ui.logRequest(r, `unauthorized`, http.StatusUnauthorized, 0)
+		ui.logRequest(r, `unauthorized`, http.StatusUnauthorized, 0, nil)
 		handleMissingAuthorizationError(w)
 		return true
 	}
@@ -211,7 +218,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 
 	invalidAuthTokenRequests.Inc()
 	slowdownUnauthorizedResponse(r)
-	uu.logRequest(r, `unauthorized`, http.StatusUnauthorized, 0)
+	uu.logRequest(r, `unauthorized`, http.StatusUnauthorized, 0, nil)
 	if *logInvalidAuthTokens {
 		err := fmt.Errorf("cannot authorize request with auth tokens %q", ats)
 		err = &httpserver.ErrorWithStatusCode{
@@ -280,17 +287,46 @@ func processUserRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, tk
 		userName = "unauthorized"
 	}
 
-	if ui.AccessLog != nil {
+	// Trace the request if needed.
+	// See https://docs.victoriametrics.com/victoriametrics/vmauth/#tracing
+	span := startRequestSpan(r, userName)
+
+	if ui.AccessLog != nil || span != nil {
 		w = &responseWriterWithStatus{ResponseWriter: w}
 		defer func() {
 			rws := w.(*responseWriterWithStatus)
 			duration := time.Since(startTime)
-			ui.logRequest(r, userName, rws.status, duration)
+			if span != nil {
+				span.SetAttributes(tracing.Int("http.response.status_code", int64(rws.status)))
+				if rws.status >= 500 {
+					span.SetError(fmt.Errorf("unexpected response status code %d", rws.status))
+				}
+				span.End()
+			}
+			ui.logRequest(r, userName, rws.status, duration, span)
 		}()
 	}
 
+	// Apply rate limits for the given user.
+	if err := ui.rateLimits.check(); err != nil {
+		ui.rateLimitReached.Inc()
+		handleRateLimitError(w, r, fmt.Errorf("cannot process the request from the user %s: %w", userName, err))
+		return
+	}
+	var rlb *rateLimitedBody
+	if ui.hasRequestBytesLimits && r.Body != nil {
+		// Charge the request body bytes to max_request_bytes_per_second limits.
+		rlb = &rateLimitedBody{r: r.Body}
+		rlb.addLimiter(ui.rateLimits.getBytesLimiter())
+		r.Body = rlb
+	}
+
 	// Acquire global concurrency limit.
-	if err := beginConcurrencyLimit(ctx); err != nil {
+	qs := span.NewChild("vmauth.queue_wait", tracing.SpanKindInternal)
+	err := beginConcurrencyLimit(ctx)
+	qs.SetError(err)
+	qs.End()
+	if err != nil {
 		handleConcurrencyLimitError(w, r, err)
 		return
 	}
@@ -320,14 +356,18 @@ func processUserRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, tk
 	}
 
 	// Acquire concurrency limit for the given user.
-	if err := ui.beginConcurrencyLimit(ctx); err != nil {
+	qs = span.NewChild("vmauth.user_queue_wait", tracing.SpanKindInternal)
+	err = ui.beginConcurrencyLimit(ctx)
+	qs.SetError(err)
+	qs.End()
+	if err != nil {
 		handleConcurrencyLimitError(w, r, err)
 		return
 	}
 	defer ui.endConcurrencyLimit()
 
 	// Process the request.
-	processRequest(w, r, ui, tkn, userName)
+	processRequest(w, r, ui, tkn, userName, rlb, span)
 }
 
 func beginConcurrencyLimit(ctx context.Context) error {
@@ -401,7 +441,7 @@ func bufferRequestBody(ctx context.Context, r io.ReadCloser, userName string) (i
 	return bb, nil
 }
 
-func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, tkn *jwt.Token, userName string) {
+func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, tkn *jwt.Token, userName string, rlb *rateLimitedBody, span *tracing.Span) {
 	u := normalizeURL(r.URL)
 	up, hc := ui.getURLPrefixAndHeaders(u, r.Host, r.Header)
 	isDefault := false
@@ -426,18 +466,45 @@ func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, tkn *j
 		isDefault = true
 	}
 
-	maxAttempts := up.getBackendsCount()
-	for range maxAttempts {
-		bu := up.getBackendURL()
-		if bu == nil {
-			break
+	// Apply rate limits for the matching url_map entry.
+	if err := up.rateLimits.check(); err != nil {
+		ui.rateLimitReached.Inc()
+		handleRateLimitError(w, r, fmt.Errorf("cannot process the request from the user %s to %q: %w", userName, u.Path, err))
+		return
+	}
+	if rlb != nil {
+		rlb.addLimiter(up.rateLimits.getBytesLimiter())
+	}
+
+	var vmac *jwt.VMAccessClaim
+	if tkn != nil {
+		vmac = tkn.VMAccess()
+		if !tkn.HasVMAccessClaim() {
+			vmac = ui.JWT.DefaultVMAccessClaim
 		}
+	}
+
+	// Enforce label filters for the matching route.
+	// See https://docs.victoriametrics.com/victoriametrics/vmauth/#label-enforcement
+	if up.labelEnforcer != nil {
+		if err := up.labelEnforcer.enforce(r, u, vmac); err != nil {
+			enforceLabelsRejectedRequests.Inc()
+			ui.requestErrors.Inc()
+			httpserver.Errorf(w, r, "cannot process the request from the user %s to %q: %s", userName, u.Path, err)
+			return
+		}
+	}
+
+	if !isDefault {
+		// Mirror the request to the shadow backend if needed.
+		// See https://docs.victoriametrics.com/victoriametrics/vmauth/#shadow-traffic
+		up.shadow.mirrorRequest(r, u, up, hc, ui)
+	}
+
+	getTargetURL := func(bu *backendURL) (*url.URL, HeadersConf) {
 		targetURL := bu.url
+		hc := hc
 		if tkn != nil {
-			vmac := tkn.VMAccess()
-			if !tkn.HasVMAccessClaim() {
-				vmac = ui.JWT.DefaultVMAccessClaim
-			}
 			// for security reasons allow templating only for configured url values and headers
 			targetURL, hc = replaceJWTPlaceholders(bu, hc, vmac)
 		}
@@ -452,9 +519,47 @@ func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, tkn *j
 			// Update path for regular routes.
 			targetURL = mergeURLs(targetURL, u, up.dropSrcPathPrefixParts, up.mergeQueryArgs)
 		}
+		return targetURL, hc
+	}
+
+	maxAttempts := up.getBackendsCount()
+	span.SetAttributes(tracing.Int("vmauth.backends_count", int64(maxAttempts)))
+	for i := range maxAttempts {
+		bu := up.getBackendURL()
+		if bu == nil {
+			break
+		}
+		targetURL, hc := getTargetURL(bu)
+		var bs *tracing.Span
+		newHedgeRequest := func() (*http.Request, func()) {
+			hbu := up.getHedgeBackendURL(bu)
+			if hbu == nil {
+				return nil, nil
+			}
+			targetURL, hc := getTargetURL(hbu)
+			req := newBackendRequest(r, targetURL, hc)
+			req.Body = newHedgeRequestBody(r)
+			bs.SetAttributes(tracing.String("vmauth.hedge_server.address", hbu.url.Host))
+			bs.InjectHeaders(req.Header)
+			return req, hbu.put
+		}
+		if i == 0 && up.responseCacheTTL > 0 {
+			// Serve the response from the cache if possible.
+			// See https://docs.victoriametrics.com/victoriametrics/vmauth/#response-caching
+			if key := getResponseCacheKey(r, targetURL, hc, userName); key != nil {
+				if writeCachedResponse(w, key) {
+					span.SetAttributes(tracing.String("vmauth.response_cache", "hit"))
+					bu.put()
+					return
+				}
+				w = newResponseCacheWriter(w, key, up.responseCacheTTL)
+			}
+		}
 		wasLocalRetry := false
 	again:
-		ok, needLocalRetry := tryProcessingRequest(w, r, targetURL, hc, up.retryStatusCodes, ui, bu)
+		bs = startBackendRequestSpan(span, bu, i+1, wasLocalRetry)
+		ok, needLocalRetry := tryProcessingRequest(w, r, targetURL, hc, up, ui, bu, newHedgeRequest, bs)
+		bs.End()
 		if needLocalRetry && !wasLocalRetry {
 			wasLocalRetry = true
 			goto again
@@ -476,27 +581,35 @@ func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, tkn *j
 	ui.requestErrors.Inc()
 }
 
-func tryProcessingRequest(w http.ResponseWriter, r *http.Request, targetURL *url.URL, hc HeadersConf, retryStatusCodes []int, ui *UserInfo, bu *backendURL) (bool, bool) {
+func tryProcessingRequest(w http.ResponseWriter, r *http.Request, targetURL *url.URL, hc HeadersConf, up *URLPrefix, ui *UserInfo, bu *backendURL,
+	newHedgeRequest func() (*http.Request, func()), bs *tracing.Span) (bool, bool) {
 	ui.backendRequests.Inc()
-	req := sanitizeRequestHeaders(r)
-
-	req.URL = targetURL
-	req.Header.Set("User-Agent", "vmauth")
-	updateHeadersByConfig(req.Header, hc.RequestHeaders)
-	if hc.KeepOriginalHost == nil || !*hc.KeepOriginalHost {
-		if host := getHostHeader(hc.RequestHeaders); host != "" {
-			req.Host = host
-		} else {
-			req.Host = targetURL.Host
-		}
-	}
+	req := newBackendRequest(r, targetURL, hc)
+	bs.InjectHeaders(req.Header)
 
 	bb, bbOK := req.Body.(*bufferedBody)
 	canRetry := !bbOK || bb.canRetry()
 
-	res, err := ui.rt.RoundTrip(req)
+	var res *http.Response
+	var err error
+	startTime := time.Now()
+	if hedgeDelay := up.getHedgeDelay(); hedgeDelay > 0 && canHedgeRequest(req) {
+		// Send the request to another backend if the response isn't received during hedgeDelay.
+		// See https://docs.victoriametrics.com/victoriametrics/vmauth/#request-hedging
+		res, _, err = hedgedRoundTrip(ui.rt, req, hedgeDelay, up.retryStatusCodes, newHedgeRequest)
+	} else {
+		res, err = ui.rt.RoundTrip(req)
+	}
 	if err == nil {
+		latency := time.Since(startTime)
+		up.latencyTracker.update(latency)
+		bs.SetAttributes(
+			tracing.Int("http.response.status_code", int64(res.StatusCode)),
+			tracing.Int("vmauth.upstream_latency_ms", latency.Milliseconds()),
+		)
 		defer func() { _ = res.Body.Close() }()
+	} else {
+		bs.SetError(err)
 	}
 
 	if errors.Is(r.Context().Err(), context.Canceled) {
@@ -535,7 +648,7 @@ func tryProcessingRequest(w http.ResponseWriter, r *http.Request, targetURL *url
 		}
 		return false, false
 	}
-	if slices.Contains(retryStatusCodes, res.StatusCode) {
+	if slices.Contains(up.retryStatusCodes, res.StatusCode) {
 		if !canRetry {
 			// If we get an error from the retry_status_codes list, but cannot execute retry,
 			// we consider such a request an error as well.
@@ -555,7 +668,8 @@ func tryProcessingRequest(w http.ResponseWriter, r *http.Request, targetURL *url
 		remoteAddr := httpserver.GetQuotedRemoteAddr(r)
 		requestURI := httpserver.GetRequestURI(r)
 		logger.Warnf("remoteAddr: %s; requestURI: %s; request to %s failed, retrying the request at another backend because response status code=%d belongs to retry_status_codes=%d",
-			remoteAddr, requestURI, targetURL, res.StatusCode, retryStatusCodes)
+			remoteAddr, requestURI, targetURL, res.StatusCode, up.retryStatusCodes)
+		bs.SetError(fmt.Errorf("response status code=%d belongs to retry_status_codes", res.StatusCode))
 		if bbOK {
 			bb.resetReader()
 		}
@@ -567,6 +681,9 @@ func tryProcessingRequest(w http.ResponseWriter, r *http.Request, targetURL *url
 	w.WriteHeader(res.StatusCode)
 
 	err = copyStreamToClient(w, res.Body)
+	if rcw, ok := w.(*responseCacheWriter); ok && err == nil {
+		rcw.storeResponse()
+	}
 
 	if errors.Is(r.Context().Err(), context.Canceled) {
 		// Do not retry canceled requests.
@@ -649,6 +766,23 @@ func updateHeadersByConfig(dst http.Header, src []*Header) {
 	}
 }
 
+// newBackendRequest returns a copy of r for proxying to the given targetURL with the given hc.
+func newBackendRequest(r *http.Request, targetURL *url.URL, hc HeadersConf) *http.Request {
+	req := sanitizeRequestHeaders(r)
+
+	req.URL = targetURL
+	req.Header.Set("User-Agent", "vmauth")
+	updateHeadersByConfig(req.Header, hc.RequestHeaders)
+	if hc.KeepOriginalHost == nil || !*hc.KeepOriginalHost {
+		if host := getHostHeader(hc.RequestHeaders); host != "" {
+			req.Host = host
+		} else {
+			req.Host = targetURL.Host
+		}
+	}
+	return req
+}
+
 func sanitizeRequestHeaders(r *http.Request) *http.Request {
 	// This code has been copied from net/http/httputil/reverseproxy.go
 	req := r.Clone(r.Context())
@@ -916,4 +1050,6 @@ func slowdownUnauthorizedResponse(r *http.Request) {
 // initSecretFlags manages the secret flags for this app and must be called after flag parsing and before logger init.
 func initSecretFlags() {
 	pushmetrics.InitSecretFlags()
+	tracing.InitSecretFlags()
+	flagutil.RegisterSecretFlag("accessLog.otlpHeader")
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+)
+
+var (
+	mtlsEnable = flagutil.NewArrayBool("mtls", "Whether to require valid client certificate for https requests to the corresponding -httpListenAddr . "+
+		"This flag works only if -tls flag is set. See also -mtlsCAFile")
+	mtlsCAFile = flagutil.NewArrayString("mtlsCAFile", "Optional path to TLS Root CA for verifying client certificates at the corresponding -httpListenAddr when -mtls is enabled. "+
+		"By default the host system TLS Root CA is used for client certificate verification")
+)
+
+// MTLSConfig contains the identity of the client TLS certificate for matching the user.
+//
+// See https://docs.victoriametrics.com/victoriametrics/vmauth/#mtls-based-request-routing
+type MTLSConfig struct {
+	// CommonName is the subject common name (CN) of the client certificate.
+	CommonName string `yaml:"common_name,omitempty"`
+
+	// Organization is the subject organization (O) of the client certificate.
+	Organization string `yaml:"organization,omitempty"`
+
+	// OrganizationalUnit is the subject organizational unit (OU) of the client certificate.
+	OrganizationalUnit string `yaml:"organizational_unit,omitempty"`
+
+	// URISAN is the URI from subject alternative names (SAN) of the client certificate.
+	URISAN string `yaml:"uri_san,omitempty"`
+
+	// SPIFFEID is the SPIFFE ID of the client certificate.
+	//
+	// See https://github.com/spiffe/spiffe/blob/main/standards/X509-SVID.md
+	SPIFFEID string `yaml:"spiffe_id,omitempty"`
+}
+
+// getAuthToken returns auth token for the given mc.
+//
+// The returned auth token matches one of the tokens returned by getClientCertAuthTokens for the request with the matching client certificate.
+func (mc *MTLSConfig) getAuthToken() (string, error) {
+	var ats []string
+	if mc.CommonName != "" {
+		ats = append(ats, getMTLSCommonNameToken(mc.CommonName))
+	}
+	if mc.Organization != "" {
+		ats = append(ats, getMTLSOrganizationToken(mc.Organization))
+	}
+	if mc.OrganizationalUnit != "" {
+		ats = append(ats, getMTLSOrganizationalUnitToken(mc.OrganizationalUnit))
+	}
+	if mc.URISAN != "" {
+		ats = append(ats, getMTLSURIToken(mc.URISAN))
+	}
+	if mc.SPIFFEID != "" {
+		if err := validateSPIFFEID(mc.SPIFFEID); err != nil {
+			return "", fmt.Errorf("invalid spiffe_id=%q: %w", mc.SPIFFEID, err)
+		}
+		ats = append(ats, getMTLSURIToken(mc.SPIFFEID))
+	}
+	if len(ats) != 1 {
+		return "", fmt.Errorf("mtls section must contain exactly one of common_name, organization, organizational_unit, uri_san or spiffe_id; got %d of them", len(ats))
+	}
+	return ats[0], nil
+}
+
+// checkMTLSCAFile returns an error if users with mtls section are present in ac, while some of -httpListenAddr
+// verify client certificates with the host system TLS Root CA. Such certificates can be issued for arbitrary identities
+// by public CAs, so -mtlsCAFile must be set.
+func checkMTLSCAFile(ac *AuthConfig) error {
+	if !slices.ContainsFunc(ac.Users, func(ui UserInfo) bool { return ui.MTLS != nil }) {
+		return nil
+	}
+	listenAddrs := *httpListenAddrs
+	if len(listenAddrs) == 0 {
+		listenAddrs = []string{":8427"}
+	}
+	for idx, addr := range listenAddrs {
+		if httpserver.IsTLS(idx) && mtlsEnable.GetOptionalArg(idx) && mtlsCAFile.GetOptionalArg(idx) == "" {
+			return fmt.Errorf("-mtlsCAFile must be set for -httpListenAddr=%q with enabled -mtls if users with mtls section are present in -auth.config", addr)
+		}
+	}
+	return nil
+}
+
+// configureMTLS enables client certificates verification at cfg for -httpListenAddr at the given idx if -mtls is set.
+func configureMTLS(idx int, cfg *tls.Config) error {
+	if !mtlsEnable.GetOptionalArg(idx) {
+		return nil
+	}
+	caFile := mtlsCAFile.GetOptionalArg(idx)
+	if err := netutil.EnableServerMTLS(cfg, caFile); err != nil {
+		return fmt.Errorf("cannot enable mTLS with -mtlsCAFile=%q: %w", caFile, err)
+	}
+	return nil
+}
+
+// validateSPIFFEID validates the given SPIFFE ID according to https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE-ID.md
+func validateSPIFFEID(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "spiffe" {
+		return fmt.Errorf("the scheme must be spiffe://")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing trust domain")
+	}
+	if u.Port() != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("port, user info, query and fragment aren't allowed")
+	}
+	return nil
+}
+
+// getClientCertAuthTokens returns auth tokens for the verified client TLS certificate from r.
+//
+// Nil is returned if r doesn't contain verified client certificate. See -mtls command-line flag.
+func getClientCertAuthTokens(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	var ats []string
+	for _, u := range cert.URIs {
+		ats = append(ats, getMTLSURIToken(u.String()))
+	}
+	if cn := cert.Subject.CommonName; cn != "" {
+		ats = append(ats, getMTLSCommonNameToken(cn))
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		ats = append(ats, getMTLSOrganizationalUnitToken(ou))
+	}
+	for _, o := range cert.Subject.Organization {
+		ats = append(ats, getMTLSOrganizationToken(o))
+	}
+	return ats
+}
+
+func getMTLSCommonNameToken(cn string) string {
+	return "mtls:cn:" + cn
+}
+
+func getMTLSOrganizationToken(o string) string {
+	return "mtls:o:" + o
+}
+
+func getMTLSOrganizationalUnitToken(ou string) string {
+	return "mtls:ou:" + ou
+}
+
+func getMTLSURIToken(uri string) string {
+	return "mtls:uri:" + uri
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+)
+
+func TestMTLSConfigGetAuthTokenSuccess(t *testing.T) {
+	f := func(mc *MTLSConfig, atExpected string) {
+		t.Helper()
+
+		at, err := mc.getAuthToken()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if at != atExpected {
+			t.Fatalf("unexpected auth token; got %q; want %q", at, atExpected)
+		}
+	}
+
+	f(&MTLSConfig{CommonName: "vmagent"}, "mtls:cn:vmagent")
+	f(&MTLSConfig{Organization: "acme"}, "mtls:o:acme")
+	f(&MTLSConfig{OrganizationalUnit: "finance"}, "mtls:ou:finance")
+	f(&MTLSConfig{URISAN: "https://vmagent.example.com"}, "mtls:uri:https://vmagent.example.com")
+	f(&MTLSConfig{SPIFFEID: "spiffe://example.org/ns/monitoring/sa/vmagent"}, "mtls:uri:spiffe://example.org/ns/monitoring/sa/vmagent")
+}
+
+func TestMTLSConfigGetAuthTokenFailure(t *testing.T) {
+	f := func(mc *MTLSConfig) {
+		t.Helper()
+
+		if _, err := mc.getAuthToken(); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// empty config
+	f(&MTLSConfig{})
+
+	// multiple identities
+	f(&MTLSConfig{CommonName: "vmagent", OrganizationalUnit: "finance"})
+
+	// invalid spiffe_id
+	f(&MTLSConfig{SPIFFEID: "https://example.org/vmagent"})
+	f(&MTLSConfig{SPIFFEID: "spiffe:///vmagent"})
+	f(&MTLSConfig{SPIFFEID: "spiffe://example.org:443/vmagent"})
+	f(&MTLSConfig{SPIFFEID: "spiffe://example.org/vmagent?foo=bar"})
+}
+
+func TestCheckMTLSCAFile(t *testing.T) {
+	setFlag := func(name, value string) {
+		t.Helper()
+
+		v := flag.Lookup(name).Value
+		switch a := v.(type) {
+		case *flagutil.ArrayBool:
+			*a = nil
+		case *flagutil.ArrayString:
+			*a = nil
+		}
+		if value == "" {
+			return
+		}
+		if err := v.Set(value); err != nil {
+			t.Fatalf("cannot set -%s=%q: %s", name, value, err)
+		}
+	}
+	defer func() {
+		setFlag("tls", "")
+		setFlag("mtls", "")
+		setFlag("mtlsCAFile", "")
+	}()
+
+	f := func(s, mtls, mtlsCAFile string, resultExpected bool) {
+		t.Helper()
+
+		setFlag("tls", "true")
+		setFlag("mtls", mtls)
+		setFlag("mtlsCAFile", mtlsCAFile)
+		ac, err := parseAuthConfig([]byte(s))
+		if err != nil {
+			t.Fatalf("cannot parse auth config: %s", err)
+		}
+		err = checkMTLSCAFile(ac)
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v; err: %v", result, resultExpected, err)
+		}
+	}
+
+	mtlsConfig := `
+users:
+- mtls:
+    common_name: vmagent
+  url_prefix: http://foo
+`
+	basicAuthConfig := `
+users:
+- username: foo
+  url_prefix: http://foo
+`
+
+	// mtls users with -mtlsCAFile
+	f(mtlsConfig, "true", "/path/to/ca.pem", true)
+
+	// mtls users without -mtlsCAFile
+	f(mtlsConfig, "true", "", false)
+
+	// mtls users without -mtls
+	f(mtlsConfig, "", "", true)
+
+	// no mtls users
+	f(basicAuthConfig, "true", "", true)
+}
+
+func TestConfigureMTLS(t *testing.T) {
+	defer func() {
+		*mtlsEnable = nil
+	}()
+
+	// -mtls isn't set
+	var cfg tls.Config
+	if err := configureMTLS(0, &cfg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.ClientAuth != tls.NoClientCert {
+		t.Fatalf("unexpected ClientAuth; got %v; want %v", cfg.ClientAuth, tls.NoClientCert)
+	}
+
+	// -mtls is set only for the second -httpListenAddr
+	if err := mtlsEnable.Set("false,true"); err != nil {
+		t.Fatalf("cannot set -mtls: %s", err)
+	}
+	if err := configureMTLS(0, &cfg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.ClientAuth != tls.NoClientCert {
+		t.Fatalf("unexpected ClientAuth; got %v; want %v", cfg.ClientAuth, tls.NoClientCert)
+	}
+	if err := configureMTLS(1, &cfg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Fatalf("unexpected ClientAuth; got %v; want %v", cfg.ClientAuth, tls.RequireAndVerifyClientCert)
+	}
+}
+
+func TestGetClientCertAuthTokens(t *testing.T) {
+	f := func(cs *tls.ConnectionState, atsExpected []string) {
+		t.Helper()
+
+		r := &http.Request{
+			TLS: cs,
+		}
+		ats := getClientCertAuthTokens(r)
+		if !reflect.DeepEqual(ats, atsExpected) {
+			t.Fatalf("unexpected auth tokens; got %q; want %q", ats, atsExpected)
+		}
+	}
+
+	// non-TLS request
+	f(nil, nil)
+
+	// unverified client certificate
+	f(&tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{newTestClientCert("vmagent", "", nil)},
+	}, nil)
+
+	// verified client certificate
+	f(newTestConnectionState(newTestClientCert("vmagent", "finance", []string{"spiffe://example.org/vmagent"})), []string{
+		"mtls:uri:spiffe://example.org/vmagent",
+		"mtls:cn:vmagent",
+		"mtls:ou:finance",
+	})
+}
+
+func TestRequestHandlerMTLS(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	cfgOrigP := authConfigData.Load()
+	cfgStr := strings.ReplaceAll(`
+users:
+- mtls:
+    spiffe_id: spiffe://example.org/ns/monitoring/sa/vmagent
+  url_prefix: {BACKEND}/vmagent
+- mtls:
+    organizational_unit: finance
+  url_prefix: {BACKEND}/finance
+- username: foo
+  password: bar
+  url_prefix: {BACKEND}/foo
+`, "{BACKEND}", ts.URL)
+	if _, err := reloadAuthConfigData([]byte(cfgStr)); err != nil {
+		t.Fatalf("cannot load config data: %s", err)
+	}
+	defer func() {
+		cfgOrig := []byte("unauthorized_user:\n  url_prefix: http://foo/bar")
+		if cfgOrigP != nil {
+			cfgOrig = *cfgOrigP
+		}
+		if _, err := reloadAuthConfigData(cfgOrig); err != nil {
+			t.Fatalf("cannot load the original config: %s", err)
+		}
+	}()
+
+	f := func(cert *x509.Certificate, withBasicAuth bool, responseExpected string) {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodGet, "https://some-host.com/api/v1/query", nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		r.RequestURI = r.URL.RequestURI()
+		r.RemoteAddr = "42.2.3.84:6789"
+		if cert != nil {
+			r.TLS = newTestConnectionState(cert)
+		}
+		if withBasicAuth {
+			r.SetBasicAuth("foo", "bar")
+		}
+
+		w := &fakeResponseWriter{}
+		if !requestHandler(w, r) {
+			t.Fatalf("unexpected false is returned from requestHandler")
+		}
+		response := strings.TrimSpace(w.getResponse())
+		responseExpected = strings.TrimSpace(responseExpected)
+		if response != responseExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", response, responseExpected)
+		}
+	}
+
+	// SPIFFE ID match
+	f(newTestClientCert("vmagent", "finance", []string{"spiffe://example.org/ns/monitoring/sa/vmagent"}), false, `
+statusCode=200
+/vmagent/api/v1/query`)
+
+	// organizational unit match
+	f(newTestClientCert("grafana", "finance", nil), false, `
+statusCode=200
+/finance/api/v1/query`)
+
+	// basic auth takes precedence over the client certificate
+	f(newTestClientCert("grafana", "finance", nil), true, `
+statusCode=200
+/foo/api/v1/query`)
+
+	// unknown client certificate
+	f(newTestClientCert("grafana", "devops", nil), false, `
+statusCode=401
+Unauthorized`)
+}
+
+func newTestClientCert(cn, ou string, uris []string) *x509.Certificate {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: cn,
+		},
+	}
+	if ou != "" {
+		cert.Subject.OrganizationalUnit = []string{ou}
+	}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			panic(err)
+		}
+		cert.URIs = append(cert.URIs, u)
+	}
+	return cert
+}
+
+func newTestConnectionState(cert *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+// rateLimits contains rate limits for requests and request body bytes.
+//
+// It is configured via max_requests_per_second and max_request_bytes_per_second options
+// at user and url_map sections of -auth.config.
+type rateLimits struct {
+	requests *rateLimiter
+	bytes    *rateLimiter
+}
+
+// newRateLimits returns rate limits for the given options.
+//
+// nil is returned if both options are zero, i.e. rate limiting is disabled.
+func newRateLimits(maxRequestsPerSecond float64, maxRequestBytesPerSecond int64) (*rateLimits, error) {
+	if maxRequestsPerSecond < 0 || math.IsNaN(maxRequestsPerSecond) || math.IsInf(maxRequestsPerSecond, 0) {
+		return nil, fmt.Errorf("max_requests_per_second must be a non-negative finite number; got %v", maxRequestsPerSecond)
+	}
+	if maxRequestBytesPerSecond < 0 {
+		return nil, fmt.Errorf("max_request_bytes_per_second cannot be negative; got %d", maxRequestBytesPerSecond)
+	}
+	if maxRequestsPerSecond == 0 && maxRequestBytesPerSecond == 0 {
+		return nil, nil
+	}
+	return &rateLimits{
+		requests: newRateLimiter(maxRequestsPerSecond),
+		bytes:    newRateLimiter(float64(maxRequestBytesPerSecond)),
+	}, nil
+}
+
+// check verifies whether a new request can be started according to rls.
+//
+// It returns rateLimitError if the request must be rejected.
+func (rls *rateLimits) check() error {
+	if rls == nil {
+		return nil
+	}
+	now := time.Now()
+
+	// Check the bytes limit at first, so the request isn't counted against requests limit if it is rejected because of the bytes limit.
+	if d := rls.bytes.reserve(now, 0); d > 0 {
+		return &rateLimitError{
+			err:        fmt.Errorf("max_request_bytes_per_second=%.0f limit is exceeded", rls.bytes.limit),
+			retryAfter: d,
+		}
+	}
+	if d := rls.requests.reserve(now, 1); d > 0 {
+		return &rateLimitError{
+			err:        fmt.Errorf("max_requests_per_second=%v limit is exceeded", rls.requests.limit),
+			retryAfter: d,
+		}
+	}
+	return nil
+}
+
+func (rls *rateLimits) getBytesLimiter() *rateLimiter {
+	if rls == nil {
+		return nil
+	}
+	return rls.bytes
+}
+
+// rateLimiter implements token bucket rate limiting.
+//
+// The bucket is refilled with limit tokens per second. It can hold up to one second worth of tokens.
+// The bucket may go into debt after charge() call. New reservations are rejected until the debt is paid off.
+type rateLimiter struct {
+	limit float64
+	burst float64
+
+	// mu protects fields below
+	mu         sync.Mutex
+	tokens     float64
+	lastUpdate time.Time
+}
+
+// newRateLimiter returns rate limiter for the given limit per second.
+//
+// nil is returned if limit is zero.
+func newRateLimiter(limit float64) *rateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	burst := max(limit, 1)
+	return &rateLimiter{
+		limit:      limit,
+		burst:      burst,
+		tokens:     burst,
+		lastUpdate: time.Now(),
+	}
+}
+
+// reserve takes n tokens from rl if it has enough tokens at the given time.
+//
+// Otherwise it returns the duration to wait until rl has enough tokens.
+func (rl *rateLimiter) reserve(now time.Time, n float64) time.Duration {
+	if rl == nil {
+		return 0
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.refillLocked(now)
+	if rl.tokens >= n {
+		rl.tokens -= n
+		return 0
+	}
+	seconds := (n - rl.tokens) / rl.limit
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+// charge unconditionally takes n tokens from rl at the given time.
+//
+// rl goes into debt if it has less than n tokens.
+func (rl *rateLimiter) charge(now time.Time, n float64) {
+	if rl == nil {
+		return
+	}
+	rl.mu.Lock()
+	rl.refillLocked(now)
+	rl.tokens -= n
+	rl.mu.Unlock()
+}
+
+func (rl *rateLimiter) refillLocked(now time.Time) {
+	d := now.Sub(rl.lastUpdate).Seconds()
+	if d <= 0 {
+		return
+	}
+	rl.tokens = min(rl.tokens+d*rl.limit, rl.burst)
+	rl.lastUpdate = now
+}
+
+// rateLimitError is returned when the request exceeds the configured rate limits.
+type rateLimitError struct {
+	err error
+
+	// retryAfter is the duration to wait before the request can be retried.
+	retryAfter time.Duration
+}
+
+// Error implements error interface.
+func (e *rateLimitError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *rateLimitError) Unwrap() error {
+	return e.err
+}
+
+func handleRateLimitError(w http.ResponseWriter, r *http.Request, err error) {
+	retryAfter := time.Second
+	var rle *rateLimitError
+	if errors.As(err, &rle) {
+		retryAfter = max(rle.retryAfter, time.Second)
+	}
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	err = &httpserver.ErrorWithStatusCode{
+		Err:        err,
+		StatusCode: http.StatusTooManyRequests,
+	}
+	httpserver.Errorf(w, r, "%s", err)
+}
+
+// rateLimitedBody charges the bytes read from the request body to the registered rate limiters.
+//
+// The charged bytes put rate limiters into debt, so the subsequent requests are rejected until the debt is paid off.
+// This allows limiting the ingestion rate for streamed request bodies of unknown size.
+type rateLimitedBody struct {
+	r io.ReadCloser
+
+	// bytesRead is the number of bytes read from r.
+	bytesRead int64
+
+	limiters []*rateLimiter
+}
+
+// addLimiter registers rl at rb and charges it with the bytes already read from rb.
+func (rb *rateLimitedBody) addLimiter(rl *rateLimiter) {
+	if rl == nil {
+		return
+	}
+	if rb.bytesRead > 0 {
+		rl.charge(time.Now(), float64(rb.bytesRead))
+	}
+	rb.limiters = append(rb.limiters, rl)
+}
+
+// Read implements io.Reader interface.
+func (rb *rateLimitedBody) Read(p []byte) (int, error) {
+	n, err := rb.r.Read(p)
+	if n > 0 {
+		rb.bytesRead += int64(n)
+		now := time.Now()
+		for _, rl := range rb.limiters {
+			rl.charge(now, float64(n))
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface.
+func (rb *rateLimitedBody) Close() error {
+	return rb.r.Close()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	f := func(limit float64, reservations []float64, durationsExpected []time.Duration) {
+		t.Helper()
+
+		rl := newRateLimiter(limit)
+		now := rl.lastUpdate
+		for i, n := range reservations {
+			d := rl.reserve(now, n)
+			if d != durationsExpected[i] {
+				t.Fatalf("unexpected duration for reservation #%d of %v tokens; got %s; want %s", i, n, d, durationsExpected[i])
+			}
+		}
+	}
+
+	// the burst equals to one second worth of tokens
+	f(2, []float64{1, 1, 1}, []time.Duration{0, 0, 500 * time.Millisecond})
+	f(10, []float64{5, 5, 2}, []time.Duration{0, 0, 200 * time.Millisecond})
+
+	// the burst cannot be smaller than a single token
+	f(0.5, []float64{1, 1}, []time.Duration{0, 2 * time.Second})
+
+	// zero reservation succeeds if the bucket isn't in debt
+	f(1, []float64{1, 0}, []time.Duration{0, 0})
+
+	// reservations bigger than the burst cannot be satisfied immediately
+	f(1, []float64{3}, []time.Duration{2 * time.Second})
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	rl := newRateLimiter(10)
+	now := rl.lastUpdate
+
+	// Put the bucket into debt
+	rl.charge(now, 30)
+	if d := rl.reserve(now, 0); d != 2*time.Second {
+		t.Fatalf("unexpected duration for the bucket in debt; got %s; want 2s", d)
+	}
+
+	// The debt is partially paid off
+	now = now.Add(time.Second)
+	if d := rl.reserve(now, 0); d != time.Second {
+		t.Fatalf("unexpected duration for the bucket in debt; got %s; want 1s", d)
+	}
+
+	// The debt is fully paid off
+	now = now.Add(time.Second)
+	if d := rl.reserve(now, 0); d != 0 {
+		t.Fatalf("unexpected duration for the bucket without debt; got %s; want 0s", d)
+	}
+
+	// The bucket cannot hold more than one second worth of tokens
+	now = now.Add(time.Hour)
+	if d := rl.reserve(now, 10); d != 0 {
+		t.Fatalf("unexpected duration for the full bucket; got %s; want 0s", d)
+	}
+	if d := rl.reserve(now, 1); d != 100*time.Millisecond {
+		t.Fatalf("unexpected duration for the empty bucket; got %s; want 100ms", d)
+	}
+}
+
+func TestNewRateLimits(t *testing.T) {
+	rls, err := newRateLimits(0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rls != nil {
+		t.Fatalf("expecting nil rate limits for zero limits")
+	}
+	if err := rls.check(); err != nil {
+		t.Fatalf("unexpected error for nil rate limits: %s", err)
+	}
+
+	rls, err = newRateLimits(1, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rls.getBytesLimiter() != nil {
+		t.Fatalf("expecting nil bytes limiter for zero max_request_bytes_per_second")
+	}
+	if err := rls.check(); err != nil {
+		t.Fatalf("unexpected error for the first request: %s", err)
+	}
+	if err := rls.check(); err == nil {
+		t.Fatalf("expecting non-nil error for the second request")
+	}
+}
+
+func TestRateLimitedBody(t *testing.T) {
+	rl1 := newRateLimiter(100)
+	rl2 := newRateLimiter(100)
+
+	rb := &rateLimitedBody{
+		r: io.NopCloser(strings.NewReader(strings.Repeat("x", 300))),
+	}
+	rb.addLimiter(rl1)
+	buf := make([]byte, 100)
+	if _, err := io.ReadFull(rb, buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// rl2 must be charged with already read bytes
+	rb.addLimiter(rl2)
+	if _, err := io.ReadAll(rb); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rb.bytesRead != 300 {
+		t.Fatalf("unexpected number of read bytes; got %d; want 300", rb.bytesRead)
+	}
+	for _, rl := range []*rateLimiter{rl1, rl2} {
+		if rl.tokens > -199 {
+			t.Fatalf("expecting the rate limiter in debt of at least 199 tokens; got %v tokens", rl.tokens)
+		}
+	}
+}
+
+func TestRequestHandlerRateLimits(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	cfgOrigP := authConfigData.Load()
+	cfgStr := strings.ReplaceAll(`
+users:
+- username: foo
+  password: bar
+  max_requests_per_second: 1
+  url_map:
+  - src_paths: ["/api/v1/write"]
+    url_prefix: {BACKEND}
+    max_request_bytes_per_second: 10
+  - src_paths: ["/api/v1/query"]
+    url_prefix: {BACKEND}
+`, "{BACKEND}", ts.URL)
+	if _, err := reloadAuthConfigData([]byte(cfgStr)); err != nil {
+		t.Fatalf("cannot load config data: %s", err)
+	}
+	defer func() {
+		cfgOrig := []byte("unauthorized_user:\n  url_prefix: http://foo/bar")
+		if cfgOrigP != nil {
+			cfgOrig = *cfgOrigP
+		}
+		if _, err := reloadAuthConfigData(cfgOrig); err != nil {
+			t.Fatalf("cannot load the original config: %s", err)
+		}
+	}()
+
+	f := func(path, body string, statusCodeExpected int) http.Header {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodPost, "http://some-host.com"+path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		r.RequestURI = r.URL.RequestURI()
+		r.RemoteAddr = "42.2.3.84:6789"
+		r.SetBasicAuth("foo", "bar")
+
+		w := &fakeResponseWriter{}
+		if !requestHandler(w, r) {
+			t.Fatalf("unexpected false is returned from requestHandler")
+		}
+		if w.statusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d; response:\n%s", w.statusCode, statusCodeExpected, w.getResponse())
+		}
+		return w.Header()
+	}
+
+	// The first request is allowed, while it puts the url_map bytes limiter into debt.
+	h := f("/api/v1/write", strings.Repeat("x", 100), http.StatusNoContent)
+	if v := h.Get("Retry-After"); v != "" {
+		t.Fatalf("unexpected Retry-After header for successful request: %q", v)
+	}
+
+	// The next request is rejected because of the user requests limit.
+	h = f("/api/v1/query", "", http.StatusTooManyRequests)
+	if v := h.Get("Retry-After"); v != "1" {
+		t.Fatalf("unexpected Retry-After header; got %q; want %q", v, "1")
+	}
+
+	// Wait until the user requests limit allows the next request.
+	time.Sleep(time.Second)
+
+	// The url_map without bytes limit accepts requests.
+	f("/api/v1/query", "", http.StatusNoContent)
+
+	// Wait until the user requests limit allows the next request.
+	time.Sleep(time.Second)
+
+	// The url_map with the bytes limit in debt rejects requests until the debt is paid off.
+	h = f("/api/v1/write", "x", http.StatusTooManyRequests)
+	if v := h.Get("Retry-After"); v == "" || v == "1" {
+		t.Fatalf("expecting Retry-After header bigger than 1 second; got %q", v)
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
+)
+
+var (
+	responseCachePath = flag.String("responseCachePath", "", "Optional path to the directory for persisting the cache for backend responses between vmauth restarts. "+
+		"By default, the cache is stored only in memory. See https://docs.victoriametrics.com/victoriametrics/vmauth/#response-caching")
+	responseCacheSize = flagutil.NewBytes("responseCacheSize", 0, "The maximum size of the cache for backend responses. "+
+		"By default, 1/16 of the allowed memory is used; see -memory.allowedPercent. See https://docs.victoriametrics.com/victoriametrics/vmauth/#response-caching")
+	responseCacheMaxEntrySize = flagutil.NewBytes("responseCacheMaxEntrySize", 4*1024*1024, "The maximum size of a single backend response, which can be cached. "+
+		"Bigger responses are proxied without caching. See https://docs.victoriametrics.com/victoriametrics/vmauth/#response-caching")
+)
+
+var (
+	responseCache     *workingsetcache.Cache
+	responseCacheOnce sync.Once
+
+	responseCacheHits   = metrics.NewCounter(`vmauth_response_cache_hits_total`)
+	responseCacheMisses = metrics.NewCounter(`vmauth_response_cache_misses_total`)
+
+	responseCacheInvalidEntries     = metrics.NewCounter(`vmauth_response_cache_invalid_entries_total`)
+	invalidResponseCacheEntryLogger = logger.WithThrottler("invalidResponseCacheEntry", 5*time.Second)
+)
+
+// getResponseCache returns the cache for backend responses.
+//
+// The cache is initialized on the first call, since it is needed only if response_cache_ttl is set at some url_map entries.
+func getResponseCache() *workingsetcache.Cache {
+	responseCacheOnce.Do(initResponseCache)
+	return responseCache
+}
+
+func initResponseCache() {
+	maxBytes := responseCacheSize.IntN()
+	if maxBytes <= 0 {
+		maxBytes = memory.Allowed() / 16
+	}
+	if *responseCachePath != "" {
+		logger.Infof("loading response cache from %q...", *responseCachePath)
+		responseCache = workingsetcache.Load(*responseCachePath, maxBytes)
+	} else {
+		responseCache = workingsetcache.New(maxBytes)
+	}
+
+	var stats fastcache.Stats
+	var statsLock sync.Mutex
+	var statsLastUpdate time.Time
+	getStats := func() *fastcache.Stats {
+		statsLock.Lock()
+		defer statsLock.Unlock()
+
+		if time.Since(statsLastUpdate) < 2*time.Second {
+			return &stats
+		}
+		stats.Reset()
+		responseCache.UpdateStats(&stats)
+		statsLastUpdate = time.Now()
+		return &stats
+	}
+	metrics.GetOrCreateGauge(`vm_cache_entries{type="vmauth/response"}`, func() float64 {
+		return float64(getStats().EntriesCount)
+	})
+	metrics.GetOrCreateGauge(`vm_cache_size_bytes{type="vmauth/response"}`, func() float64 {
+		return float64(getStats().BytesSize)
+	})
+	metrics.GetOrCreateGauge(`vm_cache_size_max_bytes{type="vmauth/response"}`, func() float64 {
+		return float64(getStats().MaxBytesSize)
+	})
+}
+
+// stopResponseCache stops the response cache and saves it to -responseCachePath if needed.
+func stopResponseCache() {
+	if responseCache == nil {
+		return
+	}
+	if *responseCachePath != "" {
+		responseCache.MustSave(*responseCachePath)
+	}
+	responseCache.Stop()
+	responseCache = nil
+}
+
+// getResponseCacheKey returns the cache key for the response to r, which is proxied to targetURL.
+//
+// The key contains the user name, the targetURL path with sorted query args and the request headers forwarded to the backend
+// with the overrides from the config, except of responseCacheIgnoredHeaders.
+// Query args are taken from targetURL, so they contain only the client query args allowed by merge_query_args.
+//
+// nil is returned if the response to r mustn't be cached.
+func getResponseCacheKey(r *http.Request, targetURL *url.URL, hc HeadersConf, userName string) []byte {
+	args := targetURL.Query()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		// Grafana sends queries to Prometheus datasource via POST requests with url-encoded form by default.
+		// Cache responses to such requests if the request body fits the buffer read by bufferRequestBody.
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			return nil
+		}
+		bb, ok := r.Body.(*bufferedBody)
+		if !ok || bb.r != nil {
+			return nil
+		}
+		formArgs, err := url.ParseQuery(string(bb.buf))
+		if err != nil {
+			return nil
+		}
+		for k, vs := range formArgs {
+			for _, v := range vs {
+				args.Add(k, v)
+			}
+		}
+	default:
+		return nil
+	}
+
+	cc := r.Header.Get("Cache-Control")
+	if strings.Contains(cc, "no-cache") || strings.Contains(cc, "no-store") {
+		return nil
+	}
+	if args.Get("nocache") == "1" {
+		return nil
+	}
+	if !isAlignedQueryRange(args) {
+		return nil
+	}
+
+	// Take into account all the request headers forwarded to the backend, since they may change the response.
+	// For example, query_range response format depends on Accept header.
+	rh := r.Header.Clone()
+	removeHopHeaders(rh)
+	updateHeadersByConfig(rh, hc.RequestHeaders)
+	names := make([]string, 0, len(rh))
+	for name := range rh {
+		if !isResponseCacheIgnoredHeader(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s?%s\n", userName, r.Method, targetURL.Path, args.Encode())
+	for _, name := range names {
+		fmt.Fprintf(h, "%s: %q\n", name, rh[name])
+	}
+	return h.Sum(nil)
+}
+
+// isResponseCacheIgnoredHeader returns true if the request header with the given canonical name doesn't affect backend responses.
+func isResponseCacheIgnoredHeader(name string) bool {
+	if responseCacheIgnoredHeaders[name] {
+		return true
+	}
+	for _, prefix := range responseCacheIgnoredHeaderPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseCacheIgnoredHeaders contains request headers, which aren't included into response cache keys.
+//
+// These headers are either overridden by vmauth or are set by clients and proxies for tracing and debugging purposes,
+// so including them into the key would prevent from re-using cached responses across clients.
+var responseCacheIgnoredHeaders = map[string]bool{
+	"Cache-Control":     true,
+	"Content-Length":    true,
+	"Origin":            true,
+	"Pragma":            true,
+	"Referer":           true,
+	"Traceparent":       true,
+	"Tracestate":        true,
+	"User-Agent":        true,
+	"X-Dashboard-Uid":   true,
+	"X-Datasource-Uid":  true,
+	"X-Forwarded-For":   true,
+	"X-Forwarded-Host":  true,
+	"X-Forwarded-Proto": true,
+	"X-Panel-Id":        true,
+	"X-Query-Group-Id":  true,
+	"X-Real-Ip":         true,
+	"X-Request-Id":      true,
+}
+
+var responseCacheIgnoredHeaderPrefixes = []string{
+	"Sec-",
+	"X-Grafana-",
+}
+
+// isAlignedQueryRange returns false if args contain step arg, while start or end args aren't aligned to step.
+//
+// Responses to such requests cannot be reused, since their start and end change on every dashboard refresh.
+func isAlignedQueryRange(args url.Values) bool {
+	stepStr := args.Get("step")
+	if stepStr == "" {
+		return true
+	}
+	step, ok := parseDurationMsecs(stepStr)
+	if !ok || step <= 0 {
+		return false
+	}
+	start, ok := parseTimeMsecs(args.Get("start"))
+	if !ok {
+		return false
+	}
+	end, ok := parseTimeMsecs(args.Get("end"))
+	if !ok {
+		return false
+	}
+	return start%step == 0 && end%step == 0
+}
+
+func parseTimeMsecs(s string) (int64, bool) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, false
+		}
+		return int64(math.Round(f * 1e3)), true
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, false
+	}
+	return t.UnixMilli(), true
+}
+
+func parseDurationMsecs(s string) (int64, bool) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, false
+		}
+		return int64(math.Round(f * 1e3)), true
+	}
+	d, err := metricsql.PositiveDurationValue(s, 0)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
+// writeCachedResponse writes the cached response for the given key to w.
+//
+// false is returned if the cache doesn't contain non-expired response for the given key.
+func writeCachedResponse(w http.ResponseWriter, key []byte) bool {
+	data := getResponseCache().GetBig(nil, key)
+	if len(data) == 0 {
+		responseCacheMisses.Inc()
+		return false
+	}
+	h, body, err := unmarshalCachedResponse(data)
+	if err != nil {
+		// The entry may be corrupted or may be written by incompatible vmauth version to -responseCachePath.
+		// Drop it and treat it as cache miss.
+		responseCacheInvalidEntries.Inc()
+		invalidResponseCacheEntryLogger.Warnf("cannot unmarshal cached response; treating it as cache miss: %s", err)
+		getResponseCache().Del(key)
+		responseCacheMisses.Inc()
+		return false
+	}
+	if h == nil {
+		// The cached response has been expired.
+		responseCacheMisses.Inc()
+		return false
+	}
+	responseCacheHits.Inc()
+
+	dst := w.Header()
+	for k, vs := range h {
+		dst[k] = vs
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+	return true
+}
+
+func marshalCachedResponse(dst []byte, deadline time.Time, h http.Header, body []byte) []byte {
+	dst = encoding.MarshalUint64(dst, uint64(deadline.UnixMilli()))
+	dst = encoding.MarshalVarUint64(dst, uint64(len(h)))
+	for k, vs := range h {
+		dst = encoding.MarshalBytes(dst, []byte(k))
+		dst = encoding.MarshalVarUint64(dst, uint64(len(vs)))
+		for _, v := range vs {
+			dst = encoding.MarshalBytes(dst, []byte(v))
+		}
+	}
+	dst = append(dst, body...)
+	return dst
+}
+
+// unmarshalCachedResponse unmarshals the response marshaled with marshalCachedResponse from src.
+//
+// nil headers are returned if the response is expired.
+func unmarshalCachedResponse(src []byte) (http.Header, []byte, error) {
+	if len(src) < 8 {
+		return nil, nil, fmt.Errorf("too short data; got %d bytes; want at least 8 bytes", len(src))
+	}
+	deadline := int64(encoding.UnmarshalUint64(src))
+	src = src[8:]
+	if time.Now().UnixMilli() > deadline {
+		return nil, nil, nil
+	}
+
+	headersLen, n := encoding.UnmarshalVarUint64(src)
+	if n <= 0 {
+		return nil, nil, fmt.Errorf("cannot unmarshal the number of headers")
+	}
+	src = src[n:]
+	h := make(http.Header, headersLen)
+	for range headersLen {
+		k, n := encoding.UnmarshalBytes(src)
+		if n <= 0 {
+			return nil, nil, fmt.Errorf("cannot unmarshal header name")
+		}
+		src = src[n:]
+		valuesLen, n := encoding.UnmarshalVarUint64(src)
+		if n <= 0 {
+			return nil, nil, fmt.Errorf("cannot unmarshal the number of values for header %q", k)
+		}
+		src = src[n:]
+		vs := make([]string, 0, valuesLen)
+		for range valuesLen {
+			v, n := encoding.UnmarshalBytes(src)
+			if n <= 0 {
+				return nil, nil, fmt.Errorf("cannot unmarshal value for header %q", k)
+			}
+			src = src[n:]
+			vs = append(vs, string(v))
+		}
+		h[string(k)] = vs
+	}
+	return h, src, nil
+}
+
+// responseCacheWriter is a wrapper around http.ResponseWriter, which collects the response for storing it in the response cache.
+type responseCacheWriter struct {
+	http.ResponseWriter
+
+	key []byte
+	ttl time.Duration
+
+	statusCode int
+	header     http.Header
+	body       []byte
+
+	// tooBig is set to true if the response body exceeds -responseCacheMaxEntrySize.
+	tooBig bool
+}
+
+func newResponseCacheWriter(w http.ResponseWriter, key []byte, ttl time.Duration) *responseCacheWriter {
+	return &responseCacheWriter{
+		ResponseWriter: w,
+		key:            key,
+		ttl:            ttl,
+	}
+}
+
+// WriteHeader implements http.ResponseWriter interface.
+func (rcw *responseCacheWriter) WriteHeader(statusCode int) {
+	if rcw.statusCode == 0 {
+		rcw.statusCode = statusCode
+		rcw.header = rcw.Header().Clone()
+	}
+	rcw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter interface.
+func (rcw *responseCacheWriter) Write(p []byte) (int, error) {
+	if rcw.statusCode == 0 {
+		rcw.WriteHeader(http.StatusOK)
+	}
+	if rcw.statusCode == http.StatusOK && !rcw.tooBig {
+		if len(rcw.body)+len(p) > responseCacheMaxEntrySize.IntN() {
+			rcw.tooBig = true
+			rcw.body = nil
+		} else {
+			rcw.body = append(rcw.body, p...)
+		}
+	}
+	return rcw.ResponseWriter.Write(p)
+}
+
+// Flush implements net/http.Flusher interface
+//
+// This is needed for the copyStreamToClient()
+func (rcw *responseCacheWriter) Flush() {
+	flusher, ok := rcw.ResponseWriter.(http.Flusher)
+	if !ok {
+		logger.Panicf("BUG: it is expected http.ResponseWriter (%T) supports http.Flusher interface", rcw.ResponseWriter)
+	}
+	flusher.Flush()
+}
+
+// Unwrap returns the original ResponseWriter wrapped by rcw.
+//
+// This is needed for the net/http.ResponseController - see https://pkg.go.dev/net/http#NewResponseController
+func (rcw *responseCacheWriter) Unwrap() http.ResponseWriter {
+	return rcw.ResponseWriter
+}
+
+// storeResponse stores the fully proxied response at the response cache.
+func (rcw *responseCacheWriter) storeResponse() {
+	if rcw.statusCode != http.StatusOK || rcw.tooBig {
+		return
+	}
+	if len(rcw.header.Values("Set-Cookie")) > 0 {
+		return
+	}
+	cc := rcw.header.Get("Cache-Control")
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "no-cache") {
+		return
+	}
+	h := rcw.header.Clone()
+	h.Del("Date")
+	h.Del("Content-Length")
+
+	deadline := time.Now().Add(rcw.ttl)
+	data := marshalCachedResponse(nil, deadline, h, rcw.body)
+	getResponseCache().SetBig(rcw.key, data)
+}
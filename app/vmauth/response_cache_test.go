@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsAlignedQueryRange(t *testing.T) {
+	f := func(query string, resultExpected bool) {
+		t.Helper()
+
+		args, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("cannot parse query %q: %s", query, err)
+		}
+		result := isAlignedQueryRange(args)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %v; want %v", query, result, resultExpected)
+		}
+	}
+
+	// missing step
+	f(``, true)
+	f(`query=up&time=1700000001`, true)
+
+	// aligned start and end
+	f(`query=up&start=1699999980&end=1700003580&step=60`, true)
+	f(`query=up&start=1699999980&end=1700003580&step=1m`, true)
+	f(`query=up&start=2023-11-14T22:13:20Z&end=2023-11-14T23:13:20Z&step=20s`, true)
+	f(`query=up&start=1700000000.5&end=1700000001.5&step=0.5`, true)
+
+	// unaligned start or end
+	f(`query=up&start=1700000001&end=1700003600&step=60`, false)
+	f(`query=up&start=1699999980&end=1700003581&step=1m`, false)
+
+	// missing or invalid start and end
+	f(`query=up&step=60`, false)
+	f(`query=up&start=1700000000&step=60`, false)
+	f(`query=up&start=foo&end=1700003600&step=60`, false)
+
+	// invalid step
+	f(`query=up&start=1700000000&end=1700003600&step=foo`, false)
+	f(`query=up&start=1700000000&end=1700003600&step=0`, false)
+}
+
+func TestMarshalUnmarshalCachedResponse(t *testing.T) {
+	h := http.Header{
+		"Content-Type":     {"application/json"},
+		"Content-Encoding": {"gzip"},
+		"X-Multi":          {"a", "b"},
+	}
+	body := []byte(`{"status":"success"}`)
+
+	data := marshalCachedResponse(nil, time.Now().Add(time.Hour), h, body)
+	hResult, bodyResult, err := unmarshalCachedResponse(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(hResult, h) {
+		t.Fatalf("unexpected headers; got %v; want %v", hResult, h)
+	}
+	if !bytes.Equal(bodyResult, body) {
+		t.Fatalf("unexpected body; got %q; want %q", bodyResult, body)
+	}
+
+	// expired response
+	data = marshalCachedResponse(nil, time.Now().Add(-time.Second), h, body)
+	hResult, _, err = unmarshalCachedResponse(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if hResult != nil {
+		t.Fatalf("expecting nil headers for expired response; got %v", hResult)
+	}
+
+	// invalid data
+	if _, _, err := unmarshalCachedResponse([]byte("foo")); err == nil {
+		t.Fatalf("expecting non-nil error for invalid data")
+	}
+}
+
+func TestGetResponseCacheKey(t *testing.T) {
+	getKey := func(method, requestURL, body string, header http.Header, hc HeadersConf, userName string) []byte {
+		t.Helper()
+
+		r, err := http.NewRequest(method, requestURL, nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		if header != nil {
+			r.Header = header
+		}
+		if body != "" {
+			r.Body = newBufferedBody(nil, []byte(body), 1024)
+		}
+		return getResponseCacheKey(r, r.URL, hc, userName)
+	}
+	formHeader := http.Header{
+		"Content-Type": {"application/x-www-form-urlencoded"},
+	}
+
+	key := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", nil, HeadersConf{}, "foo")
+	if key == nil {
+		t.Fatalf("expecting non-nil key")
+	}
+
+	// The same key for reordered query args
+	if k := getKey("GET", "http://other-backend/api/v1/labels?match[]=up&start=1", "", nil, HeadersConf{}, "foo"); !bytes.Equal(k, key) {
+		t.Fatalf("expecting the same key for reordered query args")
+	}
+
+	// POST requests with url-encoded form are cached under distinct keys
+	if k := getKey("POST", "http://backend/api/v1/labels?start=1", "match[]=up", formHeader, HeadersConf{}, "foo"); k == nil || bytes.Equal(k, key) {
+		t.Fatalf("expecting non-nil key for POST request, which differs from GET request key")
+	}
+	k1 := getKey("POST", "http://backend/api/v1/labels?start=1", "match[]=up", formHeader, HeadersConf{}, "foo")
+	k2 := getKey("POST", "http://backend/api/v1/labels", "match[]=up&start=1", formHeader, HeadersConf{}, "foo")
+	if !bytes.Equal(k1, k2) {
+		t.Fatalf("expecting the same key for args passed via query string and via POST form")
+	}
+
+	// Different keys for different users, query args, headers and request headers from the config
+	if k := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", nil, HeadersConf{}, "bar"); bytes.Equal(k, key) {
+		t.Fatalf("expecting different keys for different users")
+	}
+	if k := getKey("GET", "http://backend/api/v1/labels?start=2&match[]=up", "", nil, HeadersConf{}, "foo"); bytes.Equal(k, key) {
+		t.Fatalf("expecting different keys for different query args")
+	}
+	if k := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", http.Header{"Accept-Encoding": {"gzip"}}, HeadersConf{}, "foo"); bytes.Equal(k, key) {
+		t.Fatalf("expecting different keys for different Accept-Encoding headers")
+	}
+	kJSON := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", http.Header{"Accept": {"application/json"}}, HeadersConf{}, "foo")
+	kNDJSON := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", http.Header{"Accept": {"application/x-ndjson"}}, HeadersConf{}, "foo")
+	if bytes.Equal(kJSON, key) || bytes.Equal(kJSON, kNDJSON) {
+		t.Fatalf("expecting different keys for different Accept headers")
+	}
+	if k := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", http.Header{"X-Custom": {"foo"}}, HeadersConf{}, "foo"); bytes.Equal(k, key) {
+		t.Fatalf("expecting different keys for different forwarded headers")
+	}
+	hc := HeadersConf{
+		RequestHeaders: []*Header{{Name: "X-Scope-OrgID", Value: "42"}},
+	}
+	if k := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", nil, hc, "foo"); bytes.Equal(k, key) {
+		t.Fatalf("expecting different keys for different request headers from the config")
+	}
+
+	// Request headers from the config override client headers
+	kConfig := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", nil, hc, "foo")
+	if k := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", http.Header{"X-Scope-Orgid": {"1"}}, hc, "foo"); !bytes.Equal(k, kConfig) {
+		t.Fatalf("expecting the same key when the client header is overridden by the config")
+	}
+	hcDelete := HeadersConf{
+		RequestHeaders: []*Header{{Name: "X-Custom", Value: ""}},
+	}
+	if k := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", http.Header{"X-Custom": {"foo"}}, hcDelete, "foo"); !bytes.Equal(k, key) {
+		t.Fatalf("expecting the same key when the client header is removed by the config")
+	}
+
+	// Headers, which don't affect the response, are ignored
+	ignoredHeader := http.Header{
+		"User-Agent":        {"Grafana/12.0"},
+		"X-Forwarded-For":   {"1.2.3.4"},
+		"X-Grafana-Org-Id":  {"1"},
+		"Sec-Fetch-Mode":    {"cors"},
+		"Traceparent":       {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		"Connection":        {"keep-alive"},
+		"X-Dashboard-Uid":   {"abc"},
+		"X-Forwarded-Proto": {"https"},
+	}
+	if k := getKey("GET", "http://backend/api/v1/labels?start=1&match[]=up", "", ignoredHeader, HeadersConf{}, "foo"); !bytes.Equal(k, key) {
+		t.Fatalf("expecting the same key for requests with headers, which don't affect the response")
+	}
+
+	// Non-cacheable requests
+	f := func(method, requestURL, body string, header http.Header) {
+		t.Helper()
+		if k := getKey(method, requestURL, body, header, HeadersConf{}, "foo"); k != nil {
+			t.Fatalf("expecting nil key for %s %s", method, requestURL)
+		}
+	}
+	f("PUT", "http://backend/api/v1/labels", "", nil)
+	f("POST", "http://backend/api/v1/write", "foo bar", http.Header{"Content-Type": {"text/plain"}})
+	f("GET", "http://backend/api/v1/labels", "", http.Header{"Cache-Control": {"no-cache"}})
+	f("GET", "http://backend/api/v1/labels?nocache=1", "", nil)
+	f("GET", "http://backend/api/v1/query_range?query=up&start=1700000001&end=1700003600&step=60", "", nil)
+	f("POST", "http://backend/api/v1/query_range", "query=up&start=1700000001&end=1700003600&step=60", formHeader)
+}
+
+func TestRequestHandlerResponseCache(t *testing.T) {
+	var backendRequests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := backendRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("fail") == "1" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		fmt.Fprintf(w, `{"path":%q,"n":%d}`, r.URL.Path, n)
+	}))
+	defer ts.Close()
+
+	cfgOrigP := authConfigData.Load()
+	cfgStr := strings.ReplaceAll(`
+users:
+- username: foo
+  password: bar
+  url_map:
+  - src_paths: ["/api/v1/labels", "/api/v1/query_range"]
+    url_prefix: {BACKEND}
+    response_cache_ttl: 1h
+  - src_paths: ["/api/v1/query"]
+    url_prefix: {BACKEND}
+`, "{BACKEND}", ts.URL)
+	if _, err := reloadAuthConfigData([]byte(cfgStr)); err != nil {
+		t.Fatalf("cannot load config data: %s", err)
+	}
+	defer func() {
+		cfgOrig := []byte("unauthorized_user:\n  url_prefix: http://foo/bar")
+		if cfgOrigP != nil {
+			cfgOrig = *cfgOrigP
+		}
+		if _, err := reloadAuthConfigData(cfgOrig); err != nil {
+			t.Fatalf("cannot load the original config: %s", err)
+		}
+	}()
+
+	fWithHeader := func(requestURL string, header http.Header, responseExpected string) {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodGet, requestURL, nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		for k, vs := range header {
+			r.Header[k] = vs
+		}
+		r.RequestURI = r.URL.RequestURI()
+		r.RemoteAddr = "42.2.3.84:6789"
+		r.SetBasicAuth("foo", "bar")
+
+		w := &fakeResponseWriter{}
+		if !requestHandler(w, r) {
+			t.Fatalf("unexpected false is returned from requestHandler")
+		}
+		response := strings.TrimSpace(w.getResponse())
+		responseExpected = strings.TrimSpace(responseExpected)
+		if response != responseExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", response, responseExpected)
+		}
+	}
+	f := func(requestURL, responseExpected string) {
+		t.Helper()
+		fWithHeader(requestURL, nil, responseExpected)
+	}
+
+	// The second response must be served from the cache
+	f("http://some-host.com/api/v1/labels?match[]=up&start=1", `
+statusCode=200
+{"path":"/api/v1/labels","n":1}`)
+	f("http://some-host.com/api/v1/labels?start=1&match[]=up", `
+statusCode=200
+{"path":"/api/v1/labels","n":1}`)
+
+	// Different query args aren't served from the cache
+	f("http://some-host.com/api/v1/labels?match[]=up&start=2", `
+statusCode=200
+{"path":"/api/v1/labels","n":2}`)
+
+	// Unaligned query_range isn't cached
+	f("http://some-host.com/api/v1/query_range?query=up&start=1700000001&end=1700003600&step=60", `
+statusCode=200
+{"path":"/api/v1/query_range","n":3}`)
+	f("http://some-host.com/api/v1/query_range?query=up&start=1700000001&end=1700003600&step=60", `
+statusCode=200
+{"path":"/api/v1/query_range","n":4}`)
+
+	// Aligned query_range is cached
+	f("http://some-host.com/api/v1/query_range?query=up&start=1699999980&end=1700003580&step=60", `
+statusCode=200
+{"path":"/api/v1/query_range","n":5}`)
+	f("http://some-host.com/api/v1/query_range?query=up&start=1699999980&end=1700003580&step=60", `
+statusCode=200
+{"path":"/api/v1/query_range","n":5}`)
+
+	// Error responses aren't cached
+	f("http://some-host.com/api/v1/labels?fail=1", `
+statusCode=400
+{"path":"/api/v1/labels","n":6}`)
+	f("http://some-host.com/api/v1/labels?fail=1", `
+statusCode=400
+{"path":"/api/v1/labels","n":7}`)
+
+	// Responses for url_map without response_cache_ttl aren't cached
+	f("http://some-host.com/api/v1/query?query=up", `
+statusCode=200
+{"path":"/api/v1/query","n":8}`)
+	f("http://some-host.com/api/v1/query?query=up", `
+statusCode=200
+{"path":"/api/v1/query","n":9}`)
+
+	// The cached JSON response for aligned query_range isn't served to NDJSON requests
+	ndjsonHeader := http.Header{"Accept": {"application/x-ndjson"}}
+	fWithHeader("http://some-host.com/api/v1/query_range?query=up&start=1699999980&end=1700003580&step=60", ndjsonHeader, `
+statusCode=200
+{"path":"/api/v1/query_range","n":10}`)
+	fWithHeader("http://some-host.com/api/v1/query_range?query=up&start=1699999980&end=1700003580&step=60", ndjsonHeader, `
+statusCode=200
+{"path":"/api/v1/query_range","n":10}`)
+	f("http://some-host.com/api/v1/query_range?query=up&start=1699999980&end=1700003580&step=60", `
+statusCode=200
+{"path":"/api/v1/query_range","n":5}`)
+}
+
+func TestWriteCachedResponseInvalidEntry(t *testing.T) {
+	key := []byte("invalid-entry-key")
+	getResponseCache().SetBig(key, []byte("foo"))
+
+	invalidEntries := responseCacheInvalidEntries.Get()
+	w := &fakeResponseWriter{}
+	if writeCachedResponse(w, key) {
+		t.Fatalf("expecting false result for invalid cache entry")
+	}
+	if n := responseCacheInvalidEntries.Get() - invalidEntries; n != 1 {
+		t.Fatalf("unexpected number of invalid entries; got %d; want 1", n)
+	}
+	if data := getResponseCache().GetBig(nil, key); len(data) > 0 {
+		t.Fatalf("expecting invalid entry to be deleted from the cache; got %q", data)
+	}
+}
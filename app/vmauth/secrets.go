@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/secretprovider"
+)
+
+// resolveSecretRefs replaces secret references in password, bearer_token and auth_token of ui with their current values.
+//
+// The obtained values are stored in secrets, so they could be checked for changes later via AuthConfig.secretsChanged.
+// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#secret-references
+func (ui *UserInfo) resolveSecretRefs(secrets map[string]string) error {
+	fields := []struct {
+		name string
+		p    *string
+	}{
+		{"password", &ui.Password},
+		{"bearer_token", &ui.BearerToken},
+		{"auth_token", &ui.AuthToken},
+	}
+	for _, f := range fields {
+		if !secretprovider.IsRef(*f.p) {
+			continue
+		}
+		ref, err := secretprovider.ParseRef(*f.p)
+		if err != nil {
+			return fmt.Errorf("cannot parse %s for user %q: %w", f.name, ui.name(), err)
+		}
+		v, err := ref.Get()
+		if err != nil {
+			return fmt.Errorf("cannot obtain %s for user %q: %w", f.name, ui.name(), err)
+		}
+		secrets[ref.String()] = v
+		*f.p = v
+	}
+	return nil
+}
+
+// secretsChanged returns true if values for secret references in ac were changed since ac was loaded.
+func (ac *AuthConfig) secretsChanged() bool {
+	if ac == nil {
+		return false
+	}
+	for s, v := range ac.secrets {
+		vNew, err := secretprovider.Get(s)
+		if err != nil {
+			logger.Errorf("cannot refresh secret %s referred in -auth.config=%q: %s", s, *authConfigPath, err)
+			continue
+		}
+		if vNew != v {
+			return true
+		}
+	}
+	return false
+}
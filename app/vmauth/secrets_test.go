@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/secretprovider"
+)
+
+type testSecretProvider struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (tsp *testSecretProvider) GetSecret(path, key string) (string, error) {
+	tsp.mu.Lock()
+	defer tsp.mu.Unlock()
+
+	v, ok := tsp.values[path+"#"+key]
+	if !ok {
+		return "", fmt.Errorf("missing secret %s#%s", path, key)
+	}
+	return v, nil
+}
+
+func (tsp *testSecretProvider) set(k, v string) {
+	tsp.mu.Lock()
+	tsp.values[k] = v
+	tsp.mu.Unlock()
+}
+
+var testSecrets = func() *testSecretProvider {
+	tsp := &testSecretProvider{
+		values: make(map[string]string),
+	}
+	secretprovider.RegisterProvider("vmauth-test", tsp)
+	return tsp
+}()
+
+func TestParseAuthConfigSecretRefsFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		if _, err := parseAuthConfig([]byte(s)); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// unknown provider
+	f(`
+users:
+- bearer_token: secret://foobar/some/path#token
+  url_prefix: http://foo.bar
+`)
+
+	// missing key
+	f(`
+users:
+- username: foo
+  password: secret://vmauth-test/some/path
+  url_prefix: http://foo.bar
+`)
+
+	// missing secret
+	f(`
+users:
+- auth_token: secret://vmauth-test/missing#token
+  url_prefix: http://foo.bar
+`)
+}
+
+func TestReloadAuthConfigDataSecretRefs(t *testing.T) {
+	// Disable caching of secret values, so rotated secrets are detected immediately.
+	refreshIntervalOrig := secretprovider.RefreshInterval()
+	if err := flag.Set("secret.refreshInterval", "0"); err != nil {
+		t.Fatalf("cannot set -secret.refreshInterval: %s", err)
+	}
+	defer func() {
+		if err := flag.Set("secret.refreshInterval", refreshIntervalOrig.String()); err != nil {
+			t.Fatalf("cannot restore -secret.refreshInterval: %s", err)
+		}
+	}()
+
+	testSecrets.set("creds#token", "token1")
+	testSecrets.set("creds#password", "password1")
+
+	cfgOrigP := authConfigData.Load()
+	cfgStr := `
+users:
+- bearer_token: secret://vmauth-test/creds#token
+  url_prefix: http://foo.bar
+- username: foo
+  password: secret://vmauth-test/creds#password
+  url_prefix: http://foo.bar
+`
+	if _, err := reloadAuthConfigData([]byte(cfgStr)); err != nil {
+		t.Fatalf("cannot load config data: %s", err)
+	}
+	defer func() {
+		cfgOrig := []byte("unauthorized_user:\n  url_prefix: http://foo/bar")
+		if cfgOrigP != nil {
+			cfgOrig = *cfgOrigP
+		}
+		if _, err := reloadAuthConfigData(cfgOrig); err != nil {
+			t.Fatalf("cannot load the original config: %s", err)
+		}
+	}()
+
+	f := func(authTokens []string, reloadExpected bool) {
+		t.Helper()
+
+		ok, err := reloadAuthConfigData([]byte(cfgStr))
+		if err != nil {
+			t.Fatalf("cannot reload config data: %s", err)
+		}
+		if ok != reloadExpected {
+			t.Fatalf("unexpected reload result; got %v; want %v", ok, reloadExpected)
+		}
+		m := *authUsers.Load()
+		if len(m) != len(authTokens) {
+			t.Fatalf("unexpected number of auth tokens; got %d; want %d", len(m), len(authTokens))
+		}
+		for _, at := range authTokens {
+			if m[at] == nil {
+				t.Fatalf("missing user for auth token %q", at)
+			}
+		}
+	}
+
+	// The config mustn't be reloaded if neither the config nor the secrets are changed.
+	f([]string{
+		getHTTPAuthBearerToken("token1"),
+		getHTTPAuthBasicToken("token1", ""),
+		getHTTPAuthBasicToken("foo", "password1"),
+	}, false)
+
+	// The config must be reloaded after the secrets rotation.
+	testSecrets.set("creds#token", "token2")
+	f([]string{
+		getHTTPAuthBearerToken("token2"),
+		getHTTPAuthBasicToken("token2", ""),
+		getHTTPAuthBasicToken("foo", "password1"),
+	}, true)
+
+	testSecrets.set("creds#password", "password2")
+	f([]string{
+		getHTTPAuthBearerToken("token2"),
+		getHTTPAuthBasicToken("token2", ""),
+		getHTTPAuthBasicToken("foo", "password2"),
+	}, true)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var maxConcurrentShadowRequests = flag.Int("maxConcurrentShadowRequests", 100, "The maximum number of concurrent requests vmauth can send to shadow backends. "+
+	"Requests exceeding this limit aren't mirrored to shadow backends. See https://docs.victoriametrics.com/victoriametrics/vmauth/#shadow-traffic")
+
+var shadowErrorLogger = logger.WithThrottler("shadowRequestError", 5*time.Second)
+
+var (
+	shadowRequests        = metrics.NewCounter(`vmauth_shadow_requests_total`)
+	shadowRequestErrors   = metrics.NewCounter(`vmauth_shadow_request_errors_total`)
+	shadowRequestsSkipped = metrics.NewCounter(`vmauth_shadow_requests_skipped_total`)
+)
+
+// shadowConfig contains the config for mirroring requests to a shadow backend.
+type shadowConfig struct {
+	// url is the shadow backend url.
+	url *url.URL
+
+	// percent is the percent of requests to mirror to the shadow backend.
+	percent float64
+}
+
+// newShadowConfig returns shadow config for the given shadow_url and shadow_percent options.
+//
+// nil is returned if shadowURL is empty.
+func newShadowConfig(shadowURL string, shadowPercent *float64) (*shadowConfig, error) {
+	if shadowURL == "" {
+		if shadowPercent != nil {
+			return nil, fmt.Errorf("shadow_percent cannot be set without shadow_url")
+		}
+		return nil, nil
+	}
+	u, err := url.Parse(shadowURL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse shadow_url=%q: %w", shadowURL, err)
+	}
+	u, err = sanitizeURLPrefix(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shadow_url=%q: %w", shadowURL, err)
+	}
+	percent := 100.0
+	if shadowPercent != nil {
+		percent = *shadowPercent
+		if percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("shadow_percent must be in the range (0..100]; got %v", percent)
+		}
+	}
+	return &shadowConfig{
+		url:     u,
+		percent: percent,
+	}, nil
+}
+
+var (
+	shadowConcurrencyLimitCh   chan struct{}
+	shadowConcurrencyLimitOnce sync.Once
+)
+
+func getShadowConcurrencyLimitCh() chan struct{} {
+	shadowConcurrencyLimitOnce.Do(func() {
+		shadowConcurrencyLimitCh = make(chan struct{}, *maxConcurrentShadowRequests)
+	})
+	return shadowConcurrencyLimitCh
+}
+
+// mirrorRequest asynchronously sends a copy of r to the shadow backend if needed.
+//
+// The response from the shadow backend is discarded.
+func (sc *shadowConfig) mirrorRequest(r *http.Request, u *url.URL, up *URLPrefix, hc HeadersConf, ui *UserInfo) {
+	if sc == nil || rand.Float64()*100 >= sc.percent {
+		return
+	}
+	if !canHedgeRequest(r) {
+		// The request may modify the backend state or its body isn't fully buffered, so it cannot be sent to multiple backends.
+		shadowRequestsSkipped.Inc()
+		return
+	}
+	limitCh := getShadowConcurrencyLimitCh()
+	select {
+	case limitCh <- struct{}{}:
+	default:
+		shadowRequestsSkipped.Inc()
+		return
+	}
+
+	targetURL := mergeURLs(sc.url, u, up.dropSrcPathPrefixParts, up.mergeQueryArgs)
+	ctx, cancel := context.WithTimeout(context.Background(), *responseTimeout)
+	req := newBackendRequest(r, targetURL, hc).WithContext(ctx)
+	if r.Body != nil {
+		req.Body = newHedgeRequestBody(r)
+	}
+
+	shadowRequests.Inc()
+	go func() {
+		defer func() {
+			cancel()
+			<-limitCh
+		}()
+
+		res, err := ui.rt.RoundTrip(req)
+		if err != nil {
+			shadowRequestErrors.Inc()
+			shadowErrorLogger.Warnf("cannot mirror request to shadow backend %s: %s", targetURL.Redacted(), err)
+			return
+		}
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+		if res.StatusCode >= 500 {
+			shadowRequestErrors.Inc()
+		}
+	}()
+}
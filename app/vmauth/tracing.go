@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
+)
+
+var (
+	accessLogOTLPEndpoint = flag.String("accessLog.otlpEndpoint", "", "Optional OTLP/HTTP endpoint for exporting access logs in OpenTelemetry format in addition to stderr. "+
+		"For example, -accessLog.otlpEndpoint=http://otel-collector:4318/v1/logs . Access logs are written only for users with access_log section in -auth.config. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmauth/#access-log")
+	accessLogOTLPHeader = flagutil.NewArrayString("accessLog.otlpHeader", "Optional HTTP request header to send to -accessLog.otlpEndpoint . "+
+		"For example, -accessLog.otlpHeader='Authorization: Bearer foobar' adds 'Authorization: Bearer foobar' header to every request to -accessLog.otlpEndpoint")
+)
+
+var accessLogExporter *tracing.LogExporter
+
+func initAccessLogExporter() {
+	if *accessLogOTLPEndpoint == "" {
+		return
+	}
+	le, err := tracing.NewLogExporter(*accessLogOTLPEndpoint, *accessLogOTLPHeader, "vmauth")
+	if err != nil {
+		logger.Fatalf("cannot initialize exporter for -accessLog.otlpEndpoint: %s", err)
+	}
+	accessLogExporter = le
+}
+
+func stopAccessLogExporter() {
+	if accessLogExporter != nil {
+		accessLogExporter.Stop()
+		accessLogExporter = nil
+	}
+}
+
+// exportAccessLog sends access log record for r to -accessLog.otlpEndpoint if it is set.
+func exportAccessLog(r *http.Request, userName string, statusCode int, duration time.Duration, span *tracing.Span) {
+	if accessLogExporter == nil {
+		return
+	}
+	lr := &tracing.LogRecord{
+		Timestamp: time.Now(),
+		Severity:  "INFO",
+		Body:      "access_log",
+		Attributes: []tracing.Attribute{
+			tracing.String("request_host", r.Host),
+			tracing.String("request_uri", httpserver.GetRequestURI(r)),
+			tracing.Int("status_code", int64(statusCode)),
+			tracing.String("remote_addr", r.RemoteAddr),
+			tracing.String("user_agent", r.UserAgent()),
+			tracing.String("referer", r.Referer()),
+			tracing.Int("duration_ms", duration.Milliseconds()),
+			tracing.String("username", userName),
+		},
+		SpanContext: span.SpanContext(),
+	}
+	accessLogExporter.Export(lr)
+}
+
+// startRequestSpan starts the span for the request r from the user with the given userName.
+//
+// nil is returned if tracing is disabled. See https://docs.victoriametrics.com/victoriametrics/vmauth/#tracing
+func startRequestSpan(r *http.Request, userName string) *tracing.Span {
+	span := tracing.StartRequestSpan(r, "vmauth.request")
+	span.SetAttributes(
+		tracing.String("http.request.method", r.Method),
+		tracing.String("url.path", r.URL.Path),
+		tracing.String("client.address", r.RemoteAddr),
+		tracing.String("user.name", userName),
+	)
+	return span
+}
+
+// startBackendRequestSpan starts the child span of span for the request to the given backend.
+func startBackendRequestSpan(span *tracing.Span, bu *backendURL, attempt int, isLocalRetry bool) *tracing.Span {
+	bs := span.NewChild("vmauth.backend_request", tracing.SpanKindClient)
+	bs.SetAttributes(
+		tracing.String("server.address", bu.url.Host),
+		tracing.Int("vmauth.attempt", int64(attempt)),
+		tracing.String("vmauth.local_retry", strconv.FormatBool(isLocalRetry)),
+	)
+	return bs
+}
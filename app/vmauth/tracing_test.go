@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
+)
+
+func TestRequestHandlerTracing(t *testing.T) {
+	var spansRequests atomic.Int64
+	otlpServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		spansRequests.Add(1)
+	}))
+	defer otlpServer.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get(tracing.TraceparentHeader))
+	}))
+	defer ts.Close()
+
+	cfgOrigP := authConfigData.Load()
+	cfgStr := strings.ReplaceAll(`
+unauthorized_user:
+  url_prefix: {BACKEND}/foo
+`, "{BACKEND}", ts.URL)
+	if _, err := reloadAuthConfigData([]byte(cfgStr)); err != nil {
+		t.Fatalf("cannot load config data: %s", err)
+	}
+	defer func() {
+		cfgOrig := []byte("unauthorized_user:\n  url_prefix: http://foo/bar")
+		if cfgOrigP != nil {
+			cfgOrig = *cfgOrigP
+		}
+		if _, err := reloadAuthConfigData(cfgOrig); err != nil {
+			t.Fatalf("cannot load the original config: %s", err)
+		}
+	}()
+
+	f := func(traceparent string) string {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodGet, "http://some-host.com/api/v1/query", nil)
+		if err != nil {
+			t.Fatalf("cannot initialize http request: %s", err)
+		}
+		r.RequestURI = r.URL.RequestURI()
+		r.RemoteAddr = "42.2.3.84:6789"
+		if traceparent != "" {
+			r.Header.Set(tracing.TraceparentHeader, traceparent)
+		}
+
+		w := &fakeResponseWriter{}
+		if !requestHandler(w, r) {
+			t.Fatalf("unexpected false is returned from requestHandler")
+		}
+		response := w.getResponse()
+		if !strings.HasPrefix(response, "statusCode=200\n") {
+			t.Fatalf("unexpected response: %q", response)
+		}
+		return strings.TrimPrefix(response, "statusCode=200\n")
+	}
+
+	// The incoming traceparent is proxied as is when tracing is disabled.
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := f(incoming); got != incoming {
+		t.Fatalf("unexpected traceparent at the backend; got %q; want %q", got, incoming)
+	}
+
+	if err := flag.Set("tracing.otlpEndpoint", otlpServer.URL); err != nil {
+		t.Fatalf("cannot set -tracing.otlpEndpoint: %s", err)
+	}
+	defer func() {
+		_ = flag.Set("tracing.otlpEndpoint", "")
+	}()
+	tracing.Init("vmauth")
+
+	// The trace from the incoming traceparent must be continued at the backend.
+	got := f(incoming)
+	sc, err := tracing.ParseTraceparent(got)
+	if err != nil {
+		t.Fatalf("cannot parse traceparent at the backend %q: %s", got, err)
+	}
+	if traceID := sc.TraceID.String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected trace id at the backend; got %q", traceID)
+	}
+	if spanID := sc.SpanID.String(); spanID == "00f067aa0ba902b7" {
+		t.Fatalf("the backend must receive span id for the request from vmauth")
+	}
+	if !sc.Sampled {
+		t.Fatalf("the sampled flag must be propagated to the backend")
+	}
+
+	// A new trace must be started for requests without traceparent.
+	got = f("")
+	if _, err := tracing.ParseTraceparent(got); err != nil {
+		t.Fatalf("cannot parse traceparent at the backend %q: %s", got, err)
+	}
+
+	tracing.Stop()
+	if n := spansRequests.Load(); n != 1 {
+		t.Fatalf("unexpected number of requests to OTLP endpoint; got %d; want 1", n)
+	}
+}
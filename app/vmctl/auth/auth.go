@@ -8,12 +8,16 @@ import (
 	"sync"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 )
 
 // HTTPClientConfig represents http client config.
 type HTTPClientConfig struct {
 	BasicAuth   *BasicAuthConfig
 	BearerToken string
+	AzureAD     *promauth.AzureADConfig
+	GoogleIAM   *promauth.GoogleIAMConfig
 	Headers     string
 }
 
@@ -22,6 +26,8 @@ func (hcc *HTTPClientConfig) NewConfig() (*Config, error) {
 	opts := &Options{
 		BasicAuth:   hcc.BasicAuth,
 		BearerToken: hcc.BearerToken,
+		AzureAD:     hcc.AzureAD,
+		GoogleIAM:   hcc.GoogleIAM,
 		Headers:     hcc.Headers,
 	}
 	return opts.NewConfig()
@@ -68,6 +74,45 @@ func WithBearer(token string) ConfigOptions {
 	}
 }
 
+// WithAzureAD returns AuthConfigOptions and set Azure AD params based on given params
+func WithAzureAD(useManagedIdentity, useWorkloadIdentity bool, clientID, tenantID, cloud, scope string) ConfigOptions {
+	return func(config *HTTPClientConfig) {
+		if !useManagedIdentity && !useWorkloadIdentity {
+			return
+		}
+		config.AzureAD = &promauth.AzureADConfig{
+			Cloud: cloud,
+			Scope: scope,
+		}
+		if useManagedIdentity {
+			config.AzureAD.ManagedIdentity = &promauth.AzureManagedIdentityConfig{
+				ClientID: clientID,
+			}
+		}
+		if useWorkloadIdentity {
+			config.AzureAD.WorkloadIdentity = &promauth.AzureWorkloadIdentityConfig{
+				ClientID: clientID,
+				TenantID: tenantID,
+			}
+		}
+	}
+}
+
+// WithGoogleIAM returns AuthConfigOptions and set Google IAM params based on given params
+func WithGoogleIAM(enabled bool, credentialsFile, scopes string) ConfigOptions {
+	return func(config *HTTPClientConfig) {
+		if !enabled {
+			return
+		}
+		config.GoogleIAM = &promauth.GoogleIAMConfig{
+			CredentialsFile: credentialsFile,
+		}
+		if scopes != "" {
+			config.GoogleIAM.Scopes = strings.Split(scopes, ";")
+		}
+	}
+}
+
 // WithHeaders returns AuthConfigOptions and set Headers based on the given params
 func WithHeaders(headers string) ConfigOptions {
 	return func(config *HTTPClientConfig) {
@@ -149,6 +194,24 @@ func (ac *authContext) initFromBearerToken(bearerToken string) error {
 	return nil
 }
 
+// initFromPromauthOptions initializes ac from the token sources supported by lib/promauth, such as azuread and google_iam.
+func (ac *authContext) initFromPromauthOptions(opts *promauth.Options) error {
+	pac, err := opts.NewConfig()
+	if err != nil {
+		return err
+	}
+	ac.getAuthHeader = func() string {
+		ah, err := pac.GetAuthHeader()
+		if err != nil {
+			logger.Errorf("cannot obtain auth header: %s", err)
+			return ""
+		}
+		return ah
+	}
+	ac.authDigest = pac.String()
+	return nil
+}
+
 // Options contain options, which must be passed to NewConfig.
 type Options struct {
 	// BasicAuth contains optional BasicAuthConfig.
@@ -157,6 +220,12 @@ type Options struct {
 	// BearerToken contains optional bearer token.
 	BearerToken string
 
+	// AzureAD contains optional promauth.AzureADConfig.
+	AzureAD *promauth.AzureADConfig
+
+	// GoogleIAM contains optional promauth.GoogleIAMConfig.
+	GoogleIAM *promauth.GoogleIAMConfig
+
 	// Headers contains optional http request headers in the form 'Foo: bar'.
 	Headers string
 }
@@ -180,6 +249,18 @@ func (opts *Options) NewConfig() (*Config, error) {
 			return nil, err
 		}
 	}
+	if opts.AzureAD != nil || opts.GoogleIAM != nil {
+		if ac.getAuthHeader != nil {
+			return nil, fmt.Errorf("cannot simultaneously use `basic_auth`, `bearer_token`, `azuread` and `google_iam`")
+		}
+		popts := &promauth.Options{
+			AzureAD:   opts.AzureAD,
+			GoogleIAM: opts.GoogleIAM,
+		}
+		if err := ac.initFromPromauthOptions(popts); err != nil {
+			return nil, err
+		}
+	}
 
 	headers, err := parseHeaders(opts.Headers)
 	if err != nil {
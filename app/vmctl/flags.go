@@ -92,6 +92,16 @@ const (
 	vmBackoffRetries     = "vm-backoff-retries"
 	vmBackoffFactor      = "vm-backoff-factor"
 	vmBackoffMinDuration = "vm-backoff-min-duration"
+
+	vmAzureADUseManagedIdentity  = "vm-azuread-use-managed-identity"
+	vmAzureADUseWorkloadIdentity = "vm-azuread-use-workload-identity"
+	vmAzureADClientID            = "vm-azuread-client-id"
+	vmAzureADTenantID            = "vm-azuread-tenant-id"
+	vmAzureADCloud               = "vm-azuread-cloud"
+	vmAzureADScope               = "vm-azuread-scope"
+	vmGoogleIAMEnabled           = "vm-google-iam-enabled"
+	vmGoogleIAMCredentialsFile   = "vm-google-iam-credentials-file"
+	vmGoogleIAMScopes            = "vm-google-iam-scopes"
 )
 
 var (
@@ -124,6 +134,43 @@ var (
 			Name:  vmBearerToken,
 			Usage: "Optional bearer auth token to use for the corresponding --vm-addr",
 		},
+		&cli.BoolFlag{
+			Name:  vmAzureADUseManagedIdentity,
+			Usage: "Whether to obtain access tokens for --vm-addr via Azure managed identity",
+		},
+		&cli.BoolFlag{
+			Name:  vmAzureADUseWorkloadIdentity,
+			Usage: "Whether to obtain access tokens for --vm-addr via Azure workload identity",
+		},
+		&cli.StringFlag{
+			Name: vmAzureADClientID,
+			Usage: "Optional client id of Azure managed identity or workload identity application for --vm-addr. \n" +
+				"AZURE_CLIENT_ID env var is used for workload identity if it isn't set",
+		},
+		&cli.StringFlag{
+			Name:  vmAzureADTenantID,
+			Usage: "Optional tenant id of Azure workload identity application for --vm-addr. AZURE_TENANT_ID env var is used if it isn't set",
+		},
+		&cli.StringFlag{
+			Name:  vmAzureADCloud,
+			Usage: "Optional Azure cloud for --vm-addr. Supported values: AzurePublic, AzureChina, AzureGovernment. Defaults to AzurePublic",
+		},
+		&cli.StringFlag{
+			Name:  vmAzureADScope,
+			Usage: "Optional scope for Azure access tokens for --vm-addr. Defaults to Azure Monitor scope for --vm-azuread-cloud",
+		},
+		&cli.BoolFlag{
+			Name:  vmGoogleIAMEnabled,
+			Usage: "Whether to obtain access tokens for --vm-addr from Google Cloud IAM",
+		},
+		&cli.StringFlag{
+			Name:  vmGoogleIAMCredentialsFile,
+			Usage: "Optional path to Google Cloud credentials file for --vm-addr. Application default credentials are used if it isn't set",
+		},
+		&cli.StringFlag{
+			Name:  vmGoogleIAMScopes,
+			Usage: "Optional OAuth2 scopes for Google Cloud access tokens for --vm-addr. Scopes must be delimited by ';'. Defaults to https://www.googleapis.com/auth/cloud-platform",
+		},
 		&cli.StringFlag{
 			Name: vmAccountID,
 			Usage: "AccountID is an arbitrary 32-bit integer identifying namespace for data ingestion (aka tenant). \n" +
@@ -600,6 +600,9 @@ func initConfigVM(c *cli.Context) (vm.Config, error) {
 	authCfg, err := auth.Generate(
 		auth.WithBasicAuth(c.String(vmUser), c.String(vmPassword)),
 		auth.WithBearer(c.String(vmBearerToken)),
+		auth.WithAzureAD(c.Bool(vmAzureADUseManagedIdentity), c.Bool(vmAzureADUseWorkloadIdentity),
+			c.String(vmAzureADClientID), c.String(vmAzureADTenantID), c.String(vmAzureADCloud), c.String(vmAzureADScope)),
+		auth.WithGoogleIAM(c.Bool(vmGoogleIAMEnabled), c.String(vmGoogleIAMCredentialsFile), c.String(vmGoogleIAMScopes)),
 		auth.WithHeaders(c.String(vmHeaders)))
 	if err != nil {
 		return vm.Config{}, fmt.Errorf("error initialize auth config for destination: %s: %w", addr, err)
@@ -54,6 +54,7 @@ type InsertCtx struct {
 
 	mrs           []storage.MetricRow
 	mms           []metricsmetadata.Row
+	exs           []storage.ExemplarRow
 	metricNameBuf []byte
 
 	relabelCtx    relabel.Ctx
@@ -81,6 +82,8 @@ func (ctx *InsertCtx) Reset(rowsLen int) {
 		cleanMetricMetadata(&mms[i])
 	}
 	ctx.mms = mms[:0]
+	clear(ctx.exs)
+	ctx.exs = ctx.exs[:0]
 
 	ctx.metricNameBuf = ctx.metricNameBuf[:0]
 	ctx.relabelCtx.Reset()
@@ -168,6 +171,23 @@ func (ctx *InsertCtx) addRow(metricNameRaw []byte, timestamp int64, value float6
 	return nil
 }
 
+// WriteExemplars writes exemplars for the series with the given labels into ctx buffer.
+//
+// caller must invoke TryPrepareLabels before using this function.
+// exemplars must exist until ctx.FlushBufs is called.
+func (ctx *InsertCtx) WriteExemplars(labels []prompb.Label, exemplars []prompb.Exemplar) {
+	if len(exemplars) == 0 {
+		return
+	}
+	metricNameRaw := ctx.marshalMetricNameRaw(nil, labels)
+	for i := range exemplars {
+		ctx.exs = append(ctx.exs, storage.ExemplarRow{
+			MetricNameRaw: metricNameRaw,
+			Exemplar:      exemplars[i],
+		})
+	}
+}
+
 // WriteMetadata writes given prometheus protobuf  metadata into the storage.
 func (ctx *InsertCtx) WriteMetadata(mmpbs []prompb.MetricMetadata) error {
 	if len(mmpbs) == 0 {
@@ -290,6 +310,10 @@ func (ctx *InsertCtx) FlushBufs() error {
 	// used at every stream.Parse() call under lib/protoparser/*
 
 	err := vmstorage.VMInsertAPI.WriteRows(ctx.mrs)
+	if err == nil && len(ctx.exs) > 0 {
+		exemplarsInserted.Add(len(ctx.exs))
+		err = vmstorage.VMInsertAPI.WriteExemplars(ctx.exs)
+	}
 	ctx.Reset(0)
 	if err == nil {
 		return nil
@@ -300,6 +324,8 @@ func (ctx *InsertCtx) FlushBufs() error {
 	}
 }
 
+var exemplarsInserted = metrics.NewCounter(`vm_exemplars_inserted_total`)
+
 func (ctx *InsertCtx) dropAggregatedRows(matchIdxs []uint32) {
 	dst := ctx.mrs[:0]
 	src := ctx.mrs
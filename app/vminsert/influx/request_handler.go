@@ -1,7 +1,6 @@
 package influx
 
 import (
-	"flag"
 	"io"
 	"net/http"
 	"sync"
@@ -9,6 +8,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/influxutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/influx"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/influx/stream"
@@ -18,13 +18,6 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 )
 
-var (
-	measurementFieldSeparator = flag.String("influxMeasurementFieldSeparator", "_", "Separator for '{measurement}{separator}{field_name}' metric name when inserted via InfluxDB line protocol")
-	skipSingleField           = flag.Bool("influxSkipSingleField", false, "Uses '{measurement}' instead of '{measurement}{separator}{field_name}' for metric name if InfluxDB line contains only a single field")
-	skipMeasurement           = flag.Bool("influxSkipMeasurement", false, "Uses '{field_name}' as a metric name while ignoring '{measurement}' and '-influxMeasurementFieldSeparator'")
-	dbLabel                   = flag.String("influxDBLabel", "db", "Default label for the DB name sent over '?db={db_name}' query parameter")
-)
-
 var (
 	rowsInserted  = metrics.NewCounter(`vm_rows_inserted_total{type="influx"}`)
 	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="influx"}`)
@@ -78,26 +71,26 @@ func insertRows(db string, rows []influx.Row, extraLabels []prompb.Label) error
 		hasDBKey := false
 		for j := range r.Tags {
 			tag := &r.Tags[j]
-			if tag.Key == *dbLabel {
+			if tag.Key == *influxutil.DBLabel {
 				hasDBKey = true
 			}
 			ic.AddLabel(tag.Key, tag.Value)
 		}
 		if !hasDBKey {
-			ic.AddLabel(*dbLabel, db)
+			ic.AddLabel(*influxutil.DBLabel, db)
 		}
 		for j := range extraLabels {
 			label := &extraLabels[j]
 			ic.AddLabel(label.Name, label.Value)
 		}
 		ctx.metricGroupBuf = ctx.metricGroupBuf[:0]
-		if !*skipMeasurement {
+		if !*influxutil.SkipMeasurement {
 			ctx.metricGroupBuf = append(ctx.metricGroupBuf, r.Measurement...)
 		}
 		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1139
-		skipFieldKey := len(r.Measurement) > 0 && len(r.Fields) == 1 && *skipSingleField
+		skipFieldKey := len(r.Measurement) > 0 && len(r.Fields) == 1 && *influxutil.SkipSingleField
 		if len(ctx.metricGroupBuf) > 0 && !skipFieldKey {
-			ctx.metricGroupBuf = append(ctx.metricGroupBuf, *measurementFieldSeparator...)
+			ctx.metricGroupBuf = append(ctx.metricGroupBuf, *influxutil.MeasurementFieldSeparator...)
 		}
 		metricGroupPrefixLen := len(ctx.metricGroupBuf)
 		if hasRelabeling {
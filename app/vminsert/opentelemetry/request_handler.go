@@ -79,6 +79,7 @@ func insertRows(tss []prompb.TimeSeries, mms []prompb.MetricMetadata, extraLabel
 				return err
 			}
 		}
+		ctx.WriteExemplars(ctx.Labels, ts.Exemplars)
 	}
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
@@ -68,6 +68,7 @@ func insertRows(timeseries []prompb.TimeSeries, mms []prompb.MetricMetadata, ext
 				return err
 			}
 		}
+		ctx.WriteExemplars(ctx.Labels, ts.Exemplars)
 	}
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
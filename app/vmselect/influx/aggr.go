@@ -0,0 +1,258 @@
+package influx
+
+import (
+	"math"
+	"slices"
+)
+
+// aggrFunc calculates the aggregate over values sorted by timestamps.
+//
+// arg is an optional argument for the function such as N for percentile(field, N).
+type aggrFunc func(values []float64, arg float64) float64
+
+var aggrFuncs = map[string]aggrFunc{
+	"count":      aggrCount,
+	"sum":        aggrSum,
+	"mean":       aggrMean,
+	"median":     aggrMedian,
+	"min":        aggrMin,
+	"max":        aggrMax,
+	"first":      aggrFirst,
+	"last":       aggrLast,
+	"spread":     aggrSpread,
+	"stddev":     aggrStddev,
+	"mode":       aggrMode,
+	"percentile": aggrPercentile,
+}
+
+func aggrCount(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	return float64(len(values))
+}
+
+func aggrSum(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	sum := float64(0)
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func aggrMean(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	return aggrSum(values, 0) / float64(len(values))
+}
+
+func aggrMedian(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	a := slices.Clone(values)
+	slices.Sort(a)
+	n := len(a) / 2
+	if len(a)%2 == 1 {
+		return a[n]
+	}
+	return (a[n-1] + a[n]) / 2
+}
+
+func aggrMin(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	return slices.Min(values)
+}
+
+func aggrMax(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	return slices.Max(values)
+}
+
+func aggrFirst(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	return values[0]
+}
+
+func aggrLast(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	return values[len(values)-1]
+}
+
+func aggrSpread(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	return slices.Max(values) - slices.Min(values)
+}
+
+func aggrStddev(values []float64, _ float64) float64 {
+	if len(values) < 2 {
+		// InfluxDB returns null for less than 2 values.
+		return nan
+	}
+	mean := aggrMean(values, 0)
+	var sum float64
+	for _, v := range values {
+		d := v - mean
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+func aggrMode(values []float64, _ float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	a := slices.Clone(values)
+	slices.Sort(a)
+	mode := a[0]
+	modeCount := 0
+	for i := 0; i < len(a); {
+		j := i + 1
+		for j < len(a) && a[j] == a[i] {
+			j++
+		}
+		// Prefer the smallest value on ties.
+		if j-i > modeCount {
+			mode = a[i]
+			modeCount = j - i
+		}
+		i = j
+	}
+	return mode
+}
+
+func aggrPercentile(values []float64, phi float64) float64 {
+	if len(values) == 0 {
+		return nan
+	}
+	a := slices.Clone(values)
+	slices.Sort(a)
+	// InfluxDB uses the nearest rank method.
+	i := int(math.Floor(float64(len(a))*phi/100+0.5)) - 1
+	if i < 0 {
+		return nan
+	}
+	if i >= len(a) {
+		i = len(a) - 1
+	}
+	return a[i]
+}
+
+// transformFunc transforms values at the given timestamps.
+//
+// unit is the unit in milliseconds for derivative functions.
+type transformFunc func(timestamps []int64, values []float64, unit int64)
+
+var transformFuncs = map[string]transformFunc{
+	"derivative":              transformDerivative(false),
+	"non_negative_derivative": transformDerivative(true),
+	"difference":              transformDifference(false),
+	"non_negative_difference": transformDifference(true),
+	"cumulative_sum":          transformCumulativeSum,
+}
+
+func transformDerivative(nonNegative bool) transformFunc {
+	return func(timestamps []int64, values []float64, unit int64) {
+		prevTimestamp := int64(0)
+		prevValue := nan
+		for i, v := range values {
+			if math.IsNaN(v) {
+				continue
+			}
+			if math.IsNaN(prevValue) {
+				values[i] = nan
+			} else {
+				d := (v - prevValue) / (float64(timestamps[i]-prevTimestamp) / float64(unit))
+				if nonNegative && d < 0 {
+					d = nan
+				}
+				values[i] = d
+			}
+			prevTimestamp = timestamps[i]
+			prevValue = v
+		}
+	}
+}
+
+func transformDifference(nonNegative bool) transformFunc {
+	return func(_ []int64, values []float64, _ int64) {
+		prevValue := nan
+		for i, v := range values {
+			if math.IsNaN(v) {
+				continue
+			}
+			d := v - prevValue
+			if nonNegative && d < 0 {
+				d = nan
+			}
+			values[i] = d
+			prevValue = v
+		}
+	}
+}
+
+func transformCumulativeSum(_ []int64, values []float64, _ int64) {
+	sum := float64(0)
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		sum += v
+		values[i] = sum
+	}
+}
+
+// applyFill fills empty values according to fill.
+//
+// Rows with empty values for fill(none) are removed later when generating the response.
+func applyFill(timestamps []int64, values []float64, mode string, fillValue float64) {
+	switch mode {
+	case "value":
+		for i, v := range values {
+			if math.IsNaN(v) {
+				values[i] = fillValue
+			}
+		}
+	case "previous":
+		prevValue := nan
+		for i, v := range values {
+			if math.IsNaN(v) {
+				values[i] = prevValue
+			} else {
+				prevValue = v
+			}
+		}
+	case "linear":
+		prevIdx := -1
+		for i, v := range values {
+			if math.IsNaN(v) {
+				continue
+			}
+			if prevIdx >= 0 && prevIdx+1 < i {
+				prevTimestamp := timestamps[prevIdx]
+				prevValue := values[prevIdx]
+				k := (v - prevValue) / float64(timestamps[i]-prevTimestamp)
+				for j := prevIdx + 1; j < i; j++ {
+					values[j] = prevValue + k*float64(timestamps[j]-prevTimestamp)
+				}
+			}
+			prevIdx = i
+		}
+	}
+}
+
+var nan = math.NaN()
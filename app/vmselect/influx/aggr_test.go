@@ -0,0 +1,91 @@
+package influx
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAggrFuncs(t *testing.T) {
+	f := func(name string, values []float64, arg, resultExpected float64) {
+		t.Helper()
+		result := aggrFuncs[name](values, arg)
+		if math.IsNaN(resultExpected) {
+			if !math.IsNaN(result) {
+				t.Fatalf("unexpected result for %s(%v); got %v; want NaN", name, values, result)
+			}
+			return
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %s(%v); got %v; want %v", name, values, result, resultExpected)
+		}
+	}
+	values := []float64{3, 1, 4, 1, 5, 9, 2, 6}
+
+	for name := range aggrFuncs {
+		f(name, nil, 50, nan)
+	}
+	f("count", values, 0, 8)
+	f("sum", values, 0, 31)
+	f("mean", values, 0, 3.875)
+	f("median", values, 0, 3.5)
+	f("median", values[:7], 0, 3)
+	f("min", values, 0, 1)
+	f("max", values, 0, 9)
+	f("first", values, 0, 3)
+	f("last", values, 0, 6)
+	f("spread", values, 0, 8)
+	f("stddev", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 0, math.Sqrt(32.0/7))
+	f("stddev", []float64{1}, 0, nan)
+	f("mode", values, 0, 1)
+	f("mode", []float64{5, 2, 5, 2}, 0, 2)
+	f("percentile", values, 50, 3)
+	f("percentile", values, 90, 6)
+	f("percentile", values, 100, 9)
+	f("percentile", values, 0, nan)
+}
+
+func TestTransformFuncs(t *testing.T) {
+	f := func(name string, values []float64, unit int64, resultExpected []float64) {
+		t.Helper()
+		timestamps := []int64{1000, 2000, 3000, 4000, 5000}
+		transformFuncs[name](timestamps, values, unit)
+		if !reflect.DeepEqual(replaceNaNs(values), replaceNaNs(resultExpected)) {
+			t.Fatalf("unexpected result for %s(); got %v; want %v", name, values, resultExpected)
+		}
+	}
+	f("derivative", []float64{1, 3, nan, 2, 6}, 1000, []float64{nan, 2, nan, -0.5, 4})
+	f("derivative", []float64{1, 3, nan, 2, 6}, 60e3, []float64{nan, 120, nan, -30, 240})
+	f("non_negative_derivative", []float64{1, 3, nan, 2, 6}, 1000, []float64{nan, 2, nan, nan, 4})
+	f("difference", []float64{1, 3, nan, 2, 6}, 0, []float64{nan, 2, nan, -1, 4})
+	f("non_negative_difference", []float64{1, 3, nan, 2, 6}, 0, []float64{nan, 2, nan, nan, 4})
+	f("cumulative_sum", []float64{1, 3, nan, 2, 6}, 0, []float64{1, 4, nan, 6, 12})
+}
+
+func TestApplyFill(t *testing.T) {
+	f := func(mode string, values []float64, resultExpected []float64) {
+		t.Helper()
+		timestamps := []int64{1000, 2000, 3000, 4000, 5000}
+		applyFill(timestamps, values, mode, 42)
+		if !reflect.DeepEqual(replaceNaNs(values), replaceNaNs(resultExpected)) {
+			t.Fatalf("unexpected result for fill(%s); got %v; want %v", mode, values, resultExpected)
+		}
+	}
+	f("null", []float64{nan, 1, nan, nan, 4}, []float64{nan, 1, nan, nan, 4})
+	f("none", []float64{nan, 1, nan, nan, 4}, []float64{nan, 1, nan, nan, 4})
+	f("value", []float64{nan, 1, nan, nan, 4}, []float64{42, 1, 42, 42, 4})
+	f("previous", []float64{nan, 1, nan, nan, 4}, []float64{nan, 1, 1, 1, 4})
+	f("linear", []float64{nan, 1, nan, nan, 4}, []float64{nan, 1, 2, 3, 4})
+}
+
+// replaceNaNs replaces NaNs with a special value, so reflect.DeepEqual could be used for comparing slices with NaNs.
+func replaceNaNs(a []float64) []float64 {
+	result := make([]float64, len(a))
+	for i, v := range a {
+		if math.IsNaN(v) {
+			v = -1e300
+		}
+		result[i] = v
+	}
+	return result
+}
@@ -0,0 +1,248 @@
+package influx
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/influxql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/influxutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// timeRange is the time range in milliseconds obtained from time conditions in WHERE clause.
+type timeRange struct {
+	start int64
+	end   int64
+
+	// hasStart is set if the lower bound for the time range is set in WHERE clause.
+	hasStart bool
+}
+
+// getTimeRange returns time range from time conditions in cond.
+//
+// The end of the time range defaults to currentTimestamp.
+func getTimeRange(cond influxql.Cond, currentTimestamp int64) (timeRange, error) {
+	minTimestamp := int64(math.MinInt64)
+	maxTimestamp := currentTimestamp * 1e6
+	hasStart := false
+	var f func(cond influxql.Cond, insideOr bool) error
+	f = func(cond influxql.Cond, insideOr bool) error {
+		switch t := cond.(type) {
+		case *influxql.BinaryCond:
+			insideOr = insideOr || t.Op == "or"
+			if err := f(t.Left, insideOr); err != nil {
+				return err
+			}
+			return f(t.Right, insideOr)
+		case *influxql.TimeCond:
+			if insideOr {
+				return fmt.Errorf("time conditions joined with OR aren't supported")
+			}
+			switch t.Op {
+			case "=":
+				minTimestamp = max(minTimestamp, t.Timestamp)
+				maxTimestamp = min(maxTimestamp, t.Timestamp)
+			case ">":
+				minTimestamp = max(minTimestamp, t.Timestamp+1)
+			case ">=":
+				minTimestamp = max(minTimestamp, t.Timestamp)
+			case "<":
+				maxTimestamp = min(maxTimestamp, t.Timestamp-1)
+			case "<=":
+				maxTimestamp = min(maxTimestamp, t.Timestamp)
+			default:
+				return fmt.Errorf("unsupported operator %q for time", t.Op)
+			}
+			if t.Op != "<" && t.Op != "<=" {
+				hasStart = true
+			}
+		}
+		return nil
+	}
+	if err := f(cond, false); err != nil {
+		return timeRange{}, err
+	}
+	tr := timeRange{
+		end:      floorDiv(maxTimestamp, 1e6),
+		hasStart: hasStart,
+	}
+	if hasStart {
+		tr.start = -floorDiv(-minTimestamp, 1e6)
+	}
+	return tr, nil
+}
+
+func floorDiv(a, b int64) int64 {
+	n := a / b
+	if a%b != 0 && a < 0 {
+		n--
+	}
+	return n
+}
+
+// getTagFilterss converts tag conditions in cond to tag filters joined with `or`.
+//
+// Time conditions are skipped, since they are handled by getTimeRange.
+// nil result means that all the series match cond.
+func getTagFilterss(cond influxql.Cond) ([][]storage.TagFilter, error) {
+	switch t := cond.(type) {
+	case nil:
+		return nil, nil
+	case *influxql.TimeCond:
+		return nil, nil
+	case *influxql.TagCond:
+		tf, err := newTagFilter(t)
+		if err != nil {
+			return nil, err
+		}
+		return [][]storage.TagFilter{{tf}}, nil
+	case *influxql.BinaryCond:
+		left, err := getTagFilterss(t.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := getTagFilterss(t.Right)
+		if err != nil {
+			return nil, err
+		}
+		if t.Op == "or" {
+			if len(left) == 0 || len(right) == 0 {
+				return nil, nil
+			}
+			return append(left, right...), nil
+		}
+		if len(left) == 0 {
+			return right, nil
+		}
+		if len(right) == 0 {
+			return left, nil
+		}
+		tfss := make([][]storage.TagFilter, 0, len(left)*len(right))
+		for _, l := range left {
+			for _, r := range right {
+				tfs := append([]storage.TagFilter{}, l...)
+				tfs = append(tfs, r...)
+				tfss = append(tfss, tfs)
+			}
+		}
+		return tfss, nil
+	default:
+		return nil, fmt.Errorf("BUG: unexpected condition type %T", cond)
+	}
+}
+
+func newTagFilter(tc *influxql.TagCond) (storage.TagFilter, error) {
+	tf := storage.TagFilter{
+		Key:        []byte(tc.Key),
+		Value:      []byte(tc.Value),
+		IsNegative: tc.Op == "!=" || tc.Op == "!~",
+		IsRegexp:   tc.Op == "=~" || tc.Op == "!~",
+	}
+	if tf.IsRegexp {
+		re, err := toStorageRegexp(tc.Value)
+		if err != nil {
+			return tf, err
+		}
+		tf.Value = []byte(re)
+	}
+	return tf, nil
+}
+
+// toStorageRegexp converts InfluxQL regexp to the regexp anchored at both ends, which is used by the storage.
+//
+// InfluxQL regexps are unanchored, so they are wrapped into `.*` unless they start with `^` and end with `$`.
+func toStorageRegexp(expr string) (string, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse regexp %q: %w", expr, err)
+	}
+	prefix := ".*"
+	suffix := ".*"
+	if re.Op == syntax.OpConcat && len(re.Sub) > 0 {
+		if re.Sub[0].Op == syntax.OpBeginText && strings.HasPrefix(expr, "^") {
+			expr = expr[1:]
+			prefix = ""
+		}
+		if re.Sub[len(re.Sub)-1].Op == syntax.OpEndText && strings.HasSuffix(expr, "$") && len(re.Sub) > 1 {
+			expr = expr[:len(expr)-1]
+			suffix = ""
+		}
+	}
+	if prefix == "" && suffix == "" {
+		return expr, nil
+	}
+	return prefix + "(?:" + expr + ")" + suffix, nil
+}
+
+// getMetricNameFilter returns a filter on metric names for the given measurement and fields.
+//
+// All the fields of the measurement are matched if fields is empty.
+// See the naming of InfluxDB line protocol fields at https://docs.victoriametrics.com/victoriametrics/integrations/influxdb/
+func getMetricNameFilter(measurement string, fields []string) storage.TagFilter {
+	prefix := measurement + *influxutil.MeasurementFieldSeparator
+	if *influxutil.SkipMeasurement {
+		prefix = ""
+	}
+	var a []string
+	if len(fields) == 0 {
+		a = append(a, regexp.QuoteMeta(prefix)+".+")
+	} else {
+		for _, field := range fields {
+			a = append(a, regexp.QuoteMeta(prefix+field))
+		}
+	}
+	if *influxutil.SkipSingleField && !*influxutil.SkipMeasurement {
+		a = append(a, regexp.QuoteMeta(measurement))
+	}
+	return storage.TagFilter{
+		Value:    []byte(strings.Join(a, "|")),
+		IsRegexp: true,
+	}
+}
+
+// getFieldName returns the field name for the given metricName of the given measurement.
+//
+// An empty field name is returned for series with a single field if -influxSkipSingleField is set.
+func getFieldName(metricName, measurement string) (string, bool) {
+	if *influxutil.SkipMeasurement {
+		return metricName, true
+	}
+	if *influxutil.SkipSingleField && metricName == measurement {
+		return "", true
+	}
+	prefix := measurement + *influxutil.MeasurementFieldSeparator
+	if !strings.HasPrefix(metricName, prefix) || len(metricName) == len(prefix) {
+		return "", false
+	}
+	return metricName[len(prefix):], true
+}
+
+// getMeasurementName returns the measurement name for the given metricName.
+//
+// The measurement name is the metricName part until the first -influxMeasurementFieldSeparator.
+// This may be incorrect for measurements containing the separator in their names.
+func getMeasurementName(metricName string) string {
+	sep := *influxutil.MeasurementFieldSeparator
+	if sep == "" {
+		return metricName
+	}
+	n := strings.Index(metricName, sep)
+	if n <= 0 {
+		return metricName
+	}
+	return metricName[:n]
+}
+
+// getDBFilter returns a filter on the -influxDBLabel for the given db.
+//
+// The filter also matches series without the db label, since they may be ingested via other protocols.
+func getDBFilter(db string) storage.TagFilter {
+	return storage.TagFilter{
+		Key:      []byte(*influxutil.DBLabel),
+		Value:    []byte(regexp.QuoteMeta(db) + "|"),
+		IsRegexp: true,
+	}
+}
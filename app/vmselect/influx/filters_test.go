@@ -0,0 +1,148 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/influxql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func parseWhere(t *testing.T, where string) influxql.Cond {
+	t.Helper()
+	stmts, err := influxql.Parse("SELECT value FROM m WHERE "+where, 1e18)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", where, err)
+	}
+	return stmts[0].(*influxql.SelectStatement).Where
+}
+
+func TestGetTimeRangeSuccess(t *testing.T) {
+	f := func(where string, trExpected timeRange) {
+		t.Helper()
+		tr, err := getTimeRange(parseWhere(t, where), 1e12)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if tr != trExpected {
+			t.Fatalf("unexpected time range for %q; got %+v; want %+v", where, tr, trExpected)
+		}
+	}
+	f(`host = 'a'`, timeRange{end: 1e12})
+	f(`time > now() - 1h`, timeRange{start: 1e12 - 3600e3 + 1, end: 1e12, hasStart: true})
+	f(`time >= 1000ms and time <= 2000ms`, timeRange{start: 1000, end: 2000, hasStart: true})
+	f(`time >= 1000500000 and time < 2000500000`, timeRange{start: 1001, end: 2000, hasStart: true})
+	f(`host = 'a' and (time >= 1s and time < 2s)`, timeRange{start: 1000, end: 1999, hasStart: true})
+	f(`time = 5s`, timeRange{start: 5000, end: 5000, hasStart: true})
+}
+
+func TestGetTimeRangeFailure(t *testing.T) {
+	where := parseWhere(t, `host = 'a' or time > now() - 1h`)
+	if _, err := getTimeRange(where, 1e12); err == nil {
+		t.Fatalf("expecting non-nil error for time condition inside OR")
+	}
+}
+
+func TestGetTagFilterss(t *testing.T) {
+	f := func(where, resultExpected string) {
+		t.Helper()
+		tfss, err := getTagFilterss(parseWhere(t, where))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := marshalTagFilterss(tfss)
+		if result != resultExpected {
+			t.Fatalf("unexpected filters for %q\ngot\n%s\nwant\n%s", where, result, resultExpected)
+		}
+	}
+	f(`time > 0`, ``)
+	f(`host = 'a'`, `{host="a"}`)
+	f(`host = 'a' and time > 0 and dc != 'b'`, `{host="a",dc!="b"}`)
+	f(`host =~ /^web-.+$/ AND dc !~ /eu/`, `{host=~"web-.+",dc!~".*(?:eu).*"}`)
+	f(`host = 'a' or host = 'b'`, `{host="a"} or {host="b"}`)
+	f(`(host = 'a' or host = 'b') and dc = 'c'`, `{host="a",dc="c"} or {host="b",dc="c"}`)
+	f(`time > 0 and (host = 'a' or dc = 'b')`, `{host="a"} or {dc="b"}`)
+}
+
+func marshalTagFilterss(tfss [][]storage.TagFilter) string {
+	var s string
+	for i, tfs := range tfss {
+		if i > 0 {
+			s += " or "
+		}
+		s += "{"
+		for j, tf := range tfs {
+			if j > 0 {
+				s += ","
+			}
+			s += tf.String()
+		}
+		s += "}"
+	}
+	return s
+}
+
+func TestToStorageRegexp(t *testing.T) {
+	f := func(expr, resultExpected string) {
+		t.Helper()
+		result, err := toStorageRegexp(expr)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %q; want %q", expr, result, resultExpected)
+		}
+	}
+	f(`foo`, `.*(?:foo).*`)
+	f(`^foo`, `(?:foo).*`)
+	f(`foo$`, `.*(?:foo)`)
+	f(`^foo$`, `foo`)
+	f(`^(a|b)$`, `(a|b)`)
+	f(`^a|b$`, `.*(?:^a|b$).*`)
+	f(`^$`, ``)
+	f(`foo\$`, `.*(?:foo\$).*`)
+
+	if _, err := toStorageRegexp(`(`); err == nil {
+		t.Fatalf("expecting non-nil error for invalid regexp")
+	}
+}
+
+func TestGetMetricNameFilter(t *testing.T) {
+	f := func(measurement string, fields []string, resultExpected string) {
+		t.Helper()
+		tf := getMetricNameFilter(measurement, fields)
+		result := tf.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected filter; got %s; want %s", result, resultExpected)
+		}
+	}
+	f("cpu", nil, `__name__=~"cpu_.+"`)
+	f("cpu", []string{"usage_idle"}, `__name__=~"cpu_usage_idle"`)
+	f("cpu.x", []string{"a", "b"}, `__name__=~"cpu\\.x_a|cpu\\.x_b"`)
+}
+
+func TestGetFieldName(t *testing.T) {
+	f := func(metricName, measurement, fieldExpected string, okExpected bool) {
+		t.Helper()
+		field, ok := getFieldName(metricName, measurement)
+		if field != fieldExpected || ok != okExpected {
+			t.Fatalf("unexpected result for getFieldName(%q, %q); got (%q, %v); want (%q, %v)", metricName, measurement, field, ok, fieldExpected, okExpected)
+		}
+	}
+	f("cpu_usage_idle", "cpu", "usage_idle", true)
+	f("cpu_", "cpu", "", false)
+	f("mem_free", "cpu", "", false)
+	f("cpu", "cpu", "", false)
+}
+
+func TestGetMeasurementName(t *testing.T) {
+	f := func(metricName, resultExpected string) {
+		t.Helper()
+		result := getMeasurementName(metricName)
+		if result != resultExpected {
+			t.Fatalf("unexpected measurement for %q; got %q; want %q", metricName, result, resultExpected)
+		}
+	}
+	f("cpu_usage_idle", "cpu")
+	f("up", "up")
+	f("_foo", "_foo")
+}
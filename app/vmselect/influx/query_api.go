@@ -0,0 +1,151 @@
+package influx
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/influxql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	maxInfluxSeries = flag.Int("search.maxInfluxSeries", 300e3, "The maximum number of time series, which can be scanned during InfluxQL queries to /query. "+
+		"See https://docs.victoriametrics.com/victoriametrics/integrations/influxdb/#influxql-queries")
+	maxInfluxTagValues = flag.Int("search.maxInfluxTagValues", 100e3, "The maximum number of measurements, tag keys, tag values or field keys returned from SHOW statements at /query. "+
+		"See https://docs.victoriametrics.com/victoriametrics/integrations/influxdb/#influxql-queries")
+	maxPointsPerSeries = flag.Int("search.influxMaxPointsPerSeries", 30e3, "The maximum number of points per series InfluxQL queries with GROUP BY time() can return")
+	defaultLookback    = flag.Duration("search.influxDefaultLookback", time.Hour, "The time range for InfluxQL SELECT queries at /query without the lower time bound in WHERE clause. "+
+		"See https://docs.victoriametrics.com/victoriametrics/integrations/influxdb/#influxql-queries")
+)
+
+// statementResult is the result for a single InfluxQL statement.
+type statementResult struct {
+	StatementID int
+	Series      []*series
+	Err         error
+}
+
+// evalConfig is the configuration for InfluxQL statements evaluation.
+type evalConfig struct {
+	qt       *querytracer.Tracer
+	deadline searchutil.Deadline
+
+	// currentTimestamp is the current time in milliseconds.
+	currentTimestamp int64
+
+	// db is the database from db query arg.
+	db string
+
+	// etfs contains extra tag filters from the request.
+	etfs [][]storage.TagFilter
+}
+
+// QueryHandler implements /query endpoint from InfluxDB 1.x query API.
+//
+// See https://docs.influxdata.com/influxdb/v1/tools/api/#query-http-endpoint
+func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer queryDuration.UpdateDuration(startTime)
+
+	// InfluxDB clients such as Grafana and Chronograf detect InfluxDB by this header.
+	w.Header().Set("X-Influxdb-Version", "1.8.0")
+
+	q := r.FormValue("q")
+	if q == "" {
+		return httpserver.InvalidParamError(fmt.Errorf("missing required parameter \"q\""))
+	}
+	epoch := r.FormValue("epoch")
+	if _, ok := epochDivisors[epoch]; !ok && epoch != "" {
+		return httpserver.InvalidParamError(fmt.Errorf("unsupported epoch=%q; supported values: ns, n, u, µ, ms, s, m, h", epoch))
+	}
+	stmts, err := influxql.Parse(q, startTime.UnixNano())
+	if err != nil {
+		return httpserver.InvalidParamError(fmt.Errorf("error parsing query: %w", err))
+	}
+	etfs, err := searchutil.GetExtraTagFilters(r)
+	if err != nil {
+		return fmt.Errorf("cannot setup tag filters: %w", err)
+	}
+	ec := &evalConfig{
+		qt:               qt,
+		deadline:         searchutil.GetDeadlineForQuery(r, startTime),
+		currentTimestamp: startTime.UnixNano() / 1e6,
+		db:               r.FormValue("db"),
+		etfs:             etfs,
+	}
+	results := make([]*statementResult, len(stmts))
+	for i, stmt := range stmts {
+		ss, err := ec.execStatement(stmt)
+		results[i] = &statementResult{
+			StatementID: i,
+			Series:      ss,
+			Err:         err,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteQueryResponse(bw, results, epoch)
+	return bw.Flush()
+}
+
+var queryDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/influx/query"}`)
+
+func (ec *evalConfig) execStatement(stmt influxql.Statement) ([]*series, error) {
+	switch t := stmt.(type) {
+	case *influxql.SelectStatement:
+		return ec.execSelect(t)
+	case *influxql.CreateDatabaseStatement:
+		// VictoriaMetrics doesn't need databases to be created before writing data into them.
+		// InfluxDB clients such as Telegraf create the database on start, so just ignore the statement.
+		return nil, nil
+	case *influxql.ShowDatabasesStatement:
+		return ec.execShowDatabases()
+	case *influxql.ShowRetentionPoliciesStatement:
+		return getRetentionPoliciesSeries(), nil
+	case *influxql.ShowMeasurementsStatement:
+		return ec.execShowMeasurements(t)
+	case *influxql.ShowTagKeysStatement:
+		return ec.execShowTagKeys(t)
+	case *influxql.ShowTagValuesStatement:
+		return ec.execShowTagValues(t)
+	case *influxql.ShowFieldKeysStatement:
+		return ec.execShowFieldKeys(t)
+	default:
+		return nil, fmt.Errorf("BUG: unexpected statement type %T", stmt)
+	}
+}
+
+// epochDivisors contains divisors for converting timestamps in milliseconds to the given epoch query arg.
+//
+// Negative divisors mean multiplication.
+var epochDivisors = map[string]int64{
+	"ns": -1e6,
+	"n":  -1e6,
+	"u":  -1e3,
+	"µ":  -1e3,
+	"ms": 1,
+	"s":  1e3,
+	"m":  60e3,
+	"h":  3600e3,
+}
+
+// convertTimestamp converts timestamp in milliseconds to the given epoch.
+func convertTimestamp(timestamp int64, epoch string) int64 {
+	d := epochDivisors[epoch]
+	if d < 0 {
+		return timestamp * -d
+	}
+	return floorDiv(timestamp, d)
+}
+
+func formatTimestamp(timestamp int64) string {
+	return time.UnixMilli(timestamp).UTC().Format(time.RFC3339Nano)
+}
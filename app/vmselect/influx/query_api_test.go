@@ -0,0 +1,24 @@
+package influx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestQueryHandlerCreateDatabase(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/query", nil)
+	r.Form = url.Values{
+		"q": {`CREATE DATABASE "telegraf"`},
+	}
+	w := httptest.NewRecorder()
+	if err := QueryHandler(nil, time.Now(), w, r); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resultExpected := `{"results":[{"statement_id":0}]}`
+	if result := w.Body.String(); result != resultExpected {
+		t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
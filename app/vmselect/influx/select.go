@@ -0,0 +1,694 @@
+package influx
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/influxql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/influxutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// series is a series in the response for InfluxQL statement.
+type series struct {
+	Name    string
+	Tags    []tag
+	Columns []string
+	Values  [][]any
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+// timestampMsecs is a timestamp in milliseconds in the response.
+//
+// It is formatted according to the epoch query arg.
+type timestampMsecs int64
+
+// rawSeries is a series fetched from the storage for a single field.
+type rawSeries struct {
+	// field is the field name. It is empty for series with a single field if -influxSkipSingleField is set.
+	field string
+
+	// tags contains series tags sorted by key.
+	tags []tag
+
+	timestamps []int64
+	values     []float64
+}
+
+// selectField is a field from SELECT statement.
+type selectField struct {
+	// column is the column name in the response.
+	column string
+
+	// field is the field name to select.
+	field string
+
+	// isWildcard is set for `SELECT *`.
+	isWildcard bool
+
+	// aggr is the aggregate function name. It is empty for raw fields.
+	aggr    string
+	aggrArg float64
+
+	// transform is an optional function applied to aggregated values such as derivative.
+	transform string
+
+	// unit is the unit in milliseconds for derivative functions.
+	unit int64
+}
+
+// getSelectFields returns fields for ss.
+//
+// The returned bool is set if all the fields are aggregates.
+func getSelectFields(ss *influxql.SelectStatement) ([]*selectField, bool, error) {
+	sfs := make([]*selectField, 0, len(ss.Fields))
+	aggrFields := 0
+	for _, f := range ss.Fields {
+		sf, err := newSelectField(f.Expr)
+		if err != nil {
+			return nil, false, err
+		}
+		if f.Alias != "" {
+			sf.column = f.Alias
+		}
+		if sf.aggr != "" {
+			aggrFields++
+		}
+		if sf.transform != "" && ss.GroupByInterval <= 0 {
+			return nil, false, fmt.Errorf("%s() requires GROUP BY time()", sf.transform)
+		}
+		sfs = append(sfs, sf)
+	}
+	if aggrFields > 0 && aggrFields < len(sfs) {
+		return nil, false, fmt.Errorf("mixing aggregate and non-aggregate queries is not supported")
+	}
+	isAggr := aggrFields > 0
+	if !isAggr && ss.GroupByInterval > 0 {
+		return nil, false, fmt.Errorf("GROUP BY time() requires aggregate functions")
+	}
+	return sfs, isAggr, nil
+}
+
+func newSelectField(expr influxql.Expr) (*selectField, error) {
+	switch t := expr.(type) {
+	case *influxql.Wildcard:
+		return &selectField{
+			isWildcard: true,
+		}, nil
+	case *influxql.VarRef:
+		return &selectField{
+			column: t.Name,
+			field:  t.Name,
+		}, nil
+	case *influxql.Call:
+		if _, ok := transformFuncs[t.Name]; ok {
+			return newTransformField(t)
+		}
+		return newAggrField(t)
+	default:
+		return nil, fmt.Errorf("unsupported field expression %T; supported expressions: field, aggregate function call or *", expr)
+	}
+}
+
+func newAggrField(c *influxql.Call) (*selectField, error) {
+	if _, ok := aggrFuncs[c.Name]; !ok {
+		return nil, fmt.Errorf("unsupported function %s(); see https://docs.victoriametrics.com/victoriametrics/integrations/influxdb/#influxql-queries for the list of supported functions", c.Name)
+	}
+	argsLen := 1
+	if c.Name == "percentile" {
+		argsLen = 2
+	}
+	if len(c.Args) != argsLen {
+		return nil, fmt.Errorf("unexpected number of args for %s(); got %d; want %d", c.Name, len(c.Args), argsLen)
+	}
+	vr, ok := c.Args[0].(*influxql.VarRef)
+	if !ok {
+		return nil, fmt.Errorf("the first arg for %s() must be a field name", c.Name)
+	}
+	sf := &selectField{
+		column: c.Name,
+		field:  vr.Name,
+		aggr:   c.Name,
+	}
+	if c.Name == "percentile" {
+		nl, ok := c.Args[1].(*influxql.NumberLiteral)
+		if !ok || nl.N < 0 || nl.N > 100 {
+			return nil, fmt.Errorf("the second arg for percentile() must be a number in the range [0..100]")
+		}
+		sf.aggrArg = nl.N
+	}
+	return sf, nil
+}
+
+func newTransformField(c *influxql.Call) (*selectField, error) {
+	maxArgs := 1
+	if strings.HasSuffix(c.Name, "derivative") {
+		maxArgs = 2
+	}
+	if len(c.Args) < 1 || len(c.Args) > maxArgs {
+		return nil, fmt.Errorf("unexpected number of args for %s(); got %d; want up to %d", c.Name, len(c.Args), maxArgs)
+	}
+	inner, ok := c.Args[0].(*influxql.Call)
+	if !ok {
+		return nil, fmt.Errorf("the first arg for %s() must be an aggregate function such as mean(field)", c.Name)
+	}
+	sf, err := newAggrField(inner)
+	if err != nil {
+		return nil, err
+	}
+	sf.column = c.Name
+	sf.transform = c.Name
+	sf.unit = 1000
+	if len(c.Args) > 1 {
+		dl, ok := c.Args[1].(*influxql.DurationLiteral)
+		if !ok || dl.D < 1e6 {
+			return nil, fmt.Errorf("the second arg for %s() must be a duration not smaller than 1ms", c.Name)
+		}
+		sf.unit = dl.D / 1e6
+	}
+	return sf, nil
+}
+
+// getFieldNames returns field names to fetch for sfs.
+//
+// nil is returned if all the fields must be fetched.
+func getFieldNames(sfs []*selectField) []string {
+	var fields []string
+	for _, sf := range sfs {
+		if sf.isWildcard {
+			return nil
+		}
+		if !slices.Contains(fields, sf.field) {
+			fields = append(fields, sf.field)
+		}
+	}
+	return fields
+}
+
+func (ec *evalConfig) execSelect(ss *influxql.SelectStatement) ([]*series, error) {
+	sfs, isAggr, err := getSelectFields(ss)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := getTimeRange(ss.Where, ec.currentTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	if ss.GroupByInterval > 0 && !tr.hasStart {
+		return nil, fmt.Errorf("GROUP BY time() requires the lower time bound in WHERE clause such as `time > now() - 1h`")
+	}
+	if !tr.hasStart {
+		// Do not scan all the stored data for queries without the lower time bound.
+		tr.start = tr.end - defaultLookback.Milliseconds()
+	}
+	if tr.start > tr.end {
+		return nil, nil
+	}
+	fields := getFieldNames(sfs)
+	var result []*series
+	for _, measurement := range ss.Measurements {
+		rss, err := ec.fetchSeries(measurement, fields, ss.Where, tr)
+		if err != nil {
+			return nil, err
+		}
+		var ssr []*series
+		if isAggr {
+			ssr, err = evalAggrSelect(ss, sfs, measurement, rss, tr)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			ssr = evalRawSelect(ss, sfs, measurement, rss)
+		}
+		result = append(result, ssr...)
+	}
+	result = applyLimitOffset(result, ss.SLimit, ss.SOffset)
+	return result, nil
+}
+
+func (ec *evalConfig) fetchSeries(measurement string, fields []string, where influxql.Cond, tr timeRange) ([]*rawSeries, error) {
+	tfss, err := ec.getTagFilterss(where, getMetricNameFilter(measurement, fields))
+	if err != nil {
+		return nil, err
+	}
+	sq := storage.NewSearchQuery(tr.start, tr.end, tfss, *maxInfluxSeries)
+	rss, err := netstorage.ProcessSearchQuery(ec.qt, sq, ec.deadline)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+	}
+	var resultLock sync.Mutex
+	var result []*rawSeries
+	err = rss.RunParallel(ec.qt, func(rs *netstorage.Result, _ uint) error {
+		field, ok := getFieldName(string(rs.MetricName.MetricGroup), measurement)
+		if !ok {
+			return nil
+		}
+		s := &rawSeries{
+			field: field,
+		}
+		for _, t := range rs.MetricName.Tags {
+			s.tags = append(s.tags, tag{
+				Key:   string(t.Key),
+				Value: string(t.Value),
+			})
+		}
+		sortTags(s.tags)
+		for i, ts := range rs.Timestamps {
+			v := rs.Values[i]
+			if ts < tr.start || ts > tr.end || decimal.IsStaleNaN(v) {
+				continue
+			}
+			s.timestamps = append(s.timestamps, ts)
+			s.values = append(s.values, v)
+		}
+		if len(s.timestamps) == 0 {
+			return nil
+		}
+		resultLock.Lock()
+		result = append(result, s)
+		resultLock.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error when fetching data for %q: %w", sq, err)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if ka, kb := marshalTags(a.tags), marshalTags(b.tags); ka != kb {
+			return ka < kb
+		}
+		return a.field < b.field
+	})
+	return result, nil
+}
+
+// getTagFilterss returns tag filters for the given where condition, the db query arg, extra filters from the request and the given extraFilters.
+func (ec *evalConfig) getTagFilterss(where influxql.Cond, extraFilters ...storage.TagFilter) ([][]storage.TagFilter, error) {
+	tfss, err := getTagFilterss(where)
+	if err != nil {
+		return nil, err
+	}
+	if ec.db != "" {
+		extraFilters = append(extraFilters, getDBFilter(ec.db))
+	}
+	if len(extraFilters) > 0 {
+		if len(tfss) == 0 {
+			tfss = [][]storage.TagFilter{nil}
+		}
+		for i, tfs := range tfss {
+			tfss[i] = append(tfs, extraFilters...)
+		}
+	}
+	return searchutil.JoinTagFilterss(tfss, ec.etfs), nil
+}
+
+// seriesGroup is a group of series for GROUP BY clause.
+type seriesGroup struct {
+	tags []tag
+	rss  []*rawSeries
+}
+
+func groupRawSeries(ss *influxql.SelectStatement, rss []*rawSeries) []*seriesGroup {
+	m := make(map[string]*seriesGroup)
+	var groups []*seriesGroup
+	for _, rs := range rss {
+		tags := getGroupTags(ss, rs.tags)
+		k := marshalTags(tags)
+		g := m[k]
+		if g == nil {
+			g = &seriesGroup{
+				tags: tags,
+			}
+			m[k] = g
+			groups = append(groups, g)
+		}
+		g.rss = append(g.rss, rs)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return marshalTags(groups[i].tags) < marshalTags(groups[j].tags)
+	})
+	return groups
+}
+
+func getGroupTags(ss *influxql.SelectStatement, tags []tag) []tag {
+	var result []tag
+	if ss.GroupByAllTags {
+		for _, t := range tags {
+			if t.Key != *influxutil.DBLabel {
+				result = append(result, t)
+			}
+		}
+	}
+	for _, key := range ss.GroupByTags {
+		if hasTag(result, key) {
+			continue
+		}
+		result = append(result, tag{
+			Key:   key,
+			Value: getTagValue(tags, key),
+		})
+	}
+	sortTags(result)
+	return result
+}
+
+func evalRawSelect(ss *influxql.SelectStatement, sfs []*selectField, measurement string, rss []*rawSeries) []*series {
+	var result []*series
+	for _, g := range groupRawSeries(ss, rss) {
+		if s := evalRawGroup(ss, sfs, measurement, g); s != nil {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+type rawRow struct {
+	timestamp int64
+	tagsKey   string
+	tags      []tag
+	fields    map[string]float64
+}
+
+// rawColumn is a column for raw SELECT.
+type rawColumn struct {
+	// name is a field or tag name for the column.
+	name  string
+	isTag bool
+}
+
+func evalRawGroup(ss *influxql.SelectStatement, sfs []*selectField, measurement string, g *seriesGroup) *series {
+	// Collect field names and tag keys for the group
+	fieldsSet := make(map[string]bool)
+	tagKeysSet := make(map[string]bool)
+	for _, rs := range g.rss {
+		fieldsSet[getRawFieldName(rs.field)] = true
+		for _, t := range rs.tags {
+			if t.Key != *influxutil.DBLabel && !hasTag(g.tags, t.Key) {
+				tagKeysSet[t.Key] = true
+			}
+		}
+	}
+
+	// Generate columns
+	columns := []string{"time"}
+	var rcs []rawColumn
+	for _, sf := range sfs {
+		if !sf.isWildcard {
+			columns = append(columns, sf.column)
+			rcs = append(rcs, rawColumn{
+				name:  sf.field,
+				isTag: !fieldsSet[sf.field] && tagKeysSet[sf.field],
+			})
+			continue
+		}
+		var names []string
+		for name := range fieldsSet {
+			names = append(names, name)
+		}
+		for key := range tagKeysSet {
+			if !fieldsSet[key] {
+				names = append(names, key)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			columns = append(columns, name)
+			rcs = append(rcs, rawColumn{
+				name:  name,
+				isTag: !fieldsSet[name],
+			})
+		}
+	}
+
+	// Merge points for the series with the same tags into rows
+	m := make(map[string]*rawRow)
+	var rows []*rawRow
+	for _, rs := range g.rss {
+		tagsKey := marshalTags(rs.tags)
+		field := getRawFieldName(rs.field)
+		for i, ts := range rs.timestamps {
+			k := fmt.Sprintf("%s\xfe%d", tagsKey, ts)
+			row := m[k]
+			if row == nil {
+				row = &rawRow{
+					timestamp: ts,
+					tagsKey:   tagsKey,
+					tags:      rs.tags,
+					fields:    make(map[string]float64),
+				}
+				m[k] = row
+				rows = append(rows, row)
+			}
+			row.fields[field] = rs.values[i]
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.timestamp != b.timestamp {
+			return a.timestamp < b.timestamp
+		}
+		return a.tagsKey < b.tagsKey
+	})
+
+	var values [][]any
+	for _, row := range rows {
+		rowValues := make([]any, 0, len(columns))
+		rowValues = append(rowValues, timestampMsecs(row.timestamp))
+		hasFields := false
+		for _, rc := range rcs {
+			if rc.isTag {
+				if v := getTagValue(row.tags, rc.name); v != "" {
+					rowValues = append(rowValues, v)
+				} else {
+					rowValues = append(rowValues, nil)
+				}
+				continue
+			}
+			if v, ok := row.fields[rc.name]; ok {
+				rowValues = append(rowValues, v)
+				hasFields = true
+			} else {
+				rowValues = append(rowValues, nil)
+			}
+		}
+		if hasFields {
+			values = append(values, rowValues)
+		}
+	}
+	if ss.OrderDesc {
+		slices.Reverse(values)
+	}
+	values = applyLimitOffset(values, ss.Limit, ss.Offset)
+	if len(values) == 0 {
+		return nil
+	}
+	return &series{
+		Name:    measurement,
+		Tags:    g.tags,
+		Columns: uniqueColumns(columns),
+		Values:  values,
+	}
+}
+
+// getRawFieldName returns the field name for the given rawSeries.field.
+func getRawFieldName(field string) string {
+	if field == "" {
+		return "value"
+	}
+	return field
+}
+
+func evalAggrSelect(ss *influxql.SelectStatement, sfs []*selectField, measurement string, rss []*rawSeries, tr timeRange) ([]*series, error) {
+	var timestamps []int64
+	interval := tr.end - tr.start + 1
+	if ss.GroupByInterval > 0 {
+		interval = ss.GroupByInterval / 1e6
+		if interval <= 0 {
+			return nil, fmt.Errorf("GROUP BY time() interval must be at least 1ms")
+		}
+		offset := (ss.GroupByOffset / 1e6) % interval
+		start := floorDiv(tr.start-offset, interval)*interval + offset
+		end := floorDiv(tr.end-offset, interval)*interval + offset
+		pointsLen := (end-start)/interval + 1
+		if pointsLen > int64(*maxPointsPerSeries) {
+			return nil, fmt.Errorf("too many points for GROUP BY time(); got %d; the maximum is -search.influxMaxPointsPerSeries=%d; "+
+				"increase the interval in GROUP BY time() or reduce the time range", pointsLen, *maxPointsPerSeries)
+		}
+		for ts := start; ts <= end; ts += interval {
+			timestamps = append(timestamps, ts)
+		}
+	} else {
+		timestamps = []int64{tr.start}
+	}
+
+	columns := []string{"time"}
+	for _, sf := range sfs {
+		columns = append(columns, sf.column)
+	}
+	columns = uniqueColumns(columns)
+
+	var result []*series
+	for _, g := range groupRawSeries(ss, rss) {
+		columnValues := make([][]float64, len(sfs))
+		for i, sf := range sfs {
+			pointTimestamps, pointValues := mergeFieldPoints(g.rss, sf.field)
+			values := make([]float64, len(timestamps))
+			af := aggrFuncs[sf.aggr]
+			j := 0
+			for k, ts := range timestamps {
+				jStart := j
+				for j < len(pointTimestamps) && pointTimestamps[j] < ts+interval {
+					j++
+				}
+				values[k] = af(pointValues[jStart:j], sf.aggrArg)
+			}
+			if sf.transform != "" {
+				transformFuncs[sf.transform](timestamps, values, sf.unit)
+			}
+			applyFill(timestamps, values, ss.Fill.Mode, ss.Fill.Value)
+			columnValues[i] = values
+		}
+
+		var values [][]any
+		for k, ts := range timestamps {
+			rowValues := make([]any, 0, len(columns))
+			rowValues = append(rowValues, timestampMsecs(ts))
+			hasValues := false
+			for _, cvs := range columnValues {
+				v := cvs[k]
+				if !math.IsNaN(v) {
+					hasValues = true
+				}
+				rowValues = append(rowValues, v)
+			}
+			if !hasValues && (ss.Fill.Mode == "none" || ss.GroupByInterval <= 0) {
+				continue
+			}
+			values = append(values, rowValues)
+		}
+		if ss.OrderDesc {
+			slices.Reverse(values)
+		}
+		values = applyLimitOffset(values, ss.Limit, ss.Offset)
+		if len(values) == 0 {
+			continue
+		}
+		result = append(result, &series{
+			Name:    measurement,
+			Tags:    g.tags,
+			Columns: columns,
+			Values:  values,
+		})
+	}
+	return result, nil
+}
+
+// mergeFieldPoints returns points for the given field from rss sorted by timestamps.
+func mergeFieldPoints(rss []*rawSeries, field string) ([]int64, []float64) {
+	var srcs []*rawSeries
+	for _, rs := range rss {
+		if rs.field == field || rs.field == "" {
+			srcs = append(srcs, rs)
+		}
+	}
+	if len(srcs) == 1 {
+		return srcs[0].timestamps, srcs[0].values
+	}
+	type point struct {
+		timestamp int64
+		value     float64
+	}
+	var points []point
+	for _, rs := range srcs {
+		for i, ts := range rs.timestamps {
+			points = append(points, point{
+				timestamp: ts,
+				value:     rs.values[i],
+			})
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].timestamp < points[j].timestamp
+	})
+	timestamps := make([]int64, len(points))
+	values := make([]float64, len(points))
+	for i, p := range points {
+		timestamps[i] = p.timestamp
+		values[i] = p.value
+	}
+	return timestamps, values
+}
+
+// uniqueColumns adds _N suffixes to duplicate column names like InfluxDB does.
+func uniqueColumns(columns []string) []string {
+	seen := make(map[string]int, len(columns))
+	result := make([]string, len(columns))
+	for i, c := range columns {
+		n := seen[c]
+		seen[c] = n + 1
+		if n > 0 {
+			c = fmt.Sprintf("%s_%d", c, n)
+		}
+		result[i] = c
+	}
+	return result
+}
+
+func applyLimitOffset[T any](a []T, limit, offset int) []T {
+	if offset > 0 {
+		if offset >= len(a) {
+			return nil
+		}
+		a = a[offset:]
+	}
+	if limit > 0 && limit < len(a) {
+		a = a[:limit]
+	}
+	return a
+}
+
+func sortTags(tags []tag) {
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Key < tags[j].Key
+	})
+}
+
+func marshalTags(tags []tag) string {
+	var sb strings.Builder
+	for _, t := range tags {
+		sb.WriteString(t.Key)
+		sb.WriteByte('\xff')
+		sb.WriteString(t.Value)
+		sb.WriteByte('\xff')
+	}
+	return sb.String()
+}
+
+func hasTag(tags []tag, key string) bool {
+	for _, t := range tags {
+		if t.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func getTagValue(tags []tag, key string) string {
+	for _, t := range tags {
+		if t.Key == key {
+			return t.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/influxql"
+)
+
+func testRawSeries() []*rawSeries {
+	return []*rawSeries{
+		{
+			field:      "usage",
+			tags:       []tag{{Key: "db", Value: "telegraf"}, {Key: "host", Value: "a"}},
+			timestamps: []int64{1000, 2000, 3000, 4000},
+			values:     []float64{1, 2, 3, 4},
+		},
+		{
+			field:      "idle",
+			tags:       []tag{{Key: "db", Value: "telegraf"}, {Key: "host", Value: "a"}},
+			timestamps: []int64{1000, 3000},
+			values:     []float64{10, 30},
+		},
+		{
+			field:      "usage",
+			tags:       []tag{{Key: "host", Value: "b"}},
+			timestamps: []int64{1500, 2500},
+			values:     []float64{5, 7},
+		},
+	}
+}
+
+func TestEvalSelect(t *testing.T) {
+	f := func(q, epoch, resultExpected string) {
+		t.Helper()
+		stmts, err := influxql.Parse(q, 5000e6)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		ss := stmts[0].(*influxql.SelectStatement)
+		sfs, isAggr, err := getSelectFields(ss)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		tr, err := getTimeRange(ss.Where, 5000)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var result []*series
+		if isAggr {
+			result, err = evalAggrSelect(ss, sfs, "cpu", testRawSeries(), tr)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		} else {
+			result = evalRawSelect(ss, sfs, "cpu", testRawSeries())
+		}
+		results := []*statementResult{{
+			Series: result,
+		}}
+		response := QueryResponse(results, epoch)
+		if response != resultExpected {
+			t.Fatalf("unexpected response for %q\ngot\n%s\nwant\n%s", q, response, resultExpected)
+		}
+	}
+
+	// raw select
+	f(`SELECT usage FROM cpu`, "ms", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","usage"],`+
+		`"values":[[1000,1],[1500,5],[2000,2],[2500,7],[3000,3],[4000,4]]}]}]}`)
+	f(`SELECT * FROM cpu ORDER BY time DESC LIMIT 3`, "s", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","host","idle","usage"],`+
+		`"values":[[4,"a",null,4],[3,"a",30,3],[2,"b",null,7]]}]}]}`)
+	f(`SELECT usage, idle AS i, usage FROM cpu GROUP BY host`, "", `{"results":[{"statement_id":0,"series":[`+
+		`{"name":"cpu","tags":{"host":"a"},"columns":["time","usage","i","usage_1"],"values":[`+
+		`["1970-01-01T00:00:01Z",1,10,1],["1970-01-01T00:00:02Z",2,null,2],["1970-01-01T00:00:03Z",3,30,3],["1970-01-01T00:00:04Z",4,null,4]]},`+
+		`{"name":"cpu","tags":{"host":"b"},"columns":["time","usage","i","usage_1"],"values":[`+
+		`["1970-01-01T00:00:01.5Z",5,null,5],["1970-01-01T00:00:02.5Z",7,null,7]]}]}]}`)
+
+	// aggregate without GROUP BY time()
+	f(`SELECT count(usage), sum(usage), mean(idle) FROM cpu`, "ms", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","count","sum","mean"],`+
+		`"values":[[0,6,22,20]]}]}]}`)
+	f(`SELECT max(usage) FROM cpu WHERE time >= 2s GROUP BY *`, "ms", `{"results":[{"statement_id":0,"series":[`+
+		`{"name":"cpu","tags":{"host":"a"},"columns":["time","max"],"values":[[2000,4]]},`+
+		`{"name":"cpu","tags":{"host":"b"},"columns":["time","max"],"values":[[2000,7]]}]}]}`)
+
+	// aggregate with GROUP BY time()
+	f(`SELECT sum(usage) FROM cpu WHERE time >= 0 GROUP BY time(2s)`, "ms", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","sum"],`+
+		`"values":[[0,6],[2000,12],[4000,4]]}]}]}`)
+	f(`SELECT last(idle) FROM cpu WHERE time >= 0 GROUP BY time(1s) fill(previous)`, "ms", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","last"],`+
+		`"values":[[0,null],[1000,10],[2000,10],[3000,30],[4000,30],[5000,30]]}]}]}`)
+	f(`SELECT mean(idle) FROM cpu WHERE time >= 1s GROUP BY time(1s) fill(linear) LIMIT 3`, "ms", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","mean"],`+
+		`"values":[[1000,10],[2000,20],[3000,30]]}]}]}`)
+	f(`SELECT mean(idle) FROM cpu WHERE time >= 1s GROUP BY time(1s) fill(none)`, "ms", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","mean"],`+
+		`"values":[[1000,10],[3000,30]]}]}]}`)
+	f(`SELECT mean(idle) FROM cpu WHERE time >= 1s AND time < 3s GROUP BY time(1s) fill(0)`, "ms", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","mean"],`+
+		`"values":[[1000,10],[2000,0]]}]}]}`)
+	f(`SELECT derivative(max(usage), 1s) AS d FROM cpu WHERE time >= 1s GROUP BY time(1s, 500ms) fill(none)`, "ms", `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","d"],`+
+		`"values":[[1500,4],[2500,2],[3500,-3]]}]}]}`)
+}
+
+func TestGetSelectFieldsFailure(t *testing.T) {
+	f := func(q string) {
+		t.Helper()
+		stmts, err := influxql.Parse(q, 0)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		if _, _, err := getSelectFields(stmts[0].(*influxql.SelectStatement)); err == nil {
+			t.Fatalf("expecting non-nil error for %q", q)
+		}
+	}
+	f(`SELECT mean(value), value FROM m`)
+	f(`SELECT value FROM m GROUP BY time(1m)`)
+	f(`SELECT foobar(value) FROM m`)
+	f(`SELECT mean(*) FROM m`)
+	f(`SELECT mean(value, 1) FROM m`)
+	f(`SELECT percentile(value) FROM m`)
+	f(`SELECT percentile(value, 101) FROM m`)
+	f(`SELECT derivative(value) FROM m GROUP BY time(1m)`)
+	f(`SELECT derivative(mean(value)) FROM m`)
+	f(`SELECT derivative(mean(value), 1) FROM m GROUP BY time(1m)`)
+	f(`SELECT 1 FROM m`)
+}
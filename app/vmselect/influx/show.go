@@ -0,0 +1,283 @@
+package influx
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/influxql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/influxutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func (ec *evalConfig) execShowDatabases() ([]*series, error) {
+	dbs := append([]string{}, influxutil.GetDatabaseNames()...)
+	// Do not apply the db filter, since all the databases must be returned.
+	sq := storage.NewSearchQuery(0, ec.currentTimestamp, ec.etfs, *maxInfluxSeries)
+	values, err := netstorage.LabelValues(ec.qt, *influxutil.DBLabel, sq, *maxInfluxTagValues, ec.deadline)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if !slices.Contains(dbs, v) {
+			dbs = append(dbs, v)
+		}
+	}
+	if len(dbs) == 0 {
+		dbs = []string{"_internal"}
+	}
+	return []*series{newSingleColumnSeries("databases", "name", dbs)}, nil
+}
+
+// getRetentionPoliciesSeries returns the default InfluxDB retention policy, since VictoriaMetrics has a single retention.
+func getRetentionPoliciesSeries() []*series {
+	return []*series{{
+		Columns: []string{"name", "duration", "shardGroupDuration", "replicaN", "default"},
+		Values: [][]any{
+			{"autogen", "0s", "168h0m0s", 1, true},
+		},
+	}}
+}
+
+func (ec *evalConfig) execShowMeasurements(s *influxql.ShowMeasurementsStatement) ([]*series, error) {
+	var re *regexp.Regexp
+	if s.MeasurementRegexp != "" {
+		var err error
+		re, err = regexp.Compile(s.MeasurementRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse measurement regexp: %w", err)
+		}
+	}
+	measurements, err := ec.getMeasurements(s.Where)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, m := range measurements {
+		if s.Measurement != "" && m != s.Measurement {
+			continue
+		}
+		if re != nil && !re.MatchString(m) {
+			continue
+		}
+		result = append(result, m)
+	}
+	result = applyLimitOffset(result, s.Limit, s.Offset)
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return []*series{newSingleColumnSeries("measurements", "name", result)}, nil
+}
+
+func (ec *evalConfig) execShowTagKeys(s *influxql.ShowTagKeysStatement) ([]*series, error) {
+	measurements, err := ec.getMeasurementsOrDefault(s.Measurements, s.Where)
+	if err != nil {
+		return nil, err
+	}
+	var result []*series
+	for _, m := range measurements {
+		keys, err := ec.getTagKeys(m, s.Where)
+		if err != nil {
+			return nil, err
+		}
+		keys = applyLimitOffset(keys, s.Limit, s.Offset)
+		if len(keys) == 0 {
+			continue
+		}
+		result = append(result, newSingleColumnSeries(m, "tagKey", keys))
+	}
+	return result, nil
+}
+
+func (ec *evalConfig) execShowTagValues(s *influxql.ShowTagValuesStatement) ([]*series, error) {
+	var re *regexp.Regexp
+	if s.KeyOp == "=~" || s.KeyOp == "!~" {
+		var err error
+		re, err = regexp.Compile(s.Keys[0])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse key regexp: %w", err)
+		}
+	}
+	measurements, err := ec.getMeasurementsOrDefault(s.Measurements, s.Where)
+	if err != nil {
+		return nil, err
+	}
+	var result []*series
+	for _, m := range measurements {
+		var keys []string
+		switch s.KeyOp {
+		case "=", "in":
+			keys = append(keys, s.Keys...)
+			sort.Strings(keys)
+		default:
+			tagKeys, err := ec.getTagKeys(m, s.Where)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range tagKeys {
+				var ok bool
+				switch s.KeyOp {
+				case "!=":
+					ok = key != s.Keys[0]
+				case "=~":
+					ok = re.MatchString(key)
+				case "!~":
+					ok = !re.MatchString(key)
+				}
+				if ok {
+					keys = append(keys, key)
+				}
+			}
+		}
+		sq, err := ec.getShowSearchQuery(s.Where, getMetricNameFilter(m, nil))
+		if err != nil {
+			return nil, err
+		}
+		var values [][]any
+		for _, key := range keys {
+			tagValues, err := netstorage.LabelValues(ec.qt, key, sq, *maxInfluxTagValues, ec.deadline)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range tagValues {
+				values = append(values, []any{key, v})
+			}
+		}
+		values = applyLimitOffset(values, s.Limit, s.Offset)
+		if len(values) == 0 {
+			continue
+		}
+		result = append(result, &series{
+			Name:    m,
+			Columns: []string{"key", "value"},
+			Values:  values,
+		})
+	}
+	return result, nil
+}
+
+func (ec *evalConfig) execShowFieldKeys(s *influxql.ShowFieldKeysStatement) ([]*series, error) {
+	measurements, err := ec.getMeasurementsOrDefault(s.Measurements, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result []*series
+	for _, m := range measurements {
+		sq, err := ec.getShowSearchQuery(nil, getMetricNameFilter(m, nil))
+		if err != nil {
+			return nil, err
+		}
+		names, err := netstorage.LabelValues(ec.qt, "__name__", sq, *maxInfluxTagValues, ec.deadline)
+		if err != nil {
+			return nil, err
+		}
+		var fields []string
+		for _, name := range names {
+			field, ok := getFieldName(name, m)
+			if !ok {
+				continue
+			}
+			field = getRawFieldName(field)
+			if !slices.Contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		sort.Strings(fields)
+		values := make([][]any, len(fields))
+		for i, field := range fields {
+			// All the values are stored as floats.
+			values[i] = []any{field, "float"}
+		}
+		result = append(result, &series{
+			Name:    m,
+			Columns: []string{"fieldKey", "fieldType"},
+			Values:  values,
+		})
+	}
+	return result, nil
+}
+
+// getMeasurementsOrDefault returns measurements if they aren't empty. Otherwise it returns all the measurements matching where.
+func (ec *evalConfig) getMeasurementsOrDefault(measurements []string, where influxql.Cond) ([]string, error) {
+	if len(measurements) > 0 {
+		return measurements, nil
+	}
+	return ec.getMeasurements(where)
+}
+
+// getMeasurements returns sorted measurements for series matching where.
+//
+// Measurements are obtained from metric names with getMeasurementName.
+func (ec *evalConfig) getMeasurements(where influxql.Cond) ([]string, error) {
+	if *influxutil.SkipMeasurement {
+		return nil, fmt.Errorf("measurements cannot be obtained when -influxSkipMeasurement command-line flag is set")
+	}
+	sq, err := ec.getShowSearchQuery(where)
+	if err != nil {
+		return nil, err
+	}
+	names, err := netstorage.LabelValues(ec.qt, "__name__", sq, *maxInfluxTagValues, ec.deadline)
+	if err != nil {
+		return nil, err
+	}
+	var measurements []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		m := getMeasurementName(name)
+		if !seen[m] {
+			seen[m] = true
+			measurements = append(measurements, m)
+		}
+	}
+	sort.Strings(measurements)
+	return measurements, nil
+}
+
+// getTagKeys returns sorted tag keys for the given measurement and series matching where.
+func (ec *evalConfig) getTagKeys(measurement string, where influxql.Cond) ([]string, error) {
+	sq, err := ec.getShowSearchQuery(where, getMetricNameFilter(measurement, nil))
+	if err != nil {
+		return nil, err
+	}
+	labels, err := netstorage.LabelNames(ec.qt, sq, *maxInfluxTagValues, ec.deadline)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, label := range labels {
+		if label != "__name__" && label != *influxutil.DBLabel {
+			keys = append(keys, label)
+		}
+	}
+	return keys, nil
+}
+
+// getShowSearchQuery returns search query for SHOW statements with the given where condition.
+func (ec *evalConfig) getShowSearchQuery(where influxql.Cond, extraFilters ...storage.TagFilter) (*storage.SearchQuery, error) {
+	tr, err := getTimeRange(where, ec.currentTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	tfss, err := ec.getTagFilterss(where, extraFilters...)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewSearchQuery(tr.start, tr.end, tfss, *maxInfluxSeries), nil
+}
+
+func newSingleColumnSeries(name, column string, values []string) *series {
+	s := &series{
+		Name:    name,
+		Columns: []string{column},
+		Values:  make([][]any, len(values)),
+	}
+	for i, v := range values {
+		s.Values[i] = []any{v}
+	}
+	return s
+}
@@ -0,0 +1,311 @@
+package influxql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type lexer struct {
+	// Token contains the currently parsed token.
+	// An empty token means EOF.
+	Token string
+
+	sOrig string
+	sTail string
+
+	err error
+}
+
+func (lex *lexer) Context() string {
+	return fmt.Sprintf("%s%s", lex.Token, lex.sTail)
+}
+
+func (lex *lexer) Init(s string) {
+	lex.Token = ""
+
+	lex.sOrig = s
+	lex.sTail = s
+
+	lex.err = nil
+}
+
+func (lex *lexer) Next() error {
+	if lex.err != nil {
+		return lex.err
+	}
+	token, err := lex.next()
+	if err != nil {
+		lex.err = err
+		return err
+	}
+	lex.Token = token
+	return nil
+}
+
+func (lex *lexer) next() (string, error) {
+	// Skip whitespace and comments
+	s := lex.sTail
+	for {
+		i := 0
+		for i < len(s) && isSpaceChar(s[i]) {
+			i++
+		}
+		s = s[i:]
+		if !strings.HasPrefix(s, "--") {
+			break
+		}
+		n := strings.IndexByte(s, '\n')
+		if n < 0 {
+			s = ""
+		} else {
+			s = s[n+1:]
+		}
+	}
+	lex.sTail = s
+
+	if len(s) == 0 {
+		return "", nil
+	}
+
+	var token string
+	var err error
+	switch {
+	case s[0] == '"':
+		token, err = scanQuoted(s, '"')
+	case s[0] == '\'':
+		token, err = scanQuoted(s, '\'')
+	case s[0] == '/' && (lex.Token == "=~" || lex.Token == "!~"):
+		token, err = scanRegexp(s)
+	case isDigitChar(s[0]) || s[0] == '.' && len(s) > 1 && isDigitChar(s[1]):
+		token = scanNumber(s)
+	case isIdentFirstChar(s[0]):
+		token = scanIdent(s)
+	default:
+		token, err = scanOperator(s)
+	}
+	if err != nil {
+		return "", err
+	}
+	lex.sTail = s[len(token):]
+	return token, nil
+}
+
+func scanQuoted(s string, quote byte) (string, error) {
+	i := 1
+	for i < len(s) {
+		switch s[i] {
+		case '\\':
+			i += 2
+		case quote:
+			return s[:i+1], nil
+		default:
+			i++
+		}
+	}
+	return "", fmt.Errorf("cannot find closing quote %c for %s", quote, s)
+}
+
+func scanRegexp(s string) (string, error) {
+	i := 1
+	for i < len(s) {
+		switch s[i] {
+		case '\\':
+			i += 2
+		case '/':
+			return s[:i+1], nil
+		default:
+			i++
+		}
+	}
+	return "", fmt.Errorf("cannot find closing slash for regexp %s", s)
+}
+
+func scanNumber(s string) string {
+	// The number may contain duration suffixes such as 1h30m or 1600000000000ms
+	i := 0
+	for i < len(s) && (isDigitChar(s[i]) || isIdentChar(s[i]) || s[i] == '.') {
+		if (s[i] == 'e' || s[i] == 'E') && i+1 < len(s) && (s[i+1] == '-' || s[i+1] == '+') {
+			i++
+		}
+		i++
+	}
+	if strings.HasPrefix(s[i:], "µs") || strings.HasPrefix(s[i:], "µ") {
+		i += len("µ")
+		if i < len(s) && s[i] == 's' {
+			i++
+		}
+	}
+	return s[:i]
+}
+
+func scanIdent(s string) string {
+	i := 0
+	for i < len(s) && isIdentChar(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+func scanOperator(s string) (string, error) {
+	for _, op := range []string{"=~", "!~", "!=", "<>", "<=", ">=", "=", "<", ">", "+", "-", "*", "/", "(", ")", ",", ";", "."} {
+		if strings.HasPrefix(s, op) {
+			return op, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected char %q", s[:1])
+}
+
+func isSpaceChar(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	default:
+		return false
+	}
+}
+
+func isDigitChar(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentFirstChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentFirstChar(c) || isDigitChar(c)
+}
+
+func isKeyword(token, keyword string) bool {
+	return strings.EqualFold(token, keyword)
+}
+
+func isIdentToken(token string) bool {
+	return len(token) > 0 && (token[0] == '"' || isIdentFirstChar(token[0]))
+}
+
+func isStringToken(token string) bool {
+	return len(token) > 0 && token[0] == '\''
+}
+
+func isRegexpToken(token string) bool {
+	return len(token) > 0 && token[0] == '/'
+}
+
+func isNumberToken(token string) bool {
+	return len(token) > 0 && (isDigitChar(token[0]) || token[0] == '.')
+}
+
+// unquoteToken returns unquoted value for the given quoted identifier, string or regexp token.
+func unquoteToken(token string) string {
+	if len(token) < 2 {
+		return token
+	}
+	quote := token[0]
+	if quote != '"' && quote != '\'' && quote != '/' {
+		return token
+	}
+	s := token[1 : len(token)-1]
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			next := s[i+1]
+			if next == quote || quote != '/' && next == '\\' {
+				// Regexps preserve escaped backslashes, since they are part of the regexp syntax.
+				b.WriteByte(next)
+				i++
+				continue
+			}
+			if quote != '/' {
+				switch next {
+				case 'n':
+					b.WriteByte('\n')
+					i++
+					continue
+				case 't':
+					b.WriteByte('\t')
+					i++
+					continue
+				}
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// parseNumber parses the given number token without duration suffix.
+func parseNumber(token string) (float64, error) {
+	f, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse number %q: %w", token, err)
+	}
+	return f, nil
+}
+
+// parseDuration parses InfluxQL duration such as 1h30m and returns it in nanoseconds.
+//
+// Integers without suffix are treated as nanoseconds.
+func parseDuration(token string) (int64, error) {
+	if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+		return n, nil
+	}
+	if len(token) == 0 {
+		return 0, fmt.Errorf("duration cannot be empty")
+	}
+	s := token
+	var d int64
+	for len(s) > 0 {
+		i := 0
+		for i < len(s) && isDigitChar(s[i]) {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("cannot parse duration %q", token)
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse duration %q: %w", token, err)
+		}
+		s = s[i:]
+		unit, mult := getDurationUnit(s)
+		if mult == 0 {
+			return 0, fmt.Errorf("unknown unit in duration %q; supported units: ns, u, µ, ms, s, m, h, d, w", token)
+		}
+		s = s[len(unit):]
+		d += n * mult
+	}
+	return d, nil
+}
+
+func getDurationUnit(s string) (string, int64) {
+	for _, u := range durationUnits {
+		if strings.HasPrefix(s, u.unit) {
+			return u.unit, u.mult
+		}
+	}
+	return "", 0
+}
+
+// durationUnits contains supported duration units in the order of matching.
+var durationUnits = []struct {
+	unit string
+	mult int64
+}{
+	{"ns", 1},
+	{"µs", 1e3},
+	{"µ", 1e3},
+	{"us", 1e3},
+	{"u", 1e3},
+	{"ms", 1e6},
+	{"s", 1e9},
+	{"m", 60e9},
+	{"h", 3600e9},
+	{"d", 24 * 3600e9},
+	{"w", 7 * 24 * 3600e9},
+}
@@ -0,0 +1,103 @@
+package influxql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLexerSuccess(t *testing.T) {
+	f := func(s string, tokensExpected []string) {
+		t.Helper()
+		var lex lexer
+		var tokens []string
+		lex.Init(s)
+		for {
+			if err := lex.Next(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if lex.Token == "" {
+				break
+			}
+			tokens = append(tokens, lex.Token)
+		}
+		if !reflect.DeepEqual(tokens, tokensExpected) {
+			t.Fatalf("unexpected tokens; got\n%q\nwant\n%q", tokens, tokensExpected)
+		}
+	}
+	f("", nil)
+	f("  -- comment", nil)
+	f("SELECT mean(value) FROM cpu", []string{"SELECT", "mean", "(", "value", ")", "FROM", "cpu"})
+	f(`select "a b" from "db"."rp"."m"`, []string{"select", `"a b"`, "from", `"db"`, ".", `"rp"`, ".", `"m"`})
+	f(`host='a\'b' and x<>'c'`, []string{"host", "=", `'a\'b'`, "and", "x", "<>", `'c'`})
+	f(`host=~/a\/b.+/ OR host !~ /c/`, []string{"host", "=~", `/a\/b.+/`, "OR", "host", "!~", `/c/`})
+	f("time > now() - 1h30m", []string{"time", ">", "now", "(", ")", "-", "1h30m"})
+	f("time >= 1600000000000ms and time<=1600000000000000000", []string{"time", ">=", "1600000000000ms", "and", "time", "<=", "1600000000000000000"})
+	f("fill(-1.5e-3);show databases", []string{"fill", "(", "-", "1.5e-3", ")", ";", "show", "databases"})
+	f("time(10µs)", []string{"time", "(", "10µs", ")"})
+	f("a / 2", []string{"a", "/", "2"})
+}
+
+func TestLexerError(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		var lex lexer
+		lex.Init(s)
+		for {
+			if err := lex.Next(); err != nil {
+				// Make sure lex.Next() consistently returns the error.
+				if err1 := lex.Next(); err1 != err {
+					t.Fatalf("unexpected error returned; got %v; want %v", err1, err)
+				}
+				return
+			}
+			if lex.Token == "" {
+				t.Fatalf("expecting non-nil error when parsing %q", s)
+			}
+		}
+	}
+
+	// unclosed quotes
+	f(`"foo`)
+	f(`'foo`)
+	f(`a =~ /foo`)
+
+	// unexpected chars
+	f("a ~ b")
+	f("a & b")
+}
+
+func TestParseDurationSuccess(t *testing.T) {
+	f := func(s string, dExpected int64) {
+		t.Helper()
+		d, err := parseDuration(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if d != dExpected {
+			t.Fatalf("unexpected duration for %q; got %d; want %d", s, d, dExpected)
+		}
+	}
+	f("123", 123)
+	f("10ns", 10)
+	f("10u", 10e3)
+	f("10µs", 10e3)
+	f("10ms", 10e6)
+	f("10s", 10e9)
+	f("10m", 600e9)
+	f("1h30m", 5400e9)
+	f("2d", 2*24*3600e9)
+	f("1w", 7*24*3600e9)
+}
+
+func TestParseDurationFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, err := parseDuration(s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+	f("")
+	f("1.5h")
+	f("10x")
+	f("h")
+}
@@ -0,0 +1,1137 @@
+package influxql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statement is an InfluxQL statement.
+//
+// The following statements are supported:
+//
+//   - *SelectStatement
+//   - *CreateDatabaseStatement
+//   - *ShowDatabasesStatement
+//   - *ShowRetentionPoliciesStatement
+//   - *ShowMeasurementsStatement
+//   - *ShowTagKeysStatement
+//   - *ShowTagValuesStatement
+//   - *ShowFieldKeysStatement
+type Statement interface {
+	isStatement()
+}
+
+// SelectStatement is `SELECT ... FROM ...` statement.
+type SelectStatement struct {
+	// Fields contains the selected fields.
+	Fields []*Field
+
+	// Measurements contains measurements from FROM clause.
+	Measurements []string
+
+	// Where is an optional condition from WHERE clause.
+	Where Cond
+
+	// GroupByInterval is the interval in nanoseconds from `GROUP BY time(interval)`.
+	GroupByInterval int64
+
+	// GroupByOffset is the offset in nanoseconds from `GROUP BY time(interval, offset)`.
+	GroupByOffset int64
+
+	// GroupByTags contains tags from GROUP BY clause.
+	GroupByTags []string
+
+	// GroupByAllTags is set for `GROUP BY *`.
+	GroupByAllTags bool
+
+	// Fill is the fill option from fill(...) clause.
+	Fill Fill
+
+	// OrderDesc is set for `ORDER BY time DESC`.
+	OrderDesc bool
+
+	// Limit, Offset, SLimit and SOffset contain values for LIMIT, OFFSET, SLIMIT and SOFFSET clauses.
+	Limit   int
+	Offset  int
+	SLimit  int
+	SOffset int
+}
+
+// Field is a field in SELECT statement.
+type Field struct {
+	Expr  Expr
+	Alias string
+}
+
+// Fill is the fill option for empty time buckets.
+type Fill struct {
+	// Mode is one of null, none, previous, linear or value.
+	Mode string
+
+	// Value is the value for empty buckets if Mode is value.
+	Value float64
+}
+
+// CreateDatabaseStatement is `CREATE DATABASE` statement.
+type CreateDatabaseStatement struct {
+	Name string
+}
+
+// ShowDatabasesStatement is `SHOW DATABASES` statement.
+type ShowDatabasesStatement struct{}
+
+// ShowRetentionPoliciesStatement is `SHOW RETENTION POLICIES` statement.
+type ShowRetentionPoliciesStatement struct{}
+
+// ShowMeasurementsStatement is `SHOW MEASUREMENTS` statement.
+type ShowMeasurementsStatement struct {
+	// DB is the database from ON clause.
+	DB string
+
+	// Measurement is the measurement from `WITH MEASUREMENT = name` clause.
+	Measurement string
+
+	// MeasurementRegexp is the regexp from `WITH MEASUREMENT =~ /regexp/` clause.
+	MeasurementRegexp string
+
+	Where  Cond
+	Limit  int
+	Offset int
+}
+
+// ShowTagKeysStatement is `SHOW TAG KEYS` statement.
+type ShowTagKeysStatement struct {
+	// DB is the database from ON clause.
+	DB string
+
+	Measurements []string
+	Where        Cond
+	Limit        int
+	Offset       int
+}
+
+// ShowTagValuesStatement is `SHOW TAG VALUES` statement.
+type ShowTagValuesStatement struct {
+	// DB is the database from ON clause.
+	DB string
+
+	Measurements []string
+
+	// KeyOp is the operation from `WITH KEY` clause. It is one of =, !=, =~, !~ or in.
+	KeyOp string
+
+	// Keys contains the keys from `WITH KEY` clause. It contains a single regexp for =~ and !~ operations.
+	Keys []string
+
+	Where  Cond
+	Limit  int
+	Offset int
+}
+
+// ShowFieldKeysStatement is `SHOW FIELD KEYS` statement.
+type ShowFieldKeysStatement struct {
+	// DB is the database from ON clause.
+	DB string
+
+	Measurements []string
+}
+
+func (*SelectStatement) isStatement()                {}
+func (*CreateDatabaseStatement) isStatement()        {}
+func (*ShowDatabasesStatement) isStatement()         {}
+func (*ShowRetentionPoliciesStatement) isStatement() {}
+func (*ShowMeasurementsStatement) isStatement()      {}
+func (*ShowTagKeysStatement) isStatement()           {}
+func (*ShowTagValuesStatement) isStatement()         {}
+func (*ShowFieldKeysStatement) isStatement()         {}
+
+// Expr is an expression in SELECT fields.
+//
+// The following expressions are supported:
+//
+//   - *Call
+//   - *VarRef
+//   - *Wildcard
+//   - *NumberLiteral
+//   - *DurationLiteral
+type Expr interface {
+	isExpr()
+}
+
+// Call is a function call such as mean(value).
+type Call struct {
+	// Name is the function name in lowercase.
+	Name string
+
+	Args []Expr
+}
+
+// VarRef is a reference to field.
+type VarRef struct {
+	Name string
+}
+
+// Wildcard is `*` in SELECT fields.
+type Wildcard struct{}
+
+// NumberLiteral is a numeric literal.
+type NumberLiteral struct {
+	N float64
+}
+
+// DurationLiteral is a duration literal.
+type DurationLiteral struct {
+	// D is the duration in nanoseconds.
+	D int64
+}
+
+func (*Call) isExpr()            {}
+func (*VarRef) isExpr()          {}
+func (*Wildcard) isExpr()        {}
+func (*NumberLiteral) isExpr()   {}
+func (*DurationLiteral) isExpr() {}
+
+// Cond is a condition in WHERE clause.
+//
+// The following conditions are supported:
+//
+//   - *BinaryCond
+//   - *TagCond
+//   - *TimeCond
+type Cond interface {
+	isCond()
+}
+
+// BinaryCond is `Left AND Right` or `Left OR Right` condition.
+type BinaryCond struct {
+	// Op is either and or or.
+	Op string
+
+	Left  Cond
+	Right Cond
+}
+
+// TagCond is a condition on tag value.
+type TagCond struct {
+	Key string
+
+	// Op is one of =, !=, =~ or !~.
+	Op string
+
+	// Value is the tag value or regexp for =~ and !~ operations.
+	Value string
+}
+
+// TimeCond is a condition on time.
+type TimeCond struct {
+	// Op is one of =, <, <=, > or >=.
+	Op string
+
+	// Timestamp is the timestamp in nanoseconds.
+	Timestamp int64
+}
+
+func (*BinaryCond) isCond() {}
+func (*TagCond) isCond()    {}
+func (*TimeCond) isCond()   {}
+
+// Parse parses InfluxQL statements separated by semicolons from s.
+//
+// currentTimestamp is the current time in nanoseconds, which is used for now() calls.
+func Parse(s string, currentTimestamp int64) ([]Statement, error) {
+	var p parser
+	p.lex.Init(s)
+	p.currentTimestamp = currentTimestamp
+	if err := p.lex.Next(); err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", s, err)
+	}
+	var stmts []Statement
+	for p.lex.Token != "" {
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w; context: %q", s, err, p.lex.Context())
+		}
+		stmts = append(stmts, stmt)
+		if p.lex.Token == "" {
+			break
+		}
+		if p.lex.Token != ";" {
+			return nil, fmt.Errorf("cannot parse %q: unexpected token %q; want ';'; context: %q", s, p.lex.Token, p.lex.Context())
+		}
+		if err := p.lex.Next(); err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", s, err)
+		}
+	}
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("missing statement in %q", s)
+	}
+	return stmts, nil
+}
+
+type parser struct {
+	lex              lexer
+	currentTimestamp int64
+}
+
+func (p *parser) next() error {
+	return p.lex.Next()
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !isKeyword(p.lex.Token, keyword) {
+		return fmt.Errorf("unexpected token %q; want %s", p.lex.Token, strings.ToUpper(keyword))
+	}
+	return p.next()
+}
+
+func (p *parser) expectToken(token string) error {
+	if p.lex.Token != token {
+		return fmt.Errorf("unexpected token %q; want %q", p.lex.Token, token)
+	}
+	return p.next()
+}
+
+func (p *parser) parseStatement() (Statement, error) {
+	switch {
+	case isKeyword(p.lex.Token, "select"):
+		return p.parseSelect()
+	case isKeyword(p.lex.Token, "show"):
+		return p.parseShow()
+	case isKeyword(p.lex.Token, "create"):
+		return p.parseCreateDatabase()
+	default:
+		return nil, fmt.Errorf("unsupported statement starting with %q; supported statements: SELECT, SHOW, CREATE DATABASE", p.lex.Token)
+	}
+}
+
+// parseCreateDatabase parses `CREATE DATABASE name [WITH ...]` statement.
+//
+// Retention policy options from WITH clause are ignored.
+func (p *parser) parseCreateDatabase() (*CreateDatabaseStatement, error) {
+	if err := p.expectKeyword("create"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("database"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	if isKeyword(p.lex.Token, "with") {
+		for p.lex.Token != "" && p.lex.Token != ";" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &CreateDatabaseStatement{
+		Name: name,
+	}, nil
+}
+
+func (p *parser) parseSelect() (*SelectStatement, error) {
+	if err := p.expectKeyword("select"); err != nil {
+		return nil, err
+	}
+	var ss SelectStatement
+	for {
+		f, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		ss.Fields = append(ss.Fields, f)
+		if p.lex.Token != "," {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	ms, err := p.parseMeasurements()
+	if err != nil {
+		return nil, err
+	}
+	ss.Measurements = ms
+	if isKeyword(p.lex.Token, "where") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		cond, err := p.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		ss.Where = cond
+	}
+	if isKeyword(p.lex.Token, "group") {
+		if err := p.parseGroupBy(&ss); err != nil {
+			return nil, err
+		}
+	}
+	ss.Fill.Mode = "null"
+	if isKeyword(p.lex.Token, "fill") {
+		fill, err := p.parseFill()
+		if err != nil {
+			return nil, err
+		}
+		ss.Fill = fill
+	}
+	if isKeyword(p.lex.Token, "order") {
+		desc, err := p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+		ss.OrderDesc = desc
+	}
+	for _, x := range []struct {
+		keyword string
+		dst     *int
+	}{
+		{"limit", &ss.Limit},
+		{"offset", &ss.Offset},
+		{"slimit", &ss.SLimit},
+		{"soffset", &ss.SOffset},
+	} {
+		if !isKeyword(p.lex.Token, x.keyword) {
+			continue
+		}
+		n, err := p.parseLimit()
+		if err != nil {
+			return nil, err
+		}
+		*x.dst = n
+	}
+	if isKeyword(p.lex.Token, "tz") {
+		return nil, fmt.Errorf("tz() clause isn't supported")
+	}
+	return &ss, nil
+}
+
+func (p *parser) parseField() (*Field, error) {
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	f := &Field{
+		Expr: expr,
+	}
+	if isKeyword(p.lex.Token, "as") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		alias, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		f.Alias = alias
+	}
+	return f, nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	token := p.lex.Token
+	switch {
+	case token == "*":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return &Wildcard{}, nil
+	case isNumberToken(token):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if n, err := parseNumber(token); err == nil {
+			return &NumberLiteral{N: n}, nil
+		}
+		d, err := parseDuration(token)
+		if err != nil {
+			return nil, err
+		}
+		return &DurationLiteral{D: d}, nil
+	case isIdentToken(token):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name := unquoteToken(token)
+		if token[0] == '"' || p.lex.Token != "(" {
+			return &VarRef{Name: name}, nil
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		c := &Call{
+			Name: strings.ToLower(name),
+		}
+		for p.lex.Token != ")" {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			c.Args = append(c.Args, arg)
+			if p.lex.Token == ")" {
+				break
+			}
+			if err := p.expectToken(","); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unexpected token %q in field expression", token)
+	}
+}
+
+func (p *parser) parseIdent() (string, error) {
+	token := p.lex.Token
+	if !isIdentToken(token) {
+		return "", fmt.Errorf("unexpected token %q; want identifier", token)
+	}
+	if err := p.next(); err != nil {
+		return "", err
+	}
+	return unquoteToken(token), nil
+}
+
+// parseMeasurements parses comma-separated list of measurements in FROM clause.
+//
+// Database and retention policy prefixes such as "db"."rp"."measurement" are ignored.
+func (p *parser) parseMeasurements() ([]string, error) {
+	var ms []string
+	for {
+		if isRegexpToken(p.lex.Token) || p.lex.Token == "/" {
+			return nil, fmt.Errorf("regexps in FROM clause aren't supported")
+		}
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		for p.lex.Token == "." {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if p.lex.Token == "." {
+				// db..measurement
+				continue
+			}
+			name, err = p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+		}
+		ms = append(ms, name)
+		if p.lex.Token != "," {
+			return ms, nil
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseGroupBy(ss *SelectStatement) error {
+	if err := p.expectKeyword("group"); err != nil {
+		return err
+	}
+	if err := p.expectKeyword("by"); err != nil {
+		return err
+	}
+	for {
+		switch {
+		case p.lex.Token == "*":
+			ss.GroupByAllTags = true
+			if err := p.next(); err != nil {
+				return err
+			}
+		case isKeyword(p.lex.Token, "time"):
+			if err := p.next(); err != nil {
+				return err
+			}
+			if p.lex.Token != "(" {
+				ss.GroupByTags = append(ss.GroupByTags, "time")
+				break
+			}
+			if err := p.next(); err != nil {
+				return err
+			}
+			interval, err := p.parseDurationToken()
+			if err != nil {
+				return err
+			}
+			if interval <= 0 {
+				return fmt.Errorf("GROUP BY time() interval must be positive")
+			}
+			ss.GroupByInterval = interval
+			if p.lex.Token == "," {
+				if err := p.next(); err != nil {
+					return err
+				}
+				sign := int64(1)
+				if p.lex.Token == "-" {
+					sign = -1
+					if err := p.next(); err != nil {
+						return err
+					}
+				}
+				offset, err := p.parseDurationToken()
+				if err != nil {
+					return err
+				}
+				ss.GroupByOffset = sign * offset
+			}
+			if err := p.expectToken(")"); err != nil {
+				return err
+			}
+		case isRegexpToken(p.lex.Token) || p.lex.Token == "/":
+			return fmt.Errorf("regexps in GROUP BY clause aren't supported")
+		default:
+			tag, err := p.parseIdent()
+			if err != nil {
+				return err
+			}
+			ss.GroupByTags = append(ss.GroupByTags, tag)
+		}
+		if p.lex.Token != "," {
+			return nil
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) parseDurationToken() (int64, error) {
+	token := p.lex.Token
+	if !isNumberToken(token) {
+		return 0, fmt.Errorf("unexpected token %q; want duration", token)
+	}
+	d, err := parseDuration(token)
+	if err != nil {
+		return 0, err
+	}
+	if err := p.next(); err != nil {
+		return 0, err
+	}
+	return d, nil
+}
+
+func (p *parser) parseFill() (Fill, error) {
+	var fill Fill
+	if err := p.expectKeyword("fill"); err != nil {
+		return fill, err
+	}
+	if err := p.expectToken("("); err != nil {
+		return fill, err
+	}
+	token := p.lex.Token
+	sign := 1.0
+	if token == "-" {
+		sign = -1
+		if err := p.next(); err != nil {
+			return fill, err
+		}
+		token = p.lex.Token
+	}
+	switch {
+	case isNumberToken(token):
+		n, err := parseNumber(token)
+		if err != nil {
+			return fill, err
+		}
+		fill.Mode = "value"
+		fill.Value = sign * n
+	case isKeyword(token, "null"), isKeyword(token, "none"), isKeyword(token, "previous"), isKeyword(token, "linear"):
+		fill.Mode = strings.ToLower(token)
+	default:
+		return fill, fmt.Errorf("unsupported fill option %q; supported options: null, none, previous, linear or a number", token)
+	}
+	if err := p.next(); err != nil {
+		return fill, err
+	}
+	if err := p.expectToken(")"); err != nil {
+		return fill, err
+	}
+	return fill, nil
+}
+
+func (p *parser) parseOrderBy() (bool, error) {
+	if err := p.expectKeyword("order"); err != nil {
+		return false, err
+	}
+	if err := p.expectKeyword("by"); err != nil {
+		return false, err
+	}
+	if err := p.expectKeyword("time"); err != nil {
+		return false, fmt.Errorf("only ORDER BY time is supported: %w", err)
+	}
+	desc := false
+	switch {
+	case isKeyword(p.lex.Token, "desc"):
+		desc = true
+		if err := p.next(); err != nil {
+			return false, err
+		}
+	case isKeyword(p.lex.Token, "asc"):
+		if err := p.next(); err != nil {
+			return false, err
+		}
+	}
+	return desc, nil
+}
+
+func (p *parser) parseLimit() (int, error) {
+	if err := p.next(); err != nil {
+		return 0, err
+	}
+	token := p.lex.Token
+	n, err := strconv.Atoi(token)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("unexpected token %q; want non-negative integer", token)
+	}
+	if err := p.next(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (p *parser) parseCond() (Cond, error) {
+	left, err := p.parseAndCond()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.lex.Token, "or") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAndCond()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryCond{
+			Op:    "or",
+			Left:  left,
+			Right: right,
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAndCond() (Cond, error) {
+	left, err := p.parsePrimaryCond()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.lex.Token, "and") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parsePrimaryCond()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryCond{
+			Op:    "and",
+			Left:  left,
+			Right: right,
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimaryCond() (Cond, error) {
+	if p.lex.Token == "(" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		cond, err := p.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectToken(")"); err != nil {
+			return nil, err
+		}
+		return cond, nil
+	}
+	keyToken := p.lex.Token
+	key, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	op := p.lex.Token
+	switch op {
+	case "=", "!=", "<>", "=~", "!~", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("unexpected token %q; want comparison operator", op)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if keyToken[0] != '"' && isKeyword(key, "time") {
+		if op == "!=" || op == "<>" || op == "=~" || op == "!~" {
+			return nil, fmt.Errorf("unsupported operator %q for time", op)
+		}
+		ts, err := p.parseTimeExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &TimeCond{
+			Op:        op,
+			Timestamp: ts,
+		}, nil
+	}
+	token := p.lex.Token
+	switch op {
+	case "=", "!=", "<>":
+		if !isStringToken(token) {
+			return nil, fmt.Errorf("unsupported condition on %q; only comparisons of tags with 'string' values are supported; conditions on fields aren't supported", key)
+		}
+		if op == "<>" {
+			op = "!="
+		}
+	case "=~", "!~":
+		if !isRegexpToken(token) {
+			return nil, fmt.Errorf("unexpected token %q; want /regexp/", token)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operator %q for %q; conditions on fields aren't supported", op, key)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return &TagCond{
+		Key:   key,
+		Op:    op,
+		Value: unquoteToken(token),
+	}, nil
+}
+
+// parseTimeExpr parses time expression such as `now() - 1h` and returns the corresponding timestamp in nanoseconds.
+func (p *parser) parseTimeExpr() (int64, error) {
+	ts, err := p.parseTimeTerm()
+	if err != nil {
+		return 0, err
+	}
+	for p.lex.Token == "+" || p.lex.Token == "-" {
+		sign := int64(1)
+		if p.lex.Token == "-" {
+			sign = -1
+		}
+		if err := p.next(); err != nil {
+			return 0, err
+		}
+		d, err := p.parseDurationToken()
+		if err != nil {
+			return 0, err
+		}
+		ts += sign * d
+	}
+	return ts, nil
+}
+
+func (p *parser) parseTimeTerm() (int64, error) {
+	token := p.lex.Token
+	switch {
+	case isKeyword(token, "now"):
+		if err := p.next(); err != nil {
+			return 0, err
+		}
+		if err := p.expectToken("("); err != nil {
+			return 0, err
+		}
+		if err := p.expectToken(")"); err != nil {
+			return 0, err
+		}
+		return p.currentTimestamp, nil
+	case isStringToken(token):
+		ts, err := parseTimeString(unquoteToken(token))
+		if err != nil {
+			return 0, err
+		}
+		if err := p.next(); err != nil {
+			return 0, err
+		}
+		return ts, nil
+	case isNumberToken(token):
+		// Integer without suffix is a timestamp in nanoseconds.
+		// Integer with suffix is a duration since Unix epoch.
+		return p.parseDurationToken()
+	default:
+		return 0, fmt.Errorf("unexpected token %q; want time", token)
+	}
+}
+
+func parseTimeString(s string) (int64, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t.UnixNano(), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot parse time %q; supported formats: RFC3339, 2006-01-02 15:04:05, 2006-01-02", s)
+}
+
+func (p *parser) parseShow() (Statement, error) {
+	if err := p.expectKeyword("show"); err != nil {
+		return nil, err
+	}
+	switch {
+	case isKeyword(p.lex.Token, "databases"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return &ShowDatabasesStatement{}, nil
+	case isKeyword(p.lex.Token, "retention"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("policies"); err != nil {
+			return nil, err
+		}
+		if _, err := p.parseOnDB(); err != nil {
+			return nil, err
+		}
+		return &ShowRetentionPoliciesStatement{}, nil
+	case isKeyword(p.lex.Token, "measurements"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return p.parseShowMeasurements()
+	case isKeyword(p.lex.Token, "tag"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		switch {
+		case isKeyword(p.lex.Token, "keys"):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			return p.parseShowTagKeys()
+		case isKeyword(p.lex.Token, "values"):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			return p.parseShowTagValues()
+		default:
+			return nil, fmt.Errorf("unexpected token %q; want KEYS or VALUES", p.lex.Token)
+		}
+	case isKeyword(p.lex.Token, "field"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("keys"); err != nil {
+			return nil, err
+		}
+		var s ShowFieldKeysStatement
+		db, err := p.parseOnDB()
+		if err != nil {
+			return nil, err
+		}
+		s.DB = db
+		if s.Measurements, err = p.parseOptionalFrom(); err != nil {
+			return nil, err
+		}
+		return &s, nil
+	default:
+		return nil, fmt.Errorf("unsupported SHOW statement %q; supported statements: SHOW DATABASES, SHOW RETENTION POLICIES, "+
+			"SHOW MEASUREMENTS, SHOW TAG KEYS, SHOW TAG VALUES, SHOW FIELD KEYS", p.lex.Token)
+	}
+}
+
+func (p *parser) parseOnDB() (string, error) {
+	if !isKeyword(p.lex.Token, "on") {
+		return "", nil
+	}
+	if err := p.next(); err != nil {
+		return "", err
+	}
+	return p.parseIdent()
+}
+
+func (p *parser) parseOptionalFrom() ([]string, error) {
+	if !isKeyword(p.lex.Token, "from") {
+		return nil, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return p.parseMeasurements()
+}
+
+func (p *parser) parseOptionalWhere() (Cond, error) {
+	if !isKeyword(p.lex.Token, "where") {
+		return nil, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return p.parseCond()
+}
+
+func (p *parser) parseLimitOffset(limit, offset *int) error {
+	if isKeyword(p.lex.Token, "limit") {
+		n, err := p.parseLimit()
+		if err != nil {
+			return err
+		}
+		*limit = n
+	}
+	if isKeyword(p.lex.Token, "offset") {
+		n, err := p.parseLimit()
+		if err != nil {
+			return err
+		}
+		*offset = n
+	}
+	return nil
+}
+
+func (p *parser) parseShowMeasurements() (*ShowMeasurementsStatement, error) {
+	var s ShowMeasurementsStatement
+	db, err := p.parseOnDB()
+	if err != nil {
+		return nil, err
+	}
+	s.DB = db
+	if isKeyword(p.lex.Token, "with") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("measurement"); err != nil {
+			return nil, err
+		}
+		switch p.lex.Token {
+		case "=":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if s.Measurement, err = p.parseIdent(); err != nil {
+				return nil, err
+			}
+		case "=~":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if !isRegexpToken(p.lex.Token) {
+				return nil, fmt.Errorf("unexpected token %q; want /regexp/", p.lex.Token)
+			}
+			s.MeasurementRegexp = unquoteToken(p.lex.Token)
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected token %q; want '=' or '=~'", p.lex.Token)
+		}
+	}
+	if s.Where, err = p.parseOptionalWhere(); err != nil {
+		return nil, err
+	}
+	if err := p.parseLimitOffset(&s.Limit, &s.Offset); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (p *parser) parseShowTagKeys() (*ShowTagKeysStatement, error) {
+	var s ShowTagKeysStatement
+	db, err := p.parseOnDB()
+	if err != nil {
+		return nil, err
+	}
+	s.DB = db
+	if s.Measurements, err = p.parseOptionalFrom(); err != nil {
+		return nil, err
+	}
+	if s.Where, err = p.parseOptionalWhere(); err != nil {
+		return nil, err
+	}
+	if err := p.parseLimitOffset(&s.Limit, &s.Offset); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (p *parser) parseShowTagValues() (*ShowTagValuesStatement, error) {
+	var s ShowTagValuesStatement
+	db, err := p.parseOnDB()
+	if err != nil {
+		return nil, err
+	}
+	s.DB = db
+	if s.Measurements, err = p.parseOptionalFrom(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("with"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("key"); err != nil {
+		return nil, err
+	}
+	op := p.lex.Token
+	switch {
+	case op == "=" || op == "!=" || op == "<>":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		key, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		if op == "<>" {
+			op = "!="
+		}
+		s.KeyOp = op
+		s.Keys = []string{key}
+	case op == "=~" || op == "!~":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if !isRegexpToken(p.lex.Token) {
+			return nil, fmt.Errorf("unexpected token %q; want /regexp/", p.lex.Token)
+		}
+		s.KeyOp = op
+		s.Keys = []string{unquoteToken(p.lex.Token)}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	case isKeyword(op, "in"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expectToken("("); err != nil {
+			return nil, err
+		}
+		s.KeyOp = "in"
+		for {
+			key, err := p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+			s.Keys = append(s.Keys, key)
+			if p.lex.Token != "," {
+				break
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectToken(")"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected token %q; want '=', '!=', '=~', '!~' or IN", op)
+	}
+	if s.Where, err = p.parseOptionalWhere(); err != nil {
+		return nil, err
+	}
+	if err := p.parseLimitOffset(&s.Limit, &s.Offset); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,247 @@
+package influxql
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testCurrentTimestamp = 1700000000e9
+
+func TestParseSelectSuccess(t *testing.T) {
+	f := func(s string, ssExpected *SelectStatement) {
+		t.Helper()
+		stmts, err := Parse(s, testCurrentTimestamp)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(stmts) != 1 {
+			t.Fatalf("unexpected number of statements; got %d; want 1", len(stmts))
+		}
+		ss, ok := stmts[0].(*SelectStatement)
+		if !ok {
+			t.Fatalf("unexpected statement type %T; want *SelectStatement", stmts[0])
+		}
+		if !reflect.DeepEqual(ss, ssExpected) {
+			t.Fatalf("unexpected statement\ngot\n%#v\nwant\n%#v", ss, ssExpected)
+		}
+	}
+
+	// raw select
+	f(`SELECT value FROM cpu`, &SelectStatement{
+		Fields: []*Field{
+			{Expr: &VarRef{Name: "value"}},
+		},
+		Measurements: []string{"cpu"},
+		Fill:         Fill{Mode: "null"},
+	})
+	f(`select * from "telegraf"."autogen"."cpu" limit 10 offset 2`, &SelectStatement{
+		Fields: []*Field{
+			{Expr: &Wildcard{}},
+		},
+		Measurements: []string{"cpu"},
+		Fill:         Fill{Mode: "null"},
+		Limit:        10,
+		Offset:       2,
+	})
+
+	// Grafana-like query
+	f(`SELECT mean("usage_idle") AS "idle", max(usage_user) FROM "cpu" WHERE ("host" =~ /^web-.+$/ AND cpu != 'cpu-total') `+
+		`AND time >= 1600000000000ms and time <= now() - 5m GROUP BY time(1m), "host" fill(none) ORDER BY time DESC SLIMIT 5`, &SelectStatement{
+		Fields: []*Field{
+			{
+				Expr:  &Call{Name: "mean", Args: []Expr{&VarRef{Name: "usage_idle"}}},
+				Alias: "idle",
+			},
+			{
+				Expr: &Call{Name: "max", Args: []Expr{&VarRef{Name: "usage_user"}}},
+			},
+		},
+		Measurements: []string{"cpu"},
+		Where: &BinaryCond{
+			Op: "and",
+			Left: &BinaryCond{
+				Op: "and",
+				Left: &BinaryCond{
+					Op:    "and",
+					Left:  &TagCond{Key: "host", Op: "=~", Value: "^web-.+$"},
+					Right: &TagCond{Key: "cpu", Op: "!=", Value: "cpu-total"},
+				},
+				Right: &TimeCond{Op: ">=", Timestamp: 1600000000000e6},
+			},
+			Right: &TimeCond{Op: "<=", Timestamp: testCurrentTimestamp - 300e9},
+		},
+		GroupByInterval: 60e9,
+		GroupByTags:     []string{"host"},
+		Fill:            Fill{Mode: "none"},
+		OrderDesc:       true,
+		SLimit:          5,
+	})
+
+	// functions with extra args
+	f(`SELECT percentile(value, 95), non_negative_derivative(max(value), 1s) FROM m WHERE time > '2020-01-02T03:04:05Z' OR a <> 'b' `+
+		`GROUP BY time(5m, -1m), * fill(-1)`, &SelectStatement{
+		Fields: []*Field{
+			{
+				Expr: &Call{Name: "percentile", Args: []Expr{&VarRef{Name: "value"}, &NumberLiteral{N: 95}}},
+			},
+			{
+				Expr: &Call{Name: "non_negative_derivative", Args: []Expr{
+					&Call{Name: "max", Args: []Expr{&VarRef{Name: "value"}}},
+					&DurationLiteral{D: 1e9},
+				}},
+			},
+		},
+		Measurements: []string{"m"},
+		Where: &BinaryCond{
+			Op:    "or",
+			Left:  &TimeCond{Op: ">", Timestamp: 1577934245e9},
+			Right: &TagCond{Key: "a", Op: "!=", Value: "b"},
+		},
+		GroupByInterval: 300e9,
+		GroupByOffset:   -60e9,
+		GroupByAllTags:  true,
+		Fill:            Fill{Mode: "value", Value: -1},
+	})
+}
+
+func TestParseShowSuccess(t *testing.T) {
+	f := func(s string, stmtExpected Statement) {
+		t.Helper()
+		stmts, err := Parse(s, testCurrentTimestamp)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(stmts) != 1 {
+			t.Fatalf("unexpected number of statements; got %d; want 1", len(stmts))
+		}
+		if !reflect.DeepEqual(stmts[0], stmtExpected) {
+			t.Fatalf("unexpected statement\ngot\n%#v\nwant\n%#v", stmts[0], stmtExpected)
+		}
+	}
+
+	f(`SHOW DATABASES`, &ShowDatabasesStatement{})
+	f(`show retention policies on "telegraf"`, &ShowRetentionPoliciesStatement{})
+	f(`SHOW MEASUREMENTS`, &ShowMeasurementsStatement{})
+	f(`SHOW MEASUREMENTS ON db WITH MEASUREMENT =~ /cpu.*/ WHERE host = 'a' LIMIT 100`, &ShowMeasurementsStatement{
+		DB:                "db",
+		MeasurementRegexp: "cpu.*",
+		Where:             &TagCond{Key: "host", Op: "=", Value: "a"},
+		Limit:             100,
+	})
+	f(`SHOW TAG KEYS FROM "cpu"`, &ShowTagKeysStatement{
+		Measurements: []string{"cpu"},
+	})
+	f(`SHOW TAG VALUES FROM cpu WITH KEY = "host" WHERE dc =~ /eu/`, &ShowTagValuesStatement{
+		Measurements: []string{"cpu"},
+		KeyOp:        "=",
+		Keys:         []string{"host"},
+		Where:        &TagCond{Key: "dc", Op: "=~", Value: "eu"},
+	})
+	f(`SHOW TAG VALUES WITH KEY IN ("host", dc)`, &ShowTagValuesStatement{
+		KeyOp: "in",
+		Keys:  []string{"host", "dc"},
+	})
+	f(`SHOW FIELD KEYS ON db FROM cpu`, &ShowFieldKeysStatement{
+		DB:           "db",
+		Measurements: []string{"cpu"},
+	})
+}
+
+func TestParseCreateDatabaseSuccess(t *testing.T) {
+	f := func(s, nameExpected string) {
+		t.Helper()
+		stmts, err := Parse(s, testCurrentTimestamp)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(stmts) != 1 {
+			t.Fatalf("unexpected number of statements; got %d; want 1", len(stmts))
+		}
+		cs, ok := stmts[0].(*CreateDatabaseStatement)
+		if !ok {
+			t.Fatalf("unexpected statement type %T; want *CreateDatabaseStatement", stmts[0])
+		}
+		if cs.Name != nameExpected {
+			t.Fatalf("unexpected database name; got %q; want %q", cs.Name, nameExpected)
+		}
+	}
+
+	f(`CREATE DATABASE telegraf`, "telegraf")
+	f(`create database "my-db"`, "my-db")
+	f(`CREATE DATABASE "telegraf" WITH DURATION 30d REPLICATION 1 SHARD DURATION 1h NAME "rp"`, "telegraf")
+}
+
+func TestParseMultipleStatements(t *testing.T) {
+	stmts, err := Parse(`SHOW DATABASES; SELECT value FROM cpu;`, testCurrentTimestamp)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(stmts) != 2 {
+		t.Fatalf("unexpected number of statements; got %d; want 2", len(stmts))
+	}
+	if _, ok := stmts[0].(*ShowDatabasesStatement); !ok {
+		t.Fatalf("unexpected type for the first statement: %T", stmts[0])
+	}
+	if _, ok := stmts[1].(*SelectStatement); !ok {
+		t.Fatalf("unexpected type for the second statement: %T", stmts[1])
+	}
+}
+
+func TestParseFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		stmts, err := Parse(s, testCurrentTimestamp)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q; got %#v", s, stmts)
+		}
+	}
+
+	// empty query
+	f("")
+	f(";")
+
+	// unsupported statements
+	f("DROP MEASUREMENT cpu")
+	f("SHOW USERS")
+	f("DELETE FROM cpu")
+	f("CREATE USER foo")
+
+	// invalid CREATE DATABASE
+	f("CREATE DATABASE")
+	f("CREATE DATABASE foo bar")
+
+	// invalid select
+	f("SELECT")
+	f("SELECT value")
+	f("SELECT value FROM")
+	f("SELECT mean(value FROM cpu")
+	f("SELECT value FROM /cpu/")
+	f("SELECT value FROM cpu foo")
+	f("SELECT value FROM cpu tz('Europe/Berlin')")
+
+	// conditions on fields
+	f("SELECT value FROM cpu WHERE value > 10")
+	f("SELECT value FROM cpu WHERE value = 10")
+
+	// invalid time conditions
+	f("SELECT value FROM cpu WHERE time != now()")
+	f("SELECT value FROM cpu WHERE time > 'foobar'")
+	f("SELECT value FROM cpu WHERE time > now() - 1x")
+
+	// invalid GROUP BY
+	f("SELECT mean(value) FROM cpu GROUP BY time()")
+	f("SELECT mean(value) FROM cpu GROUP BY time(0s)")
+	f("SELECT mean(value) FROM cpu GROUP BY /host/")
+
+	// invalid fill, order and limits
+	f("SELECT mean(value) FROM cpu fill(foo)")
+	f("SELECT mean(value) FROM cpu ORDER BY host")
+	f("SELECT value FROM cpu LIMIT -1")
+	f("SELECT value FROM cpu LIMIT foo")
+
+	// invalid SHOW statements
+	f("SHOW TAG VALUES FROM cpu")
+	f("SHOW TAG VALUES WITH KEY > 'a'")
+	f("SHOW MEASUREMENTS WITH MEASUREMENT =~ 'cpu'")
+	f("SHOW FIELD")
+}
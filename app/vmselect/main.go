@@ -12,6 +12,7 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/graphite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/influx"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/prometheus"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
@@ -26,7 +27,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/vmalertproxy"
 )
 
@@ -34,6 +35,8 @@ var (
 	deleteAuthKey                = flagutil.NewPassword("deleteAuthKey", "authKey for metrics' deletion via /api/v1/admin/tsdb/delete_series and /tags/delSeries. It could be passed via authKey query arg. It overrides -httpAuth.*")
 	metricNamesStatsResetAuthKey = flagutil.NewPassword("metricNamesStatsResetAuthKey", "authKey for resetting metric names usage cache via /api/v1/admin/status/metric_names_stats/reset. It overrides -httpAuth.*. "+
 		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#track-ingested-metrics-usage")
+	cancelQueryAuthKey = flagutil.NewPassword("search.cancelQueryAuthKey", "Optional authKey for canceling active queries via /api/v1/admin/query/cancel. It could be passed via authKey query arg. It overrides -httpAuth.*. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#active-queries")
 	resetCacheAuthKey    = flagutil.NewPassword("search.resetCacheAuthKey", "Optional authKey for resetting rollup cache via /internal/resetRollupResultCache call. It could be passed via authKey query arg. It overrides -httpAuth.*")
 	logSlowQueryDuration = flag.Duration("search.logSlowQueryDuration", 5*time.Second, "Log queries with execution time exceeding this value. Zero disables slow query logging. "+
 		"See also -search.logQueryMemoryUsage")
@@ -54,11 +57,14 @@ func Init(vmselectMaxConcurrentRequests int, vmselectMaxQueueDuration time.Durat
 
 	maxConcurrentRequests = vmselectMaxConcurrentRequests
 	maxQueueDuration = vmselectMaxQueueDuration
-	concurrencyLimitCh = make(chan struct{}, maxConcurrentRequests)
+	concurrencyLimiter = searchutil.NewConcurrencyLimiter(maxConcurrentRequests)
+	searchutil.InitQuotas()
 
 	initVMUIConfig()
 
 	vmalertproxy.Init(*vmalertProxyURL)
+	promql.InitRecordingRules()
+	tracing.Init("victoria-metrics")
 
 }
 
@@ -66,17 +72,20 @@ func Init(vmselectMaxConcurrentRequests int, vmselectMaxQueueDuration time.Durat
 // It should run before logger initialization and package Init() (if exists).
 func InitSecretFlags() {
 	flagutil.RegisterSecretFlag("vmalert.proxyURL")
+	tracing.InitSecretFlags()
 }
 
 // Stop stops vmselect
 func Stop() {
+	tracing.Stop()
+	promql.StopRecordingRules()
 	promql.StopRollupResultCache()
 }
 
 var (
 	maxConcurrentRequests int
 	maxQueueDuration      time.Duration
-	concurrencyLimitCh    chan struct{}
+	concurrencyLimiter    *searchutil.ConcurrencyLimiter
 )
 
 var (
@@ -84,10 +93,10 @@ var (
 	concurrencyLimitTimeout = metrics.NewCounter(`vm_concurrent_select_limit_timeout_total`)
 
 	_ = metrics.NewGauge(`vm_concurrent_select_capacity`, func() float64 {
-		return float64(cap(concurrencyLimitCh))
+		return float64(concurrencyLimiter.Capacity())
 	})
 	_ = metrics.NewGauge(`vm_concurrent_select_current`, func() float64 {
-		return float64(len(concurrencyLimitCh))
+		return float64(concurrencyLimiter.Current())
 	})
 )
 
@@ -118,31 +127,51 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	startTime := time.Now()
 	defer requestDuration.UpdateDuration(startTime)
 	tracerEnabled := httputil.GetBool(r, "trace")
-	qt := querytracer.New(tracerEnabled, "%s", r.URL.Path)
 
-	// Limit the number of concurrent queries.
-	select {
-	case concurrencyLimitCh <- struct{}{}:
-		defer func() { <-concurrencyLimitCh }()
-	default:
-		// Sleep for a while until giving up. This should resolve short bursts in requests.
-		concurrencyLimitReached.Inc()
-		d := min(searchutil.GetMaxQueryDuration(r), maxQueueDuration)
-		t := timerpool.Get(d)
-		select {
-		case concurrencyLimitCh <- struct{}{}:
-			timerpool.Put(t)
-			qt.Printf("wait in queue because -search.maxConcurrentRequests=%d concurrent requests are executed", maxConcurrentRequests)
-			defer func() { <-concurrencyLimitCh }()
-		case <-r.Context().Done():
-			timerpool.Put(t)
+	// Export query execution spans if needed.
+	// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#opentelemetry-tracing
+	span := tracing.StartRequestSpan(r, "vmselect.request")
+	span.SetAttributes(
+		tracing.String("http.request.method", r.Method),
+		tracing.String("url.path", path),
+	)
+	qt := querytracer.NewForSpan(span, tracerEnabled, "%s", r.URL.Path)
+	defer func() {
+		qt.ExportSpans(span)
+		span.End()
+	}()
+
+	// Limit the number of concurrent queries per quota from -search.quotasConfig.
+	// This is performed before the global limit, so the queries waiting for the quota do not occupy global slots.
+	quota := searchutil.GetQuota(r)
+	if err := quota.BeginQuery(r, min(searchutil.GetMaxQueryDuration(r), maxQueueDuration)); err != nil {
+		if r.Context().Err() != nil {
 			remoteAddr := httpserver.GetQuotedRemoteAddr(r)
 			requestURI := httpserver.GetRequestURI(r)
 			logger.Infof("client has canceled the request after %.3f seconds: remoteAddr=%s, requestURI: %q",
 				time.Since(startTime).Seconds(), remoteAddr, requestURI)
 			return true
-		case <-t.C:
-			timerpool.Put(t)
+		}
+		w.Header().Add("Retry-After", "10")
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+	defer quota.EndQuery()
+
+	// Limit the number of concurrent queries.
+	if !concurrencyLimiter.TryAcquire() {
+		// Sleep for a while until giving up. This should resolve short bursts in requests.
+		// Requests with higher quota priority are started first.
+		concurrencyLimitReached.Inc()
+		d := min(searchutil.GetMaxQueryDuration(r), maxQueueDuration)
+		if !concurrencyLimiter.Acquire(quota.Priority(), d, r.Context().Done()) {
+			if r.Context().Err() != nil {
+				remoteAddr := httpserver.GetQuotedRemoteAddr(r)
+				requestURI := httpserver.GetRequestURI(r)
+				logger.Infof("client has canceled the request after %.3f seconds: remoteAddr=%s, requestURI: %q",
+					time.Since(startTime).Seconds(), remoteAddr, requestURI)
+				return true
+			}
 			concurrencyLimitTimeout.Inc()
 			err := &httpserver.ErrorWithStatusCode{
 				Err: fmt.Errorf("couldn't start executing the request in %.3f seconds, since -search.maxConcurrentRequests=%d concurrent requests "+
@@ -155,7 +184,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			httpserver.Errorf(w, r, "%s", err)
 			return true
 		}
+		qt.Printf("wait in queue because -search.maxConcurrentRequests=%d concurrent requests are executed", maxConcurrentRequests)
 	}
+	defer concurrencyLimiter.Release()
 
 	if *logSlowQueryDuration > 0 {
 		actualStartTime := time.Now()
@@ -231,6 +262,24 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/query_exemplars":
+		queryExemplarsRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.QueryExemplarsHandler(qt, startTime, w, r); err != nil {
+			queryExemplarsErrors.Inc()
+			httpserver.SendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "/api/v1/query/explain":
+		queryExplainRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.QueryExplainHandler(qt, startTime, w, r); err != nil {
+			queryExplainErrors.Inc()
+			httpserver.SendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "/api/v1/series/count":
 		seriesCountRequests.Inc()
 		httpserver.EnableCORS(w, r)
@@ -285,6 +334,24 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/export/parquet":
+		exportParquetRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.ExportParquetHandler(startTime, w, r); err != nil {
+			exportParquetErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
+	case "/api/v1/export/arrow":
+		exportArrowRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.ExportArrowHandler(startTime, w, r); err != nil {
+			exportArrowErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
 	case "/federate":
 		federateRequests.Inc()
 		if err := prometheus.FederateHandler(startTime, w, r); err != nil {
@@ -389,6 +456,14 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/influx/query", "/query":
+		influxQueryRequests.Inc()
+		if err := influx.QueryHandler(qt, startTime, w, r); err != nil {
+			influxQueryErrors.Inc()
+			httpserver.SendInfluxError(w, r, err)
+			return true
+		}
+		return true
 	case "/render":
 		graphiteRenderRequests.Inc()
 		if err := graphite.RenderHandler(startTime, w, r); err != nil {
@@ -465,6 +540,11 @@ func handleStaticAndSimpleRequests(w http.ResponseWriter, r *http.Request, path
 		// This is needed for serving /graph URLs from Prometheus datasource in Grafana.
 		path = strings.Replace(path, "/graph/", "/vmui/", 1)
 	}
+	if strings.HasPrefix(path, "/internal/rollupResultCache/") && promql.IsRollupResultCachePeersEnabled() {
+		// Requests from -search.rollupResultCachePeers are cheap, so they aren't limited by -search.maxConcurrentRequests.
+		promql.RollupResultCacheHandler(w, r)
+		return true
+	}
 	if path == "/vmui/custom-dashboards" {
 		if err := handleVMUICustomDashboards(w); err != nil {
 			httpserver.Errorf(w, r, "%s", err)
@@ -544,6 +624,21 @@ func handleStaticAndSimpleRequests(w http.ResponseWriter, r *http.Request, path
 		httpserver.EnableCORS(w, r)
 		promql.ActiveQueriesHandler(w, r)
 		return true
+	case "/api/v1/admin/query/cancel":
+		if r.Method != "POST" {
+			http.Error(w, fmt.Sprintf("Only POST method is allowed. Got %s.", r.Method), http.StatusMethodNotAllowed)
+			return true
+		}
+		if !httpserver.CheckAuthFlag(w, r, cancelQueryAuthKey) {
+			return true
+		}
+		cancelQueryRequests.Inc()
+		if err := promql.CancelQueryHandler(w, r); err != nil {
+			cancelQueryErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
 	case "/api/v1/status/top_queries":
 		topQueriesRequests.Inc()
 		httpserver.EnableCORS(w, r)
@@ -606,12 +701,6 @@ func handleStaticAndSimpleRequests(w http.ResponseWriter, r *http.Request, path
 		// see this issue for more info: https://github.com/VictoriaMetrics/VictoriaMetrics/issues/5370
 		fmt.Fprintf(w, "%s", `{"status":"success","data":{"version":"2.24.0"}}`)
 		return true
-	case "/api/v1/query_exemplars":
-		// Return dumb placeholder for https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
-		queryExemplarsRequests.Inc()
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, "%s", `{"status":"success","data":[]}`)
-		return true
 	default:
 		return false
 	}
@@ -655,6 +744,9 @@ var (
 
 	statusActiveQueriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/active_queries"}`)
 
+	cancelQueryRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/admin/query/cancel"}`)
+	cancelQueryErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/admin/query/cancel"}`)
+
 	topQueriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/top_queries"}`)
 	topQueriesErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/top_queries"}`)
 
@@ -670,6 +762,12 @@ var (
 	exportNativeRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/export/native"}`)
 	exportNativeErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/export/native"}`)
 
+	exportParquetRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/export/parquet"}`)
+	exportParquetErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/export/parquet"}`)
+
+	exportArrowRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/export/arrow"}`)
+	exportArrowErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/export/arrow"}`)
+
 	federateRequests = metrics.NewCounter(`vm_http_requests_total{path="/federate"}`)
 	federateErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/federate"}`)
 
@@ -709,6 +807,9 @@ var (
 	graphiteRenderRequests = metrics.NewCounter(`vm_http_requests_total{path="/render"}`)
 	graphiteRenderErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/render"}`)
 
+	influxQueryRequests = metrics.NewCounter(`vm_http_requests_total{path="/influx/query", protocol="influx"}`)
+	influxQueryErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/influx/query", protocol="influx"}`)
+
 	promscrapeMetricRelabelDebugRequests = metrics.NewCounter(`vm_http_requests_total{path="/metric-relabel-debug"}`)
 	promscrapeTargetRelabelDebugRequests = metrics.NewCounter(`vm_http_requests_total{path="/target-relabel-debug"}`)
 
@@ -731,6 +832,10 @@ var (
 
 	buildInfoRequests      = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/buildinfo"}`)
 	queryExemplarsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query_exemplars"}`)
+	queryExemplarsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query_exemplars"}`)
+
+	queryExplainRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query/explain"}`)
+	queryExplainErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query/explain"}`)
 
 	metricNamesStatsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/metric_names_stats"}`)
 	metricNamesStatsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/metric_names_stats"}`)
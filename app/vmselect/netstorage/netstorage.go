@@ -65,6 +65,9 @@ type Results struct {
 	packedTimeseries []packedTimeseries
 	sr               *storage.Search
 	tbf              *tmpBlocksFile
+
+	// samples is the number of raw samples in the blocks selected by the query.
+	samples int
 }
 
 // Len returns the number of results in rss.
@@ -72,6 +75,11 @@ func (rss *Results) Len() int {
 	return len(rss.packedTimeseries)
 }
 
+// Samples returns the number of raw samples in the data blocks selected by the query.
+func (rss *Results) Samples() int {
+	return rss.samples
+}
+
 // Cancel cancels rss work.
 func (rss *Results) Cancel() {
 	rss.mustClose()
@@ -123,17 +131,20 @@ func timeseriesWorker(qt *querytracer.Tracer, workChs []chan *timeseriesWork, wo
 	// Perform own work at first.
 	rowsProcessed := 0
 	seriesProcessed := 0
+	blocksProcessed := 0
 	ch := workChs[workerID]
 	for tsw := range ch {
+		blocksProcessed += len(tsw.pts.brs)
 		tsw.err = tsw.do(&tmpResult.rs, workerID)
 		rowsProcessed += tsw.rowsProcessed
 		seriesProcessed++
 	}
-	qt.Printf("own work processed: series=%d, samples=%d", seriesProcessed, rowsProcessed)
+	qt.Printf("own work processed: series=%d, blocks=%d, samples=%d", seriesProcessed, blocksProcessed, rowsProcessed)
 
 	// Then help others with the remaining work.
 	rowsProcessed = 0
 	seriesProcessed = 0
+	blocksProcessed = 0
 	for i := uint(1); i < uint(len(workChs)); i++ {
 		idx := (i + workerID) % uint(len(workChs))
 		ch := workChs[idx]
@@ -149,12 +160,13 @@ func timeseriesWorker(qt *querytracer.Tracer, workChs []chan *timeseriesWork, wo
 			if !ok {
 				break
 			}
+			blocksProcessed += len(tsw.pts.brs)
 			tsw.err = tsw.do(&tmpResult.rs, workerID)
 			rowsProcessed += tsw.rowsProcessed
 			seriesProcessed++
 		}
 	}
-	qt.Printf("others work processed: series=%d, samples=%d", seriesProcessed, rowsProcessed)
+	qt.Printf("others work processed: series=%d, blocks=%d, samples=%d", seriesProcessed, blocksProcessed, rowsProcessed)
 
 	putTmpResult(tmpResult)
 }
@@ -937,6 +949,16 @@ func SeriesCount(qt *querytracer.Tracer, deadline searchutil.Deadline) (uint64,
 // It is the responsibility of f to call b.UnmarshalData before reading timestamps and values from the block.
 // It is the responsibility of f to filter blocks according to the given tr.
 func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutil.Deadline,
+	f func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange, workerID uint) error) error {
+	return ExportBlocksWithQuota(qt, sq, deadline, nil, f)
+}
+
+// ExportBlocksWithQuota searches for time series matching sq and calls f for each found block.
+//
+// The exported samples are registered at the given quota, so the export is stopped as soon as it exceeds `max_samples_per_minute` for the quota.
+//
+// See ExportBlocks for details on f.
+func ExportBlocksWithQuota(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutil.Deadline, quota *searchutil.Quota,
 	f func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange, workerID uint) error) error {
 	qt = qt.NewChild("export blocks: %s", sq)
 	defer qt.Done()
@@ -945,7 +967,7 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 	}
 
 	tr := sq.GetTimeRange()
-	sr, _, err := vmstorage.GetSearch(qt, sq, deadline.Deadline())
+	sr, _, err := vmstorage.GetSearch(deadline.Context(), qt, sq, deadline.Deadline())
 	if err != nil {
 		return err
 	}
@@ -979,6 +1001,7 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 	// Feed workers with work
 	blocksRead := 0
 	samples := 0
+	var quotaErr error
 	for sr.NextMetricBlock() {
 		blocksRead++
 		if deadline.Exceeded() {
@@ -987,11 +1010,15 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 		if mustStop.Load() {
 			break
 		}
+		br := sr.MetricBlockRef.BlockRef
+		if err := quota.AddSamples(br.RowsCount()); err != nil {
+			quotaErr = err
+			break
+		}
 		xw := exportWorkPool.Get().(*exportWork)
 		if err := xw.mn.Unmarshal(sr.MetricBlockRef.MetricName); err != nil {
 			return fmt.Errorf("cannot unmarshal metricName for block #%d: %w", blocksRead, err)
 		}
-		br := sr.MetricBlockRef.BlockRef
 		br.MustReadBlock(&xw.b)
 		samples += br.RowsCount()
 		workCh <- xw
@@ -1001,6 +1028,9 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 	// Wait for workers to finish.
 	wg.Wait()
 	qt.Printf("export blocks=%d, samples=%d", blocksRead, samples)
+	if quotaErr != nil {
+		return quotaErr
+	}
 
 	// Check errors.
 	err = sr.Error()
@@ -1051,17 +1081,47 @@ func SearchMetricNames(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline
 	return metricNames, nil
 }
 
+// SearchExemplars returns exemplars for series matching the given sq until the given deadline.
+//
+// The returned results are sorted by metric name.
+func SearchExemplars(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutil.Deadline) ([]storage.ExemplarsResult, error) {
+	qt = qt.NewChild("fetch exemplars: %s", sq)
+	defer qt.Done()
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting to search exemplars: %s", deadline.String())
+	}
+
+	results, err := vmstorage.SearchExemplars(qt, sq, deadline.Deadline())
+	if err != nil {
+		return nil, fmt.Errorf("cannot find exemplars: %w", err)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].MetricName < results[j].MetricName
+	})
+	return results, nil
+}
+
 // ProcessSearchQuery performs sq until the given deadline.
 //
 // Results.RunParallel or Results.Cancel must be called on the returned Results.
 func ProcessSearchQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutil.Deadline) (*Results, error) {
+	return ProcessSearchQueryWithQuota(qt, sq, deadline, nil)
+}
+
+// ProcessSearchQueryWithQuota performs sq until the given deadline.
+//
+// The scanned samples are registered at the given quota while fetching the data,
+// so the query is stopped as soon as it exceeds `max_samples_per_minute` for the quota.
+//
+// Results.RunParallel or Results.Cancel must be called on the returned Results.
+func ProcessSearchQueryWithQuota(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutil.Deadline, quota *searchutil.Quota) (*Results, error) {
 	qt = qt.NewChild("fetch matching series: %s", sq)
 	defer qt.Done()
 	if deadline.Exceeded() {
 		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
 	}
 
-	sr, maxSeriesCount, err := vmstorage.GetSearch(qt, sq, deadline.Deadline())
+	sr, maxSeriesCount, err := vmstorage.GetSearch(deadline.Context(), qt, sq, deadline.Deadline())
 	if err != nil {
 		return nil, err
 	}
@@ -1119,6 +1179,11 @@ func ProcessSearchQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, deadlin
 			return nil, fmt.Errorf("cannot select more than -search.maxSamplesPerQuery=%d samples; possible solutions: increase the -search.maxSamplesPerQuery; "+
 				"reduce time range for the query; use more specific label filters in order to select fewer series", *maxSamplesPerQuery)
 		}
+		if err := quota.AddSamples(br.RowsCount()); err != nil {
+			putTmpBlocksFile(tbf)
+			vmstorage.PutSearch(sr)
+			return nil, err
+		}
 
 		buf = br.Marshal(buf[:0])
 		addr, err := tbf.WriteBlockRefData(buf)
@@ -1198,6 +1263,7 @@ func ProcessSearchQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, deadlin
 	var rss Results
 	rss.tr = sq.GetTimeRange()
 	rss.deadline = deadline
+	rss.samples = samples
 	pts := make([]packedTimeseries, len(orderedMetricNames))
 	for i, metricName := range orderedMetricNames {
 		pts[i] = packedTimeseries{
@@ -0,0 +1,385 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// arrowWriter writes columnarRows in Apache Arrow IPC streaming format.
+//
+// Every columnarRows is written as a separate record batch. The stream has the following schema:
+//
+//	labels: map<string, string> not null
+//	timestamp: timestamp[ms, tz=UTC] not null
+//	value: double not null
+//
+// See https://arrow.apache.org/docs/format/Columnar.html#ipc-streaming-format
+type arrowWriter struct {
+	w io.Writer
+
+	body    []byte
+	nodes   []byte
+	buffers []byte
+	frame   []byte
+	fb      flatbufferBuilder
+}
+
+// Arrow constants. See https://github.com/apache/arrow/tree/main/format
+const (
+	arrowMetadataVersionV5 = 4
+
+	arrowMessageHeaderSchema      = 1
+	arrowMessageHeaderRecordBatch = 3
+
+	arrowTypeFloatingPoint = 3
+	arrowTypeUtf8          = 5
+	arrowTypeTimestamp     = 10
+	arrowTypeStruct        = 13
+	arrowTypeMap           = 17
+
+	arrowPrecisionDouble = 2
+
+	arrowTimeUnitMillisecond = 1
+)
+
+func newArrowWriter(w io.Writer) columnarWriter {
+	return &arrowWriter{
+		w: w,
+	}
+}
+
+func (aw *arrowWriter) writeHeader() error {
+	entries := arrowField("entries", arrowTypeStruct, flatbufferTable{},
+		arrowField("key", arrowTypeUtf8, flatbufferTable{}),
+		arrowField("value", arrowTypeUtf8, flatbufferTable{}),
+	)
+	schema := flatbufferTable{
+		// endianness: Little
+		flatbufferScalar(0, 2, 0),
+		flatbufferRef(1, flatbufferVector{
+			arrowField("labels", arrowTypeMap, flatbufferTable{
+				// keysSorted: false
+				flatbufferScalar(0, 1, 0),
+			}, entries),
+			arrowField("timestamp", arrowTypeTimestamp, flatbufferTable{
+				flatbufferScalar(0, 2, arrowTimeUnitMillisecond),
+				flatbufferRef(1, flatbufferString("UTC")),
+			}),
+			arrowField("value", arrowTypeFloatingPoint, flatbufferTable{
+				flatbufferScalar(0, 2, arrowPrecisionDouble),
+			}),
+		}),
+	}
+	return aw.writeMessage(arrowMessageHeaderSchema, schema, nil)
+}
+
+// arrowField returns Field table for non-nullable field with the given name, type and children.
+func arrowField(name string, typeType uint64, typ flatbufferTable, children ...flatbufferObject) flatbufferTable {
+	return flatbufferTable{
+		flatbufferRef(0, flatbufferString(name)),
+		// nullable: false
+		flatbufferScalar(1, 1, 0),
+		flatbufferScalar(2, 1, typeType),
+		flatbufferRef(3, typ),
+		flatbufferRef(5, flatbufferVector(children)),
+	}
+}
+
+func (aw *arrowWriter) writeRows(cr *columnarRows) error {
+	aw.body = aw.body[:0]
+	aw.nodes = aw.nodes[:0]
+	aw.buffers = aw.buffers[:0]
+
+	rowsCount := cr.rowsCount()
+	labelsCount := 0
+	for _, seriesIdx := range cr.rowSeries {
+		labelsStart, labelsEnd := cr.seriesLabelsRange(seriesIdx)
+		labelsCount += (labelsEnd - labelsStart) / 2
+	}
+
+	// labels map
+	aw.addNode(rowsCount)
+	aw.addEmptyBuffer()
+	start := len(aw.body)
+	offset := 0
+	aw.body = binary.LittleEndian.AppendUint32(aw.body, 0)
+	for _, seriesIdx := range cr.rowSeries {
+		labelsStart, labelsEnd := cr.seriesLabelsRange(seriesIdx)
+		offset += (labelsEnd - labelsStart) / 2
+		aw.body = binary.LittleEndian.AppendUint32(aw.body, uint32(offset))
+	}
+	aw.addBuffer(start)
+
+	// entries struct
+	aw.addNode(labelsCount)
+	aw.addEmptyBuffer()
+
+	// Label names are stored at even items, while label values are stored at odd items for every series.
+	for columnIdx := range 2 {
+		aw.addNode(labelsCount)
+		aw.addEmptyBuffer()
+		start := len(aw.body)
+		offset := 0
+		aw.body = binary.LittleEndian.AppendUint32(aw.body, 0)
+		for _, seriesIdx := range cr.rowSeries {
+			labelsStart, labelsEnd := cr.seriesLabelsRange(seriesIdx)
+			for j := labelsStart + columnIdx; j < labelsEnd; j += 2 {
+				offset += len(cr.getItem(j))
+				aw.body = binary.LittleEndian.AppendUint32(aw.body, uint32(offset))
+			}
+		}
+		if offset > math.MaxInt32 {
+			return fmt.Errorf("too big size of label names or values in a single record batch: %d bytes; decrease row_group_size query arg", offset)
+		}
+		aw.addBuffer(start)
+
+		start = len(aw.body)
+		for _, seriesIdx := range cr.rowSeries {
+			labelsStart, labelsEnd := cr.seriesLabelsRange(seriesIdx)
+			for j := labelsStart + columnIdx; j < labelsEnd; j += 2 {
+				aw.body = append(aw.body, cr.getItem(j)...)
+			}
+		}
+		aw.addBuffer(start)
+	}
+
+	// timestamp
+	aw.addNode(rowsCount)
+	aw.addEmptyBuffer()
+	start = len(aw.body)
+	for _, ts := range cr.timestamps {
+		aw.body = binary.LittleEndian.AppendUint64(aw.body, uint64(ts))
+	}
+	aw.addBuffer(start)
+
+	// value
+	aw.addNode(rowsCount)
+	aw.addEmptyBuffer()
+	start = len(aw.body)
+	for _, v := range cr.values {
+		aw.body = binary.LittleEndian.AppendUint64(aw.body, math.Float64bits(v))
+	}
+	aw.addBuffer(start)
+
+	recordBatch := flatbufferTable{
+		flatbufferScalar(0, 8, uint64(rowsCount)),
+		flatbufferRef(1, flatbufferStructVector(aw.nodes)),
+		flatbufferRef(2, flatbufferStructVector(aw.buffers)),
+	}
+	return aw.writeMessage(arrowMessageHeaderRecordBatch, recordBatch, aw.body)
+}
+
+// addNode adds FieldNode struct for the field with the given length and without nulls.
+func (aw *arrowWriter) addNode(length int) {
+	aw.nodes = binary.LittleEndian.AppendUint64(aw.nodes, uint64(length))
+	aw.nodes = binary.LittleEndian.AppendUint64(aw.nodes, 0)
+}
+
+// addEmptyBuffer adds an empty buffer. It is used as validity bitmap for fields without nulls.
+func (aw *arrowWriter) addEmptyBuffer() {
+	aw.addBuffer(len(aw.body))
+}
+
+// addBuffer adds Buffer struct for the buffer at aw.body[start:] and pads aw.body to 8 bytes.
+func (aw *arrowWriter) addBuffer(start int) {
+	aw.buffers = binary.LittleEndian.AppendUint64(aw.buffers, uint64(start))
+	aw.buffers = binary.LittleEndian.AppendUint64(aw.buffers, uint64(len(aw.body)-start))
+	aw.body = appendPadding(aw.body, 8)
+}
+
+func (aw *arrowWriter) writeMessage(headerType uint64, header flatbufferTable, body []byte) error {
+	message := flatbufferTable{
+		flatbufferScalar(0, 2, arrowMetadataVersionV5),
+		flatbufferScalar(1, 1, headerType),
+		flatbufferRef(2, header),
+		flatbufferScalar(3, 8, uint64(len(body))),
+	}
+	metadata := aw.fb.finish(message)
+
+	// The encapsulated message format: continuation marker, metadata size, metadata padded to 8 bytes and body.
+	// See https://arrow.apache.org/docs/format/Columnar.html#encapsulated-message-format
+	aw.frame = binary.LittleEndian.AppendUint32(aw.frame[:0], 0xffffffff)
+	aw.frame = binary.LittleEndian.AppendUint32(aw.frame, 0)
+	aw.frame = append(aw.frame, metadata...)
+	aw.frame = appendPadding(aw.frame, 8)
+	binary.LittleEndian.PutUint32(aw.frame[4:], uint32(len(aw.frame)-8))
+	if _, err := aw.w.Write(aw.frame); err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	_, err := aw.w.Write(body)
+	return err
+}
+
+func (aw *arrowWriter) writeFooter() error {
+	// End-of-stream marker.
+	aw.frame = binary.LittleEndian.AppendUint32(aw.frame[:0], 0xffffffff)
+	aw.frame = binary.LittleEndian.AppendUint32(aw.frame, 0)
+	_, err := aw.w.Write(aw.frame)
+	return err
+}
+
+func appendPadding(dst []byte, alignment int) []byte {
+	for len(dst)%alignment != 0 {
+		dst = append(dst, 0)
+	}
+	return dst
+}
+
+// flatbufferBuilder marshals flatbuffers.
+//
+// Unlike the canonical flatbuffers builder, it writes objects from the start to the end of the buffer:
+// a table is followed by the objects it refers to, while its vtable is written just before the table.
+// This is allowed by the format, since it uses relative offsets.
+//
+// See https://flatbuffers.dev/internals/
+type flatbufferBuilder struct {
+	b []byte
+}
+
+// flatbufferObject is an object, which can be referred from flatbuffers table.
+type flatbufferObject interface {
+	// marshal appends the object to fb and returns its position.
+	marshal(fb *flatbufferBuilder) int
+}
+
+// flatbufferTable is a table with the given fields.
+type flatbufferTable []flatbufferField
+
+type flatbufferField struct {
+	id int
+
+	// size is the size of the inline field value in bytes.
+	size int
+
+	// value is the field value for scalar fields.
+	value uint64
+
+	// ref is the referred object for non-scalar fields.
+	ref flatbufferObject
+}
+
+func flatbufferScalar(id, size int, value uint64) flatbufferField {
+	return flatbufferField{
+		id:    id,
+		size:  size,
+		value: value,
+	}
+}
+
+func flatbufferRef(id int, ref flatbufferObject) flatbufferField {
+	return flatbufferField{
+		id:   id,
+		size: 4,
+		ref:  ref,
+	}
+}
+
+// flatbufferString is a string.
+type flatbufferString string
+
+// flatbufferVector is a vector of tables or strings.
+type flatbufferVector []flatbufferObject
+
+// flatbufferStructVector is a vector of structs with 16 bytes size and 8 bytes alignment.
+type flatbufferStructVector []byte
+
+// finish marshals flatbuffer with the given root table.
+//
+// The returned buffer is valid until the next call to finish.
+func (fb *flatbufferBuilder) finish(root flatbufferTable) []byte {
+	fb.b = append(fb.b[:0], 0, 0, 0, 0)
+	pos := root.marshal(fb)
+	binary.LittleEndian.PutUint32(fb.b, uint32(pos))
+	return fb.b
+}
+
+func (fb *flatbufferBuilder) align(alignment int) {
+	fb.b = appendPadding(fb.b, alignment)
+}
+
+func (t flatbufferTable) marshal(fb *flatbufferBuilder) int {
+	fieldsCount := 0
+	for _, f := range t {
+		fieldsCount = max(fieldsCount, f.id+1)
+	}
+
+	fb.align(2)
+	vtablePos := len(fb.b)
+	vtableSize := 4 + 2*fieldsCount
+	fb.b = append(fb.b, make([]byte, vtableSize)...)
+
+	fb.align(4)
+	tablePos := len(fb.b)
+	fb.b = append(fb.b, 0, 0, 0, 0)
+
+	// Write fields in the descending order of their sizes in order to minimize padding.
+	fieldPositions := make([]int, len(t))
+	for _, size := range []int{8, 4, 2, 1} {
+		for i, f := range t {
+			if f.size != size {
+				continue
+			}
+			fb.align(size)
+			fieldPositions[i] = len(fb.b)
+			for j := range size {
+				fb.b = append(fb.b, byte(f.value>>(8*j)))
+			}
+		}
+	}
+
+	vtable := fb.b[vtablePos:]
+	binary.LittleEndian.PutUint16(vtable, uint16(vtableSize))
+	binary.LittleEndian.PutUint16(vtable[2:], uint16(len(fb.b)-tablePos))
+	for i, f := range t {
+		binary.LittleEndian.PutUint16(vtable[4+2*f.id:], uint16(fieldPositions[i]-tablePos))
+	}
+	binary.LittleEndian.PutUint32(fb.b[tablePos:], uint32(tablePos-vtablePos))
+
+	for i, f := range t {
+		if f.ref == nil {
+			continue
+		}
+		pos := f.ref.marshal(fb)
+		binary.LittleEndian.PutUint32(fb.b[fieldPositions[i]:], uint32(pos-fieldPositions[i]))
+	}
+	return tablePos
+}
+
+func (s flatbufferString) marshal(fb *flatbufferBuilder) int {
+	fb.align(4)
+	pos := len(fb.b)
+	fb.b = binary.LittleEndian.AppendUint32(fb.b, uint32(len(s)))
+	fb.b = append(fb.b, s...)
+	fb.b = append(fb.b, 0)
+	return pos
+}
+
+func (v flatbufferVector) marshal(fb *flatbufferBuilder) int {
+	fb.align(4)
+	pos := len(fb.b)
+	fb.b = binary.LittleEndian.AppendUint32(fb.b, uint32(len(v)))
+	fb.b = append(fb.b, make([]byte, 4*len(v))...)
+	for i, obj := range v {
+		itemPos := pos + 4 + 4*i
+		objPos := obj.marshal(fb)
+		binary.LittleEndian.PutUint32(fb.b[itemPos:], uint32(objPos-itemPos))
+	}
+	return pos
+}
+
+func (v flatbufferStructVector) marshal(fb *flatbufferBuilder) int {
+	// Structs must be aligned to 8 bytes, so the preceding vector length must be aligned to 8 bytes + 4.
+	fb.align(4)
+	if len(fb.b)%8 == 0 {
+		fb.b = append(fb.b, 0, 0, 0, 0)
+	}
+	pos := len(fb.b)
+	fb.b = binary.LittleEndian.AppendUint32(fb.b, uint32(len(v)/16))
+	fb.b = append(fb.b, v...)
+	return pos
+}
@@ -0,0 +1,235 @@
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// ExportParquetHandler exports data in Apache Parquet format from /api/v1/export/parquet.
+func ExportParquetHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer exportParquetDuration.UpdateDuration(startTime)
+
+	return exportColumnar(startTime, w, r, "application/vnd.apache.parquet", newParquetWriter)
+}
+
+var exportParquetDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/export/parquet"}`)
+
+// ExportArrowHandler exports data in Apache Arrow IPC streaming format from /api/v1/export/arrow.
+func ExportArrowHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer exportArrowDuration.UpdateDuration(startTime)
+
+	return exportColumnar(startTime, w, r, "application/vnd.apache.arrow.stream", newArrowWriter)
+}
+
+var exportArrowDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/export/arrow"}`)
+
+// columnarWriter writes columnarRows in some columnar format.
+//
+// columnarWriter methods are called sequentially.
+type columnarWriter interface {
+	// writeHeader writes the beginning of the exported data.
+	writeHeader() error
+
+	// writeRows writes cr as a single row group or a single record batch.
+	writeRows(cr *columnarRows) error
+
+	// writeFooter writes the end of the exported data.
+	writeFooter() error
+}
+
+// getRowGroupSize returns the number of rows per row group from row_group_size query arg at r.
+//
+// Every export worker buffers up to row group size rows, so row_group_size cannot exceed -search.exportRowGroupSize.
+func getRowGroupSize(r *http.Request) (int, error) {
+	rowGroupSize, err := httputil.GetInt(r, "row_group_size")
+	if err != nil {
+		return 0, httpserver.InvalidParamError(err)
+	}
+	if rowGroupSize <= 0 {
+		return *exportRowGroupSize, nil
+	}
+	if rowGroupSize > *exportRowGroupSize {
+		return 0, httpserver.InvalidParamError(fmt.Errorf("row_group_size=%d cannot exceed -search.exportRowGroupSize=%d", rowGroupSize, *exportRowGroupSize))
+	}
+	return rowGroupSize, nil
+}
+
+func exportColumnar(startTime time.Time, w http.ResponseWriter, r *http.Request, contentType string, newWriter func(w io.Writer) columnarWriter) error {
+	cp, err := getExportParams(r, startTime)
+	if err != nil {
+		return err
+	}
+	rowGroupSize, err := getRowGroupSize(r)
+	if err != nil {
+		return err
+	}
+
+	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, cp.quota.MaxSeriesPerQuery(*maxExportSeries))
+	w.Header().Set("Content-Type", contentType)
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	cw := newWriter(bw)
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+
+	// Every worker collects rows into its own columnarRows, so workers do not contend on the collected rows.
+	// The collected rows are written under cwLock when their number reaches rowGroupSize.
+	var crs sync.Map
+	var cwLock sync.Mutex
+	flushRows := func(cr *columnarRows) error {
+		cwLock.Lock()
+		err := cw.writeRows(cr)
+		cwLock.Unlock()
+		cr.reset()
+		return err
+	}
+	err = netstorage.ExportBlocksWithQuota(nil, sq, cp.deadline, cp.quota, func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange, workerID uint) error {
+		if err := bw.Error(); err != nil {
+			return err
+		}
+		if err := b.UnmarshalData(); err != nil {
+			return fmt.Errorf("cannot unmarshal block during export: %w", err)
+		}
+		v, ok := crs.Load(workerID)
+		if !ok {
+			v = &columnarRows{}
+			crs.Store(workerID, v)
+		}
+		cr := v.(*columnarRows)
+
+		xb := exportBlockPool.Get().(*exportBlock)
+		defer func() {
+			xb.reset()
+			exportBlockPool.Put(xb)
+		}()
+		xb.timestamps, xb.values = b.AppendRowsWithTimeRangeFilter(xb.timestamps[:0], xb.values[:0], tr)
+		timestamps, values := xb.timestamps, xb.values
+		for len(timestamps) > 0 {
+			n := min(len(timestamps), rowGroupSize-cr.rowsCount())
+			cr.addSeries(mn)
+			cr.addSamples(timestamps[:n], values[:n])
+			timestamps, values = timestamps[n:], values[n:]
+			if cr.rowsCount() >= rowGroupSize {
+				if err := flushRows(cr); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		crs.Range(func(_, v any) bool {
+			cr := v.(*columnarRows)
+			if cr.rowsCount() > 0 {
+				err = flushRows(cr)
+			}
+			return err == nil
+		})
+	}
+	if err == nil {
+		err = cw.writeFooter()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil && !netutil.IsTrivialNetworkError(err) {
+		return fmt.Errorf("error during sending the exported data to remote client: %w", err)
+	}
+	return nil
+}
+
+// columnarRows holds exported samples in columnar form.
+//
+// Every row contains labels, timestamp and value for a single sample.
+// Labels are stored once per series, while rows refer to them via series index.
+type columnarRows struct {
+	// labelsBuf contains names and values for labels of all the series.
+	labelsBuf []byte
+
+	// labelsEnds contains end offsets in labelsBuf for label names and values.
+	// Every label occupies two items - for the name and for the value.
+	labelsEnds []int
+
+	// seriesEnds contains end offsets in labelsEnds for every series.
+	seriesEnds []int
+
+	// rowSeries contains series index for every row.
+	rowSeries []int
+
+	timestamps []int64
+	values     []float64
+}
+
+func (cr *columnarRows) reset() {
+	cr.labelsBuf = cr.labelsBuf[:0]
+	cr.labelsEnds = cr.labelsEnds[:0]
+	cr.seriesEnds = cr.seriesEnds[:0]
+	cr.rowSeries = cr.rowSeries[:0]
+	cr.timestamps = cr.timestamps[:0]
+	cr.values = cr.values[:0]
+}
+
+func (cr *columnarRows) rowsCount() int {
+	return len(cr.timestamps)
+}
+
+// addSeries registers series with the given mn. The subsequent addSamples calls add samples for this series.
+func (cr *columnarRows) addSeries(mn *storage.MetricName) {
+	if len(mn.MetricGroup) > 0 {
+		cr.addString("__name__")
+		cr.addString(bytesutil.ToUnsafeString(mn.MetricGroup))
+	}
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		cr.addString(bytesutil.ToUnsafeString(tag.Key))
+		cr.addString(bytesutil.ToUnsafeString(tag.Value))
+	}
+	cr.seriesEnds = append(cr.seriesEnds, len(cr.labelsEnds))
+}
+
+func (cr *columnarRows) addString(s string) {
+	cr.labelsBuf = append(cr.labelsBuf, s...)
+	cr.labelsEnds = append(cr.labelsEnds, len(cr.labelsBuf))
+}
+
+// addSamples adds samples for the series registered by the last addSeries call.
+func (cr *columnarRows) addSamples(timestamps []int64, values []float64) {
+	seriesIdx := len(cr.seriesEnds) - 1
+	for range timestamps {
+		cr.rowSeries = append(cr.rowSeries, seriesIdx)
+	}
+	cr.timestamps = append(cr.timestamps, timestamps...)
+	cr.values = append(cr.values, values...)
+}
+
+// seriesLabelsRange returns the range of items at labelsEnds for the series with the given seriesIdx.
+func (cr *columnarRows) seriesLabelsRange(seriesIdx int) (int, int) {
+	start := 0
+	if seriesIdx > 0 {
+		start = cr.seriesEnds[seriesIdx-1]
+	}
+	return start, cr.seriesEnds[seriesIdx]
+}
+
+// getItem returns label name or label value for the given item index at labelsEnds.
+func (cr *columnarRows) getItem(itemIdx int) []byte {
+	start := 0
+	if itemIdx > 0 {
+		start = cr.labelsEnds[itemIdx-1]
+	}
+	return cr.labelsBuf[start:cr.labelsEnds[itemIdx]]
+}
@@ -0,0 +1,491 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/snappy"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestGetRowGroupSize(t *testing.T) {
+	f := func(query string, rowGroupSizeExpected int) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/export/parquet?"+query, nil)
+		rowGroupSize, err := getRowGroupSize(r)
+		if rowGroupSizeExpected <= 0 {
+			var esc *httpserver.ErrorWithStatusCode
+			if !errors.As(err, &esc) || esc.StatusCode != http.StatusBadRequest {
+				t.Fatalf("expecting error with status code 400 for %q; got %v", query, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", query, err)
+		}
+		if rowGroupSize != rowGroupSizeExpected {
+			t.Fatalf("unexpected row group size for %q; got %d; want %d", query, rowGroupSize, rowGroupSizeExpected)
+		}
+	}
+
+	f("", *exportRowGroupSize)
+	f("row_group_size=0", *exportRowGroupSize)
+	f("row_group_size=1000", 1000)
+	f("row_group_size=131072", *exportRowGroupSize)
+
+	// too big row_group_size
+	f("row_group_size=131073", 0)
+	f("row_group_size=100000000", 0)
+
+	// invalid row_group_size
+	f("row_group_size=foo", 0)
+}
+
+func newTestColumnarRows() *columnarRows {
+	var cr columnarRows
+
+	var mn storage.MetricName
+	mn.MetricGroup = []byte("foo")
+	mn.AddTag("job", "bar")
+	cr.addSeries(&mn)
+	cr.addSamples([]int64{1000, 2000}, []float64{1, 2})
+
+	mn.Reset()
+	mn.AddTag("instance", "baz")
+	cr.addSeries(&mn)
+	cr.addSamples([]int64{3000}, []float64{math.Inf(1)})
+
+	mn.Reset()
+	cr.addSeries(&mn)
+	cr.addSamples([]int64{4000}, []float64{-4.5})
+
+	return &cr
+}
+
+func TestColumnarRows(t *testing.T) {
+	cr := newTestColumnarRows()
+	if n := cr.rowsCount(); n != 4 {
+		t.Fatalf("unexpected number of rows; got %d; want 4", n)
+	}
+
+	var labels [][]string
+	for _, seriesIdx := range cr.rowSeries {
+		var items []string
+		start, end := cr.seriesLabelsRange(seriesIdx)
+		for i := start; i < end; i++ {
+			items = append(items, string(cr.getItem(i)))
+		}
+		labels = append(labels, items)
+	}
+	labelsExpected := [][]string{
+		{"__name__", "foo", "job", "bar"},
+		{"__name__", "foo", "job", "bar"},
+		{"instance", "baz"},
+		nil,
+	}
+	if !reflect.DeepEqual(labels, labelsExpected) {
+		t.Fatalf("unexpected labels;\ngot\n%q\nwant\n%q", labels, labelsExpected)
+	}
+
+	cr.reset()
+	if n := cr.rowsCount(); n != 0 {
+		t.Fatalf("unexpected number of rows after reset; got %d; want 0", n)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	var bb bytes.Buffer
+	pw := newParquetWriter(&bb)
+	if err := pw.writeHeader(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for range 2 {
+		if err := pw.writeRows(newTestColumnarRows()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := pw.writeFooter(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data := bb.Bytes()
+
+	if !bytes.HasPrefix(data, []byte(parquetMagic)) || !bytes.HasSuffix(data, []byte(parquetMagic)) {
+		t.Fatalf("missing %q magic at the start and the end of the file", parquetMagic)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-footerLen : len(data)-8]
+	tr := &thriftReader{b: footer}
+	fileMetadata := tr.readStruct()
+	if len(tr.b) != 0 {
+		t.Fatalf("unexpected tail left after reading FileMetaData: %X", tr.b)
+	}
+
+	if n := fileMetadata[3].(int64); n != 8 {
+		t.Fatalf("unexpected num_rows; got %d; want 8", n)
+	}
+	var names []string
+	for _, v := range fileMetadata[2].([]any) {
+		names = append(names, string(v.(map[int16]any)[4].([]byte)))
+	}
+	namesExpected := []string{"schema", "labels", "key_value", "key", "value", "timestamp", "value"}
+	if !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected schema names; got %q; want %q", names, namesExpected)
+	}
+
+	rowGroups := fileMetadata[4].([]any)
+	if len(rowGroups) != 2 {
+		t.Fatalf("unexpected number of row groups; got %d; want 2", len(rowGroups))
+	}
+	for _, v := range rowGroups {
+		rg := v.(map[int16]any)
+		if n := rg[3].(int64); n != 4 {
+			t.Fatalf("unexpected num_rows in row group; got %d; want 4", n)
+		}
+		columns := rg[1].([]any)
+		if len(columns) != len(parquetColumns) {
+			t.Fatalf("unexpected number of columns; got %d; want %d", len(columns), len(parquetColumns))
+		}
+		var pages [][]byte
+		for i, c := range columns {
+			cmd := c.(map[int16]any)[3].(map[int16]any)
+			offset := cmd[9].(int64)
+			size := cmd[7].(int64)
+			tr := &thriftReader{b: data[offset : offset+size]}
+			pageHeader := tr.readStruct()
+			if n := int(pageHeader[3].(int32)); n != len(tr.b) {
+				t.Fatalf("unexpected compressed_page_size for column #%d; got %d; want %d", i, n, len(tr.b))
+			}
+			page, err := snappy.Decode(nil, tr.b)
+			if err != nil {
+				t.Fatalf("cannot decompress page for column #%d: %s", i, err)
+			}
+			if n := int(pageHeader[2].(int32)); n != len(page) {
+				t.Fatalf("unexpected uncompressed_page_size for column #%d; got %d; want %d", i, n, len(page))
+			}
+			numValues := pageHeader[5].(map[int16]any)[1].(int32)
+			if numValuesExpected := int32(cmd[5].(int64)); numValues != numValuesExpected {
+				t.Fatalf("unexpected num_values for column #%d; got %d; want %d", i, numValues, numValuesExpected)
+			}
+			pages = append(pages, page)
+		}
+
+		// Verify label names column.
+		repLevels, tail := readParquetLevels(t, pages[0])
+		defLevels, tail := readParquetLevels(t, tail)
+		if !reflect.DeepEqual(repLevels, []int{0, 1, 0, 1, 0, 0}) {
+			t.Fatalf("unexpected repetition levels: %v", repLevels)
+		}
+		if !reflect.DeepEqual(defLevels, []int{1, 1, 1, 1, 1, 0}) {
+			t.Fatalf("unexpected definition levels: %v", defLevels)
+		}
+		var keys []string
+		for len(tail) > 0 {
+			n := binary.LittleEndian.Uint32(tail)
+			keys = append(keys, string(tail[4:4+n]))
+			tail = tail[4+n:]
+		}
+		if !reflect.DeepEqual(keys, []string{"__name__", "job", "__name__", "job", "instance"}) {
+			t.Fatalf("unexpected label names: %q", keys)
+		}
+
+		// Verify timestamp and value columns.
+		var timestamps []int64
+		var values []float64
+		for i := 0; i < len(pages[2]); i += 8 {
+			timestamps = append(timestamps, int64(binary.LittleEndian.Uint64(pages[2][i:])))
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(pages[3][i:])))
+		}
+		if !reflect.DeepEqual(timestamps, []int64{1000, 2000, 3000, 4000}) {
+			t.Fatalf("unexpected timestamps: %v", timestamps)
+		}
+		if !reflect.DeepEqual(values, []float64{1, 2, math.Inf(1), -4.5}) {
+			t.Fatalf("unexpected values: %v", values)
+		}
+	}
+}
+
+func readParquetLevels(t *testing.T, src []byte) ([]int, []byte) {
+	t.Helper()
+	n := binary.LittleEndian.Uint32(src)
+	data := src[4 : 4+n]
+	var levels []int
+	for len(data) > 0 {
+		header, nSize := binary.Uvarint(data)
+		if header&1 != 0 {
+			t.Fatalf("unexpected bit-packed run")
+		}
+		for range header >> 1 {
+			levels = append(levels, int(data[nSize]))
+		}
+		data = data[nSize+1:]
+	}
+	return levels, src[4+n:]
+}
+
+// thriftReader reads data in Thrift compact protocol.
+type thriftReader struct {
+	b []byte
+}
+
+func (tr *thriftReader) readStruct() map[int16]any {
+	m := make(map[int16]any)
+	var id int16
+	for {
+		header := tr.b[0]
+		tr.b = tr.b[1:]
+		if header == 0 {
+			return m
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(tr.readVarint())
+		}
+		m[id] = tr.readValue(header & 0x0f)
+	}
+}
+
+func (tr *thriftReader) readValue(typ byte) any {
+	switch typ {
+	case thriftTypeBoolTrue:
+		return true
+	case thriftTypeBoolFalse:
+		return false
+	case thriftTypeI32:
+		return int32(tr.readVarint())
+	case thriftTypeI64:
+		return tr.readVarint()
+	case thriftTypeBinary:
+		n, nSize := binary.Uvarint(tr.b)
+		v := tr.b[nSize : nSize+int(n)]
+		tr.b = tr.b[nSize+int(n):]
+		return v
+	case thriftTypeList:
+		header := tr.b[0]
+		tr.b = tr.b[1:]
+		n := int(header >> 4)
+		if n == 15 {
+			v, nSize := binary.Uvarint(tr.b)
+			tr.b = tr.b[nSize:]
+			n = int(v)
+		}
+		a := make([]any, n)
+		for i := range a {
+			a[i] = tr.readValue(header & 0x0f)
+		}
+		return a
+	case thriftTypeStruct:
+		return tr.readStruct()
+	default:
+		panic("unexpected thrift type")
+	}
+}
+
+func (tr *thriftReader) readVarint() int64 {
+	v, nSize := binary.Varint(tr.b)
+	tr.b = tr.b[nSize:]
+	return v
+}
+
+func TestArrowWriter(t *testing.T) {
+	var bb bytes.Buffer
+	aw := newArrowWriter(&bb)
+	if err := aw.writeHeader(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := aw.writeRows(newTestColumnarRows()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := aw.writeFooter(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data := bb.Bytes()
+
+	readMessage := func() (flatbufferTableReader, []byte) {
+		t.Helper()
+		if len(data)%8 != 0 {
+			t.Fatalf("unexpected message alignment; len(data)=%d", len(data))
+		}
+		if v := binary.LittleEndian.Uint32(data); v != 0xffffffff {
+			t.Fatalf("missing continuation marker; got %X", v)
+		}
+		metadataLen := int(binary.LittleEndian.Uint32(data[4:]))
+		if metadataLen%8 != 0 {
+			t.Fatalf("unexpected metadata length: %d", metadataLen)
+		}
+		metadata := data[8 : 8+metadataLen]
+		msg := newFlatbufferTableReader(metadata, int(binary.LittleEndian.Uint32(metadata)))
+		if v := msg.scalar(0, 2); v != arrowMetadataVersionV5 {
+			t.Fatalf("unexpected metadata version; got %d; want %d", v, arrowMetadataVersionV5)
+		}
+		bodyLen := int(msg.scalar(3, 8))
+		body := data[8+metadataLen : 8+metadataLen+bodyLen]
+		data = data[8+metadataLen+bodyLen:]
+		return msg, body
+	}
+
+	// Verify schema
+	msg, _ := readMessage()
+	if v := msg.scalar(1, 1); v != arrowMessageHeaderSchema {
+		t.Fatalf("unexpected message header type; got %d; want %d", v, arrowMessageHeaderSchema)
+	}
+	var getFieldNames func(fields []flatbufferTableReader) []string
+	getFieldNames = func(fields []flatbufferTableReader) []string {
+		var names []string
+		for _, f := range fields {
+			names = append(names, f.string(0))
+			names = append(names, getFieldNames(f.vector(5))...)
+		}
+		return names
+	}
+	names := getFieldNames(msg.table(2).vector(1))
+	namesExpected := []string{"labels", "entries", "key", "value", "timestamp", "value"}
+	if !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected field names; got %q; want %q", names, namesExpected)
+	}
+
+	// Verify record batch
+	msg, body := readMessage()
+	if v := msg.scalar(1, 1); v != arrowMessageHeaderRecordBatch {
+		t.Fatalf("unexpected message header type; got %d; want %d", v, arrowMessageHeaderRecordBatch)
+	}
+	rb := msg.table(2)
+	if n := rb.scalar(0, 8); n != 4 {
+		t.Fatalf("unexpected record batch length; got %d; want 4", n)
+	}
+	nodes := rb.structVector(1)
+	nodesExpected := []uint64{4, 0, 5, 0, 5, 0, 5, 0, 4, 0, 4, 0}
+	if !reflect.DeepEqual(nodes, nodesExpected) {
+		t.Fatalf("unexpected nodes; got %v; want %v", nodes, nodesExpected)
+	}
+	buffers := rb.structVector(2)
+	if len(buffers) != 2*13 {
+		t.Fatalf("unexpected number of buffers; got %d; want 13", len(buffers)/2)
+	}
+	getBuffer := func(i int) []byte {
+		offset, length := buffers[2*i], buffers[2*i+1]
+		if offset%8 != 0 {
+			t.Fatalf("unexpected alignment for buffer #%d: %d", i, offset)
+		}
+		return body[offset : offset+length]
+	}
+	var labelsOffsets []uint32
+	for b := getBuffer(1); len(b) > 0; b = b[4:] {
+		labelsOffsets = append(labelsOffsets, binary.LittleEndian.Uint32(b))
+	}
+	if !reflect.DeepEqual(labelsOffsets, []uint32{0, 2, 4, 5, 5}) {
+		t.Fatalf("unexpected labels offsets: %v", labelsOffsets)
+	}
+	if s := string(getBuffer(5)); s != "__name__job__name__jobinstance" {
+		t.Fatalf("unexpected label names: %q", s)
+	}
+	if s := string(getBuffer(8)); s != "foobarfoobarbaz" {
+		t.Fatalf("unexpected label values: %q", s)
+	}
+	var timestamps []int64
+	var values []float64
+	for i := 0; i < 4; i++ {
+		timestamps = append(timestamps, int64(binary.LittleEndian.Uint64(getBuffer(10)[8*i:])))
+		values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(getBuffer(12)[8*i:])))
+	}
+	if !reflect.DeepEqual(timestamps, []int64{1000, 2000, 3000, 4000}) {
+		t.Fatalf("unexpected timestamps: %v", timestamps)
+	}
+	if !reflect.DeepEqual(values, []float64{1, 2, math.Inf(1), -4.5}) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	// Verify end-of-stream marker
+	if !bytes.Equal(data, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}) {
+		t.Fatalf("unexpected end-of-stream marker: %X", data)
+	}
+}
+
+// flatbufferTableReader reads fields from flatbuffers table.
+type flatbufferTableReader struct {
+	b   []byte
+	pos int
+}
+
+func newFlatbufferTableReader(b []byte, pos int) flatbufferTableReader {
+	return flatbufferTableReader{
+		b:   b,
+		pos: pos,
+	}
+}
+
+func (tr flatbufferTableReader) fieldPos(id, size int) int {
+	vtablePos := tr.pos - int(int32(binary.LittleEndian.Uint32(tr.b[tr.pos:])))
+	vtableSize := int(binary.LittleEndian.Uint16(tr.b[vtablePos:]))
+	if 4+2*id >= vtableSize {
+		return -1
+	}
+	offset := int(binary.LittleEndian.Uint16(tr.b[vtablePos+4+2*id:]))
+	if offset == 0 {
+		return -1
+	}
+	pos := tr.pos + offset
+	if pos%size != 0 {
+		panic("unexpected field alignment")
+	}
+	return pos
+}
+
+func (tr flatbufferTableReader) scalar(id, size int) uint64 {
+	pos := tr.fieldPos(id, size)
+	if pos < 0 {
+		return 0
+	}
+	v := uint64(0)
+	for i := range size {
+		v |= uint64(tr.b[pos+i]) << (8 * i)
+	}
+	return v
+}
+
+func (tr flatbufferTableReader) ref(id int) int {
+	pos := tr.fieldPos(id, 4)
+	return pos + int(binary.LittleEndian.Uint32(tr.b[pos:]))
+}
+
+func (tr flatbufferTableReader) table(id int) flatbufferTableReader {
+	return newFlatbufferTableReader(tr.b, tr.ref(id))
+}
+
+func (tr flatbufferTableReader) string(id int) string {
+	pos := tr.ref(id)
+	n := int(binary.LittleEndian.Uint32(tr.b[pos:]))
+	return string(tr.b[pos+4 : pos+4+n])
+}
+
+func (tr flatbufferTableReader) vector(id int) []flatbufferTableReader {
+	pos := tr.ref(id)
+	n := int(binary.LittleEndian.Uint32(tr.b[pos:]))
+	a := make([]flatbufferTableReader, n)
+	for i := range a {
+		itemPos := pos + 4 + 4*i
+		a[i] = newFlatbufferTableReader(tr.b, itemPos+int(binary.LittleEndian.Uint32(tr.b[itemPos:])))
+	}
+	return a
+}
+
+func (tr flatbufferTableReader) structVector(id int) []uint64 {
+	pos := tr.ref(id)
+	n := int(binary.LittleEndian.Uint32(tr.b[pos:]))
+	if (pos+4)%8 != 0 {
+		panic("unexpected struct vector alignment")
+	}
+	a := make([]uint64, 2*n)
+	for i := range a {
+		a[i] = binary.LittleEndian.Uint64(tr.b[pos+4+8*i:])
+	}
+	return a
+}
@@ -0,0 +1,469 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/golang/snappy"
+)
+
+// parquetWriter writes columnarRows in Apache Parquet format.
+//
+// Every columnarRows is written as a separate row group with a single data page per column.
+// The file has the following schema:
+//
+//	message schema {
+//	  required group labels (MAP) {
+//	    repeated group key_value {
+//	      required binary key (STRING);
+//	      required binary value (STRING);
+//	    }
+//	  }
+//	  required int64 timestamp (TIMESTAMP(MILLIS,true));
+//	  required double value;
+//	}
+//
+// See https://parquet.apache.org/docs/file-format/
+type parquetWriter struct {
+	w io.Writer
+
+	// offset is the number of bytes written to w.
+	offset int64
+
+	numRows   int64
+	rowGroups []parquetRowGroup
+
+	pageBuf       []byte
+	levelsBuf     []byte
+	compressedBuf []byte
+	tw            thriftWriter
+}
+
+type parquetRowGroup struct {
+	numRows int64
+	columns [len(parquetColumns)]parquetColumnChunk
+}
+
+type parquetColumnChunk struct {
+	numValues             int64
+	dataPageOffset        int64
+	totalUncompressedSize int64
+	totalCompressedSize   int64
+}
+
+// parquetColumns contains leaf columns of the Parquet schema.
+var parquetColumns = [...]struct {
+	path []string
+	typ  int32
+}{
+	{
+		path: []string{"labels", "key_value", "key"},
+		typ:  parquetTypeByteArray,
+	},
+	{
+		path: []string{"labels", "key_value", "value"},
+		typ:  parquetTypeByteArray,
+	},
+	{
+		path: []string{"timestamp"},
+		typ:  parquetTypeInt64,
+	},
+	{
+		path: []string{"value"},
+		typ:  parquetTypeDouble,
+	},
+}
+
+// Parquet constants. See https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+const (
+	parquetMagic = "PAR1"
+
+	parquetTypeInt64     = 2
+	parquetTypeDouble    = 5
+	parquetTypeByteArray = 6
+
+	parquetRepetitionRequired = 0
+	parquetRepetitionRepeated = 2
+
+	parquetConvertedTypeUTF8            = 0
+	parquetConvertedTypeMap             = 1
+	parquetConvertedTypeTimestampMillis = 9
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	parquetCodecSnappy = 1
+
+	parquetPageTypeData = 0
+)
+
+func newParquetWriter(w io.Writer) columnarWriter {
+	return &parquetWriter{
+		w: w,
+	}
+}
+
+func (pw *parquetWriter) write(data []byte) error {
+	n, err := pw.w.Write(data)
+	pw.offset += int64(n)
+	return err
+}
+
+func (pw *parquetWriter) writeHeader() error {
+	return pw.write([]byte(parquetMagic))
+}
+
+func (pw *parquetWriter) writeRows(cr *columnarRows) error {
+	rg := parquetRowGroup{
+		numRows: int64(cr.rowsCount()),
+	}
+	for i := range parquetColumns {
+		pw.levelsBuf = pw.levelsBuf[:0]
+		pw.pageBuf = pw.pageBuf[:0]
+		numValues := cr.rowsCount()
+		switch i {
+		case 0, 1:
+			// Label names are stored at even items, while label values are stored at odd items for every series.
+			pw.pageBuf, numValues = marshalParquetLabelsPage(pw.pageBuf, &pw.levelsBuf, cr, i)
+		case 2:
+			for _, ts := range cr.timestamps {
+				pw.pageBuf = binary.LittleEndian.AppendUint64(pw.pageBuf, uint64(ts))
+			}
+		case 3:
+			for _, v := range cr.values {
+				pw.pageBuf = binary.LittleEndian.AppendUint64(pw.pageBuf, math.Float64bits(v))
+			}
+		}
+
+		pw.compressedBuf = snappy.Encode(pw.compressedBuf[:cap(pw.compressedBuf)], pw.pageBuf)
+
+		tw := &pw.tw
+		tw.reset()
+		tw.fieldI32(1, parquetPageTypeData)
+		tw.fieldI32(2, int32(len(pw.pageBuf)))
+		tw.fieldI32(3, int32(len(pw.compressedBuf)))
+		tw.fieldStructBegin(5)
+		tw.fieldI32(1, int32(numValues))
+		tw.fieldI32(2, parquetEncodingPlain)
+		tw.fieldI32(3, parquetEncodingRLE)
+		tw.fieldI32(4, parquetEncodingRLE)
+		tw.structEnd()
+		tw.structEnd()
+
+		cc := &rg.columns[i]
+		cc.numValues = int64(numValues)
+		cc.dataPageOffset = pw.offset
+		cc.totalUncompressedSize = int64(len(tw.b) + len(pw.pageBuf))
+		cc.totalCompressedSize = int64(len(tw.b) + len(pw.compressedBuf))
+		if err := pw.write(tw.b); err != nil {
+			return err
+		}
+		if err := pw.write(pw.compressedBuf); err != nil {
+			return err
+		}
+	}
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.numRows += rg.numRows
+	return nil
+}
+
+// marshalParquetLabelsPage appends data page contents for the labels map column with the given columnIdx to dst.
+//
+// columnIdx must be 0 for label names and 1 for label values.
+// It returns the number of values in the page including empty maps.
+func marshalParquetLabelsPage(dst []byte, levelsBuf *[]byte, cr *columnarRows, columnIdx int) ([]byte, int) {
+	// Repetition levels: 0 for the first label in a row, 1 for the subsequent labels.
+	numValues := 0
+	rl := newParquetLevelsEncoder(*levelsBuf)
+	for _, seriesIdx := range cr.rowSeries {
+		start, end := cr.seriesLabelsRange(seriesIdx)
+		labelsCount := (end - start) / 2
+		rl.add(0, 1)
+		if labelsCount > 1 {
+			rl.add(1, labelsCount-1)
+		}
+		numValues += max(labelsCount, 1)
+	}
+	*levelsBuf = rl.finish()
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(*levelsBuf)))
+	dst = append(dst, *levelsBuf...)
+
+	// Definition levels: 0 for empty maps, 1 for the rest of values.
+	dl := newParquetLevelsEncoder((*levelsBuf)[:0])
+	for _, seriesIdx := range cr.rowSeries {
+		start, end := cr.seriesLabelsRange(seriesIdx)
+		if end == start {
+			dl.add(0, 1)
+		} else {
+			dl.add(1, (end-start)/2)
+		}
+	}
+	*levelsBuf = dl.finish()
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(*levelsBuf)))
+	dst = append(dst, *levelsBuf...)
+
+	// Values in PLAIN encoding.
+	for _, seriesIdx := range cr.rowSeries {
+		start, end := cr.seriesLabelsRange(seriesIdx)
+		for j := start + columnIdx; j < end; j += 2 {
+			item := cr.getItem(j)
+			dst = binary.LittleEndian.AppendUint32(dst, uint32(len(item)))
+			dst = append(dst, item...)
+		}
+	}
+	return dst, numValues
+}
+
+// parquetLevelsEncoder encodes repetition and definition levels with the maximum level 1
+// into RLE runs of the RLE/bit-packing hybrid encoding.
+//
+// See https://parquet.apache.org/docs/file-format/data-pages/encodings/#run-length-encoding--bit-packing-hybrid-rle--3
+type parquetLevelsEncoder struct {
+	dst      []byte
+	level    int
+	runCount int
+}
+
+func newParquetLevelsEncoder(dst []byte) *parquetLevelsEncoder {
+	return &parquetLevelsEncoder{
+		dst: dst[:0],
+	}
+}
+
+func (le *parquetLevelsEncoder) add(level, count int) {
+	if le.runCount > 0 && level != le.level {
+		le.flushRun()
+	}
+	le.level = level
+	le.runCount += count
+}
+
+func (le *parquetLevelsEncoder) flushRun() {
+	le.dst = binary.AppendUvarint(le.dst, uint64(le.runCount)<<1)
+	le.dst = append(le.dst, byte(le.level))
+	le.runCount = 0
+}
+
+func (le *parquetLevelsEncoder) finish() []byte {
+	if le.runCount > 0 {
+		le.flushRun()
+	}
+	return le.dst
+}
+
+func (pw *parquetWriter) writeFooter() error {
+	tw := &pw.tw
+	tw.reset()
+
+	// FileMetaData
+	tw.fieldI32(1, 1)
+	tw.fieldListBegin(2, thriftTypeStruct, 7)
+	marshalParquetSchemaElement(tw, "schema", -1, -1, 3, -1)
+	marshalParquetSchemaElement(tw, "labels", -1, parquetRepetitionRequired, 1, parquetConvertedTypeMap)
+	marshalParquetSchemaElement(tw, "key_value", -1, parquetRepetitionRepeated, 2, -1)
+	marshalParquetSchemaElement(tw, "key", parquetTypeByteArray, parquetRepetitionRequired, -1, parquetConvertedTypeUTF8)
+	marshalParquetSchemaElement(tw, "value", parquetTypeByteArray, parquetRepetitionRequired, -1, parquetConvertedTypeUTF8)
+	marshalParquetSchemaElement(tw, "timestamp", parquetTypeInt64, parquetRepetitionRequired, -1, parquetConvertedTypeTimestampMillis)
+	marshalParquetSchemaElement(tw, "value", parquetTypeDouble, parquetRepetitionRequired, -1, -1)
+	tw.fieldI64(3, pw.numRows)
+	tw.fieldListBegin(4, thriftTypeStruct, len(pw.rowGroups))
+	for i := range pw.rowGroups {
+		marshalParquetRowGroup(tw, &pw.rowGroups[i])
+	}
+	tw.fieldString(6, "VictoriaMetrics")
+	tw.structEnd()
+
+	footerLen := len(tw.b)
+	tw.b = binary.LittleEndian.AppendUint32(tw.b, uint32(footerLen))
+	tw.b = append(tw.b, parquetMagic...)
+	return pw.write(tw.b)
+}
+
+// marshalParquetSchemaElement marshals SchemaElement struct into tw. Negative args are omitted.
+func marshalParquetSchemaElement(tw *thriftWriter, name string, typ, repetitionType, numChildren, convertedType int32) {
+	tw.structBegin()
+	if typ >= 0 {
+		tw.fieldI32(1, typ)
+	}
+	if repetitionType >= 0 {
+		tw.fieldI32(3, repetitionType)
+	}
+	tw.fieldString(4, name)
+	if numChildren >= 0 {
+		tw.fieldI32(5, numChildren)
+	}
+	if convertedType >= 0 {
+		tw.fieldI32(6, convertedType)
+
+		// LogicalType union
+		tw.fieldStructBegin(10)
+		switch convertedType {
+		case parquetConvertedTypeUTF8:
+			// StringType
+			tw.fieldStructBegin(1)
+			tw.structEnd()
+		case parquetConvertedTypeMap:
+			// MapType
+			tw.fieldStructBegin(2)
+			tw.structEnd()
+		case parquetConvertedTypeTimestampMillis:
+			// TimestampType
+			tw.fieldStructBegin(8)
+			tw.fieldBool(1, true)
+			tw.fieldStructBegin(2)
+			tw.fieldStructBegin(1)
+			tw.structEnd()
+			tw.structEnd()
+			tw.structEnd()
+		}
+		tw.structEnd()
+	}
+	tw.structEnd()
+}
+
+func marshalParquetRowGroup(tw *thriftWriter, rg *parquetRowGroup) {
+	totalUncompressedSize := int64(0)
+	totalCompressedSize := int64(0)
+	for i := range rg.columns {
+		totalUncompressedSize += rg.columns[i].totalUncompressedSize
+		totalCompressedSize += rg.columns[i].totalCompressedSize
+	}
+
+	tw.structBegin()
+	tw.fieldListBegin(1, thriftTypeStruct, len(rg.columns))
+	for i := range rg.columns {
+		cc := &rg.columns[i]
+		col := &parquetColumns[i]
+
+		// ColumnChunk
+		tw.structBegin()
+		tw.fieldI64(2, cc.dataPageOffset)
+
+		// ColumnMetaData
+		tw.fieldStructBegin(3)
+		tw.fieldI32(1, col.typ)
+		tw.fieldListBegin(2, thriftTypeI32, 2)
+		tw.i32(parquetEncodingPlain)
+		tw.i32(parquetEncodingRLE)
+		tw.fieldListBegin(3, thriftTypeBinary, len(col.path))
+		for _, s := range col.path {
+			tw.string(s)
+		}
+		tw.fieldI32(4, parquetCodecSnappy)
+		tw.fieldI64(5, cc.numValues)
+		tw.fieldI64(6, cc.totalUncompressedSize)
+		tw.fieldI64(7, cc.totalCompressedSize)
+		tw.fieldI64(9, cc.dataPageOffset)
+		tw.structEnd()
+
+		tw.structEnd()
+	}
+	tw.fieldI64(2, totalUncompressedSize)
+	tw.fieldI64(3, rg.numRows)
+	tw.fieldI64(5, rg.columns[0].dataPageOffset)
+	tw.fieldI64(6, totalCompressedSize)
+	tw.structEnd()
+}
+
+// thriftWriter marshals data in Thrift compact protocol.
+//
+// See https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+type thriftWriter struct {
+	b []byte
+
+	// lastFieldID is the id of the last written field in the current struct.
+	lastFieldID int16
+
+	// lastFieldIDs holds lastFieldID values for the parent structs.
+	lastFieldIDs []int16
+}
+
+const (
+	thriftTypeBoolTrue  = 1
+	thriftTypeBoolFalse = 2
+	thriftTypeI32       = 5
+	thriftTypeI64       = 6
+	thriftTypeBinary    = 8
+	thriftTypeList      = 9
+	thriftTypeStruct    = 12
+)
+
+func (tw *thriftWriter) reset() {
+	tw.b = tw.b[:0]
+	tw.lastFieldID = 0
+	tw.lastFieldIDs = tw.lastFieldIDs[:0]
+}
+
+func (tw *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - tw.lastFieldID; delta > 0 && delta <= 15 {
+		tw.b = append(tw.b, byte(delta<<4)|typ)
+	} else {
+		tw.b = append(tw.b, typ)
+		tw.b = binary.AppendVarint(tw.b, int64(id))
+	}
+	tw.lastFieldID = id
+}
+
+func (tw *thriftWriter) fieldBool(id int16, v bool) {
+	if v {
+		tw.fieldHeader(id, thriftTypeBoolTrue)
+	} else {
+		tw.fieldHeader(id, thriftTypeBoolFalse)
+	}
+}
+
+func (tw *thriftWriter) fieldI32(id int16, v int32) {
+	tw.fieldHeader(id, thriftTypeI32)
+	tw.i32(v)
+}
+
+func (tw *thriftWriter) fieldI64(id int16, v int64) {
+	tw.fieldHeader(id, thriftTypeI64)
+	tw.b = binary.AppendVarint(tw.b, v)
+}
+
+func (tw *thriftWriter) fieldString(id int16, s string) {
+	tw.fieldHeader(id, thriftTypeBinary)
+	tw.string(s)
+}
+
+// fieldListBegin starts list field with n items of elemType. The items must be written after the call.
+func (tw *thriftWriter) fieldListBegin(id int16, elemType byte, n int) {
+	tw.fieldHeader(id, thriftTypeList)
+	if n < 15 {
+		tw.b = append(tw.b, byte(n<<4)|elemType)
+	} else {
+		tw.b = append(tw.b, 0xf0|elemType)
+		tw.b = binary.AppendUvarint(tw.b, uint64(n))
+	}
+}
+
+// fieldStructBegin starts struct field. The struct must be finished with structEnd call.
+func (tw *thriftWriter) fieldStructBegin(id int16) {
+	tw.fieldHeader(id, thriftTypeStruct)
+	tw.structBegin()
+}
+
+// structBegin starts struct. The struct must be finished with structEnd call.
+func (tw *thriftWriter) structBegin() {
+	tw.lastFieldIDs = append(tw.lastFieldIDs, tw.lastFieldID)
+	tw.lastFieldID = 0
+}
+
+func (tw *thriftWriter) structEnd() {
+	tw.b = append(tw.b, 0)
+	if n := len(tw.lastFieldIDs); n > 0 {
+		tw.lastFieldID = tw.lastFieldIDs[n-1]
+		tw.lastFieldIDs = tw.lastFieldIDs[:n-1]
+	}
+}
+
+func (tw *thriftWriter) i32(v int32) {
+	tw.b = binary.AppendVarint(tw.b, int64(v))
+}
+
+func (tw *thriftWriter) string(s string) {
+	tw.b = binary.AppendUvarint(tw.b, uint64(len(s)))
+	tw.b = append(tw.b, s...)
+}
@@ -66,6 +66,8 @@ var (
 		"/api/v1/labels and /api/v1/label/.../values . This may be useful for decreasing load on VictoriaMetrics when extra filters "+
 		"match too many time series. The downside is that superfluous labels or series could be returned, which do not match the extra filters. "+
 		"See also -search.maxLabelsAPISeries and -search.maxLabelsAPIDuration")
+	exportRowGroupSize = flag.Int("search.exportRowGroupSize", 128*1024, "The maximum number of samples per row group in Parquet files returned from /api/v1/export/parquet "+
+		"and per record batch in Arrow streams returned from /api/v1/export/arrow. It can be decreased on per-request basis via row_group_size query arg")
 )
 
 // Default step used if not set.
@@ -187,7 +189,7 @@ func ExportCSVHandler(startTime time.Time, w http.ResponseWriter, r *http.Reques
 	fieldNames := strings.Split(format, ",")
 	reduceMemUsage := httputil.GetBool(r, "reduce_mem_usage")
 
-	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, *maxExportSeries)
+	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, cp.quota.MaxSeriesPerQuery(*maxExportSeries))
 	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
@@ -203,7 +205,7 @@ func ExportCSVHandler(startTime time.Time, w http.ResponseWriter, r *http.Reques
 	}
 	doneCh := make(chan error, 1)
 	if !reduceMemUsage {
-		rss, err := netstorage.ProcessSearchQuery(nil, sq, cp.deadline)
+		rss, err := netstorage.ProcessSearchQueryWithQuota(nil, sq, cp.deadline, cp.quota)
 		if err != nil {
 			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 		}
@@ -227,7 +229,7 @@ func ExportCSVHandler(startTime time.Time, w http.ResponseWriter, r *http.Reques
 		}()
 	} else {
 		go func() {
-			err := netstorage.ExportBlocks(nil, sq, cp.deadline, func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange, workerID uint) error {
+			err := netstorage.ExportBlocksWithQuota(nil, sq, cp.deadline, cp.quota, func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange, workerID uint) error {
 				if err := bw.Error(); err != nil {
 					return err
 				}
@@ -268,7 +270,7 @@ func ExportNativeHandler(startTime time.Time, w http.ResponseWriter, r *http.Req
 		return err
 	}
 
-	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, *maxExportSeries)
+	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, cp.quota.MaxSeriesPerQuery(*maxExportSeries))
 	w.Header().Set("Content-Type", "VictoriaMetrics/native")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
@@ -281,7 +283,7 @@ func ExportNativeHandler(startTime time.Time, w http.ResponseWriter, r *http.Req
 	_, _ = bw.Write(trBuf)
 
 	// Marshal native blocks.
-	err = netstorage.ExportBlocks(nil, sq, cp.deadline, func(mn *storage.MetricName, b *storage.Block, _ storage.TimeRange, workerID uint) error {
+	err = netstorage.ExportBlocksWithQuota(nil, sq, cp.deadline, cp.quota, func(mn *storage.MetricName, b *storage.Block, _ storage.TimeRange, workerID uint) error {
 		if err := bw.Error(); err != nil {
 			return err
 		}
@@ -414,12 +416,12 @@ func exportHandler(qt *querytracer.Tracer, w http.ResponseWriter, cp *commonPara
 		}
 	}
 
-	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, *maxExportSeries)
+	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, cp.quota.MaxSeriesPerQuery(*maxExportSeries))
 	w.Header().Set("Content-Type", contentType)
 
 	doneCh := make(chan error, 1)
 	if !reduceMemUsage {
-		rss, err := netstorage.ProcessSearchQuery(qt, sq, cp.deadline)
+		rss, err := netstorage.ProcessSearchQueryWithQuota(qt, sq, cp.deadline, cp.quota)
 		if err != nil {
 			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 		}
@@ -446,7 +448,7 @@ func exportHandler(qt *querytracer.Tracer, w http.ResponseWriter, cp *commonPara
 	} else {
 		qtChild := qt.NewChild("background export format=%s", format)
 		go func() {
-			err := netstorage.ExportBlocks(qtChild, sq, cp.deadline, func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange, workerID uint) error {
+			err := netstorage.ExportBlocksWithQuota(qtChild, sq, cp.deadline, cp.quota, func(mn *storage.MetricName, b *storage.Block, tr storage.TimeRange, workerID uint) error {
 				if err := bw.Error(); err != nil {
 					return err
 				}
@@ -740,7 +742,11 @@ func SeriesHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseW
 		return httpserver.InvalidParamError(err)
 	}
 
-	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, *maxSeriesLimit)
+	quota := searchutil.GetQuota(r)
+	if err := quota.CheckSamplesRate(); err != nil {
+		return err
+	}
+	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, quota.MaxSeriesPerQuery(*maxSeriesLimit))
 	metricNames, err := netstorage.SearchMetricNames(qt, sq, cp.deadline)
 	if err != nil {
 		return fmt.Errorf("cannot fetch time series for %q: %w", sq, err)
@@ -760,6 +766,73 @@ func SeriesHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseW
 
 var seriesDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/series"}`)
 
+// QueryExemplarsHandler processes /api/v1/query_exemplars request.
+//
+// Series selectors are obtained from `query` arg and from `match[]` args.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+func QueryExemplarsHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer queryExemplarsDuration.UpdateDuration(startTime)
+
+	if err := r.ParseForm(); err != nil {
+		return httpserver.InvalidParamError(fmt.Errorf("cannot parse request form values: %w", err))
+	}
+	if query := r.FormValue("query"); query != "" {
+		maxLen := searchutil.GetMaxQueryLen()
+		if len(query) > maxLen {
+			return httpserver.InvalidParamError(fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxLen))
+		}
+		selectors, err := getSeriesSelectorsFromQuery(query)
+		if err != nil {
+			return httpserver.InvalidParamError(err)
+		}
+		r.Form["match[]"] = append(r.Form["match[]"], selectors...)
+	}
+	if len(r.Form["match[]"]) == 0 && len(r.Form["match"]) == 0 {
+		return httpserver.InvalidParamError(fmt.Errorf("missing `query` or `match[]` arg"))
+	}
+	cp, err := getCommonParamsForLabelsAPI(r, startTime, true)
+	if err != nil {
+		return httpserver.InvalidParamError(err)
+	}
+
+	sq := storage.NewSearchQuery(cp.start, cp.end, cp.filterss, *maxSeriesLimit)
+	results, err := netstorage.SearchExemplars(qt, sq, cp.deadline)
+	if err != nil {
+		return fmt.Errorf("cannot fetch exemplars for %q: %w", sq, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	qtDone := func() {
+		qt.Donef("start=%d, end=%d", cp.start, cp.end)
+	}
+	WriteQueryExemplarsResponse(bw, results, qt, qtDone)
+	return bw.Flush()
+}
+
+var queryExemplarsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query_exemplars"}`)
+
+// getSeriesSelectorsFromQuery returns series selectors for all the metric expressions in the given query.
+func getSeriesSelectorsFromQuery(query string) ([]string, error) {
+	e, err := metricsql.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query %q: %w", query, err)
+	}
+	var selectors []string
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		me, ok := expr.(*metricsql.MetricExpr)
+		if !ok || me.IsEmpty() {
+			return
+		}
+		selectors = append(selectors, string(me.AppendString(nil)))
+	})
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("query %q doesn't contain series selectors", query)
+	}
+	return selectors, nil
+}
+
 // QueryHandler processes /api/v1/query request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#instant-queries
@@ -769,29 +842,17 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 	ct := startTime.UnixNano() / 1e6
 	deadline := searchutil.GetDeadlineForQuery(r, startTime)
 	mayCache := !httputil.GetBool(r, "nocache")
-	query := r.FormValue("query")
-	if len(query) == 0 {
-		return httpserver.InvalidParamError(fmt.Errorf("missing `query` arg"))
-	}
-	start, err := httputil.GetTime(r, "time", ct)
+	query, err := getQueryArg(r)
 	if err != nil {
-		return httpserver.InvalidParamError(err)
+		return err
 	}
 	lookbackDelta, err := getMaxLookback(r)
 	if err != nil {
 		return httpserver.InvalidParamError(err)
 	}
-	step, err := httputil.GetDuration(r, "step", lookbackDelta)
+	start, step, err := getInstantQueryTimeParams(r, ct, lookbackDelta)
 	if err != nil {
-		return httpserver.InvalidParamError(err)
-	}
-	if step <= 0 {
-		step = defaultStep
-	}
-
-	maxLen := searchutil.GetMaxQueryLen()
-	if len(query) > maxLen {
-		return httpserver.InvalidParamError(fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxLen))
+		return err
 	}
 	etfs, err := searchutil.GetExtraTagFilters(r)
 	if err != nil {
@@ -818,11 +879,16 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 		}
 		filterss := searchutil.JoinTagFilterss(tagFilterss, etfs)
 
+		quota := searchutil.GetQuota(r)
+		if err := quota.CheckSamplesRate(); err != nil {
+			return err
+		}
 		cp := &commonParams{
 			deadline: deadline,
 			start:    start,
 			end:      end,
 			filterss: filterss,
+			quota:    quota,
 		}
 		if err := exportHandler(qt, w, cp, "promapi", 0, false); err != nil {
 			return fmt.Errorf("error when exporting data for query=%q on the time range (start=%d, end=%d): %w", childQuery, start, end, err)
@@ -830,7 +896,7 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 		return nil
 	}
 	if childQuery, windowExpr, stepExpr, offsetExpr := promql.IsRollup(query); childQuery != "" {
-		if len(childQuery) > maxLen {
+		if maxLen := searchutil.GetMaxQueryLen(); len(childQuery) > maxLen {
 			return httpserver.InvalidParamError(fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(childQuery), maxLen))
 		}
 		newStep, err := stepExpr.NonNegativeDuration(step)
@@ -868,21 +934,23 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 		queryOffset = 0
 	}
 	ec := &promql.EvalConfig{
-		Start:               start,
-		End:                 start,
-		Step:                step,
-		MaxPointsPerSeries:  *maxPointsPerTimeseries,
-		MaxSeries:           0, // let vmstorage use maxUniqueTimeseries by default
-		QuotedRemoteAddr:    httpserver.GetQuotedRemoteAddr(r),
-		Deadline:            deadline,
-		MayCache:            mayCache,
-		LookbackDelta:       lookbackDelta,
-		RoundDigits:         getRoundDigits(r),
-		EnforcedTagFilterss: etfs,
-		CacheTagFilters:     etfs,
+		Start:                        start,
+		End:                          start,
+		Step:                         step,
+		MaxPointsPerSeries:           *maxPointsPerTimeseries,
+		MaxSeries:                    0, // let vmstorage use maxUniqueTimeseries by default
+		QuotedRemoteAddr:             httpserver.GetQuotedRemoteAddr(r),
+		Deadline:                     deadline,
+		MayCache:                     mayCache,
+		DisableRecordingRulesRewrite: httputil.GetBool(r, "norewrite"),
+		LookbackDelta:                lookbackDelta,
+		RoundDigits:                  getRoundDigits(r),
+		EnforcedTagFilterss:          etfs,
+		CacheTagFilters:              etfs,
 		GetRequestURI: func() string {
 			return httpserver.GetRequestURI(r)
 		},
+		Quota: searchutil.GetQuota(r),
 	}
 	qs := promql.NewQueryStats(query, nil, ec)
 	ec.QueryStats = qs
@@ -928,25 +996,13 @@ func QueryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 	defer queryRangeDuration.UpdateDuration(startTime)
 
 	ct := startTime.UnixNano() / 1e6
-	query := r.FormValue("query")
-	if len(query) == 0 {
-		return httpserver.InvalidParamError(fmt.Errorf("missing `query` arg"))
-	}
-	maxLen := searchutil.GetMaxQueryLen()
-	if len(query) > maxLen {
-		return httpserver.InvalidParamError(fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxLen))
-	}
-	start, err := httputil.GetTime(r, "start", ct-defaultStep)
+	query, err := getQueryArg(r)
 	if err != nil {
-		return httpserver.InvalidParamError(err)
+		return err
 	}
-	end, err := httputil.GetTime(r, "end", ct)
+	start, end, step, err := getRangeQueryTimeParams(r, ct)
 	if err != nil {
-		return httpserver.InvalidParamError(err)
-	}
-	step, err := httputil.GetDuration(r, "step", defaultStep)
-	if err != nil {
-		return httpserver.InvalidParamError(err)
+		return err
 	}
 	etfs, err := searchutil.GetExtraTagFilters(r)
 	if err != nil {
@@ -967,14 +1023,9 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 	deadline := searchutil.GetDeadlineForQuery(r, startTime)
 	mayCache := !httputil.GetBool(r, "nocache")
 	optimizeRepeatedBinaryOpSubexprs := httputil.GetBool(r, "optimize_repeated_binary_op_subexprs")
-	if start > end {
-		end = start + defaultStep
-	}
-	if err := promql.ValidateMaxPointsPerSeries(start, end, step, *maxPointsPerTimeseries); err != nil {
-		return fmt.Errorf("%w; (see -search.maxPointsPerTimeseries command-line flag)", err)
-	}
-	if mayCache {
-		start, end = promql.AdjustStartEnd(start, end, step)
+	start, end, err := adjustRangeQueryTimeRange(start, end, step, mayCache)
+	if err != nil {
+		return err
 	}
 
 	ec := &promql.EvalConfig{
@@ -987,6 +1038,7 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 		Deadline:                         deadline,
 		MayCache:                         mayCache,
 		OptimizeRepeatedBinaryOpSubexprs: optimizeRepeatedBinaryOpSubexprs,
+		DisableRecordingRulesRewrite:     httputil.GetBool(r, "norewrite"),
 		LookbackDelta:                    lookbackDelta,
 		RoundDigits:                      getRoundDigits(r),
 		EnforcedTagFilterss:              etfs,
@@ -994,10 +1046,15 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 		GetRequestURI: func() string {
 			return httpserver.GetRequestURI(r)
 		},
+		Quota: searchutil.GetQuota(r),
 	}
 	qs := promql.NewQueryStats(query, nil, ec)
 	ec.QueryStats = qs
 
+	if isNDJSONRequest(r) {
+		return queryRangeStreamHandler(qt, w, r, ec, query, ct)
+	}
+
 	result, err := promql.Exec(qt, ec, query, false)
 	if err != nil {
 		return err
@@ -1030,6 +1087,152 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 	return nil
 }
 
+// QueryExplainHandler processes /api/v1/query/explain request.
+//
+// It returns the evaluation plan for the query without fetching samples from the storage.
+// The plan is returned for range query if `start` arg is set. Otherwise it is returned for instant query at `time`.
+func QueryExplainHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer queryExplainDuration.UpdateDuration(startTime)
+
+	ct := startTime.UnixNano() / 1e6
+	query, err := getQueryArg(r)
+	if err != nil {
+		return err
+	}
+	lookbackDelta, err := getMaxLookback(r)
+	if err != nil {
+		return httpserver.InvalidParamError(err)
+	}
+	etfs, err := searchutil.GetExtraTagFilters(r)
+	if err != nil {
+		return httpserver.InvalidParamError(err)
+	}
+	mayCache := !httputil.GetBool(r, "nocache")
+	var start, end, step int64
+	if r.FormValue("start") != "" {
+		start, end, step, err = getRangeQueryTimeParams(r, ct)
+		if err != nil {
+			return err
+		}
+		start, end, err = adjustRangeQueryTimeRange(start, end, step, mayCache)
+		if err != nil {
+			return err
+		}
+	} else {
+		start, step, err = getInstantQueryTimeParams(r, ct, lookbackDelta)
+		if err != nil {
+			return err
+		}
+		end = start
+	}
+
+	ec := &promql.EvalConfig{
+		Start:                            start,
+		End:                              end,
+		Step:                             step,
+		MaxPointsPerSeries:               *maxPointsPerTimeseries,
+		MaxSeries:                        0, // let vmstorage use maxUniqueTimeseries by default
+		QuotedRemoteAddr:                 httpserver.GetQuotedRemoteAddr(r),
+		Deadline:                         searchutil.GetDeadlineForQuery(r, startTime),
+		MayCache:                         mayCache,
+		OptimizeRepeatedBinaryOpSubexprs: httputil.GetBool(r, "optimize_repeated_binary_op_subexprs"),
+		DisableRecordingRulesRewrite:     httputil.GetBool(r, "norewrite"),
+		LookbackDelta:                    lookbackDelta,
+		EnforcedTagFilterss:              etfs,
+		CacheTagFilters:                  etfs,
+		Quota:                            searchutil.GetQuota(r),
+	}
+	er, err := promql.Explain(qt, ec, query)
+	if err != nil {
+		return fmt.Errorf("cannot explain query=%q: %w", query, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	qtDone := func() {
+		qt.Donef("start=%d, end=%d, step=%d, query=%q", start, end, step, query)
+	}
+	WriteQueryExplainResponse(bw, er, qt, qtDone)
+	return bw.Flush()
+}
+
+var queryExplainDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query/explain"}`)
+
+// isNDJSONRequest returns true if the client requests /api/v1/query_range response in NDJSON format.
+func isNDJSONRequest(r *http.Request) bool {
+	if r.FormValue("format") == "ndjson" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// queryRangeStreamHandler writes /api/v1/query_range response in NDJSON format.
+//
+// Every line in the response contains a single time series. Time series are written as soon as they are calculated,
+// so the order of time series in the response is undefined. The last line contains either query stats or an error.
+func queryRangeStreamHandler(qt *querytracer.Tracer, w http.ResponseWriter, r *http.Request, ec *promql.EvalConfig, query string, ct int64) error {
+	adjustStart, adjustEnd := int64(0), int64(0)
+	if ec.Step < maxStepForPointsAdjustment.Milliseconds() {
+		queryOffset, err := getLatencyOffsetMilliseconds(r)
+		if err != nil {
+			return httpserver.InvalidParamError(err)
+		}
+		if ct-queryOffset < ec.End {
+			adjustStart, adjustEnd = ct-queryOffset, ct+ec.Step
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+
+	var seriesCount, pointsCount atomic.Int64
+	err := promql.ExecStream(qt, ec, query, func(rs *netstorage.Result, _ uint) error {
+		if err := bw.Error(); err != nil {
+			return err
+		}
+		tss := []netstorage.Result{*rs}
+		if adjustEnd > 0 {
+			tss = adjustLastPoints(tss, adjustStart, adjustEnd)
+		}
+		// Remove NaN values as Prometheus does.
+		tss = removeEmptyValuesAndTimeseries(tss)
+		if len(tss) == 0 {
+			return nil
+		}
+		seriesCount.Add(1)
+		pointsCount.Add(int64(len(tss[0].Values)))
+
+		bb := bbPool.Get()
+		WriteQueryRangeStreamLine(bb, &tss[0])
+		_, err := bw.Write(bb.B)
+		bbPool.Put(bb)
+		return err
+	})
+	if err != nil {
+		if netutil.IsTrivialNetworkError(err) {
+			return nil
+		}
+		if seriesCount.Load() == 0 {
+			// Nothing has been sent to the client yet, so the error can be returned with the proper status code.
+			return err
+		}
+		logger.Warnf("error when streaming /api/v1/query_range response for query=%q to %s: %s", query, ec.QuotedRemoteAddr, err)
+		WriteQueryRangeStreamError(bw, err)
+		return bw.Flush()
+	}
+
+	qtDone := func() {
+		qt.Donef("start=%d, end=%d, step=%d, query=%q: series=%d", ec.Start, ec.End, ec.Step, query, seriesCount.Load())
+	}
+	WriteQueryRangeStreamFooter(bw, int(seriesCount.Load()), int(pointsCount.Load()), qt, qtDone, ec.QueryStats)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot send query range response to remote client: %w", err)
+	}
+	return nil
+}
+
 func removeEmptyValuesAndTimeseries(tss []netstorage.Result) []netstorage.Result {
 	dst := tss[:0]
 	for i := range tss {
@@ -1098,6 +1301,70 @@ func adjustLastPoints(tss []netstorage.Result, start, end int64) []netstorage.Re
 	return tss
 }
 
+// getQueryArg returns `query` arg from r.
+func getQueryArg(r *http.Request) (string, error) {
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return "", httpserver.InvalidParamError(fmt.Errorf("missing `query` arg"))
+	}
+	maxLen := searchutil.GetMaxQueryLen()
+	if len(query) > maxLen {
+		return "", httpserver.InvalidParamError(fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxLen))
+	}
+	return query, nil
+}
+
+// getInstantQueryTimeParams returns `time` and `step` args for instant query from r.
+//
+// ct is the current timestamp in milliseconds, while lookbackDelta is used as the default step.
+func getInstantQueryTimeParams(r *http.Request, ct, lookbackDelta int64) (int64, int64, error) {
+	start, err := httputil.GetTime(r, "time", ct)
+	if err != nil {
+		return 0, 0, httpserver.InvalidParamError(err)
+	}
+	step, err := httputil.GetDuration(r, "step", lookbackDelta)
+	if err != nil {
+		return 0, 0, httpserver.InvalidParamError(err)
+	}
+	if step <= 0 {
+		step = defaultStep
+	}
+	return start, step, nil
+}
+
+// getRangeQueryTimeParams returns `start`, `end` and `step` args for range query from r.
+//
+// ct is the current timestamp in milliseconds.
+func getRangeQueryTimeParams(r *http.Request, ct int64) (int64, int64, int64, error) {
+	start, err := httputil.GetTime(r, "start", ct-defaultStep)
+	if err != nil {
+		return 0, 0, 0, httpserver.InvalidParamError(err)
+	}
+	end, err := httputil.GetTime(r, "end", ct)
+	if err != nil {
+		return 0, 0, 0, httpserver.InvalidParamError(err)
+	}
+	step, err := httputil.GetDuration(r, "step", defaultStep)
+	if err != nil {
+		return 0, 0, 0, httpserver.InvalidParamError(err)
+	}
+	return start, end, step, nil
+}
+
+// adjustRangeQueryTimeRange validates the time range for range query and aligns it to step if mayCache is set.
+func adjustRangeQueryTimeRange(start, end, step int64, mayCache bool) (int64, int64, error) {
+	if start > end {
+		end = start + defaultStep
+	}
+	if err := promql.ValidateMaxPointsPerSeries(start, end, step, *maxPointsPerTimeseries); err != nil {
+		return 0, 0, fmt.Errorf("%w; (see -search.maxPointsPerTimeseries command-line flag)", err)
+	}
+	if mayCache {
+		start, end = promql.AdjustStartEnd(start, end, step)
+	}
+	return start, end, nil
+}
+
 func getMaxLookback(r *http.Request) (int64, error) {
 	d := maxLookback.Milliseconds()
 	if d == 0 {
@@ -1184,6 +1451,9 @@ type commonParams struct {
 	end              int64
 	currentTimestamp int64
 	filterss         [][]storage.TagFilter
+
+	// quota is an optional quota from -search.quotasConfig, which is applied to the request.
+	quota *searchutil.Quota
 }
 
 func (cp *commonParams) IsDefaultTimeRange() bool {
@@ -1204,6 +1474,10 @@ func getExportParams(r *http.Request, startTime time.Time) (*commonParams, error
 		return nil, err
 	}
 	cp.deadline = searchutil.GetDeadlineForExport(r, startTime)
+	cp.quota = searchutil.GetQuota(r)
+	if err := cp.quota.CheckSamplesRate(); err != nil {
+		return nil, err
+	}
 	return cp, nil
 }
 
@@ -1,6 +1,7 @@
 package prometheus
 
 import (
+	"fmt"
 	"math"
 	"net/http"
 	"reflect"
@@ -197,6 +198,34 @@ func TestAdjustLastPoints(t *testing.T) {
 	})
 }
 
+func TestGetSeriesSelectorsFromQuery(t *testing.T) {
+	f := func(query string, selectorsExpected []string) {
+		t.Helper()
+		selectors, err := getSeriesSelectorsFromQuery(query)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(selectors, selectorsExpected) {
+			t.Fatalf("unexpected selectors\ngot\n%q\nwant\n%q", selectors, selectorsExpected)
+		}
+	}
+	f("foo", []string{"foo"})
+	f(`rate(foo{bar="baz"}[5m])`, []string{`foo{bar="baz"}`})
+	f(`histogram_quantile(0.9, sum(rate(foo_bucket[5m])) by (le)) / bar{x=~"y.+"}`, []string{"foo_bucket", `bar{x=~"y.+"}`})
+}
+
+func TestGetSeriesSelectorsFromQueryFailure(t *testing.T) {
+	f := func(query string) {
+		t.Helper()
+		if _, err := getSeriesSelectorsFromQuery(query); err == nil {
+			t.Fatalf("expecting non-nil error for query %q", query)
+		}
+	}
+	f("")
+	f("foo{")
+	f("1+2")
+}
+
 func TestGetLatencyOffsetMillisecondsSuccess(t *testing.T) {
 	f := func(url string, expectedOffset int64) {
 		t.Helper()
@@ -229,3 +258,53 @@ func TestGetLatencyOffsetMillisecondsFailure(t *testing.T) {
 	}
 	f("http://localhost?latency_offset=foobar")
 }
+
+func TestIsNDJSONRequest(t *testing.T) {
+	f := func(url, accept string, resultExpected bool) {
+		t.Helper()
+		r, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		result := isNDJSONRequest(r)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for isNDJSONRequest(url=%q, accept=%q); got %v; want %v", url, accept, result, resultExpected)
+		}
+	}
+
+	f("http://localhost/api/v1/query_range?query=foo", "", false)
+	f("http://localhost/api/v1/query_range?query=foo&format=json", "", false)
+	f("http://localhost/api/v1/query_range?query=foo", "application/json", false)
+	f("http://localhost/api/v1/query_range?query=foo&format=ndjson", "", true)
+	f("http://localhost/api/v1/query_range?query=foo", "application/x-ndjson", true)
+	f("http://localhost/api/v1/query_range?query=foo", "application/x-ndjson, application/json;q=0.9", true)
+}
+
+func TestQueryRangeStreamLine(t *testing.T) {
+	f := func(r *netstorage.Result, resultExpected string) {
+		t.Helper()
+		result := QueryRangeStreamLine(r)
+		if result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	r := &netstorage.Result{
+		Timestamps: []int64{1000, 2000},
+		Values:     []float64{1, 2.5},
+	}
+	r.MetricName.MetricGroup = []byte("foo")
+	r.MetricName.AddTag("bar", "baz")
+	f(r, `{"metric":{"__name__":"foo","bar":"baz"},"values":[[1,"1"],[2,"2.5"]]}`+"\n")
+
+	f(&netstorage.Result{}, `{"metric":{},"values":[]}`+"\n")
+
+	result := QueryRangeStreamError(fmt.Errorf("some error"))
+	resultExpected := `{"status":"error","errorType":"execution","error":"some error"}` + "\n"
+	if result != resultExpected {
+		t.Fatalf("unexpected error line;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
@@ -0,0 +1,143 @@
+// Code generated by qtc from "query_exemplars_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:1
+package prometheus
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:1
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// QueryExemplarsResponse generates response for /api/v1/query_exemplars.See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:9
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:9
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:9
+func StreamQueryExemplarsResponse(qw422016 *qt422016.Writer, results []storage.ExemplarsResult, qt *querytracer.Tracer, qtDone func()) {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:9
+	qw422016.N().S(`{"status":"success","data":[`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:13
+	var mn storage.MetricName
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:14
+	for i := range results {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:16
+		r := &results[i]
+		err := mn.UnmarshalString(r.MetricName)
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:18
+		qw422016.N().S(`{"seriesLabels":`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:21
+		if err != nil {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:22
+			qw422016.N().Q(err.Error())
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:23
+		} else {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:24
+			streammetricNameObject(qw422016, &mn)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:25
+		}
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:25
+		qw422016.N().S(`,"exemplars":[`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:27
+		for j := range r.Exemplars {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:28
+			e := &r.Exemplars[j]
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:28
+			qw422016.N().S(`{"labels":{`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:31
+			for k := range e.Labels {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:32
+				qw422016.N().Q(e.Labels[k].Name)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:32
+				qw422016.N().S(`:`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:32
+				qw422016.N().Q(e.Labels[k].Value)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:33
+				if k+1 < len(e.Labels) {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:33
+					qw422016.N().S(`,`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:33
+				}
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:34
+			}
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:34
+			qw422016.N().S(`},"value":"`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:36
+			qw422016.N().F(e.Value)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:36
+			qw422016.N().S(`","timestamp":`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:37
+			qw422016.N().F(float64(e.Timestamp) / 1e3)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:37
+			qw422016.N().S(`}`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:39
+			if j+1 < len(r.Exemplars) {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:39
+				qw422016.N().S(`,`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:39
+			}
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:40
+		}
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:40
+		qw422016.N().S(`]}`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:43
+		if i+1 < len(results) {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:43
+			qw422016.N().S(`,`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:43
+		}
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:44
+	}
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:44
+	qw422016.N().S(`]`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:47
+	qt.Printf("generate response: series=%d", len(results))
+	qtDone()
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:50
+	streamdumpQueryTrace(qw422016, qt)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:50
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+}
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+func WriteQueryExemplarsResponse(qq422016 qtio422016.Writer, results []storage.ExemplarsResult, qt *querytracer.Tracer, qtDone func()) {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+	StreamQueryExemplarsResponse(qw422016, results, qt, qtDone)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+}
+
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+func QueryExemplarsResponse(results []storage.ExemplarsResult, qt *querytracer.Tracer, qtDone func()) string {
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+	WriteQueryExemplarsResponse(qb422016, results, qt, qtDone)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+	return qs422016
+//line app/vmselect/prometheus/query_exemplars_response.qtpl:52
+}
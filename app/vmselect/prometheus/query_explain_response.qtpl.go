@@ -0,0 +1,287 @@
+// Code generated by qtc from "query_explain_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line query_explain_response.qtpl:1
+package prometheus
+
+//line query_explain_response.qtpl:1
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+)
+
+// QueryExplainResponse generates response for /api/v1/query/explain.
+
+//line query_explain_response.qtpl:8
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line query_explain_response.qtpl:8
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line query_explain_response.qtpl:8
+func StreamQueryExplainResponse(qw422016 *qt422016.Writer, er *promql.ExplainResult, qt *querytracer.Tracer, qtDone func()) {
+//line query_explain_response.qtpl:8
+	qw422016.N().S(`{"status":"success","data":{"query":`)
+//line query_explain_response.qtpl:12
+	qw422016.N().Q(er.Query)
+//line query_explain_response.qtpl:12
+	qw422016.N().S(`,"optimizedQuery":`)
+//line query_explain_response.qtpl:13
+	qw422016.N().Q(er.OptimizedQuery)
+//line query_explain_response.qtpl:13
+	qw422016.N().S(`,"start":`)
+//line query_explain_response.qtpl:14
+	qw422016.N().F(float64(er.Start) / 1e3)
+//line query_explain_response.qtpl:14
+	qw422016.N().S(`,"end":`)
+//line query_explain_response.qtpl:15
+	qw422016.N().F(float64(er.End) / 1e3)
+//line query_explain_response.qtpl:15
+	qw422016.N().S(`,"step":`)
+//line query_explain_response.qtpl:16
+	qw422016.N().F(float64(er.Step) / 1e3)
+//line query_explain_response.qtpl:16
+	qw422016.N().S(`,"plan":`)
+//line query_explain_response.qtpl:17
+	streamexplainNode(qw422016, er.Plan)
+//line query_explain_response.qtpl:17
+	qw422016.N().S(`}`)
+//line query_explain_response.qtpl:20
+	qtDone()
+
+//line query_explain_response.qtpl:22
+	streamdumpQueryTrace(qw422016, qt)
+//line query_explain_response.qtpl:22
+	qw422016.N().S(`}`)
+//line query_explain_response.qtpl:24
+}
+
+//line query_explain_response.qtpl:24
+func WriteQueryExplainResponse(qq422016 qtio422016.Writer, er *promql.ExplainResult, qt *querytracer.Tracer, qtDone func()) {
+//line query_explain_response.qtpl:24
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line query_explain_response.qtpl:24
+	StreamQueryExplainResponse(qw422016, er, qt, qtDone)
+//line query_explain_response.qtpl:24
+	qt422016.ReleaseWriter(qw422016)
+//line query_explain_response.qtpl:24
+}
+
+//line query_explain_response.qtpl:24
+func QueryExplainResponse(er *promql.ExplainResult, qt *querytracer.Tracer, qtDone func()) string {
+//line query_explain_response.qtpl:24
+	qb422016 := qt422016.AcquireByteBuffer()
+//line query_explain_response.qtpl:24
+	WriteQueryExplainResponse(qb422016, er, qt, qtDone)
+//line query_explain_response.qtpl:24
+	qs422016 := string(qb422016.B)
+//line query_explain_response.qtpl:24
+	qt422016.ReleaseByteBuffer(qb422016)
+//line query_explain_response.qtpl:24
+	return qs422016
+//line query_explain_response.qtpl:24
+}
+
+//line query_explain_response.qtpl:26
+func streamexplainNode(qw422016 *qt422016.Writer, n *promql.ExplainNode) {
+//line query_explain_response.qtpl:26
+	qw422016.N().S(`{"type":`)
+//line query_explain_response.qtpl:28
+	qw422016.N().Q(n.Type)
+//line query_explain_response.qtpl:28
+	qw422016.N().S(`,"expr":`)
+//line query_explain_response.qtpl:29
+	qw422016.N().Q(n.Expr)
+//line query_explain_response.qtpl:30
+	if n.Name != "" {
+//line query_explain_response.qtpl:30
+		qw422016.N().S(`,"name":`)
+//line query_explain_response.qtpl:31
+		qw422016.N().Q(n.Name)
+//line query_explain_response.qtpl:32
+	}
+//line query_explain_response.qtpl:33
+	switch n.Type {
+//line query_explain_response.qtpl:34
+	case "rollup":
+//line query_explain_response.qtpl:34
+		qw422016.N().S(`,"window":`)
+//line query_explain_response.qtpl:35
+		qw422016.N().F(float64(n.Window) / 1e3)
+//line query_explain_response.qtpl:35
+		qw422016.N().S(`,"step":`)
+//line query_explain_response.qtpl:36
+		qw422016.N().F(float64(n.Step) / 1e3)
+//line query_explain_response.qtpl:36
+		qw422016.N().S(`,"offset":`)
+//line query_explain_response.qtpl:37
+		qw422016.N().F(float64(n.Offset) / 1e3)
+//line query_explain_response.qtpl:37
+		qw422016.N().S(`,"cache":`)
+//line query_explain_response.qtpl:38
+		qw422016.N().Q(n.CacheStatus)
+//line query_explain_response.qtpl:39
+	case "subquery":
+//line query_explain_response.qtpl:39
+		qw422016.N().S(`,"window":`)
+//line query_explain_response.qtpl:40
+		qw422016.N().F(float64(n.Window) / 1e3)
+//line query_explain_response.qtpl:40
+		qw422016.N().S(`,"step":`)
+//line query_explain_response.qtpl:41
+		qw422016.N().F(float64(n.Step) / 1e3)
+//line query_explain_response.qtpl:41
+		qw422016.N().S(`,"offset":`)
+//line query_explain_response.qtpl:42
+		qw422016.N().F(float64(n.Offset) / 1e3)
+//line query_explain_response.qtpl:43
+	case "aggregate":
+//line query_explain_response.qtpl:43
+		qw422016.N().S(`,"incrementalAggregation":`)
+//line query_explain_response.qtpl:44
+		if n.IncrementalAggregation {
+//line query_explain_response.qtpl:44
+			qw422016.N().S(`true`)
+//line query_explain_response.qtpl:44
+		} else {
+//line query_explain_response.qtpl:44
+			qw422016.N().S(`false`)
+//line query_explain_response.qtpl:44
+		}
+//line query_explain_response.qtpl:45
+	case "binaryOp":
+//line query_explain_response.qtpl:45
+		qw422016.N().S(`,"evalOrder":`)
+//line query_explain_response.qtpl:46
+		qw422016.N().Q(n.EvalOrder)
+//line query_explain_response.qtpl:46
+		qw422016.N().S(`,"commonFiltersPushdown":`)
+//line query_explain_response.qtpl:47
+		if n.CommonFiltersPushdown {
+//line query_explain_response.qtpl:47
+			qw422016.N().S(`true`)
+//line query_explain_response.qtpl:47
+		} else {
+//line query_explain_response.qtpl:47
+			qw422016.N().S(`false`)
+//line query_explain_response.qtpl:47
+		}
+//line query_explain_response.qtpl:48
+	case "selector":
+//line query_explain_response.qtpl:48
+		qw422016.N().S(`,"filters":[`)
+//line query_explain_response.qtpl:50
+		for i, f := range n.Filters {
+//line query_explain_response.qtpl:51
+			qw422016.N().Q(f)
+//line query_explain_response.qtpl:52
+			if i+1 < len(n.Filters) {
+//line query_explain_response.qtpl:52
+				qw422016.N().S(`,`)
+//line query_explain_response.qtpl:52
+			}
+//line query_explain_response.qtpl:53
+		}
+//line query_explain_response.qtpl:53
+		qw422016.N().S(`],"pushedDownFilters":[`)
+//line query_explain_response.qtpl:56
+		for i, f := range n.PushedDownFilters {
+//line query_explain_response.qtpl:57
+			qw422016.N().Q(f)
+//line query_explain_response.qtpl:58
+			if i+1 < len(n.PushedDownFilters) {
+//line query_explain_response.qtpl:58
+				qw422016.N().S(`,`)
+//line query_explain_response.qtpl:58
+			}
+//line query_explain_response.qtpl:59
+		}
+//line query_explain_response.qtpl:59
+		qw422016.N().S(`]`)
+//line query_explain_response.qtpl:61
+		if n.MaxTimestamp > 0 {
+//line query_explain_response.qtpl:61
+			qw422016.N().S(`,"start":`)
+//line query_explain_response.qtpl:62
+			qw422016.N().F(float64(n.MinTimestamp) / 1e3)
+//line query_explain_response.qtpl:62
+			qw422016.N().S(`,"end":`)
+//line query_explain_response.qtpl:63
+			qw422016.N().F(float64(n.MaxTimestamp) / 1e3)
+//line query_explain_response.qtpl:64
+		}
+//line query_explain_response.qtpl:65
+		if n.EstimatedSeries >= 0 {
+//line query_explain_response.qtpl:65
+			qw422016.N().S(`,"estimatedSeries":`)
+//line query_explain_response.qtpl:66
+			qw422016.N().D(n.EstimatedSeries)
+//line query_explain_response.qtpl:67
+		}
+//line query_explain_response.qtpl:68
+		if n.EstimateError != "" {
+//line query_explain_response.qtpl:68
+			qw422016.N().S(`,"estimateError":`)
+//line query_explain_response.qtpl:69
+			qw422016.N().Q(n.EstimateError)
+//line query_explain_response.qtpl:70
+		}
+//line query_explain_response.qtpl:71
+	}
+//line query_explain_response.qtpl:72
+	if len(n.Children) > 0 {
+//line query_explain_response.qtpl:72
+		qw422016.N().S(`,"children":[`)
+//line query_explain_response.qtpl:74
+		for i, child := range n.Children {
+//line query_explain_response.qtpl:75
+			streamexplainNode(qw422016, child)
+//line query_explain_response.qtpl:76
+			if i+1 < len(n.Children) {
+//line query_explain_response.qtpl:76
+				qw422016.N().S(`,`)
+//line query_explain_response.qtpl:76
+			}
+//line query_explain_response.qtpl:77
+		}
+//line query_explain_response.qtpl:77
+		qw422016.N().S(`]`)
+//line query_explain_response.qtpl:79
+	}
+//line query_explain_response.qtpl:79
+	qw422016.N().S(`}`)
+//line query_explain_response.qtpl:81
+}
+
+//line query_explain_response.qtpl:81
+func writeexplainNode(qq422016 qtio422016.Writer, n *promql.ExplainNode) {
+//line query_explain_response.qtpl:81
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line query_explain_response.qtpl:81
+	streamexplainNode(qw422016, n)
+//line query_explain_response.qtpl:81
+	qt422016.ReleaseWriter(qw422016)
+//line query_explain_response.qtpl:81
+}
+
+//line query_explain_response.qtpl:81
+func explainNode(n *promql.ExplainNode) string {
+//line query_explain_response.qtpl:81
+	qb422016 := qt422016.AcquireByteBuffer()
+//line query_explain_response.qtpl:81
+	writeexplainNode(qb422016, n)
+//line query_explain_response.qtpl:81
+	qs422016 := string(qb422016.B)
+//line query_explain_response.qtpl:81
+	qt422016.ReleaseByteBuffer(qb422016)
+//line query_explain_response.qtpl:81
+	return qs422016
+//line query_explain_response.qtpl:81
+}
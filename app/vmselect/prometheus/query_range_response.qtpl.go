@@ -116,43 +116,189 @@ func QueryRangeResponse(rs []netstorage.Result, qt *querytracer.Tracer, qtDone f
 //line app/vmselect/prometheus/query_range_response.qtpl:49
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:51
+// QueryRangeStreamLine generates a line for a single series in NDJSON response for /api/v1/query_range?format=ndjson.
+
+//line app/vmselect/prometheus/query_range_response.qtpl:52
+func StreamQueryRangeStreamLine(qw422016 *qt422016.Writer, r *netstorage.Result) {
+//line app/vmselect/prometheus/query_range_response.qtpl:53
+	streamqueryRangeLine(qw422016, r)
+//line app/vmselect/prometheus/query_range_response.qtpl:53
+	qw422016.N().S(`
+`)
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+}
+
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+func WriteQueryRangeStreamLine(qq422016 qtio422016.Writer, r *netstorage.Result) {
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+	StreamQueryRangeStreamLine(qw422016, r)
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+}
+
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+func QueryRangeStreamLine(r *netstorage.Result) string {
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+	WriteQueryRangeStreamLine(qb422016, r)
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+	return qs422016
+//line app/vmselect/prometheus/query_range_response.qtpl:54
+}
+
+// QueryRangeStreamFooter generates the last line in NDJSON response for /api/v1/query_range?format=ndjson.
+
+//line app/vmselect/prometheus/query_range_response.qtpl:57
+func StreamQueryRangeStreamFooter(qw422016 *qt422016.Writer, seriesCount, pointsCount int, qt *querytracer.Tracer, qtDone func(), qs *promql.QueryStats) {
+//line app/vmselect/prometheus/query_range_response.qtpl:57
+	qw422016.N().S(`{`)
+//line app/vmselect/prometheus/query_range_response.qtpl:60
+	executionDuration := int64(0)
+	if ed := qs.ExecutionDuration.Load(); ed != nil {
+		executionDuration = ed.Milliseconds()
+	}
+
+//line app/vmselect/prometheus/query_range_response.qtpl:64
+	qw422016.N().S(`"status":"success","stats":{"seriesFetched": "`)
+//line app/vmselect/prometheus/query_range_response.qtpl:67
+	qw422016.N().DL(qs.SeriesFetched.Load())
+//line app/vmselect/prometheus/query_range_response.qtpl:67
+	qw422016.N().S(`","seriesReturned":`)
+//line app/vmselect/prometheus/query_range_response.qtpl:68
+	qw422016.N().D(seriesCount)
+//line app/vmselect/prometheus/query_range_response.qtpl:68
+	qw422016.N().S(`,"executionTimeMsec":`)
+//line app/vmselect/prometheus/query_range_response.qtpl:69
+	qw422016.N().DL(executionDuration)
+//line app/vmselect/prometheus/query_range_response.qtpl:69
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/query_range_response.qtpl:72
+	qt.Printf("generate /api/v1/query_range NDJSON response for series=%d, points=%d", seriesCount, pointsCount)
+	qtDone()
+
+//line app/vmselect/prometheus/query_range_response.qtpl:75
+	streamdumpQueryTrace(qw422016, qt)
+//line app/vmselect/prometheus/query_range_response.qtpl:75
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/query_range_response.qtpl:76
+	qw422016.N().S(`
+`)
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+}
+
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+func WriteQueryRangeStreamFooter(qq422016 qtio422016.Writer, seriesCount, pointsCount int, qt *querytracer.Tracer, qtDone func(), qs *promql.QueryStats) {
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+	StreamQueryRangeStreamFooter(qw422016, seriesCount, pointsCount, qt, qtDone, qs)
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+}
+
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+func QueryRangeStreamFooter(seriesCount, pointsCount int, qt *querytracer.Tracer, qtDone func(), qs *promql.QueryStats) string {
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+	WriteQueryRangeStreamFooter(qb422016, seriesCount, pointsCount, qt, qtDone, qs)
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+	return qs422016
+//line app/vmselect/prometheus/query_range_response.qtpl:77
+}
+
+// QueryRangeStreamError generates the last line in NDJSON response for /api/v1/query_range?format=ndjsonif an error occurs after the response has been started.
+
+//line app/vmselect/prometheus/query_range_response.qtpl:81
+func StreamQueryRangeStreamError(qw422016 *qt422016.Writer, err error) {
+//line app/vmselect/prometheus/query_range_response.qtpl:81
+	qw422016.N().S(`{"status":"error","errorType":"execution","error":`)
+//line app/vmselect/prometheus/query_range_response.qtpl:85
+	qw422016.N().Q(err.Error())
+//line app/vmselect/prometheus/query_range_response.qtpl:85
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/query_range_response.qtpl:86
+	qw422016.N().S(`
+`)
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+}
+
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+func WriteQueryRangeStreamError(qq422016 qtio422016.Writer, err error) {
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+	StreamQueryRangeStreamError(qw422016, err)
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+}
+
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+func QueryRangeStreamError(err error) string {
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+	WriteQueryRangeStreamError(qb422016, err)
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+	return qs422016
+//line app/vmselect/prometheus/query_range_response.qtpl:87
+}
+
+//line app/vmselect/prometheus/query_range_response.qtpl:89
 func streamqueryRangeLine(qw422016 *qt422016.Writer, r *netstorage.Result) {
-//line app/vmselect/prometheus/query_range_response.qtpl:51
+//line app/vmselect/prometheus/query_range_response.qtpl:89
 	qw422016.N().S(`{"metric":`)
-//line app/vmselect/prometheus/query_range_response.qtpl:53
+//line app/vmselect/prometheus/query_range_response.qtpl:91
 	streammetricNameObject(qw422016, &r.MetricName)
-//line app/vmselect/prometheus/query_range_response.qtpl:53
+//line app/vmselect/prometheus/query_range_response.qtpl:91
 	qw422016.N().S(`,"values":`)
-//line app/vmselect/prometheus/query_range_response.qtpl:54
+//line app/vmselect/prometheus/query_range_response.qtpl:92
 	streamvaluesWithTimestamps(qw422016, r.Values, r.Timestamps)
-//line app/vmselect/prometheus/query_range_response.qtpl:54
+//line app/vmselect/prometheus/query_range_response.qtpl:92
 	qw422016.N().S(`}`)
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 func writequeryRangeLine(qq422016 qtio422016.Writer, r *netstorage.Result) {
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 	streamqueryRangeLine(qw422016, r)
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 }
 
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 func queryRangeLine(r *netstorage.Result) string {
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 	writequeryRangeLine(qb422016, r)
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 	qs422016 := string(qb422016.B)
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 	return qs422016
-//line app/vmselect/prometheus/query_range_response.qtpl:56
+//line app/vmselect/prometheus/query_range_response.qtpl:94
 }
@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/stringsutil"
 )
 
@@ -34,6 +39,33 @@ func ActiveQueriesHandler(w http.ResponseWriter, _ *http.Request) {
 	fmt.Fprintf(w, `]}`)
 }
 
+// CancelQueryHandler processes /api/v1/admin/query/cancel request.
+//
+// It cancels the active query with the given id. The id can be obtained from /api/v1/status/active_queries.
+func CancelQueryHandler(w http.ResponseWriter, r *http.Request) error {
+	id := r.FormValue("id")
+	if id == "" {
+		return httpserver.InvalidParamError(fmt.Errorf("missing `id` query arg"))
+	}
+	qid, err := strconv.ParseUint(id, 16, 64)
+	if err != nil {
+		return httpserver.InvalidParamError(fmt.Errorf("cannot parse `id` query arg %q: %w", id, err))
+	}
+	if !activeQueriesV.Cancel(qid) {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot find active query with id=%q", id),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	canceledQueries.Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok","data":{"id":"%016X"}}`, qid)
+	return nil
+}
+
+var canceledQueries = metrics.NewCounter(`vm_canceled_queries_total`)
+
 var activeQueriesV = newActiveQueries()
 
 type activeQueries struct {
@@ -49,6 +81,9 @@ type activeQueryEntry struct {
 	quotedRemoteAddr string
 	q                string
 	startTime        time.Time
+
+	// deadline is used for canceling the query via /api/v1/admin/query/cancel.
+	deadline searchutil.Deadline
 }
 
 func newActiveQueries() *activeQueries {
@@ -66,6 +101,7 @@ func (aq *activeQueries) Add(ec *EvalConfig, q string) uint64 {
 	aqe.quotedRemoteAddr = ec.QuotedRemoteAddr
 	aqe.q = q
 	aqe.startTime = time.Now()
+	aqe.deadline = ec.Deadline
 
 	aq.mu.Lock()
 	aq.m[aqe.qid] = aqe
@@ -79,6 +115,20 @@ func (aq *activeQueries) Remove(qid uint64) {
 	aq.mu.Unlock()
 }
 
+// Cancel cancels the active query with the given qid.
+//
+// It returns false if there is no active query with the given qid.
+func (aq *activeQueries) Cancel(qid uint64) bool {
+	aq.mu.Lock()
+	aqe, ok := aq.m[qid]
+	aq.mu.Unlock()
+	if !ok {
+		return false
+	}
+	aqe.deadline.Cancel()
+	return true
+}
+
 func (aq *activeQueries) GetAll() []activeQueryEntry {
 	aq.mu.Lock()
 	aqes := make([]activeQueryEntry, 0, len(aq.m))
@@ -0,0 +1,103 @@
+package promql
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+func TestActiveQueriesCancel(t *testing.T) {
+	aq := newActiveQueries()
+	ec := &EvalConfig{
+		Start: 1000,
+		End:   2000,
+		Step:  100,
+	}
+	d := searchutil.NewDeadline(time.Now(), time.Minute, "")
+	ec.Deadline = d.WithCancel()
+	defer ec.Deadline.Cancel()
+	qid := aq.Add(ec, "foo")
+	if aq.Cancel(qid + 1) {
+		t.Fatalf("unexpected cancel of missing query")
+	}
+	if ec.Deadline.IsCanceled() {
+		t.Fatalf("unexpected canceled deadline")
+	}
+	if !aq.Cancel(qid) {
+		t.Fatalf("cannot cancel active query")
+	}
+	if !ec.Deadline.IsCanceled() {
+		t.Fatalf("expecting canceled deadline")
+	}
+	aq.Remove(qid)
+	if aq.Cancel(qid) {
+		t.Fatalf("unexpected cancel of removed query")
+	}
+}
+
+func TestCancelQueryHandler(t *testing.T) {
+	ec := &EvalConfig{
+		Start: 1000,
+		End:   2000,
+		Step:  100,
+	}
+	d := searchutil.NewDeadline(time.Now(), time.Minute, "")
+	ec.Deadline = d.WithCancel()
+	qid := activeQueriesV.Add(ec, "foo")
+	defer activeQueriesV.Remove(qid)
+
+	f := func(id string, statusCodeExpected int) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/query/cancel?id="+id, nil)
+		w := httptest.NewRecorder()
+		err := CancelQueryHandler(w, r)
+		if statusCodeExpected == http.StatusOK {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error for id=%q", id)
+		}
+		var esc *httpserver.ErrorWithStatusCode
+		if !errors.As(err, &esc) {
+			t.Fatalf("unexpected error type %T: %s", err, err)
+		}
+		if esc.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", esc.StatusCode, statusCodeExpected)
+		}
+	}
+
+	f("", http.StatusBadRequest)
+	f("foobar", http.StatusBadRequest)
+	f(fmt.Sprintf("%016X", qid+1), http.StatusNotFound)
+	f(fmt.Sprintf("%016X", qid), http.StatusOK)
+
+	if !ec.Deadline.IsCanceled() {
+		t.Fatalf("expecting canceled query")
+	}
+}
+
+func TestExecCanceledQuery(t *testing.T) {
+	ec := &EvalConfig{
+		Start:              1000,
+		End:                2000,
+		Step:               100,
+		MaxPointsPerSeries: 1e4,
+		MaxSeries:          1000,
+		RoundDigits:        100,
+	}
+	d := searchutil.NewDeadline(time.Now(), time.Minute, "")
+	ec.Deadline = d.WithCancel()
+	ec.Deadline.Cancel()
+	if _, err := Exec(nil, ec, "1+2", false); err == nil {
+		t.Fatalf("expecting non-nil error for canceled query")
+	}
+}
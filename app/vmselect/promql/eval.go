@@ -135,6 +135,9 @@ type EvalConfig struct {
 	// Whether repeated cacheable binary op subexpressions can be optimized.
 	OptimizeRepeatedBinaryOpSubexprs bool
 
+	// Whether to disable rewriting the query with recording rules from -search.recordingRulesFile and vmalert.
+	DisableRecordingRulesRewrite bool
+
 	// LookbackDelta is analog to `-query.lookback-delta` from Prometheus.
 	LookbackDelta int64
 
@@ -160,6 +163,14 @@ type EvalConfig struct {
 	// The caller must initialize QueryStats, otherwise it isn't collected.
 	QueryStats *QueryStats
 
+	// Quota is an optional quota from -search.quotasConfig, which is applied to the query.
+	Quota *searchutil.Quota
+
+	// streamFunc is called for every calculated time series if the query is executed via ExecStream.
+	//
+	// It is intentionally not copied by copyEvalConfig, so it is applied only to the top-level rollup.
+	streamFunc func(ts *timeseries, workerID uint) error
+
 	timestamps     []int64
 	timestampsOnce sync.Once
 }
@@ -175,12 +186,14 @@ func copyEvalConfig(src *EvalConfig) *EvalConfig {
 	ec.Deadline = src.Deadline
 	ec.MayCache = src.MayCache
 	ec.OptimizeRepeatedBinaryOpSubexprs = src.OptimizeRepeatedBinaryOpSubexprs
+	ec.DisableRecordingRulesRewrite = src.DisableRecordingRulesRewrite
 	ec.LookbackDelta = src.LookbackDelta
 	ec.RoundDigits = src.RoundDigits
 	ec.EnforcedTagFilterss = src.EnforcedTagFilterss
 	ec.CacheTagFilters = src.CacheTagFilters
 	ec.GetRequestURI = src.GetRequestURI
 	ec.QueryStats = src.QueryStats
+	ec.Quota = src.Quota
 
 	// do not copy src.timestamps - they must be generated again.
 	return &ec
@@ -195,6 +208,17 @@ func (ec *EvalConfig) validate() {
 	}
 }
 
+// applyQuota applies `max_series_per_query` from ec.Quota to ec.
+//
+// It returns an error if queries for ec.Quota exceed `max_samples_per_minute`.
+func (ec *EvalConfig) applyQuota() error {
+	if err := ec.Quota.CheckSamplesRate(); err != nil {
+		return err
+	}
+	ec.MaxSeries = ec.Quota.MaxSeriesPerQuery(ec.MaxSeries)
+	return nil
+}
+
 func (ec *EvalConfig) mayCache() bool {
 	if *disableCache {
 		return false
@@ -277,6 +301,10 @@ func evalExpr(qt *querytracer.Tracer, ec *EvalConfig, e metricsql.Expr) ([]*time
 }
 
 func evalExprInternal(qt *querytracer.Tracer, ec *EvalConfig, e metricsql.Expr) ([]*timeseries, error) {
+	if ec.Deadline.IsCanceled() {
+		// Stop evaluating the remaining subexpressions for the query canceled via /api/v1/admin/query/cancel.
+		return nil, fmt.Errorf("cannot evaluate %q: %s", e.AppendString(nil), ec.Deadline.String())
+	}
 	if me, ok := e.(*metricsql.MetricExpr); ok {
 		re := &metricsql.RollupExpr{
 			Expr: me,
@@ -1830,7 +1858,7 @@ func evalRollupFuncNoCache(qt *querytracer.Tracer, ec *EvalConfig, funcName stri
 		minTimestamp -= ec.Step
 	}
 	sq := storage.NewSearchQuery(minTimestamp, ec.End, tfss, ec.MaxSeries)
-	rss, err := netstorage.ProcessSearchQuery(qt, sq, ec.Deadline)
+	rss, err := netstorage.ProcessSearchQueryWithQuota(qt, sq, ec.Deadline, ec.Quota)
 	if err != nil {
 		return nil, err
 	}
@@ -1844,7 +1872,10 @@ func evalRollupFuncNoCache(qt *querytracer.Tracer, ec *EvalConfig, funcName stri
 
 	// Verify timeseries fit available memory during rollup calculations.
 	timeseriesLen := rssLen
-	if iafc != nil {
+	if ec.streamFunc != nil {
+		// Streamed time series require holding only GOMAXPROCS timeseries in memory.
+		timeseriesLen = min(cgroup.AvailableCPUs(), rssLen)
+	} else if iafc != nil {
 		// Incremental aggregates require holding only GOMAXPROCS timeseries in memory.
 		timeseriesLen = cgroup.AvailableCPUs()
 		if iafc.ae.Modifier.Op != "" {
@@ -1898,6 +1929,9 @@ func evalRollupFuncNoCache(qt *querytracer.Tracer, ec *EvalConfig, funcName stri
 
 	// Evaluate rollup
 	keepMetricNames := getKeepMetricNames(expr)
+	if ec.streamFunc != nil {
+		return nil, evalRollupStream(qt, funcName, keepMetricNames, rss, rcs, preFunc, sharedTimestamps, ec.streamFunc)
+	}
 	if iafc != nil {
 		return evalRollupWithIncrementalAggregate(qt, funcName, keepMetricNames, iafc, rss, rcs, preFunc, sharedTimestamps)
 	}
@@ -2006,6 +2040,42 @@ func evalRollupNoIncrementalAggregate(qt *querytracer.Tracer, funcName string, k
 	return tss, nil
 }
 
+// evalRollupStream calculates rollups over rss and passes every calculated time series to f as soon as it is ready.
+func evalRollupStream(qt *querytracer.Tracer, funcName string, keepMetricNames bool, rss *netstorage.Results, rcs []*rollupConfig,
+	preFunc func(values []float64, timestamps []int64), sharedTimestamps []int64, f func(ts *timeseries, workerID uint) error,
+) error {
+	qt = qt.NewChild("rollup %s() over %d series with streaming; rollupConfigs=%s", funcName, rss.Len(), rcs)
+	defer qt.Done()
+
+	var samplesScannedTotal atomic.Uint64
+	err := rss.RunParallel(qt, func(rs *netstorage.Result, workerID uint) error {
+		rs.Values, rs.Timestamps = dropStaleNaNs(funcName, rs.Values, rs.Timestamps)
+		preFunc(rs.Values, rs.Timestamps)
+		for _, rc := range rcs {
+			if tsm := newTimeseriesMap(funcName, keepMetricNames, sharedTimestamps, &rs.MetricName); tsm != nil {
+				samplesScanned := rc.DoTimeseriesMap(tsm, rs.Values, rs.Timestamps)
+				samplesScannedTotal.Add(samplesScanned)
+				for _, ts := range tsm.m {
+					if err := f(ts, workerID); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			var ts timeseries
+			samplesScanned := doRollupForTimeseries(funcName, keepMetricNames, rc, &ts, &rs.MetricName, rs.Values, rs.Timestamps, sharedTimestamps)
+			samplesScannedTotal.Add(samplesScanned)
+			if err := f(&ts, workerID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	rowsScannedPerQuery.Update(float64(samplesScannedTotal.Load()))
+	qt.Printf("samplesScanned=%d", samplesScannedTotal.Load())
+	return err
+}
+
 func doRollupForTimeseries(funcName string, keepMetricNames bool, rc *rollupConfig, tsDst *timeseries, mnSrc *storage.MetricName,
 	valuesSrc []float64, timestampsSrc []int64, sharedTimestamps []int64,
 ) uint64 {
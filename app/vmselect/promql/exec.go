@@ -4,10 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"math"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
+
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/querystats"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
@@ -38,17 +43,28 @@ func Exec(qt *querytracer.Tracer, ec *EvalConfig, q string, isFirstPointOnly boo
 	if querystats.Enabled() {
 		startTime := time.Now()
 		defer func() {
-			querystats.RegisterQuery(q, ec.End-ec.Start, startTime, ec.QueryStats.memoryUsage())
+			if ec.Deadline.IsCanceled() {
+				querystats.RegisterCanceledQuery(q, ec.End-ec.Start, startTime, ec.QueryStats.memoryUsage())
+			} else {
+				querystats.RegisterQuery(q, ec.End-ec.Start, startTime, ec.QueryStats.memoryUsage())
+			}
 			ec.QueryStats.addExecutionTimeMsec(startTime)
 		}()
 	}
 
 	ec.validate()
 
+	if err := ec.applyQuota(); err != nil {
+		return nil, err
+	}
+
+	qtChild := qt.NewChild("parse query")
 	e, err := parsePromQLWithCache(q)
+	qtChild.Done()
 	if err != nil {
 		return nil, httpserver.InvalidParamError(err)
 	}
+	e = rewriteWithRecordingRules(qt, ec, e)
 
 	if *disableImplicitConversion || *logImplicitConversion {
 		isInvalid := metricsql.IsLikelyInvalid(e)
@@ -62,9 +78,14 @@ func Exec(qt *querytracer.Tracer, ec *EvalConfig, q string, isFirstPointOnly boo
 		}
 	}
 
+	// Make the query cancelable via /api/v1/admin/query/cancel only while it is active.
+	deadline := ec.Deadline
+	ec.Deadline = deadline.WithCancel()
 	qid := activeQueriesV.Add(ec, q)
 	rv, err := evalExpr(qt, ec, e)
 	activeQueriesV.Remove(qid)
+	ec.Deadline.Cancel()
+	ec.Deadline = deadline
 	if err != nil {
 		return nil, err
 	}
@@ -102,6 +123,135 @@ func Exec(qt *querytracer.Tracer, ec *EvalConfig, q string, isFirstPointOnly boo
 	return result, nil
 }
 
+// ExecStream executes q for the given ec and calls f for every resulting time series.
+//
+// If q is a rollup over a series selector such as `rate(foo[5m])`, then the time series are passed to f as soon as they are calculated.
+// This allows reducing memory usage for queries over big number of time series.
+// Otherwise f is called for all the resulting time series after the query evaluation is complete.
+//
+// f may be called concurrently from multiple goroutines. The order of time series passed to f is undefined.
+// f mustn't hold references to rs contents after returning.
+func ExecStream(qt *querytracer.Tracer, ec *EvalConfig, q string, f func(rs *netstorage.Result, workerID uint) error) error {
+	qtChild := qt.NewChild("parse query")
+	e, err := parsePromQLWithCache(q)
+	qtChild.Done()
+	if err != nil {
+		return httpserver.InvalidParamError(err)
+	}
+	// The query may become non-streamable after the rewrite with recording rules.
+	e = rewriteWithRecordingRules(nil, ec, e)
+	if ec.Start == ec.End || !isStreamableExpr(e) {
+		qt.Printf("the query cannot be streamed, so evaluate it at once")
+		result, err := Exec(qt, ec, q, false)
+		if err != nil {
+			return err
+		}
+		for i := range result {
+			if err := f(&result[i], 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ecNew := copyEvalConfig(ec)
+	// The streamed results cannot be cached, since they aren't collected in memory.
+	ecNew.MayCache = false
+
+	var seriesCount atomic.Int64
+	var seenSeriesLock sync.Mutex
+	seenSeries := make(map[uint64]struct{})
+	ecNew.streamFunc = func(ts *timeseries, workerID uint) error {
+		if !slices.ContainsFunc(ts.Values, func(v float64) bool { return !math.IsNaN(v) }) {
+			// Skip timeseries with all NaNs.
+			return nil
+		}
+		if n := seriesCount.Add(1); *maxResponseSeries > 0 && n > int64(*maxResponseSeries) {
+			return fmt.Errorf("the response contains more than -search.maxResponseSeries=%d time series; either increase -search.maxResponseSeries "+
+				"or change the query in order to return smaller number of series", *maxResponseSeries)
+		}
+
+		bb := bbPool.Get()
+		bb.B = marshalMetricNameSorted(bb.B[:0], &ts.MetricName)
+		h := xxhash.Sum64(bb.B)
+		bbPool.Put(bb)
+		seenSeriesLock.Lock()
+		_, ok := seenSeries[h]
+		seenSeries[h] = struct{}{}
+		seenSeriesLock.Unlock()
+		if ok {
+			return fmt.Errorf(`duplicate output timeseries: %s`, stringMetricName(&ts.MetricName))
+		}
+
+		if n := ec.RoundDigits; n < 100 {
+			for i, v := range ts.Values {
+				ts.Values[i] = decimal.RoundToDecimalDigits(v, n)
+			}
+		}
+		var rs netstorage.Result
+		rs.MetricName.MoveFrom(&ts.MetricName)
+		rs.Values = ts.Values
+		rs.Timestamps = ts.Timestamps
+		return f(&rs, workerID)
+	}
+	if _, err := Exec(qt, ecNew, q, false); err != nil {
+		return err
+	}
+	qt.Printf("stream %d series", seriesCount.Load())
+	return nil
+}
+
+// isStreamableExpr returns true if results for e can be streamed via ExecStream.
+//
+// Only rollups over series selectors without `offset` and `@` modifiers can be streamed,
+// since the rest of expressions need all the time series in memory for calculating the result.
+func isStreamableExpr(e metricsql.Expr) bool {
+	switch t := e.(type) {
+	case *metricsql.MetricExpr:
+		return !t.IsEmpty()
+	case *metricsql.RollupExpr:
+		return isStreamableRollupExpr(t)
+	case *metricsql.FuncExpr:
+		if getRollupFunc(t.Name) == nil {
+			return false
+		}
+		switch strings.ToLower(t.Name) {
+		case "absent_over_time", "rollup_candlestick":
+			// These functions need special handling of the calculated results.
+			return false
+		}
+		hasRollupArg := false
+		for _, arg := range t.Args {
+			switch at := arg.(type) {
+			case *metricsql.NumberExpr, *metricsql.StringExpr, *metricsql.DurationExpr:
+			case *metricsql.MetricExpr:
+				if at.IsEmpty() {
+					return false
+				}
+				hasRollupArg = true
+			case *metricsql.RollupExpr:
+				if !isStreamableRollupExpr(at) {
+					return false
+				}
+				hasRollupArg = true
+			default:
+				return false
+			}
+		}
+		return hasRollupArg
+	default:
+		return false
+	}
+}
+
+func isStreamableRollupExpr(re *metricsql.RollupExpr) bool {
+	me, ok := re.Expr.(*metricsql.MetricExpr)
+	if !ok || me.IsEmpty() {
+		return false
+	}
+	return !re.ForSubquery() && re.Offset == nil && re.At == nil
+}
+
 func maySortResults(e metricsql.Expr) bool {
 	switch v := e.(type) {
 	case *metricsql.FuncExpr:
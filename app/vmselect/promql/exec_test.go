@@ -2,6 +2,7 @@ package promql
 
 import (
 	"math"
+	"sync"
 	"testing"
 	"time"
 
@@ -10910,3 +10911,73 @@ WITH (
 )
 max_over_time(cpuIdle)`)
 }
+
+func TestIsStreamableExpr(t *testing.T) {
+	f := func(q string, resultExpected bool) {
+		t.Helper()
+		e, err := metricsql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		result := isStreamableExpr(e)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for isStreamableExpr(%q); got %v; want %v", q, result, resultExpected)
+		}
+	}
+
+	f(`foo`, true)
+	f(`foo{bar="baz"}[5m]`, true)
+	f(`rate(foo[5m])`, true)
+	f(`rate(foo)`, true)
+	f(`quantile_over_time(0.5, foo[5m])`, true)
+	f(`rollup(foo[5m])`, true)
+
+	f(`123`, false)
+	f(`foo offset 5m`, false)
+	f(`rate(foo[5m] offset 1h)`, false)
+	f(`rate(foo[5m] @ 123)`, false)
+	f(`rate(foo[5m:1m])`, false)
+	f(`max_over_time(rate(foo[5m])[1h:])`, false)
+	f(`sum(rate(foo[5m]))`, false)
+	f(`rate(foo[5m]) + 1`, false)
+	f(`abs(foo)`, false)
+	f(`absent_over_time(foo[5m])`, false)
+	f(`rollup_candlestick(foo[5m])`, false)
+}
+
+func TestExecStreamNonStreamable(t *testing.T) {
+	ec := &EvalConfig{
+		Start:              1000e3,
+		End:                2000e3,
+		Step:               200e3,
+		MaxPointsPerSeries: 1e4,
+		MaxSeries:          1000,
+		Deadline:           searchutil.NewDeadline(time.Now(), time.Minute, ""),
+		RoundDigits:        100,
+	}
+	var mu sync.Mutex
+	var result []netstorage.Result
+	err := ExecStream(nil, ec, `label_set(time(), "foo", "bar")`, func(rs *netstorage.Result, _ uint) error {
+		mu.Lock()
+		result = append(result, *rs)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var mn storage.MetricName
+	mn.AddTag("foo", "bar")
+	resultExpected := []netstorage.Result{
+		{
+			MetricName: mn,
+			Values:     []float64{1000, 1200, 1400, 1600, 1800, 2000},
+			Timestamps: []int64{1000e3, 1200e3, 1400e3, 1600e3, 1800e3, 2000e3},
+		},
+	}
+	testResultsEqual(t, result, resultExpected)
+
+	if err := ExecStream(nil, ec, `1-`, func(_ *netstorage.Result, _ uint) error { return nil }); err == nil {
+		t.Fatalf("expecting non-nil error for invalid query")
+	}
+}
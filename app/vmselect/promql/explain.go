@@ -0,0 +1,477 @@
+package promql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// ExplainResult describes how a MetricsQL query is going to be evaluated.
+type ExplainResult struct {
+	// Query is the original query.
+	Query string
+
+	// OptimizedQuery is the query after parsing and optimization.
+	OptimizedQuery string
+
+	// Start, End and Step are the query time range and step in milliseconds.
+	Start int64
+	End   int64
+	Step  int64
+
+	// Plan is the root of the evaluation tree for OptimizedQuery.
+	Plan *ExplainNode
+}
+
+// ExplainNode describes the evaluation of a single expression in the query.
+type ExplainNode struct {
+	// Type is the expression type. See explainNodeType* constants.
+	Type string
+
+	// Expr is the string representation of the expression.
+	Expr string
+
+	// Name is the name of the function, aggregate function or binary operation.
+	Name string
+
+	// Children contains nodes for the expression args, which are evaluated before the current expression.
+	Children []*ExplainNode
+
+	// The following fields are set for rollup nodes.
+
+	// Window is the lookbehind window in milliseconds. Zero window means it is selected automatically based on Step.
+	Window int64
+
+	// Step is the interval between points calculated by the rollup or by the subquery in milliseconds.
+	Step int64
+
+	// Offset is the offset for the rollup in milliseconds.
+	Offset int64
+
+	// CacheStatus is the status of rollup result cache for the rollup. See explainCacheStatus* constants.
+	CacheStatus string
+
+	// IncrementalAggregation is set to true if the aggregate function is calculated incrementally over the rollup results,
+	// without holding all the rollup results in memory.
+	IncrementalAggregation bool
+
+	// The following fields are set for series selector nodes.
+
+	// Filters contains label filters sent to the storage, including filters from extra_label and extra_filters[] query args.
+	Filters []string
+
+	// PushedDownFilters contains label filters added to the selector by the query optimizer.
+	PushedDownFilters []string
+
+	// MinTimestamp and MaxTimestamp are the time range for searching series in milliseconds.
+	MinTimestamp int64
+	MaxTimestamp int64
+
+	// EstimatedSeries is the number of series matching the selector according to the index.
+	//
+	// It is set to -1 if the estimation isn't available.
+	EstimatedSeries int
+
+	// EstimateError contains the error occurred during series estimation.
+	EstimateError string
+
+	// The following fields are set for binary operation nodes.
+
+	// CommonFiltersPushdown is set to true if common label filters from the result of the first evaluated side
+	// are pushed down to the second side of the binary operation during evaluation.
+	CommonFiltersPushdown bool
+
+	// EvalOrder describes the order of evaluation of binary operation sides. See explainEvalOrder* constants.
+	EvalOrder string
+}
+
+const (
+	explainNodeTypeSelector  = "selector"
+	explainNodeTypeRollup    = "rollup"
+	explainNodeTypeSubquery  = "subquery"
+	explainNodeTypeTransform = "transform"
+	explainNodeTypeAggregate = "aggregate"
+	explainNodeTypeBinaryOp  = "binaryOp"
+	explainNodeTypeNumber    = "number"
+	explainNodeTypeString    = "string"
+	explainNodeTypeDuration  = "duration"
+)
+
+const (
+	// explainCacheStatusDisabled means the rollup result cache isn't used for the rollup.
+	explainCacheStatusDisabled = "disabled"
+
+	// explainCacheStatusMiss means the results for the rollup are missing in the cache.
+	explainCacheStatusMiss = "miss"
+
+	// explainCacheStatusPartialHit means only a part of the results is found in the cache.
+	explainCacheStatusPartialHit = "partialHit"
+
+	// explainCacheStatusFullHit means all the results are found in the cache.
+	explainCacheStatusFullHit = "fullHit"
+)
+
+const (
+	explainEvalOrderLeftFirst  = "leftFirst"
+	explainEvalOrderRightFirst = "rightFirst"
+	explainEvalOrderSequential = "sequential"
+	explainEvalOrderParallel   = "parallel"
+)
+
+// Explain returns the evaluation plan for q with the given ec without fetching samples from the storage.
+//
+// The number of series matching every series selector is estimated from the index.
+func Explain(qt *querytracer.Tracer, ec *EvalConfig, q string) (*ExplainResult, error) {
+	ec.validate()
+
+	if err := ec.applyQuota(); err != nil {
+		return nil, err
+	}
+	return explainQuery(qt, ec, q, true)
+}
+
+func explainQuery(qt *querytracer.Tracer, ec *EvalConfig, q string, estimateSeries bool) (*ExplainResult, error) {
+	e, err := parsePromQLWithCache(q)
+	if err != nil {
+		return nil, httpserver.InvalidParamError(err)
+	}
+	ex := &explainer{
+		qt:             qt,
+		estimateSeries: estimateSeries,
+	}
+	ex.initPushedDownFilters(q, e)
+	e = rewriteWithRecordingRules(qt, ec, e)
+	er := &ExplainResult{
+		Query:          q,
+		OptimizedQuery: string(e.AppendString(nil)),
+		Start:          ec.Start,
+		End:            ec.End,
+		Step:           ec.Step,
+		Plan:           ex.explainExpr(ec, e),
+	}
+	return er, nil
+}
+
+type explainer struct {
+	qt *querytracer.Tracer
+
+	// estimateSeries enables estimating the number of series for selectors from the index.
+	estimateSeries bool
+
+	// pushedDownFilters contains label filters added by the optimizer per every optimized series selector.
+	pushedDownFilters map[*metricsql.MetricExpr][]string
+}
+
+// initPushedDownFilters detects label filters added by the optimizer to series selectors in the optimized e.
+func (ex *explainer) initPushedDownFilters(q string, e metricsql.Expr) {
+	eOrig, err := metricsql.Parse(q)
+	if err != nil {
+		return
+	}
+	mesOrig := getMetricExprs(eOrig)
+	mes := getMetricExprs(e)
+	if len(mesOrig) != len(mes) {
+		// The optimizer changed the query structure, so it is impossible to match the original selectors to the optimized ones.
+		return
+	}
+	ex.pushedDownFilters = make(map[*metricsql.MetricExpr][]string)
+	for i, me := range mes {
+		meOrig := mesOrig[i]
+		if len(me.LabelFilterss) != len(meOrig.LabelFilterss) {
+			continue
+		}
+		var filters []string
+		for j, lfs := range me.LabelFilterss {
+			origFilters := make(map[string]struct{})
+			for _, lf := range meOrig.LabelFilterss[j] {
+				origFilters[string(lf.AppendString(nil))] = struct{}{}
+			}
+			for _, lf := range lfs {
+				s := string(lf.AppendString(nil))
+				if _, ok := origFilters[s]; !ok {
+					filters = append(filters, s)
+				}
+			}
+		}
+		if len(filters) > 0 {
+			ex.pushedDownFilters[me] = filters
+		}
+	}
+}
+
+func getMetricExprs(e metricsql.Expr) []*metricsql.MetricExpr {
+	var mes []*metricsql.MetricExpr
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		if me, ok := expr.(*metricsql.MetricExpr); ok {
+			mes = append(mes, me)
+		}
+	})
+	return mes
+}
+
+func (ex *explainer) explainExpr(ec *EvalConfig, e metricsql.Expr) *ExplainNode {
+	switch t := e.(type) {
+	case *metricsql.MetricExpr:
+		re := &metricsql.RollupExpr{
+			Expr: t,
+		}
+		return ex.explainRollup(ec, "default_rollup", e, re, false)
+	case *metricsql.RollupExpr:
+		return ex.explainRollup(ec, "default_rollup", e, t, false)
+	case *metricsql.FuncExpr:
+		if getRollupFunc(t.Name) == nil {
+			return ex.newNodeWithArgs(ec, explainNodeTypeTransform, e, t.Name, t.Args)
+		}
+		rollupArgIdx := metricsql.GetRollupArgIdx(t)
+		if rollupArgIdx >= len(t.Args) {
+			return ex.newNodeWithArgs(ec, explainNodeTypeRollup, e, t.Name, t.Args)
+		}
+		args := append([]metricsql.Expr{}, t.Args[:rollupArgIdx]...)
+		args = append(args, t.Args[rollupArgIdx+1:]...)
+		re := getRollupExprArg(t.Args[rollupArgIdx])
+		n := ex.explainRollup(ec, t.Name, e, re, false)
+		for _, arg := range args {
+			n.Children = append(n.Children, ex.explainExpr(ec, arg))
+		}
+		return n
+	case *metricsql.AggrFuncExpr:
+		if getIncrementalAggrFuncCallbacks(t.Name) != nil {
+			if fe, _ := tryGetArgRollupFuncWithMetricExpr(t); fe != nil {
+				// The aggregate is calculated incrementally over the rollup results - see evalAggrFunc.
+				// Rollup results are cached for the whole aggregate expression in this case.
+				n := &ExplainNode{
+					Type:                   explainNodeTypeAggregate,
+					Expr:                   string(e.AppendString(nil)),
+					Name:                   t.Name,
+					IncrementalAggregation: true,
+					EstimatedSeries:        -1,
+				}
+				rollupArgIdx := metricsql.GetRollupArgIdx(fe)
+				re := getRollupExprArg(fe.Args[rollupArgIdx])
+				rn := ex.explainRollup(ec, fe.Name, e, re, true)
+				rn.Expr = string(fe.AppendString(nil))
+				for i, arg := range fe.Args {
+					if i != rollupArgIdx {
+						rn.Children = append(rn.Children, ex.explainExpr(ec, arg))
+					}
+				}
+				n.Children = append(n.Children, rn)
+				return n
+			}
+		}
+		return ex.newNodeWithArgs(ec, explainNodeTypeAggregate, e, t.Name, t.Args)
+	case *metricsql.BinaryOpExpr:
+		n := ex.newNodeWithArgs(ec, explainNodeTypeBinaryOp, e, t.Op, []metricsql.Expr{t.Left, t.Right})
+		exprFirst, exprSecond := binaryOpEvalOrder(t)
+		switch {
+		case canPushdownCommonFilters(t):
+			n.CommonFiltersPushdown = true
+			if exprFirst == t.Left {
+				n.EvalOrder = explainEvalOrderLeftFirst
+			} else {
+				n.EvalOrder = explainEvalOrderRightFirst
+			}
+		case shouldOptimizeRepeatedBinaryOpSubexprs(ec, exprFirst, exprSecond):
+			n.EvalOrder = explainEvalOrderSequential
+		default:
+			n.EvalOrder = explainEvalOrderParallel
+		}
+		return n
+	case *metricsql.NumberExpr:
+		return ex.newNodeWithArgs(ec, explainNodeTypeNumber, e, "", nil)
+	case *metricsql.StringExpr:
+		return ex.newNodeWithArgs(ec, explainNodeTypeString, e, "", nil)
+	default:
+		return ex.newNodeWithArgs(ec, explainNodeTypeDuration, e, "", nil)
+	}
+}
+
+func (ex *explainer) newNodeWithArgs(ec *EvalConfig, nodeType string, e metricsql.Expr, name string, args []metricsql.Expr) *ExplainNode {
+	n := &ExplainNode{
+		Type:            nodeType,
+		Expr:            string(e.AppendString(nil)),
+		Name:            name,
+		EstimatedSeries: -1,
+	}
+	for _, arg := range args {
+		n.Children = append(n.Children, ex.explainExpr(ec, arg))
+	}
+	return n
+}
+
+// explainRollup explains the calculation of funcName over re.
+//
+// expr is the expression used as a key in the rollup result cache. See evalRollupFunc.
+func (ex *explainer) explainRollup(ec *EvalConfig, funcName string, expr metricsql.Expr, re *metricsql.RollupExpr, isIncrementalAggr bool) *ExplainNode {
+	funcName = strings.ToLower(funcName)
+	n := &ExplainNode{
+		Type:            explainNodeTypeRollup,
+		Expr:            string(expr.AppendString(nil)),
+		Name:            funcName,
+		Step:            ec.Step,
+		CacheStatus:     explainCacheStatusDisabled,
+		EstimatedSeries: -1,
+	}
+	if re.Offset != nil {
+		n.Offset = re.Offset.Duration(ec.Step)
+	}
+	ecNew := ec
+	if re.Offset != nil || re.At != nil {
+		ecNew = copyEvalConfig(ec)
+		ecNew.Start -= n.Offset
+		ecNew.End -= n.Offset
+		if re.At != nil {
+			// The `@` modifier is evaluated at query time, so the time range for the rollup is unknown here.
+			n.Children = append(n.Children, ex.explainExpr(ec, re.At))
+		}
+	}
+	window, err := re.Window.NonNegativeDuration(ec.Step)
+	if err == nil {
+		n.Window = window
+	}
+
+	me, ok := re.Expr.(*metricsql.MetricExpr)
+	if !ok {
+		// Rollup over subquery - see evalRollupFuncWithSubquery.
+		n.Type = explainNodeTypeSubquery
+		step, err := re.Step.NonNegativeDuration(ec.Step)
+		if err != nil || step == 0 {
+			step = ec.Step
+		}
+		n.Step = step
+		ecSQ := copyEvalConfig(ecNew)
+		ecSQ.Start -= window + step + maxSilenceInterval()
+		ecSQ.End += step
+		ecSQ.Step = step
+		ecSQ.Start, ecSQ.End = alignStartEnd(ecSQ.Start, ecSQ.End, ecSQ.Step)
+		n.Children = append(n.Children, ex.explainExpr(ecSQ, re.Expr))
+		return n
+	}
+
+	if re.At == nil && !me.IsEmpty() {
+		n.CacheStatus = getExplainCacheStatus(ecNew, funcName, expr, window, isIncrementalAggr)
+	}
+	n.Children = append(n.Children, ex.explainSelector(ecNew, funcName, me, window, re.At != nil))
+	return n
+}
+
+func (ex *explainer) explainSelector(ec *EvalConfig, funcName string, me *metricsql.MetricExpr, window int64, hasAt bool) *ExplainNode {
+	n := &ExplainNode{
+		Type:              explainNodeTypeSelector,
+		Expr:              string(me.AppendString(nil)),
+		PushedDownFilters: ex.pushedDownFilters[me],
+		EstimatedSeries:   -1,
+	}
+	if me.IsEmpty() {
+		return n
+	}
+
+	// Use the same search query as evalRollupFuncNoCache does.
+	tfss := searchutil.ToTagFilterss(me.LabelFilterss)
+	tfss = searchutil.JoinTagFilterss(tfss, ec.EnforcedTagFilterss)
+	minTimestamp := ec.Start
+	if needSilenceIntervalForRollupFunc[funcName] {
+		minTimestamp -= maxSilenceInterval()
+	}
+	minTimestamp -= max(window, ec.Step)
+	sq := storage.NewSearchQuery(minTimestamp, ec.End, tfss, ec.MaxSeries)
+	n.Filters = sq.FiltersString()
+	if !hasAt {
+		n.MinTimestamp = sq.MinTimestamp
+		n.MaxTimestamp = sq.MaxTimestamp
+	}
+	if !ex.estimateSeries || hasAt {
+		return n
+	}
+	metricNames, err := netstorage.SearchMetricNames(ex.qt, sq, ec.Deadline)
+	if err != nil {
+		n.EstimateError = err.Error()
+		return n
+	}
+	n.EstimatedSeries = len(metricNames)
+	return n
+}
+
+// getExplainCacheStatus returns rollup result cache status for the rollup funcName over expr with the given window.
+//
+// The status is obtained without modifying the cache contents.
+func getExplainCacheStatus(ec *EvalConfig, funcName string, expr metricsql.Expr, window int64, isIncrementalAggr bool) string {
+	if !ec.mayCache() {
+		return explainCacheStatusDisabled
+	}
+	if ec.Start != ec.End {
+		return rollupResultCacheV.getSeriesCacheStatus(ec, expr, window)
+	}
+
+	// See evalInstantRollup for the conditions when the cache is used for instant queries.
+	if window < minWindowForInstantRollupOptimization.Milliseconds() {
+		return explainCacheStatusDisabled
+	}
+	aggrName := ""
+	if ae, ok := expr.(*metricsql.AggrFuncExpr); ok && isIncrementalAggr {
+		aggrName = strings.ToLower(ae.Name)
+	}
+	switch funcName {
+	case "max_over_time":
+		if aggrName != "" && aggrName != "max" {
+			return explainCacheStatusDisabled
+		}
+	case "min_over_time":
+		if aggrName != "" && aggrName != "min" {
+			return explainCacheStatusDisabled
+		}
+	case "count_eq_over_time", "count_gt_over_time", "count_le_over_time", "count_ne_over_time", "count_over_time",
+		"increase", "increase_pure", "sum_over_time":
+		if aggrName != "" && aggrName != "sum" {
+			return explainCacheStatusDisabled
+		}
+	default:
+		// avg_over_time and sum(rate) are calculated via other cached rollups,
+		// while the rest of functions do not use the cache for instant queries.
+		return explainCacheStatusDisabled
+	}
+	tss := rollupResultCacheV.GetInstantValues(nil, expr, window, ec.Step, ec.EnforcedTagFilterss)
+	if len(tss) == 0 {
+		return explainCacheStatusMiss
+	}
+	// Cached instant values are always adjusted with the data from the storage.
+	return explainCacheStatusPartialHit
+}
+
+// planString returns human-readable representation of the plan starting from n.
+func (n *ExplainNode) planString() string {
+	var sb strings.Builder
+	n.appendString(&sb, 0)
+	return sb.String()
+}
+
+func (n *ExplainNode) appendString(sb *strings.Builder, indent int) {
+	fmt.Fprintf(sb, "%s%s %s", strings.Repeat("  ", indent), n.Type, n.Expr)
+	switch n.Type {
+	case explainNodeTypeRollup:
+		fmt.Fprintf(sb, " window=%d step=%d offset=%d cache=%s", n.Window, n.Step, n.Offset, n.CacheStatus)
+	case explainNodeTypeSubquery:
+		fmt.Fprintf(sb, " window=%d step=%d offset=%d", n.Window, n.Step, n.Offset)
+	case explainNodeTypeAggregate:
+		if n.IncrementalAggregation {
+			sb.WriteString(" incremental")
+		}
+	case explainNodeTypeBinaryOp:
+		fmt.Fprintf(sb, " evalOrder=%s commonFiltersPushdown=%v", n.EvalOrder, n.CommonFiltersPushdown)
+	case explainNodeTypeSelector:
+		if len(n.PushedDownFilters) > 0 {
+			fmt.Fprintf(sb, " pushedDownFilters=%s", strings.Join(n.PushedDownFilters, ","))
+		}
+	}
+	sb.WriteString("\n")
+	for _, child := range n.Children {
+		child.appendString(sb, indent+1)
+	}
+}
@@ -0,0 +1,149 @@
+package promql
+
+import (
+	"testing"
+)
+
+func TestExplainQuery(t *testing.T) {
+	f := func(q, optimizedQueryExpected, planExpected string) {
+		t.Helper()
+
+		ec := &EvalConfig{
+			Start:              1200e3,
+			End:                2400e3,
+			Step:               60e3,
+			MaxPointsPerSeries: 1e4,
+			MayCache:           false,
+		}
+		er, err := explainQuery(nil, ec, q, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if er.OptimizedQuery != optimizedQueryExpected {
+			t.Fatalf("unexpected optimized query\ngot\n%s\nwant\n%s", er.OptimizedQuery, optimizedQueryExpected)
+		}
+		plan := er.Plan.planString()
+		if plan != planExpected {
+			t.Fatalf("unexpected plan\ngot\n%s\nwant\n%s", plan, planExpected)
+		}
+	}
+
+	// series selector
+	f(`foo{a="b"}`, `foo{a="b"}`, `rollup foo{a="b"} window=0 step=60000 offset=0 cache=disabled
+  selector foo{a="b"}
+`)
+
+	// rollup function with extra args
+	f(`quantile_over_time(0.9, foo[5m] offset 1m)`, `quantile_over_time(0.9, foo[5m] offset 1m)`, `rollup quantile_over_time(0.9, foo[5m] offset 1m) window=300000 step=60000 offset=60000 cache=disabled
+  selector foo
+  number 0.9
+`)
+
+	// incremental aggregation
+	f(`sum(rate(foo[5m])) by (x)`, `sum(rate(foo[5m])) by(x)`, `aggregate sum(rate(foo[5m])) by(x) incremental
+  rollup rate(foo[5m]) window=300000 step=60000 offset=0 cache=disabled
+    selector foo
+`)
+
+	// non-incremental aggregation
+	f(`topk(3, foo)`, `topk(3, foo)`, `aggregate topk(3, foo)
+  number 3
+  rollup foo window=0 step=60000 offset=0 cache=disabled
+    selector foo
+`)
+
+	// binary operation with label filters pushdown
+	f(`foo{a="b"} + on(a) bar`, `foo{a="b"} + on(a) bar{a="b"}`, `binaryOp foo{a="b"} + on(a) bar{a="b"} evalOrder=leftFirst commonFiltersPushdown=true
+  rollup foo{a="b"} window=0 step=60000 offset=0 cache=disabled
+    selector foo{a="b"}
+  rollup bar{a="b"} window=0 step=60000 offset=0 cache=disabled
+    selector bar{a="b"} pushedDownFilters=a="b"
+`)
+	f(`foo and bar`, `foo and bar`, `binaryOp foo and bar evalOrder=rightFirst commonFiltersPushdown=true
+  rollup foo window=0 step=60000 offset=0 cache=disabled
+    selector foo
+  rollup bar window=0 step=60000 offset=0 cache=disabled
+    selector bar
+`)
+	f(`foo or bar`, `foo or bar`, `binaryOp foo or bar evalOrder=parallel commonFiltersPushdown=false
+  rollup foo window=0 step=60000 offset=0 cache=disabled
+    selector foo
+  rollup bar window=0 step=60000 offset=0 cache=disabled
+    selector bar
+`)
+
+	// subquery
+	f(`max_over_time(rate(foo[1m])[10m:30s])`, `max_over_time(rate(foo[1m])[10m:30s])`, `subquery max_over_time(rate(foo[1m])[10m:30s]) window=600000 step=30000 offset=0
+  rollup rate(foo[1m]) window=60000 step=30000 offset=0 cache=disabled
+    selector foo
+`)
+
+	// transform function
+	f(`abs(foo)`, `abs(foo)`, `transform abs(foo)
+  rollup foo window=0 step=60000 offset=0 cache=disabled
+    selector foo
+`)
+
+	// constant expression
+	f(`1 + 2`, `3`, `number 3
+`)
+}
+
+func TestExplainQueryCacheStatus(t *testing.T) {
+	InitRollupResultCache("")
+	defer StopRollupResultCache()
+
+	ec := &EvalConfig{
+		Start:              1000,
+		End:                2000,
+		Step:               200,
+		MaxPointsPerSeries: 1e4,
+		MayCache:           true,
+	}
+	q := `rate(foo[1s])`
+	e, err := parsePromQLWithCache(q)
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+
+	f := func(cacheStatusExpected string) {
+		t.Helper()
+
+		er, err := explainQuery(nil, ec, q, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if er.Plan.CacheStatus != cacheStatusExpected {
+			t.Fatalf("unexpected cache status; got %q; want %q", er.Plan.CacheStatus, cacheStatusExpected)
+		}
+	}
+
+	f(explainCacheStatusMiss)
+
+	tss := []*timeseries{
+		{
+			Timestamps: []int64{1000, 1200, 1400},
+			Values:     []float64{1, 2, 3},
+		},
+	}
+	rollupResultCacheV.PutSeries(nil, ec, e, 1000, tss)
+	f(explainCacheStatusPartialHit)
+
+	tss = []*timeseries{
+		{
+			Timestamps: []int64{1000, 1200, 1400, 1600, 1800, 2000},
+			Values:     []float64{1, 2, 3, 4, 5, 6},
+		},
+	}
+	rollupResultCacheV.PutSeries(nil, ec, e, 1000, tss)
+	f(explainCacheStatusFullHit)
+
+	// Explain mustn't modify the cache
+	tssCached, newStart := rollupResultCacheV.GetSeries(nil, ec, e, 1000)
+	if newStart <= ec.End || len(tssCached) != 1 {
+		t.Fatalf("unexpected cached series; newStart=%d, series=%d", newStart, len(tssCached))
+	}
+
+	ResetRollupResultCache()
+	f(explainCacheStatusMiss)
+}
@@ -0,0 +1,873 @@
+package promql
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/vmalertproxy"
+)
+
+var (
+	recordingRulesFile = flag.String("search.recordingRulesFile", "", "Optional path to a file with vmalert recording rules, which are used for automatic rewriting of queries, "+
+		"so they read the series precomputed by these rules. The path can point either to local file or to http url. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#recording-rules-query-rewriting . The file is re-read on SIGHUP signal. "+
+		"See also -search.recordingRulesFromVMAlert")
+	recordingRulesFromVMAlert = flag.Bool("search.recordingRulesFromVMAlert", false, "Whether to periodically fetch recording rules from vmalert at -vmalert.proxyURL "+
+		"for automatic rewriting of queries, so they read the series precomputed by these rules. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#recording-rules-query-rewriting and -search.recordingRulesRefreshInterval")
+	recordingRulesRefreshInterval = flag.Duration("search.recordingRulesRefreshInterval", time.Minute, "How often to fetch recording rules from vmalert if -search.recordingRulesFromVMAlert is set")
+	recordingRulesDefaultInterval = flag.Duration("search.recordingRulesDefaultInterval", time.Minute, "The evaluation interval for groups without interval at -search.recordingRulesFile. "+
+		"It must match -evaluationInterval command-line flag value at vmalert")
+	recordingRulesDefaultEvalDelay = flag.Duration("search.recordingRulesDefaultEvalDelay", 30*time.Second, "The evaluation delay for groups without eval_delay and eval_offset "+
+		"at -search.recordingRulesFile and at vmalert. It must match -rule.evalDelay command-line flag value at vmalert")
+)
+
+// InitRecordingRules must be called after flag.Parse and before executing queries.
+//
+// The loaded recording rules are used for rewriting queries at Exec and ExecStream.
+func InitRecordingRules() {
+	if *recordingRulesFromVMAlert && !vmalertproxy.IsEnabled() {
+		logger.Fatalf("-search.recordingRulesFromVMAlert requires -vmalert.proxyURL to be set")
+	}
+
+	// Register SIGHUP handler for config re-read just before loadRecordingRulesFile call.
+	// This guarantees that the config will be re-read if the signal arrives during loadRecordingRulesFile call.
+	sighupCh := procutil.NewSighupChan()
+
+	rules, err := loadRecordingRulesFile()
+	if err != nil {
+		logger.Fatalf("cannot load -search.recordingRulesFile: %s", err)
+	}
+	if len(*recordingRulesFile) > 0 {
+		recordingRulesConfigReloads = metrics.NewCounter(`vm_recording_rules_config_reloads_total`)
+		recordingRulesConfigReloadErrors = metrics.NewCounter(`vm_recording_rules_config_reloads_errors_total`)
+		recordingRulesConfigSuccess = metrics.NewGauge(`vm_recording_rules_config_last_reload_successful`, nil)
+		recordingRulesConfigTimestamp = metrics.NewCounter(`vm_recording_rules_config_last_reload_success_timestamp_seconds`)
+
+		recordingRulesSources.setFileRules(rules)
+		recordingRulesConfigSuccess.Set(1)
+		recordingRulesConfigTimestamp.Set(fasttime.UnixTimestamp())
+
+		go func() {
+			for range sighupCh {
+				recordingRulesConfigReloads.Inc()
+				logger.Infof("received SIGHUP; reloading -search.recordingRulesFile=%q...", *recordingRulesFile)
+				rules, err := loadRecordingRulesFile()
+				if err != nil {
+					recordingRulesConfigReloadErrors.Inc()
+					recordingRulesConfigSuccess.Set(0)
+					logger.Errorf("cannot load the updated -search.recordingRulesFile: %s; preserving the previous rules", err)
+					continue
+				}
+				recordingRulesSources.setFileRules(rules)
+				recordingRulesConfigSuccess.Set(1)
+				recordingRulesConfigTimestamp.Set(fasttime.UnixTimestamp())
+				logger.Infof("successfully reloaded -search.recordingRulesFile=%q", *recordingRulesFile)
+			}
+		}()
+	}
+
+	if *recordingRulesFromVMAlert {
+		recordingRulesStopCh = make(chan struct{})
+		recordingRulesWG.Add(1)
+		go func() {
+			defer recordingRulesWG.Done()
+			runRecordingRulesFetcher(recordingRulesStopCh)
+		}()
+	}
+}
+
+// StopRecordingRules stops fetching recording rules from vmalert.
+func StopRecordingRules() {
+	if recordingRulesStopCh == nil {
+		return
+	}
+	close(recordingRulesStopCh)
+	recordingRulesWG.Wait()
+}
+
+// CheckRecordingRulesFile checks the file pointed by -search.recordingRulesFile
+func CheckRecordingRulesFile() error {
+	_, err := loadRecordingRulesFile()
+	return err
+}
+
+var (
+	recordingRulesConfigReloads      *metrics.Counter
+	recordingRulesConfigReloadErrors *metrics.Counter
+	recordingRulesConfigSuccess      *metrics.Gauge
+	recordingRulesConfigTimestamp    *metrics.Counter
+)
+
+var (
+	recordingRulesStopCh chan struct{}
+	recordingRulesWG     sync.WaitGroup
+)
+
+var (
+	recordingRulesFetches     = metrics.NewCounter(`vm_recording_rules_vmalert_fetches_total`)
+	recordingRulesFetchErrors = metrics.NewCounter(`vm_recording_rules_vmalert_fetch_errors_total`)
+	recordingRulesRewrites    = metrics.NewCounter(`vm_recording_rules_query_rewrites_total`)
+
+	_ = metrics.NewGauge(`vm_recording_rules`, func() float64 {
+		rrs := recordingRulesGlobal.Load()
+		if rrs == nil {
+			return 0
+		}
+		return float64(len(rrs.rules))
+	})
+)
+
+func runRecordingRulesFetcher(stopCh <-chan struct{}) {
+	t := time.NewTicker(*recordingRulesRefreshInterval)
+	defer t.Stop()
+	for {
+		recordingRulesFetches.Inc()
+		rules, err := fetchRecordingRulesFromVMAlert()
+		if err != nil {
+			recordingRulesFetchErrors.Inc()
+			logger.Errorf("cannot fetch recording rules from vmalert; preserving the previously fetched rules: %s", err)
+		} else {
+			recordingRulesSources.setVMAlertRules(rules)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// recordingRulesSources holds recording rules obtained from -search.recordingRulesFile and from vmalert.
+var recordingRulesSources recordingRulesState
+
+type recordingRulesState struct {
+	mu           sync.Mutex
+	fileRules    []*recordingRule
+	vmalertRules []*recordingRule
+}
+
+func (rs *recordingRulesState) setFileRules(rules []*recordingRule) {
+	rs.mu.Lock()
+	rs.fileRules = rules
+	rs.updateGlobalLocked()
+	rs.mu.Unlock()
+}
+
+func (rs *recordingRulesState) setVMAlertRules(rules []*recordingRule) {
+	rs.mu.Lock()
+	rs.vmalertRules = rules
+	rs.updateGlobalLocked()
+	rs.mu.Unlock()
+}
+
+func (rs *recordingRulesState) updateGlobalLocked() {
+	rules := append([]*recordingRule{}, rs.fileRules...)
+	rules = append(rules, rs.vmalertRules...)
+
+	// Preserve the time since the rule results exist for the rules, which were loaded before.
+	if rrs := recordingRulesGlobal.Load(); rrs != nil {
+		sinces := make(map[string]int64, len(rrs.rules))
+		for _, r := range rrs.rules {
+			sinces[r.key()] = r.since
+		}
+		for _, r := range rules {
+			if since, ok := sinces[r.key()]; ok && since < r.since {
+				r.since = since
+			}
+		}
+	}
+	recordingRulesGlobal.Store(newRecordingRules(rules))
+}
+
+var recordingRulesGlobal atomic.Pointer[recordingRules]
+
+func loadRecordingRulesFile() ([]*recordingRule, error) {
+	if len(*recordingRulesFile) == 0 {
+		return nil, nil
+	}
+	data, err := fscore.ReadFileOrHTTP(*recordingRulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", *recordingRulesFile, err)
+	}
+	data = envtemplate.ReplaceBytes(data)
+	rules, err := parseRecordingRulesFile(data, *recordingRulesDefaultInterval, *recordingRulesDefaultEvalDelay)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", *recordingRulesFile, err)
+	}
+	return rules, nil
+}
+
+// recordingRulesConfig represents vmalert rules file.
+//
+// Only the fields needed for query rewriting are parsed, the rest of fields are ignored.
+type recordingRulesConfig struct {
+	Groups []recordingRulesGroupConfig `yaml:"groups"`
+}
+
+type recordingRulesGroupConfig struct {
+	Name          string                `yaml:"name"`
+	Type          string                `yaml:"type,omitempty"`
+	Interval      *promutil.Duration    `yaml:"interval,omitempty"`
+	EvalOffset    *promutil.Duration    `yaml:"eval_offset,omitempty"`
+	EvalDelay     *promutil.Duration    `yaml:"eval_delay,omitempty"`
+	EvalAlignment *bool                 `yaml:"eval_alignment,omitempty"`
+	Params        url.Values            `yaml:"params,omitempty"`
+	Labels        map[string]string     `yaml:"labels,omitempty"`
+	Rules         []recordingRuleConfig `yaml:"rules"`
+}
+
+type recordingRuleConfig struct {
+	Record string            `yaml:"record,omitempty"`
+	Expr   string            `yaml:"expr"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+func parseRecordingRulesFile(data []byte, defaultInterval, defaultEvalDelay time.Duration) ([]*recordingRule, error) {
+	var cfg recordingRulesConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	var rules []*recordingRule
+	for _, g := range cfg.Groups {
+		if !isRewritableRecordingRulesGroup(g.Type, len(g.Params)) {
+			continue
+		}
+		interval := g.Interval.Duration()
+		if interval < 0 {
+			return nil, fmt.Errorf("interval for group %q cannot be negative; got %s", g.Name, interval)
+		}
+		if interval == 0 {
+			interval = defaultInterval
+		}
+		var evalOffset *time.Duration
+		if g.EvalOffset != nil {
+			d := g.EvalOffset.Duration()
+			evalOffset = &d
+		}
+		if evalOffset == nil && g.EvalAlignment != nil && !*g.EvalAlignment {
+			// The rule results are stored at timestamps, which aren't aligned to the interval,
+			// so they cannot be used for calculating the query results at the requested timestamps.
+			continue
+		}
+		evalDelay := defaultEvalDelay
+		if g.EvalDelay != nil {
+			evalDelay = g.EvalDelay.Duration()
+		}
+		ret := recordingRuleEvalTiming{
+			interval:   interval,
+			evalOffset: evalOffset,
+			evalDelay:  evalDelay,
+		}
+		for _, rc := range g.Rules {
+			if rc.Record == "" {
+				// Skip alerting rules
+				continue
+			}
+			labels := make(map[string]string, len(g.Labels)+len(rc.Labels))
+			for k, v := range rc.Labels {
+				labels[k] = v
+			}
+			// Group labels override rule labels in the same way as vmalert does.
+			for k, v := range g.Labels {
+				labels[k] = v
+			}
+			r, err := newRecordingRule(g.Name, rc.Record, rc.Expr, ret, labels)
+			if err != nil {
+				return nil, fmt.Errorf("group %q: %w", g.Name, err)
+			}
+			if r != nil {
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules, nil
+}
+
+func fetchRecordingRulesFromVMAlert() ([]*recordingRule, error) {
+	args := url.Values{
+		"type":            {"record"},
+		"datasource_type": {"prometheus"},
+	}
+	data, err := vmalertproxy.Get("/api/v1/rules", args)
+	if err != nil {
+		return nil, err
+	}
+	return parseVMAlertRulesResponse(data, *recordingRulesDefaultEvalDelay)
+}
+
+// vmalertRulesResponse represents vmalert response for /api/v1/rules
+type vmalertRulesResponse struct {
+	Data struct {
+		Groups []struct {
+			Name       string   `json:"name"`
+			Type       string   `json:"type"`
+			Interval   float64  `json:"interval"`
+			EvalOffset *float64 `json:"eval_offset"`
+			EvalDelay  *float64 `json:"eval_delay"`
+			Params     []string `json:"params"`
+			Rules      []struct {
+				Name   string            `json:"name"`
+				Query  string            `json:"query"`
+				Type   string            `json:"type"`
+				Labels map[string]string `json:"labels"`
+			} `json:"rules"`
+		} `json:"groups"`
+	} `json:"data"`
+}
+
+func parseVMAlertRulesResponse(data []byte, defaultEvalDelay time.Duration) ([]*recordingRule, error) {
+	var resp vmalertRulesResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("cannot parse vmalert response: %w", err)
+	}
+	var rules []*recordingRule
+	for _, g := range resp.Data.Groups {
+		if !isRewritableRecordingRulesGroup(g.Type, len(g.Params)) {
+			continue
+		}
+		// vmalert doesn't expose eval_alignment, so the rule results are expected to be aligned to the interval.
+		ret := recordingRuleEvalTiming{
+			interval:  time.Duration(g.Interval * float64(time.Second)),
+			evalDelay: defaultEvalDelay,
+		}
+		if g.EvalOffset != nil {
+			d := time.Duration(*g.EvalOffset * float64(time.Second))
+			ret.evalOffset = &d
+		}
+		if g.EvalDelay != nil {
+			ret.evalDelay = time.Duration(*g.EvalDelay * float64(time.Second))
+		}
+		for _, rc := range g.Rules {
+			if rc.Type != "recording" {
+				continue
+			}
+			r, err := newRecordingRule(g.Name, rc.Name, rc.Query, ret, rc.Labels)
+			if err != nil {
+				// vmalert may run with different MetricsQL version, so skip the rule instead of rejecting all the rules.
+				logger.Warnf("skipping recording rule fetched from vmalert: group %q: %s", g.Name, err)
+				continue
+			}
+			if r != nil {
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// isRewritableRecordingRulesGroup returns false for groups, which query another datasource type
+// or which pass additional params to the datasource, since the results of their rules may differ from the results of the query.
+func isRewritableRecordingRulesGroup(groupType string, paramsLen int) bool {
+	if groupType != "" && groupType != "prometheus" {
+		return false
+	}
+	return paramsLen == 0
+}
+
+// recordingRuleEvalTiming contains group settings, which define timestamps for the rule results.
+type recordingRuleEvalTiming struct {
+	interval time.Duration
+
+	// evalOffset is eval_offset from the group config. It is nil if eval_offset isn't set.
+	evalOffset *time.Duration
+
+	// evalDelay is eval_delay from the group config. It is ignored if evalOffset is set.
+	evalDelay time.Duration
+}
+
+// recordingRule is a recording rule, which can be used for query rewriting.
+type recordingRule struct {
+	group  string
+	record string
+
+	// interval is the rule evaluation interval in milliseconds.
+	interval int64
+
+	// evalOffset is the offset in milliseconds for the rule results timestamps in the range [0..interval).
+	//
+	// The rule results are stored at timestamps t, where (t - evalOffset) is divisible by interval.
+	evalOffset int64
+
+	// evalDelay is the delay in milliseconds between the rule results timestamp and the time the rule is evaluated.
+	evalDelay int64
+
+	// since is the time in milliseconds since the rule results are expected to exist.
+	//
+	// It is set to the time when the rule has been loaded for the first time,
+	// since there is no way to determine when vmalert started evaluating the rule.
+	since int64
+
+	// expr is the optimized rule expression.
+	expr metricsql.Expr
+
+	// labels contains rule labels sorted by name.
+	labels []metricsql.LabelFilter
+
+	// mayFilter returns true if the matching subexpression may contain extra filter on the given label at the series selector.
+	//
+	// It is nil if the matching subexpression must be identical to expr.
+	mayFilter func(label string) bool
+}
+
+// newRecordingRule returns recording rule for the given args.
+//
+// nil is returned if the rule cannot be used for query rewriting.
+func newRecordingRule(group, record, expr string, ret recordingRuleEvalTiming, labels map[string]string) (*recordingRule, error) {
+	if record == "" {
+		return nil, fmt.Errorf("missing record name for expr %q", expr)
+	}
+	e, err := parsePromQLWithCache(expr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse expr for %q: %w", record, err)
+	}
+	interval := ret.interval.Milliseconds()
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval for %q must be positive; got %s", record, ret.interval)
+	}
+	var evalOffset, evalDelay int64
+	if ret.evalOffset != nil {
+		// vmalert evaluates groups with eval_offset at the exact timestamps without the delay.
+		// Negative eval_offset is equivalent to interval+eval_offset.
+		evalOffset = ret.evalOffset.Milliseconds() % interval
+		if evalOffset < 0 {
+			evalOffset += interval
+		}
+	} else {
+		evalDelay = ret.evalDelay.Milliseconds()
+		if evalDelay < 0 {
+			return nil, fmt.Errorf("eval_delay for %q cannot be negative; got %s", record, ret.evalDelay)
+		}
+	}
+	mayFilter, ok := getRecordingRuleMayFilter(e, labels)
+	if !ok {
+		return nil, nil
+	}
+	lfs := make([]metricsql.LabelFilter, 0, len(labels))
+	for k, v := range labels {
+		lfs = append(lfs, metricsql.LabelFilter{
+			Label: k,
+			Value: v,
+		})
+	}
+	sort.Slice(lfs, func(i, j int) bool {
+		return lfs[i].Label < lfs[j].Label
+	})
+	r := &recordingRule{
+		group:      group,
+		record:     record,
+		interval:   interval,
+		evalOffset: evalOffset,
+		evalDelay:  evalDelay,
+		since:      int64(fasttime.UnixTimestamp() * 1000),
+		expr:       e,
+		labels:     lfs,
+		mayFilter:  mayFilter,
+	}
+	return r, nil
+}
+
+// key returns a string, which uniquely identifies r.
+func (r *recordingRule) key() string {
+	return fmt.Sprintf("group=%q, record=%q, expr=%q, labels=%v, interval=%d, evalOffset=%d, evalDelay=%d",
+		r.group, r.record, r.expr.AppendString(nil), r.labels, r.interval, r.evalOffset, r.evalDelay)
+}
+
+// getRecordingRuleMayFilter returns mayFilter func for the recording rule with the given expr and labels.
+//
+// false is returned if the rule cannot be used for query rewriting. Only aggregations with `by` modifier are supported,
+// since the set of labels in their results is known in advance. This allows verifying that the rule labels
+// do not override the labels returned from expr, since such results cannot be restored by the rewritten query.
+func getRecordingRuleMayFilter(e metricsql.Expr, labels map[string]string) (func(label string) bool, bool) {
+	ae, ok := e.(*metricsql.AggrFuncExpr)
+	if !ok {
+		return nil, false
+	}
+	name := strings.ToLower(ae.Name)
+	if !recordingRuleAggrFuncs[name] {
+		return nil, false
+	}
+	if ae.Limit > 0 {
+		// The results depend on the order of the selected series.
+		return nil, false
+	}
+	op := strings.ToLower(ae.Modifier.Op)
+	if op != "" && op != "by" {
+		// The results of `without` aggregations may contain arbitrary labels.
+		return nil, false
+	}
+	groupLabels := make(map[string]bool, len(ae.Modifier.Args)+1)
+	for _, label := range ae.Modifier.Args {
+		groupLabels[label] = true
+	}
+	for label := range labels {
+		if groupLabels[label] || (name == "histogram" && label == "vmrange") {
+			// The rule label overrides the label returned from expr.
+			return nil, false
+		}
+	}
+	if len(getMetricExprs(e)) != 1 {
+		// It is unclear which selector must be filtered.
+		return nil, true
+	}
+	mayFilter := func(label string) bool {
+		return groupLabels[label]
+	}
+	return mayFilter, true
+}
+
+// recordingRuleAggrFuncs contains aggregate functions, which drop metric names from the results.
+var recordingRuleAggrFuncs = map[string]bool{
+	"avg":       true,
+	"count":     true,
+	"distinct":  true,
+	"geomean":   true,
+	"group":     true,
+	"histogram": true,
+	"mad":       true,
+	"max":       true,
+	"median":    true,
+	"min":       true,
+	"mode":      true,
+	"quantile":  true,
+	"stddev":    true,
+	"stdvar":    true,
+	"sum":       true,
+	"sum2":      true,
+}
+
+// newExpr returns an expression for reading the series precomputed by r.
+//
+// extraFilters are added to the series selector. Metric name and rule labels are removed from the selected series,
+// so the results match the results of r.expr.
+func (r *recordingRule) newExpr(extraFilters []metricsql.LabelFilter) metricsql.Expr {
+	lfs := make([]metricsql.LabelFilter, 0, 1+len(r.labels)+len(extraFilters))
+	lfs = append(lfs, metricsql.LabelFilter{
+		Label: "__name__",
+		Value: r.record,
+	})
+	lfs = append(lfs, r.labels...)
+	lfs = append(lfs, extraFilters...)
+	me := &metricsql.MetricExpr{
+		LabelFilterss: [][]metricsql.LabelFilter{lfs},
+	}
+	args := []metricsql.Expr{
+		me,
+		&metricsql.StringExpr{S: "__name__"},
+	}
+	for _, lf := range r.labels {
+		args = append(args, &metricsql.StringExpr{S: lf.Label})
+	}
+	return &metricsql.FuncExpr{
+		Name: "label_del",
+		Args: args,
+	}
+}
+
+// recordingRules contains recording rules indexed for fast lookup of the matching rules.
+type recordingRules struct {
+	rules []*recordingRule
+
+	// m maps the top-level expression signature to rules.
+	m map[string][]*recordingRule
+}
+
+func newRecordingRules(rules []*recordingRule) *recordingRules {
+	m := make(map[string][]*recordingRule, len(rules))
+	for _, r := range rules {
+		sig := getExprSignature(r.expr)
+		m[sig] = append(m[sig], r)
+	}
+	return &recordingRules{
+		rules: rules,
+		m:     m,
+	}
+}
+
+// rewriteWithRecordingRules returns e with subexpressions matching recording rules replaced with selectors
+// for the series precomputed by these rules.
+//
+// e isn't modified, since it may be shared via parse cache.
+func rewriteWithRecordingRules(qt *querytracer.Tracer, ec *EvalConfig, e metricsql.Expr) metricsql.Expr {
+	if ec.DisableRecordingRulesRewrite {
+		return e
+	}
+	rrs := recordingRulesGlobal.Load()
+	if rrs == nil || len(rrs.rules) == 0 {
+		return e
+	}
+	tr := recordingRuleTimeRange{
+		start: ec.Start,
+		end:   ec.End,
+		step:  ec.Step,
+	}
+	currentTime := int64(fasttime.UnixTimestamp() * 1000)
+	return rrs.rewrite(qt, e, tr, currentTime)
+}
+
+// recordingRuleTimeRange contains timestamps the expression is evaluated at.
+type recordingRuleTimeRange struct {
+	start int64
+	end   int64
+	step  int64
+}
+
+func (rrs *recordingRules) rewrite(qt *querytracer.Tracer, e metricsql.Expr, tr recordingRuleTimeRange, currentTime int64) metricsql.Expr {
+	if r, extraFilters := rrs.getMatchingRule(e, tr, currentTime); r != nil {
+		recordingRulesRewrites.Inc()
+		eNew := r.newExpr(extraFilters)
+		qt.Printf("replace %s with %s according to recording rule %q from group %q", e.AppendString(nil), eNew.AppendString(nil), r.record, r.group)
+		return eNew
+	}
+	if re, ok := e.(*metricsql.RollupExpr); ok {
+		if re.At != nil {
+			// It is unclear whether the rule results exist at the time specified via `@` modifier.
+			return e
+		}
+		tr = getSubqueryTimeRange(re, tr)
+	}
+	children := getExprChildren(e)
+	var childrenNew []metricsql.Expr
+	for i, child := range children {
+		childNew := rrs.rewrite(qt, child, tr, currentTime)
+		if childNew == child {
+			continue
+		}
+		if childrenNew == nil {
+			childrenNew = append([]metricsql.Expr{}, children...)
+		}
+		childrenNew[i] = childNew
+	}
+	if childrenNew == nil {
+		return e
+	}
+	return exprWithChildren(e, childrenNew)
+}
+
+// getSubqueryTimeRange returns the time range for evaluating re.Expr, when re is evaluated on tr.
+//
+// The returned time range matches the time range used by evalRollupFuncWithSubquery.
+func getSubqueryTimeRange(re *metricsql.RollupExpr, tr recordingRuleTimeRange) recordingRuleTimeRange {
+	step := tr.step
+	if re.Step != nil {
+		if d, err := re.Step.NonNegativeDuration(tr.step); err == nil && d > 0 {
+			step = d
+		}
+	}
+	var window, offset int64
+	if re.Window != nil {
+		if d, err := re.Window.NonNegativeDuration(tr.step); err == nil {
+			window = d
+		}
+	}
+	if re.Offset != nil {
+		offset = re.Offset.Duration(tr.step)
+	}
+	start := tr.start - offset - window - step - maxSilenceInterval()
+	// Take into account the shift applied to rollup_candlestick.
+	end := tr.end - offset + step + tr.step
+	start, end = alignStartEnd(start, end, step)
+	return recordingRuleTimeRange{
+		start: start,
+		end:   end,
+		step:  step,
+	}
+}
+
+// hasResultsFor returns true if r results exist at all the timestamps in tr.
+func (r *recordingRule) hasResultsFor(tr recordingRuleTimeRange, currentTime int64) bool {
+	if tr.step < r.interval || tr.step%r.interval != 0 {
+		// The rule results are missing at some of the requested timestamps.
+		return false
+	}
+	if (tr.start-r.evalOffset)%r.interval != 0 {
+		// The rule results are stored at other timestamps.
+		return false
+	}
+	if tr.start < r.since {
+		// The rule results may be missing before the rule has been loaded.
+		return false
+	}
+	// The rule results for the timestamp t are calculated at t+evalDelay.
+	// The calculation may take up to the interval.
+	return tr.end+r.evalDelay+r.interval <= currentTime
+}
+
+// getMatchingRule returns the rule matching e on the given time range together with extra label filters, which must be applied to the rule results.
+func (rrs *recordingRules) getMatchingRule(e metricsql.Expr, tr recordingRuleTimeRange, currentTime int64) (*recordingRule, []metricsql.LabelFilter) {
+	if _, ok := e.(*metricsql.MetricExpr); ok {
+		return nil, nil
+	}
+	rules := rrs.m[getExprSignature(e)]
+	for _, r := range rules {
+		if !r.hasResultsFor(tr, currentTime) {
+			continue
+		}
+		extraFilters, ok := matchRecordingRuleExpr(nil, e, r.expr)
+		if !ok {
+			continue
+		}
+		if len(extraFilters) > 0 {
+			if r.mayFilter == nil {
+				continue
+			}
+			mayFilter := true
+			for _, lf := range extraFilters {
+				if lf.Label == "__name__" || !r.mayFilter(lf.Label) {
+					mayFilter = false
+					break
+				}
+			}
+			if !mayFilter {
+				continue
+			}
+		}
+		return r, extraFilters
+	}
+	return nil, nil
+}
+
+// matchRecordingRuleExpr returns true if e matches the recording rule expression re.
+//
+// Series selectors in e may contain label filters missing in re. These filters are appended to dst.
+func matchRecordingRuleExpr(dst []metricsql.LabelFilter, e, re metricsql.Expr) ([]metricsql.LabelFilter, bool) {
+	if rme, ok := re.(*metricsql.MetricExpr); ok {
+		me, ok := e.(*metricsql.MetricExpr)
+		if !ok {
+			return dst, false
+		}
+		return matchRecordingRuleSelector(dst, me, rme)
+	}
+	if getExprSignature(e) != getExprSignature(re) {
+		return dst, false
+	}
+	children := getExprChildren(e)
+	rChildren := getExprChildren(re)
+	if len(children) != len(rChildren) {
+		return dst, false
+	}
+	for i := range children {
+		var ok bool
+		dst, ok = matchRecordingRuleExpr(dst, children[i], rChildren[i])
+		if !ok {
+			return dst, false
+		}
+	}
+	return dst, true
+}
+
+func matchRecordingRuleSelector(dst []metricsql.LabelFilter, me, rme *metricsql.MetricExpr) ([]metricsql.LabelFilter, bool) {
+	if len(me.LabelFilterss) != 1 || len(rme.LabelFilterss) != 1 {
+		// Selectors with `or` filters must be identical.
+		ok := string(me.AppendString(nil)) == string(rme.AppendString(nil))
+		return dst, ok
+	}
+	lfs := me.LabelFilterss[0]
+	rlfs := rme.LabelFilterss[0]
+	for _, rlf := range rlfs {
+		if !slicesContainsLabelFilter(lfs, rlf) {
+			return dst, false
+		}
+	}
+	for _, lf := range lfs {
+		if !slicesContainsLabelFilter(rlfs, lf) {
+			dst = append(dst, lf)
+		}
+	}
+	return dst, true
+}
+
+func slicesContainsLabelFilter(lfs []metricsql.LabelFilter, lf metricsql.LabelFilter) bool {
+	for _, x := range lfs {
+		if x == lf {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingRulePlaceholder is used instead of children expressions when calculating expression signature.
+var recordingRulePlaceholder = &metricsql.MetricExpr{
+	LabelFilterss: [][]metricsql.LabelFilter{{{
+		Label: "__name__",
+		Value: "_",
+	}}},
+}
+
+// getExprSignature returns string representation for e with all the children expressions replaced with placeholders.
+func getExprSignature(e metricsql.Expr) string {
+	children := getExprChildren(e)
+	if len(children) == 0 {
+		return string(e.AppendString(nil))
+	}
+	placeholders := make([]metricsql.Expr, len(children))
+	for i := range placeholders {
+		placeholders[i] = recordingRulePlaceholder
+	}
+	return string(exprWithChildren(e, placeholders).AppendString(nil))
+}
+
+func getExprChildren(e metricsql.Expr) []metricsql.Expr {
+	switch t := e.(type) {
+	case *metricsql.RollupExpr:
+		if t.At != nil {
+			return []metricsql.Expr{t.Expr, t.At}
+		}
+		return []metricsql.Expr{t.Expr}
+	case *metricsql.FuncExpr:
+		return t.Args
+	case *metricsql.AggrFuncExpr:
+		return t.Args
+	case *metricsql.BinaryOpExpr:
+		return []metricsql.Expr{t.Left, t.Right}
+	default:
+		return nil
+	}
+}
+
+// exprWithChildren returns a shallow copy of e with the given children.
+func exprWithChildren(e metricsql.Expr, children []metricsql.Expr) metricsql.Expr {
+	switch t := e.(type) {
+	case *metricsql.RollupExpr:
+		re := *t
+		re.Expr = children[0]
+		if t.At != nil {
+			re.At = children[1]
+		}
+		return &re
+	case *metricsql.FuncExpr:
+		fe := *t
+		fe.Args = children
+		return &fe
+	case *metricsql.AggrFuncExpr:
+		ae := *t
+		ae.Args = children
+		return &ae
+	case *metricsql.BinaryOpExpr:
+		be := *t
+		be.Left = children[0]
+		be.Right = children[1]
+		return &be
+	default:
+		logger.Panicf("BUG: unexpected expression with children: %T", e)
+		return nil
+	}
+}
@@ -0,0 +1,282 @@
+package promql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecordingRulesFileFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		_, err := parseRecordingRulesFile([]byte(data), time.Minute, 30*time.Second)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid yaml
+	f(`foobar`)
+
+	// invalid expr
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: bar
+    expr: sum(
+`)
+
+	// invalid interval
+	f(`
+groups:
+- name: foo
+  interval: -1m
+  rules:
+  - record: bar
+    expr: sum(foo)
+`)
+
+	// invalid eval_delay
+	f(`
+groups:
+- name: foo
+  eval_delay: -1m
+  rules:
+  - record: bar
+    expr: sum(foo)
+`)
+}
+
+func TestParseRecordingRulesFileSuccess(t *testing.T) {
+	data := `
+groups:
+- name: group1
+  interval: 30s
+  labels:
+    team: x
+  rules:
+  - record: job:foo:rate5m
+    expr: sum(rate(foo[5m])) by (job)
+  - alert: FooHigh
+    expr: foo > 10
+    for: 5m
+  - record: foo:top
+    expr: topk(3, foo)
+  - record: foo:ratio
+    expr: sum(foo_errors) / sum(foo_total)
+  - record: instance:foo:rate5m
+    expr: rate(foo[5m])
+  - record: foo:sum:without
+    expr: sum(foo) without (instance)
+  - record: foo:sum:limit
+    expr: sum(foo) by (job) limit 10
+  - record: team:foo:sum
+    expr: sum(foo) by (team)
+- name: group2
+  eval_delay: 1m
+  rules:
+  - record: bar:avg
+    expr: avg(bar)
+    labels:
+      env: prod
+  - record: bar:histogram
+    expr: histogram(bar)
+    labels:
+      vmrange: x
+- name: graphite
+  type: graphite
+  rules:
+  - record: baz
+    expr: sumSeries(baz.*)
+- name: extra-label
+  params:
+    extra_label: ["env=dev"]
+  rules:
+  - record: bar:sum
+    expr: sum(bar)
+- name: offset
+  interval: 5m
+  eval_offset: -1m
+  eval_delay: 1m
+  rules:
+  - record: qux:sum
+    expr: sum(qux)
+- name: unaligned
+  eval_alignment: false
+  rules:
+  - record: qux:count
+    expr: count(qux)
+`
+	rules, err := parseRecordingRulesFile([]byte(data), time.Minute, 30*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("unexpected number of rules; got %d; want 3", len(rules))
+	}
+	r := rules[0]
+	if r.group != "group1" || r.record != "job:foo:rate5m" || r.interval != 30e3 || r.evalOffset != 0 || r.evalDelay != 30e3 {
+		t.Fatalf("unexpected rule: group=%q, record=%q, interval=%d, evalOffset=%d, evalDelay=%d", r.group, r.record, r.interval, r.evalOffset, r.evalDelay)
+	}
+	if len(r.labels) != 1 || r.labels[0].Label != "team" || r.labels[0].Value != "x" {
+		t.Fatalf("unexpected labels: %v", r.labels)
+	}
+	r = rules[1]
+	if r.group != "group2" || r.record != "bar:avg" || r.interval != 60e3 || r.evalOffset != 0 || r.evalDelay != 60e3 {
+		t.Fatalf("unexpected rule: group=%q, record=%q, interval=%d, evalOffset=%d, evalDelay=%d", r.group, r.record, r.interval, r.evalOffset, r.evalDelay)
+	}
+	r = rules[2]
+	if r.group != "offset" || r.record != "qux:sum" || r.interval != 300e3 || r.evalOffset != 240e3 || r.evalDelay != 0 {
+		t.Fatalf("unexpected rule: group=%q, record=%q, interval=%d, evalOffset=%d, evalDelay=%d", r.group, r.record, r.interval, r.evalOffset, r.evalDelay)
+	}
+}
+
+func TestParseVMAlertRulesResponse(t *testing.T) {
+	data := `{"status":"success","data":{"groups":[
+{"name":"group1","type":"prometheus","interval":60,"eval_delay":10,"rules":[
+	{"name":"job:foo:rate5m","query":"sum(rate(foo[5m])) by (job)","type":"recording","labels":{"team":"x"}},
+	{"name":"FooHigh","query":"foo > 10","type":"alerting"},
+	{"name":"bad","query":"sum(","type":"recording"}
+]},
+{"name":"group2","type":"prometheus","interval":30,"params":["extra_label=env=dev"],"rules":[
+	{"name":"bar:sum","query":"sum(bar)","type":"recording"}
+]},
+{"name":"group3","type":"prometheus","interval":300,"eval_offset":60,"rules":[
+	{"name":"qux:sum","query":"sum(qux)","type":"recording"}
+]}
+]}}`
+	rules, err := parseVMAlertRulesResponse([]byte(data), 30*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("unexpected number of rules; got %d; want 2", len(rules))
+	}
+	r := rules[0]
+	if r.group != "group1" || r.record != "job:foo:rate5m" || r.interval != 60e3 || r.evalDelay != 10e3 || len(r.labels) != 1 {
+		t.Fatalf("unexpected rule: group=%q, record=%q, interval=%d, evalDelay=%d, labels=%v", r.group, r.record, r.interval, r.evalDelay, r.labels)
+	}
+	r = rules[1]
+	if r.group != "group3" || r.record != "qux:sum" || r.interval != 300e3 || r.evalOffset != 60e3 || r.evalDelay != 0 {
+		t.Fatalf("unexpected rule: group=%q, record=%q, interval=%d, evalOffset=%d, evalDelay=%d", r.group, r.record, r.interval, r.evalOffset, r.evalDelay)
+	}
+
+	if _, err := parseVMAlertRulesResponse([]byte(`foobar`), 30*time.Second); err == nil {
+		t.Fatalf("expecting non-nil error for invalid response")
+	}
+}
+
+func TestRewriteWithRecordingRules(t *testing.T) {
+	data := `
+groups:
+- name: group1
+  interval: 1m
+  rules:
+  - record: job:foo:rate5m
+    expr: sum(rate(foo{env="prod"}[5m])) by (job)
+  - record: job:bar:sum
+    expr: sum(bar) by (job)
+    labels:
+      team: x
+  - record: foo:errors:sum
+    expr: sum(foo_errors) / sum(foo_total)
+- name: group2
+  interval: 5m
+  rules:
+  - record: qux:count
+    expr: count(qux)
+- name: group3
+  interval: 5m
+  eval_offset: 1m
+  rules:
+  - record: qux:sum
+    expr: sum(qux)
+`
+	rules, err := parseRecordingRulesFile([]byte(data), time.Minute, 30*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The rules have been loaded an hour before start.
+	const start = 1800e9
+	for _, r := range rules {
+		r.since = start - 3600e3
+	}
+	rrs := newRecordingRules(rules)
+	currentTime := int64(start + 24*3600e3)
+
+	f := func(q string, start, end, step int64, resultExpected string) {
+		t.Helper()
+
+		e, err := parsePromQLWithCache(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		eOrig := string(e.AppendString(nil))
+		tr := recordingRuleTimeRange{
+			start: start,
+			end:   end,
+			step:  step,
+		}
+		eNew := rrs.rewrite(nil, e, tr, currentTime)
+		result := string(eNew.AppendString(nil))
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q\ngot\n%s\nwant\n%s", q, result, resultExpected)
+		}
+		if s := string(e.AppendString(nil)); s != eOrig {
+			t.Fatalf("the original expression mustn't be modified; got %s; want %s", s, eOrig)
+		}
+	}
+
+	end := int64(start + 3600e3)
+
+	// exact match
+	f(`sum(rate(foo{env="prod"}[5m])) by (job)`, start, end, 60e3, `label_del(job:foo:rate5m, "__name__")`)
+	f(`sum(bar) by (job)`, start, end, 60e3, `label_del(job:bar:sum{team="x"}, "__name__", "team")`)
+
+	// subexpression match
+	f(`sum(rate(foo{env="prod"}[5m])) by (job) > 10`, start, end, 60e3, `label_del(job:foo:rate5m, "__name__") > 10`)
+	f(`max_over_time(sum(rate(foo{env="prod"}[5m])) by (job)[30m:1m])`, start, end, 60e3, `max_over_time(label_del(job:foo:rate5m, "__name__")[30m:1m])`)
+
+	// extra filters on labels preserved by the rule
+	f(`sum(rate(foo{env="prod",job="api"}[5m])) by (job)`, start, end, 60e3, `label_del(job:foo:rate5m{job="api"}, "__name__")`)
+
+	// extra filters on labels missing in the results of the rule
+	f(`sum(rate(foo{env="prod",instance="x"}[5m])) by (job)`, start, end, 60e3, `sum(rate(foo{env="prod",instance="x"}[5m])) by(job)`)
+
+	// rules with non-aggregate expressions aren't used
+	f(`sum(foo_errors) / sum(foo_total)`, start, end, 60e3, `sum(foo_errors) / sum(foo_total)`)
+
+	// missing filter from the rule
+	f(`sum(rate(foo[5m])) by (job)`, start, end, 60e3, `sum(rate(foo[5m])) by(job)`)
+
+	// different window and grouping
+	f(`sum(rate(foo{env="prod"}[10m])) by (job)`, start, end, 60e3, `sum(rate(foo{env="prod"}[10m])) by(job)`)
+	f(`sum(rate(foo{env="prod"}[5m])) by (instance)`, start, end, 60e3, `sum(rate(foo{env="prod"}[5m])) by(instance)`)
+
+	// step smaller than the rule interval
+	f(`count(qux)`, start, end, 60e3, `count(qux)`)
+	f(`count(qux)`, start, end, 300e3, `label_del(qux:count, "__name__")`)
+	f(`max_over_time(count(qux)[30m:5m])`, start, end, 60e3, `max_over_time(label_del(qux:count, "__name__")[30m:5m])`)
+
+	// step isn't divisible by the rule interval
+	f(`count(qux)`, start, end, 450e3, `count(qux)`)
+
+	// timestamps aren't aligned to the rule interval
+	f(`count(qux)`, start+60e3, end, 300e3, `count(qux)`)
+	f(`sum(qux)`, start, end, 300e3, `sum(qux)`)
+	f(`sum(qux)`, start+60e3, end, 300e3, `label_del(qux:sum, "__name__")`)
+
+	// time range before the rule has been loaded
+	f(`count(qux)`, start-2*3600e3, end, 300e3, `count(qux)`)
+	f(`max_over_time(count(qux)[1h:5m])`, start, end, 300e3, `max_over_time(count(qux)[1h:5m])`)
+
+	// time range without the rule results yet
+	f(`count(qux)`, start, currentTime, 300e3, `count(qux)`)
+	f(`count(qux)`, start, currentTime-300e3, 300e3, `count(qux)`)
+	f(`count(qux)`, start, currentTime-600e3, 300e3, `label_del(qux:count, "__name__")`)
+
+	// `@` modifier
+	f(`max_over_time(count(qux)[30m:5m] @ 1800000)`, start, end, 300e3, `max_over_time(count(qux)[30m:5m] @ 1800000)`)
+}
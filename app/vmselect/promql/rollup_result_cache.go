@@ -90,7 +90,9 @@ var (
 )
 
 var rollupResultCacheV = &rollupResultCache{
-	c: workingsetcache.New(1024 * 1024), // This is a cache for testing.
+	c: &memoryRollupResultCache{
+		Cache: workingsetcache.New(1024 * 1024), // This is a cache for testing.
+	},
 }
 var rollupResultCachePath string
 
@@ -119,21 +121,22 @@ var (
 func InitRollupResultCache(cachePath string) {
 	rollupResultCachePath = cachePath
 	startTime := time.Now()
-	cacheSize := getRollupResultCacheSize()
-	var c *workingsetcache.Cache
 	if len(rollupResultCachePath) > 0 {
 		if *resetRollupResultCacheOnStartup {
 			logger.Infof("removing rollupResult cache at %q because -search.resetRollupResultCacheOnStartup command-line flag is set", rollupResultCachePath)
 			fs.MustRemoveDir(rollupResultCachePath)
+			fs.MustRemoveDir(rollupResultCachePath + "Disk")
 		} else {
 			logger.Infof("loading rollupResult cache from %q...", rollupResultCachePath)
 		}
-		c = workingsetcache.Load(rollupResultCachePath, cacheSize)
 		mustLoadRollupResultCacheKeyPrefix(rollupResultCachePath)
 	} else {
-		c = workingsetcache.New(cacheSize)
 		rollupResultCacheKeyPrefix.Store(newRollupResultCacheKeyPrefix())
 	}
+	c := newRollupResultCacheBackend(rollupResultCachePath)
+	if pc, ok := c.(*peersRollupResultCache); ok {
+		pc.syncKeyPrefix()
+	}
 	if *disableCache && len(rollupResultCachePath) > 0 && !*resetRollupResultCacheOnStartup {
 		c.Reset()
 	}
@@ -192,15 +195,14 @@ func InitRollupResultCache(cachePath string) {
 // StopRollupResultCache closes the rollupResult cache.
 func StopRollupResultCache() {
 	if rollupResultCachePath != "" {
-		rollupResultCacheV.c.MustSave(rollupResultCachePath)
 		mustSaveRollupResultCacheKeyPrefix(rollupResultCachePath)
 	}
-	rollupResultCacheV.c.Stop()
+	rollupResultCacheV.c.MustStop()
 	rollupResultCacheV.c = nil
 }
 
 type rollupResultCache struct {
-	c *workingsetcache.Cache
+	c rollupResultCacheBackend
 
 	rollupResultCacheRequests    *metrics.Counter
 	rollupResultCacheFullHits    *metrics.Counter
@@ -214,6 +216,9 @@ type rollupResultCache struct {
 func ResetRollupResultCache() {
 	rollupResultCacheV.rollupResultCacheResets.Inc()
 	rollupResultCacheKeyPrefix.Add(1)
+	if pc, ok := rollupResultCacheV.c.(*peersRollupResultCache); ok {
+		pc.propagateKeyPrefix()
+	}
 	logger.Infof("rollupResult cache has been cleared")
 }
 
@@ -231,10 +236,13 @@ func (rrc *rollupResultCache) GetInstantValues(qt *querytracer.Tracer, expr metr
 
 	bb.B = marshalRollupResultCacheKeyForInstantValues(bb.B[:0], expr, window, step, etfss)
 	tss, ok := rrc.getSeriesFromCache(qt, bb.B)
-	if !ok || len(tss) == 0 {
+	if !ok {
+		return nil
+	}
+	if len(tss[0].Timestamps) != 1 {
+		logInvalidRollupResultCacheEntry("instant values", fmt.Errorf("instant series must contain a single timestamp; got %d timestamps", len(tss[0].Timestamps)))
 		return nil
 	}
-	assertInstantValues(tss)
 	qt.Printf("found %d series for time=%s", len(tss), storage.TimestampToHumanReadableFormat(tss[0].Timestamps[0]))
 	return tss
 }
@@ -280,6 +288,36 @@ func (rrc *rollupResultCache) DeleteInstantValues(qt *querytracer.Tracer, expr m
 	}
 }
 
+// getSeriesCacheStatus returns the status of cached series for the given expr, window and ec without modifying the cache.
+//
+// It is used by Explain.
+func (rrc *rollupResultCache) getSeriesCacheStatus(ec *EvalConfig, expr metricsql.Expr, window int64) string {
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+
+	bb.B = marshalRollupResultCacheKeyForSeries(bb.B[:0], expr, window, ec.Step, ec.CacheTagFilters)
+	metainfoBuf := rrc.c.Get(nil, bb.B)
+	if len(metainfoBuf) == 0 {
+		return explainCacheStatusMiss
+	}
+	var mi rollupResultCacheMetainfo
+	if err := mi.Unmarshal(metainfoBuf); err != nil {
+		logInvalidRollupResultCacheEntry("rollupResultCacheMetainfo", err)
+		return explainCacheStatusMiss
+	}
+	key := mi.GetBestKey(ec.Start, ec.End)
+	if key.prefix == 0 && key.suffix == 0 {
+		return explainCacheStatusMiss
+	}
+	for i := range mi.entries {
+		e := &mi.entries[i]
+		if e.key == key && e.end >= ec.End {
+			return explainCacheStatusFullHit
+		}
+	}
+	return explainCacheStatusPartialHit
+}
+
 func (rrc *rollupResultCache) GetSeries(qt *querytracer.Tracer, ec *EvalConfig, expr metricsql.Expr, window int64) (tss []*timeseries, newStart int64) {
 	if qt.Enabled() {
 		query := string(expr.AppendString(nil))
@@ -300,7 +338,9 @@ func (rrc *rollupResultCache) GetSeries(qt *querytracer.Tracer, ec *EvalConfig,
 	}
 	var mi rollupResultCacheMetainfo
 	if err := mi.Unmarshal(metainfoBuf); err != nil {
-		logger.Panicf("BUG: cannot unmarshal rollupResultCacheMetainfo: %s; it looks like it was improperly saved", err)
+		logInvalidRollupResultCacheEntry("rollupResultCacheMetainfo", err)
+		qt.Printf("cannot unmarshal cache metainfo")
+		return nil, ec.Start
 	}
 	key := mi.GetBestKey(ec.Start, ec.End)
 	if key.prefix == 0 && key.suffix == 0 {
@@ -425,7 +465,9 @@ func (rrc *rollupResultCache) PutSeries(qt *querytracer.Tracer, ec *EvalConfig,
 	var mi rollupResultCacheMetainfo
 	if len(metainfoBuf.B) > 0 {
 		if err := mi.Unmarshal(metainfoBuf.B); err != nil {
-			logger.Panicf("BUG: cannot unmarshal rollupResultCacheMetainfo: %s; it looks like it was improperly saved", err)
+			// Overwrite the invalid metainfo.
+			logInvalidRollupResultCacheEntry("rollupResultCacheMetainfo", err)
+			mi = rollupResultCacheMetainfo{}
 		}
 	}
 	start := timestamps[0]
@@ -477,19 +519,42 @@ func (rrc *rollupResultCache) getSeriesFromCache(qt *querytracer.Tracer, key []b
 	// Decompress into newly allocated byte slice, since tss returned from unmarshalTimeseriesFast
 	// refers to the byte slice, so it cannot be reused.
 	resultBuf, err := encoding.DecompressZSTD(nil, compressedResultBuf.B)
+	resultBufPool.Put(compressedResultBuf)
 	if err != nil {
-		logger.Panicf("BUG: cannot decompress resultBuf from rollupResultCache: %s; it looks like it was improperly saved", err)
+		logInvalidRollupResultCacheEntry("compressed timeseries", err)
+		qt.Printf("cannot decompress the entry")
+		return nil, false
 	}
-	resultBufPool.Put(compressedResultBuf)
 	qt.Printf("unpack the entry into %d bytes", len(resultBuf))
 	tss, err := unmarshalTimeseriesFast(resultBuf)
 	if err != nil {
-		logger.Panicf("BUG: cannot unmarshal timeseries from rollupResultCache: %s; it looks like it was improperly saved", err)
+		logInvalidRollupResultCacheEntry("timeseries", err)
+		qt.Printf("cannot unmarshal the entry")
+		return nil, false
+	}
+	if len(tss) == 0 {
+		// DeleteInstantValues stores empty series list.
+		qt.Printf("the entry contains no series")
+		return nil, false
 	}
 	qt.Printf("unmarshal %d series", len(tss))
 	return tss, true
 }
 
+// logInvalidRollupResultCacheEntry logs the error for the invalid cache entry.
+//
+// Cache entries may be obtained from -search.rollupResultCachePeers or from disk, so they may be corrupted.
+// Invalid entries are treated as cache misses.
+func logInvalidRollupResultCacheEntry(entryType string, err error) {
+	invalidRollupResultCacheEntries.Inc()
+	invalidRollupResultCacheEntryLogger.Warnf("cannot unmarshal %s from rollupResult cache; treating it as cache miss: %s", entryType, err)
+}
+
+var (
+	invalidRollupResultCacheEntries     = metrics.NewCounter(`vm_rollup_result_cache_invalid_entries_total`)
+	invalidRollupResultCacheEntryLogger = logger.WithThrottler("invalidRollupResultCacheEntry", 5*time.Second)
+)
+
 func (rrc *rollupResultCache) putSeriesToCache(qt *querytracer.Tracer, key []byte, step int64, tss []*timeseries) bool {
 	maxMarshaledSize := getRollupResultCacheSize() / 4
 	resultBuf := resultBufPool.Get()
@@ -738,6 +803,10 @@ func (mi *rollupResultCacheMetainfo) Unmarshal(src []byte) error {
 	}
 	entriesLen := int(encoding.UnmarshalUint32(src))
 	src = src[4:]
+	if entriesLen*32 != len(src) {
+		// Protect from excess memory allocations for corrupted data.
+		return fmt.Errorf("cannot unmarshal %d entries from %d bytes; need %d bytes", entriesLen, len(src), entriesLen*32)
+	}
 	mi.entries = slicesutil.SetLength(mi.entries, entriesLen)
 	for i := range entriesLen {
 		tail, err := mi.entries[i].Unmarshal(src)
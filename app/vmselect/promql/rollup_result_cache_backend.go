@@ -0,0 +1,107 @@
+package promql
+
+import (
+	"flag"
+
+	"github.com/VictoriaMetrics/fastcache"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
+)
+
+var (
+	rollupResultCacheType = flag.String("search.rollupResultCacheType", "memory", "The type of storage for rollup result cache. Supported values: "+
+		"memory - the cache is stored in memory and it is saved to -storageDataPath on graceful shutdown; "+
+		"disk - the cache is stored on disk at -storageDataPath with LRU eviction when its size exceeds -search.rollupResultCacheDiskMaxSize. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#rollup-result-cache")
+	rollupResultCacheDiskMaxSize = flagutil.NewBytes("search.rollupResultCacheDiskMaxSize", 4*1024*1024*1024, "The maximum size of rollup result cache on disk "+
+		"when -search.rollupResultCacheType=disk. Least recently used entries are removed when the cache size exceeds this value")
+)
+
+// rollupResultCacheBackend stores rollup result cache entries.
+//
+// Implementations must be safe for concurrent use.
+type rollupResultCacheBackend interface {
+	// Get appends the value for the given key to dst and returns the result.
+	//
+	// It is used for small entries.
+	Get(dst, key []byte) []byte
+
+	// Set stores the given value under the given key.
+	//
+	// It is used for small entries.
+	Set(key, value []byte)
+
+	// GetBig appends the value stored via SetBig for the given key to dst and returns the result.
+	GetBig(dst, key []byte) []byte
+
+	// SetBig stores the given value under the given key.
+	//
+	// The value may exceed 64KB.
+	SetBig(key, value []byte)
+
+	// Reset removes all the entries from the backend.
+	Reset()
+
+	// UpdateStats adds backend stats to fcs.
+	UpdateStats(fcs *fastcache.Stats)
+
+	// MustStop stops the backend and persists its contents if needed.
+	MustStop()
+}
+
+// newRollupResultCacheBackend returns new rollupResultCacheBackend according to -search.rollupResultCacheType and -search.rollupResultCachePeers.
+//
+// If cachePath is empty, then the returned backend isn't persisted.
+func newRollupResultCacheBackend(cachePath string) rollupResultCacheBackend {
+	var c rollupResultCacheBackend
+	switch *rollupResultCacheType {
+	case "memory":
+		c = newMemoryRollupResultCache(cachePath)
+	case "disk":
+		if cachePath == "" {
+			logger.Fatalf("-search.rollupResultCacheType=disk cannot be used without data path")
+		}
+		c = mustOpenDiskRollupResultCache(cachePath+"Disk", rollupResultCacheDiskMaxSize.N)
+	default:
+		logger.Fatalf("unsupported -search.rollupResultCacheType=%q; supported values: memory, disk", *rollupResultCacheType)
+	}
+	if IsRollupResultCachePeersEnabled() {
+		if rollupResultCachePeerAuthKey.Get() == "" {
+			// Peers accept cache entries, which are returned to queries, so unauthenticated access allows cache poisoning.
+			logger.Fatalf("-search.rollupResultCachePeerAuthKey must be set when -search.rollupResultCachePeers is set")
+		}
+		c = newPeersRollupResultCache(c, *rollupResultCachePeers, *rollupResultCacheSelfURL)
+	}
+	return c
+}
+
+// memoryRollupResultCache stores rollup result cache entries in memory.
+type memoryRollupResultCache struct {
+	*workingsetcache.Cache
+
+	// path is the path for saving the cache on MustStop. The cache isn't saved if path is empty.
+	path string
+}
+
+func newMemoryRollupResultCache(path string) *memoryRollupResultCache {
+	cacheSize := getRollupResultCacheSize()
+	var c *workingsetcache.Cache
+	if path != "" {
+		c = workingsetcache.Load(path, cacheSize)
+	} else {
+		c = workingsetcache.New(cacheSize)
+	}
+	return &memoryRollupResultCache{
+		Cache: c,
+		path:  path,
+	}
+}
+
+func (c *memoryRollupResultCache) MustStop() {
+	if c.path != "" {
+		c.MustSave(c.path)
+	}
+	c.Stop()
+}
@@ -0,0 +1,247 @@
+package promql
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+)
+
+func TestDiskRollupResultCache(t *testing.T) {
+	dir := t.TempDir()
+
+	c := mustOpenDiskRollupResultCache(dir, 1000)
+	if v := c.Get(nil, []byte("foo")); len(v) != 0 {
+		t.Fatalf("unexpected value for missing key: %q", v)
+	}
+	c.Set([]byte("foo"), []byte("bar"))
+	c.SetBig([]byte("big"), []byte("baz"))
+	if v := c.Get([]byte("x"), []byte("foo")); string(v) != "xbar" {
+		t.Fatalf("unexpected value; got %q; want %q", v, "xbar")
+	}
+	if v := c.GetBig(nil, []byte("big")); string(v) != "baz" {
+		t.Fatalf("unexpected value; got %q; want %q", v, "baz")
+	}
+
+	// Entries bigger than maxSize must be skipped
+	c.Set([]byte("too-big"), make([]byte, 2000))
+	if v := c.Get(nil, []byte("too-big")); len(v) != 0 {
+		t.Fatalf("unexpected value for too big entry with len=%d", len(v))
+	}
+
+	// The entries must be restored after reopening
+	c.MustStop()
+	c = mustOpenDiskRollupResultCache(dir, 1000)
+	if v := c.Get(nil, []byte("foo")); string(v) != "bar" {
+		t.Fatalf("unexpected value after reopening; got %q; want %q", v, "bar")
+	}
+	var fcs fastcache.Stats
+	c.UpdateStats(&fcs)
+	if fcs.EntriesCount != 2 {
+		t.Fatalf("unexpected number of entries after reopening; got %d; want 2", fcs.EntriesCount)
+	}
+
+	// Least recently used entries must be evicted
+	value := make([]byte, 300)
+	for i := range 5 {
+		key := fmt.Sprintf("key_%d", i)
+		c.Set([]byte(key), value)
+		if v := c.Get(nil, []byte("foo")); string(v) != "bar" {
+			t.Fatalf("unexpected value for frequently accessed entry; got %q; want %q", v, "bar")
+		}
+	}
+	if v := c.Get(nil, []byte("big")); len(v) != 0 {
+		t.Fatalf("least recently used entry must be evicted; got %q", v)
+	}
+	if v := c.Get(nil, []byte("key_0")); len(v) != 0 {
+		t.Fatalf("least recently used entry must be evicted; got len=%d", len(v))
+	}
+	if v := c.Get(nil, []byte("key_4")); len(v) != len(value) {
+		t.Fatalf("unexpected value len for recently added entry; got %d; want %d", len(v), len(value))
+	}
+	fcs = fastcache.Stats{}
+	c.UpdateStats(&fcs)
+	if fcs.BytesSize > 1000 {
+		t.Fatalf("cache size exceeds the limit: %d bytes", fcs.BytesSize)
+	}
+
+	c.Reset()
+	if v := c.Get(nil, []byte("foo")); len(v) != 0 {
+		t.Fatalf("unexpected value after reset: %q", v)
+	}
+	c.MustStop()
+	c = mustOpenDiskRollupResultCache(dir, 1000)
+	fcs = fastcache.Stats{}
+	c.UpdateStats(&fcs)
+	if fcs.EntriesCount != 0 {
+		t.Fatalf("unexpected number of entries after reset; got %d; want 0", fcs.EntriesCount)
+	}
+	c.MustStop()
+}
+
+func TestDiskRollupResultCacheInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	c := mustOpenDiskRollupResultCache(dir, 1000)
+	c.Set([]byte("foo"), []byte("bar"))
+	c.Set([]byte("corrupted"), []byte("value"))
+	c.flushPending()
+
+	// Corrupted file must be treated as a cache miss
+	if err := os.WriteFile(c.getPath(xxhash.Sum64([]byte("corrupted"))), []byte("\xff"), 0644); err != nil {
+		t.Fatalf("cannot corrupt the file: %s", err)
+	}
+	if v := c.Get(nil, []byte("corrupted")); len(v) != 0 {
+		t.Fatalf("unexpected value for corrupted entry: %q", v)
+	}
+
+	// Eviction of the entry with missing file mustn't fail
+	if err := os.Remove(c.getPath(xxhash.Sum64([]byte("foo")))); err != nil {
+		t.Fatalf("cannot remove the file: %s", err)
+	}
+	if v := c.Get(nil, []byte("foo")); len(v) != 0 {
+		t.Fatalf("unexpected value for removed entry: %q", v)
+	}
+	value := make([]byte, 300)
+	for i := range 5 {
+		key := fmt.Sprintf("key_%d", i)
+		c.Set([]byte(key), value)
+	}
+	c.flushPending()
+	if v := c.Get(nil, []byte("key_4")); len(v) != len(value) {
+		t.Fatalf("unexpected value len for recently added entry; got %d; want %d", len(v), len(value))
+	}
+	c.MustStop()
+}
+
+func TestPeersRollupResultCache(t *testing.T) {
+	remote := newMemoryRollupResultCache("")
+	defer remote.MustStop()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveRollupResultCacheRequest(w, r, remote)
+	}))
+	defer srv.Close()
+
+	local := newMemoryRollupResultCache("")
+	c := newPeersRollupResultCache(local, []string{srv.URL}, "")
+	defer c.MustStop()
+
+	// Entries must be sent to the owner
+	c.Set([]byte("foo"), []byte("bar"))
+	c.SetBig([]byte("big"), []byte("baz"))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(remote.Get(nil, []byte("foo"))) == 0 || len(remote.GetBig(nil, []byte("big"))) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("entries weren't sent to the peer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Entries missing locally must be obtained from the owner
+	remote.Set([]byte("remote"), []byte("value"))
+	remote.SetBig([]byte("remote-big"), []byte("big-value"))
+	if v := c.Get(nil, []byte("remote")); string(v) != "value" {
+		t.Fatalf("unexpected value from peer; got %q; want %q", v, "value")
+	}
+	if v := c.GetBig([]byte("x"), []byte("remote-big")); string(v) != "xbig-value" {
+		t.Fatalf("unexpected value from peer; got %q; want %q", v, "xbig-value")
+	}
+	if v := local.Get(nil, []byte("remote")); string(v) != "value" {
+		t.Fatalf("the entry obtained from peer must be stored locally; got %q", v)
+	}
+	if v := c.Get(nil, []byte("missing")); len(v) != 0 {
+		t.Fatalf("unexpected value for missing key: %q", v)
+	}
+
+	// Key prefix must be synced with the peer
+	prefix := rollupResultCacheKeyPrefix.Load()
+	defer rollupResultCacheKeyPrefix.Store(prefix)
+	rollupResultCacheKeyPrefix.Store(10)
+	data, err := doRollupResultCachePeerRequest(c.client, srv.URL, "prefix", nil, encoding.MarshalUint64(nil, 20))
+	if err != nil {
+		t.Fatalf("cannot send key prefix: %s", err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("unexpected response: %q", data)
+	}
+	if n := rollupResultCacheKeyPrefix.Load(); n != 20 {
+		t.Fatalf("unexpected key prefix; got %d; want 20", n)
+	}
+
+	prefixSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(encoding.MarshalUint64(nil, 42))
+	}))
+	defer prefixSrv.Close()
+	cp := newPeersRollupResultCache(local, []string{srv.URL, prefixSrv.URL}, srv.URL)
+	defer func() {
+		close(cp.stopCh)
+		cp.wg.Wait()
+	}()
+	rollupResultCacheKeyPrefix.Store(10)
+	cp.syncKeyPrefix()
+	if n := rollupResultCacheKeyPrefix.Load(); n != 42 {
+		t.Fatalf("unexpected key prefix after sync; got %d; want 42", n)
+	}
+	rollupResultCacheKeyPrefix.Store(50)
+	cp.syncKeyPrefix()
+	if n := rollupResultCacheKeyPrefix.Load(); n != 50 {
+		t.Fatalf("unexpected key prefix after sync; got %d; want 50", n)
+	}
+}
+
+func TestPeersRollupResultCacheUnavailablePeer(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	local := newMemoryRollupResultCache("")
+	c := newPeersRollupResultCache(local, []string{srv.URL}, "")
+	defer c.MustStop()
+
+	errorsBefore := metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_errors_total{type="get"}`).Get()
+	if v := c.Get(nil, []byte("foo")); len(v) != 0 {
+		t.Fatalf("unexpected value from unavailable peer: %q", v)
+	}
+	if n := metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_errors_total{type="get"}`).Get(); n != errorsBefore+1 {
+		t.Fatalf("unexpected number of peer errors; got %d; want %d", n, errorsBefore+1)
+	}
+
+	// The failed peer must be skipped by subsequent lookups
+	skippedBefore := metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_skipped_total{type="get"}`).Get()
+	if v := c.Get(nil, []byte("bar")); len(v) != 0 {
+		t.Fatalf("unexpected value from unavailable peer: %q", v)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("unexpected number of requests to the failed peer; got %d; want 1", n)
+	}
+	if n := metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_skipped_total{type="get"}`).Get(); n != skippedBefore+1 {
+		t.Fatalf("unexpected number of skipped lookups; got %d; want %d", n, skippedBefore+1)
+	}
+
+	// The peer must be requested again after the broken deadline
+	c.brokenDeadlines[0].Store(0)
+	if v := c.Get(nil, []byte("bar")); len(v) != 0 {
+		t.Fatalf("unexpected value from unavailable peer: %q", v)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("unexpected number of requests to the peer after the broken deadline; got %d; want 2", n)
+	}
+
+	// The entry must be available locally when the peer is unavailable
+	c.Set([]byte("foo"), []byte("bar"))
+	if v := c.Get(nil, []byte("foo")); string(v) != "bar" {
+		t.Fatalf("unexpected value; got %q; want %q", v, "bar")
+	}
+}
@@ -0,0 +1,422 @@
+package promql
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// diskRollupResultCache stores rollup result cache entries in files on disk.
+//
+// Every entry is stored in a separate file at <dir>/<first 2 hex digits of key hash>/<key hash in hex>.
+// The file contains the marshaled key followed by the value, so hash collisions are detected on reads.
+// Least recently used entries are removed when the summary size of the stored entries exceeds maxSize.
+//
+// Files are written, removed and touched by a background goroutine, so disk IO doesn't slow down queries.
+// Entries waiting for being written are served from memory.
+type diskRollupResultCache struct {
+	dir     string
+	maxSize int64
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// entries maps key hash to the element at lru.
+	entries map[uint64]*list.Element
+
+	// lru contains *diskRollupResultCacheEntry items ordered from the most recently used to the least recently used.
+	lru *list.List
+
+	// size is the summary size of the stored entries.
+	size int64
+
+	// pending contains marshaled entries, which must be written to disk by the writer goroutine.
+	pending map[uint64][]byte
+
+	// pendingSize is the summary size of pending entries.
+	pendingSize int64
+
+	// pathsToRemove contains paths for evicted entries, which must be removed by the writer goroutine.
+	pathsToRemove []string
+
+	// touched contains hashes for entries accessed since the last update of file modification times.
+	touched map[uint64]struct{}
+
+	writeCh chan struct{}
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+
+	getCalls   atomic.Uint64
+	setCalls   atomic.Uint64
+	misses     atomic.Uint64
+	setDropped *metrics.Counter
+}
+
+// diskRollupResultCacheMaxPendingSize is the maximum summary size of entries waiting for being written to disk.
+//
+// New entries are dropped if the disk cannot keep up with the write rate.
+const diskRollupResultCacheMaxPendingSize = 64 * 1024 * 1024
+
+// diskRollupResultCacheTouchInterval is the interval for updating modification times for the accessed files.
+const diskRollupResultCacheTouchInterval = 10 * time.Second
+
+var diskRollupResultCacheTmpFileNum atomic.Uint64
+
+type diskRollupResultCacheEntry struct {
+	h    uint64
+	size int64
+}
+
+// mustOpenDiskRollupResultCache opens disk-based rollup result cache at the given dir.
+//
+// The entries stored at dir are restored, so the cache remains warm after restarts.
+func mustOpenDiskRollupResultCache(dir string, maxSize int64) *diskRollupResultCache {
+	fs.MustMkdirIfNotExist(dir)
+	c := &diskRollupResultCache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: make(map[uint64]*list.Element),
+		lru:     list.New(),
+		pending: make(map[uint64][]byte),
+		touched: make(map[uint64]struct{}),
+		writeCh: make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+
+		setDropped: metrics.GetOrCreateCounter(`vm_rollup_result_cache_disk_set_dropped_total`),
+	}
+
+	type fileInfo struct {
+		h       uint64
+		size    int64
+		modTime time.Time
+	}
+	var fis []fileInfo
+	for _, de := range fs.MustReadDir(dir) {
+		if !de.IsDir() {
+			continue
+		}
+		subdir := filepath.Join(dir, de.Name())
+		for _, fde := range fs.MustReadDir(subdir) {
+			path := filepath.Join(subdir, fde.Name())
+			if fs.IsTemporaryFileName(path) {
+				// Remove the leftover from unclean shutdown.
+				removeDiskRollupResultCacheFile(path)
+				continue
+			}
+			h, err := strconv.ParseUint(fde.Name(), 16, 64)
+			if err != nil {
+				logger.Warnf("skipping unexpected file %q in rollupResult cache dir", path)
+				continue
+			}
+			fi, err := fde.Info()
+			if err != nil {
+				logger.Warnf("skipping file %q in rollupResult cache dir: %s", path, err)
+				continue
+			}
+			fis = append(fis, fileInfo{
+				h:       h,
+				size:    fi.Size(),
+				modTime: fi.ModTime(),
+			})
+		}
+	}
+
+	// Files are accessed in the order of their modification times, since Get updates it.
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].modTime.Before(fis[j].modTime)
+	})
+	for _, fi := range fis {
+		e := &diskRollupResultCacheEntry{
+			h:    fi.h,
+			size: fi.size,
+		}
+		c.entries[fi.h] = c.lru.PushFront(e)
+		c.size += fi.size
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	pathsToRemove := c.pathsToRemove
+	c.pathsToRemove = nil
+	c.mu.Unlock()
+	for _, path := range pathsToRemove {
+		removeDiskRollupResultCacheFile(path)
+	}
+
+	c.wg.Go(c.runWriter)
+	return c
+}
+
+func (c *diskRollupResultCache) Get(dst, key []byte) []byte {
+	c.getCalls.Add(1)
+
+	h := xxhash.Sum64(key)
+	c.mu.Lock()
+	le := c.entries[h]
+	if le != nil {
+		c.lru.MoveToFront(le)
+		// Update modification time in background, so the entry order is restored after restart.
+		c.touched[h] = struct{}{}
+	}
+	data := c.pending[h]
+	c.mu.Unlock()
+	if le == nil {
+		c.misses.Add(1)
+		return dst
+	}
+
+	if data == nil {
+		var err error
+		data, err = os.ReadFile(c.getPath(h))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Errorf("cannot read rollupResult cache entry: %s", err)
+			}
+			c.misses.Add(1)
+			return dst
+		}
+	}
+	storedKey, n := encoding.UnmarshalBytes(data)
+	if n <= 0 || string(storedKey) != string(key) {
+		// Hash collision or corrupted file.
+		c.misses.Add(1)
+		return dst
+	}
+	return append(dst, data[n:]...)
+}
+
+func (c *diskRollupResultCache) Set(key, value []byte) {
+	c.setCalls.Add(1)
+
+	if int64(len(key)+len(value)) > c.maxSize {
+		return
+	}
+
+	// Allocate new byte slice for the entry, since it is held in pending until the writer goroutine stores it on disk.
+	h := xxhash.Sum64(key)
+	data := encoding.MarshalBytes(nil, key)
+	data = append(data, value...)
+	size := int64(len(data))
+	if size > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	if prev, ok := c.pending[h]; ok {
+		c.pendingSize -= int64(len(prev))
+	} else if c.pendingSize+size > diskRollupResultCacheMaxPendingSize {
+		c.mu.Unlock()
+		c.setDropped.Inc()
+		return
+	}
+	c.pending[h] = data
+	c.pendingSize += size
+
+	if le := c.entries[h]; le != nil {
+		e := le.Value.(*diskRollupResultCacheEntry)
+		c.size += size - e.size
+		e.size = size
+		c.lru.MoveToFront(le)
+	} else {
+		e := &diskRollupResultCacheEntry{
+			h:    h,
+			size: size,
+		}
+		c.entries[h] = c.lru.PushFront(e)
+		c.size += size
+	}
+	c.evictLocked()
+	c.mu.Unlock()
+
+	// Notify the writer goroutine about the new entry.
+	select {
+	case c.writeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *diskRollupResultCache) GetBig(dst, key []byte) []byte {
+	return c.Get(dst, key)
+}
+
+func (c *diskRollupResultCache) SetBig(key, value []byte) {
+	c.Set(key, value)
+}
+
+// evictLocked removes the least recently used entries until the cache size becomes smaller than c.maxSize.
+//
+// Files for the evicted entries are removed by the writer goroutine.
+func (c *diskRollupResultCache) evictLocked() {
+	for c.size > c.maxSize {
+		le := c.lru.Back()
+		e := le.Value.(*diskRollupResultCacheEntry)
+		c.removeEntryLocked(e.h)
+		c.pathsToRemove = append(c.pathsToRemove, c.getPath(e.h))
+	}
+}
+
+func (c *diskRollupResultCache) removeEntryLocked(h uint64) {
+	if le := c.entries[h]; le != nil {
+		e := le.Value.(*diskRollupResultCacheEntry)
+		c.lru.Remove(le)
+		delete(c.entries, h)
+		c.size -= e.size
+	}
+	if data, ok := c.pending[h]; ok {
+		delete(c.pending, h)
+		c.pendingSize -= int64(len(data))
+	}
+	delete(c.touched, h)
+}
+
+func (c *diskRollupResultCache) runWriter() {
+	t := time.NewTicker(diskRollupResultCacheTouchInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stopCh:
+			c.flushPending()
+			c.flushAccessTimes()
+			return
+		case <-c.writeCh:
+			c.flushPending()
+		case <-t.C:
+			c.flushAccessTimes()
+		}
+	}
+}
+
+// flushPending removes files for evicted entries and writes pending entries to disk.
+func (c *diskRollupResultCache) flushPending() {
+	c.mu.Lock()
+	pathsToRemove := c.pathsToRemove
+	c.pathsToRemove = nil
+	pending := make(map[uint64][]byte, len(c.pending))
+	for h, data := range c.pending {
+		pending[h] = data
+	}
+	c.mu.Unlock()
+
+	// Remove files before writing new entries, since an evicted entry may be stored again.
+	for _, path := range pathsToRemove {
+		removeDiskRollupResultCacheFile(path)
+	}
+
+	for h, data := range pending {
+		path := c.getPath(h)
+		err := writeDiskRollupResultCacheFile(path, data)
+
+		c.mu.Lock()
+		current, isPending := c.pending[h]
+		isCurrent := isPending && &current[0] == &data[0]
+		if isCurrent {
+			delete(c.pending, h)
+			c.pendingSize -= int64(len(data))
+		}
+		if err != nil && isCurrent {
+			// Drop the entry, since it cannot be read from disk.
+			c.removeEntryLocked(h)
+		}
+		isOrphan := err == nil && c.entries[h] == nil
+		c.mu.Unlock()
+
+		if err != nil {
+			logger.Errorf("cannot store rollupResult cache entry: %s", err)
+		}
+		if isOrphan {
+			// The entry has been evicted or the cache has been reset while the entry was written.
+			removeDiskRollupResultCacheFile(path)
+		}
+	}
+}
+
+// flushAccessTimes updates modification times for the accessed files, so the entry order is restored after restart.
+func (c *diskRollupResultCache) flushAccessTimes() {
+	c.mu.Lock()
+	touched := c.touched
+	c.touched = make(map[uint64]struct{})
+	c.mu.Unlock()
+
+	now := time.Now()
+	for h := range touched {
+		_ = os.Chtimes(c.getPath(h), now, now)
+	}
+}
+
+// writeDiskRollupResultCacheFile writes data to the file at the given path.
+//
+// Do not use fs.MustWriteAtomic, since the cache entry doesn't need fsync
+// and write errors mustn't stop the process - the entry is just skipped in this case.
+func writeDiskRollupResultCacheFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := fmt.Sprintf("%s.tmp.%d", path, diskRollupResultCacheTmpFileNum.Add(1))
+	err := os.WriteFile(tmpPath, data, 0644)
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
+
+// removeDiskRollupResultCacheFile removes the file at the given path.
+//
+// Missing files are ignored, since they may be already removed by Reset.
+func removeDiskRollupResultCacheFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.Errorf("cannot remove rollupResult cache entry: %s", err)
+	}
+}
+
+func (c *diskRollupResultCache) getPath(h uint64) string {
+	name := fmt.Sprintf("%016x", h)
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+func (c *diskRollupResultCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[uint64]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	c.pending = make(map[uint64][]byte)
+	c.pendingSize = 0
+	c.pathsToRemove = nil
+	c.touched = make(map[uint64]struct{})
+	fs.MustRemoveDirContents(c.dir)
+}
+
+func (c *diskRollupResultCache) UpdateStats(fcs *fastcache.Stats) {
+	fcs.GetCalls += c.getCalls.Load()
+	fcs.SetCalls += c.setCalls.Load()
+	fcs.Misses += c.misses.Load()
+
+	c.mu.Lock()
+	fcs.EntriesCount += uint64(len(c.entries))
+	fcs.BytesSize += uint64(c.size)
+	c.mu.Unlock()
+	fcs.MaxBytesSize += uint64(c.maxSize)
+}
+
+func (c *diskRollupResultCache) MustStop() {
+	// Write the pending entries to disk, so they are available after restart.
+	close(c.stopCh)
+	c.wg.Wait()
+}
@@ -0,0 +1,453 @@
+package promql
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/consistenthash"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	rollupResultCachePeers = flagutil.NewArrayString("search.rollupResultCachePeers", "Optional list of vmselect URLs, which share rollup result cache entries "+
+		"with each other. Every cache entry is owned by a single peer selected via consistent hashing. The list must be identical across all the peers "+
+		"and it may include the current vmselect - see -search.rollupResultCacheSelfURL. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#rollup-result-cache")
+	rollupResultCacheSelfURL = flag.String("search.rollupResultCacheSelfURL", "", "URL of the current vmselect at -search.rollupResultCachePeers list. "+
+		"Cache entries owned by the current vmselect are stored locally without network round-trips")
+	rollupResultCachePeerAuthKey = flagutil.NewPassword("search.rollupResultCachePeerAuthKey", "authKey for accessing rollup result cache "+
+		"via /internal/rollupResultCache/* calls from -search.rollupResultCachePeers. It must be set when -search.rollupResultCachePeers is set. "+
+		"It could be passed via authKey query arg. It overrides -httpAuth.*")
+	rollupResultCachePeerTimeout = flag.Duration("search.rollupResultCachePeerTimeout", 100*time.Millisecond, "Timeout for requests to -search.rollupResultCachePeers. "+
+		"Cache lookups at unavailable peers are treated as cache misses. Peers are skipped for 10 seconds after the failed request")
+)
+
+// peerBrokenDuration is the duration for skipping the peer after the failed request to it.
+//
+// This prevents from slowing down every query on cache misses when the peer is unavailable.
+var peerBrokenDuration = 10 * time.Second
+
+// peersRollupResultCache shares rollup result cache entries among vmselect peers.
+//
+// Every entry is owned by a single peer, which is selected via consistent hashing over the entry key.
+// Entries are stored in the local backend and at the owner, so the owner serves them
+// to other peers, while the local copy saves network round-trips for repeated lookups.
+type peersRollupResultCache struct {
+	local rollupResultCacheBackend
+
+	peers   []string
+	selfIdx int
+	ch      *consistenthash.ConsistentHash
+	client  *http.Client
+
+	// brokenDeadlines contains unix timestamps in seconds per each peer until the peer must be skipped because of failed requests.
+	brokenDeadlines []atomic.Uint64
+
+	setCh  chan *peerSetRequest
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	getRequests *metrics.Counter
+	getErrors   *metrics.Counter
+	getHits     *metrics.Counter
+	getSkipped  *metrics.Counter
+	setRequests *metrics.Counter
+	setErrors   *metrics.Counter
+	setDropped  *metrics.Counter
+}
+
+type peerSetRequest struct {
+	peerIdx int
+	key     []byte
+	value   []byte
+	isBig   bool
+}
+
+func newPeersRollupResultCache(local rollupResultCacheBackend, peers []string, selfURL string) *peersRollupResultCache {
+	peers = append([]string{}, peers...)
+	selfIdx := -1
+	for i, peer := range peers {
+		peer = strings.TrimSuffix(peer, "/")
+		peers[i] = peer
+		if peer == strings.TrimSuffix(selfURL, "/") {
+			selfIdx = i
+		}
+	}
+	if selfURL != "" && selfIdx < 0 {
+		logger.Fatalf("-search.rollupResultCacheSelfURL=%q is missing in -search.rollupResultCachePeers=%q", selfURL, peers)
+	}
+	c := &peersRollupResultCache{
+		local: local,
+
+		peers:   peers,
+		selfIdx: selfIdx,
+		ch:      consistenthash.NewConsistentHash(peers, 0),
+		client: &http.Client{
+			Timeout: *rollupResultCachePeerTimeout,
+		},
+		brokenDeadlines: make([]atomic.Uint64, len(peers)),
+
+		setCh:  make(chan *peerSetRequest, 1024),
+		stopCh: make(chan struct{}),
+
+		getRequests: metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_requests_total{type="get"}`),
+		getErrors:   metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_errors_total{type="get"}`),
+		getHits:     metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_hits_total`),
+		getSkipped:  metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_skipped_total{type="get"}`),
+		setRequests: metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_requests_total{type="set"}`),
+		setErrors:   metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_errors_total{type="set"}`),
+		setDropped:  metrics.GetOrCreateCounter(`vm_rollup_result_cache_peer_set_dropped_total`),
+	}
+	for i := 0; i < 4; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.runSetWorker()
+		}()
+	}
+	return c
+}
+
+// getOwnerIdx returns the index of the peer, which owns the given key.
+//
+// -1 is returned if the key is owned by the current vmselect.
+func (c *peersRollupResultCache) getOwnerIdx(key []byte) int {
+	idx := c.ch.GetNodeIdx(xxhash.Sum64(key), nil)
+	if idx == c.selfIdx {
+		return -1
+	}
+	return idx
+}
+
+// isPeerBroken returns true if the peer with the given index must be skipped because of recently failed requests.
+func (c *peersRollupResultCache) isPeerBroken(peerIdx int) bool {
+	return fasttime.UnixTimestamp() < c.brokenDeadlines[peerIdx].Load()
+}
+
+// markPeerBroken marks the peer with the given index as broken for peerBrokenDuration.
+func (c *peersRollupResultCache) markPeerBroken(peerIdx int) {
+	c.brokenDeadlines[peerIdx].Store(fasttime.UnixTimestamp() + uint64(peerBrokenDuration.Seconds()))
+}
+
+func (c *peersRollupResultCache) Get(dst, key []byte) []byte {
+	return c.get(dst, key, false)
+}
+
+func (c *peersRollupResultCache) GetBig(dst, key []byte) []byte {
+	return c.get(dst, key, true)
+}
+
+func (c *peersRollupResultCache) get(dst, key []byte, isBig bool) []byte {
+	dstLen := len(dst)
+	if isBig {
+		dst = c.local.GetBig(dst, key)
+	} else {
+		dst = c.local.Get(dst, key)
+	}
+	if len(dst) > dstLen {
+		return dst
+	}
+	peerIdx := c.getOwnerIdx(key)
+	if peerIdx < 0 {
+		return dst
+	}
+	if c.isPeerBroken(peerIdx) {
+		c.getSkipped.Inc()
+		return dst
+	}
+
+	c.getRequests.Inc()
+	value, err := c.getFromPeer(peerIdx, key, isBig)
+	if err != nil {
+		c.getErrors.Inc()
+		c.markPeerBroken(peerIdx)
+		logger.Warnf("cannot obtain rollupResult cache entry from peer %q: %s; skipping the peer for %s", c.peers[peerIdx], err, peerBrokenDuration)
+		return dst
+	}
+	if len(value) == 0 {
+		return dst
+	}
+	c.getHits.Inc()
+
+	// Store the entry locally, so subsequent lookups do not need network round-trip.
+	if isBig {
+		c.local.SetBig(key, value)
+	} else {
+		c.local.Set(key, value)
+	}
+	return append(dst, value...)
+}
+
+func (c *peersRollupResultCache) Set(key, value []byte) {
+	c.set(key, value, false)
+}
+
+func (c *peersRollupResultCache) SetBig(key, value []byte) {
+	c.set(key, value, true)
+}
+
+func (c *peersRollupResultCache) set(key, value []byte, isBig bool) {
+	if isBig {
+		c.local.SetBig(key, value)
+	} else {
+		c.local.Set(key, value)
+	}
+	peerIdx := c.getOwnerIdx(key)
+	if peerIdx < 0 {
+		return
+	}
+	if c.isPeerBroken(peerIdx) {
+		// The entry is stored locally anyway.
+		c.setDropped.Inc()
+		return
+	}
+
+	// Send the entry to the owner in background, so the query isn't slowed down by the peer.
+	psr := &peerSetRequest{
+		peerIdx: peerIdx,
+		key:     append([]byte{}, key...),
+		value:   append([]byte{}, value...),
+		isBig:   isBig,
+	}
+	select {
+	case c.setCh <- psr:
+	default:
+		// The peer cannot keep up with the workload. Drop the entry, since it is stored locally anyway.
+		c.setDropped.Inc()
+	}
+}
+
+func (c *peersRollupResultCache) runSetWorker() {
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case psr := <-c.setCh:
+			if c.isPeerBroken(psr.peerIdx) {
+				c.setDropped.Inc()
+				continue
+			}
+			c.setRequests.Inc()
+			if err := c.setAtPeer(psr.peerIdx, psr.key, psr.value, psr.isBig); err != nil {
+				c.setErrors.Inc()
+				c.markPeerBroken(psr.peerIdx)
+				logger.Warnf("cannot store rollupResult cache entry at peer %q: %s; skipping the peer for %s", c.peers[psr.peerIdx], err, peerBrokenDuration)
+			}
+		}
+	}
+}
+
+func (c *peersRollupResultCache) getFromPeer(peerIdx int, key []byte, isBig bool) ([]byte, error) {
+	body := encoding.MarshalBytes(nil, key)
+	return c.doPeerRequest(peerIdx, "get", isBig, body)
+}
+
+func (c *peersRollupResultCache) setAtPeer(peerIdx int, key, value []byte, isBig bool) error {
+	body := encoding.MarshalBytes(nil, key)
+	body = append(body, value...)
+	_, err := c.doPeerRequest(peerIdx, "set", isBig, body)
+	return err
+}
+
+func (c *peersRollupResultCache) doPeerRequest(peerIdx int, action string, isBig bool, body []byte) ([]byte, error) {
+	args := url.Values{}
+	if isBig {
+		args.Set("big", "1")
+	}
+	return doRollupResultCachePeerRequest(c.client, c.peers[peerIdx], action, args, body)
+}
+
+func (c *peersRollupResultCache) Reset() {
+	c.local.Reset()
+}
+
+func (c *peersRollupResultCache) UpdateStats(fcs *fastcache.Stats) {
+	c.local.UpdateStats(fcs)
+}
+
+func (c *peersRollupResultCache) MustStop() {
+	close(c.stopCh)
+	c.wg.Wait()
+	c.local.MustStop()
+}
+
+// syncKeyPrefix sets rollupResultCacheKeyPrefix to the maximum prefix across the current vmselect and its peers,
+// so all the peers use the same cache keys.
+func (c *peersRollupResultCache) syncKeyPrefix() {
+	prefix := rollupResultCacheKeyPrefix.Load()
+	for i, peer := range c.peers {
+		if i == c.selfIdx {
+			continue
+		}
+		data, err := doRollupResultCachePeerRequest(c.client, peer, "prefix", nil, nil)
+		if err != nil {
+			logger.Warnf("cannot obtain rollupResult cache key prefix from peer %q: %s", peer, err)
+			continue
+		}
+		if len(data) != 8 {
+			logger.Warnf("unexpected size of rollupResult cache key prefix from peer %q; got %d bytes; want 8 bytes", peer, len(data))
+			continue
+		}
+		prefix = max(prefix, encoding.UnmarshalUint64(data))
+	}
+	setRollupResultCacheKeyPrefixIfBigger(prefix)
+}
+
+// propagateKeyPrefix sends the current rollupResultCacheKeyPrefix to all the peers.
+//
+// This invalidates the cache at all the peers after ResetRollupResultCache call.
+func (c *peersRollupResultCache) propagateKeyPrefix() {
+	body := encoding.MarshalUint64(nil, rollupResultCacheKeyPrefix.Load())
+	for i, peer := range c.peers {
+		if i == c.selfIdx {
+			continue
+		}
+		go func(peer string) {
+			if _, err := doRollupResultCachePeerRequest(c.client, peer, "prefix", nil, body); err != nil {
+				logger.Warnf("cannot send rollupResult cache key prefix to peer %q: %s", peer, err)
+			}
+		}(peer)
+	}
+}
+
+func setRollupResultCacheKeyPrefixIfBigger(prefix uint64) {
+	for {
+		n := rollupResultCacheKeyPrefix.Load()
+		if n >= prefix || rollupResultCacheKeyPrefix.CompareAndSwap(n, prefix) {
+			return
+		}
+	}
+}
+
+// doRollupResultCachePeerRequest performs the given action at /internal/rollupResultCache/* handler of the given peer.
+//
+// GET request is sent if body is nil. Otherwise POST request is sent.
+func doRollupResultCachePeerRequest(client *http.Client, peer, action string, args url.Values, body []byte) ([]byte, error) {
+	if authKey := rollupResultCachePeerAuthKey.Get(); authKey != "" {
+		if args == nil {
+			args = url.Values{}
+		}
+		args.Set("authKey", authKey)
+	}
+	reqURL := peer + "/internal/rollupResultCache/" + action
+	if len(args) > 0 {
+		reqURL += "?" + args.Encode()
+	}
+	method := http.MethodGet
+	if body != nil {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, reqURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request to %q: %w", reqURL, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response from %q: %w", reqURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code returned from %q: %d; response body: %q", reqURL, resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// IsRollupResultCachePeersEnabled returns true if rollup result cache is shared with -search.rollupResultCachePeers.
+//
+// RollupResultCacheHandler must be registered only if this function returns true.
+func IsRollupResultCachePeersEnabled() bool {
+	return len(*rollupResultCachePeers) > 0
+}
+
+// RollupResultCacheHandler processes /internal/rollupResultCache/* requests from -search.rollupResultCachePeers.
+//
+// The following paths are supported:
+//
+//   - /internal/rollupResultCache/get - returns the locally stored entry for the key from request body.
+//   - /internal/rollupResultCache/set - stores the entry from request body locally.
+//   - /internal/rollupResultCache/prefix - returns the current cache key prefix on GET request
+//     and updates it on POST request.
+func RollupResultCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.CheckAuthFlag(w, r, rollupResultCachePeerAuthKey) {
+		return
+	}
+	c := rollupResultCacheV.c
+	if pc, ok := c.(*peersRollupResultCache); ok {
+		// Serve only the locally stored entries in order to avoid request loops among peers.
+		c = pc.local
+	}
+	serveRollupResultCacheRequest(w, r, c)
+}
+
+func serveRollupResultCacheRequest(w http.ResponseWriter, r *http.Request, c rollupResultCacheBackend) {
+	action := strings.TrimPrefix(r.URL.Path, "/internal/rollupResultCache/")
+	if action == "prefix" {
+		if r.Method == http.MethodPost {
+			data, err := io.ReadAll(r.Body)
+			if err != nil || len(data) != 8 {
+				http.Error(w, fmt.Sprintf("cannot read 8-byte key prefix from request body; read %d bytes; err: %v", len(data), err), http.StatusBadRequest)
+				return
+			}
+			setRollupResultCacheKeyPrefixIfBigger(encoding.UnmarshalUint64(data))
+			return
+		}
+		_, _ = w.Write(encoding.MarshalUint64(nil, rollupResultCacheKeyPrefix.Load()))
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "expecting POST request", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot read request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	key, n := encoding.UnmarshalBytes(data)
+	if n <= 0 {
+		http.Error(w, "cannot unmarshal cache key from request body", http.StatusBadRequest)
+		return
+	}
+	value := data[n:]
+	isBig := r.URL.Query().Get("big") == "1"
+	switch action {
+	case "get":
+		var dst []byte
+		if isBig {
+			dst = c.GetBig(nil, key)
+		} else {
+			dst = c.Get(nil, key)
+		}
+		_, _ = w.Write(dst)
+	case "set":
+		if isBig {
+			c.SetBig(key, value)
+		} else {
+			c.Set(key, value)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unsupported path %q", r.URL.Path), http.StatusNotFound)
+	}
+}
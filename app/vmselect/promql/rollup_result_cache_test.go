@@ -317,6 +317,66 @@ func TestRollupResultCache(t *testing.T) {
 		testTimeseriesEqual(t, tss, tssExpected)
 	})
 
+	// Invalid entries must be treated as cache misses
+	t.Run("invalid-metainfo", func(t *testing.T) {
+		ResetRollupResultCache()
+		key := marshalRollupResultCacheKeyForSeries(nil, fe, window, ec.Step, ec.CacheTagFilters)
+		rollupResultCacheV.c.Set(key, []byte("invalid"))
+		if s := rollupResultCacheV.getSeriesCacheStatus(ec, fe, window); s != explainCacheStatusMiss {
+			t.Fatalf("unexpected cache status; got %q; want %q", s, explainCacheStatusMiss)
+		}
+		tss, newStart := rollupResultCacheV.GetSeries(nil, ec, fe, window)
+		if newStart != ec.Start {
+			t.Fatalf("unexpected newStart; got %d; want %d", newStart, ec.Start)
+		}
+		if len(tss) != 0 {
+			t.Fatalf("got %d timeseries, while expecting zero", len(tss))
+		}
+
+		// The invalid metainfo must be overwritten
+		tss = []*timeseries{
+			{
+				Timestamps: []int64{1000, 1200},
+				Values:     []float64{1, 2},
+			},
+		}
+		rollupResultCacheV.PutSeries(nil, ec, fe, window, tss)
+		tss, newStart = rollupResultCacheV.GetSeries(nil, ec, fe, window)
+		if newStart != 1400 {
+			t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1400)
+		}
+		tssExpected := []*timeseries{
+			{
+				Timestamps: []int64{1000, 1200},
+				Values:     []float64{1, 2},
+			},
+		}
+		testTimeseriesEqual(t, tss, tssExpected)
+	})
+	t.Run("invalid-series", func(t *testing.T) {
+		ResetRollupResultCache()
+		var mi rollupResultCacheMetainfo
+		key := rollupResultCacheKey{
+			prefix: rollupResultCacheKeyPrefix.Load(),
+			suffix: 1,
+		}
+		mi.AddKey(key, 1000, 2000)
+		rollupResultCacheV.c.Set(marshalRollupResultCacheKeyForSeries(nil, fe, window, ec.Step, ec.CacheTagFilters), mi.Marshal(nil))
+		rollupResultCacheV.c.SetBig(key.Marshal(nil), []byte("invalid"))
+		tss, newStart := rollupResultCacheV.GetSeries(nil, ec, fe, window)
+		if newStart != ec.Start {
+			t.Fatalf("unexpected newStart; got %d; want %d", newStart, ec.Start)
+		}
+		if len(tss) != 0 {
+			t.Fatalf("got %d timeseries, while expecting zero", len(tss))
+		}
+
+		instantKey := marshalRollupResultCacheKeyForInstantValues(nil, fe, window, ec.Step, nil)
+		rollupResultCacheV.c.SetBig(instantKey, []byte("invalid"))
+		if tss := rollupResultCacheV.GetInstantValues(nil, fe, window, ec.Step, nil); len(tss) != 0 {
+			t.Fatalf("got %d timeseries, while expecting zero", len(tss))
+		}
+	})
 }
 
 func TestMergeSeries(t *testing.T) {
@@ -133,6 +133,10 @@ func unmarshalTimeseriesFast(src []byte) ([]*timeseries, error) {
 	tssLen := encoding.UnmarshalUint64(src)
 	timestampsLen := encoding.UnmarshalUint64(src[8:])
 	src = src[16:]
+	if tssLen > uint64(len(src)) || timestampsLen > uint64(len(src))/8 {
+		// Protect from excess memory allocations for corrupted data.
+		return nil, fmt.Errorf("cannot unmarshal %d timeseries with %d timestamps from %d bytes", tssLen, timestampsLen, len(src))
+	}
 
 	// Unmarshal timestamps
 	tail, timestamps, err := unmarshalTimestampsFast(src, timestampsLen)
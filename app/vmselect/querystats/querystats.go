@@ -35,7 +35,16 @@ func Enabled() bool {
 // RegisterQuery must be called when the query is finished.
 func RegisterQuery(query string, timeRangeMsecs int64, startTime time.Time, memoryUsage int64) {
 	initOnce.Do(initQueryStats)
-	qsTracker.registerQuery(query, timeRangeMsecs, startTime, memoryUsage)
+	qsTracker.registerQuery(query, timeRangeMsecs, startTime, memoryUsage, false)
+}
+
+// RegisterCanceledQuery registers the query on the given timeRangeMsecs, which has been started at startTime
+// and has been canceled via /api/v1/admin/query/cancel.
+//
+// Canceled queries are registered regardless of -search.queryStats.minQueryDuration and -search.queryStats.minQueryMemoryUsage.
+func RegisterCanceledQuery(query string, timeRangeMsecs int64, startTime time.Time, memoryUsage int64) {
+	initOnce.Do(initQueryStats)
+	qsTracker.registerQuery(query, timeRangeMsecs, startTime, memoryUsage, true)
 }
 
 // WriteJSONQueryStats writes query stats to given writer in json format.
@@ -57,6 +66,7 @@ type queryStatRecord struct {
 	registerTime  time.Time
 	duration      time.Duration
 	memoryUsage   int64
+	canceled      bool
 }
 
 type queryStatKey struct {
@@ -83,13 +93,21 @@ func (qst *queryStatsTracker) writeJSONQueryStats(w io.Writer, topN int, maxLife
 	fmt.Fprintf(w, `"search.queryStats.minQueryDuration":"%s",`, *minQueryDuration)
 	fmt.Fprintf(w, `"search.queryStats.minQueryMemoryUsage":"%s",`, minQueryMemoryUsage)
 	fmt.Fprintf(w, `"topByCount":[`)
-	topByCount := qst.getTopByCount(topN, maxLifetime)
+	topByCount := qst.getTopByCount(topN, maxLifetime, false)
 	for i, r := range topByCount {
 		fmt.Fprintf(w, `{"query":%s,"timeRangeSeconds":%d,"count":%d}`, stringsutil.JSONString(r.query), r.timeRangeSecs, r.count)
 		if i+1 < len(topByCount) {
 			fmt.Fprintf(w, `,`)
 		}
 	}
+	fmt.Fprintf(w, `],"topByCanceledCount":[`)
+	topByCanceledCount := qst.getTopByCount(topN, maxLifetime, true)
+	for i, r := range topByCanceledCount {
+		fmt.Fprintf(w, `{"query":%s,"timeRangeSeconds":%d,"count":%d}`, stringsutil.JSONString(r.query), r.timeRangeSecs, r.count)
+		if i+1 < len(topByCanceledCount) {
+			fmt.Fprintf(w, `,`)
+		}
+	}
 	fmt.Fprintf(w, `],"topByAvgDuration":[`)
 	topByAvgDuration := qst.getTopByAvgDuration(topN, maxLifetime)
 	for i, r := range topByAvgDuration {
@@ -119,14 +137,16 @@ func (qst *queryStatsTracker) writeJSONQueryStats(w io.Writer, topN int, maxLife
 	fmt.Fprintf(w, `]}`)
 }
 
-func (qst *queryStatsTracker) registerQuery(query string, timeRangeMsecs int64, startTime time.Time, memoryUsage int64) {
+func (qst *queryStatsTracker) registerQuery(query string, timeRangeMsecs int64, startTime time.Time, memoryUsage int64, canceled bool) {
 	registerTime := time.Now()
 	duration := registerTime.Sub(startTime)
-	if duration < *minQueryDuration {
-		return
-	}
-	if memoryUsage < int64(minQueryMemoryUsage.IntN()) {
-		return
+	if !canceled {
+		if duration < *minQueryDuration {
+			return
+		}
+		if memoryUsage < int64(minQueryMemoryUsage.IntN()) {
+			return
+		}
 	}
 
 	qst.mu.Lock()
@@ -144,6 +164,7 @@ func (qst *queryStatsTracker) registerQuery(query string, timeRangeMsecs int64,
 	r.registerTime = registerTime
 	r.duration = duration
 	r.memoryUsage = memoryUsage
+	r.canceled = canceled
 }
 
 func (r *queryStatRecord) matches(currentTime time.Time, maxLifetime time.Duration) bool {
@@ -160,11 +181,14 @@ func (r *queryStatRecord) key() queryStatKey {
 	}
 }
 
-func (qst *queryStatsTracker) getTopByCount(topN int, maxLifetime time.Duration) []queryStatByCount {
+func (qst *queryStatsTracker) getTopByCount(topN int, maxLifetime time.Duration, canceledOnly bool) []queryStatByCount {
 	currentTime := time.Now()
 	qst.mu.Lock()
 	m := make(map[queryStatKey]int)
 	for _, r := range qst.a {
+		if canceledOnly && !r.canceled {
+			continue
+		}
 		if r.matches(currentTime, maxLifetime) {
 			k := r.key()
 			m[k] = m[k] + 1
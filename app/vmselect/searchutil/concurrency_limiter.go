@@ -0,0 +1,156 @@
+package searchutil
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+)
+
+// ConcurrencyLimiter limits the number of concurrently executed requests.
+//
+// Requests waiting for a free slot are started in the order of their priority.
+// Requests with the same priority are started in the order of their arrival.
+type ConcurrencyLimiter struct {
+	capacity int
+
+	mu      sync.Mutex
+	current int
+	waiters waitersHeap
+	seq     uint64
+}
+
+// NewConcurrencyLimiter returns new ConcurrencyLimiter, which allows up to capacity concurrent requests.
+func NewConcurrencyLimiter(capacity int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		capacity: capacity,
+	}
+}
+
+// Capacity returns the maximum number of concurrent requests allowed by cl.
+func (cl *ConcurrencyLimiter) Capacity() int {
+	return cl.capacity
+}
+
+// Current returns the number of currently executed requests.
+func (cl *ConcurrencyLimiter) Current() int {
+	cl.mu.Lock()
+	n := cl.current
+	cl.mu.Unlock()
+	return n
+}
+
+// TryAcquire tries acquiring a slot for the request without waiting.
+//
+// It returns false if there are no free slots or if there are other requests waiting for a free slot.
+// Release must be called when the request is finished if TryAcquire returns true.
+func (cl *ConcurrencyLimiter) TryAcquire() bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.current >= cl.capacity || len(cl.waiters) > 0 {
+		return false
+	}
+	cl.current++
+	return true
+}
+
+// Acquire waits for a free slot for the request with the given priority.
+//
+// It returns false if a free slot couldn't be acquired during the timeout or if stopCh is closed.
+// Release must be called when the request is finished if Acquire returns true.
+func (cl *ConcurrencyLimiter) Acquire(priority int, timeout time.Duration, stopCh <-chan struct{}) bool {
+	cl.mu.Lock()
+	if cl.current < cl.capacity && len(cl.waiters) == 0 {
+		cl.current++
+		cl.mu.Unlock()
+		return true
+	}
+	w := &waiter{
+		priority: priority,
+		seq:      cl.seq,
+		readyCh:  make(chan struct{}),
+	}
+	cl.seq++
+	heap.Push(&cl.waiters, w)
+	cl.mu.Unlock()
+
+	t := timerpool.Get(timeout)
+	defer timerpool.Put(t)
+	select {
+	case <-w.readyCh:
+		return true
+	case <-t.C:
+	case <-stopCh:
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if w.index < 0 {
+		// The slot has been already passed to w by Release call.
+		return true
+	}
+	heap.Remove(&cl.waiters, w.index)
+	return false
+}
+
+// Release releases the slot acquired via TryAcquire or Acquire.
+//
+// The slot is passed to the waiting request with the highest priority if any.
+func (cl *ConcurrencyLimiter) Release() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if len(cl.waiters) > 0 {
+		w := heap.Pop(&cl.waiters).(*waiter)
+		close(w.readyCh)
+		return
+	}
+	cl.current--
+}
+
+type waiter struct {
+	priority int
+	seq      uint64
+	readyCh  chan struct{}
+
+	// index is the index of the waiter in waitersHeap. It is set to -1 after the waiter is removed from the heap.
+	index int
+}
+
+type waitersHeap []*waiter
+
+func (wh *waitersHeap) Len() int {
+	return len(*wh)
+}
+
+func (wh *waitersHeap) Less(i, j int) bool {
+	a := *wh
+	if a[i].priority != a[j].priority {
+		return a[i].priority > a[j].priority
+	}
+	return a[i].seq < a[j].seq
+}
+
+func (wh *waitersHeap) Swap(i, j int) {
+	a := *wh
+	a[i], a[j] = a[j], a[i]
+	a[i].index = i
+	a[j].index = j
+}
+
+func (wh *waitersHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*wh)
+	*wh = append(*wh, w)
+}
+
+func (wh *waitersHeap) Pop() any {
+	a := *wh
+	w := a[len(a)-1]
+	a[len(a)-1] = nil
+	w.index = -1
+	*wh = a[:len(a)-1]
+	return w
+}
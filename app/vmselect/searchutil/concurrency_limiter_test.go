@@ -0,0 +1,101 @@
+package searchutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterTryAcquire(t *testing.T) {
+	cl := NewConcurrencyLimiter(2)
+	if !cl.TryAcquire() {
+		t.Fatalf("cannot acquire the first slot")
+	}
+	if !cl.TryAcquire() {
+		t.Fatalf("cannot acquire the second slot")
+	}
+	if cl.TryAcquire() {
+		t.Fatalf("unexpected slot acquired above the capacity")
+	}
+	if n := cl.Current(); n != 2 {
+		t.Fatalf("unexpected number of acquired slots; got %d; want 2", n)
+	}
+	cl.Release()
+	if !cl.TryAcquire() {
+		t.Fatalf("cannot acquire the released slot")
+	}
+	cl.Release()
+	cl.Release()
+	if n := cl.Current(); n != 0 {
+		t.Fatalf("unexpected number of acquired slots; got %d; want 0", n)
+	}
+}
+
+func TestConcurrencyLimiterAcquireTimeout(t *testing.T) {
+	cl := NewConcurrencyLimiter(1)
+	if !cl.TryAcquire() {
+		t.Fatalf("cannot acquire the first slot")
+	}
+	if cl.Acquire(0, 10*time.Millisecond, nil) {
+		t.Fatalf("unexpected slot acquired above the capacity")
+	}
+
+	stopCh := make(chan struct{})
+	close(stopCh)
+	if cl.Acquire(0, time.Hour, stopCh) {
+		t.Fatalf("unexpected slot acquired after stopCh is closed")
+	}
+
+	// The timed out waiters mustn't hold slots
+	cl.Release()
+	if n := cl.Current(); n != 0 {
+		t.Fatalf("unexpected number of acquired slots; got %d; want 0", n)
+	}
+}
+
+func TestConcurrencyLimiterAcquirePriority(t *testing.T) {
+	cl := NewConcurrencyLimiter(1)
+	if !cl.TryAcquire() {
+		t.Fatalf("cannot acquire the first slot")
+	}
+
+	resultCh := make(chan int, 3)
+	startWaiter := func(priority int) {
+		go func() {
+			if !cl.Acquire(priority, time.Hour, nil) {
+				panic("cannot acquire slot")
+			}
+			resultCh <- priority
+			cl.Release()
+		}()
+		// Wait until the waiter is registered
+		for !hasWaiter(cl, priority) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	startWaiter(1)
+	startWaiter(10)
+	startWaiter(5)
+
+	if cl.TryAcquire() {
+		t.Fatalf("unexpected slot acquired while there are waiters")
+	}
+
+	cl.Release()
+	for _, priorityExpected := range []int{10, 5, 1} {
+		priority := <-resultCh
+		if priority != priorityExpected {
+			t.Fatalf("unexpected order of acquired slots; got priority %d; want %d", priority, priorityExpected)
+		}
+	}
+}
+
+func hasWaiter(cl *ConcurrencyLimiter, priority int) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for _, w := range cl.waiters {
+		if w.priority == priority {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,471 @@
+package searchutil
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+)
+
+var quotasConfig = flag.String("search.quotasConfig", "", "Optional path to a file with per-tenant and per-user query quotas. "+
+	"The path can point either to local file or to http url. "+
+	"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#query-quotas . The config is reloaded on SIGHUP signal")
+
+// QuotasConfig represents the config for query quotas, which is read from -search.quotasConfig.
+type QuotasConfig struct {
+	// TenantHeader is the request header with the tenant identity. The tenant is obtained from AccountID and ProjectID headers if it is empty.
+	TenantHeader string `yaml:"tenant_header,omitempty"`
+
+	// UserHeader is the request header with the user identity. It must be set for quotas with `match.user`.
+	//
+	// The header is trusted as is, so it must be set only by a trusted proxy such as vmauth via `headers` option,
+	// which overrides the header value sent by clients.
+	UserHeader string `yaml:"user_header,omitempty"`
+
+	Quotas []QuotaConfig `yaml:"quotas"`
+}
+
+// QuotaConfig represents a single quota in QuotasConfig.
+type QuotaConfig struct {
+	Name  string     `yaml:"name"`
+	Match QuotaMatch `yaml:"match,omitempty"`
+
+	MaxConcurrentQueries int   `yaml:"max_concurrent_queries,omitempty"`
+	MaxSamplesPerMinute  int64 `yaml:"max_samples_per_minute,omitempty"`
+	MaxSeriesPerQuery    int   `yaml:"max_series_per_query,omitempty"`
+	Priority             int   `yaml:"priority,omitempty"`
+}
+
+// QuotaMatch contains conditions for applying the quota to the request.
+//
+// All the non-empty conditions must match. Empty QuotaMatch matches all the requests.
+type QuotaMatch struct {
+	Tenant  string            `yaml:"tenant,omitempty"`
+	User    string            `yaml:"user,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// InitQuotas must be called after flag.Parse and before using GetQuota.
+func InitQuotas() {
+	// Register SIGHUP handler for config re-read just before loadQuotas call.
+	// This guarantees that the config will be re-read if the signal arrives during loadQuotas call.
+	sighupCh := procutil.NewSighupChan()
+
+	qs, err := loadQuotas()
+	if err != nil {
+		logger.Fatalf("cannot load -search.quotasConfig: %s", err)
+	}
+	if len(*quotasConfig) == 0 {
+		return
+	}
+
+	quotasConfigReloads = metrics.NewCounter(`vm_search_quotas_config_reloads_total`)
+	quotasConfigReloadErrors = metrics.NewCounter(`vm_search_quotas_config_reloads_errors_total`)
+	quotasConfigSuccess = metrics.NewGauge(`vm_search_quotas_config_last_reload_successful`, nil)
+	quotasConfigTimestamp = metrics.NewCounter(`vm_search_quotas_config_last_reload_success_timestamp_seconds`)
+
+	quotasGlobal.Store(qs)
+	quotasConfigSuccess.Set(1)
+	quotasConfigTimestamp.Set(fasttime.UnixTimestamp())
+
+	go func() {
+		for range sighupCh {
+			quotasConfigReloads.Inc()
+			logger.Infof("received SIGHUP; reloading -search.quotasConfig=%q...", *quotasConfig)
+			qs, err := loadQuotas()
+			if err != nil {
+				quotasConfigReloadErrors.Inc()
+				quotasConfigSuccess.Set(0)
+				logger.Errorf("cannot load the updated -search.quotasConfig: %s; preserving the previous config", err)
+				continue
+			}
+			quotasGlobal.Store(qs)
+			quotasConfigSuccess.Set(1)
+			quotasConfigTimestamp.Set(fasttime.UnixTimestamp())
+			logger.Infof("successfully reloaded -search.quotasConfig=%q", *quotasConfig)
+		}
+	}()
+}
+
+var (
+	quotasConfigReloads      *metrics.Counter
+	quotasConfigReloadErrors *metrics.Counter
+	quotasConfigSuccess      *metrics.Gauge
+	quotasConfigTimestamp    *metrics.Counter
+)
+
+var quotasGlobal atomic.Pointer[quotas]
+
+// CheckQuotasConfig checks config pointed by -search.quotasConfig
+func CheckQuotasConfig() error {
+	_, err := loadQuotas()
+	return err
+}
+
+func loadQuotas() (*quotas, error) {
+	if len(*quotasConfig) == 0 {
+		return nil, nil
+	}
+	data, err := fscore.ReadFileOrHTTP(*quotasConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", *quotasConfig, err)
+	}
+	data = envtemplate.ReplaceBytes(data)
+	qs, err := parseQuotas(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", *quotasConfig, err)
+	}
+	return qs, nil
+}
+
+type quotas struct {
+	tenantHeader string
+	userHeader   string
+	qs           []*Quota
+}
+
+func parseQuotas(data []byte) (*quotas, error) {
+	var cfg QuotasConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+	qs := &quotas{
+		tenantHeader: cfg.TenantHeader,
+		userHeader:   cfg.UserHeader,
+	}
+	names := make(map[string]struct{}, len(cfg.Quotas))
+	for i := range cfg.Quotas {
+		qc := &cfg.Quotas[i]
+		if qc.Name == "" {
+			return nil, fmt.Errorf("missing `name` for quota #%d", i+1)
+		}
+		if _, ok := names[qc.Name]; ok {
+			return nil, fmt.Errorf("duplicate quota name %q", qc.Name)
+		}
+		names[qc.Name] = struct{}{}
+		if qc.Match.User != "" && qs.userHeader == "" {
+			return nil, fmt.Errorf("quota %q contains `match.user`, so `user_header` must be set to the request header with the user identity; "+
+				"the header must be set only by a trusted proxy such as vmauth", qc.Name)
+		}
+		q, err := newQuota(qc, qs.tenantHeader == "")
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse quota %q: %w", qc.Name, err)
+		}
+		qs.qs = append(qs.qs, q)
+	}
+
+	// Attach the state to quotas only after the whole config is successfully parsed,
+	// so invalid config doesn't affect the currently used quotas.
+	for _, q := range qs.qs {
+		q.state = getQuotaState(q.name, q.maxConcurrentQueries)
+	}
+	return qs, nil
+}
+
+// GetQuota returns the first quota from -search.quotasConfig, which matches r.
+//
+// It returns nil if r doesn't match any quota. All the Quota methods can be called on nil Quota.
+func GetQuota(r *http.Request) *Quota {
+	qs := quotasGlobal.Load()
+	if qs == nil {
+		return nil
+	}
+	var tenant string
+	if qs.tenantHeader != "" {
+		tenant = r.Header.Get(qs.tenantHeader)
+	} else {
+		tenant = getTenantFromHeaders(r.Header)
+	}
+	var user string
+	if qs.userHeader != "" {
+		user = r.Header.Get(qs.userHeader)
+	}
+	for _, q := range qs.qs {
+		if q.matches(r, tenant, user) {
+			return q
+		}
+	}
+	return nil
+}
+
+func getTenantFromHeaders(h http.Header) string {
+	accountID := h.Get("AccountID")
+	projectID := h.Get("ProjectID")
+	if accountID == "" && projectID == "" {
+		return ""
+	}
+	if accountID == "" {
+		accountID = "0"
+	}
+	if projectID == "" {
+		projectID = "0"
+	}
+	return accountID + ":" + projectID
+}
+
+// Quota represents query quota from -search.quotasConfig.
+type Quota struct {
+	name  string
+	match QuotaMatch
+
+	maxConcurrentQueries int
+	maxSamplesPerMinute  int64
+	maxSeriesPerQuery    int
+	priority             int
+
+	// state holds the quota state, which is preserved across config reloads.
+	state *quotaState
+}
+
+func newQuota(qc *QuotaConfig, isTenantFromHeaders bool) (*Quota, error) {
+	if qc.MaxConcurrentQueries < 0 {
+		return nil, fmt.Errorf("`max_concurrent_queries` cannot be negative; got %d", qc.MaxConcurrentQueries)
+	}
+	if qc.MaxSamplesPerMinute < 0 {
+		return nil, fmt.Errorf("`max_samples_per_minute` cannot be negative; got %d", qc.MaxSamplesPerMinute)
+	}
+	if qc.MaxSeriesPerQuery < 0 {
+		return nil, fmt.Errorf("`max_series_per_query` cannot be negative; got %d", qc.MaxSeriesPerQuery)
+	}
+	match := qc.Match
+	if match.Tenant != "" && isTenantFromHeaders {
+		// Normalize tenant, so `12` matches `12:0`.
+		at, err := auth.NewToken(match.Tenant)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `match.tenant`: %w", err)
+		}
+		match.Tenant = fmt.Sprintf("%d:%d", at.AccountID, at.ProjectID)
+	}
+	return &Quota{
+		name:                 qc.Name,
+		match:                match,
+		maxConcurrentQueries: qc.MaxConcurrentQueries,
+		maxSamplesPerMinute:  qc.MaxSamplesPerMinute,
+		maxSeriesPerQuery:    qc.MaxSeriesPerQuery,
+		priority:             qc.Priority,
+	}, nil
+}
+
+func (q *Quota) matches(r *http.Request, tenant, user string) bool {
+	m := &q.match
+	if m.Tenant != "" && m.Tenant != tenant {
+		return false
+	}
+	if m.User != "" && m.User != user {
+		return false
+	}
+	for k, v := range m.Headers {
+		if r.Header.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Name returns q name.
+func (q *Quota) Name() string {
+	if q == nil {
+		return ""
+	}
+	return q.name
+}
+
+// Priority returns q priority for requests waiting for a free slot according to -search.maxConcurrentRequests.
+//
+// Requests with higher priority are started first.
+func (q *Quota) Priority() int {
+	if q == nil {
+		return 0
+	}
+	return q.priority
+}
+
+// MaxSeriesPerQuery returns the limit on the number of series a single query can select, which is set by q.
+//
+// It returns maxSeries if q doesn't set a stricter limit.
+func (q *Quota) MaxSeriesPerQuery(maxSeries int) int {
+	if q == nil || q.maxSeriesPerQuery <= 0 {
+		return maxSeries
+	}
+	if maxSeries <= 0 || q.maxSeriesPerQuery < maxSeries {
+		return q.maxSeriesPerQuery
+	}
+	return maxSeries
+}
+
+// BeginQuery waits until a query can be started according to `max_concurrent_queries` at q.
+//
+// It returns an error with http.StatusTooManyRequests status code if the query cannot be started during maxWait.
+// EndQuery must be called when the query is finished if BeginQuery returns nil.
+func (q *Quota) BeginQuery(r *http.Request, maxWait time.Duration) error {
+	if q == nil {
+		return nil
+	}
+	cl := q.state.cl
+	if cl == nil {
+		return nil
+	}
+	if !cl.Acquire(0, maxWait, r.Context().Done()) {
+		if err := r.Context().Err(); err != nil {
+			return fmt.Errorf("client has canceled the request: %w", err)
+		}
+		q.state.concurrencyLimitTimeout.Inc()
+		return &httpserver.ErrorWithStatusCode{
+			Err: fmt.Errorf("couldn't start executing the request in %.3f seconds, since max_concurrent_queries=%d concurrent requests are executed for quota %q "+
+				"at -search.quotasConfig", maxWait.Seconds(), cl.Capacity(), q.name),
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+	return nil
+}
+
+// EndQuery must be called when the query started via BeginQuery is finished.
+func (q *Quota) EndQuery() {
+	if q == nil {
+		return
+	}
+	if cl := q.state.cl; cl != nil {
+		cl.Release()
+	}
+}
+
+// CheckSamplesRate returns an error with http.StatusTooManyRequests status code
+// if queries for q have scanned more than `max_samples_per_minute` samples during the last minute.
+func (q *Quota) CheckSamplesRate() error {
+	if q == nil || q.maxSamplesPerMinute <= 0 {
+		return nil
+	}
+	n := q.state.samples.get(fasttime.UnixTimestamp())
+	if n <= q.maxSamplesPerMinute {
+		return nil
+	}
+	q.state.samplesLimitReached.Inc()
+	return &httpserver.ErrorWithStatusCode{
+		Err: fmt.Errorf("queries for quota %q have scanned %d samples during the last minute, which exceeds max_samples_per_minute=%d at -search.quotasConfig; "+
+			"try again later", q.name, n, q.maxSamplesPerMinute),
+		StatusCode: http.StatusTooManyRequests,
+	}
+}
+
+// AddSamples registers n samples scanned by a query for q.
+//
+// It returns the same error as CheckSamplesRate if queries for q exceed `max_samples_per_minute` after registering n samples.
+// This allows stopping the query, which scans too many samples, before it finishes.
+func (q *Quota) AddSamples(n int) error {
+	if q == nil || n <= 0 {
+		return nil
+	}
+	q.state.samples.add(int64(n), fasttime.UnixTimestamp())
+	q.state.samplesScanned.Add(n)
+	return q.CheckSamplesRate()
+}
+
+type quotaState struct {
+	// cl is nil if max_concurrent_queries isn't set.
+	cl *ConcurrencyLimiter
+
+	// samples is shared among all the states for the quota with the same name,
+	// so samples registered by the queries started before config reload aren't lost.
+	samples *samplesCounter
+
+	concurrencyLimitTimeout *metrics.Counter
+	samplesLimitReached     *metrics.Counter
+	samplesScanned          *metrics.Counter
+}
+
+var (
+	quotaStatesLock sync.Mutex
+	quotaStates     = make(map[string]*quotaState)
+)
+
+// getQuotaState returns the state for the quota with the given name.
+//
+// The state is shared among config reloads, so the currently executed queries and scanned samples are preserved.
+func getQuotaState(name string, maxConcurrentQueries int) *quotaState {
+	quotaStatesLock.Lock()
+	defer quotaStatesLock.Unlock()
+
+	qs := quotaStates[name]
+	if qs == nil {
+		qs = &quotaState{
+			concurrencyLimitTimeout: metrics.GetOrCreateCounter(fmt.Sprintf(`vm_search_quota_concurrent_limit_timeout_total{quota=%q}`, name)),
+			samplesLimitReached:     metrics.GetOrCreateCounter(fmt.Sprintf(`vm_search_quota_samples_limit_reached_total{quota=%q}`, name)),
+			samplesScanned:          metrics.GetOrCreateCounter(fmt.Sprintf(`vm_search_quota_samples_scanned_total{quota=%q}`, name)),
+			samples:                 &samplesCounter{},
+		}
+		quotaStates[name] = qs
+	}
+	capacity := 0
+	if qs.cl != nil {
+		capacity = qs.cl.Capacity()
+	}
+	if capacity != maxConcurrentQueries {
+		// Create new limiter if max_concurrent_queries has been changed.
+		// The queries started with the previous limiter release their slots to it.
+		// This may result in temporary exceeding the new limit until the currently executed queries are finished.
+		qs = &quotaState{
+			concurrencyLimitTimeout: qs.concurrencyLimitTimeout,
+			samplesLimitReached:     qs.samplesLimitReached,
+			samplesScanned:          qs.samplesScanned,
+			samples:                 qs.samples,
+		}
+		if maxConcurrentQueries > 0 {
+			qs.cl = NewConcurrencyLimiter(maxConcurrentQueries)
+		}
+		quotaStates[name] = qs
+	}
+	return qs
+}
+
+// samplesCounter counts samples over a sliding one-minute window.
+//
+// The sliding window is approximated by the counters for the current and the previous minutes.
+type samplesCounter struct {
+	mu       sync.Mutex
+	minute   uint64
+	current  int64
+	previous int64
+}
+
+func (sc *samplesCounter) add(n int64, currentTime uint64) {
+	sc.mu.Lock()
+	sc.rotateLocked(currentTime)
+	sc.current += n
+	sc.mu.Unlock()
+}
+
+func (sc *samplesCounter) get(currentTime uint64) int64 {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.rotateLocked(currentTime)
+	elapsed := int64(currentTime % 60)
+	return sc.previous*(60-elapsed)/60 + sc.current
+}
+
+func (sc *samplesCounter) rotateLocked(currentTime uint64) {
+	minute := currentTime / 60
+	switch {
+	case minute == sc.minute:
+	case minute == sc.minute+1:
+		sc.previous = sc.current
+		sc.current = 0
+	default:
+		sc.previous = 0
+		sc.current = 0
+	}
+	sc.minute = minute
+}
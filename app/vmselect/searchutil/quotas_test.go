@@ -0,0 +1,270 @@
+package searchutil
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+func TestParseQuotasFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		if _, err := parseQuotas([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error for config\n%s", data)
+		}
+	}
+
+	// unknown field
+	f(`foo: bar`)
+
+	// missing name
+	f(`
+quotas:
+- max_concurrent_queries: 1
+`)
+
+	// duplicate name
+	f(`
+quotas:
+- name: foo
+- name: foo
+`)
+
+	// negative limits
+	f(`
+quotas:
+- name: foo
+  max_concurrent_queries: -1
+`)
+	f(`
+quotas:
+- name: foo
+  max_samples_per_minute: -1
+`)
+	f(`
+quotas:
+- name: foo
+  max_series_per_query: -1
+`)
+
+	// match.user without user_header
+	f(`
+quotas:
+- name: foo
+  match:
+    user: bar
+`)
+
+	// invalid tenant
+	f(`
+quotas:
+- name: foo
+  match:
+    tenant: bar
+`)
+}
+
+func TestGetQuota(t *testing.T) {
+	qs, err := parseQuotas([]byte(`
+user_header: X-Vmauth-User
+quotas:
+- name: tenant-12
+  match:
+    tenant: "12"
+  max_series_per_query: 10
+- name: alice
+  match:
+    user: alice
+  priority: 5
+- name: grafana-team-a
+  match:
+    headers:
+      X-Grafana-Org-Id: "1"
+      X-Team: a
+- name: default
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	quotasGlobal.Store(qs)
+	defer quotasGlobal.Store(nil)
+
+	f := func(headers map[string]string, nameExpected string) {
+		t.Helper()
+		r, err := http.NewRequest(http.MethodGet, "http://localhost/api/v1/query", nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		q := GetQuota(r)
+		if name := q.Name(); name != nameExpected {
+			t.Fatalf("unexpected quota; got %q; want %q", name, nameExpected)
+		}
+	}
+
+	f(nil, "default")
+	f(map[string]string{"AccountID": "12"}, "tenant-12")
+	f(map[string]string{"AccountID": "12", "ProjectID": "0"}, "tenant-12")
+	f(map[string]string{"AccountID": "12", "ProjectID": "1"}, "default")
+	f(map[string]string{"X-Vmauth-User": "alice"}, "alice")
+	f(map[string]string{"X-Vmauth-User": "bob"}, "default")
+	f(map[string]string{"X-Grafana-Org-Id": "1", "X-Team": "a"}, "grafana-team-a")
+	f(map[string]string{"X-Grafana-Org-Id": "1"}, "default")
+
+	// Custom tenant and user headers
+	qs, err = parseQuotas([]byte(`
+tenant_header: X-Scope-OrgID
+user_header: X-User
+quotas:
+- name: tenant-foo
+  match:
+    tenant: foo
+- name: bob
+  match:
+    user: bob
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	quotasGlobal.Store(qs)
+	f(map[string]string{"X-Scope-OrgID": "foo"}, "tenant-foo")
+	f(map[string]string{"X-User": "bob"}, "bob")
+	f(map[string]string{"X-Vmauth-User": "bob"}, "")
+}
+
+func TestQuotaLimits(t *testing.T) {
+	// Reset the state left by the previous runs of the test
+	quotaStatesLock.Lock()
+	delete(quotaStates, "test-quota-limits")
+	quotaStatesLock.Unlock()
+
+	qs, err := parseQuotas([]byte(`
+quotas:
+- name: test-quota-limits
+  max_concurrent_queries: 1
+  max_samples_per_minute: 100
+  max_series_per_query: 10
+  priority: 3
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	q := qs.qs[0]
+
+	if n := q.Priority(); n != 3 {
+		t.Fatalf("unexpected priority; got %d; want 3", n)
+	}
+	f := func(maxSeries, maxSeriesExpected int) {
+		t.Helper()
+		if n := q.MaxSeriesPerQuery(maxSeries); n != maxSeriesExpected {
+			t.Fatalf("unexpected MaxSeriesPerQuery(%d); got %d; want %d", maxSeries, n, maxSeriesExpected)
+		}
+	}
+	f(0, 10)
+	f(5, 5)
+	f(100, 10)
+
+	// max_concurrent_queries
+	r, err := http.NewRequest(http.MethodGet, "http://localhost/api/v1/query", nil)
+	if err != nil {
+		t.Fatalf("cannot create request: %s", err)
+	}
+	if err := q.BeginQuery(r, time.Second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = q.BeginQuery(r, 10*time.Millisecond)
+	checkTooManyRequestsError(t, err)
+	q.EndQuery()
+	if err := q.BeginQuery(r, time.Second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	q.EndQuery()
+
+	// max_samples_per_minute
+	if err := q.CheckSamplesRate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := q.AddSamples(50); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkTooManyRequestsError(t, q.AddSamples(150))
+	checkTooManyRequestsError(t, q.CheckSamplesRate())
+
+	// The state must be preserved after config reload
+	qs, err = parseQuotas([]byte(`
+quotas:
+- name: test-quota-limits
+  max_concurrent_queries: 2
+  max_samples_per_minute: 1000
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	qNew := qs.qs[0]
+	if err := qNew.CheckSamplesRate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Samples registered by queries started before config reload must be visible to the new quota
+	if err := q.AddSamples(1000); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	checkTooManyRequestsError(t, qNew.CheckSamplesRate())
+
+	// nil quota doesn't limit anything
+	var qNil *Quota
+	if err := qNil.BeginQuery(r, time.Second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	qNil.EndQuery()
+	if err := qNil.AddSamples(1e9); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := qNil.CheckSamplesRate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := qNil.MaxSeriesPerQuery(123); n != 123 {
+		t.Fatalf("unexpected MaxSeriesPerQuery; got %d; want 123", n)
+	}
+}
+
+func checkTooManyRequestsError(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	var esc *httpserver.ErrorWithStatusCode
+	if !errors.As(err, &esc) {
+		t.Fatalf("unexpected error type %T: %s", err, err)
+	}
+	if esc.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status code; got %d; want %d", esc.StatusCode, http.StatusTooManyRequests)
+	}
+}
+
+func TestSamplesCounter(t *testing.T) {
+	var sc samplesCounter
+	f := func(currentTime uint64, nExpected int64) {
+		t.Helper()
+		if n := sc.get(currentTime); n != nExpected {
+			t.Fatalf("unexpected number of samples at %d; got %d; want %d", currentTime, n, nExpected)
+		}
+	}
+
+	sc.add(60, 600)
+	sc.add(60, 630)
+	f(630, 120)
+
+	// The previous minute is taken into account proportionally to the remaining part of the sliding window
+	f(660, 120)
+	f(675, 90)
+	f(690, 60)
+
+	// The counters are reset after two minutes without samples
+	f(780, 0)
+}
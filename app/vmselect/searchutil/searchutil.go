@@ -1,6 +1,7 @@
 package searchutil
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -86,6 +87,13 @@ type Deadline struct {
 
 	timeout  time.Duration
 	flagHint string
+
+	// ctx is shared among all the copies of the Deadline, so Cancel call is visible to all of them.
+	//
+	// ctx is passed to the storage search, so it stops the search when the query is canceled.
+	// ctx is nil unless the Deadline is obtained via WithCancel call.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewDeadline returns deadline for the given timeout.
@@ -100,9 +108,43 @@ func NewDeadline(startTime time.Time, timeout time.Duration, flagHint string) De
 	}
 }
 
-// Exceeded returns true if deadline is exceeded.
+// WithCancel returns a copy of d, which can be canceled via Cancel call.
+//
+// The returned Deadline is canceled if d is canceled.
+// Cancel must be called on the returned Deadline when it is no longer needed in order to release the associated resources.
+func (d *Deadline) WithCancel() Deadline {
+	ctx, cancel := context.WithCancel(d.Context())
+	dc := *d
+	dc.ctx = ctx
+	dc.cancel = cancel
+	return dc
+}
+
+// Exceeded returns true if deadline is exceeded or if d has been canceled via Cancel call.
 func (d *Deadline) Exceeded() bool {
-	return fasttime.UnixTimestamp() > d.deadline
+	return fasttime.UnixTimestamp() > d.deadline || d.IsCanceled()
+}
+
+// Cancel cancels d, so Exceeded returns true for d and all its copies.
+//
+// It is no-op if d isn't obtained via WithCancel call.
+func (d *Deadline) Cancel() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// IsCanceled returns true if d has been canceled via Cancel call.
+func (d *Deadline) IsCanceled() bool {
+	return d.ctx != nil && d.ctx.Err() != nil
+}
+
+// Context returns a context, which is canceled when d is canceled via Cancel call.
+func (d *Deadline) Context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
 }
 
 // Deadline returns deadline in unix timestamp seconds.
@@ -114,6 +156,9 @@ func (d *Deadline) Deadline() uint64 {
 func (d *Deadline) String() string {
 	startTime := time.Unix(int64(d.deadline), 0).Add(-d.timeout)
 	elapsed := time.Since(startTime)
+	if d.IsCanceled() {
+		return fmt.Sprintf("the query has been canceled (elapsed %.3f seconds)", elapsed.Seconds())
+	}
 	msg := fmt.Sprintf("%.3f seconds (elapsed %.3f seconds)", d.timeout.Seconds(), elapsed.Seconds())
 	if float64(elapsed)/float64(d.timeout) > 0.9 && d.flagHint != "" {
 		msg += fmt.Sprintf("; the timeout can be adjusted with `%s` command-line flag", d.flagHint)
@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -300,3 +301,54 @@ func TestGetDeadline(t *testing.T) {
 	f(GetDeadlineForStatusRequest(r, start), expDeadline(time.Second))
 	f(GetDeadlineForQuery(r, start), expDeadline(time.Second))
 }
+
+func TestDeadlineCancel(t *testing.T) {
+	dParent := NewDeadline(time.Now(), time.Hour, "")
+
+	// Cancel must be no-op for deadline without WithCancel call
+	dParent.Cancel()
+	if dParent.IsCanceled() {
+		t.Fatalf("unexpected canceled deadline without WithCancel call")
+	}
+
+	d := dParent.WithCancel()
+	if d.Exceeded() {
+		t.Fatalf("unexpected deadline exceeding")
+	}
+
+	// Cancel must be visible to all the copies of the deadline
+	dCopy := d
+	d.Cancel()
+	if !dCopy.IsCanceled() {
+		t.Fatalf("expecting canceled deadline copy")
+	}
+	if !dCopy.Exceeded() {
+		t.Fatalf("expecting exceeded deadline after cancel")
+	}
+	if err := dCopy.Context().Err(); err == nil {
+		t.Fatalf("expecting canceled context for canceled deadline")
+	}
+	if s := dCopy.String(); !strings.Contains(s, "canceled") {
+		t.Fatalf("unexpected string representation for canceled deadline: %q", s)
+	}
+	if dParent.IsCanceled() {
+		t.Fatalf("unexpected canceled parent deadline")
+	}
+
+	// Deadline derived from canceled deadline must be canceled
+	dChild := d.WithCancel()
+	defer dChild.Cancel()
+	if !dChild.IsCanceled() {
+		t.Fatalf("expecting canceled deadline derived from canceled deadline")
+	}
+
+	// Cancel on zero deadline must be no-op
+	var dZero Deadline
+	dZero.Cancel()
+	if dZero.IsCanceled() {
+		t.Fatalf("unexpected canceled zero deadline")
+	}
+	if err := dZero.Context().Err(); err != nil {
+		t.Fatalf("unexpected error for zero deadline context: %s", err)
+	}
+}
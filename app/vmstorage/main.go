@@ -1,6 +1,7 @@
 package vmstorage
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -28,6 +29,13 @@ var (
 	storageDataPath = flag.String("storageDataPath", "victoria-metrics-data", "Path to storage data")
 	retentionPeriod = flagutil.NewRetentionDuration("retentionPeriod", "1M", "Data with timestamps outside the retentionPeriod is automatically deleted. The minimum retentionPeriod is 24h or 1d. "+
 		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention. See also -retentionFilter")
+	retentionFilters = flagutil.NewArrayString("retentionFilter", "Retention filter in the format 'filter:retention'. For example, '{env=\"dev\"}:3d' configures the retention for time series with env=\"dev\" label to 3 days. "+
+		"The retention must not exceed -retentionPeriod. If series matches multiple filters, then the smallest retention is applied. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention-filters")
+	downsamplingPeriods = flagutil.NewArrayString("downsampling.period", "Comma-separated downsampling periods in the format '[filter:]offset:interval'. "+
+		"For example, '30d:10m' instructs to leave a single sample per 10 minutes for samples older than 30 days. The 'offset' must be a multiple of 'interval', "+
+		"and when setting multiple downsampling periods for a single filter, those periods must also be multiples of each other. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#downsampling for details")
 	futureRetention = flagutil.NewRetentionDuration("futureRetention", "2d", "Data with timestamps bigger than now+futureRetention is automatically deleted. "+
 		"The minimum futureRetention is 2 days. See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention")
 	maxBackfillAge = flagutil.NewRetentionDuration("maxBackfillAge", "0", "The maximum allowed age for the ingested samples with historical timestamps. "+
@@ -112,6 +120,9 @@ var (
 
 	metadataStorageSize = flagutil.NewBytes("storage.maxMetadataStorageSize", 0, "Overrides max size for metrics metadata entries in-memory storage. "+
 		"If set to 0 or a negative value, defaults to 1% of allowed memory.")
+	maxExemplars = flag.Int("storage.maxExemplars", 100_000, "The maximum number of the most recently ingested exemplars to keep in memory. "+
+		"Exemplars are returned from /api/v1/query_exemplars. Set to 0 for disabling exemplars storage. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#exemplars")
 )
 
 func DataPath() string {
@@ -121,6 +132,7 @@ func DataPath() string {
 // Init initializes vmstorage.
 func Init(vmselectMaxConcurrentRequests int, vmselectMaxQueueDuration time.Duration, resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 	storage.SetDedupInterval(*minScrapeInterval)
+	mustSetDownsamplingPeriods()
 	storage.SetDataFlushInterval(*inmemoryDataFlushInterval)
 	storage.LegacySetRetentionTimezoneOffset(*retentionTimezoneOffset)
 	storage.SetFreeDiskSpaceLimit(minFreeDiskSpaceBytes.N)
@@ -133,6 +145,7 @@ func Init(vmselectMaxConcurrentRequests int, vmselectMaxQueueDuration time.Durat
 	storage.SetMetricNamesStatsCacheSize(cacheSizeMetricNamesStats.IntN())
 	storage.SetMetricNameCacheSize(cacheSizeStorageMetricName.IntN())
 	storage.SetMetadataStorageSize(metadataStorageSize.IntN())
+	storage.SetMaxExemplars(*maxExemplars)
 	mergeset.SetIndexBlocksCacheSize(cacheSizeIndexDBIndexBlocks.IntN())
 	mergeset.SetDataBlocksCacheSize(cacheSizeIndexDBDataBlocks.IntN())
 	mergeset.SetDataBlocksSparseCacheSize(cacheSizeIndexDBDataBlocksSparse.IntN())
@@ -141,6 +154,7 @@ func Init(vmselectMaxConcurrentRequests int, vmselectMaxQueueDuration time.Durat
 		logger.Fatalf("-retentionPeriod cannot be smaller than a day; got %s. "+
 			"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention", retentionPeriod)
 	}
+	rfs := mustParseRetentionFilters()
 	if futureRetention.Duration() < 2*24*time.Hour {
 		logger.Fatalf("-futureRetention cannot be smaller than 2 days; got %s. "+
 			"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention", futureRetention)
@@ -162,6 +176,7 @@ func Init(vmselectMaxConcurrentRequests int, vmselectMaxQueueDuration time.Durat
 		TrackMetricNamesStats:       *trackMetricNamesStats,
 		IDBPrefillStart:             *idbPrefillStart,
 		LogNewSeries:                *logNewSeries,
+		RetentionFilters:            rfs,
 	}
 	strg := storage.MustOpenStorage(*storageDataPath, opts)
 	vmStorage = newVMStorage(strg, vmselectMaxConcurrentRequests, resetCacheIfNeeded)
@@ -200,6 +215,7 @@ func Init(vmselectMaxConcurrentRequests int, vmselectMaxQueueDuration time.Durat
 	VMSelectAPI = vmStorage
 	GetSearch = vmStorage.GetSearch
 	PutSearch = vmStorage.PutSearch
+	SearchExemplars = vmStorage.SearchExemplars
 	RequestHandler = vmStorage.requestHandler
 	DebugFlush = vmStorage.s.DebugFlush
 }
@@ -212,10 +228,13 @@ var (
 	vmStorage      *VMStorage
 	VMInsertAPI    vminsertapi.API
 	VMSelectAPI    vmselectapi.API
-	GetSearch      func(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline uint64) (*storage.Search, int, error)
+	GetSearch      func(ctx context.Context, qt *querytracer.Tracer, sq *storage.SearchQuery, deadline uint64) (*storage.Search, int, error)
 	PutSearch      func(sr *storage.Search)
 	RequestHandler func(w http.ResponseWriter, r *http.Request) bool
 
+	// SearchExemplars returns exemplars for series matching the given sq.
+	SearchExemplars func(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline uint64) ([]storage.ExemplarsResult, error)
+
 	// TODO(@rtm0): Remove this dependency from vmalert-tool unit tests.
 	DebugFlush func()
 
@@ -484,6 +503,7 @@ func (vms *VMStorage) writeStorageMetrics(w io.Writer) {
 	metrics.WriteCounterUint64(w, `vm_rows_received_by_storage_total`, m.RowsReceivedTotal)
 	metrics.WriteCounterUint64(w, `vm_rows_added_to_storage_total`, m.RowsAddedTotal)
 	metrics.WriteCounterUint64(w, `vm_deduplicated_samples_total{type="merge"}`, m.DedupsDuringMerge)
+	metrics.WriteCounterUint64(w, `vm_downsampled_samples_total{type="merge"}`, m.DownsampledSamplesDuringMerge)
 	metrics.WriteGaugeUint64(w, `vm_snapshots`, m.SnapshotsCount)
 
 	metrics.WriteCounterUint64(w, `vm_rows_ignored_total{reason="big_timestamp"}`, m.TooBigTimestampRows)
@@ -620,6 +640,8 @@ func (vms *VMStorage) writeStorageMetrics(w io.Writer) {
 
 	metrics.WriteGaugeUint64(w, `vm_downsampling_partitions_scheduled`, tm.ScheduledDownsamplingPartitions)
 	metrics.WriteGaugeUint64(w, `vm_downsampling_partitions_scheduled_size_bytes`, tm.ScheduledDownsamplingPartitionsSize)
+	metrics.WriteGaugeUint64(w, `vm_retention_filters_partitions_scheduled`, tm.ScheduledRetentionFiltersPartitions)
+	metrics.WriteGaugeUint64(w, `vm_retention_filters_partitions_scheduled_size_bytes`, tm.ScheduledRetentionFiltersPartitionsSize)
 
 	metrics.WriteGaugeUint64(w, `vm_search_max_unique_timeseries`, uint64(vms.maxUniqueTimeSeriesCalculated))
 
@@ -627,6 +649,10 @@ func (vms *VMStorage) writeStorageMetrics(w io.Writer) {
 	metrics.WriteCounterUint64(w, `vm_metrics_metadata_storage_size_bytes`, m.MetadataStorageCurrentSizeBytes)
 	metrics.WriteCounterUint64(w, `vm_metrics_metadata_storage_max_size_bytes`, m.MetadataStorageMaxSizeBytes)
 
+	metrics.WriteGaugeUint64(w, `vm_exemplars_storage_items`, m.ExemplarsStorageItemsCurrent)
+	metrics.WriteGaugeUint64(w, `vm_exemplars_storage_max_items`, m.ExemplarsStorageMaxItems)
+	metrics.WriteCounterUint64(w, `vm_exemplars_added_total`, m.ExemplarsAddedTotal)
+	metrics.WriteCounterUint64(w, `vm_exemplars_out_of_order_total`, m.ExemplarsOutOfOrderTotal)
 }
 
 func jsonResponseError(w http.ResponseWriter, err error) {
@@ -636,6 +662,41 @@ func jsonResponseError(w http.ResponseWriter, err error) {
 	fmt.Fprintf(w, `{"status":"error","msg":%s}`, stringsutil.JSONString(errStr))
 }
 
+func mustParseRetentionFilters() []*storage.RetentionFilter {
+	var rfs []*storage.RetentionFilter
+	for _, s := range *retentionFilters {
+		rf, err := storage.ParseRetentionFilter(s)
+		if err != nil {
+			logger.Fatalf("cannot parse -retentionFilter: %s", err)
+		}
+		if rf.Retention > retentionPeriod.Duration() {
+			logger.Fatalf("-retentionFilter=%q cannot exceed -retentionPeriod=%s", s, retentionPeriod)
+		}
+		rfs = append(rfs, rf)
+	}
+	if len(rfs) > 0 {
+		logger.Infof("using %d retention filters: %s", len(rfs), strings.Join(*retentionFilters, ", "))
+	}
+	return rfs
+}
+
+func mustSetDownsamplingPeriods() {
+	var dps []*storage.DownsamplingPeriod
+	for _, s := range *downsamplingPeriods {
+		dp, err := storage.ParseDownsamplingPeriod(s)
+		if err != nil {
+			logger.Fatalf("cannot parse -downsampling.period: %s", err)
+		}
+		dps = append(dps, dp)
+	}
+	if err := storage.SetDownsamplingPeriods(dps); err != nil {
+		logger.Fatalf("invalid -downsampling.period: %s", err)
+	}
+	if len(dps) > 0 {
+		logger.Infof("using %d downsampling periods: %s", len(dps), strings.Join(*downsamplingPeriods, ", "))
+	}
+}
+
 func getMaxHourlySeries() int {
 	limit := *maxHourlySeries
 	if limit == -1 || limit > math.MaxInt32 {
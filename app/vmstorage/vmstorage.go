@@ -1,6 +1,7 @@
 package vmstorage
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -154,6 +155,18 @@ func (vms *VMStorage) WriteMetadata(rows []metricsmetadata.Row) error {
 	return nil
 }
 
+// WriteExemplars writes exemplars to storage.
+func (vms *VMStorage) WriteExemplars(rows []storage.ExemplarRow) error {
+	vms.wg.Add(1)
+	defer vms.wg.Done()
+
+	if vms.s.IsReadOnly() {
+		return errReadOnly
+	}
+	vms.s.AddExemplars(rows)
+	return nil
+}
+
 var errReadOnly = errors.New("the storage is in read-only mode; check -storage.minFreeDiskSpaceBytes command-line flag value")
 
 // IsReadOnly returns true is the storage is in read-only mode.
@@ -258,9 +271,11 @@ func (bi *blockIterator) Error() error {
 // This method is not part of the vmselectapi.API and must only be used by
 // vmsingle HTTP handlers.
 //
+// The search is stopped when ctx is canceled.
+//
 // Callers of this method must call PutSearch() once the search instance is not
 // needed anymore.
-func (vms *VMStorage) GetSearch(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline uint64) (*storage.Search, int, error) {
+func (vms *VMStorage) GetSearch(ctx context.Context, qt *querytracer.Tracer, sq *storage.SearchQuery, deadline uint64) (*storage.Search, int, error) {
 	vms.wg.Add(1)
 
 	tr := sq.GetTimeRange()
@@ -272,7 +287,7 @@ func (vms *VMStorage) GetSearch(qt *querytracer.Tracer, sq *storage.SearchQuery,
 	}
 
 	sr := getSearch()
-	maxSeriesCount := sr.Init(qt, vms.s, tfss, tr, sq.MaxMetrics, deadline)
+	maxSeriesCount := sr.InitWithContext(ctx, qt, vms.s, tfss, tr, sq.MaxMetrics, deadline)
 	return sr, maxSeriesCount, nil
 }
 
@@ -326,6 +341,23 @@ func (vms *VMStorage) SearchMetricNames(qt *querytracer.Tracer, sq *storage.Sear
 	return vms.s.SearchMetricNames(qt, tfss, tr, maxMetrics, deadline)
 }
 
+// SearchExemplars returns exemplars for series matching the given sq.
+func (vms *VMStorage) SearchExemplars(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline uint64) ([]storage.ExemplarsResult, error) {
+	vms.wg.Add(1)
+	defer vms.wg.Done()
+
+	tr := sq.GetTimeRange()
+	maxMetrics := vms.getMaxMetrics(sq.MaxMetrics)
+	tfss, err := vms.setupTfss(qt, sq, tr, maxMetrics, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if len(tfss) == 0 {
+		return nil, fmt.Errorf("missing tag filters")
+	}
+	return vms.s.SearchExemplars(qt, tfss, tr, maxMetrics, deadline)
+}
+
 // SearchLabelValues searches for label values for the given labelName, tfss and
 // tr.
 func (vms *VMStorage) LabelValues(qt *querytracer.Tracer, sq *storage.SearchQuery, labelName string, maxLabelValues int, deadline uint64) ([]string, error) {
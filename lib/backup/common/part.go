@@ -41,8 +41,9 @@ type Part struct {
 // key returns a string, which uniquely identifies p.
 func (p *Part) key() string {
 	if strings.HasSuffix(p.Path, "/parts.json") ||
-		strings.HasSuffix(p.Path, "/appliedRetention.txt") {
-		// parts.json and appliedRetention.txt files contents changes over time,
+		strings.HasSuffix(p.Path, "/appliedRetention.txt") ||
+		strings.HasSuffix(p.Path, "/appliedDownsampling.txt") {
+		// parts.json, appliedRetention.txt and appliedDownsampling.txt files contents changes over time,
 		// so it must have an unique key in order to always copy it during
 		// backup, restore and server-side copy.
 		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/5005
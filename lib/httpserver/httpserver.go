@@ -105,6 +105,10 @@ type ServeOptions struct {
 	//
 	// Mostly required by http proxy servers, which performs own authorization and requests routing
 	DisableBuiltinRoutes bool
+	// ConfigureTLS is an optional callback for modifying TLS config for the addr at the given idx if -tls is set.
+	//
+	// For example, it may be used for enabling client certificates verification.
+	ConfigureTLS func(idx int, cfg *tls.Config) error
 }
 
 // Serve starts an http server on the given addrs with the given optional rh.
@@ -143,6 +147,11 @@ func serve(addr string, rh RequestHandler, idx int, opts ServeOptions) {
 		if err != nil {
 			logger.Fatalf("cannot load TLS cert from -tlsCertFile=%q, -tlsKeyFile=%q, -tlsMinVersion=%q, -tlsCipherSuites=%q: %s", certFile, keyFile, minVersion, *tlsCipherSuites, err)
 		}
+		if opts.ConfigureTLS != nil {
+			if err := opts.ConfigureTLS(idx, tc); err != nil {
+				logger.Fatalf("cannot configure TLS for -httpListenAddr=%q: %s", addr, err)
+			}
+		}
 		tlsConfig = tc
 	}
 	ln, err := netutil.NewTCPListener(scheme, addr, useProxyProto, tlsConfig)
@@ -0,0 +1,27 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// SendInfluxError sends err to w in InfluxDB query API response format,
+// and sets HTTP status code to 400 Bad Request when code is not set,
+// see https://docs.influxdata.com/influxdb/v1/tools/api/#query-http-endpoint
+func SendInfluxError(w http.ResponseWriter, r *http.Request, err error) {
+	errStr := err.Error()
+	logHTTPError(r, errStr)
+
+	w.Header().Set("Content-Type", "application/json")
+	statusCode := http.StatusBadRequest
+	var esc *ErrorWithStatusCode
+	if errors.As(err, &esc) {
+		statusCode = esc.StatusCode
+	}
+	w.WriteHeader(statusCode)
+
+	errJSON, _ := json.Marshal(errStr)
+	fmt.Fprintf(w, `{"error":%s}`, errJSON)
+}
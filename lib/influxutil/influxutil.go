@@ -1,6 +1,7 @@
 package influxutil
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
 	"strings"
@@ -8,9 +9,28 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 )
 
+var (
+	// MeasurementFieldSeparator is the separator between measurement and field name in '{measurement}{separator}{field_name}' metric names.
+	MeasurementFieldSeparator = flag.String("influxMeasurementFieldSeparator", "_", "Separator for '{measurement}{separator}{field_name}' metric name when inserted via InfluxDB line protocol")
+
+	// SkipSingleField is set if '{measurement}' is used as metric name for InfluxDB lines with a single field.
+	SkipSingleField = flag.Bool("influxSkipSingleField", false, "Uses '{measurement}' instead of '{measurement}{separator}{field_name}' for metric name if InfluxDB line contains only a single field")
+
+	// SkipMeasurement is set if '{field_name}' is used as metric name.
+	SkipMeasurement = flag.Bool("influxSkipMeasurement", false, "Uses '{field_name}' as a metric name while ignoring '{measurement}' and '-influxMeasurementFieldSeparator'")
+
+	// DBLabel is the label name for the DB name sent over '?db={db_name}' query parameter.
+	DBLabel = flag.String("influxDBLabel", "db", "Default label for the DB name sent over '?db={db_name}' query parameter")
+)
+
 var influxDatabaseNames = flagutil.NewArrayString("influx.databaseNames", "Comma-separated list of database names to return from /query and /influx/query API. "+
 	"This can be needed for accepting data from Telegraf plugins such as https://github.com/fangli/fluent-plugin-influxdb")
 
+// GetDatabaseNames returns database names from -influx.databaseNames command-line flag.
+func GetDatabaseNames() []string {
+	return *influxDatabaseNames
+}
+
 // WriteDatabaseNames writes influxDatabaseNames to w.
 func WriteDatabaseNames(w http.ResponseWriter) {
 	// Emulate fake response for influx query.
@@ -134,6 +134,42 @@ func TestGetServerTLSConfig(t *testing.T) {
 	f("./test.crt", "./test.key", false)
 }
 
+func TestEnableServerMTLS(t *testing.T) {
+	f := func(caFile string, expectErr bool) {
+		t.Helper()
+		var cfg tls.Config
+		err := EnableServerMTLS(&cfg, caFile)
+		if (err != nil) != expectErr {
+			t.Fatalf("expect err: %v, get error: %v", expectErr, err)
+		}
+		if err != nil {
+			return
+		}
+		if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+			t.Fatalf("unexpected ClientAuth; got %v; want %v", cfg.ClientAuth, tls.RequireAndVerifyClientCert)
+		}
+		if (cfg.ClientCAs != nil) != (caFile != "") {
+			t.Fatalf("unexpected ClientCAs for caFile=%q", caFile)
+		}
+	}
+
+	mustCreateFile("test_ca.crt", testCRT)
+	mustCreateFile("test_ca.key", testPK)
+	defer func() {
+		fs.MustRemovePath("test_ca.crt")
+		fs.MustRemovePath("test_ca.key")
+	}()
+
+	// the host system TLS Root CA
+	f("", false)
+	// custom TLS Root CA
+	f("./test_ca.crt", false)
+	// missing CA file
+	f("/a", true)
+	// invalid CA file
+	f("./test_ca.key", true)
+}
+
 const (
 	testCRT = `-----BEGIN CERTIFICATE-----
 MIIDazCCAlOgAwIBAgIUKm1UQfHNrw+b2T+ARui1PJexOpswDQYJKoZIhvcNAQEL
@@ -0,0 +1,287 @@
+package promauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+)
+
+// AzureADConfig represents Azure AD (Microsoft Entra ID) config for obtaining access tokens.
+//
+// Exactly one of ManagedIdentity or WorkloadIdentity must be set.
+type AzureADConfig struct {
+	// Cloud is the name of Azure cloud: AzurePublic, AzureChina or AzureGovernment.
+	//
+	// AzurePublic is used by default.
+	Cloud string `yaml:"cloud,omitempty"`
+
+	// Scope is an optional scope for the requested access token.
+	//
+	// By default, Azure Monitor scope for the given Cloud is used.
+	Scope string `yaml:"scope,omitempty"`
+
+	ManagedIdentity  *AzureManagedIdentityConfig  `yaml:"managed_identity,omitempty"`
+	WorkloadIdentity *AzureWorkloadIdentityConfig `yaml:"workload_identity,omitempty"`
+}
+
+// AzureManagedIdentityConfig represents config for obtaining access tokens via Azure managed identity.
+//
+// See https://learn.microsoft.com/en-us/entra/identity/managed-identities-azure-resources/how-to-use-vm-token
+type AzureManagedIdentityConfig struct {
+	// ClientID is an optional client id of the user-assigned managed identity.
+	//
+	// System-assigned managed identity is used if ClientID is empty.
+	ClientID string `yaml:"client_id,omitempty"`
+}
+
+// AzureWorkloadIdentityConfig represents config for obtaining access tokens via Azure workload identity.
+//
+// See https://azure.github.io/azure-workload-identity/docs/
+type AzureWorkloadIdentityConfig struct {
+	// ClientID is client id of the application. It is read from AZURE_CLIENT_ID env var if empty.
+	ClientID string `yaml:"client_id,omitempty"`
+
+	// TenantID is tenant id of the application. It is read from AZURE_TENANT_ID env var if empty.
+	TenantID string `yaml:"tenant_id,omitempty"`
+
+	// TokenFile is a path to the file with federated token. It is read from AZURE_FEDERATED_TOKEN_FILE env var if empty.
+	TokenFile string `yaml:"token_file,omitempty"`
+}
+
+type azureCloud struct {
+	authorityHost string
+	scope         string
+}
+
+// See https://learn.microsoft.com/en-us/azure/azure-monitor/essentials/prometheus-remote-write-virtual-machines
+var azureClouds = map[string]*azureCloud{
+	"azurepublic": {
+		authorityHost: "https://login.microsoftonline.com",
+		scope:         "https://monitor.azure.com/.default",
+	},
+	"azurechina": {
+		authorityHost: "https://login.chinacloudapi.cn",
+		scope:         "https://monitor.azure.cn/.default",
+	},
+	"azuregovernment": {
+		authorityHost: "https://login.microsoftonline.us",
+		scope:         "https://monitor.azure.us/.default",
+	},
+}
+
+// azureIMDSEndpoint is the endpoint of Azure Instance Metadata Service for obtaining managed identity tokens.
+const azureIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+type azureADConfigInternal struct {
+	scope string
+
+	// authorityHost is used only for workload identity
+	authorityHost string
+
+	managedIdentityClientID string
+
+	workloadIdentityClientID  string
+	workloadIdentityTenantID  string
+	workloadIdentityTokenFile string
+
+	c *http.Client
+}
+
+func (ai *azureADConfigInternal) String() string {
+	if ai.workloadIdentityTokenFile != "" {
+		return fmt.Sprintf("workloadIdentity(clientID=%q, tenantID=%q, tokenFile=%q, authorityHost=%q), scope=%q",
+			ai.workloadIdentityClientID, ai.workloadIdentityTenantID, ai.workloadIdentityTokenFile, ai.authorityHost, ai.scope)
+	}
+	return fmt.Sprintf("managedIdentity(clientID=%q), scope=%q", ai.managedIdentityClientID, ai.scope)
+}
+
+func newAzureADConfigInternal(baseDir string, az *AzureADConfig) (*azureADConfigInternal, error) {
+	cloudName := az.Cloud
+	if cloudName == "" {
+		cloudName = "AzurePublic"
+	}
+	cloud := azureClouds[strings.ToLower(cloudName)]
+	if cloud == nil {
+		return nil, fmt.Errorf("unsupported `cloud: %q`; supported values: AzurePublic, AzureChina, AzureGovernment", cloudName)
+	}
+	ai := &azureADConfigInternal{
+		scope:         cloud.scope,
+		authorityHost: cloud.authorityHost,
+		c: &http.Client{
+			Transport: httputil.NewTransport(false, "vm_azuread_client"),
+			Timeout:   30 * time.Second,
+		},
+	}
+	if az.Scope != "" {
+		ai.scope = az.Scope
+	}
+
+	mi := az.ManagedIdentity
+	wi := az.WorkloadIdentity
+	if mi == nil && wi == nil {
+		return nil, fmt.Errorf("missing `managed_identity` or `workload_identity` section")
+	}
+	if mi != nil && wi != nil {
+		return nil, fmt.Errorf("`managed_identity` and `workload_identity` sections cannot be set simultaneously")
+	}
+	if mi != nil {
+		ai.managedIdentityClientID = mi.ClientID
+		return ai, nil
+	}
+
+	ai.workloadIdentityClientID = getStringOrEnv(wi.ClientID, "AZURE_CLIENT_ID")
+	if ai.workloadIdentityClientID == "" {
+		return nil, fmt.Errorf("missing `client_id` in `workload_identity` section and AZURE_CLIENT_ID env var")
+	}
+	ai.workloadIdentityTenantID = getStringOrEnv(wi.TenantID, "AZURE_TENANT_ID")
+	if ai.workloadIdentityTenantID == "" {
+		return nil, fmt.Errorf("missing `tenant_id` in `workload_identity` section and AZURE_TENANT_ID env var")
+	}
+	tokenFile := getStringOrEnv(wi.TokenFile, "AZURE_FEDERATED_TOKEN_FILE")
+	if tokenFile == "" {
+		return nil, fmt.Errorf("missing `token_file` in `workload_identity` section and AZURE_FEDERATED_TOKEN_FILE env var")
+	}
+	// There is no need in reading tokenFile now, since it may be missing right now.
+	// It is read before every request for the access token, since it is periodically rotated by Kubernetes.
+	ai.workloadIdentityTokenFile = fscore.GetFilepath(baseDir, tokenFile)
+	if s := os.Getenv("AZURE_AUTHORITY_HOST"); s != "" {
+		// AZURE_AUTHORITY_HOST is set by Azure workload identity webhook.
+		ai.authorityHost = s
+	}
+	return ai, nil
+}
+
+func getStringOrEnv(s, envName string) string {
+	if s != "" {
+		return s
+	}
+	return os.Getenv(envName)
+}
+
+// Token implements oauth2.TokenSource interface.
+func (ai *azureADConfigInternal) Token() (*oauth2.Token, error) {
+	req, err := ai.newTokenRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ai.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain access token from %q: %w", req.URL.Redacted(), err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read access token response from %q: %w", req.URL.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d when obtaining access token from %q; response body: %q", resp.StatusCode, req.URL.Redacted(), data)
+	}
+	return parseAzureTokenResponse(data)
+}
+
+func (ai *azureADConfigInternal) newTokenRequest() (*http.Request, error) {
+	if ai.workloadIdentityTokenFile != "" {
+		// See https://learn.microsoft.com/en-us/entra/identity-platform/v2-oauth2-client-creds-grant-flow#third-case-access-token-request-with-a-federated-credential
+		assertion, err := fscore.ReadPasswordFromFileOrHTTP(ai.workloadIdentityTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read federated token from %q: %w", ai.workloadIdentityTokenFile, err)
+		}
+		form := url.Values{
+			"grant_type":            {"client_credentials"},
+			"client_id":             {ai.workloadIdentityClientID},
+			"scope":                 {ai.scope},
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"client_assertion":      {assertion},
+		}
+		tokenURL := strings.TrimSuffix(ai.authorityHost, "/") + "/" + url.PathEscape(ai.workloadIdentityTenantID) + "/oauth2/v2.0/token"
+		req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, fmt.Errorf("cannot create request to %q: %w", tokenURL, err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+
+	// Managed identity accepts resource instead of scope.
+	resource := strings.TrimSuffix(ai.scope, "/.default")
+	endpoint := azureIMDSEndpoint
+	apiVersion := "2018-02-01"
+	// IDENTITY_ENDPOINT and IDENTITY_HEADER env vars are set by Azure App Service and Azure Container Apps.
+	// See https://learn.microsoft.com/en-us/azure/app-service/overview-managed-identity#rest-endpoint-reference
+	identityEndpoint := os.Getenv("IDENTITY_ENDPOINT")
+	identityHeader := os.Getenv("IDENTITY_HEADER")
+	if identityEndpoint != "" {
+		endpoint = identityEndpoint
+		apiVersion = "2019-08-01"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse managed identity endpoint %q: %w", endpoint, err)
+	}
+	q := u.Query()
+	q.Set("api-version", apiVersion)
+	q.Set("resource", resource)
+	if ai.managedIdentityClientID != "" {
+		q.Set("client_id", ai.managedIdentityClientID)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request to %q: %w", endpoint, err)
+	}
+	if identityEndpoint != "" {
+		req.Header.Set("X-IDENTITY-HEADER", identityHeader)
+	} else {
+		req.Header.Set("Metadata", "true")
+	}
+	return req, nil
+}
+
+// azureTokenResponse is a response from Azure token endpoints.
+//
+// expires_in and expires_on may be either strings or numbers depending on the endpoint.
+type azureTokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	ExpiresIn   json.Number `json:"expires_in"`
+	ExpiresOn   json.Number `json:"expires_on"`
+}
+
+func parseAzureTokenResponse(data []byte) (*oauth2.Token, error) {
+	var tr azureTokenResponse
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, fmt.Errorf("cannot parse access token response %q: %w", data, err)
+	}
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("missing access_token in the response %q", data)
+	}
+	t := &oauth2.Token{
+		AccessToken: tr.AccessToken,
+		TokenType:   tr.TokenType,
+	}
+	if tr.ExpiresIn != "" {
+		n, err := strconv.ParseInt(tr.ExpiresIn.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse expires_in=%q in access token response: %w", tr.ExpiresIn, err)
+		}
+		t.Expiry = time.Now().Add(time.Duration(n) * time.Second)
+	} else if tr.ExpiresOn != "" {
+		n, err := strconv.ParseInt(tr.ExpiresOn.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse expires_on=%q in access token response: %w", tr.ExpiresOn, err)
+		}
+		t.Expiry = time.Unix(n, 0)
+	}
+	return t, nil
+}
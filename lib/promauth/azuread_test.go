@@ -0,0 +1,176 @@
+package promauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestAzureADManagedIdentity(t *testing.T) {
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if h := r.Header.Get("X-IDENTITY-HEADER"); h != "secret-header" {
+			t.Errorf("unexpected X-IDENTITY-HEADER; got %q; want %q", h, "secret-header")
+		}
+		q := r.URL.Query()
+		if resource := q.Get("resource"); resource != "https://monitor.azure.com" {
+			t.Errorf("unexpected resource; got %q; want %q", resource, "https://monitor.azure.com")
+		}
+		if clientID := q.Get("client_id"); clientID != "some-client-id" {
+			t.Errorf("unexpected client_id; got %q; want %q", clientID, "some-client-id")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"mi-token","token_type":"Bearer","expires_on":"` + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + `"}`))
+	}))
+	defer ts.Close()
+
+	t.Setenv("IDENTITY_ENDPOINT", ts.URL)
+	t.Setenv("IDENTITY_HEADER", "secret-header")
+
+	cfg := mustNewConfigFromYAML(t, `
+azuread:
+  managed_identity:
+    client_id: some-client-id
+`)
+	for i := 0; i < 3; i++ {
+		ah, err := cfg.GetAuthHeader()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ah != "Bearer mi-token" {
+			t.Fatalf("unexpected auth header; got %q; want %q", ah, "Bearer mi-token")
+		}
+	}
+	// The token must be cached until it expires.
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("unexpected number of token requests; got %d; want 1", n)
+	}
+}
+
+func TestAzureADWorkloadIdentity(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("federated-token"), 0o600); err != nil {
+		t.Fatalf("cannot write token file: %s", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/some-tenant/oauth2/v2.0/token" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		expected := map[string]string{
+			"grant_type":            "client_credentials",
+			"client_id":             "some-client-id",
+			"scope":                 "https://prometheus.monitor.azure.com/.default",
+			"client_assertion_type": "urn:ietf:params:oauth:client-assertion-type:jwt-bearer",
+			"client_assertion":      "federated-token",
+		}
+		for k, v := range expected {
+			if got := r.PostForm.Get(k); got != v {
+				t.Errorf("unexpected %s; got %q; want %q", k, got, v)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"wi-token","token_type":"Bearer","expires_in":3599}`))
+	}))
+	defer ts.Close()
+
+	t.Setenv("AZURE_AUTHORITY_HOST", ts.URL)
+	t.Setenv("AZURE_CLIENT_ID", "some-client-id")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+
+	cfg := mustNewConfigFromYAML(t, `
+azuread:
+  scope: https://prometheus.monitor.azure.com/.default
+  workload_identity:
+    tenant_id: some-tenant
+`)
+	ah, err := cfg.GetAuthHeader()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ah != "Bearer wi-token" {
+		t.Fatalf("unexpected auth header; got %q; want %q", ah, "Bearer wi-token")
+	}
+}
+
+func TestAzureADWorkloadIdentityFailure(t *testing.T) {
+	t.Setenv("AZURE_CLIENT_ID", "")
+	t.Setenv("AZURE_TENANT_ID", "")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+
+	f := func(yamlConfig string) {
+		t.Helper()
+
+		var hcc HTTPClientConfig
+		if err := yaml.UnmarshalStrict([]byte(yamlConfig), &hcc); err != nil {
+			t.Fatalf("cannot parse: %s", err)
+		}
+		if _, err := hcc.NewConfig(""); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// missing client_id
+	f(`
+azuread:
+  workload_identity:
+    tenant_id: foo
+    token_file: testdata/test_secretfile.txt
+`)
+
+	// missing tenant_id
+	f(`
+azuread:
+  workload_identity:
+    client_id: foo
+    token_file: testdata/test_secretfile.txt
+`)
+
+	// missing token_file
+	f(`
+azuread:
+  workload_identity:
+    client_id: foo
+    tenant_id: bar
+`)
+}
+
+func TestParseAzureTokenResponseFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		if _, err := parseAzureTokenResponse([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f(`foobar`)
+	f(`{}`)
+	f(`{"access_token":"foo","expires_in":"bar"}`)
+	f(`{"access_token":"foo","expires_on":"1.5"}`)
+}
+
+func mustNewConfigFromYAML(t *testing.T, yamlConfig string) *Config {
+	t.Helper()
+
+	var hcc HTTPClientConfig
+	if err := yaml.UnmarshalStrict([]byte(yamlConfig), &hcc); err != nil {
+		t.Fatalf("cannot parse: %s", err)
+	}
+	cfg, err := hcc.NewConfig("")
+	if err != nil {
+		t.Fatalf("cannot initialize config: %s", err)
+	}
+	return cfg
+}
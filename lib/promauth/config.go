@@ -20,6 +20,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/secretprovider"
 )
 
 // Secret represents a string secret such as password or auth token.
@@ -67,6 +68,17 @@ func (s *Secret) String() string {
 	return s.S
 }
 
+// parseSecretRef returns a reference to external secret if s is in the form secret://<provider>/<path>#<key>.
+//
+// nil is returned if s isn't a secret reference.
+// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#secret-references
+func parseSecretRef(s string) (*secretprovider.Ref, error) {
+	if !secretprovider.IsRef(s) {
+		return nil, nil
+	}
+	return secretprovider.ParseRef(s)
+}
+
 // TLSConfig represents TLS config.
 //
 // See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#tls_config
@@ -108,6 +120,8 @@ type HTTPClientConfig struct {
 	BearerToken     *Secret          `yaml:"bearer_token,omitempty"`
 	BearerTokenFile string           `yaml:"bearer_token_file,omitempty"`
 	OAuth2          *OAuth2Config    `yaml:"oauth2,omitempty"`
+	AzureAD         *AzureADConfig   `yaml:"azuread,omitempty"`
+	GoogleIAM       *GoogleIAMConfig `yaml:"google_iam,omitempty"`
 	TLSConfig       *TLSConfig       `yaml:"tls_config,omitempty"`
 
 	// Headers contains optional HTTP headers, which must be sent in the request to the server
@@ -171,6 +185,7 @@ type oauth2ConfigInternal struct {
 	mu               sync.Mutex
 	cfg              *clientcredentials.Config
 	clientSecretFile string
+	clientSecretRef  *secretprovider.Ref
 
 	// ac contains auth config needed for initializing tls config
 	ac *Config
@@ -185,8 +200,12 @@ type oauth2ConfigInternal struct {
 }
 
 func (oi *oauth2ConfigInternal) String() string {
-	return fmt.Sprintf("clientID=%q, clientSecret=%q, clientSecretFile=%q, scopes=%q, endpointParams=%q, tokenURL=%q, proxyURL=%q, tokenURLHeaders=%q, tlsConfig={%s}",
-		oi.cfg.ClientID, oi.cfg.ClientSecret, oi.clientSecretFile, oi.cfg.Scopes, oi.cfg.EndpointParams, oi.cfg.TokenURL, oi.proxyURL, oi.tokenURLHeaders, oi.ac.String())
+	clientSecretRef := ""
+	if oi.clientSecretRef != nil {
+		clientSecretRef = oi.clientSecretRef.String()
+	}
+	return fmt.Sprintf("clientID=%q, clientSecret=%q, clientSecretFile=%q, clientSecretRef=%q, scopes=%q, endpointParams=%q, tokenURL=%q, proxyURL=%q, tokenURLHeaders=%q, tlsConfig={%s}",
+		oi.cfg.ClientID, oi.cfg.ClientSecret, oi.clientSecretFile, clientSecretRef, oi.cfg.Scopes, oi.cfg.EndpointParams, oi.cfg.TokenURL, oi.proxyURL, oi.tokenURLHeaders, oi.ac.String())
 }
 
 func newOAuth2ConfigInternal(baseDir string, o *OAuth2Config) (*oauth2ConfigInternal, error) {
@@ -207,6 +226,15 @@ func newOAuth2ConfigInternal(baseDir string, o *OAuth2Config) (*oauth2ConfigInte
 		// There is no need in reading oi.clientSecretFile now, since it may be missing right now.
 		// It is read later before performing oauth2 request to server.
 	}
+	clientSecretRef, err := parseSecretRef(oi.cfg.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `client_secret`: %w", err)
+	}
+	if clientSecretRef != nil {
+		oi.clientSecretRef = clientSecretRef
+		// The secret is obtained later before performing oauth2 request to server.
+		oi.cfg.ClientSecret = ""
+	}
 	opts := &Options{
 		BaseDir:   baseDir,
 		TLSConfig: o.TLSConfig,
@@ -305,13 +333,23 @@ func (oi *oauth2ConfigInternal) getTokenSource() (oauth2.TokenSource, error) {
 		}
 	}
 
-	if oi.clientSecretFile == "" {
+	var newSecret string
+	switch {
+	case oi.clientSecretFile != "":
+		s, err := fscore.ReadPasswordFromFileOrHTTP(oi.clientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read OAuth2 secret from %q: %w", oi.clientSecretFile, err)
+		}
+		newSecret = s
+	case oi.clientSecretRef != nil:
+		s, err := oi.clientSecretRef.Get()
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain OAuth2 secret: %w", err)
+		}
+		newSecret = s
+	default:
 		return oi.tokenSource, nil
 	}
-	newSecret, err := fscore.ReadPasswordFromFileOrHTTP(oi.clientSecretFile)
-	if err != nil {
-		return nil, fmt.Errorf("cannot read OAuth2 secret from %q: %w", oi.clientSecretFile, err)
-	}
 	if newSecret == oi.cfg.ClientSecret {
 		return oi.tokenSource, nil
 	}
@@ -635,6 +673,8 @@ func (hcc *HTTPClientConfig) NewConfig(baseDir string) (*Config, error) {
 		BearerToken:     hcc.BearerToken.String(),
 		BearerTokenFile: hcc.BearerTokenFile,
 		OAuth2:          hcc.OAuth2,
+		AzureAD:         hcc.AzureAD,
+		GoogleIAM:       hcc.GoogleIAM,
 		TLSConfig:       hcc.TLSConfig,
 		Headers:         hcc.Headers,
 	}
@@ -688,6 +728,12 @@ type Options struct {
 	// OAuth2 contains optional OAuth2Config.
 	OAuth2 *OAuth2Config
 
+	// AzureAD contains optional AzureADConfig.
+	AzureAD *AzureADConfig
+
+	// GoogleIAM contains optional GoogleIAMConfig.
+	GoogleIAM *GoogleIAMConfig
+
 	// TLSconfig contains optional TLSConfig.
 	TLSConfig *TLSConfig
 
@@ -728,7 +774,9 @@ func (opts *Options) NewConfig() (*Config, error) {
 		if actx.getAuthHeader != nil {
 			return nil, fmt.Errorf("cannot simultaneously use `authorization`, `basic_auth` and `bearer_token`")
 		}
-		actx.mustInitFromBearerToken(opts.BearerToken)
+		if err := actx.initFromBearerToken(opts.BearerToken); err != nil {
+			return nil, err
+		}
 	}
 	if opts.OAuth2 != nil {
 		if actx.getAuthHeader != nil {
@@ -738,6 +786,20 @@ func (opts *Options) NewConfig() (*Config, error) {
 			return nil, fmt.Errorf("cannot initialize oauth2: %w", err)
 		}
 	}
+	if opts.AzureAD != nil {
+		if actx.getAuthHeader != nil {
+			return nil, fmt.Errorf("cannot simultaneously use `authorization`, `basic_auth`, `bearer_token`, `oauth2` and `azuread`")
+		}
+		if err := actx.initFromAzureADConfig(baseDir, opts.AzureAD); err != nil {
+			return nil, fmt.Errorf("cannot initialize azuread: %w", err)
+		}
+	}
+	if opts.GoogleIAM != nil {
+		if actx.getAuthHeader != nil {
+			return nil, fmt.Errorf("cannot simultaneously use `authorization`, `basic_auth`, `bearer_token`, `oauth2`, `azuread` and `google_iam`")
+		}
+		actx.initFromGoogleIAMConfig(baseDir, opts.GoogleIAM)
+	}
 	var tctx tlsContext
 	if opts.TLSConfig != nil {
 		if err := tctx.initFromTLSConfig(baseDir, opts.TLSConfig); err != nil {
@@ -793,6 +855,21 @@ func (actx *authContext) initFromAuthorization(baseDir string, az *Authorization
 		azType = az.Type
 	}
 	if az.CredentialsFile == "" {
+		ref, err := parseSecretRef(az.Credentials.String())
+		if err != nil {
+			return fmt.Errorf("cannot parse `credentials`: %w", err)
+		}
+		if ref != nil {
+			actx.getAuthHeader = func() (string, error) {
+				token, err := ref.Get()
+				if err != nil {
+					return "", fmt.Errorf("cannot obtain `credentials`: %w", err)
+				}
+				return azType + " " + token, nil
+			}
+			actx.authHeaderDigest = fmt.Sprintf("custom(type=%q, credsRef=%q)", az.Type, ref)
+			return nil
+		}
 		ah := azType + " " + az.Credentials.String()
 		actx.getAuthHeader = func() (string, error) {
 			return ah, nil
@@ -851,6 +928,10 @@ func (actx *authContext) initFromBasicAuthConfig(baseDir string, ba *BasicAuthCo
 	if passwordFile != "" {
 		passwordFile = fscore.GetFilepath(baseDir, passwordFile)
 	}
+	passwordRef, err := parseSecretRef(password)
+	if err != nil {
+		return fmt.Errorf("cannot parse `password` in `basic_auth` section: %w", err)
+	}
 	actx.getAuthHeader = func() (string, error) {
 		usernameLocal := username
 		if usernameFile != "" {
@@ -868,6 +949,13 @@ func (actx *authContext) initFromBasicAuthConfig(baseDir string, ba *BasicAuthCo
 			}
 			passwordLocal = s
 		}
+		if passwordRef != nil {
+			s, err := passwordRef.Get()
+			if err != nil {
+				return "", fmt.Errorf("cannot obtain `password`: %w", err)
+			}
+			passwordLocal = s
+		}
 		// See https://en.wikipedia.org/wiki/Basic_access_authentication
 		token := usernameLocal + ":" + passwordLocal
 		token64 := base64.StdEncoding.EncodeToString([]byte(token))
@@ -889,12 +977,28 @@ func (actx *authContext) mustInitFromBearerTokenFile(baseDir string, bearerToken
 	actx.authHeaderDigest = fmt.Sprintf("bearer(tokenFile=%q)", filePath)
 }
 
-func (actx *authContext) mustInitFromBearerToken(bearerToken string) {
+func (actx *authContext) initFromBearerToken(bearerToken string) error {
+	ref, err := parseSecretRef(bearerToken)
+	if err != nil {
+		return fmt.Errorf("cannot parse `bearer_token`: %w", err)
+	}
+	if ref != nil {
+		actx.getAuthHeader = func() (string, error) {
+			token, err := ref.Get()
+			if err != nil {
+				return "", fmt.Errorf("cannot obtain `bearer_token`: %w", err)
+			}
+			return "Bearer " + token, nil
+		}
+		actx.authHeaderDigest = fmt.Sprintf("bearer(tokenRef=%q)", ref)
+		return nil
+	}
 	ah := "Bearer " + bearerToken
 	actx.getAuthHeader = func() (string, error) {
 		return ah, nil
 	}
 	actx.authHeaderDigest = fmt.Sprintf("bearer(token=%q)", bearerToken)
+	return nil
 }
 
 func (actx *authContext) initFromOAuth2Config(baseDir string, o *OAuth2Config) error {
@@ -917,6 +1021,39 @@ func (actx *authContext) initFromOAuth2Config(baseDir string, o *OAuth2Config) e
 	return nil
 }
 
+func (actx *authContext) initFromAzureADConfig(baseDir string, az *AzureADConfig) error {
+	ai, err := newAzureADConfigInternal(baseDir, az)
+	if err != nil {
+		return err
+	}
+	ts := oauth2.ReuseTokenSource(nil, ai)
+	actx.getAuthHeader = func() (string, error) {
+		t, err := ts.Token()
+		if err != nil {
+			return "", fmt.Errorf("cannot get Azure AD token: %w", err)
+		}
+		return t.Type() + " " + t.AccessToken, nil
+	}
+	actx.authHeaderDigest = fmt.Sprintf("azuread(%s)", ai.String())
+	return nil
+}
+
+func (actx *authContext) initFromGoogleIAMConfig(baseDir string, g *GoogleIAMConfig) {
+	gi := newGoogleIAMConfigInternal(baseDir, g)
+	actx.getAuthHeader = func() (string, error) {
+		ts, err := gi.getTokenSource()
+		if err != nil {
+			return "", fmt.Errorf("cannot get Google IAM tokenSource: %w", err)
+		}
+		t, err := ts.Token()
+		if err != nil {
+			return "", fmt.Errorf("cannot get Google IAM token: %w", err)
+		}
+		return t.Type() + " " + t.AccessToken, nil
+	}
+	actx.authHeaderDigest = fmt.Sprintf("google_iam(%s)", gi.String())
+}
+
 type tlsContext struct {
 	getTLSCert    getTLSCertFunc
 	tlsCertDigest string
@@ -15,6 +15,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/secretprovider"
 )
 
 func TestOptionsNewConfigFailure(t *testing.T) {
@@ -210,6 +212,67 @@ oauth2:
   - "InvalidHeader"
 `)
 
+	// azuread: both azuread and oauth2 are set
+	f(`
+oauth2:
+  client_id: some-id
+  client_secret: some-secret
+  token_url: http://some-url
+azuread:
+  managed_identity: {}
+`)
+
+	// azuread: missing managed_identity and workload_identity
+	f(`
+azuread:
+  cloud: AzurePublic
+`)
+
+	// azuread: both managed_identity and workload_identity are set
+	f(`
+azuread:
+  managed_identity: {}
+  workload_identity:
+    client_id: foo
+    tenant_id: bar
+    token_file: testdata/test_secretfile.txt
+`)
+
+	// azuread: unsupported cloud
+	f(`
+azuread:
+  cloud: foobar
+  managed_identity: {}
+`)
+
+	// google_iam: both google_iam and azuread are set
+	f(`
+azuread:
+  managed_identity: {}
+google_iam:
+  credentials_file: testdata/test_secretfile.txt
+`)
+
+	// invalid secret references
+	f(`
+bearer_token: secret://foobar/some/path#key
+`)
+	f(`
+authorization:
+  credentials: secret://vault/some/path
+`)
+	f(`
+basic_auth:
+  username: user
+  password: secret://k8s/ns/name#
+`)
+	f(`
+oauth2:
+  client_id: some-id
+  client_secret: secret://foobar/some/path#key
+  token_url: http://some-url
+`)
+
 	// tls_config: invalid ca
 	f(`
 tls_config:
@@ -659,6 +722,114 @@ oauth2:
 	}
 }
 
+type testSecretProvider map[string]string
+
+func (tsp testSecretProvider) GetSecret(path, key string) (string, error) {
+	v, ok := tsp[path+"#"+key]
+	if !ok {
+		return "", fmt.Errorf("missing secret %s#%s", path, key)
+	}
+	return v, nil
+}
+
+func TestConfigSecretRef(t *testing.T) {
+	secretprovider.RegisterProvider("promauth-test", testSecretProvider{
+		"creds#token":    "secret-token",
+		"creds#password": "secret-password",
+		"oauth2#secret":  "oauth2-secret",
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		_, password, _ := r.BasicAuth()
+		if password != "oauth2-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"oauth2-token","token_type":"Bearer"}`))
+	}))
+	defer ts.Close()
+
+	f := func(yamlConfig, ahExpected string) {
+		t.Helper()
+
+		var hcc HTTPClientConfig
+		if err := yaml.UnmarshalStrict([]byte(yamlConfig), &hcc); err != nil {
+			t.Fatalf("cannot unmarshal config: %s", err)
+		}
+		if hcc.OAuth2 != nil {
+			hcc.OAuth2.TokenURL = ts.URL
+		}
+		cfg, err := hcc.NewConfig("")
+		if err != nil {
+			t.Fatalf("cannot initialize config: %s", err)
+		}
+		ah, err := cfg.GetAuthHeader()
+		if ahExpected == "" {
+			if err == nil {
+				t.Fatalf("expecting non-nil error from GetAuthHeader()")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error from GetAuthHeader(): %s", err)
+		}
+		if ah != ahExpected {
+			t.Fatalf("unexpected auth header; got %q; want %q", ah, ahExpected)
+		}
+		// The secret reference must be visible in config digest instead of the secret value.
+		if s := cfg.String(); strings.Contains(s, "secret-token") || strings.Contains(s, "secret-password") || strings.Contains(s, "oauth2-secret") {
+			t.Fatalf("config string mustn't contain secret values; got %s", s)
+		}
+	}
+
+	// bearer_token
+	f(`
+bearer_token: secret://promauth-test/creds#token
+`, "Bearer secret-token")
+
+	// authorization
+	f(`
+authorization:
+  type: Token
+  credentials: secret://promauth-test/creds#token
+`, "Token secret-token")
+
+	// basic_auth
+	f(`
+basic_auth:
+  username: user
+  password: secret://promauth-test/creds#password
+`, "Basic dXNlcjpzZWNyZXQtcGFzc3dvcmQ=")
+
+	// oauth2
+	f(`
+oauth2:
+  client_id: some-id
+  client_secret: secret://promauth-test/oauth2#secret
+  token_url: replace-with-mock-url
+`, "Bearer oauth2-token")
+
+	// missing secrets
+	f(`
+bearer_token: secret://promauth-test/creds#missing
+`, "")
+	f(`
+basic_auth:
+  username: user
+  password: secret://promauth-test/missing#password
+`, "")
+	f(`
+oauth2:
+  client_id: some-id
+  client_secret: secret://promauth-test/oauth2#missing
+  token_url: replace-with-mock-url
+`, "")
+}
+
 func TestTLSConfigWithCertificatesFilesUpdate(t *testing.T) {
 	// Generate and save a self-signed CA certificate and a certificate signed by the CA
 	caPEM, certPEM, keyPEM := mustGenerateCertificates(t)
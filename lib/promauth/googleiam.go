@@ -0,0 +1,112 @@
+package promauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+)
+
+// GoogleIAMConfig represents config for obtaining access tokens from Google Cloud IAM.
+//
+// Application default credentials are used if CredentialsFile isn't set.
+// This covers GKE workload identity and GCE service accounts via metadata server.
+// See https://cloud.google.com/docs/authentication/application-default-credentials
+type GoogleIAMConfig struct {
+	// CredentialsFile is an optional path to JSON file with service account key or workload identity federation config.
+	CredentialsFile string `yaml:"credentials_file,omitempty"`
+
+	// Scopes contains optional OAuth2 scopes for the requested access token.
+	//
+	// By default, https://www.googleapis.com/auth/cloud-platform scope is used.
+	Scopes []string `yaml:"scopes,omitempty"`
+}
+
+const googleIAMDefaultScope = "https://www.googleapis.com/auth/cloud-platform"
+
+type googleIAMConfigInternal struct {
+	credentialsFile string
+	scopes          []string
+
+	mu          sync.Mutex
+	tokenSource oauth2.TokenSource
+}
+
+func (gi *googleIAMConfigInternal) String() string {
+	return fmt.Sprintf("credentialsFile=%q, scopes=%q", gi.credentialsFile, gi.scopes)
+}
+
+func newGoogleIAMConfigInternal(baseDir string, g *GoogleIAMConfig) *googleIAMConfigInternal {
+	gi := &googleIAMConfigInternal{
+		scopes: g.Scopes,
+	}
+	if len(gi.scopes) == 0 {
+		gi.scopes = []string{googleIAMDefaultScope}
+	}
+	if g.CredentialsFile != "" {
+		// There is no need in reading gi.credentialsFile now, since it may be missing right now.
+		// It is read on the first request for the access token.
+		gi.credentialsFile = fscore.GetFilepath(baseDir, g.CredentialsFile)
+	}
+	return gi
+}
+
+// supportedGoogleCredentialsTypes contains the allowed types of credentials_file.
+var supportedGoogleCredentialsTypes = map[google.CredentialsType]bool{
+	google.ServiceAccount:             true,
+	google.AuthorizedUser:             true,
+	google.ExternalAccount:            true,
+	google.ImpersonatedServiceAccount: true,
+}
+
+func (gi *googleIAMConfigInternal) getTokenSource() (oauth2.TokenSource, error) {
+	gi.mu.Lock()
+	defer gi.mu.Unlock()
+
+	if gi.tokenSource != nil {
+		return gi.tokenSource, nil
+	}
+
+	c := &http.Client{
+		Transport: httputil.NewTransport(false, "vm_google_iam_client"),
+		Timeout:   30 * time.Second,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, c)
+	if gi.credentialsFile == "" {
+		creds, err := google.FindDefaultCredentials(ctx, gi.scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find default credentials: %w", err)
+		}
+		gi.tokenSource = creds.TokenSource
+		return gi.tokenSource, nil
+	}
+
+	data, err := os.ReadFile(gi.credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read `credentials_file`=%q: %w", gi.credentialsFile, err)
+	}
+	var f struct {
+		Type google.CredentialsType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("cannot parse `credentials_file`=%q: %w", gi.credentialsFile, err)
+	}
+	if !supportedGoogleCredentialsTypes[f.Type] {
+		return nil, fmt.Errorf("unsupported credentials type %q at `credentials_file`=%q", f.Type, gi.credentialsFile)
+	}
+	creds, err := google.CredentialsFromJSONWithType(ctx, data, f.Type, gi.scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load credentials from `credentials_file`=%q: %w", gi.credentialsFile, err)
+	}
+	gi.tokenSource = creds.TokenSource
+	return gi.tokenSource, nil
+}
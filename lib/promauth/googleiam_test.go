@@ -0,0 +1,96 @@
+package promauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoogleIAMCredentialsFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		if gt := r.PostForm.Get("grant_type"); gt != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("unexpected grant_type; got %q", gt)
+		}
+		if r.PostForm.Get("assertion") == "" {
+			t.Errorf("missing assertion")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"google-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "some-project",
+		"private_key_id": "some-key-id",
+		"private_key":    string(keyPEM),
+		"client_email":   "vmagent@some-project.iam.gserviceaccount.com",
+		"token_uri":      ts.URL,
+	})
+	if err != nil {
+		t.Fatalf("cannot marshal credentials: %s", err)
+	}
+	credentialsFile := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(credentialsFile, data, 0o600); err != nil {
+		t.Fatalf("cannot write credentials file: %s", err)
+	}
+
+	cfg := mustNewConfigFromYAML(t, `
+google_iam:
+  credentials_file: `+credentialsFile+`
+  scopes:
+  - https://www.googleapis.com/auth/monitoring.write
+`)
+	ah, err := cfg.GetAuthHeader()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ah != "Bearer google-token" {
+		t.Fatalf("unexpected auth header; got %q; want %q", ah, "Bearer google-token")
+	}
+}
+
+func TestGoogleIAMCredentialsFileFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		credentialsFile := filepath.Join(t.TempDir(), "credentials.json")
+		if err := os.WriteFile(credentialsFile, []byte(data), 0o600); err != nil {
+			t.Fatalf("cannot write credentials file: %s", err)
+		}
+		cfg := mustNewConfigFromYAML(t, `
+google_iam:
+  credentials_file: `+credentialsFile+`
+`)
+		if _, err := cfg.GetAuthHeader(); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid json
+	f(`foobar`)
+
+	// unsupported credentials type
+	f(`{"type":"foobar"}`)
+
+	// invalid service account
+	f(`{"type":"service_account"}`)
+}
@@ -28,6 +28,23 @@ type TimeSeries struct {
 
 	// Samples is a list of samples for the given TimeSeries
 	Samples []Sample
+
+	// Exemplars is a list of exemplars for the given TimeSeries
+	Exemplars []Exemplar
+}
+
+// Exemplar is an exemplar attached to a timeseries sample.
+//
+// See https://github.com/prometheus/prometheus/blob/c5282933765ec322a0664d0a0268f8276e83b156/prompb/types.proto#L104
+type Exemplar struct {
+	// Labels is a list of exemplar labels such as trace_id.
+	Labels []Label
+
+	// Value is the exemplar value.
+	Value float64
+
+	// Timestamp is unix timestamp for the exemplar in milliseconds.
+	Timestamp int64
 }
 
 // Sample is a timeseries sample.
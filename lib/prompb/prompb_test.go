@@ -60,6 +60,72 @@ func TestWriteRequestMarshalUnmarshal(t *testing.T) {
 		},
 	})
 
+	// exemplars
+	f(&prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels: []prompb.Label{
+					{
+						Name:  "__name__",
+						Value: "http_request_duration_seconds_bucket",
+					},
+					{
+						Name:  "le",
+						Value: "0.5",
+					},
+				},
+				Samples: []prompb.Sample{
+					{
+						Value:     10,
+						Timestamp: 1000,
+					},
+				},
+				Exemplars: []prompb.Exemplar{
+					{
+						Labels: []prompb.Label{
+							{
+								Name:  "trace_id",
+								Value: "4bf92f3577b34da6a3ce929d0e0e4736",
+							},
+						},
+						Value:     0.34,
+						Timestamp: 999,
+					},
+				},
+			},
+			{
+				Labels: []prompb.Label{
+					{
+						Name:  "__name__",
+						Value: "http_requests_total",
+					},
+				},
+				Samples: []prompb.Sample{},
+				Exemplars: []prompb.Exemplar{
+					{
+						Labels: []prompb.Label{
+							{
+								Name:  "trace_id",
+								Value: "00f067aa0ba902b7",
+							},
+							{
+								Name:  "span_id",
+								Value: "b7ad6b7169203331",
+							},
+						},
+						Value:     1,
+						Timestamp: 2000,
+					},
+					{
+						Labels:    []prompb.Label{},
+						Value:     2,
+						Timestamp: 3000,
+					},
+				},
+			},
+		},
+	})
+
 	f(&prompb.WriteRequest{
 		Timeseries: []prompb.TimeSeries{
 			{
@@ -38,9 +38,27 @@ type WriteRequestUnmarshaler struct {
 
 	labelsPool  []Label
 	samplesPool []Sample
+	ep          exemplarsPool
 	fb          fmtBuffer
 }
 
+// exemplarsPool holds exemplars and their labels for the unmarshaled time series.
+//
+// Exemplar labels are kept separately from series labels, since series labels
+// must be contiguous in labelsPool.
+type exemplarsPool struct {
+	exemplars []Exemplar
+	labels    []Label
+}
+
+func (ep *exemplarsPool) reset() {
+	clear(ep.exemplars)
+	ep.exemplars = ep.exemplars[:0]
+
+	clear(ep.labels)
+	ep.labels = ep.labels[:0]
+}
+
 // Reset resets wru, so it could be re-used.
 func (wru *WriteRequestUnmarshaler) Reset() {
 	wru.wr.Reset()
@@ -51,6 +69,7 @@ func (wru *WriteRequestUnmarshaler) Reset() {
 	clear(wru.samplesPool)
 	wru.samplesPool = wru.samplesPool[:0]
 
+	wru.ep.reset()
 	wru.fb.reset()
 }
 
@@ -89,7 +108,7 @@ func (wru *WriteRequestUnmarshaler) UnmarshalProtobuf(src []byte) (*WriteRequest
 			if !ok {
 				return nil, fmt.Errorf("cannot read timeseries data")
 			}
-			tss, labelsPool, samplesPool, err = unmarshalTimeSeries(data, tss, labelsPool, samplesPool, &wru.fb)
+			tss, labelsPool, samplesPool, err = unmarshalTimeSeries(data, tss, labelsPool, samplesPool, &wru.ep, &wru.fb)
 			if err != nil {
 				return nil, fmt.Errorf("cannot unmarshal timeseries: %w", err)
 			}
@@ -119,9 +138,10 @@ func (wru *WriteRequestUnmarshaler) UnmarshalProtobuf(src []byte) (*WriteRequest
 
 // unmarshalTimeSeries unmarshals TimeSeries messages, which can specify either samples or native histogram samples, but not both.
 // See https://github.com/prometheus/prometheus/blob/9a3ac8910b0476d0d73a5c36a54c55baec5829b6/prompb/types.proto#L133
-func unmarshalTimeSeries(src []byte, tss []TimeSeries, labelsPool []Label, samplesPool []Sample, fb *fmtBuffer) ([]TimeSeries, []Label, []Sample, error) {
+func unmarshalTimeSeries(src []byte, tss []TimeSeries, labelsPool []Label, samplesPool []Sample, ep *exemplarsPool, fb *fmtBuffer) ([]TimeSeries, []Label, []Sample, error) {
 	labelsPoolLen := len(labelsPool)
 	samplesPoolLen := len(samplesPool)
+	exemplarsPoolLen := len(ep.exemplars)
 
 	var histograms [][]byte
 	var fc easyproto.FieldContext
@@ -130,6 +150,7 @@ func unmarshalTimeSeries(src []byte, tss []TimeSeries, labelsPool []Label, sampl
 	// message TimeSeries {
 	//   repeated Label labels   = 1;
 	//   repeated Sample samples = 2;
+	//   repeated Exemplar exemplars = 3;
 	//   repeated Histogram histograms = 4
 	// }
 	for len(src) > 0 {
@@ -166,6 +187,14 @@ func unmarshalTimeSeries(src []byte, tss []TimeSeries, labelsPool []Label, sampl
 			if err := sample.unmarshalProtobuf(data); err != nil {
 				return tss, labelsPool, samplesPool, fmt.Errorf("cannot unmarshal sample: %w", err)
 			}
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return tss, labelsPool, samplesPool, fmt.Errorf("cannot read exemplar data")
+			}
+			if err := ep.unmarshalExemplar(data); err != nil {
+				return tss, labelsPool, samplesPool, fmt.Errorf("cannot unmarshal exemplar: %w", err)
+			}
 		case 4:
 			data, ok := fc.MessageData()
 			if !ok {
@@ -177,14 +206,19 @@ func unmarshalTimeSeries(src []byte, tss []TimeSeries, labelsPool []Label, sampl
 
 	baseLabels := labelsPool[labelsPoolLen:len(labelsPool):len(labelsPool)]
 	samples := samplesPool[samplesPoolLen:len(samplesPool):len(samplesPool)]
+	exemplars := ep.exemplars[exemplarsPoolLen:len(ep.exemplars):len(ep.exemplars)]
 
 	if len(samples) > 0 && len(histograms) > 0 {
 		return tss, labelsPool, samplesPool, fmt.Errorf("cannot have both samples and native histograms in the same TimeSeries")
 	}
 
-	// classic series with normal samples
-	if len(samples) > 0 {
+	// classic series with normal samples and/or exemplars.
+	// Prometheus may send exemplars in TimeSeries without samples.
+	if len(samples) > 0 || (len(exemplars) > 0 && len(histograms) == 0) {
 		tss = appendTimeSeries(tss, baseLabels, samples)
+		if len(exemplars) > 0 {
+			tss[len(tss)-1].Exemplars = exemplars
+		}
 		return tss, labelsPool, samplesPool, nil
 	}
 
@@ -207,6 +241,7 @@ func appendTimeSeries(tss []TimeSeries, labels []Label, samples []Sample) []Time
 	ts := &tss[len(tss)-1]
 	ts.Labels = labels
 	ts.Samples = samples
+	ts.Exemplars = nil
 	return tss
 }
 
@@ -637,6 +672,55 @@ func (s *Sample) unmarshalProtobuf(src []byte) (err error) {
 	return nil
 }
 
+// unmarshalExemplar unmarshals exemplar from src and appends it to ep.exemplars.
+func (ep *exemplarsPool) unmarshalExemplar(src []byte) (err error) {
+	// message Exemplar {
+	//   repeated Label labels = 1;
+	//   double value          = 2;
+	//   int64 timestamp       = 3;
+	// }
+	labelsLen := len(ep.labels)
+	var e Exemplar
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar label data")
+			}
+			if len(ep.labels) < cap(ep.labels) {
+				ep.labels = ep.labels[:len(ep.labels)+1]
+			} else {
+				ep.labels = append(ep.labels, Label{})
+			}
+			label := &ep.labels[len(ep.labels)-1]
+			if err := label.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal exemplar label: %w", err)
+			}
+		case 2:
+			value, ok := fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar value")
+			}
+			e.Value = value
+		case 3:
+			timestamp, ok := fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar timestamp")
+			}
+			e.Timestamp = timestamp
+		}
+	}
+	e.Labels = ep.labels[labelsLen:len(ep.labels):len(ep.labels)]
+	ep.exemplars = append(ep.exemplars, e)
+	return nil
+}
+
 func (mm *MetricMetadata) unmarshalProtobuf(src []byte) (err error) {
 	// message MetricMetadata {
 	//   enum MetricType {
@@ -15,7 +15,7 @@ func TestUnmarshalTimeSeries(t *testing.T) {
 		var tss []TimeSeries
 		var err error
 
-		tss, _, _, err = unmarshalTimeSeries(src, tss, nil, nil, &fmtBuffer{})
+		tss, _, _, err = unmarshalTimeSeries(src, tss, nil, nil, &exemplarsPool{}, &fmtBuffer{})
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
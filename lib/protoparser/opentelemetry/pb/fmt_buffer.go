@@ -2,6 +2,7 @@ package pb
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"strconv"
 
 	"github.com/valyala/fastjson"
@@ -49,6 +50,12 @@ func (fb *fmtBuffer) formatBase64(src []byte) string {
 	return bytesutil.ToUnsafeString(fb.buf[n:])
 }
 
+func (fb *fmtBuffer) formatHex(src []byte) string {
+	n := len(fb.buf)
+	fb.buf = hex.AppendEncode(fb.buf, src)
+	return bytesutil.ToUnsafeString(fb.buf[n:])
+}
+
 func (fb *fmtBuffer) encodeJSONValue(v *fastjson.Value) string {
 	n := len(fb.buf)
 	fb.buf = v.MarshalTo(fb.buf)
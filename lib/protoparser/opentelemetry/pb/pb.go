@@ -3,6 +3,7 @@ package pb
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -29,6 +30,11 @@ type MetricPusher interface {
 	// The PushSample must copy labels, since they become invalid after returning from the func.
 	PushSample(mm *MetricMetadata, suffix string, ls *promutil.Labels, timestampNsecs uint64, value float64, flags uint32)
 
+	// PushExemplar must attach an exemplar with the given args to the sample pushed by the last PushSample call.
+	//
+	// The PushExemplar must copy labels, since they become invalid after returning from the func.
+	PushExemplar(ls *promutil.Labels, timestampNsecs uint64, value float64)
+
 	// PushMetricMetadata must store mm.
 	//
 	// The PushMetricMetadata must copy mm contents, since it becomes invalid after returning from the func.
@@ -242,6 +248,113 @@ func (dctx *decoderContext) decodeResource(src []byte, disableResourceAttributes
 	return nil
 }
 
+// Exemplar represents the corresponding OTEL protobuf message
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/049d4332834935792fd4dbd392ecd31904f99ba2/opentelemetry/proto/metrics/v1/metrics.proto#L676
+type Exemplar struct {
+	FilteredAttributes []*KeyValue
+	TimeUnixNano       uint64
+	DoubleValue        *float64
+	IntValue           *int64
+	SpanID             []byte
+	TraceID            []byte
+}
+
+func (e *Exemplar) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	for _, a := range e.FilteredAttributes {
+		a.marshalProtobuf(mm.AppendMessage(7))
+	}
+	mm.AppendFixed64(2, e.TimeUnixNano)
+	switch {
+	case e.DoubleValue != nil:
+		mm.AppendDouble(3, *e.DoubleValue)
+	case e.IntValue != nil:
+		mm.AppendSfixed64(6, *e.IntValue)
+	}
+	if len(e.SpanID) > 0 {
+		mm.AppendBytes(4, e.SpanID)
+	}
+	if len(e.TraceID) > 0 {
+		mm.AppendBytes(5, e.TraceID)
+	}
+}
+
+// decodeExemplar decodes exemplar from src and appends it to dctx.exemplars.
+//
+// trace_id and span_id are converted to hex-encoded labels, so they could be used for linking to traces.
+func (dctx *decoderContext) decodeExemplar(src []byte) (err error) {
+	// See https://github.com/open-telemetry/opentelemetry-proto/blob/049d4332834935792fd4dbd392ecd31904f99ba2/opentelemetry/proto/metrics/v1/metrics.proto#L676
+	//
+	// message Exemplar {
+	//   repeated KeyValue filtered_attributes = 7;
+	//   fixed64 time_unix_nano = 2;
+	//   oneof value {
+	//     double as_double = 3;
+	//     sfixed64 as_int = 6;
+	//   }
+	//   bytes span_id = 4;
+	//   bytes trace_id = 5;
+	// }
+	e := exemplar{
+		labelsStart: len(dctx.exemplarLabels.Labels),
+	}
+	ls := &dctx.exemplarLabels
+
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		var ok bool
+		switch fc.FieldNum {
+		case 7:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read FilteredAttributes")
+			}
+			if err := decodeKeyValue(data, ls, &dctx.fb, ""); err != nil {
+				return fmt.Errorf("cannot unmarshal FilteredAttributes: %w", err)
+			}
+		case 2:
+			e.timestamp, ok = fc.Fixed64()
+			if !ok {
+				return fmt.Errorf("cannot read TimeUnixNano")
+			}
+		case 3:
+			e.value, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read DoubleValue")
+			}
+		case 6:
+			intValue, ok := fc.Sfixed64()
+			if !ok {
+				return fmt.Errorf("cannot read IntValue")
+			}
+			e.value = float64(intValue)
+		case 4:
+			spanID, ok := fc.Bytes()
+			if !ok {
+				return fmt.Errorf("cannot read SpanID")
+			}
+			if len(spanID) > 0 {
+				ls.Add("span_id", dctx.fb.formatHex(spanID))
+			}
+		case 5:
+			traceID, ok := fc.Bytes()
+			if !ok {
+				return fmt.Errorf("cannot read TraceID")
+			}
+			if len(traceID) > 0 {
+				ls.Add("trace_id", dctx.fb.formatHex(traceID))
+			}
+		}
+	}
+	e.labelsEnd = len(ls.Labels)
+	dctx.exemplars = append(dctx.exemplars, e)
+	return nil
+}
+
 // KeyValue represents the corresponding OTEL protobuf message
 //
 // See https://github.com/open-telemetry/opentelemetry-proto/blob/049d4332834935792fd4dbd392ecd31904f99ba2/opentelemetry/proto/common/v1/common.proto#L66
@@ -817,6 +930,7 @@ type NumberDataPoint struct {
 	TimeUnixNano uint64
 	DoubleValue  *float64
 	IntValue     *int64
+	Exemplars    []*Exemplar
 	Flags        uint32
 }
 
@@ -831,6 +945,9 @@ func (ndp *NumberDataPoint) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 	case ndp.IntValue != nil:
 		mm.AppendSfixed64(6, *ndp.IntValue)
 	}
+	for _, e := range ndp.Exemplars {
+		e.marshalProtobuf(mm.AppendMessage(5))
+	}
 	mm.AppendUint32(8, ndp.Flags)
 }
 
@@ -844,6 +961,7 @@ func (dctx *decoderContext) decodeNumberDataPoint(src []byte) (err error) {
 	//     double as_double = 4;
 	//     sfixed64 as_int = 6;
 	//   }
+	//   repeated Exemplar exemplars = 5;
 	//   uint32 flags = 8;
 	// }
 
@@ -853,6 +971,8 @@ func (dctx *decoderContext) decodeNumberDataPoint(src []byte) (err error) {
 		flags     uint32
 	)
 
+	dctx.resetExemplars()
+
 	var fc easyproto.FieldContext
 	for len(src) > 0 {
 		src, err = fc.NextField(src)
@@ -885,6 +1005,14 @@ func (dctx *decoderContext) decodeNumberDataPoint(src []byte) (err error) {
 				return fmt.Errorf("cannot read IntValue")
 			}
 			value = float64(intValue)
+		case 5:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Exemplars")
+			}
+			if err := dctx.decodeExemplar(data); err != nil {
+				return fmt.Errorf("cannot unmarshal Exemplar: %w", err)
+			}
 		case 8:
 			flags, ok = fc.Uint32()
 			if !ok {
@@ -894,6 +1022,9 @@ func (dctx *decoderContext) decodeNumberDataPoint(src []byte) (err error) {
 	}
 
 	dctx.mp.PushSample(&dctx.mm, "", &dctx.ls, timestamp, value, flags)
+	for i := range dctx.exemplars {
+		dctx.pushExemplar(i)
+	}
 
 	return nil
 }
@@ -1103,6 +1234,7 @@ type HistogramDataPoint struct {
 	Sum            *float64
 	BucketCounts   []uint64
 	ExplicitBounds []float64
+	Exemplars      []*Exemplar
 	Flags          uint32
 }
 
@@ -1117,6 +1249,9 @@ func (dp *HistogramDataPoint) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 	}
 	mm.AppendFixed64s(6, dp.BucketCounts)
 	mm.AppendDoubles(7, dp.ExplicitBounds)
+	for _, e := range dp.Exemplars {
+		e.marshalProtobuf(mm.AppendMessage(8))
+	}
 	mm.AppendUint32(10, dp.Flags)
 }
 
@@ -1130,12 +1265,15 @@ func (dctx *decoderContext) decodeHistogramDataPoint(src []byte) (err error) {
 	//   optional double sum = 5;
 	//   repeated fixed64 bucket_counts = 6;
 	//   repeated double explicit_bounds = 7;
+	//   repeated Exemplar exemplars = 8;
 	//   uint32 flags = 10;
 	// }
 
 	hctx := getHistogramDataPointContext()
 	defer putHistogramDataPointContext(hctx)
 
+	dctx.resetExemplars()
+
 	var fc easyproto.FieldContext
 	for len(src) > 0 {
 		src, err = fc.NextField(src)
@@ -1179,6 +1317,14 @@ func (dctx *decoderContext) decodeHistogramDataPoint(src []byte) (err error) {
 			if !ok {
 				return fmt.Errorf("cannot read ExplicitBounds")
 			}
+		case 8:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Exemplars")
+			}
+			if err := dctx.decodeExemplar(data); err != nil {
+				return fmt.Errorf("cannot unmarshal Exemplar: %w", err)
+			}
 		case 10:
 			hctx.flags, ok = fc.Uint32()
 			if !ok {
@@ -1238,10 +1384,25 @@ func (hctx *histogramDataPointContext) pushSamples(dctx *decoderContext) {
 		cumulative += hctx.bucketCounts[index]
 		*leValueP = dctx.fb.formatFloat(bound)
 		dctx.mp.PushSample(&dctx.mm, "_bucket", &dctx.ls, hctx.timestamp, float64(cumulative), hctx.flags)
+		hctx.pushBucketExemplars(dctx, index)
 	}
 	cumulative += hctx.bucketCounts[len(hctx.bucketCounts)-1]
 	*leValueP = "+Inf"
 	dctx.mp.PushSample(&dctx.mm, "_bucket", &dctx.ls, hctx.timestamp, float64(cumulative), hctx.flags)
+	hctx.pushBucketExemplars(dctx, len(hctx.explicitBounds))
+}
+
+// pushBucketExemplars pushes exemplars, which belong to the bucket with the given index.
+//
+// Every exemplar is attached to the first bucket with the upper bound bigger or equal to the exemplar value.
+func (hctx *histogramDataPointContext) pushBucketExemplars(dctx *decoderContext, index int) {
+	for i := range dctx.exemplars {
+		v := dctx.exemplars[i].value
+		n := sort.SearchFloat64s(hctx.explicitBounds, v)
+		if n == index {
+			dctx.pushExemplar(i)
+		}
+	}
 }
 
 var skippedSampleLogger = logger.WithThrottler("otlp_skipped_sample", 5*time.Second)
@@ -1759,9 +1920,26 @@ type decoderContext struct {
 
 	mm MetricMetadata
 
+	// exemplars contains exemplars for the currently decoded data point.
+	exemplars []exemplar
+	// exemplarLabels contains labels for exemplars.
+	exemplarLabels promutil.Labels
+	// exemplarLabelsTmp is used for passing labels of a single exemplar to mp.PushExemplar.
+	exemplarLabelsTmp promutil.Labels
+
 	mp MetricPusher
 }
 
+// exemplar is a decoded OTEL exemplar.
+//
+// Its labels are stored at decoderContext.exemplarLabels[labelsStart:labelsEnd].
+type exemplar struct {
+	labelsStart int
+	labelsEnd   int
+	timestamp   uint64
+	value       float64
+}
+
 func (dctx *decoderContext) reset() {
 	// Explicitly clear all the ls.Labels up to its' capacity in order to remove possible references
 	// to the original byte slices, so they could be cleared by Go GC.
@@ -1773,9 +1951,27 @@ func (dctx *decoderContext) reset() {
 
 	dctx.mm.reset()
 
+	dctx.resetExemplars()
+
 	dctx.mp = nil
 }
 
+func (dctx *decoderContext) resetExemplars() {
+	clear(dctx.exemplars)
+	dctx.exemplars = dctx.exemplars[:0]
+
+	clear(dctx.exemplarLabels.Labels)
+	dctx.exemplarLabels.Labels = dctx.exemplarLabels.Labels[:0]
+
+	dctx.exemplarLabelsTmp.Labels = nil
+}
+
+func (dctx *decoderContext) pushExemplar(i int) {
+	e := &dctx.exemplars[i]
+	dctx.exemplarLabelsTmp.Labels = dctx.exemplarLabels.Labels[e.labelsStart:e.labelsEnd]
+	dctx.mp.PushExemplar(&dctx.exemplarLabelsTmp, e.timestamp, e.value)
+}
+
 func (dctx *decoderContext) getSnapshot() decoderContextSnapshot {
 	return decoderContextSnapshot{
 		labelsLen: len(dctx.ls.Labels),
@@ -33,6 +33,8 @@ func (p *testMetricPusher) PushSample(mm *MetricMetadata, suffix string, ls *pro
 	})
 }
 
+func (p *testMetricPusher) PushExemplar(_ *promutil.Labels, _ uint64, _ float64) {}
+
 func (p *testMetricPusher) PushMetricMetadata(mm *MetricMetadata) {
 	p.metadata = append(p.metadata, *mm)
 }
@@ -103,8 +103,10 @@ func parseData(data []byte, callback func(tss []prompb.TimeSeries, mms []prompb.
 }
 
 type writeRequestContext struct {
-	samplesBuf []prompb.Sample
-	labelsBuf  []prompb.Label
+	samplesBuf        []prompb.Sample
+	labelsBuf         []prompb.Label
+	exemplarsBuf      []prompb.Exemplar
+	exemplarLabelsBuf []prompb.Label
 
 	sctx sanitizerContext
 
@@ -134,6 +136,12 @@ func (wctx *writeRequestContext) resetBuffer() {
 	clear(wctx.labelsBuf)
 	wctx.labelsBuf = wctx.labelsBuf[:0]
 
+	clear(wctx.exemplarsBuf)
+	wctx.exemplarsBuf = wctx.exemplarsBuf[:0]
+
+	clear(wctx.exemplarLabelsBuf)
+	wctx.exemplarLabelsBuf = wctx.exemplarLabelsBuf[:0]
+
 	wctx.sctx.reset()
 
 	clear(wctx.seenMetricMetadata)
@@ -148,6 +156,19 @@ func (wctx *writeRequestContext) resetBuffer() {
 }
 
 func (wctx *writeRequestContext) PushSample(mm *pb.MetricMetadata, suffix string, ls *promutil.Labels, timestampNsecs uint64, value float64, flags uint32) {
+	// check if we should flush the previously pushed samples right now, if the buf is already huge (4MiB).
+	// The check is performed before adding the sample, since PushExemplar may refer to the last pushed sample.
+	if len(wctx.buf) > 4*1024*1024 {
+		if err := wctx.flushFunc(wctx.tss, wctx.mms); err != nil {
+			if wctx.firstErr == nil {
+				wctx.firstErr = err
+			}
+		} else {
+			rowsRead.Add(len(wctx.tss))
+		}
+		wctx.resetBuffer()
+	}
+
 	metricName := wctx.sctx.sanitizeMetricName(mm)
 	metricName = wctx.concat(metricName, suffix)
 
@@ -183,18 +204,34 @@ func (wctx *writeRequestContext) PushSample(mm *pb.MetricMetadata, suffix string
 		Labels:  wctx.labelsBuf[labelsBufLen:],
 		Samples: wctx.samplesBuf[len(wctx.samplesBuf)-1:],
 	})
+}
 
-	// check if we should flush it right now, if the buf is already huge (4MiB).
-	if len(wctx.buf) > 4*1024*1024 {
-		if err := wctx.flushFunc(wctx.tss, wctx.mms); err != nil {
-			if wctx.firstErr == nil {
-				wctx.firstErr = err
-			}
-		} else {
-			rowsRead.Add(len(wctx.tss))
-		}
-		wctx.resetBuffer()
+func (wctx *writeRequestContext) PushExemplar(ls *promutil.Labels, timestampNsecs uint64, value float64) {
+	if len(wctx.tss) == 0 {
+		return
+	}
+	ts := &wctx.tss[len(wctx.tss)-1]
+
+	labelsBufLen := len(wctx.exemplarLabelsBuf)
+	for _, label := range ls.Labels {
+		name := wctx.sctx.sanitizeLabelName(label.Name)
+		name = wctx.cloneString(name)
+		value := wctx.cloneString(label.Value)
+
+		wctx.exemplarLabelsBuf = append(wctx.exemplarLabelsBuf, prompb.Label{
+			Name:  name,
+			Value: value,
+		})
 	}
+
+	// exemplars for the last pushed sample are stored contiguously at the end of exemplarsBuf.
+	exemplarsStart := len(wctx.exemplarsBuf) - len(ts.Exemplars)
+	wctx.exemplarsBuf = append(wctx.exemplarsBuf, prompb.Exemplar{
+		Labels:    wctx.exemplarLabelsBuf[labelsBufLen:len(wctx.exemplarLabelsBuf):len(wctx.exemplarLabelsBuf)],
+		Value:     value,
+		Timestamp: int64(timestampNsecs / 1e6),
+	})
+	ts.Exemplars = wctx.exemplarsBuf[exemplarsStart:]
 }
 
 func (wctx *writeRequestContext) PushMetricMetadata(mm *pb.MetricMetadata) {
@@ -542,6 +542,86 @@ func TestParseStream(t *testing.T) {
 
 }
 
+func TestParseStreamExemplars(t *testing.T) {
+	f := func(m *pb.Metric, resultExpected string) {
+		t.Helper()
+
+		req := &pb.MetricsData{
+			ResourceMetrics: []*pb.ResourceMetrics{
+				{
+					ScopeMetrics: []*pb.ScopeMetrics{
+						{
+							Metrics: []*pb.Metric{m},
+						},
+					},
+				},
+			},
+		}
+		var a []string
+		err := ParseStream(bytes.NewReader(req.MarshalProtobuf(nil)), "", nil, func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
+			for _, ts := range tss {
+				for _, e := range ts.Exemplars {
+					a = append(a, fmt.Sprintf("%s %s %v %d", prettifyLabels(ts.Labels), prettifyLabels(e.Labels), e.Value, e.Timestamp))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("cannot parse protobuf: %s", err)
+		}
+		result := strings.Join(a, "\n")
+		if result != resultExpected {
+			t.Fatalf("unexpected exemplars\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	traceID := []byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	spanID := []byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	value := func(v float64) *float64 {
+		return &v
+	}
+
+	// gauge with exemplars
+	gauge := generateGauge("my-gauge", "")
+	gauge.Gauge.DataPoints[0].Exemplars = []*pb.Exemplar{
+		{
+			FilteredAttributes: attributesFromKV("user.id", "123"),
+			TimeUnixNano:       uint64(14 * time.Second),
+			DoubleValue:        value(14.5),
+			SpanID:             spanID,
+			TraceID:            traceID,
+		},
+		{
+			TimeUnixNano: uint64(15 * time.Second),
+			DoubleValue:  value(15),
+		},
+	}
+	f(gauge, `{__name__="my-gauge",label1="value1"} {user.id="123",span_id="00f067aa0ba902b7",trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 14.5 14000
+{__name__="my-gauge",label1="value1"} {} 15 15000`)
+
+	// histogram exemplars are attached to the matching buckets
+	histogram := generateHistogram("my-histogram", "", false)
+	histogram.Histogram.DataPoints[0].Exemplars = []*pb.Exemplar{
+		{
+			TimeUnixNano: uint64(29 * time.Second),
+			DoubleValue:  value(0.3),
+			TraceID:      traceID,
+		},
+		{
+			TimeUnixNano: uint64(29 * time.Second),
+			DoubleValue:  value(1),
+			TraceID:      traceID,
+		},
+		{
+			TimeUnixNano: uint64(30 * time.Second),
+			DoubleValue:  value(100),
+		},
+	}
+	f(histogram, `{__name__="my-histogram_bucket",label2="value2",le="0.5"} {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.3 29000
+{__name__="my-histogram_bucket",label2="value2",le="1"} {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 1 29000
+{__name__="my-histogram_bucket",label2="value2",le="+Inf"} {} 100 30000`)
+}
+
 func checkParseStream(data []byte, checkSeries func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error) error {
 	// Verify parsing without compression
 	if err := ParseStream(bytes.NewBuffer(data), "", nil, checkSeries); err != nil {
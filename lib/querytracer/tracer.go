@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 )
 
 var denyQueryTracing = flag.Bool("denyQueryTracing", false, "Whether to disable the ability to trace queries. See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#query-tracing")
@@ -42,6 +43,10 @@ type Tracer struct {
 	// span contains span for the given Tracer. It is added via Tracer.AddJSON().
 	// If span is non-nil, then the remaining fields aren't used.
 	span *span
+	// isHidden is set to true if the trace is collected only for the export via ExportSpans.
+	//
+	// Such a trace isn't returned by String and ToJSON, so it isn't sent to the client.
+	isHidden bool
 }
 
 // New creates a new instance of the tracer with the given fmt.Sprintf(format, args...) message.
@@ -61,6 +66,28 @@ func New(enabled bool, format string, args ...any) *Tracer {
 	}
 }
 
+// NewForSpan creates a new instance of the tracer with the given fmt.Sprintf(format, args...) message,
+// which collects the trace for the export as children of the given span via ExportSpans call.
+//
+// If enabled is set, then the returned tracer is equivalent to the tracer returned by New(enabled, format, args...).
+// Otherwise the returned tracer is enabled only if the span is recording. Its trace isn't returned by String and ToJSON calls in this case.
+// Note that the full trace is collected in memory for every recording span, so the overhead depends on -tracing.samplingRatio.
+//
+// Done or Donef must be called when the tracer should be finished.
+func NewForSpan(span *tracing.Span, enabled bool, format string, args ...any) *Tracer {
+	if !span.IsRecording() {
+		return New(enabled, format, args...)
+	}
+	message := fmt.Sprintf(format, args...)
+	message = buildinfo.Version + ": " + message
+	return &Tracer{
+		message:   message,
+		startTime: time.Now(),
+		// -denyQueryTracing prevents from returning query traces to clients, but it doesn't prevent from exporting them.
+		isHidden: *denyQueryTracing || !enabled,
+	}
+}
+
 // Enabled returns true if the t is enabled.
 func (t *Tracer) Enabled() bool {
 	return t != nil
@@ -201,7 +228,7 @@ func (t *Tracer) AddJSON(jsonTrace []byte) error {
 // It is safe calling String() when child tracers aren't finished yet.
 // In this case they will contain the corresponding message.
 func (t *Tracer) String() string {
-	if t == nil {
+	if t == nil || t.isHidden {
 		return ""
 	}
 	s := t.toSpan()
@@ -217,7 +244,7 @@ func (t *Tracer) String() string {
 // It is safe calling ToJSON() when child tracers aren't finished yet.
 // In this case they will contain the corresponding message.
 func (t *Tracer) ToJSON() string {
-	if t == nil {
+	if t == nil || t.isHidden {
 		return ""
 	}
 	s := t.toSpan()
@@ -228,6 +255,59 @@ func (t *Tracer) ToJSON() string {
 	return string(data)
 }
 
+// ExportSpans exports the finished children of t as children of the given span.
+//
+// Children, which aren't finished yet, are skipped, since they may be modified by concurrently running goroutines.
+// Single-line messages added via Printf are exported as span events.
+//
+// ExportSpans must be called when t methods aren't called by other goroutines.
+func (t *Tracer) ExportSpans(span *tracing.Span) {
+	if t == nil || !span.IsRecording() {
+		return
+	}
+	for _, child := range t.children {
+		child.exportSpan(span)
+	}
+}
+
+func (t *Tracer) exportSpan(parent *tracing.Span) {
+	if t.span != nil {
+		// Sub-traces added via AddJSON do not contain timestamps, so they cannot be exported.
+		return
+	}
+	if !t.isDone.Load() {
+		return
+	}
+	if t.doneTime.Equal(t.startTime) && len(t.children) == 0 {
+		parent.AddEvent(t.message, t.startTime)
+		return
+	}
+	s := parent.NewChildAt(getSpanName(t.message), tracing.SpanKindInternal, t.startTime)
+	s.SetAttributes(tracing.String("vm.trace.message", t.message))
+	for _, child := range t.children {
+		child.exportSpan(s)
+	}
+	s.EndAt(t.doneTime)
+}
+
+// getSpanName returns span name for the given tracer message.
+//
+// Tracer messages usually contain the operation name followed by its args after ": " or "; ",
+// so the operation name is used as span name in order to keep the number of unique span names low.
+func getSpanName(message string) string {
+	if n := strings.Index(message, ": "); n >= 0 {
+		message = message[:n]
+	}
+	if n := strings.Index(message, "; "); n >= 0 {
+		message = message[:n]
+	}
+	const maxLen = 128
+	if len(message) > maxLen {
+		message = message[:maxLen]
+	}
+	return message
+}
+
 func (t *Tracer) toSpan() *span {
 	s, _ := t.toSpanInternal(time.Now())
 	return s
@@ -1,9 +1,15 @@
 package querytracer
 
 import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"sync"
+	"sync/atomic"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 )
 
 func TestTracerDisabled(t *testing.T) {
@@ -56,6 +62,79 @@ func TestTracerEnabled(t *testing.T) {
 	}
 }
 
+func TestTracerForSpan(t *testing.T) {
+	var spansRequests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		spansRequests.Add(1)
+	}))
+	defer ts.Close()
+
+	if err := flag.Set("tracing.otlpEndpoint", ts.URL); err != nil {
+		t.Fatalf("cannot set -tracing.otlpEndpoint: %s", err)
+	}
+	if err := flag.Set("tracing.samplingRatio", "1"); err != nil {
+		t.Fatalf("cannot set -tracing.samplingRatio: %s", err)
+	}
+	defer func() {
+		_ = flag.Set("tracing.otlpEndpoint", "")
+		_ = flag.Set("tracing.samplingRatio", "0.1")
+	}()
+	tracing.Init("test")
+
+	f := func(enabled bool, traceExpected bool) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+		span := tracing.StartRequestSpan(r, "request")
+		qt := NewForSpan(span, enabled, "test")
+		if !qt.Enabled() {
+			t.Fatalf("query tracer must be enabled for recording span")
+		}
+		qtChild := qt.NewChild("child done %d", 456)
+		qtChild.Printf("foo %d", 123)
+		qtChild.Done()
+		qt.Done()
+		if s := qt.ToJSON(); (s != "") != traceExpected {
+			t.Fatalf("unexpected json trace; got %q; traceExpected=%v", s, traceExpected)
+		}
+		qt.ExportSpans(span)
+		span.End()
+	}
+
+	// The trace is returned to client only if it is explicitly enabled.
+	f(false, false)
+	f(true, true)
+
+	tracing.Stop()
+	if n := spansRequests.Load(); n != 1 {
+		t.Fatalf("unexpected number of requests to OTLP endpoint; got %d; want 1", n)
+	}
+
+	// The tracer for non-recording span is equivalent to the tracer returned by New.
+	if qt := NewForSpan(nil, false, "test"); qt.Enabled() {
+		t.Fatalf("query tracer must be disabled")
+	}
+	if qt := NewForSpan(nil, true, "test"); !qt.Enabled() {
+		t.Fatalf("query tracer must be enabled")
+	}
+}
+
+func TestGetSpanName(t *testing.T) {
+	f := func(message, nameExpected string) {
+		t.Helper()
+
+		name := getSpanName(message)
+		if name != nameExpected {
+			t.Fatalf("unexpected span name for %q; got %q; want %q", message, name, nameExpected)
+		}
+	}
+
+	f("eval: query=sum(foo), timeRange=[1..2], step=1, mayCache=true", "eval")
+	f("search indexDB idb_123: timeRange=[1..2]", "search indexDB idb_123")
+	f("rollup rate() over 10 series; rollupConfigs=[]", "rollup rate() over 10 series")
+	f("subquery", "subquery")
+}
+
 func TestTracerMultiline(t *testing.T) {
 	qt := New(true, "line1\nline2")
 	qt.Printf("line3\nline4\n")
@@ -0,0 +1,127 @@
+package secretprovider
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+)
+
+var (
+	kubernetesAPIServer = flag.String("secret.kubernetes.apiServer", "", "Optional address of Kubernetes API server for resolving secret://k8s/<namespace>/<name>#<key> references. "+
+		"By default, the in-cluster API server address is used")
+	kubernetesTokenFile = flag.String("secret.kubernetes.tokenFile", "/var/run/secrets/kubernetes.io/serviceaccount/token", "Path to file with service account token "+
+		"for accessing -secret.kubernetes.apiServer . The file is re-read before every request, since the token is rotated by Kubernetes")
+	kubernetesCAFile = flag.String("secret.kubernetes.caFile", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt", "Path to TLS CA file "+
+		"for verifying connections to -secret.kubernetes.apiServer")
+)
+
+// kubernetesProvider reads secrets from Kubernetes Secrets.
+//
+// The path for secret://k8s/<namespace>/<name>#<key> reference is <namespace>/<name>.
+//
+// See https://kubernetes.io/docs/reference/kubernetes-api/config-and-storage-resources/secret-v1/#get-read-the-specified-secret
+type kubernetesProvider struct {
+	apiServer string
+	tokenFile string
+
+	c *http.Client
+}
+
+func newKubernetesProviderFromFlags() (Provider, error) {
+	apiServer := *kubernetesAPIServer
+	if apiServer == "" {
+		host := os.Getenv("KUBERNETES_SERVICE_HOST")
+		port := os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("missing -secret.kubernetes.apiServer command-line flag and KUBERNETES_SERVICE_HOST, KUBERNETES_SERVICE_PORT env vars")
+		}
+		apiServer = "https://" + net.JoinHostPort(host, port)
+	}
+	caFile := ""
+	if strings.HasPrefix(apiServer, "https://") {
+		caFile = *kubernetesCAFile
+	}
+	c, err := newHTTPClient(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize client for -secret.kubernetes.apiServer=%q: %w", apiServer, err)
+	}
+	kp := &kubernetesProvider{
+		apiServer: strings.TrimSuffix(apiServer, "/"),
+		tokenFile: *kubernetesTokenFile,
+		c:         c,
+	}
+	return kp, nil
+}
+
+// GetSecret implements Provider interface.
+func (kp *kubernetesProvider) GetSecret(path, key string) (string, error) {
+	namespace, name, ok := strings.Cut(path, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("unexpected path %q; expecting <namespace>/<name>", path)
+	}
+	u := kp.apiServer + "/api/v1/namespaces/" + url.PathEscape(namespace) + "/secrets/" + url.PathEscape(name)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create request to Kubernetes API server: %w", err)
+	}
+	if kp.tokenFile != "" {
+		token, err := fscore.ReadPasswordFromFileOrHTTP(kp.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("cannot read service account token from -secret.kubernetes.tokenFile=%q: %w", kp.tokenFile, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	data, err := doRequest(kp.c, req)
+	if err != nil {
+		return "", err
+	}
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return "", fmt.Errorf("cannot parse Kubernetes secret %s/%s: %w", namespace, name, err)
+	}
+	v, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("missing key %q in Kubernetes secret %s/%s", key, namespace, name)
+	}
+	value, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return "", fmt.Errorf("cannot decode key %q in Kubernetes secret %s/%s: %w", key, namespace, name, err)
+	}
+	return string(value), nil
+}
+
+// newHTTPClient returns http client for accessing secrets providers.
+//
+// The client verifies server certificates with CA from caFile if it isn't empty.
+func newHTTPClient(caFile string) (*http.Client, error) {
+	tr := httputil.NewTransport(false, "vm_secret_provider")
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file: %w", err)
+		}
+		rootCA := x509.NewCertPool()
+		if !rootCA.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("cannot parse data from CA file %q", caFile)
+		}
+		tr.TLSClientConfig.RootCAs = rootCA
+	}
+	c := &http.Client{
+		Transport: tr,
+		Timeout:   30 * time.Second,
+	}
+	return c, nil
+}
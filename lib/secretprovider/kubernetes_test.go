@@ -0,0 +1,72 @@
+package secretprovider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKubernetesProviderGetSecret(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ah := r.Header.Get("Authorization"); ah != "Bearer sa-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/monitoring/secrets/vmagent-creds":
+			// "cGFzc3dvcmQ=" is base64-encoded "password"
+			_, _ = w.Write([]byte(`{"kind":"Secret","apiVersion":"v1","data":{"password":"cGFzc3dvcmQ=","invalid":"foo!"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"kind":"Status","reason":"NotFound"}`))
+		}
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token"), 0o600); err != nil {
+		t.Fatalf("cannot write token file: %s", err)
+	}
+	kp := &kubernetesProvider{
+		apiServer: ts.URL,
+		tokenFile: tokenFile,
+		c:         http.DefaultClient,
+	}
+
+	v, err := kp.GetSecret("monitoring/vmagent-creds", "password")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if v != "password" {
+		t.Fatalf("unexpected value; got %q; want %q", v, "password")
+	}
+
+	f := func(path, key string) {
+		t.Helper()
+
+		if _, err := kp.GetSecret(path, key); err == nil {
+			t.Fatalf("expecting non-nil error for path=%q, key=%q", path, key)
+		}
+	}
+
+	// invalid path
+	f("vmagent-creds", "password")
+	f("monitoring/vmagent-creds/foo", "password")
+
+	// missing secret
+	f("monitoring/missing", "password")
+
+	// missing key
+	f("monitoring/vmagent-creds", "missing")
+
+	// invalid base64 value
+	f("monitoring/vmagent-creds", "invalid")
+
+	// invalid token
+	if err := os.WriteFile(tokenFile, []byte("invalid-token"), 0o600); err != nil {
+		t.Fatalf("cannot write token file: %s", err)
+	}
+	f("monitoring/vmagent-creds", "password")
+}
@@ -0,0 +1,280 @@
+package secretprovider
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var refreshInterval = flag.Duration("secret.refreshInterval", time.Minute, "Interval for refreshing secrets referred via secret://<provider>/<path>#<key> in configs and command-line flags. "+
+	"This allows picking up rotated secrets without restart. See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#secret-references")
+
+// RefreshInterval returns the interval for refreshing secret values. See -secret.refreshInterval command-line flag.
+func RefreshInterval() time.Duration {
+	return *refreshInterval
+}
+
+// Prefix is the prefix for secret references.
+const Prefix = "secret://"
+
+// IsRef returns true if s is a reference to a secret in the form secret://<provider>/<path>#<key>.
+func IsRef(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// Ref is a reference to a secret stored at external secrets provider.
+type Ref struct {
+	// Provider is the name of secrets provider such as vault or k8s.
+	Provider string
+
+	// Path is the path to the secret at the provider.
+	Path string
+
+	// Key is the key of the secret value at the Path.
+	Key string
+
+	s string
+}
+
+// ParseRef parses secret reference in the form secret://<provider>/<path>#<key>.
+func ParseRef(s string) (*Ref, error) {
+	if !IsRef(s) {
+		return nil, fmt.Errorf("missing %q prefix in secret reference %q", Prefix, s)
+	}
+	tail := s[len(Prefix):]
+	n := strings.LastIndexByte(tail, '#')
+	if n < 0 {
+		return nil, fmt.Errorf("missing #<key> in secret reference %q; expecting %s<provider>/<path>#<key>", s, Prefix)
+	}
+	key := tail[n+1:]
+	tail = tail[:n]
+	n = strings.IndexByte(tail, '/')
+	if n < 0 {
+		return nil, fmt.Errorf("missing /<path> in secret reference %q; expecting %s<provider>/<path>#<key>", s, Prefix)
+	}
+	providerName := tail[:n]
+	path := strings.Trim(tail[n+1:], "/")
+	if providerName == "" {
+		return nil, fmt.Errorf("missing provider name in secret reference %q", s)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("missing path in secret reference %q", s)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("missing key in secret reference %q", s)
+	}
+	if getProvider(providerName) == nil {
+		return nil, fmt.Errorf("unknown provider %q in secret reference %q; supported providers: %s", providerName, s, strings.Join(getProviderNames(), ", "))
+	}
+	r := &Ref{
+		Provider: providerName,
+		Path:     path,
+		Key:      key,
+		s:        s,
+	}
+	return r, nil
+}
+
+// String returns string representation of r.
+//
+// It doesn't contain the secret value, so it is safe to log it.
+func (r *Ref) String() string {
+	return r.s
+}
+
+// Get returns the current value for the secret referred by r.
+//
+// The value is cached and is refreshed in background every -secret.refreshInterval, so slow providers do not block callers.
+// The last successfully obtained value is returned until the refresh is complete or if the provider is temporarily unavailable.
+func (r *Ref) Get() (string, error) {
+	e := getCacheEntry(r.s)
+	if *refreshInterval <= 0 {
+		// Caching is disabled, so the secret is fetched on every call.
+		return e.refresh(r)
+	}
+
+	e.mu.Lock()
+	if e.hasValue {
+		if fasttime.UnixTimestamp() >= e.deadline && !e.isRefreshing {
+			e.isRefreshing = true
+			go func() {
+				_, _ = e.refresh(r)
+			}()
+		}
+		value := e.value
+		e.mu.Unlock()
+		return value, nil
+	}
+	e.mu.Unlock()
+
+	// The secret hasn't been obtained yet, so it must be fetched synchronously.
+	return e.refresh(r)
+}
+
+// refresh fetches the secret referred by r and stores it in e.
+//
+// The last known value is returned if the secret cannot be fetched.
+func (e *cacheEntry) refresh(r *Ref) (string, error) {
+	// Do not hold e.mu during the fetch, since it may take long time.
+	value, err := r.fetch()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.isRefreshing = false
+	ct := fasttime.UnixTimestamp()
+	if err != nil {
+		if !e.hasValue {
+			return "", err
+		}
+		// Return the last known value, so temporary unavailability of the provider doesn't break clients.
+		refreshErrorLogger.Warnf("cannot refresh secret %s; using the previously obtained value; error: %s", r, err)
+		e.deadline = ct + retryIntervalSeconds
+		return e.value, nil
+	}
+	e.value = value
+	e.hasValue = true
+	e.deadline = ct + uint64(refreshInterval.Seconds())
+	return value, nil
+}
+
+func (r *Ref) fetch() (string, error) {
+	p := getProvider(r.Provider)
+	if p == nil {
+		return "", fmt.Errorf("unknown provider %q in secret reference %q", r.Provider, r.s)
+	}
+	metrics.GetOrCreateCounter(fmt.Sprintf(`vm_secret_provider_requests_total{provider=%q}`, r.Provider)).Inc()
+	value, err := p.GetSecret(r.Path, r.Key)
+	if err != nil {
+		metrics.GetOrCreateCounter(fmt.Sprintf(`vm_secret_provider_request_errors_total{provider=%q}`, r.Provider)).Inc()
+		return "", fmt.Errorf("cannot obtain secret %s: %w", r.s, err)
+	}
+	return value, nil
+}
+
+// Get returns the value of the secret referred by s if s is a secret reference. Otherwise s is returned as is.
+func Get(s string) (string, error) {
+	if !IsRef(s) {
+		return s, nil
+	}
+	r, err := ParseRef(s)
+	if err != nil {
+		return "", err
+	}
+	return r.Get()
+}
+
+// retryIntervalSeconds is the interval for retrying failed secret refreshes.
+const retryIntervalSeconds = 5
+
+var refreshErrorLogger = logger.WithThrottler("secretRefreshError", 5*time.Second)
+
+type cacheEntry struct {
+	mu       sync.Mutex
+	value    string
+	hasValue bool
+	deadline uint64
+
+	// isRefreshing is set to true while the value is refreshed in background.
+	isRefreshing bool
+}
+
+var (
+	cacheLock sync.Mutex
+	cache     = make(map[string]*cacheEntry)
+)
+
+func getCacheEntry(ref string) *cacheEntry {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	e := cache[ref]
+	if e == nil {
+		e = &cacheEntry{}
+		cache[ref] = e
+	}
+	return e
+}
+
+// Provider must implement external secrets provider.
+type Provider interface {
+	// GetSecret must return the value for the given key of the secret at the given path.
+	GetSecret(path, key string) (string, error)
+}
+
+var (
+	providersLock sync.Mutex
+	providers     = make(map[string]Provider)
+)
+
+// RegisterProvider registers p under the given name.
+//
+// After that p can be used via secret://<name>/<path>#<key> references.
+func RegisterProvider(name string, p Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	if _, ok := providers[name]; ok {
+		logger.Panicf("BUG: secrets provider %q is already registered", name)
+	}
+	providers[name] = p
+}
+
+func getProvider(name string) Provider {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	return providers[name]
+}
+
+func getProviderNames() []string {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterProvider("vault", newLazyProvider(newVaultProviderFromFlags))
+	RegisterProvider("k8s", newLazyProvider(newKubernetesProviderFromFlags))
+}
+
+// lazyProvider initializes the underlying provider on the first use,
+// since command-line flags aren't parsed yet during package initialization.
+type lazyProvider struct {
+	newProvider func() (Provider, error)
+
+	once sync.Once
+	p    Provider
+	err  error
+}
+
+func newLazyProvider(newProvider func() (Provider, error)) *lazyProvider {
+	return &lazyProvider{
+		newProvider: newProvider,
+	}
+}
+
+// GetSecret implements Provider interface.
+func (lp *lazyProvider) GetSecret(path, key string) (string, error) {
+	lp.once.Do(func() {
+		lp.p, lp.err = lp.newProvider()
+	})
+	if lp.err != nil {
+		return "", lp.err
+	}
+	return lp.p.GetSecret(path, key)
+}
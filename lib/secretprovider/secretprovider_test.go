@@ -0,0 +1,196 @@
+package secretprovider
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRefSuccess(t *testing.T) {
+	f := func(s, providerExpected, pathExpected, keyExpected string) {
+		t.Helper()
+
+		r, err := ParseRef(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if r.Provider != providerExpected {
+			t.Fatalf("unexpected provider; got %q; want %q", r.Provider, providerExpected)
+		}
+		if r.Path != pathExpected {
+			t.Fatalf("unexpected path; got %q; want %q", r.Path, pathExpected)
+		}
+		if r.Key != keyExpected {
+			t.Fatalf("unexpected key; got %q; want %q", r.Key, keyExpected)
+		}
+		if r.String() != s {
+			t.Fatalf("unexpected string representation; got %q; want %q", r.String(), s)
+		}
+	}
+
+	f("secret://vault/secret/data/vmagent#password", "vault", "secret/data/vmagent", "password")
+	f("secret://k8s/monitoring/vmagent-creds#token", "k8s", "monitoring/vmagent-creds", "token")
+	f("secret://k8s/monitoring/vmagent-creds/#token", "k8s", "monitoring/vmagent-creds", "token")
+}
+
+func TestParseRefFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		if _, err := ParseRef(s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+
+	// missing prefix
+	f("vault/secret/data/vmagent#password")
+
+	// missing key
+	f("secret://vault/secret/data/vmagent")
+	f("secret://vault/secret/data/vmagent#")
+
+	// missing path
+	f("secret://vault#password")
+	f("secret://vault/#password")
+
+	// missing provider
+	f("secret:///secret/data/vmagent#password")
+
+	// unknown provider
+	f("secret://foobar/secret/data/vmagent#password")
+}
+
+type testProvider struct {
+	mu     sync.Mutex
+	values map[string]string
+	err    error
+
+	// blockCh blocks GetSecret calls until it is closed.
+	blockCh chan struct{}
+}
+
+func (tp *testProvider) block() {
+	tp.mu.Lock()
+	tp.blockCh = make(chan struct{})
+	tp.mu.Unlock()
+}
+
+func (tp *testProvider) unblock() {
+	tp.mu.Lock()
+	close(tp.blockCh)
+	tp.blockCh = nil
+	tp.mu.Unlock()
+}
+
+func (tp *testProvider) GetSecret(path, key string) (string, error) {
+	tp.mu.Lock()
+	blockCh := tp.blockCh
+	tp.mu.Unlock()
+	if blockCh != nil {
+		<-blockCh
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	if tp.err != nil {
+		return "", tp.err
+	}
+	v, ok := tp.values[path+"#"+key]
+	if !ok {
+		return "", fmt.Errorf("missing secret")
+	}
+	return v, nil
+}
+
+func (tp *testProvider) set(k, v string, err error) {
+	tp.mu.Lock()
+	tp.values[k] = v
+	tp.err = err
+	tp.mu.Unlock()
+}
+
+func TestRefGet(t *testing.T) {
+	tp := &testProvider{
+		values: map[string]string{},
+	}
+	RegisterProvider("test-get", tp)
+	tp.set("foo/bar#baz", "value1", nil)
+
+	// Values without secret:// prefix must be returned as is.
+	v, err := Get("foo/bar#baz")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if v != "foo/bar#baz" {
+		t.Fatalf("unexpected value; got %q; want %q", v, "foo/bar#baz")
+	}
+
+	// Missing secret.
+	if _, err := Get("secret://test-get/foo/bar#missing"); err == nil {
+		t.Fatalf("expecting non-nil error for missing secret")
+	}
+
+	f := func(valueExpected string) {
+		t.Helper()
+
+		v, err := Get("secret://test-get/foo/bar#baz")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if v != valueExpected {
+			t.Fatalf("unexpected value; got %q; want %q", v, valueExpected)
+		}
+	}
+
+	f("value1")
+
+	// The cached value must be returned until -secret.refreshInterval passes.
+	tp.set("foo/bar#baz", "value2", nil)
+	f("value1")
+
+	// The cached value must be returned after the cache entry expires, while the rotated value is obtained in background.
+	e := getCacheEntry("secret://test-get/foo/bar#baz")
+	expire := func() {
+		e.mu.Lock()
+		e.deadline = 0
+		e.mu.Unlock()
+	}
+	waitRefresh := func() {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			e.mu.Lock()
+			isRefreshing := e.isRefreshing
+			e.mu.Unlock()
+			if !isRefreshing {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout when waiting for the secret refresh")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	expire()
+	f("value1")
+	waitRefresh()
+	f("value2")
+
+	// Slow provider mustn't block callers.
+	tp.block()
+	expire()
+	f("value2")
+	f("value2")
+	tp.unblock()
+	waitRefresh()
+
+	// The last known value must be returned if the provider is unavailable.
+	tp.set("foo/bar#baz", "value3", fmt.Errorf("provider is unavailable"))
+	expire()
+	f("value2")
+	waitRefresh()
+	f("value2")
+}
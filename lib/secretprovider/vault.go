@@ -0,0 +1,250 @@
+package secretprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+)
+
+var (
+	vaultAddr = flag.String("secret.vault.addr", "", "Address of HashiCorp Vault for resolving secret://vault/<path>#<key> references. "+
+		"For example, -secret.vault.addr=https://vault:8200 . VAULT_ADDR env var is used if it isn't set")
+	vaultToken = flag.String("secret.vault.token", "", "Optional token for accessing -secret.vault.addr . "+
+		"VAULT_TOKEN env var is used if neither -secret.vault.token, nor -secret.vault.tokenFile, nor -secret.vault.kubernetesRole is set")
+	vaultTokenFile = flag.String("secret.vault.tokenFile", "", "Optional path to file with token for accessing -secret.vault.addr . "+
+		"The file is re-read before every request to Vault, so it can be updated by Vault Agent")
+	vaultKubernetesRole = flag.String("secret.vault.kubernetesRole", "", "Optional Vault role for authenticating at -secret.vault.addr via Kubernetes auth method "+
+		"with the service account token from -secret.kubernetes.tokenFile")
+	vaultKubernetesMountPath = flag.String("secret.vault.kubernetesMountPath", "kubernetes", "Mount path of Kubernetes auth method at -secret.vault.addr . "+
+		"See -secret.vault.kubernetesRole")
+	vaultTLSCAFile = flag.String("secret.vault.tlsCAFile", "", "Optional path to TLS CA file for verifying connections to -secret.vault.addr . "+
+		"By default, system CA is used")
+)
+
+// vaultProvider reads secrets from HashiCorp Vault KV secrets engine.
+//
+// The path for secret://vault/<path>#<key> reference is the full API path for reading the secret without /v1/ prefix,
+// for example, secret/data/vmagent for KV v2 or kv/vmagent for KV v1.
+//
+// See https://developer.hashicorp.com/vault/api-docs/secret/kv
+type vaultProvider struct {
+	addr      string
+	token     string
+	tokenFile string
+
+	kubernetesRole      string
+	kubernetesMountPath string
+	kubernetesTokenFile string
+
+	c *http.Client
+
+	// loginLock protects loginToken and loginDeadline obtained via Kubernetes auth method.
+	loginLock     sync.Mutex
+	loginToken    string
+	loginDeadline time.Time
+}
+
+func newVaultProviderFromFlags() (Provider, error) {
+	addr := *vaultAddr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("missing -secret.vault.addr command-line flag and VAULT_ADDR env var")
+	}
+	token := *vaultToken
+	if token == "" && *vaultTokenFile == "" && *vaultKubernetesRole == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	c, err := newHTTPClient(*vaultTLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize client for -secret.vault.addr=%q: %w", addr, err)
+	}
+	vp := &vaultProvider{
+		addr:      strings.TrimSuffix(addr, "/"),
+		token:     token,
+		tokenFile: *vaultTokenFile,
+
+		kubernetesRole:      *vaultKubernetesRole,
+		kubernetesMountPath: strings.Trim(*vaultKubernetesMountPath, "/"),
+		kubernetesTokenFile: *kubernetesTokenFile,
+
+		c: c,
+	}
+	return vp, nil
+}
+
+// GetSecret implements Provider interface.
+func (vp *vaultProvider) GetSecret(path, key string) (string, error) {
+	token, err := vp.getToken()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, vp.addr+"/v1/"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create request to Vault: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	data, err := doRequest(vp.c, req)
+	if err != nil {
+		var se *statusCodeError
+		if vp.kubernetesRole != "" && errors.As(err, &se) && (se.statusCode == http.StatusUnauthorized || se.statusCode == http.StatusForbidden) {
+			// The token may be revoked before its lease expiration. Obtain new token on the next request.
+			vp.resetLoginToken()
+		}
+		return "", err
+	}
+	return getVaultSecretValue(data, key)
+}
+
+// getVaultSecretValue returns the value for the given key from Vault response data.
+//
+// It supports responses from both KV v1 and KV v2 secrets engines.
+func getVaultSecretValue(data []byte, key string) (string, error) {
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("cannot parse Vault response: %w", err)
+	}
+	m := resp.Data
+	if inner, ok := m["data"]; ok {
+		if _, ok := m["metadata"]; ok {
+			// KV v2 response - the secret is located at data.data
+			m = nil
+			if err := json.Unmarshal(inner, &m); err != nil {
+				return "", fmt.Errorf("cannot parse KV v2 data from Vault response: %w", err)
+			}
+		}
+	}
+	raw, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("missing key %q in the secret", key)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	// Return non-string values as is.
+	return string(raw), nil
+}
+
+func (vp *vaultProvider) getToken() (string, error) {
+	if vp.tokenFile != "" {
+		token, err := fscore.ReadPasswordFromFileOrHTTP(vp.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("cannot read Vault token from -secret.vault.tokenFile=%q: %w", vp.tokenFile, err)
+		}
+		return token, nil
+	}
+	if vp.kubernetesRole != "" {
+		return vp.getLoginToken()
+	}
+	return vp.token, nil
+}
+
+func (vp *vaultProvider) getLoginToken() (string, error) {
+	vp.loginLock.Lock()
+	defer vp.loginLock.Unlock()
+
+	if vp.loginToken != "" && (vp.loginDeadline.IsZero() || time.Now().Before(vp.loginDeadline)) {
+		return vp.loginToken, nil
+	}
+
+	// See https://developer.hashicorp.com/vault/api-docs/auth/kubernetes#login
+	jwt, err := fscore.ReadPasswordFromFileOrHTTP(vp.kubernetesTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read service account token for Vault Kubernetes auth: %w", err)
+	}
+	body, err := json.Marshal(map[string]string{
+		"role": vp.kubernetesRole,
+		"jwt":  jwt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("BUG: cannot marshal Vault login request: %w", err)
+	}
+	loginURL := vp.addr + "/v1/auth/" + vp.kubernetesMountPath + "/login"
+	req, err := http.NewRequest(http.MethodPost, loginURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("cannot create Vault login request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	data, err := doRequest(vp.c, req)
+	if err != nil {
+		return "", fmt.Errorf("cannot login to Vault via Kubernetes auth method with role %q: %w", vp.kubernetesRole, err)
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("cannot parse Vault login response: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("missing auth.client_token in Vault login response")
+	}
+	vp.loginToken = resp.Auth.ClientToken
+	if resp.Auth.LeaseDuration <= 0 {
+		// The token has no TTL, so it is used until the request with it fails.
+		vp.loginDeadline = time.Time{}
+	} else {
+		// Renew the token after 80% of its lease duration in order to avoid using expired token.
+		vp.loginDeadline = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second * 8 / 10)
+	}
+	return vp.loginToken, nil
+}
+
+func (vp *vaultProvider) resetLoginToken() {
+	vp.loginLock.Lock()
+	vp.loginToken = ""
+	vp.loginLock.Unlock()
+}
+
+func doRequest(c *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot perform request to %q: %w", req.URL.Redacted(), err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response from %q: %w", req.URL.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(data) > 1024 {
+			data = data[:1024]
+		}
+		return nil, &statusCodeError{
+			statusCode: resp.StatusCode,
+			url:        req.URL.Redacted(),
+			response:   data,
+		}
+	}
+	return data, nil
+}
+
+// statusCodeError is returned from doRequest on unexpected response status code.
+type statusCodeError struct {
+	statusCode int
+	url        string
+	response   []byte
+}
+
+// Error implements error interface.
+func (se *statusCodeError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %q; response: %q", se.statusCode, se.url, se.response)
+}
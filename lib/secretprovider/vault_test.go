@@ -0,0 +1,211 @@
+package secretprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestVaultProviderGetSecret(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get("X-Vault-Token"); token != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/vmagent":
+			// KV v2 response
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"kv2-password","port":8428},"metadata":{"version":3}}}`))
+		case "/v1/kv/vmagent":
+			// KV v1 response
+			_, _ = w.Write([]byte(`{"data":{"password":"kv1-password"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer ts.Close()
+
+	vp := &vaultProvider{
+		addr:  ts.URL,
+		token: "vault-token",
+		c:     http.DefaultClient,
+	}
+
+	f := func(path, key, valueExpected string) {
+		t.Helper()
+
+		v, err := vp.GetSecret(path, key)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if v != valueExpected {
+			t.Fatalf("unexpected value; got %q; want %q", v, valueExpected)
+		}
+	}
+
+	f("secret/data/vmagent", "password", "kv2-password")
+	f("secret/data/vmagent", "port", "8428")
+	f("kv/vmagent", "password", "kv1-password")
+
+	fFailure := func(path, key string) {
+		t.Helper()
+
+		if _, err := vp.GetSecret(path, key); err == nil {
+			t.Fatalf("expecting non-nil error for path=%q, key=%q", path, key)
+		}
+	}
+
+	// missing secret
+	fFailure("secret/data/missing", "password")
+
+	// missing key
+	fFailure("secret/data/vmagent", "missing")
+	fFailure("kv/vmagent", "missing")
+
+	// invalid token
+	vp.token = "invalid-token"
+	fFailure("kv/vmagent", "password")
+}
+
+func TestVaultProviderTokenFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Vault-Token")
+		_, _ = w.Write([]byte(`{"data":{"token":"` + token + `"}}`))
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	vp := &vaultProvider{
+		addr:      ts.URL,
+		tokenFile: tokenFile,
+		c:         http.DefaultClient,
+	}
+
+	f := func(tokenExpected string) {
+		t.Helper()
+
+		if err := os.WriteFile(tokenFile, []byte(tokenExpected), 0o600); err != nil {
+			t.Fatalf("cannot write token file: %s", err)
+		}
+		v, err := vp.GetSecret("kv/vmagent", "token")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if v != tokenExpected {
+			t.Fatalf("unexpected token passed to Vault; got %q; want %q", v, tokenExpected)
+		}
+	}
+
+	// The token file must be re-read on every request.
+	f("token1")
+	f("token2")
+}
+
+func TestVaultProviderKubernetesAuth(t *testing.T) {
+	var logins atomic.Int64
+	var revokeToken atomic.Bool
+	var leaseDuration atomic.Int64
+	leaseDuration.Store(3600)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/k8s-auth/login":
+			var req struct {
+				Role string `json:"role"`
+				JWT  string `json:"jwt"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("cannot parse login request: %s", err)
+			}
+			if req.Role != "vmagent" || req.JWT != "sa-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			logins.Add(1)
+			fmt.Fprintf(w, `{"auth":{"client_token":"login-token","lease_duration":%d}}`, leaseDuration.Load())
+		case "/v1/secret/data/vmagent":
+			if r.Header.Get("X-Vault-Token") != "login-token" || revokeToken.CompareAndSwap(true, false) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"secret-password"},"metadata":{}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	saTokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(saTokenFile, []byte("sa-token"), 0o600); err != nil {
+		t.Fatalf("cannot write token file: %s", err)
+	}
+	vp := &vaultProvider{
+		addr:                ts.URL,
+		kubernetesRole:      "vmagent",
+		kubernetesMountPath: "k8s-auth",
+		kubernetesTokenFile: saTokenFile,
+		c:                   http.DefaultClient,
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := vp.GetSecret("secret/data/vmagent", "password")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if v != "secret-password" {
+			t.Fatalf("unexpected value; got %q; want %q", v, "secret-password")
+		}
+	}
+	// The login token must be reused until its lease expires.
+	if n := logins.Load(); n != 1 {
+		t.Fatalf("unexpected number of logins; got %d; want 1", n)
+	}
+
+	// The login token must be reused after request for missing secret.
+	if _, err := vp.GetSecret("secret/data/missing", "password"); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if _, err := vp.GetSecret("secret/data/vmagent", "password"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := logins.Load(); n != 1 {
+		t.Fatalf("unexpected number of logins; got %d; want 1", n)
+	}
+
+	// The login token must be obtained again after request rejected with 403 Forbidden.
+	revokeToken.Store(true)
+	if _, err := vp.GetSecret("secret/data/vmagent", "password"); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if _, err := vp.GetSecret("secret/data/vmagent", "password"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := logins.Load(); n != 2 {
+		t.Fatalf("unexpected number of logins; got %d; want 2", n)
+	}
+
+	// The login token without lease duration must be reused until failed request.
+	leaseDuration.Store(0)
+	vp.resetLoginToken()
+	for i := 0; i < 3; i++ {
+		if _, err := vp.GetSecret("secret/data/vmagent", "password"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if n := logins.Load(); n != 3 {
+		t.Fatalf("unexpected number of logins; got %d; want 3", n)
+	}
+
+	// Invalid role
+	vp.kubernetesRole = "foobar"
+	vp.resetLoginToken()
+	if _, err := vp.GetSecret("secret/data/vmagent", "password"); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
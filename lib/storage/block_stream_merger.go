@@ -16,6 +16,12 @@ type blockStreamMerger struct {
 	// Blocks with smaller timestamps are removed because of retention.
 	retentionDeadline int64
 
+	// sr contains per-series retention deadlines. It is nil if retention filters aren't configured.
+	sr *seriesRetention
+
+	// sd applies downsampling to the merged blocks. It is nil if downsampling isn't configured.
+	sd *seriesDownsampling
+
 	// Whether the call to NextBlock must be no-op.
 	nextBlockNoop bool
 
@@ -32,14 +38,18 @@ func (bsm *blockStreamMerger) reset() {
 	bsm.bsrHeap = bsm.bsrHeap[:0]
 
 	bsm.retentionDeadline = 0
+	bsm.sr = nil
+	bsm.sd = nil
 	bsm.nextBlockNoop = false
 	bsm.err = nil
 }
 
 // Init initializes bsm with the given bsrs.
-func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, retentionDeadline int64) {
+func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, retentionDeadline int64, sr *seriesRetention, sd *seriesDownsampling) {
 	bsm.reset()
 	bsm.retentionDeadline = retentionDeadline
+	bsm.sr = sr
+	bsm.sd = sd
 	for _, bsr := range bsrs {
 		if bsr.NextBlock() {
 			bsm.bsrHeap = append(bsm.bsrHeap, bsr)
@@ -61,8 +71,11 @@ func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, retentionDeadline
 	bsm.nextBlockNoop = true
 }
 
-func (bsm *blockStreamMerger) getRetentionDeadline(_ *blockHeader) int64 {
-	return bsm.retentionDeadline
+func (bsm *blockStreamMerger) getRetentionDeadline(bh *blockHeader) int64 {
+	if bsm.sr == nil {
+		return bsm.retentionDeadline
+	}
+	return bsm.sr.getDeadline(bh)
 }
 
 // NextBlock stores the next block in bsm.Block.
@@ -0,0 +1,426 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+)
+
+// DownsamplingPeriod instructs leaving the last sample per each Interval for samples older than Offset.
+//
+// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#downsampling
+type DownsamplingPeriod struct {
+	// Filter is an optional series filter such as {env="dev"}.
+	//
+	// The period is applied to all the series if Filter is nil.
+	Filter *promrelabel.IfExpression
+
+	// Offset is the age of samples, which must be downsampled.
+	Offset time.Duration
+
+	// Interval is the downsampling interval.
+	Interval time.Duration
+
+	// s is the original string representation of the period.
+	s string
+}
+
+// ParseDownsamplingPeriod parses downsampling period in the form `[filter:]offset:interval`.
+//
+// For example, `30d:5m` or `{__name__=~"node_.*"}:1d:1m`.
+func ParseDownsamplingPeriod(s string) (*DownsamplingPeriod, error) {
+	n := strings.LastIndexByte(s, ':')
+	if n < 0 {
+		return nil, fmt.Errorf("missing `:interval` suffix in the downsampling period %q", s)
+	}
+	intervalStr := s[n+1:]
+	prefix := s[:n]
+	filterStr := ""
+	offsetStr := prefix
+	if n := strings.LastIndexByte(prefix, ':'); n >= 0 {
+		filterStr = prefix[:n]
+		offsetStr = prefix[n+1:]
+	}
+
+	offset, err := timeutil.ParseDuration(offsetStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse offset in the downsampling period %q: %w", s, err)
+	}
+	interval, err := timeutil.ParseDuration(intervalStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse interval in the downsampling period %q: %w", s, err)
+	}
+	offsetMsecs := offset.Milliseconds()
+	intervalMsecs := interval.Milliseconds()
+	if offsetMsecs < 0 || intervalMsecs < 0 {
+		return nil, fmt.Errorf("offset and interval in the downsampling period %q cannot be negative", s)
+	}
+	if intervalMsecs == 0 {
+		if offsetMsecs != 0 {
+			return nil, fmt.Errorf("interval in the downsampling period %q must be positive", s)
+		}
+	} else if offsetMsecs%intervalMsecs != 0 {
+		return nil, fmt.Errorf("offset in the downsampling period %q must be a multiple of interval", s)
+	}
+
+	var filter *promrelabel.IfExpression
+	if filterStr != "" {
+		var ie promrelabel.IfExpression
+		if err := ie.Parse(filterStr); err != nil {
+			return nil, fmt.Errorf("cannot parse series filter in the downsampling period %q: %w", s, err)
+		}
+		filter = &ie
+	} else if intervalMsecs == 0 {
+		return nil, fmt.Errorf("the downsampling period %q without downsampling must contain series filter", s)
+	}
+
+	dp := &DownsamplingPeriod{
+		Filter:   filter,
+		Offset:   offset,
+		Interval: interval,
+		s:        s,
+	}
+	return dp, nil
+}
+
+// String returns string representation of dp.
+func (dp *DownsamplingPeriod) String() string {
+	if dp.s != "" {
+		return dp.s
+	}
+	if dp.Filter == nil {
+		return fmt.Sprintf("%s:%s", dp.Offset, dp.Interval)
+	}
+	return fmt.Sprintf("%s:%s:%s", dp.Filter, dp.Offset, dp.Interval)
+}
+
+// downsamplingLevel leaves the last sample per each interval for samples older than offset.
+type downsamplingLevel struct {
+	offset   int64
+	interval int64
+}
+
+// downsamplingGroup contains downsampling levels for series matching the filter.
+type downsamplingGroup struct {
+	// filter is nil for the group, which is applied to all the series.
+	filter *promrelabel.IfExpression
+
+	// levels are sorted by offset in descending order, e.g. the most coarse level goes first.
+	levels []downsamplingLevel
+}
+
+// SetDownsamplingPeriods sets the downsampling periods, which are applied to samples during background merges.
+//
+// Periods with the same filter form multi-level downsampling for series matching the filter.
+// If the series matches multiple filters, then the periods for the first filter are applied.
+// Periods without filter are applied to series, which do not match any filter.
+//
+// This function must be called after SetDedupInterval and before initializing the storage.
+func SetDownsamplingPeriods(dps []*DownsamplingPeriod) error {
+	dedupInterval := GetDedupInterval()
+	var dgs []*downsamplingGroup
+	var dgNoFilter *downsamplingGroup
+	m := make(map[string]*downsamplingGroup)
+	for _, dp := range dps {
+		offset := dp.Offset.Milliseconds()
+		interval := dp.Interval.Milliseconds()
+		if dedupInterval > 0 {
+			if offset == 0 {
+				return fmt.Errorf("the downsampling period %q with zero offset cannot be used together with -dedup.minScrapeInterval", dp)
+			}
+			if interval%dedupInterval != 0 {
+				return fmt.Errorf("interval in the downsampling period %q must be a multiple of -dedup.minScrapeInterval=%s", dp, msecsToDuration(dedupInterval))
+			}
+		}
+
+		var dg *downsamplingGroup
+		if dp.Filter == nil {
+			if dgNoFilter == nil {
+				dgNoFilter = &downsamplingGroup{}
+			}
+			dg = dgNoFilter
+		} else {
+			filter := dp.Filter.String()
+			dg = m[filter]
+			if dg == nil {
+				dg = &downsamplingGroup{
+					filter: dp.Filter,
+				}
+				m[filter] = dg
+				dgs = append(dgs, dg)
+			}
+		}
+		if interval == 0 {
+			if len(dg.levels) > 0 {
+				return fmt.Errorf("the downsampling period %q cannot be mixed with other periods for the same filter", dp)
+			}
+			// Add an empty level in order to detect mixing with other periods for the same filter.
+			dg.levels = append(dg.levels, downsamplingLevel{})
+			continue
+		}
+		for _, dl := range dg.levels {
+			if dl.interval == 0 {
+				return fmt.Errorf("the downsampling period %q cannot be mixed with `0s:0s` period for the same filter", dp)
+			}
+			if dl.offset == offset {
+				return fmt.Errorf("duplicate offset in the downsampling period %q", dp)
+			}
+		}
+		dg.levels = append(dg.levels, downsamplingLevel{
+			offset:   offset,
+			interval: interval,
+		})
+	}
+	if dgNoFilter != nil {
+		// Series, which do not match any filter, are downsampled according to periods without filter.
+		dgs = append(dgs, dgNoFilter)
+	}
+
+	for _, dg := range dgs {
+		if len(dg.levels) == 1 && dg.levels[0].interval == 0 {
+			dg.levels = nil
+			continue
+		}
+		sort.Slice(dg.levels, func(i, j int) bool {
+			return dg.levels[i].offset > dg.levels[j].offset
+		})
+		// Older samples must be downsampled with bigger intervals, which are multiples of the intervals for newer samples.
+		// Otherwise the downsampling for newer samples may leave more samples than needed for the older samples.
+		for i := 1; i < len(dg.levels); i++ {
+			prev := dg.levels[i-1]
+			curr := dg.levels[i]
+			if prev.interval%curr.interval != 0 {
+				return fmt.Errorf("downsampling interval %s for offset %s must be a multiple of downsampling interval %s for offset %s",
+					msecsToDuration(prev.interval), msecsToDuration(prev.offset), msecsToDuration(curr.interval), msecsToDuration(curr.offset))
+			}
+		}
+	}
+
+	a := make([]string, len(dps))
+	for i, dp := range dps {
+		a[i] = dp.String()
+	}
+	downsamplingGroups = dgs
+	downsamplingPeriodsString = strings.Join(a, ",")
+	return nil
+}
+
+func msecsToDuration(msecs int64) time.Duration {
+	return time.Duration(msecs) * time.Millisecond
+}
+
+var (
+	downsamplingGroups        []*downsamplingGroup
+	downsamplingPeriodsString string
+)
+
+func isDownsamplingEnabled() bool {
+	return len(downsamplingGroups) > 0
+}
+
+// getDownsamplingLevels returns downsampling levels for series with the given labels.
+//
+// nil is returned if the series mustn't be downsampled.
+func getDownsamplingLevels(labels []prompb.Label) []downsamplingLevel {
+	for _, dg := range downsamplingGroups {
+		if dg.filter == nil || dg.filter.Match(labels) {
+			return dg.levels
+		}
+	}
+	return nil
+}
+
+// getMaxDownsamplingDeadline returns the biggest timestamp across all the downsampling levels, which may be affected by downsampling at currentTimestamp.
+//
+// math.MinInt64 is returned if downsampling is disabled.
+func getMaxDownsamplingDeadline(currentTimestamp int64) int64 {
+	maxDeadline := int64(math.MinInt64)
+	for _, dg := range downsamplingGroups {
+		if len(dg.levels) > 0 {
+			dl := dg.levels[len(dg.levels)-1]
+			maxDeadline = max(maxDeadline, dl.getDeadline(currentTimestamp))
+		}
+	}
+	return maxDeadline
+}
+
+// getDeadline returns the maximum timestamp for samples, which must be downsampled by dl at currentTimestamp.
+//
+// The deadline is aligned to dl.interval, so samples are downsampled only on whole intervals.
+func (dl *downsamplingLevel) getDeadline(currentTimestamp int64) int64 {
+	deadline := currentTimestamp - dl.offset
+	return deadline - deadline%dl.interval
+}
+
+// downsampleSamples applies the given levels to src* at currentTimestamp via dedup function.
+//
+// levels must be sorted by offset in descending order. src* are modified in place.
+func downsampleSamples[T int64 | float64](srcTimestamps []int64, srcValues []T, levels []downsamplingLevel, currentTimestamp int64,
+	dedup func(timestamps []int64, values []T, interval int64) ([]int64, []T)) ([]int64, []T) {
+	dstTimestamps := srcTimestamps[:0]
+	dstValues := srcValues[:0]
+	i := 0
+	for _, dl := range levels {
+		deadline := dl.getDeadline(currentTimestamp)
+		j := i
+		for j < len(srcTimestamps) && srcTimestamps[j] <= deadline {
+			j++
+		}
+		if j == i {
+			continue
+		}
+		timestamps, values := dedup(srcTimestamps[i:j], srcValues[i:j], dl.interval)
+		dstTimestamps = append(dstTimestamps, timestamps...)
+		dstValues = append(dstValues, values...)
+		i = j
+	}
+	dstTimestamps = append(dstTimestamps, srcTimestamps[i:]...)
+	dstValues = append(dstValues, srcValues[i:]...)
+	return dstTimestamps, dstValues
+}
+
+// seriesDownsampling applies downsampling to blocks during background merges.
+type seriesDownsampling struct {
+	mns *metricNameSearch
+
+	currentTimestamp int64
+
+	// maxDeadline is the biggest timestamp, which may be affected by downsampling.
+	maxDeadline int64
+
+	// lastMetricID and lastLevels hold the levels for the last seen series,
+	// since merged blocks are sorted by TSID.
+	lastMetricID uint64
+	lastLevels   []downsamplingLevel
+	hasLast      bool
+
+	metricName []byte
+	mn         MetricName
+	labels     []prompb.Label
+}
+
+// newSeriesDownsampling returns seriesDownsampling for the merge of pt parts at currentTimestamp.
+//
+// nil is returned if downsampling doesn't affect pt data.
+// The returned seriesDownsampling must be released via release() when no longer needed.
+func (pt *partition) newSeriesDownsampling(currentTimestamp int64, useSparseCache bool) *seriesDownsampling {
+	if !isDownsamplingEnabled() {
+		return nil
+	}
+	maxDeadline := getMaxDownsamplingDeadline(currentTimestamp)
+	if maxDeadline < pt.tr.MinTimestamp {
+		// Fast path - downsampling doesn't affect the partition data yet.
+		return nil
+	}
+
+	// See the comment in newSeriesRetention on why pt.s.tb isn't used here.
+	mns := &metricNameSearch{
+		storage:        pt.s,
+		idbs:           []*indexDB{pt.idb},
+		legacyIDBs:     pt.s.getLegacyIndexDBs(),
+		useSparseCache: useSparseCache,
+	}
+	return &seriesDownsampling{
+		mns:              mns,
+		currentTimestamp: currentTimestamp,
+		maxDeadline:      maxDeadline,
+	}
+}
+
+func (sd *seriesDownsampling) release() {
+	sd.mns.storage.putLegacyIndexDBs(sd.mns.legacyIDBs)
+	sd.mns = nil
+}
+
+// downsampleBlock applies downsampling to b according to the levels for the series b belongs to.
+func (sd *seriesDownsampling) downsampleBlock(b *Block) {
+	if b.bh.MinTimestamp > sd.maxDeadline {
+		// Fast path - the block contains only samples, which mustn't be downsampled.
+		return
+	}
+	levels := sd.getLevels(b.bh.TSID.MetricID)
+	if len(levels) == 0 {
+		return
+	}
+	if err := b.UnmarshalData(); err != nil {
+		logger.Panicf("FATAL: cannot unmarshal block: %s", err)
+	}
+	srcTimestamps := b.timestamps[b.nextIdx:]
+	if len(srcTimestamps) < 2 {
+		// Nothing to downsample.
+		return
+	}
+	srcValues := b.values[b.nextIdx:]
+	timestamps, values := downsampleSamples(srcTimestamps, srcValues, levels, sd.currentTimestamp, deduplicateSamplesDuringMerge)
+	downsampledSamplesDuringMerge.Add(uint64(len(srcTimestamps) - len(timestamps)))
+	b.timestamps = b.timestamps[:b.nextIdx+len(timestamps)]
+	b.values = b.values[:b.nextIdx+len(values)]
+}
+
+func (sd *seriesDownsampling) getLevels(metricID uint64) []downsamplingLevel {
+	if len(downsamplingGroups) == 1 && downsamplingGroups[0].filter == nil {
+		// Fast path - there is no need to search for series labels.
+		return downsamplingGroups[0].levels
+	}
+	if sd.hasLast && sd.lastMetricID == metricID {
+		return sd.lastLevels
+	}
+	var ok bool
+	sd.metricName, ok = sd.mns.search(sd.metricName[:0], metricID)
+	sd.labels = sd.labels[:0]
+	if ok {
+		if err := sd.mn.Unmarshal(sd.metricName); err != nil {
+			logger.Panicf("FATAL: cannot unmarshal metricName %q for metricID=%d: %s", sd.metricName, metricID, err)
+		}
+		sd.labels = sd.mn.appendPromLabels(sd.labels)
+	}
+	// The metric name may be missing for deleted series. Apply periods without filter to them.
+	sd.lastLevels = getDownsamplingLevels(sd.labels)
+	sd.lastMetricID = metricID
+	sd.hasLast = true
+	return sd.lastLevels
+}
+
+var downsampledSamplesDuringMerge atomicutil.Uint64
+
+// isDownsamplingNeeded returns true if samples starting from minTimestamp must be downsampled at currentTimestamp.
+func isDownsamplingNeeded(minTimestamp, currentTimestamp int64) bool {
+	return isDownsamplingEnabled() && minTimestamp <= getMaxDownsamplingDeadline(currentTimestamp)
+}
+
+// isDownsamplingApplyNeeded returns true if downsampling must be applied
+// to the historical data in pt at currentTimestamp.
+func (pt *partition) isDownsamplingApplyNeeded(currentTimestamp int64) bool {
+	if !isDownsamplingEnabled() {
+		return false
+	}
+	var offsets []int64
+	for _, dg := range downsamplingGroups {
+		for _, dl := range dg.levels {
+			offsets = append(offsets, dl.offset)
+		}
+	}
+	appliedTimestamp := pt.mustReadAppliedDownsampling()
+	return pt.isHistoricalApplyNeeded(offsets, appliedTimestamp, currentTimestamp)
+}
+
+// mustReadAppliedDownsampling returns the timestamp when the currently configured downsampling periods
+// were applied to pt the last time.
+//
+// Zero is returned if the downsampling wasn't applied yet or if the periods were changed since then.
+func (pt *partition) mustReadAppliedDownsampling() int64 {
+	return pt.mustReadAppliedTimestamp(appliedDownsamplingFilename, downsamplingPeriodsString)
+}
+
+// mustWriteAppliedDownsampling stores the timestamp when the currently configured downsampling periods were applied to pt.
+func (pt *partition) mustWriteAppliedDownsampling(timestamp int64) {
+	pt.mustWriteAppliedTimestamp(appliedDownsamplingFilename, downsamplingPeriodsString, timestamp)
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestParseDownsamplingPeriod_Failure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, err := ParseDownsamplingPeriod(s); err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q", s)
+		}
+	}
+	f("")
+	f("30d")
+	f("30d:")
+	f(":5m")
+	f("foo:5m")
+	f("30d:foo")
+	f("30d:7m")
+	f("30d:0s")
+	f("0s:0s")
+	f("-1d:1h")
+	f(`{env=~"dev}:30d:5m`)
+}
+
+func TestParseDownsamplingPeriod_Success(t *testing.T) {
+	f := func(s, filterExpected string, offsetExpected, intervalExpected time.Duration) {
+		t.Helper()
+		dp, err := ParseDownsamplingPeriod(s)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		filter := ""
+		if dp.Filter != nil {
+			filter = dp.Filter.String()
+		}
+		if filter != filterExpected {
+			t.Fatalf("unexpected filter for %q; got %q; want %q", s, filter, filterExpected)
+		}
+		if dp.Offset != offsetExpected {
+			t.Fatalf("unexpected offset for %q; got %s; want %s", s, dp.Offset, offsetExpected)
+		}
+		if dp.Interval != intervalExpected {
+			t.Fatalf("unexpected interval for %q; got %s; want %s", s, dp.Interval, intervalExpected)
+		}
+		if dp.String() != s {
+			t.Fatalf("unexpected string representation; got %q; want %q", dp.String(), s)
+		}
+	}
+	f("30d:5m", "", 30*24*time.Hour, 5*time.Minute)
+	f("180d:1h", "", 180*24*time.Hour, time.Hour)
+	f("0s:1m", "", 0, time.Minute)
+	f(`{__name__=~"node_.*"}:1d:1m`, `{__name__=~"node_.*"}`, 24*time.Hour, time.Minute)
+	f(`{env="prod"}:0s:0s`, `{env="prod"}`, 0, 0)
+}
+
+func TestSetDownsamplingPeriods_Failure(t *testing.T) {
+	defer func() {
+		SetDedupInterval(0)
+		_ = SetDownsamplingPeriods(nil)
+	}()
+
+	f := func(dedupInterval time.Duration, periods ...string) {
+		t.Helper()
+		SetDedupInterval(dedupInterval)
+		dps := mustParseDownsamplingPeriods(t, periods)
+		if err := SetDownsamplingPeriods(dps); err == nil {
+			t.Fatalf("expecting non-nil error for %q", periods)
+		}
+	}
+
+	// intervals for the same filter aren't multiples of each other
+	f(0, "1d:2m", "30d:5m")
+	f(0, `{env="dev"}:1d:2h`, `{env="dev"}:30d:1h`)
+
+	// duplicate offset
+	f(0, "30d:5m", "30d:10m")
+
+	// 0s:0s mixed with other periods
+	f(0, `{env="dev"}:0s:0s`, `{env="dev"}:30d:5m`)
+
+	// interval isn't a multiple of dedup interval
+	f(time.Minute, "30d:90s")
+
+	// zero offset cannot be used with dedup
+	f(time.Minute, "0s:5m")
+	f(time.Minute, `{env="dev"}:0s:0s`)
+}
+
+func TestDownsampleSamples(t *testing.T) {
+	defer func() {
+		_ = SetDownsamplingPeriods(nil)
+	}()
+
+	const hour = int64(time.Hour / time.Millisecond)
+	const minute = int64(time.Minute / time.Millisecond)
+	currentTimestamp := 100 * hour
+
+	dps := mustParseDownsamplingPeriods(t, []string{`{env="prod"}:0s:0s`, "10h:10m", "50h:1h"})
+	if err := SetDownsamplingPeriods(dps); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(mn *MetricName, timestamps []int64, timestampsExpected []int64) {
+		t.Helper()
+		values := make([]float64, len(timestamps))
+		for i := range values {
+			values[i] = float64(i)
+		}
+		levels := getDownsamplingLevels(mn.appendPromLabels(nil))
+		resultTimestamps, resultValues := downsampleSamples(timestamps, values, levels, currentTimestamp, DeduplicateSamples)
+		if !reflect.DeepEqual(resultTimestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps;\ngot\n%v\nwant\n%v", resultTimestamps, timestampsExpected)
+		}
+		if len(resultValues) != len(resultTimestamps) {
+			t.Fatalf("unexpected number of values; got %d; want %d", len(resultValues), len(resultTimestamps))
+		}
+	}
+
+	var timestamps []int64
+	for ts := 40 * hour; ts <= currentTimestamp; ts += 5 * minute {
+		timestamps = append(timestamps, ts)
+	}
+
+	mn := &MetricName{
+		MetricGroup: []byte("foo"),
+	}
+
+	// samples older than 50h are downsampled to 1h, samples older than 10h are downsampled to 10m.
+	var timestampsExpected []int64
+	for _, ts := range timestamps {
+		if ts <= 50*hour && ts%hour == 0 || ts > 50*hour && ts <= 90*hour && ts%(10*minute) == 0 || ts > 90*hour {
+			timestampsExpected = append(timestampsExpected, ts)
+		}
+	}
+	f(mn, append([]int64{}, timestamps...), timestampsExpected)
+
+	// series matching `{env="prod"}:0s:0s` mustn't be downsampled
+	mnProd := &MetricName{
+		MetricGroup: []byte("foo"),
+		Tags: []Tag{{
+			Key:   []byte("env"),
+			Value: []byte("prod"),
+		}},
+	}
+	f(mnProd, append([]int64{}, timestamps...), timestamps)
+
+	// samples newer than all the deadlines mustn't be downsampled
+	f(mn, []int64{95 * hour, 95*hour + minute}, []int64{95 * hour, 95*hour + minute})
+}
+
+func TestGetDownsamplingLevels(t *testing.T) {
+	defer func() {
+		_ = SetDownsamplingPeriods(nil)
+	}()
+
+	dps := mustParseDownsamplingPeriods(t, []string{`{env="prod"}:1d:30s`, `{__name__=~"node_.*"}:1d:5m`, `{__name__=~"node_.*"}:30d:1h`})
+	if err := SetDownsamplingPeriods(dps); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(labels []prompb.Label, intervalsExpected []time.Duration) {
+		t.Helper()
+		var intervals []time.Duration
+		for _, dl := range getDownsamplingLevels(labels) {
+			intervals = append(intervals, msecsToDuration(dl.interval))
+		}
+		if !reflect.DeepEqual(intervals, intervalsExpected) {
+			t.Fatalf("unexpected intervals for %s; got %v; want %v", labels, intervals, intervalsExpected)
+		}
+	}
+
+	// the first matching filter is applied
+	f([]prompb.Label{{Name: "__name__", Value: "node_cpu"}, {Name: "env", Value: "prod"}}, []time.Duration{30 * time.Second})
+	f([]prompb.Label{{Name: "__name__", Value: "node_cpu"}}, []time.Duration{time.Hour, 5 * time.Minute})
+
+	// series without matching filters aren't downsampled
+	f([]prompb.Label{{Name: "__name__", Value: "process_cpu"}}, nil)
+}
+
+func mustParseDownsamplingPeriods(t *testing.T, periods []string) []*DownsamplingPeriod {
+	t.Helper()
+	var dps []*DownsamplingPeriod
+	for _, s := range periods {
+		dp, err := ParseDownsamplingPeriod(s)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		dps = append(dps, dp)
+	}
+	return dps
+}
@@ -0,0 +1,251 @@
+package exemplars
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+// bucketsCount is the number of buckets for the storage.
+//
+// Every bucket has its own lock, so concurrent Add calls for distinct series do not contend.
+const bucketsCount = 8
+
+// Storage is an in-memory storage for exemplars.
+//
+// It keeps up to maxExemplars the most recently added exemplars.
+// Older exemplars are overwritten by newer ones.
+type Storage struct {
+	buckets [bucketsCount]*bucket
+
+	maxExemplars int
+}
+
+// NewStorage returns new Storage, which keeps up to maxExemplars exemplars.
+//
+// The returned Storage doesn't keep exemplars if maxExemplars <= 0.
+func NewStorage(maxExemplars int) *Storage {
+	s := &Storage{
+		maxExemplars: max(maxExemplars, 0),
+	}
+	maxBucketExemplars := 0
+	if maxExemplars > 0 {
+		maxBucketExemplars = max(maxExemplars/bucketsCount, 1)
+	}
+	for i := range bucketsCount {
+		s.buckets[i] = &bucket{
+			maxExemplars: maxBucketExemplars,
+			index:        make(map[string]int),
+		}
+	}
+	return s
+}
+
+// IsEnabled returns true if s keeps exemplars.
+func (s *Storage) IsEnabled() bool {
+	return s.maxExemplars > 0
+}
+
+// Add adds exemplar e for the series with the given key to s.
+//
+// The exemplar is ignored if its timestamp doesn't exceed the timestamp of the last exemplar for the given key,
+// since the same exemplar is usually sent multiple times by Prometheus-compatible agents.
+//
+// Add copies key and e contents, so they can be modified after returning from Add.
+func (s *Storage) Add(key []byte, e *prompb.Exemplar) {
+	if !s.IsEnabled() {
+		return
+	}
+	b := s.buckets[xxhash.Sum64(key)%bucketsCount]
+	b.add(key, e)
+}
+
+// Get appends exemplars for the series with the given key on the time range [minTimestamp, maxTimestamp] to dst and returns the result.
+//
+// The appended exemplars are sorted by timestamp. They mustn't be modified by the caller.
+func (s *Storage) Get(dst []prompb.Exemplar, key string, minTimestamp, maxTimestamp int64) []prompb.Exemplar {
+	if !s.IsEnabled() {
+		return dst
+	}
+	b := s.buckets[xxhash.Sum64String(key)%bucketsCount]
+	return b.get(dst, key, minTimestamp, maxTimestamp)
+}
+
+// StorageMetrics contains metrics for the Storage.
+type StorageMetrics struct {
+	ItemsCurrent    uint64
+	MaxItems        uint64
+	AddedTotal      uint64
+	OutOfOrderTotal uint64
+}
+
+// UpdateMetrics updates dst with s metrics.
+func (s *Storage) UpdateMetrics(dst *StorageMetrics) {
+	for _, b := range s.buckets {
+		b.mu.Lock()
+		dst.ItemsCurrent += uint64(len(b.entries))
+		b.mu.Unlock()
+		dst.AddedTotal += b.addedTotal.Load()
+		dst.OutOfOrderTotal += b.outOfOrderTotal.Load()
+	}
+	dst.MaxItems = uint64(s.maxExemplars)
+}
+
+type bucket struct {
+	maxExemplars int
+
+	addedTotal      atomic.Uint64
+	outOfOrderTotal atomic.Uint64
+
+	mu sync.Mutex
+
+	// entries is a ring buffer with up to maxExemplars the most recently added exemplars.
+	entries []entry
+
+	// next is the position in entries for the next exemplar after entries reach maxExemplars.
+	next int
+
+	// seq is the sequence number for the next added entry.
+	seq uint64
+
+	// index maps series key to the position of the most recently added entry for this series in entries.
+	index map[string]int
+}
+
+type entry struct {
+	key      string
+	exemplar prompb.Exemplar
+
+	// seq is the sequence number of the entry.
+	seq uint64
+
+	// prev is the position of the previous entry for the same key in bucket.entries.
+	// The previous entry has been overwritten if its sequence number doesn't match prevSeq.
+	prev    int
+	prevSeq uint64
+}
+
+func (b *bucket) add(key []byte, e *prompb.Exemplar) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev, hasPrev := b.index[string(key)]
+	var prevSeq uint64
+	if hasPrev {
+		pe := &b.entries[prev]
+		if e.Timestamp <= pe.exemplar.Timestamp {
+			if e.Timestamp < pe.exemplar.Timestamp {
+				b.outOfOrderTotal.Add(1)
+			}
+			return
+		}
+		prevSeq = pe.seq
+	} else {
+		prev = -1
+	}
+
+	var pos int
+	if len(b.entries) < b.maxExemplars {
+		pos = len(b.entries)
+		b.entries = append(b.entries, entry{})
+	} else {
+		pos = b.next
+		oldKey := b.entries[pos].key
+		if n, ok := b.index[oldKey]; ok && n == pos {
+			// The overwritten entry is the last one for its series.
+			delete(b.index, oldKey)
+		}
+		b.next++
+		if b.next >= len(b.entries) {
+			b.next = 0
+		}
+	}
+
+	var k string
+	if hasPrev {
+		// Re-use the key string from the previous entry in order to save memory.
+		k = b.entries[prev].key
+	} else {
+		k = string(key)
+	}
+	b.entries[pos] = entry{
+		key:      k,
+		exemplar: cloneExemplar(e),
+		seq:      b.seq,
+		prev:     prev,
+		prevSeq:  prevSeq,
+	}
+	b.index[k] = pos
+	b.seq++
+	b.addedTotal.Add(1)
+}
+
+func (b *bucket) get(dst []prompb.Exemplar, key string, minTimestamp, maxTimestamp int64) []prompb.Exemplar {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, ok := b.index[key]
+	if !ok {
+		return dst
+	}
+	dstLen := len(dst)
+	for {
+		e := &b.entries[n]
+		ts := e.exemplar.Timestamp
+		if ts < minTimestamp {
+			// The remaining entries are older.
+			break
+		}
+		if ts <= maxTimestamp {
+			dst = append(dst, e.exemplar)
+		}
+		if e.prev < 0 || b.entries[e.prev].seq != e.prevSeq {
+			break
+		}
+		n = e.prev
+	}
+
+	// Entries were collected from the newest to the oldest. Reverse them.
+	a := dst[dstLen:]
+	for i, j := 0, len(a)-1; i < j; i, j = i+1, j-1 {
+		a[i], a[j] = a[j], a[i]
+	}
+	return dst
+}
+
+// cloneExemplar returns a copy of e, which doesn't refer to e contents.
+//
+// Label names and values are stored in a single string in order to reduce the number of memory allocations.
+func cloneExemplar(e *prompb.Exemplar) prompb.Exemplar {
+	n := 0
+	for _, label := range e.Labels {
+		n += len(label.Name) + len(label.Value)
+	}
+	var sb strings.Builder
+	sb.Grow(n)
+	for _, label := range e.Labels {
+		sb.WriteString(label.Name)
+		sb.WriteString(label.Value)
+	}
+	s := sb.String()
+
+	var labels []prompb.Label
+	if len(e.Labels) > 0 {
+		labels = make([]prompb.Label, len(e.Labels))
+	}
+	for i, label := range e.Labels {
+		labels[i].Name = s[:len(label.Name)]
+		s = s[len(label.Name):]
+		labels[i].Value = s[:len(label.Value)]
+		s = s[len(label.Value):]
+	}
+	return prompb.Exemplar{
+		Labels:    labels,
+		Value:     e.Value,
+		Timestamp: e.Timestamp,
+	}
+}
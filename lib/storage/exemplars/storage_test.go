@@ -0,0 +1,120 @@
+package exemplars
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestStorageAddGet(t *testing.T) {
+	s := NewStorage(1024)
+
+	newExemplar := func(traceID string, value float64, timestamp int64) *prompb.Exemplar {
+		return &prompb.Exemplar{
+			Labels:    []prompb.Label{{Name: "trace_id", Value: traceID}},
+			Value:     value,
+			Timestamp: timestamp,
+		}
+	}
+
+	f := func(key string, minTimestamp, maxTimestamp int64, resultExpected []prompb.Exemplar) {
+		t.Helper()
+		result := s.Get(nil, key, minTimestamp, maxTimestamp)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected exemplars for key=%q on [%d..%d]\ngot\n%v\nwant\n%v", key, minTimestamp, maxTimestamp, result, resultExpected)
+		}
+	}
+
+	s.Add([]byte("foo"), newExemplar("a", 1, 1000))
+	s.Add([]byte("foo"), newExemplar("b", 2, 2000))
+	s.Add([]byte("bar"), newExemplar("c", 3, 1500))
+	s.Add([]byte("foo"), newExemplar("d", 3, 3000))
+
+	// duplicate and out of order exemplars must be ignored
+	s.Add([]byte("foo"), newExemplar("d", 3, 3000))
+	s.Add([]byte("foo"), newExemplar("e", 4, 2500))
+
+	f("foo", 0, 5000, []prompb.Exemplar{
+		*newExemplar("a", 1, 1000),
+		*newExemplar("b", 2, 2000),
+		*newExemplar("d", 3, 3000),
+	})
+	f("foo", 1500, 2500, []prompb.Exemplar{
+		*newExemplar("b", 2, 2000),
+	})
+	f("foo", 3001, 5000, nil)
+	f("bar", 0, 5000, []prompb.Exemplar{
+		*newExemplar("c", 3, 1500),
+	})
+	f("missing", 0, 5000, nil)
+
+	var m StorageMetrics
+	s.UpdateMetrics(&m)
+	if m.ItemsCurrent != 4 {
+		t.Fatalf("unexpected ItemsCurrent; got %d; want 4", m.ItemsCurrent)
+	}
+	if m.OutOfOrderTotal != 1 {
+		t.Fatalf("unexpected OutOfOrderTotal; got %d; want 1", m.OutOfOrderTotal)
+	}
+
+	// exemplars must be copied
+	labels := []prompb.Label{{Name: "trace_id", Value: "x"}}
+	s.Add([]byte("baz"), &prompb.Exemplar{Labels: labels, Value: 1, Timestamp: 1000})
+	labels[0].Value = "y"
+	f("baz", 0, 5000, []prompb.Exemplar{
+		*newExemplar("x", 1, 1000),
+	})
+}
+
+func TestStorageOverwrite(t *testing.T) {
+	// a single exemplar per bucket
+	s := NewStorage(bucketsCount)
+
+	key := []byte("foo")
+	for i := range 10 {
+		s.Add(key, &prompb.Exemplar{
+			Value:     float64(i),
+			Timestamp: int64(i),
+		})
+	}
+	result := s.Get(nil, string(key), 0, 10)
+	resultExpected := []prompb.Exemplar{{Value: 9, Timestamp: 9}}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected exemplars\ngot\n%v\nwant\n%v", result, resultExpected)
+	}
+
+	// the oldest exemplars must be overwritten by new series
+	s = NewStorage(bucketsCount * 4)
+	for i := range 100 {
+		k := fmt.Sprintf("series_%d", i)
+		s.Add([]byte(k), &prompb.Exemplar{
+			Value:     float64(i),
+			Timestamp: int64(i),
+		})
+	}
+	found := 0
+	for i := range 100 {
+		k := fmt.Sprintf("series_%d", i)
+		found += len(s.Get(nil, k, 0, 100))
+	}
+	if found != bucketsCount*4 {
+		t.Fatalf("unexpected number of found exemplars; got %d; want %d", found, bucketsCount*4)
+	}
+	var m StorageMetrics
+	s.UpdateMetrics(&m)
+	if m.ItemsCurrent != bucketsCount*4 {
+		t.Fatalf("unexpected ItemsCurrent; got %d; want %d", m.ItemsCurrent, bucketsCount*4)
+	}
+	if m.AddedTotal != 100 {
+		t.Fatalf("unexpected AddedTotal; got %d; want 100", m.AddedTotal)
+	}
+
+	// disabled storage
+	s = NewStorage(0)
+	s.Add(key, &prompb.Exemplar{Value: 1, Timestamp: 1})
+	if result := s.Get(nil, string(key), 0, 10); len(result) > 0 {
+		t.Fatalf("unexpected exemplars for disabled storage: %v", result)
+	}
+}
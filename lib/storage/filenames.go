@@ -9,6 +9,7 @@ const (
 	metadataFilename   = "metadata.json"
 
 	appliedRetentionFilename    = "appliedRetention.txt"
+	appliedDownsamplingFilename = "appliedDownsampling.txt"
 	resetCacheOnStartupFilename = "reset_cache_on_startup"
 
 	tsidCacheFilename         = "metricName_tsid"
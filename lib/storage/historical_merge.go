@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// historicalApplyInterval is the minimum interval between applying retention filters
+// and downsampling to historical partitions.
+var historicalApplyInterval = 24 * time.Hour
+
+// isHistoricalApplyNeeded returns true if the deadlines currentTimestamp-offset for the given offsets
+// have advanced over pt data enough since appliedTimestamp.
+//
+// It is used for deciding whether retention filters or downsampling must be applied
+// to historical partitions, which aren't merged in background anymore.
+func (pt *partition) isHistoricalApplyNeeded(offsets []int64, appliedTimestamp, currentTimestamp int64) bool {
+	for _, offset := range offsets {
+		deadline := currentTimestamp - offset
+		if deadline <= pt.tr.MinTimestamp {
+			// The deadline doesn't affect pt data yet.
+			continue
+		}
+		appliedDeadline := appliedTimestamp - offset
+		if appliedDeadline > pt.tr.MaxTimestamp {
+			// The deadline has been already applied to all the pt data.
+			continue
+		}
+		if deadline > pt.tr.MaxTimestamp || deadline-appliedDeadline >= historicalApplyInterval.Milliseconds() {
+			return true
+		}
+	}
+	return false
+}
+
+// mustReadAppliedTimestamp returns the timestamp stored in the given filename at pt
+// via mustWriteAppliedTimestamp for the given config.
+//
+// Zero is returned if the file is missing or if it was written for another config.
+func (pt *partition) mustReadAppliedTimestamp(filename, config string) int64 {
+	path := filepath.Join(pt.bigPartsPath, filename)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("cannot read %q: %s; re-applying it to the partition %s", path, err, pt.name)
+		}
+		return 0
+	}
+	timestampStr, appliedConfig, _ := strings.Cut(string(data), "\n")
+	if appliedConfig != config {
+		return 0
+	}
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		logger.Errorf("cannot parse timestamp from %q: %s; re-applying it to the partition %s", path, err, pt.name)
+		return 0
+	}
+	return timestamp
+}
+
+// mustWriteAppliedTimestamp stores the timestamp when the given config was applied to pt.
+func (pt *partition) mustWriteAppliedTimestamp(filename, config string, timestamp int64) {
+	path := filepath.Join(pt.bigPartsPath, filename)
+	data := fmt.Sprintf("%d\n%s", timestamp, config)
+	fs.MustWriteAtomic(path, []byte(data), true)
+}
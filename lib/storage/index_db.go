@@ -3,6 +3,7 @@ package storage
 import (
 	"bytes"
 	"container/heap"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -380,14 +381,22 @@ type indexSearch struct {
 
 	// deadline in unix timestamp seconds for the given search.
 	deadline uint64
+
+	// ctx is used for stopping the search when it is canceled by the caller.
+	ctx context.Context
 }
 
 // getIndexSearch returns an indexSearch with default configuration
 func (db *indexDB) getIndexSearch(deadline uint64) *indexSearch {
-	return db.getIndexSearchInternal(deadline, false)
+	return db.getIndexSearchInternal(context.Background(), deadline, false)
+}
+
+// getIndexSearchContext returns an indexSearch, which stops the search when ctx is canceled.
+func (db *indexDB) getIndexSearchContext(ctx context.Context, deadline uint64) *indexSearch {
+	return db.getIndexSearchInternal(ctx, deadline, false)
 }
 
-func (db *indexDB) getIndexSearchInternal(deadline uint64, sparse bool) *indexSearch {
+func (db *indexDB) getIndexSearchInternal(ctx context.Context, deadline uint64, sparse bool) *indexSearch {
 	v := db.indexSearchPool.Get()
 	if v == nil {
 		v = &indexSearch{
@@ -397,6 +406,7 @@ func (db *indexDB) getIndexSearchInternal(deadline uint64, sparse bool) *indexSe
 	is := v.(*indexSearch)
 	is.ts.Init(db.tb, sparse)
 	is.deadline = deadline
+	is.ctx = ctx
 	return is
 }
 
@@ -405,6 +415,7 @@ func (db *indexDB) putIndexSearch(is *indexSearch) {
 	is.kb.Reset()
 	is.mp.Reset()
 	is.deadline = 0
+	is.ctx = nil
 
 	db.indexSearchPool.Put(is)
 }
@@ -543,7 +554,7 @@ func (is *indexSearch) searchLabelNamesWithFiltersOnTimeRange(qt *querytracer.Tr
 		wg.Go(func() {
 			defer qtChild.Done()
 
-			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal := is.db.getIndexSearchContext(is.ctx, is.deadline)
 			lnsLocal, err := isLocal.searchLabelNamesWithFiltersOnDate(qtChild, tfss, date, maxLabelNames, maxMetrics)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -615,7 +626,7 @@ func (is *indexSearch) searchLabelNamesWithFiltersOnDate(qt *querytracer.Tracer,
 	lns := make(map[string]struct{})
 	for len(lns) < maxLabelNames && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return nil, err
 			}
 		}
@@ -806,7 +817,7 @@ func (is *indexSearch) searchLabelValuesOnTimeRange(qt *querytracer.Tracer, labe
 		wg.Go(func() {
 			defer qtChild.Done()
 
-			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal := is.db.getIndexSearchContext(is.ctx, is.deadline)
 			lvsLocal, err := isLocal.searchLabelValuesOnDate(qtChild, labelName, tfss, date, maxLabelValues, maxMetrics)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -883,7 +894,7 @@ func (is *indexSearch) searchLabelValuesOnDate(qt *querytracer.Tracer, labelName
 	ts.Seek(prefix)
 	for len(lvs) < maxLabelValues && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return nil, err
 			}
 		}
@@ -1002,7 +1013,7 @@ func (is *indexSearch) searchTagValueSuffixesForTimeRange(tr TimeRange, tagKey,
 	for minDate <= maxDate {
 		date := minDate
 		wg.Go(func() {
-			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal := is.db.getIndexSearchContext(is.ctx, is.deadline)
 			tvssLocal, err := isLocal.searchTagValueSuffixesForDate(date, tagKey, tagValuePrefix, delimiter, maxTagValueSuffixes)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -1061,7 +1072,7 @@ func (is *indexSearch) searchTagValueSuffixesForPrefix(nsPrefix byte, prefix []b
 	tvss := make(map[string]struct{})
 	for len(tvss) < maxTagValueSuffixes && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return nil, err
 			}
 		}
@@ -1268,7 +1279,7 @@ func (is *indexSearch) getSeriesCount() (uint64, error) {
 	ts.Seek(kb.B)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return 0, err
 			}
 		}
@@ -1343,7 +1354,7 @@ func (is *indexSearch) getTSDBStatus(qt *querytracer.Tracer, tfss []*TagFilters,
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return nil, err
 			}
 		}
@@ -1695,7 +1706,7 @@ func (is *indexSearch) loadDeletedMetricIDs() (*uint64set.Set, error) {
 }
 
 // searchMetricIDs returns metricIDs for the given tfss and tr.
-func (db *indexDB) searchMetricIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) (*uint64set.Set, error) {
+func (db *indexDB) searchMetricIDs(ctx context.Context, qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) (*uint64set.Set, error) {
 	qt = qt.NewChild("search metricIDs: filters=%s, timeRange=%s", tfss, &tr)
 	defer qt.Done()
 
@@ -1717,7 +1728,7 @@ func (db *indexDB) searchMetricIDs(qt *querytracer.Tracer, tfss []*TagFilters, t
 	}
 
 	// Slow path - search for metricIDs in the db
-	is := db.getIndexSearch(deadline)
+	is := db.getIndexSearchContext(ctx, deadline)
 	metricIDs, err := is.searchMetricIDs(qt, tfss, tr, maxMetrics)
 	db.putIndexSearch(is)
 	if err != nil {
@@ -1742,6 +1753,11 @@ func (db *indexDB) wrapError(op string, err error) error {
 // The method will fail if the number of found TSIDs exceeds maxMetrics or the
 // search has not completed within the specified deadline.
 func (db *indexDB) SearchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+	return db.searchTSIDs(context.Background(), qt, tfss, tr, maxMetrics, deadline)
+}
+
+// searchTSIDs is like SearchTSIDs, but stops the search when ctx is canceled.
+func (db *indexDB) searchTSIDs(ctx context.Context, qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
 	qt = qt.NewChild("search TSIDs: filters=%s, timeRange=%s, maxMetrics=%d", tfss, &tr, maxMetrics)
 	defer qt.Done()
 
@@ -1750,7 +1766,7 @@ func (db *indexDB) SearchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr Ti
 		return nil, nil
 	}
 
-	metricIDs, err := db.searchMetricIDs(qt, tfss, tr, maxMetrics, deadline)
+	metricIDs, err := db.searchMetricIDs(ctx, qt, tfss, tr, maxMetrics, deadline)
 	if err != nil {
 		return nil, db.wrapError("search TSIDs", err)
 	}
@@ -1762,12 +1778,12 @@ func (db *indexDB) SearchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr Ti
 	metricIDsToDelete := &uint64set.Set{}
 	i := 0
 	paceLimiter := 0
-	is := db.getIndexSearch(deadline)
+	is := db.getIndexSearchContext(ctx, deadline)
 	defer db.putIndexSearch(is)
 	metricIDs.ForEach(func(metricIDs []uint64) bool {
 		for _, metricID := range metricIDs {
 			if paceLimiter&paceLimiterSlowIterationsMask == 0 {
-				if err = checkSearchDeadlineAndPace(deadline); err != nil {
+				if err = is.checkSearchDeadlineAndPace(); err != nil {
 					return false
 				}
 			}
@@ -1824,7 +1840,7 @@ func (db *indexDB) SearchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr Ti
 // searchMetricName appends metric name for the given metricID to dst
 // and returns the result.
 func (db *indexDB) searchMetricName(dst []byte, metricID uint64, noCache bool) ([]byte, bool) {
-	is := db.getIndexSearchInternal(noDeadline, noCache)
+	is := db.getIndexSearchInternal(context.Background(), noDeadline, noCache)
 	defer db.putIndexSearch(is)
 	return is.searchMetricName(dst, metricID)
 }
@@ -1838,7 +1854,7 @@ func (db *indexDB) SearchMetricNames(qt *querytracer.Tracer, tfss []*TagFilters,
 		return nil, nil
 	}
 
-	metricIDs, err := db.searchMetricIDs(qt, tfss, tr, maxMetrics, deadline)
+	metricIDs, err := db.searchMetricIDs(context.Background(), qt, tfss, tr, maxMetrics, deadline)
 	if err != nil {
 		return nil, db.wrapError("search metric names", err)
 	}
@@ -1856,7 +1872,7 @@ func (db *indexDB) SearchMetricNames(qt *querytracer.Tracer, tfss []*TagFilters,
 	metricIDs.ForEach(func(metricIDs []uint64) bool {
 		for _, metricID := range metricIDs {
 			if paceLimiter&paceLimiterSlowIterationsMask == 0 {
-				if err = checkSearchDeadlineAndPace(deadline); err != nil {
+				if err = is.checkSearchDeadlineAndPace(); err != nil {
 					return false
 				}
 			}
@@ -2011,7 +2027,7 @@ func (is *indexSearch) updateMetricIDsByMetricNameMatch(qt *querytracer.Tracer,
 	defer PutMetricName(mn)
 	for loopsPaceLimiter, metricID := range sortedMetricIDs {
 		if loopsPaceLimiter&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return err
 			}
 		}
@@ -2346,7 +2362,7 @@ func (is *indexSearch) getMetricIDsForTagFilterSlow(tf *tagFilter, f func(metric
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterMediumIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return loopsCount, err
 			}
 		}
@@ -2450,7 +2466,7 @@ func (is *indexSearch) updateMetricIDsForOrSuffix(prefix []byte, metricIDs *uint
 	ts.Seek(prefix)
 	for metricIDs.Len() < maxMetrics && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return loopsCount, err
 			}
 		}
@@ -2499,7 +2515,7 @@ func (is *indexSearch) updateMetricIDsForDateRange(qt *querytracer.Tracer, metri
 		wg.Go(func() {
 			defer qtChild.Done()
 
-			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal := is.db.getIndexSearchContext(is.ctx, is.deadline)
 			m, err := isLocal.getMetricIDsForDateAndFilters(qtChild, date, tfs, maxMetrics)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -3040,7 +3056,7 @@ func (is *indexSearch) updateMetricIDsForPrefix(prefix []byte, metricIDs *uint64
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := is.checkSearchDeadlineAndPace(); err != nil {
 				return err
 			}
 		}
@@ -16,11 +16,16 @@ import (
 // mergeBlockStreams returns immediately if stopCh is closed.
 //
 // rowsMerged is atomically updated with the number of merged rows during the merge.
-func mergeBlockStreams(ph *partHeader, bsw *blockStreamWriter, bsrs []*blockStreamReader, stopCh <-chan struct{}, dmis *uint64set.Set, retentionDeadline int64, rowsMerged, rowsDeleted *atomic.Uint64) error {
+//
+// sr may contain per-series retention deadlines, which override retentionDeadline. It may be nil.
+//
+// sd applies downsampling to the merged blocks. It may be nil.
+func mergeBlockStreams(ph *partHeader, bsw *blockStreamWriter, bsrs []*blockStreamReader, stopCh <-chan struct{}, dmis *uint64set.Set,
+	retentionDeadline int64, sr *seriesRetention, sd *seriesDownsampling, rowsMerged, rowsDeleted *atomic.Uint64) error {
 	ph.Reset()
 
 	bsm := bsmPool.Get().(*blockStreamMerger)
-	bsm.Init(bsrs, retentionDeadline)
+	bsm.Init(bsrs, retentionDeadline, sr, sd)
 	err := mergeBlockStreamsInternal(ph, bsw, bsm, stopCh, dmis, rowsMerged, rowsDeleted)
 	bsm.reset()
 	bsmPool.Put(bsm)
@@ -62,6 +67,13 @@ func mergeBlockStreamsInternal(ph *partHeader, bsw *blockStreamWriter, bsm *bloc
 	}
 	defer updateStats()
 
+	writeBlock := func(b *Block) {
+		if bsm.sd != nil {
+			bsm.sd.downsampleBlock(b)
+		}
+		bsw.WriteExternalBlock(b, ph, &localRowsMerged)
+	}
+
 	for bsm.NextBlock() {
 		ct := fasttime.UnixTimestamp()
 		if ct > updateStatsDeadline {
@@ -88,6 +100,15 @@ func mergeBlockStreamsInternal(ph *partHeader, bsw *blockStreamWriter, bsm *bloc
 			localRowsDeleted += uint64(b.bh.RowsCount)
 			continue
 		}
+		if retentionDeadline > bsm.retentionDeadline && b.bh.MinTimestamp < retentionDeadline {
+			// The block contains samples outside the retention configured via retention filters for the given series.
+			// Drop them.
+			if err := b.UnmarshalData(); err != nil {
+				return fmt.Errorf("cannot unmarshal block for applying retention filters: %w", err)
+			}
+			skipSamplesOutsideRetention(b, retentionDeadline, &localRowsDeleted)
+			b.fixupTimestamps()
+		}
 		if pendingBlockIsEmpty {
 			// Load the next block if pendingBlock is empty.
 			pendingBlock.CopyFrom(b)
@@ -102,14 +123,14 @@ func mergeBlockStreamsInternal(ph *partHeader, bsw *blockStreamWriter, bsm *bloc
 			if b.bh.TSID.Less(&pendingBlock.bh.TSID) {
 				logger.Panicf("BUG: the next TSID=%+v is smaller than the current TSID=%+v", &b.bh.TSID, &pendingBlock.bh.TSID)
 			}
-			bsw.WriteExternalBlock(pendingBlock, ph, &localRowsMerged)
+			writeBlock(pendingBlock)
 			pendingBlock.CopyFrom(b)
 			continue
 		}
 		if pendingBlock.tooBig() && pendingBlock.bh.MaxTimestamp <= b.bh.MinTimestamp {
 			// Fast path - pendingBlock is too big and it doesn't overlap with b.
 			// Write the pendingBlock and then deal with b.
-			bsw.WriteExternalBlock(pendingBlock, ph, &localRowsMerged)
+			writeBlock(pendingBlock)
 			pendingBlock.CopyFrom(b)
 			continue
 		}
@@ -145,13 +166,13 @@ func mergeBlockStreamsInternal(ph *partHeader, bsw *blockStreamWriter, bsm *bloc
 		tmpBlock.timestamps = tmpBlock.timestamps[:maxRowsPerBlock]
 		tmpBlock.values = tmpBlock.values[:maxRowsPerBlock]
 		tmpBlock.fixupTimestamps()
-		bsw.WriteExternalBlock(tmpBlock, ph, &localRowsMerged)
+		writeBlock(tmpBlock)
 	}
 	if err := bsm.Error(); err != nil {
 		return fmt.Errorf("cannot read block to be merged: %w", err)
 	}
 	if !pendingBlockIsEmpty {
-		bsw.WriteExternalBlock(pendingBlock, ph, &localRowsMerged)
+		writeBlock(pendingBlock)
 	}
 	return nil
 }
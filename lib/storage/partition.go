@@ -77,6 +77,12 @@ type partition struct {
 
 	isDedupScheduled atomic.Bool
 
+	// isRetentionFiltersScheduled is set to true when the retention filters are scheduled to be applied to the partition.
+	isRetentionFiltersScheduled atomic.Bool
+
+	// isDownsamplingScheduled is set to true when the downsampling is scheduled to be applied to the partition.
+	isDownsamplingScheduled atomic.Bool
+
 	mergeIdx atomic.Uint64
 
 	// the path to directory with smallParts.
@@ -363,6 +369,9 @@ type partitionMetrics struct {
 	ScheduledDownsamplingPartitions     uint64
 	ScheduledDownsamplingPartitionsSize uint64
 
+	ScheduledRetentionFiltersPartitions     uint64
+	ScheduledRetentionFiltersPartitionsSize uint64
+
 	IndexDBMetrics IndexDBMetrics
 }
 
@@ -377,10 +386,14 @@ func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 
 	pt.partsLock.Lock()
 
-	isDedupScheduled := pt.isDedupScheduled.Load()
-	if isDedupScheduled {
+	isDownsamplingScheduled := pt.isDedupScheduled.Load() || pt.isDownsamplingScheduled.Load()
+	if isDownsamplingScheduled {
 		m.ScheduledDownsamplingPartitions++
 	}
+	isRetentionFiltersScheduled := pt.isRetentionFiltersScheduled.Load()
+	if isRetentionFiltersScheduled {
+		m.ScheduledRetentionFiltersPartitions++
+	}
 
 	for _, pw := range pt.inmemoryParts {
 		p := pw.p
@@ -389,9 +402,12 @@ func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 		m.InmemorySizeBytes += p.size
 		m.MetaindexSizeBytes += p.metaindexSizeBytes
 		m.InmemoryPartsRefCount += uint64(pw.refCount.Load())
-		if isDedupScheduled {
+		if isDownsamplingScheduled {
 			m.ScheduledDownsamplingPartitionsSize += p.size
 		}
+		if isRetentionFiltersScheduled {
+			m.ScheduledRetentionFiltersPartitionsSize += p.size
+		}
 	}
 	for _, pw := range pt.smallParts {
 		p := pw.p
@@ -400,9 +416,12 @@ func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 		m.SmallSizeBytes += p.size
 		m.MetaindexSizeBytes += p.metaindexSizeBytes
 		m.SmallPartsRefCount += uint64(pw.refCount.Load())
-		if isDedupScheduled {
+		if isDownsamplingScheduled {
 			m.ScheduledDownsamplingPartitionsSize += p.size
 		}
+		if isRetentionFiltersScheduled {
+			m.ScheduledRetentionFiltersPartitionsSize += p.size
+		}
 	}
 	for _, pw := range pt.bigParts {
 		p := pw.p
@@ -411,9 +430,12 @@ func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 		m.BigSizeBytes += p.size
 		m.MetaindexSizeBytes += p.metaindexSizeBytes
 		m.BigPartsRefCount += uint64(pw.refCount.Load())
-		if isDedupScheduled {
+		if isDownsamplingScheduled {
 			m.ScheduledDownsamplingPartitionsSize += p.size
 		}
+		if isRetentionFiltersScheduled {
+			m.ScheduledRetentionFiltersPartitionsSize += p.size
+		}
 	}
 
 	m.InmemoryPartsCount += uint64(len(pt.inmemoryParts))
@@ -1246,7 +1268,7 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isFi
 	mergeIdx := pt.nextMergeIdx()
 	dstPartPath := pt.getDstPartPath(dstPartType, mergeIdx)
 
-	if !isDedupEnabled() && isFinal && len(pws) == 1 && pws[0].mp != nil {
+	if !isDedupEnabled() && isFinal && len(pws) == 1 && pws[0].mp != nil && !pt.isMergeFiltersNeeded(&pws[0].mp.ph, startTime.UnixMilli()) {
 		// Fast path: flush a single in-memory part to disk.
 		mp := pws[0].mp
 		mp.MustStoreToDisk(dstPartPath)
@@ -1426,9 +1448,16 @@ func (pt *partition) mergePartsInternal(dstPartPath string, bsw *blockStreamWrit
 	}
 	retentionDeadline := currentTimestamp - pt.s.retentionMsecs
 	activeMerges.Add(1)
-	_ = useSparseCache // unused in OSS version.
 	dmis := pt.idb.getDeletedMetricIDs()
-	err := mergeBlockStreams(&ph, bsw, bsrs, stopCh, dmis, retentionDeadline, rowsMerged, rowsDeleted)
+	sr := pt.newSeriesRetention(currentTimestamp, useSparseCache)
+	sd := pt.newSeriesDownsampling(currentTimestamp, useSparseCache)
+	err := mergeBlockStreams(&ph, bsw, bsrs, stopCh, dmis, retentionDeadline, sr, sd, rowsMerged, rowsDeleted)
+	if sr != nil {
+		sr.release()
+	}
+	if sd != nil {
+		sd.release()
+	}
 	activeMerges.Add(-1)
 	mergesCount.Add(1)
 	if err != nil {
@@ -1467,6 +1496,11 @@ func (pt *partition) openCreatedPart(ph *partHeader, pws []*partWrapper, mpNew *
 	return pwNew
 }
 
+// isMergeFiltersNeeded returns true if retention filters or downsampling must be applied at currentTimestamp to the part with the given ph.
+func (pt *partition) isMergeFiltersNeeded(ph *partHeader, currentTimestamp int64) bool {
+	return ph.MinTimestamp < pt.getMaxRetentionFiltersDeadline(currentTimestamp) || isDownsamplingNeeded(ph.MinTimestamp, currentTimestamp)
+}
+
 func areAllInmemoryParts(pws []*partWrapper) bool {
 	for _, pw := range pws {
 		if pw.mp == nil {
@@ -1865,14 +1899,17 @@ func (pt *partition) mustCreateSnapshot(srcDir, dstDir string, pws []*partWrappe
 		fs.MustHardLinkFiles(srcPartPath, dstPartPath)
 	}
 
-	// Copy the appliedRetentionFilename to dstDir.
-	// This file can be created by VictoriaMetrics Enterprise.
-	// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention-filters .
-	// Do not make hard link to this file, since it can be modified over time.
-	srcPath := filepath.Join(srcDir, appliedRetentionFilename)
-	if fs.IsPathExist(srcPath) {
-		dstPath := filepath.Join(dstDir, filepath.Base(srcPath))
-		fs.MustCopyFile(srcPath, dstPath)
+	// Copy the appliedRetentionFilename and appliedDownsamplingFilename to dstDir.
+	// These files are created when retention filters and downsampling are applied to the partition.
+	// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention-filters
+	// and https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#downsampling .
+	// Do not make hard links to these files, since they can be modified over time.
+	for _, filename := range []string{appliedRetentionFilename, appliedDownsamplingFilename} {
+		srcPath := filepath.Join(srcDir, filename)
+		if fs.IsPathExist(srcPath) {
+			dstPath := filepath.Join(dstDir, filepath.Base(srcPath))
+			fs.MustCopyFile(srcPath, dstPath)
+		}
 	}
 }
 
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+// RetentionFilter holds the retention for time series matching the given series filter.
+//
+// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention-filters
+type RetentionFilter struct {
+	// Filter is the series filter such as {env="dev"}.
+	Filter *promrelabel.IfExpression
+
+	// Retention is the retention for time series matching the Filter.
+	Retention time.Duration
+
+	// s is the original string representation of the filter.
+	s string
+}
+
+// ParseRetentionFilter parses retention filter in the form `filter:duration`.
+//
+// For example, `{env="dev"}:7d` or `{__name__=~"debug_.*"}:2d`.
+func ParseRetentionFilter(s string) (*RetentionFilter, error) {
+	n := strings.LastIndexByte(s, ':')
+	if n < 0 {
+		return nil, fmt.Errorf("missing `:duration` suffix in the retention filter %q", s)
+	}
+	var ie promrelabel.IfExpression
+	if err := ie.Parse(s[:n]); err != nil {
+		return nil, fmt.Errorf("cannot parse series filter in the retention filter %q: %w", s, err)
+	}
+	var d flagutil.RetentionDuration
+	if err := d.Set(s[n+1:]); err != nil {
+		return nil, fmt.Errorf("cannot parse duration in the retention filter %q: %w", s, err)
+	}
+	if d.Milliseconds() <= 0 {
+		return nil, fmt.Errorf("duration in the retention filter %q must be positive", s)
+	}
+	rf := &RetentionFilter{
+		Filter:    &ie,
+		Retention: d.Duration(),
+		s:         s,
+	}
+	return rf, nil
+}
+
+// String returns string representation of rf.
+func (rf *RetentionFilter) String() string {
+	if rf.s != "" {
+		return rf.s
+	}
+	return fmt.Sprintf("%s:%s", rf.Filter, rf.Retention)
+}
+
+func retentionFiltersString(rfs []*RetentionFilter) string {
+	a := make([]string, len(rfs))
+	for i, rf := range rfs {
+		a[i] = rf.String()
+	}
+	return strings.Join(a, ",")
+}
+
+// seriesRetention returns retention deadlines for individual series according to the configured retention filters.
+//
+// It is used during background merges for dropping samples outside the retention of the matching series.
+type seriesRetention struct {
+	rfs []*RetentionFilter
+	mns *metricNameSearch
+
+	currentTimestamp int64
+
+	// globalDeadline is the deadline for series, which do not match any of rfs.
+	globalDeadline int64
+
+	// maxDeadline is the biggest deadline across rfs.
+	// Blocks with samples newer than maxDeadline cannot be affected by rfs.
+	maxDeadline int64
+
+	// lastMetricID and lastDeadline hold the deadline for the last seen series,
+	// since merged blocks are sorted by TSID.
+	lastMetricID uint64
+	lastDeadline int64
+	hasLast      bool
+
+	metricName []byte
+	mn         MetricName
+	labels     []prompb.Label
+}
+
+// newSeriesRetention returns seriesRetention for the merge of pt parts at currentTimestamp.
+//
+// nil is returned if retention filters aren't configured.
+// The returned seriesRetention must be released via release() when no longer needed.
+func (pt *partition) newSeriesRetention(currentTimestamp int64, useSparseCache bool) *seriesRetention {
+	rfs := pt.s.retentionFilters
+	if len(rfs) == 0 {
+		return nil
+	}
+	maxDeadline := pt.getMaxRetentionFiltersDeadline(currentTimestamp)
+	if maxDeadline <= pt.tr.MinTimestamp {
+		// Fast path - retention filters do not affect the partition data yet.
+		return nil
+	}
+
+	// Do not use pt.s.tb for obtaining partition indexDBs, since it may be nil
+	// when the merge is started during the storage opening.
+	// Series stored in pt have metric names either in pt.idb or in legacy indexDBs.
+	mns := &metricNameSearch{
+		storage:        pt.s,
+		idbs:           []*indexDB{pt.idb},
+		legacyIDBs:     pt.s.getLegacyIndexDBs(),
+		useSparseCache: useSparseCache,
+	}
+	return &seriesRetention{
+		rfs:              rfs,
+		mns:              mns,
+		currentTimestamp: currentTimestamp,
+		globalDeadline:   currentTimestamp - pt.s.retentionMsecs,
+		maxDeadline:      maxDeadline,
+	}
+}
+
+// getMaxRetentionFiltersDeadline returns the biggest retention deadline across the configured retention filters at currentTimestamp.
+//
+// Samples with bigger timestamps cannot be dropped by retention filters.
+func (pt *partition) getMaxRetentionFiltersDeadline(currentTimestamp int64) int64 {
+	maxDeadline := currentTimestamp - pt.s.retentionMsecs
+	for _, rf := range pt.s.retentionFilters {
+		maxDeadline = max(maxDeadline, currentTimestamp-rf.Retention.Milliseconds())
+	}
+	return maxDeadline
+}
+
+func (sr *seriesRetention) release() {
+	sr.mns.storage.putLegacyIndexDBs(sr.mns.legacyIDBs)
+	sr.mns = nil
+}
+
+// getDeadline returns the retention deadline for the series the block with the given bh belongs to.
+func (sr *seriesRetention) getDeadline(bh *blockHeader) int64 {
+	if bh.MinTimestamp >= sr.maxDeadline {
+		// Fast path - the block cannot contain samples outside the retention of any retention filter.
+		return sr.globalDeadline
+	}
+	metricID := bh.TSID.MetricID
+	if sr.hasLast && sr.lastMetricID == metricID {
+		return sr.lastDeadline
+	}
+	deadline := sr.getDeadlineForMetricID(metricID)
+	sr.lastMetricID = metricID
+	sr.lastDeadline = deadline
+	sr.hasLast = true
+	return deadline
+}
+
+func (sr *seriesRetention) getDeadlineForMetricID(metricID uint64) int64 {
+	var ok bool
+	sr.metricName, ok = sr.mns.search(sr.metricName[:0], metricID)
+	if !ok {
+		// The metric name may be missing for deleted series.
+		// Apply the global retention to them.
+		return sr.globalDeadline
+	}
+	if err := sr.mn.Unmarshal(sr.metricName); err != nil {
+		logger.Panicf("FATAL: cannot unmarshal metricName %q for metricID=%d: %s", sr.metricName, metricID, err)
+	}
+	sr.labels = sr.mn.appendPromLabels(sr.labels[:0])
+
+	// If series matches multiple retention filters, then the smallest retention is applied.
+	deadline := sr.globalDeadline
+	for _, rf := range sr.rfs {
+		if rf.Filter.Match(sr.labels) {
+			deadline = max(deadline, sr.currentTimestamp-rf.Retention.Milliseconds())
+		}
+	}
+	return deadline
+}
+
+func (mn *MetricName) appendPromLabels(dst []prompb.Label) []prompb.Label {
+	dst = append(dst, prompb.Label{
+		Name:  "__name__",
+		Value: bytesutil.ToUnsafeString(mn.MetricGroup),
+	})
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		dst = append(dst, prompb.Label{
+			Name:  bytesutil.ToUnsafeString(tag.Key),
+			Value: bytesutil.ToUnsafeString(tag.Value),
+		})
+	}
+	return dst
+}
+
+// isRetentionFiltersApplyNeeded returns true if the retention filters must be applied
+// to the historical data in pt at currentTimestamp.
+func (pt *partition) isRetentionFiltersApplyNeeded(currentTimestamp int64) bool {
+	rfs := pt.s.retentionFilters
+	if len(rfs) == 0 {
+		return false
+	}
+	offsets := make([]int64, len(rfs))
+	for i, rf := range rfs {
+		offsets[i] = rf.Retention.Milliseconds()
+	}
+	appliedTimestamp := pt.mustReadAppliedRetention()
+	return pt.isHistoricalApplyNeeded(offsets, appliedTimestamp, currentTimestamp)
+}
+
+// mustReadAppliedRetention returns the timestamp when the currently configured retention filters
+// were applied to pt the last time.
+//
+// Zero is returned if the retention filters weren't applied yet or if they were changed since then.
+func (pt *partition) mustReadAppliedRetention() int64 {
+	return pt.mustReadAppliedTimestamp(appliedRetentionFilename, retentionFiltersString(pt.s.retentionFilters))
+}
+
+// mustWriteAppliedRetention stores the timestamp when the currently configured retention filters were applied to pt.
+func (pt *partition) mustWriteAppliedRetention(timestamp int64) {
+	pt.mustWriteAppliedTimestamp(appliedRetentionFilename, retentionFiltersString(pt.s.retentionFilters), timestamp)
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestParseRetentionFilter_Failure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, err := ParseRetentionFilter(s); err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q", s)
+		}
+	}
+	f("")
+	f(`{env="dev"}`)
+	f(`{env="dev"}:`)
+	f(`{env="dev"}:foo`)
+	f(`{env="dev"}:0d`)
+	f(`{env=~"dev}:1d`)
+}
+
+func TestParseRetentionFilter_Success(t *testing.T) {
+	f := func(s string, labels []prompb.Label, matchExpected bool, retentionExpected time.Duration) {
+		t.Helper()
+		rf, err := ParseRetentionFilter(s)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		if rf.String() != s {
+			t.Fatalf("unexpected string representation; got %q; want %q", rf.String(), s)
+		}
+		if rf.Retention != retentionExpected {
+			t.Fatalf("unexpected retention; got %s; want %s", rf.Retention, retentionExpected)
+		}
+		if match := rf.Filter.Match(labels); match != matchExpected {
+			t.Fatalf("unexpected match result for %s; got %v; want %v", labels, match, matchExpected)
+		}
+	}
+	labels := []prompb.Label{
+		{Name: "__name__", Value: "debug_requests_total"},
+		{Name: "env", Value: "dev"},
+		{Name: "url", Value: "http://foo:8080/"},
+	}
+	f(`{env="dev"}:7d`, labels, true, 7*24*time.Hour)
+	f(`{env="prod"}:7d`, labels, false, 7*24*time.Hour)
+	f(`{__name__=~"debug_.*"}:2d`, labels, true, 2*24*time.Hour)
+	f(`{env="dev",url="http://foo:8080/"}:12h`, labels, true, 12*time.Hour)
+	f(`debug_requests_total:1w`, labels, true, 7*24*time.Hour)
+	f(`{env=~"dev|staging"}:1y`, labels, true, 365*24*time.Hour)
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -183,6 +184,9 @@ type Search struct {
 	// deadline in unix timestamp seconds for the current search.
 	deadline uint64
 
+	// ctx is used for stopping the search when it is canceled by the caller.
+	ctx context.Context
+
 	err error
 
 	needClosing bool
@@ -208,6 +212,7 @@ func (s *Search) reset() {
 	s.tr = TimeRange{}
 	s.tfss = nil
 	s.deadline = 0
+	s.ctx = nil
 	s.err = nil
 	s.needClosing = false
 	s.loops = 0
@@ -222,6 +227,11 @@ func (s *Search) reset() {
 //
 // Init returns the upper bound on the number of found time series.
 func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) int {
+	return s.InitWithContext(context.Background(), qt, storage, tfss, tr, maxMetrics, deadline)
+}
+
+// InitWithContext is like Init, but stops the search when ctx is canceled.
+func (s *Search) InitWithContext(ctx context.Context, qt *querytracer.Tracer, storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) int {
 	qt = qt.NewChild("init series search: filters=%s, timeRange=%s, maxMetrics=%d", tfss, &tr, maxMetrics)
 	defer qt.Done()
 
@@ -237,9 +247,10 @@ func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilte
 	s.tr = tr
 	s.tfss = tfss
 	s.deadline = deadline
+	s.ctx = ctx
 	s.needClosing = true
 
-	tsids, err := storage.SearchTSIDs(qt, tfss, tr, maxMetrics, deadline)
+	tsids, err := storage.searchTSIDs(ctx, qt, tfss, tr, maxMetrics, deadline)
 
 	// It is ok to call Init on non-nil err.
 	// Init must be called before returning because it will fail
@@ -278,7 +289,7 @@ func (s *Search) NextMetricBlock() bool {
 	}
 	for s.ts.NextBlock() {
 		if s.loops&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(s.deadline); err != nil {
+			if err := checkSearchContextAndDeadline(s.ctx, s.deadline); err != nil {
 				s.err = err
 				return false
 			}
@@ -600,6 +611,19 @@ func checkSearchDeadlineAndPace(deadline uint64) error {
 	return nil
 }
 
+// checkSearchContextAndDeadline returns an error if ctx is canceled or if the deadline is exceeded.
+func checkSearchContextAndDeadline(ctx context.Context, deadline uint64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("the search has been canceled: %w", err)
+	}
+	return checkSearchDeadlineAndPace(deadline)
+}
+
+// checkSearchDeadlineAndPace returns an error if is has been canceled or if its deadline is exceeded.
+func (is *indexSearch) checkSearchDeadlineAndPace() error {
+	return checkSearchContextAndDeadline(is.ctx, is.deadline)
+}
+
 const (
 	paceLimiterFastIterationsMask   = 1<<16 - 1
 	paceLimiterMediumIterationsMask = 1<<14 - 1
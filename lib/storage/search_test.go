@@ -2,6 +2,8 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -192,6 +194,47 @@ func TestSearch_VariousTimeRanges(t *testing.T) {
 	testStorageOpOnVariousTimeRanges(t, f)
 }
 
+func TestSearch_Canceled(t *testing.T) {
+	defer testRemoveAll(t)
+
+	st := MustOpenStorage(t.Name(), OpenOptions{})
+	defer st.MustClose()
+
+	const rowsCount = 100
+	mrs := make([]MetricRow, rowsCount)
+	startTimestamp := timestampFromTime(time.Now())
+	for i := range mrs {
+		mn := MetricName{MetricGroup: fmt.Appendf(nil, "metric_%d", i)}
+		mrs[i].MetricNameRaw = mn.marshalRaw(nil)
+		mrs[i].Timestamp = startTimestamp + int64(i)
+		mrs[i].Value = float64(i)
+	}
+	st.AddRows(mrs, defaultPrecisionBits)
+	st.DebugFlush()
+
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("metric_.*"), false, true); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: startTimestamp,
+		MaxTimestamp: startTimestamp + rowsCount,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var sr Search
+	sr.InitWithContext(ctx, nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+	defer sr.MustClose()
+	for sr.NextMetricBlock() {
+		t.Fatalf("unexpected metric block for canceled search")
+	}
+	if err := sr.Error(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error for canceled search; got %v; want %v", err, context.Canceled)
+	}
+}
+
 // TestStorageAddFlushSearchDataConcurrently verifies that concurrent goroutines
 // can read their own writes.
 //
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -21,8 +22,10 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/snapshot/snapshotutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage/exemplars"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage/metricnamestats"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage/metricsmetadata"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
@@ -159,6 +162,13 @@ type Storage struct {
 	logNewSeriesUntil atomic.Uint64
 
 	metadataStorage *metricsmetadata.Storage
+
+	exemplarsStorage *exemplars.Storage
+
+	// retentionFilters contains per-series retentions applied during background merges.
+	//
+	// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention-filters
+	retentionFilters []*RetentionFilter
 }
 
 // OpenOptions optional args for MustOpenStorage
@@ -173,6 +183,7 @@ type OpenOptions struct {
 	TrackMetricNamesStats       bool
 	IDBPrefillStart             time.Duration
 	LogNewSeries                bool
+	RetentionFilters            []*RetentionFilter
 }
 
 // MustOpenStorage opens storage on the given path with the given retentionMsecs.
@@ -206,6 +217,7 @@ func MustOpenStorage(path string, opts OpenOptions) *Storage {
 		denyQueriesOutsideRetention: opts.DenyQueriesOutsideRetention,
 		stopCh:                      make(chan struct{}),
 		idbPrefillStartSeconds:      idbPrefillStart.Milliseconds() / 1000,
+		retentionFilters:            opts.RetentionFilters,
 	}
 	s.logNewSeries.Store(opts.LogNewSeries)
 
@@ -262,6 +274,7 @@ func MustOpenStorage(path string, opts OpenOptions) *Storage {
 	}
 
 	s.metadataStorage = metricsmetadata.NewStorage(getMetadataStorageSize())
+	s.exemplarsStorage = exemplars.NewStorage(maxExemplars)
 
 	// Load metadata
 	metadataDir := filepath.Join(path, metadataDirname)
@@ -384,6 +397,15 @@ func SetMetadataStorageSize(size int) {
 	maxMetadataStorageSize = size
 }
 
+var maxExemplars = 100_000
+
+// SetMaxExemplars sets the maximum number of exemplars to keep in memory.
+//
+// Exemplars aren't stored if n <= 0.
+func SetMaxExemplars(n int) {
+	maxExemplars = n
+}
+
 func getMetadataStorageSize() int {
 	if maxMetadataStorageSize <= 0 {
 		return memory.Allowed() / 100
@@ -540,6 +562,8 @@ type Metrics struct {
 	DedupsDuringMerge uint64
 	SnapshotsCount    uint64
 
+	DownsampledSamplesDuringMerge uint64
+
 	TooSmallTimestampRows uint64
 	TooBigTimestampRows   uint64
 	InvalidRawMetricNames uint64
@@ -598,6 +622,11 @@ type Metrics struct {
 	MetadataStorageCurrentSizeBytes uint64
 	MetadataStorageMaxSizeBytes     uint64
 
+	ExemplarsStorageItemsCurrent uint64
+	ExemplarsStorageMaxItems     uint64
+	ExemplarsAddedTotal          uint64
+	ExemplarsOutOfOrderTotal     uint64
+
 	DeletedMetricsCount uint64
 
 	TableMetrics TableMetrics
@@ -613,6 +642,7 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.RowsReceivedTotal += s.rowsReceivedTotal.Load()
 	m.RowsAddedTotal += s.rowsAddedTotal.Load()
 	m.DedupsDuringMerge = dedupsDuringMerge.Load()
+	m.DownsampledSamplesDuringMerge = downsampledSamplesDuringMerge.Load()
 	m.SnapshotsCount += uint64(s.mustGetSnapshotsCount())
 
 	m.TooSmallTimestampRows += s.tooSmallTimestampRows.Load()
@@ -690,6 +720,13 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.MetadataStorageCurrentSizeBytes = mr.CurrentSizeBytes
 	m.MetadataStorageMaxSizeBytes = mr.MaxSizeBytes
 
+	var em exemplars.StorageMetrics
+	s.exemplarsStorage.UpdateMetrics(&em)
+	m.ExemplarsStorageItemsCurrent = em.ItemsCurrent
+	m.ExemplarsStorageMaxItems = em.MaxItems
+	m.ExemplarsAddedTotal = em.AddedTotal
+	m.ExemplarsOutOfOrderTotal = em.OutOfOrderTotal
+
 	d := max(s.legacyNextRetentionSeconds(), 0)
 	m.NextRetentionSeconds = uint64(d)
 
@@ -1270,6 +1307,11 @@ func (s *Storage) checkTimeRange(tr TimeRange) error {
 // The method will fail if the number of found TSIDs exceeds maxMetrics or the
 // search has not completed within the specified deadline.
 func (s *Storage) SearchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+	return s.searchTSIDs(context.Background(), qt, tfss, tr, maxMetrics, deadline)
+}
+
+// searchTSIDs is like SearchTSIDs, but stops the search when ctx is canceled.
+func (s *Storage) searchTSIDs(ctx context.Context, qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
 	qt = qt.NewChild("search TSIDs: filters=%s, timeRange=%s, maxMetrics=%d", tfss, &tr, maxMetrics)
 	defer qt.Done()
 
@@ -1278,7 +1320,7 @@ func (s *Storage) SearchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr Tim
 	}
 
 	search := func(qt *querytracer.Tracer, idb *indexDB, tr TimeRange) ([]TSID, error) {
-		return idb.SearchTSIDs(qt, tfss, tr, maxMetrics, deadline)
+		return idb.searchTSIDs(ctx, qt, tfss, tr, maxMetrics, deadline)
 	}
 
 	merge := func(data [][]TSID) []TSID {
@@ -2685,3 +2727,75 @@ func (s *Storage) GetMetadataRows(qt *querytracer.Tracer, limit int, metricName
 func (s *Storage) AddMetadataRows(rows []metricsmetadata.Row) {
 	s.metadataStorage.Add(rows)
 }
+
+// ExemplarRow is an exemplar for the time series with the given MetricNameRaw.
+type ExemplarRow struct {
+	// MetricNameRaw contains raw metric name, which must be decoded
+	// with MetricName.UnmarshalRaw.
+	MetricNameRaw []byte
+
+	Exemplar prompb.Exemplar
+}
+
+// AddExemplars adds the given exemplars to s.
+//
+// Exemplars are kept in memory, so they are lost after the restart.
+func (s *Storage) AddExemplars(rows []ExemplarRow) {
+	if len(rows) == 0 || !s.exemplarsStorage.IsEnabled() {
+		return
+	}
+	mn := GetMetricName()
+	defer PutMetricName(mn)
+
+	var metricNameBuf []byte
+	for i := range rows {
+		r := &rows[i]
+		if err := mn.UnmarshalRaw(r.MetricNameRaw); err != nil {
+			s.invalidRawMetricNames.Add(1)
+			continue
+		}
+		// Construct canonical metric name, so it matches metric names returned from SearchMetricNames.
+		mn.sortTags()
+		metricNameBuf = mn.Marshal(metricNameBuf[:0])
+		s.exemplarsStorage.Add(metricNameBuf, &r.Exemplar)
+	}
+}
+
+// ExemplarsResult contains exemplars for a single time series.
+type ExemplarsResult struct {
+	// MetricName is marshaled metric name, which must be unmarshaled via MetricName.UnmarshalString().
+	MetricName string
+
+	// Exemplars are exemplars for the MetricName sorted by timestamp.
+	Exemplars []prompb.Exemplar
+}
+
+// SearchExemplars returns exemplars on the given tr for time series matching the given tfss.
+//
+// Time series without exemplars on the given tr aren't returned.
+func (s *Storage) SearchExemplars(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]ExemplarsResult, error) {
+	qt = qt.NewChild("search exemplars: filters=%s, timeRange=%s", tfss, &tr)
+	defer qt.Done()
+
+	if !s.exemplarsStorage.IsEnabled() {
+		qt.Printf("exemplars storage is disabled")
+		return nil, nil
+	}
+	metricNames, err := s.SearchMetricNames(qt, tfss, tr, maxMetrics, deadline)
+	if err != nil {
+		return nil, err
+	}
+	var results []ExemplarsResult
+	for _, metricName := range metricNames {
+		es := s.exemplarsStorage.Get(nil, metricName, tr.MinTimestamp, tr.MaxTimestamp)
+		if len(es) == 0 {
+			continue
+		}
+		results = append(results, ExemplarsResult{
+			MetricName: metricName,
+			Exemplars:  es,
+		})
+	}
+	qt.Printf("found exemplars for %d out of %d series", len(results), len(metricNames))
+	return results, nil
+}
@@ -3,6 +3,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"path/filepath"
@@ -59,7 +60,7 @@ func TestStorageSearchTSIDs_CorruptedIndex(t *testing.T) {
 		tfssAll := []*TagFilters{tfsAll}
 
 		searchMetricIDs := func() []uint64 {
-			metricIDs, err := idb.searchMetricIDs(nil, tfssAll, tr, 1e9, noDeadline)
+			metricIDs, err := idb.searchMetricIDs(context.Background(), nil, tfssAll, tr, 1e9, noDeadline)
 			if err != nil {
 				panic(fmt.Sprintf("searchMetricIDs() failed unexpectedly: %v", err))
 			}
@@ -161,7 +162,7 @@ func TestStorageSearchMetricNames_CorruptedIndex(t *testing.T) {
 		tfssAll := []*TagFilters{tfsAll}
 
 		searchMetricIDs := func() []uint64 {
-			metricIDs, err := idb.searchMetricIDs(nil, tfssAll, tr, 1e9, noDeadline)
+			metricIDs, err := idb.searchMetricIDs(context.Background(), nil, tfssAll, tr, 1e9, noDeadline)
 			if err != nil {
 				panic(fmt.Sprintf("searchMetricIDs() failed unexpectedly: %v", err))
 			}
@@ -1584,3 +1585,226 @@ func TestStorageAddRows_currHourMetricIDs(t *testing.T) {
 		f(t, true)
 	})
 }
+
+func TestStorage_retentionFilters(t *testing.T) {
+	defer testRemoveAll(t)
+
+	assertData := func(t *testing.T, s *Storage, metricGroupRe string, want []MetricRow) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte(metricGroupRe), false, true); err != nil {
+			t.Fatalf("TagFilters.Add() failed unexpectedly: %v", err)
+		}
+		tr := TimeRange{
+			MinTimestamp: 0,
+			MaxTimestamp: time.Now().UnixMilli(),
+		}
+		if err := testAssertSearchResult(s, tr, tfs, want); err != nil {
+			t.Fatalf("search for %q failed unexpectedly: %v", metricGroupRe, err)
+		}
+	}
+
+	synctest.Test(t, func(t *testing.T) {
+		// synctests start at 2000-01-01T00:00:00Z
+
+		rf, err := ParseRetentionFilter(`{__name__=~"debug_.*"}:7d`)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing retention filter: %s", err)
+		}
+		s := MustOpenStorage(t.Name(), OpenOptions{
+			Retention:        365 * 24 * time.Hour,
+			RetentionFilters: []*RetentionFilter{rf},
+		})
+
+		// Ingest hourly samples for the previous month for kpi_* and debug_* series.
+		// Blocks for debug_* series must be partially dropped.
+		now := time.Now().UTC()
+		start := time.Date(1999, 12, 1, 0, 0, 0, 0, time.UTC)
+		deadline := now.Add(-7 * 24 * time.Hour)
+		var wantKPI, wantDebug []MetricRow
+		var mn MetricName
+		for i := range 3 {
+			for ts := start; ts.Before(now); ts = ts.Add(time.Hour) {
+				mn.MetricGroup = fmt.Appendf(nil, "kpi_%d", i)
+				mr := MetricRow{
+					MetricNameRaw: mn.marshalRaw(nil),
+					Timestamp:     ts.UnixMilli(),
+					Value:         float64(ts.Hour()),
+				}
+				wantKPI = append(wantKPI, mr)
+
+				mn.MetricGroup = fmt.Appendf(nil, "debug_%d", i)
+				mr.MetricNameRaw = mn.marshalRaw(nil)
+				if !ts.Before(deadline) {
+					wantDebug = append(wantDebug, mr)
+				}
+				s.AddRows([]MetricRow{wantKPI[len(wantKPI)-1], mr}, defaultPrecisionBits)
+			}
+		}
+		s.DebugFlush()
+		// Wait until background merges are finished, so force merge could process all the parts.
+		synctest.Wait()
+
+		var pt *partition
+		ptws := s.tb.GetAllPartitions(nil)
+		for _, ptw := range ptws {
+			if ptw.pt.name == "1999_12" {
+				pt = ptw.pt
+			}
+		}
+		s.tb.PutPartitions(ptws)
+		if pt == nil {
+			t.Fatalf("cannot find partition 1999_12")
+		}
+
+		if !pt.isRetentionFiltersApplyNeeded(now.UnixMilli()) {
+			t.Fatalf("expecting retention filters to be applied to the partition")
+		}
+
+		// Retention filters must be applied during the merge.
+		if err := s.ForceMergePartitions(""); err != nil {
+			t.Fatalf("ForceMergePartitions() failed unexpectedly: %s", err)
+		}
+		assertData(t, s, "kpi_.*", wantKPI)
+		assertData(t, s, "debug_.*", wantDebug)
+
+		pt.mustWriteAppliedRetention(now.UnixMilli())
+		f := func(d time.Duration, resultExpected bool) {
+			t.Helper()
+			currentTimestamp := now.Add(d).UnixMilli()
+			if result := pt.isRetentionFiltersApplyNeeded(currentTimestamp); result != resultExpected {
+				t.Fatalf("unexpected isRetentionFiltersApplyNeeded() result after %s; got %v; want %v", d, result, resultExpected)
+			}
+		}
+
+		// Retention filters mustn't be applied right after they were applied.
+		f(0, false)
+		f(time.Hour, false)
+
+		// The filter deadline advances by a day, so the partition must be processed again.
+		f(24*time.Hour, true)
+
+		// The filter deadline exceeds the partition end, so the whole partition must be processed.
+		f(8*24*time.Hour, true)
+
+		// The partition mustn't be processed after the filter has been applied to all its data.
+		pt.mustWriteAppliedRetention(now.Add(8 * 24 * time.Hour).UnixMilli())
+		f(8*24*time.Hour, false)
+		f(30*24*time.Hour, false)
+
+		// Changing retention filters must result in applying them again.
+		rf, err = ParseRetentionFilter(`{__name__=~"debug_.*"}:3d`)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing retention filter: %s", err)
+		}
+		s.retentionFilters = []*RetentionFilter{rf}
+		f(8*24*time.Hour, true)
+
+		s.MustClose()
+	})
+}
+
+func TestStorage_downsampling(t *testing.T) {
+	defer testRemoveAll(t)
+
+	dps := mustParseDownsamplingPeriods(t, []string{`{__name__=~"raw_.*"}:0s:0s`, "7d:1h"})
+	if err := SetDownsamplingPeriods(dps); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() {
+		_ = SetDownsamplingPeriods(nil)
+	}()
+
+	assertData := func(t *testing.T, s *Storage, metricGroupRe string, want []MetricRow) {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte(metricGroupRe), false, true); err != nil {
+			t.Fatalf("TagFilters.Add() failed unexpectedly: %v", err)
+		}
+		tr := TimeRange{
+			MinTimestamp: 0,
+			MaxTimestamp: time.Now().UnixMilli(),
+		}
+		if err := testAssertSearchResult(s, tr, tfs, want); err != nil {
+			t.Fatalf("search for %q failed unexpectedly: %v", metricGroupRe, err)
+		}
+	}
+
+	synctest.Test(t, func(t *testing.T) {
+		// synctests start at 2000-01-01T00:00:00Z
+
+		s := MustOpenStorage(t.Name(), OpenOptions{
+			Retention: 365 * 24 * time.Hour,
+		})
+
+		// Ingest samples with 10 minutes interval for the previous month for raw_* and ds_* series.
+		// Samples for ds_* series older than 7 days must be downsampled to 1 hour.
+		now := time.Now().UTC()
+		start := time.Date(1999, 12, 1, 0, 0, 0, 0, time.UTC)
+		deadline := now.Add(-7 * 24 * time.Hour)
+		var wantRaw, wantDS []MetricRow
+		var mn MetricName
+		for i := range 3 {
+			for ts := start; ts.Before(now); ts = ts.Add(10 * time.Minute) {
+				mn.MetricGroup = fmt.Appendf(nil, "raw_%d", i)
+				mr := MetricRow{
+					MetricNameRaw: mn.marshalRaw(nil),
+					Timestamp:     ts.UnixMilli(),
+					Value:         float64(ts.Minute()),
+				}
+				wantRaw = append(wantRaw, mr)
+
+				mn.MetricGroup = fmt.Appendf(nil, "ds_%d", i)
+				mr.MetricNameRaw = mn.marshalRaw(nil)
+				if ts.After(deadline) || ts.Minute() == 0 {
+					wantDS = append(wantDS, mr)
+				}
+				s.AddRows([]MetricRow{wantRaw[len(wantRaw)-1], mr}, defaultPrecisionBits)
+			}
+		}
+		s.DebugFlush()
+		// Wait until background merges are finished, so force merge could process all the parts.
+		synctest.Wait()
+
+		var pt *partition
+		ptws := s.tb.GetAllPartitions(nil)
+		for _, ptw := range ptws {
+			if ptw.pt.name == "1999_12" {
+				pt = ptw.pt
+			}
+		}
+		s.tb.PutPartitions(ptws)
+		if pt == nil {
+			t.Fatalf("cannot find partition 1999_12")
+		}
+
+		if !pt.isDownsamplingApplyNeeded(now.UnixMilli()) {
+			t.Fatalf("expecting downsampling to be applied to the partition")
+		}
+
+		// Downsampling must be applied during the merge.
+		if err := s.ForceMergePartitions(""); err != nil {
+			t.Fatalf("ForceMergePartitions() failed unexpectedly: %s", err)
+		}
+		assertData(t, s, "raw_.*", wantRaw)
+		assertData(t, s, "ds_.*", wantDS)
+
+		pt.mustWriteAppliedDownsampling(now.UnixMilli())
+		f := func(d time.Duration, resultExpected bool) {
+			t.Helper()
+			currentTimestamp := now.Add(d).UnixMilli()
+			if result := pt.isDownsamplingApplyNeeded(currentTimestamp); result != resultExpected {
+				t.Fatalf("unexpected isDownsamplingApplyNeeded() result after %s; got %v; want %v", d, result, resultExpected)
+			}
+		}
+
+		// Downsampling mustn't be applied right after it was applied.
+		f(0, false)
+		f(time.Hour, false)
+
+		// The downsampling deadline advances by a day, so the partition must be processed again.
+		f(24*time.Hour, true)
+
+		s.MustClose()
+	})
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"math/rand"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
 	"github.com/google/go-cmp/cmp"
@@ -2059,6 +2061,81 @@ func TestStorageSearchMetricNames_VariousTimeRanges(t *testing.T) {
 	testStorageOpOnVariousTimeRanges(t, f)
 }
 
+func TestStorageSearchExemplars(t *testing.T) {
+	defer testRemoveAll(t)
+
+	s := MustOpenStorage(t.Name(), OpenOptions{})
+	defer s.MustClose()
+
+	ts := time.Now().UnixMilli()
+	tr := TimeRange{
+		MinTimestamp: ts - 3600*1000,
+		MaxTimestamp: ts,
+	}
+
+	// Use unsorted labels in order to verify that exemplars are bound to canonical metric names.
+	labels := []prompb.Label{
+		{Name: "__name__", Value: "http_requests_total"},
+		{Name: "path", Value: "/foo"},
+		{Name: "instance", Value: "host1"},
+	}
+	metricNameRaw := MarshalMetricNameRaw(nil, labels)
+	labelsWithoutExemplars := []prompb.Label{
+		{Name: "__name__", Value: "http_requests_total"},
+		{Name: "path", Value: "/bar"},
+	}
+	s.AddRows([]MetricRow{
+		{MetricNameRaw: metricNameRaw, Timestamp: ts - 1000, Value: 1},
+		{MetricNameRaw: MarshalMetricNameRaw(nil, labelsWithoutExemplars), Timestamp: ts - 1000, Value: 2},
+	}, defaultPrecisionBits)
+	s.AddExemplars([]ExemplarRow{
+		{
+			MetricNameRaw: metricNameRaw,
+			Exemplar: prompb.Exemplar{
+				Labels:    []prompb.Label{{Name: "trace_id", Value: "abc"}},
+				Value:     1,
+				Timestamp: ts - 2000,
+			},
+		},
+		{
+			MetricNameRaw: metricNameRaw,
+			Exemplar: prompb.Exemplar{
+				Labels:    []prompb.Label{{Name: "trace_id", Value: "def"}},
+				Value:     1,
+				Timestamp: ts - 7200*1000,
+			},
+		},
+	})
+	s.DebugFlush()
+
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("http_requests_total"), false, false); err != nil {
+		t.Fatalf("unexpected error in TagFilters.Add: %s", err)
+	}
+	results, err := s.SearchExemplars(nil, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+	if err != nil {
+		t.Fatalf("unexpected error in SearchExemplars: %s", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("unexpected number of series with exemplars; got %d; want 1", len(results))
+	}
+	var mn MetricName
+	if err := mn.UnmarshalString(results[0].MetricName); err != nil {
+		t.Fatalf("cannot unmarshal metric name: %s", err)
+	}
+	if got, want := mn.String(), `http_requests_total{instance="host1",path="/foo"}`; got != want {
+		t.Fatalf("unexpected metric name; got %s; want %s", got, want)
+	}
+	exemplarsExpected := []prompb.Exemplar{{
+		Labels:    []prompb.Label{{Name: "trace_id", Value: "abc"}},
+		Value:     1,
+		Timestamp: ts - 2000,
+	}}
+	if diff := cmp.Diff(exemplarsExpected, results[0].Exemplars); diff != "" {
+		t.Fatalf("unexpected exemplars (-want, +got):\n%s", diff)
+	}
+}
+
 func TestStorageSearchMetricNames_TooManyTimeseries(t *testing.T) {
 	defer testRemoveAll(t)
 
@@ -3576,7 +3653,7 @@ func testStorageAddRowsWithZeroDate(t *testing.T, disablePerDayIndex bool) {
 // tests only.
 func testSearchMetricIDs(s *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) []uint64 {
 	search := func(qt *querytracer.Tracer, idb *indexDB, tr TimeRange) (*uint64set.Set, error) {
-		return idb.searchMetricIDs(qt, tfss, tr, maxMetrics, deadline)
+		return idb.searchMetricIDs(context.Background(), qt, tfss, tr, maxMetrics, deadline)
 	}
 	merge := func(data []*uint64set.Set) *uint64set.Set {
 		all := &uint64set.Set{}
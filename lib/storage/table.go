@@ -490,8 +490,8 @@ func (tb *table) startHistoricalMergeWatcher() {
 }
 
 func (tb *table) historicalMergeWatcher() {
-	if !isDedupEnabled() {
-		// Deduplication and retentionFilters are disabled.
+	if !isDedupEnabled() && len(tb.s.retentionFilters) == 0 && !isDownsamplingEnabled() {
+		// Deduplication, retentionFilters and downsampling are disabled.
 		return
 	}
 
@@ -506,11 +506,12 @@ func (tb *table) historicalMergeWatcher() {
 			if ptw.pt.name == currentPartitionName {
 				// Do not run force merge for the current month.
 				// For the current month, the samples are continuously
-				// deduplicated and retention filters applied by the background in-memory, small, and big part
+				// deduplicated, downsampled and retention filters applied by the background in-memory, small, and big part
 				// merge tasks. See:
 				// - partition.mergeParts() in partition.go and
 				// - Block.deduplicateSamplesDuringMerge() in block.go.
 				// - blockStreamMerger.getRetentionDeadline() in block_stream_merger.go
+				// - seriesDownsampling.downsampleBlock() in downsampling.go
 				continue
 			}
 			mergeScheduled := false
@@ -519,6 +520,16 @@ func (tb *table) historicalMergeWatcher() {
 				ptw.pt.isDedupScheduled.Store(true)
 				mergeScheduled = true
 			}
+			if ptw.pt.isRetentionFiltersApplyNeeded(timestamp) {
+				// mark partition with retention filters marker
+				ptw.pt.isRetentionFiltersScheduled.Store(true)
+				mergeScheduled = true
+			}
+			if ptw.pt.isDownsamplingApplyNeeded(timestamp) {
+				// mark partition with downsampling marker
+				ptw.pt.isDownsamplingScheduled.Store(true)
+				mergeScheduled = true
+			}
 			if mergeScheduled {
 				ptwsToMerge = append(ptwsToMerge, ptw)
 			}
@@ -532,14 +543,35 @@ func (tb *table) historicalMergeWatcher() {
 				logContext = append(logContext, "removing duplicate samples")
 				logErrContext = append(logErrContext, "remove duplicate samples")
 			}
+			isRetentionFiltersScheduled := pt.isRetentionFiltersScheduled.Load()
+			if isRetentionFiltersScheduled {
+				rfs := retentionFiltersString(tb.s.retentionFilters)
+				logContext = append(logContext, fmt.Sprintf("applying retention filters %s", rfs))
+				logErrContext = append(logErrContext, fmt.Sprintf("apply retention filters %s", rfs))
+			}
+			isDownsamplingScheduled := pt.isDownsamplingScheduled.Load()
+			if isDownsamplingScheduled {
+				logContext = append(logContext, fmt.Sprintf("applying downsampling %s", downsamplingPeriodsString))
+				logErrContext = append(logErrContext, fmt.Sprintf("apply downsampling %s", downsamplingPeriodsString))
+			}
 
 			logger.Infof("start %s for partition (%s, %s)", strings.Join(logContext, " and "), pt.bigPartsPath, pt.smallPartsPath)
 			if err := pt.ForceMergeAllParts(tb.stopCh); err != nil {
 				logger.Errorf("cannot %s for partition (%s, %s): %s", strings.Join(logErrContext, " and "), pt.bigPartsPath, pt.smallPartsPath, err)
+			} else if !isStopped(tb.stopCh) {
+				// The merge was started after the timestamp, so it has applied retention filters and downsampling at least up to the timestamp.
+				if isRetentionFiltersScheduled {
+					pt.mustWriteAppliedRetention(timestamp)
+				}
+				if isDownsamplingScheduled {
+					pt.mustWriteAppliedDownsampling(timestamp)
+				}
 			}
 			logger.Infof("finished %s for partition (%s, %s) in %.3f seconds", strings.Join(logContext, " and "), pt.bigPartsPath, pt.smallPartsPath, time.Since(t).Seconds())
 
 			pt.isDedupScheduled.Store(false)
+			pt.isRetentionFiltersScheduled.Store(false)
+			pt.isDownsamplingScheduled.Store(false)
 		}
 	}
 
@@ -730,3 +762,12 @@ func putPartitionWrappers(ptwsX *partitionWrappers) {
 }
 
 var ptwsPool sync.Pool
+
+func isStopped(stopCh <-chan struct{}) bool {
+	select {
+	case <-stopCh:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,247 @@
+package tracing
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	otlpEndpoint = flag.String("tracing.otlpEndpoint", "", "Optional OTLP/HTTP endpoint for exporting spans in OpenTelemetry format. "+
+		"For example, -tracing.otlpEndpoint=http://otel-collector:4318/v1/traces . By default, spans aren't exported")
+	otlpHeader = flagutil.NewArrayString("tracing.otlpHeader", "Optional HTTP request header to send to -tracing.otlpEndpoint . "+
+		"For example, -tracing.otlpHeader='Authorization: Bearer foobar' adds 'Authorization: Bearer foobar' header to every request to -tracing.otlpEndpoint")
+	samplingRatio = flag.Float64("tracing.samplingRatio", 0.1, "The ratio of traces to export to -tracing.otlpEndpoint in the range [0..1]. "+
+		"It is applied only to requests without W3C traceparent header. Requests with traceparent header are exported only if it has the sampled flag. "+
+		"Higher values increase CPU and memory usage, since more requests are traced")
+	flushInterval   = flag.Duration("tracing.flushInterval", 5*time.Second, "Interval for sending the collected spans and log records to OTLP endpoints")
+	maxPendingItems = flag.Int("tracing.maxPendingItems", 10000, "The maximum number of spans or log records, which may wait for sending to every OTLP endpoint. "+
+		"Items exceeding this limit are dropped. This protects from excess memory usage when the OTLP endpoint is unavailable or slow")
+)
+
+// InitSecretFlags manages the secret flags for this pkg and must be called by app-level initSecretFlags.
+func InitSecretFlags() {
+	// The -tracing.otlpHeader flag can contain auth creds, so it mustn't be visible when exposing the flags.
+	flagutil.RegisterSecretFlag("tracing.otlpHeader")
+}
+
+var spansExporter atomic.Pointer[batcher[*Span]]
+
+// Init starts exporting spans for the service with the given serviceName to -tracing.otlpEndpoint.
+//
+// Init must be called after logger.Init. Tracing stays disabled if -tracing.otlpEndpoint isn't set.
+func Init(serviceName string) {
+	if *otlpEndpoint == "" {
+		return
+	}
+	if *samplingRatio < 0 || *samplingRatio > 1 {
+		logger.Fatalf("-tracing.samplingRatio must be in the range [0..1]; got %v", *samplingRatio)
+	}
+	headers, err := parseHeaders(*otlpHeader)
+	if err != nil {
+		logger.Fatalf("cannot parse -tracing.otlpHeader: %s", err)
+	}
+	r := newResource(serviceName)
+	marshal := func(dst []byte, spans []*Span) []byte {
+		return marshalTracesData(dst, r, spans)
+	}
+	spansExporter.Store(newBatcher("spans", *otlpEndpoint, headers, marshal))
+}
+
+// Stop stops exporting spans and sends the pending spans to -tracing.otlpEndpoint.
+func Stop() {
+	if se := spansExporter.Swap(nil); se != nil {
+		se.stop()
+	}
+}
+
+// IsEnabled returns true if spans are exported. See -tracing.otlpEndpoint command-line flag.
+func IsEnabled() bool {
+	return spansExporter.Load() != nil
+}
+
+// LogExporter exports log records to OTLP/HTTP endpoint.
+type LogExporter struct {
+	b *batcher[*LogRecord]
+}
+
+// NewLogExporter returns new exporter of log records for the service with the given serviceName to the given OTLP/HTTP endpoint.
+//
+// headers are sent with every request to the endpoint. They must be in the form `Name: value`.
+//
+// Call Stop when the returned exporter is no longer needed.
+func NewLogExporter(endpoint string, headers []string, serviceName string) (*LogExporter, error) {
+	hs, err := parseHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	r := newResource(serviceName)
+	marshal := func(dst []byte, lrs []*LogRecord) []byte {
+		return marshalLogsData(dst, r, lrs)
+	}
+	le := &LogExporter{
+		b: newBatcher("logs", endpoint, hs, marshal),
+	}
+	return le, nil
+}
+
+// Export schedules lr for the export.
+//
+// lr mustn't be modified after the call.
+func (le *LogExporter) Export(lr *LogRecord) {
+	le.b.add(lr)
+}
+
+// Stop stops le and sends the pending log records.
+func (le *LogExporter) Stop() {
+	le.b.stop()
+}
+
+var exportErrorLogger = logger.WithThrottler("otlpExportError", 5*time.Second)
+
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+func getHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		httpClient = &http.Client{
+			Transport: httputil.NewTransport(false, "vm_tracing_otlp"),
+			Timeout:   10 * time.Second,
+		}
+	})
+	return httpClient
+}
+
+// batcher collects items and periodically sends them in batches to OTLP/HTTP endpoint.
+type batcher[T any] struct {
+	name     string
+	endpoint string
+	headers  http.Header
+	marshal  func(dst []byte, items []T) []byte
+
+	mu      sync.Mutex
+	pending []T
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	itemsSent    *metrics.Counter
+	itemsDropped *metrics.Counter
+	sendErrors   *metrics.Counter
+}
+
+func newBatcher[T any](name, endpoint string, headers http.Header, marshal func(dst []byte, items []T) []byte) *batcher[T] {
+	b := &batcher[T]{
+		name:     name,
+		endpoint: endpoint,
+		headers:  headers,
+		marshal:  marshal,
+		stopCh:   make(chan struct{}),
+
+		itemsSent:    metrics.GetOrCreateCounter(fmt.Sprintf(`vm_tracing_otlp_sent_items_total{type=%q}`, name)),
+		itemsDropped: metrics.GetOrCreateCounter(fmt.Sprintf(`vm_tracing_otlp_dropped_items_total{type=%q}`, name)),
+		sendErrors:   metrics.GetOrCreateCounter(fmt.Sprintf(`vm_tracing_otlp_send_errors_total{type=%q}`, name)),
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.run()
+	}()
+	return b
+}
+
+func (b *batcher[T]) add(item T) {
+	b.mu.Lock()
+	if len(b.pending) >= *maxPendingItems {
+		b.mu.Unlock()
+		b.itemsDropped.Inc()
+		return
+	}
+	b.pending = append(b.pending, item)
+	b.mu.Unlock()
+}
+
+func (b *batcher[T]) run() {
+	t := time.NewTicker(*flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-b.stopCh:
+			b.flush()
+			return
+		case <-t.C:
+			b.flush()
+		}
+	}
+}
+
+func (b *batcher[T]) stop() {
+	close(b.stopCh)
+	b.wg.Wait()
+}
+
+func (b *batcher[T]) flush() {
+	b.mu.Lock()
+	items := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(items) == 0 {
+		return
+	}
+	data := b.marshal(nil, items)
+	if err := b.send(data); err != nil {
+		b.sendErrors.Inc()
+		b.itemsDropped.Add(len(items))
+		exportErrorLogger.Errorf("cannot send %d %s to %q: %s", len(items), b.name, b.endpoint, err)
+		return
+	}
+	b.itemsSent.Add(len(items))
+}
+
+func (b *batcher[T]) send(data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, b.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	for k, vs := range b.headers {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := getHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response status code %d; response body: %q", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func parseHeaders(headers []string) (http.Header, error) {
+	hs := make(http.Header, len(headers))
+	for _, h := range headers {
+		n := strings.IndexByte(h, ':')
+		if n < 0 {
+			return nil, fmt.Errorf(`missing ':' in header %q; expecting "key: value" format`, h)
+		}
+		hs.Add(strings.TrimSpace(h[:n]), strings.TrimSpace(h[n+1:]))
+	}
+	return hs, nil
+}
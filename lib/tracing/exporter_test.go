@@ -0,0 +1,238 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/easyproto"
+)
+
+func TestExportSpans(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+			t.Errorf("unexpected Content-Type header; got %q; want %q", ct, "application/x-protobuf")
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer foo" {
+			t.Errorf("unexpected Authorization header; got %q; want %q", auth, "Bearer foo")
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read request body: %s", err)
+		}
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	if err := flag.Set("tracing.otlpEndpoint", ts.URL); err != nil {
+		t.Fatalf("cannot set -tracing.otlpEndpoint: %s", err)
+	}
+	defer func() {
+		_ = flag.Set("tracing.otlpEndpoint", "")
+		*otlpHeader = nil
+	}()
+	*otlpHeader = []string{"Authorization: Bearer foo"}
+
+	Init("test")
+	if !IsEnabled() {
+		t.Fatalf("tracing must be enabled")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s := StartRequestSpan(r, "request")
+	child := s.NewChild("backend request", SpanKindClient)
+	child.SetAttributes(String("url.path", "/api/v1/query"), Int("http.response.status_code", 502))
+	child.SetError(errors.New("bad gateway"))
+
+	h := http.Header{}
+	child.InjectHeaders(h)
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		t.Fatalf("cannot parse the injected traceparent: %s", err)
+	}
+	if sc != child.SpanContext() {
+		t.Fatalf("unexpected injected span context; got %v; want %v", sc, child.SpanContext())
+	}
+	child.End()
+	s.End()
+
+	// Spans from non-sampled traces mustn't be exported.
+	r.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	StartRequestSpan(r, "not sampled").End()
+
+	Stop()
+	if IsEnabled() {
+		t.Fatalf("tracing must be disabled after Stop")
+	}
+	if s := StartRequestSpan(r, "disabled"); s != nil {
+		t.Fatalf("expecting nil span when tracing is disabled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("unexpected number of requests; got %d; want 1", len(bodies))
+	}
+	spans := getSpans(t, bodies[0])
+	if len(spans) != 2 {
+		t.Fatalf("unexpected number of spans; got %d; want 2", len(spans))
+	}
+
+	f := func(src []byte, nameExpected, parentSpanIDExpected string, kindExpected SpanKind, isErrorExpected bool) {
+		t.Helper()
+
+		var fc easyproto.FieldContext
+		var name, traceID, parentSpanID string
+		var kind int32
+		isError := false
+		for len(src) > 0 {
+			var err error
+			src, err = fc.NextField(src)
+			if err != nil {
+				t.Fatalf("cannot read span field: %s", err)
+			}
+			switch fc.FieldNum {
+			case 1:
+				b, _ := fc.Bytes()
+				traceID = hex.EncodeToString(b)
+			case 4:
+				b, _ := fc.Bytes()
+				parentSpanID = hex.EncodeToString(b)
+			case 5:
+				name, _ = fc.String()
+			case 6:
+				kind, _ = fc.Enum()
+			case 15:
+				isError = true
+			}
+		}
+		if name != nameExpected {
+			t.Fatalf("unexpected span name; got %q; want %q", name, nameExpected)
+		}
+		if traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Fatalf("unexpected trace id; got %q", traceID)
+		}
+		if parentSpanID != parentSpanIDExpected {
+			t.Fatalf("unexpected parent span id; got %q; want %q", parentSpanID, parentSpanIDExpected)
+		}
+		if SpanKind(kind) != kindExpected {
+			t.Fatalf("unexpected span kind; got %d; want %d", kind, kindExpected)
+		}
+		if isError != isErrorExpected {
+			t.Fatalf("unexpected span status; got isError=%v; want %v", isError, isErrorExpected)
+		}
+	}
+
+	sid := s.SpanContext().SpanID.String()
+	f(spans[0], "backend request", sid, SpanKindClient, true)
+	f(spans[1], "request", "00f067aa0ba902b7", SpanKindServer, false)
+}
+
+func TestLogExporter(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read request body: %s", err)
+		}
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	if _, err := NewLogExporter(ts.URL, []string{"foobar"}, "test"); err == nil {
+		t.Fatalf("expecting non-nil error for invalid header")
+	}
+
+	le, err := NewLogExporter(ts.URL, nil, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	le.Export(&LogRecord{
+		Timestamp:  time.Unix(1, 0),
+		Severity:   "INFO",
+		Body:       "access_log",
+		Attributes: []Attribute{String("username", "foo")},
+	})
+	le.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("unexpected number of requests; got %d; want 1", len(bodies))
+	}
+
+	// LogsData -> ResourceLogs -> ScopeLogs -> LogRecord
+	rls := getMessages(t, bodies[0], 1)
+	if len(rls) != 1 {
+		t.Fatalf("unexpected number of ResourceLogs; got %d; want 1", len(rls))
+	}
+	sls := getMessages(t, rls[0], 2)
+	if len(sls) != 1 {
+		t.Fatalf("unexpected number of ScopeLogs; got %d; want 1", len(sls))
+	}
+	lrs := getMessages(t, sls[0], 2)
+	if len(lrs) != 1 {
+		t.Fatalf("unexpected number of LogRecords; got %d; want 1", len(lrs))
+	}
+	body := getMessages(t, lrs[0], 5)
+	if len(body) != 1 {
+		t.Fatalf("missing body in LogRecord")
+	}
+	bodyStr, ok, err := easyproto.GetString(body[0], 1)
+	if err != nil || !ok {
+		t.Fatalf("cannot read string body; ok=%v, err=%v", ok, err)
+	}
+	if bodyStr != "access_log" {
+		t.Fatalf("unexpected body; got %q; want %q", bodyStr, "access_log")
+	}
+}
+
+func getSpans(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+
+	// TracesData -> ResourceSpans -> ScopeSpans -> Span
+	var spans [][]byte
+	for _, rs := range getMessages(t, data, 1) {
+		for _, ss := range getMessages(t, rs, 2) {
+			spans = append(spans, getMessages(t, ss, 2)...)
+		}
+	}
+	return spans
+}
+
+func getMessages(t *testing.T, src []byte, fieldNum uint32) [][]byte {
+	t.Helper()
+
+	var a [][]byte
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			t.Fatalf("cannot read field: %s", err)
+		}
+		if fc.FieldNum != fieldNum {
+			continue
+		}
+		data, ok := fc.MessageData()
+		if !ok {
+			t.Fatalf("cannot read message data for field #%d", fieldNum)
+		}
+		a = append(a, data)
+	}
+	return a
+}
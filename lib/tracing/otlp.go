@@ -0,0 +1,244 @@
+package tracing
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/easyproto"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+)
+
+// scopeName is the name of instrumentation scope for the exported spans and log records.
+const scopeName = "github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
+
+var mp easyproto.MarshalerPool
+
+// resource contains attributes of the entity, which produces spans and log records.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/v1.5.0/opentelemetry/proto/resource/v1/resource.proto
+type resource struct {
+	attrs []Attribute
+}
+
+func newResource(serviceName string) *resource {
+	attrs := []Attribute{
+		String("service.name", serviceName),
+	}
+	if v := buildinfo.ShortVersion(); v != "" {
+		attrs = append(attrs, String("service.version", v))
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attrs = append(attrs, String("host.name", hostname))
+	}
+	return &resource{
+		attrs: attrs,
+	}
+}
+
+func (r *resource) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	marshalAttributes(mm, 1, r.attrs)
+}
+
+func marshalInstrumentationScope(mm *easyproto.MessageMarshaler) {
+	mm.AppendString(1, scopeName)
+}
+
+func marshalAttributes(mm *easyproto.MessageMarshaler, fieldNum uint32, attrs []Attribute) {
+	for i := range attrs {
+		attrs[i].marshalProtobuf(mm.AppendMessage(fieldNum))
+	}
+}
+
+func (a *Attribute) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	// See https://github.com/open-telemetry/opentelemetry-proto/blob/v1.5.0/opentelemetry/proto/common/v1/common.proto
+	//
+	// message KeyValue {
+	//   string key = 1;
+	//   AnyValue value = 2;
+	// }
+	mm.AppendString(1, a.Key)
+	av := mm.AppendMessage(2)
+	if a.isInt {
+		av.AppendInt64(3, a.intValue)
+	} else {
+		av.AppendString(1, a.stringValue)
+	}
+}
+
+// marshalTracesData appends TracesData protobuf message with the given spans to dst and returns the result.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/v1.5.0/opentelemetry/proto/trace/v1/trace.proto
+func marshalTracesData(dst []byte, r *resource, spans []*Span) []byte {
+	m := mp.Get()
+
+	// message TracesData {
+	//   repeated ResourceSpans resource_spans = 1;
+	// }
+	//
+	// message ResourceSpans {
+	//   Resource resource = 1;
+	//   repeated ScopeSpans scope_spans = 2;
+	// }
+	//
+	// message ScopeSpans {
+	//   InstrumentationScope scope = 1;
+	//   repeated Span spans = 2;
+	// }
+	rs := m.MessageMarshaler().AppendMessage(1)
+	r.marshalProtobuf(rs.AppendMessage(1))
+	ss := rs.AppendMessage(2)
+	marshalInstrumentationScope(ss.AppendMessage(1))
+	for _, s := range spans {
+		s.marshalProtobuf(ss.AppendMessage(2))
+	}
+
+	dst = m.Marshal(dst)
+	mp.Put(m)
+	return dst
+}
+
+func (s *Span) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	// message Span {
+	//   bytes trace_id = 1;
+	//   bytes span_id = 2;
+	//   bytes parent_span_id = 4;
+	//   string name = 5;
+	//   SpanKind kind = 6;
+	//   fixed64 start_time_unix_nano = 7;
+	//   fixed64 end_time_unix_nano = 8;
+	//   repeated KeyValue attributes = 9;
+	//   repeated Event events = 11;
+	//   Status status = 15;
+	// }
+	mm.AppendBytes(1, s.sc.TraceID[:])
+	mm.AppendBytes(2, s.sc.SpanID[:])
+	if !s.parentSpanID.IsZero() {
+		mm.AppendBytes(4, s.parentSpanID[:])
+	}
+	mm.AppendString(5, s.name)
+	mm.AppendInt32(6, int32(s.kind))
+	mm.AppendFixed64(7, uint64(s.startTime.UnixNano()))
+	mm.AppendFixed64(8, uint64(s.endTime.UnixNano()))
+	marshalAttributes(mm, 9, s.attrs)
+	for _, e := range s.events {
+		// message Event {
+		//   fixed64 time_unix_nano = 1;
+		//   string name = 2;
+		// }
+		ev := mm.AppendMessage(11)
+		ev.AppendFixed64(1, uint64(e.timestamp.UnixNano()))
+		ev.AppendString(2, e.name)
+	}
+	if s.isError {
+		// message Status {
+		//   string message = 2;
+		//   StatusCode code = 3;
+		// }
+		//
+		// STATUS_CODE_ERROR = 2
+		st := mm.AppendMessage(15)
+		st.AppendString(2, s.errMsg)
+		st.AppendInt32(3, 2)
+	}
+}
+
+// LogRecord is a log record for the export via LogExporter.
+type LogRecord struct {
+	// Timestamp is the time of the event.
+	Timestamp time.Time
+
+	// Severity is the severity of the event, such as INFO, WARN or ERROR.
+	Severity string
+
+	// Body is the log message.
+	Body string
+
+	// Attributes contains additional attributes for the event.
+	Attributes []Attribute
+
+	// SpanContext is an optional span context for correlating the log record with the trace.
+	SpanContext SpanContext
+}
+
+// marshalLogsData appends LogsData protobuf message with the given lrs to dst and returns the result.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/v1.5.0/opentelemetry/proto/logs/v1/logs.proto
+func marshalLogsData(dst []byte, r *resource, lrs []*LogRecord) []byte {
+	m := mp.Get()
+
+	// message LogsData {
+	//   repeated ResourceLogs resource_logs = 1;
+	// }
+	//
+	// message ResourceLogs {
+	//   Resource resource = 1;
+	//   repeated ScopeLogs scope_logs = 2;
+	// }
+	//
+	// message ScopeLogs {
+	//   InstrumentationScope scope = 1;
+	//   repeated LogRecord log_records = 2;
+	// }
+	rl := m.MessageMarshaler().AppendMessage(1)
+	r.marshalProtobuf(rl.AppendMessage(1))
+	sl := rl.AppendMessage(2)
+	marshalInstrumentationScope(sl.AppendMessage(1))
+	for _, lr := range lrs {
+		lr.marshalProtobuf(sl.AppendMessage(2))
+	}
+
+	dst = m.Marshal(dst)
+	mp.Put(m)
+	return dst
+}
+
+func (lr *LogRecord) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	// message LogRecord {
+	//   fixed64 time_unix_nano = 1;
+	//   SeverityNumber severity_number = 2;
+	//   string severity_text = 3;
+	//   AnyValue body = 5;
+	//   repeated KeyValue attributes = 6;
+	//   fixed32 flags = 8;
+	//   bytes trace_id = 9;
+	//   bytes span_id = 10;
+	// }
+	mm.AppendFixed64(1, uint64(lr.Timestamp.UnixNano()))
+	if n := getSeverityNumber(lr.Severity); n > 0 {
+		mm.AppendInt32(2, n)
+	}
+	if lr.Severity != "" {
+		mm.AppendString(3, lr.Severity)
+	}
+	mm.AppendMessage(5).AppendString(1, lr.Body)
+	marshalAttributes(mm, 6, lr.Attributes)
+	if sc := &lr.SpanContext; sc.IsValid() {
+		if sc.Sampled {
+			mm.AppendFixed32(8, 1)
+		}
+		mm.AppendBytes(9, sc.TraceID[:])
+		mm.AppendBytes(10, sc.SpanID[:])
+	}
+}
+
+// getSeverityNumber returns SeverityNumber enum value for the given severity.
+//
+// 0 is returned for unknown severity.
+func getSeverityNumber(severity string) int32 {
+	switch strings.ToUpper(severity) {
+	case "DEBUG":
+		return 5
+	case "INFO":
+		return 9
+	case "WARN":
+		return 13
+	case "ERROR":
+		return 17
+	case "FATAL", "PANIC":
+		return 21
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,218 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// SpanKind is the kind of the span.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/v1.5.0/opentelemetry/proto/trace/v1/trace.proto
+type SpanKind int32
+
+const (
+	// SpanKindInternal is the kind for spans, which represent internal operations.
+	SpanKindInternal SpanKind = 1
+
+	// SpanKindServer is the kind for spans, which represent handling of incoming requests.
+	SpanKindServer SpanKind = 2
+
+	// SpanKindClient is the kind for spans, which represent outgoing requests.
+	SpanKindClient SpanKind = 3
+)
+
+// Attribute is a key-value attribute for spans and log records.
+type Attribute struct {
+	// Key is the attribute key.
+	Key string
+
+	stringValue string
+	intValue    int64
+	isInt       bool
+}
+
+// String returns string attribute with the given key and value.
+func String(key, value string) Attribute {
+	return Attribute{
+		Key:         key,
+		stringValue: value,
+	}
+}
+
+// Int returns integer attribute with the given key and value.
+func Int(key string, value int64) Attribute {
+	return Attribute{
+		Key:      key,
+		intValue: value,
+		isInt:    true,
+	}
+}
+
+// Span represents a single operation within a trace.
+//
+// Span methods may be called on nil span, which is returned when tracing is disabled. In this case they do nothing.
+//
+// Span methods mustn't be called concurrently.
+type Span struct {
+	sc           SpanContext
+	parentSpanID SpanID
+
+	name      string
+	kind      SpanKind
+	startTime time.Time
+	endTime   time.Time
+	attrs     []Attribute
+	events    []spanEvent
+
+	isError bool
+	errMsg  string
+}
+
+// StartRequestSpan starts a server span with the given name for handling the incoming request r.
+//
+// The span continues the trace from W3C traceparent header at r if it contains valid value.
+// Otherwise a new trace is started. It is sampled according to -tracing.samplingRatio command-line flag.
+//
+// nil is returned if tracing is disabled. See -tracing.otlpEndpoint command-line flag.
+func StartRequestSpan(r *http.Request, name string) *Span {
+	if !IsEnabled() {
+		return nil
+	}
+	parent, err := ParseTraceparent(r.Header.Get(TraceparentHeader))
+	if err != nil {
+		parent = SpanContext{
+			TraceID: newTraceID(),
+			Sampled: rand.Float64() < *samplingRatio,
+		}
+	}
+	return newSpan(parent, name, SpanKindServer, time.Now())
+}
+
+// NewChild starts a child span with the given name and kind for s.
+func (s *Span) NewChild(name string, kind SpanKind) *Span {
+	return s.NewChildAt(name, kind, time.Now())
+}
+
+// NewChildAt starts a child span with the given name and kind for s at the given startTime.
+//
+// This is useful for exporting already finished operations. See also EndAt.
+func (s *Span) NewChildAt(name string, kind SpanKind, startTime time.Time) *Span {
+	if s == nil {
+		return nil
+	}
+	return newSpan(s.sc, name, kind, startTime)
+}
+
+func newSpan(parent SpanContext, name string, kind SpanKind, startTime time.Time) *Span {
+	return &Span{
+		sc: SpanContext{
+			TraceID: parent.TraceID,
+			SpanID:  newSpanID(),
+			Sampled: parent.Sampled,
+		},
+		parentSpanID: parent.SpanID,
+		name:         name,
+		kind:         kind,
+		startTime:    startTime,
+	}
+}
+
+// IsRecording returns true if s is exported when it is finished.
+//
+// This allows skipping expensive preparation of span attributes and children for spans, which aren't exported.
+func (s *Span) IsRecording() bool {
+	return s != nil && s.sc.Sampled
+}
+
+// SpanContext returns span context for s.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes sets the given attrs on s.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// AddEvent adds an event with the given name, which occurred at the given timestamp, to s.
+func (s *Span) AddEvent(name string, timestamp time.Time) {
+	if s == nil {
+		return
+	}
+	s.events = append(s.events, spanEvent{
+		name:      name,
+		timestamp: timestamp,
+	})
+}
+
+type spanEvent struct {
+	name      string
+	timestamp time.Time
+}
+
+// SetError marks s as failed with the given err.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.isError = true
+	s.errMsg = err.Error()
+}
+
+// InjectHeaders sets W3C traceparent header for s at h.
+//
+// This allows continuing the trace at the server, which receives the request with h headers.
+func (s *Span) InjectHeaders(h http.Header) {
+	if s == nil {
+		return
+	}
+	h.Set(TraceparentHeader, s.sc.Traceparent())
+}
+
+// End finishes s and schedules it for the export if it is sampled.
+//
+// s mustn't be used after End call.
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt finishes s at the given endTime and schedules it for the export if it is sampled.
+//
+// s mustn't be used after EndAt call.
+func (s *Span) EndAt(endTime time.Time) {
+	if s == nil {
+		return
+	}
+	s.endTime = endTime
+	if !s.sc.Sampled {
+		return
+	}
+	if se := spansExporter.Load(); se != nil {
+		se.add(s)
+	}
+}
+
+func newTraceID() TraceID {
+	var tid TraceID
+	for tid.IsZero() {
+		binary.BigEndian.PutUint64(tid[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(tid[8:], rand.Uint64())
+	}
+	return tid
+}
+
+func newSpanID() SpanID {
+	var sid SpanID
+	for sid.IsZero() {
+		binary.BigEndian.PutUint64(sid[:], rand.Uint64())
+	}
+	return sid
+}
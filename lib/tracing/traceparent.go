@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// TraceparentHeader is the name of W3C Trace Context header used for trace context propagation.
+//
+// See https://www.w3.org/TR/trace-context/#traceparent-header
+const TraceparentHeader = "Traceparent"
+
+// TraceID is a unique identifier of a trace.
+type TraceID [16]byte
+
+// IsZero returns true if tid is all zeros.
+func (tid TraceID) IsZero() bool {
+	return tid == TraceID{}
+}
+
+// String returns hex-encoded tid.
+func (tid TraceID) String() string {
+	return hex.EncodeToString(tid[:])
+}
+
+// SpanID is a unique identifier of a span within a trace.
+type SpanID [8]byte
+
+// IsZero returns true if sid is all zeros.
+func (sid SpanID) IsZero() bool {
+	return sid == SpanID{}
+}
+
+// String returns hex-encoded sid.
+func (sid SpanID) String() string {
+	return hex.EncodeToString(sid[:])
+}
+
+// SpanContext contains span identifiers, which are propagated across process boundaries.
+type SpanContext struct {
+	// TraceID is the id of the trace the span belongs to.
+	TraceID TraceID
+
+	// SpanID is the id of the span.
+	SpanID SpanID
+
+	// Sampled is set to true if the trace must be recorded.
+	Sampled bool
+}
+
+// IsValid returns true if sc contains non-zero trace id and span id.
+func (sc *SpanContext) IsValid() bool {
+	return !sc.TraceID.IsZero() && !sc.SpanID.IsZero()
+}
+
+// Traceparent returns W3C traceparent header value for sc.
+//
+// See https://www.w3.org/TR/trace-context/#traceparent-header-field-values
+func (sc *SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses W3C traceparent header value s.
+//
+// See https://www.w3.org/TR/trace-context/#traceparent-header-field-values
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+
+	// The header has the following format: version "-" trace-id "-" parent-id "-" trace-flags
+	if len(s) < 55 {
+		return sc, fmt.Errorf("too short traceparent; got %d chars; want at least 55 chars", len(s))
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, fmt.Errorf("missing '-' delimiters in traceparent")
+	}
+	var version [1]byte
+	if err := decodeLowerHex(version[:], s[:2]); err != nil {
+		return sc, fmt.Errorf("cannot parse version: %w", err)
+	}
+	switch {
+	case version[0] == 0xff:
+		return sc, fmt.Errorf("invalid version ff")
+	case version[0] == 0 && len(s) != 55:
+		return sc, fmt.Errorf("unexpected traceparent length for version 00; got %d chars; want 55 chars", len(s))
+	case len(s) > 55 && s[55] != '-':
+		// Future versions may append fields to the header.
+		return sc, fmt.Errorf("missing '-' delimiter after trace-flags")
+	}
+	if err := decodeLowerHex(sc.TraceID[:], s[3:35]); err != nil {
+		return sc, fmt.Errorf("cannot parse trace-id: %w", err)
+	}
+	if sc.TraceID.IsZero() {
+		return sc, fmt.Errorf("trace-id cannot contain only zeros")
+	}
+	if err := decodeLowerHex(sc.SpanID[:], s[36:52]); err != nil {
+		return sc, fmt.Errorf("cannot parse parent-id: %w", err)
+	}
+	if sc.SpanID.IsZero() {
+		return sc, fmt.Errorf("parent-id cannot contain only zeros")
+	}
+	var flags [1]byte
+	if err := decodeLowerHex(flags[:], s[53:55]); err != nil {
+		return sc, fmt.Errorf("cannot parse trace-flags: %w", err)
+	}
+	sc.Sampled = flags[0]&1 != 0
+	return sc, nil
+}
+
+func decodeLowerHex(dst []byte, s string) error {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return fmt.Errorf("unexpected char %q in %q; only lowercase hex chars are allowed", c, s)
+		}
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"testing"
+)
+
+func TestParseTraceparentSuccess(t *testing.T) {
+	f := func(s, traceIDExpected, spanIDExpected string, sampledExpected bool) {
+		t.Helper()
+
+		sc, err := ParseTraceparent(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if traceID := sc.TraceID.String(); traceID != traceIDExpected {
+			t.Fatalf("unexpected trace id; got %q; want %q", traceID, traceIDExpected)
+		}
+		if spanID := sc.SpanID.String(); spanID != spanIDExpected {
+			t.Fatalf("unexpected span id; got %q; want %q", spanID, spanIDExpected)
+		}
+		if sc.Sampled != sampledExpected {
+			t.Fatalf("unexpected sampled flag; got %v; want %v", sc.Sampled, sampledExpected)
+		}
+	}
+
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false)
+
+	// unknown flags are ignored
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+
+	// future version with additional fields
+	f("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foobar", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+}
+
+func TestParseTraceparentFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+
+	f("")
+	f("foobar")
+
+	// too short
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0")
+
+	// too long for version 00
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foobar")
+
+	// invalid version
+	f("ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// uppercase hex
+	f("00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+
+	// zero trace id
+	f("00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+
+	// zero span id
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01")
+
+	// invalid delimiters
+	f("00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01")
+}
+
+func TestSpanContextTraceparent(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		sc, err := ParseTraceparent(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := sc.Traceparent(); result != s {
+			t.Fatalf("unexpected traceparent; got %q; want %q", result, s)
+		}
+	}
+
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+}
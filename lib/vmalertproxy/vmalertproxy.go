@@ -1,10 +1,13 @@
 package vmalertproxy
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
@@ -20,10 +23,38 @@ func Init(proxyURL string) {
 	if err != nil {
 		logger.Fatalf("cannot parse -vmalert.proxyURL=%q: %s", proxyURL, err)
 	}
+	vmalertProxyURL = pu
 	vmalertProxyHost = pu.Host
 	vmalertProxy = httputil.NewSingleHostReverseProxy(pu)
 }
 
+// IsEnabled returns true if proxyURL was passed to Init.
+func IsEnabled() bool {
+	return vmalertProxyURL != nil
+}
+
+// Get returns the response body for GET request to the given path with the given args at vmalert.
+//
+// It can be called only if IsEnabled returns true.
+func Get(path string, args url.Values) ([]byte, error) {
+	u := *vmalertProxyURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = args.Encode()
+	resp, err := vmalertClient.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch %q: %w", u.Redacted(), err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response from %q: %w", u.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code for %q; got %d; want %d; response body: %q", u.Redacted(), resp.StatusCode, http.StatusOK, data)
+	}
+	return data, nil
+}
+
 // HandleRequest proxies the given request path to vmalert at proxyURL passed to Init().
 func HandleRequest(w http.ResponseWriter, r *http.Request, path string) {
 	defer func() {
@@ -63,6 +94,11 @@ func HandleRequest(w http.ResponseWriter, r *http.Request, path string) {
 }
 
 var (
+	vmalertProxyURL  *url.URL
 	vmalertProxyHost string
 	vmalertProxy     *httputil.ReverseProxy
 )
+
+var vmalertClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
@@ -26,5 +26,6 @@ var (
 type API interface {
 	WriteRows(rows []storage.MetricRow) error
 	WriteMetadata(mrs []metricsmetadata.Row) error
+	WriteExemplars(rows []storage.ExemplarRow) error
 	IsReadOnly() bool
 }
@@ -624,3 +624,13 @@ func (c *Cache) SetBig(key, value []byte) {
 	curr := c.curr.Load()
 	curr.SetBig(key, value)
 }
+
+// Del deletes the value for the given key.
+//
+// It works for values stored via both Set and SetBig.
+func (c *Cache) Del(key []byte) {
+	curr := c.curr.Load()
+	curr.Del(key)
+	prev := c.prev.Load()
+	prev.Del(key)
+}